@@ -0,0 +1,167 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package a2r
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/checker"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// GatewayConfig configures MountService.
+type GatewayConfig struct {
+	// Prefix of the routes, defaults to "/" and the snake_case service name,
+	// e.g. "/user" for openim.user.user.
+	Prefix string
+	// Methods mounts only the listed methods. Empty mounts every unary method.
+	Methods []string
+	// Middleware runs before every mounted route, e.g. token parsing and
+	// operation ID handling shared with the api routes.
+	Middleware []gin.HandlerFunc
+	// Path maps a method name to its route relative to Prefix, defaults to
+	// "/" and the snake_case method name, e.g. "/get_users_info".
+	Path func(method string) string
+}
+
+// Route is a mounted method.
+type Route struct {
+	HTTPMethod string
+	Path       string
+	FullMethod string // gRPC method, e.g. "/openim.user.user/getUsersInfo".
+}
+
+// MountService exposes the unary methods of a gRPC service registered in
+// the global proto registry as POST routes on r, e.g. for admin RPCs of
+// small deployments that run no separate api binary. Request bodies are
+// proto JSON decoded with jsonutil.ProtoUnmarshal, the call goes through
+// conn with the gin context, so client interceptors see the values set by
+// the middleware, and results are written in the apiresp envelope.
+func MountService(r gin.IRouter, conn grpc.ClientConnInterface, service string, conf GatewayConfig) ([]Route, error) {
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "grpc service not registered", "service", service)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("not a grpc service", "service", service)
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "/" + snakeCase(string(sd.Name()))
+	}
+	if conf.Path == nil {
+		conf.Path = func(method string) string { return "/" + snakeCase(method) }
+	}
+	var methods []protoreflect.MethodDescriptor
+	if len(conf.Methods) == 0 {
+		for i := 0; i < sd.Methods().Len(); i++ {
+			if md := sd.Methods().Get(i); !md.IsStreamingClient() && !md.IsStreamingServer() {
+				methods = append(methods, md)
+			}
+		}
+	} else {
+		for _, name := range conf.Methods {
+			md := sd.Methods().ByName(protoreflect.Name(name))
+			if md == nil {
+				return nil, errs.ErrArgs.WrapMsg("grpc method not found", "service", service, "method", name)
+			}
+			if md.IsStreamingClient() || md.IsStreamingServer() {
+				return nil, errs.ErrArgs.WrapMsg("streaming grpc methods cannot be mounted", "service", service, "method", name)
+			}
+			methods = append(methods, md)
+		}
+	}
+	group := r.Group(conf.Prefix, conf.Middleware...)
+	routes := make([]Route, 0, len(methods))
+	for _, md := range methods {
+		route := Route{
+			HTTPMethod: http.MethodPost,
+			Path:       strings.TrimSuffix(conf.Prefix, "/") + conf.Path(string(md.Name())),
+			FullMethod: "/" + service + "/" + string(md.Name()),
+		}
+		group.POST(conf.Path(string(md.Name())), gatewayHandler(conn, route.FullMethod, md))
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func gatewayHandler(conn grpc.ClientConnInterface, fullMethod string, md protoreflect.MethodDescriptor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req := newMessage(md.Input())
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apiresp.GinError(c, errs.WrapMsg(err, "read request body failed", "method", fullMethod))
+			return
+		}
+		if len(body) > 0 {
+			if err := jsonutil.ProtoUnmarshal(body, req); err != nil {
+				apiresp.GinError(c, errs.NewCodeError(errs.ArgsError, err.Error()))
+				return
+			}
+		}
+		if err := checker.Validate(req); err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		resp := newMessage(md.Output())
+		if err := conn.Invoke(c, fullMethod, req, resp); err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		data, err := jsonutil.ProtoMarshal(resp)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		apiresp.GinSuccess(c, json.RawMessage(data))
+	}
+}
+
+// newMessage returns the generated type of md when it is linked in, so
+// Check methods used by checker.Validate apply, or else a dynamic message.
+func newMessage(md protoreflect.MessageDescriptor) proto.Message {
+	if mt, err := protoregistry.GlobalTypes.FindMessageByName(md.FullName()); err == nil {
+		return mt.New().Interface()
+	}
+	return dynamicpb.NewMessage(md)
+}
+
+// snakeCase converts "GetUsersInfo" and "getUsersInfo" to "get_users_info".
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,111 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package a2r
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestSnakeCase(t *testing.T) {
+	for in, want := range map[string]string{
+		"GetUsersInfo": "get_users_info",
+		"getUsersInfo": "get_users_info",
+		"Check":        "check",
+		"GetURLInfo":   "get_url_info",
+		"health":       "health",
+	} {
+		assert.Equal(t, want, snakeCase(in), in)
+	}
+}
+
+func TestMountService(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	hs := health.NewServer()
+	hs.SetServingStatus("msg", grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(srv, hs)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var calls int
+	routes, err := MountService(r, conn, grpc_health_v1.Health_ServiceDesc.ServiceName, GatewayConfig{
+		Middleware: []gin.HandlerFunc{func(c *gin.Context) { calls++ }},
+	})
+	require.NoError(t, err)
+	// The streaming Watch method is skipped.
+	assert.Equal(t, []Route{{HTTPMethod: http.MethodPost, Path: "/health/check", FullMethod: "/grpc.health.v1.Health/Check"}}, routes)
+
+	post := func(path, body string) *apiresp.ApiResponse {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			apiresp.ApiResponse
+			Data json.RawMessage `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		resp.ApiResponse.Data = resp.Data
+		return &resp.ApiResponse
+	}
+
+	resp := post("/health/check", `{"service":"msg"}`)
+	assert.Equal(t, 0, resp.ErrCode)
+	assert.JSONEq(t, `{"status":1}`, string(resp.Data.(json.RawMessage)))
+	resp = post("/health/check", "")
+	assert.Equal(t, 0, resp.ErrCode)
+
+	resp = post("/health/check", `{"service":1}`)
+	assert.Equal(t, errs.ArgsError, resp.ErrCode)
+	resp = post("/health/check", `{"service":"unknown"}`)
+	assert.NotEqual(t, 0, resp.ErrCode)
+	assert.Equal(t, 4, calls)
+
+	_, err = MountService(gin.New(), conn, grpc_health_v1.Health_ServiceDesc.ServiceName, GatewayConfig{Methods: []string{"Watch"}})
+	assert.Error(t, err)
+	_, err = MountService(gin.New(), conn, "no.such.Service", GatewayConfig{})
+	assert.Error(t, err)
+
+	routes, err = MountService(gin.New(), conn, grpc_health_v1.Health_ServiceDesc.ServiceName, GatewayConfig{
+		Prefix:  "/admin/",
+		Methods: []string{"Check"},
+		Path:    func(method string) string { return "/" + method },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/admin/Check", routes[0].Path)
+}
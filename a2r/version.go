@@ -0,0 +1,234 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package a2r
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+)
+
+// VersionKey is the gin context key of the API version of a request.
+const VersionKey = "apiVersion"
+
+// VersionConfig configures a versioned route group.
+type VersionConfig struct {
+	// Version is the path segment of the group, e.g. "v3".
+	Version string
+	// Middleware runs only on this version, e.g. the old token parsing kept
+	// for v3 while v4 uses the new one.
+	Middleware []gin.HandlerFunc
+	// Deprecated announces the version as deprecated with the Deprecation
+	// header, dated DeprecatedAt when set.
+	Deprecated   bool
+	DeprecatedAt time.Time
+	// Sunset is the date the version stops working, sent in the Sunset header.
+	Sunset time.Time
+	// Successor is linked as the successor version, e.g. "/v4".
+	Successor string
+}
+
+// APIVersion returns the version of the group that routed c, or "" outside
+// versioned groups.
+func APIVersion(c *gin.Context) string {
+	return c.GetString(VersionKey)
+}
+
+// Version returns the route group of a version below r, e.g. /v3. Routes
+// registered on it see the version through APIVersion and, for deprecated
+// versions, answer with the Deprecation, Sunset and Link headers.
+func Version(r gin.IRouter, conf VersionConfig) *gin.RouterGroup {
+	version := strings.Trim(conf.Version, "/")
+	header := make(http.Header)
+	if conf.Deprecated || !conf.DeprecatedAt.IsZero() {
+		if conf.DeprecatedAt.IsZero() {
+			header.Set("Deprecation", "true")
+		} else {
+			header.Set("Deprecation", "@"+strconv.FormatInt(conf.DeprecatedAt.Unix(), 10))
+		}
+	}
+	if !conf.Sunset.IsZero() {
+		header.Set("Sunset", conf.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if conf.Successor != "" {
+		header.Set("Link", "<"+conf.Successor+`>; rel="successor-version"`)
+	}
+	handlers := make([]gin.HandlerFunc, 0, len(conf.Middleware)+1)
+	handlers = append(handlers, func(c *gin.Context) {
+		c.Set(VersionKey, version)
+		for k, v := range header {
+			c.Writer.Header()[k] = v
+		}
+		c.Next()
+	})
+	handlers = append(handlers, conf.Middleware...)
+	return r.Group("/"+version, handlers...)
+}
+
+// Shim declares how the JSON request body of an old API shape is rewritten
+// into the current one, so a route of an old version can reuse the handler
+// and RPC of the new version. Keys are dot separated paths into nested
+// objects, e.g. "msg.sendID". Drop runs first, then Rename, Defaults and
+// Transform.
+type Shim struct {
+	// Drop removes fields the new shape no longer accepts.
+	Drop []string
+	// Rename moves the value at an old path to a new path.
+	Rename map[string]string
+	// Defaults sets fields missing from the old shape.
+	Defaults map[string]any
+	// Transform edits the rewritten body for changes the fields above cannot
+	// express, e.g. converting units.
+	Transform func(body map[string]any) error
+}
+
+// Gin returns a middleware applying the shim to the request body.
+func (s Shim) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := s.apply(c.Request); err != nil {
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Handle wraps a handler of the new shape for a route of the old one.
+func (s Shim) Handle(handler gin.HandlerFunc) gin.HandlerFunc {
+	shim := s.Gin()
+	return func(c *gin.Context) {
+		shim(c)
+		if !c.IsAborted() {
+			handler(c)
+		}
+	}
+}
+
+func (s Shim) apply(r *http.Request) error {
+	var data []byte
+	if r.Body != nil {
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			return errs.WrapMsg(err, "read request body failed")
+		}
+	}
+	body := make(map[string]any)
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber() // Keeps int64 IDs exact.
+		if err := dec.Decode(&body); err != nil {
+			return errs.NewCodeError(errs.ArgsError, err.Error())
+		}
+	}
+	if err := s.Rewrite(body); err != nil {
+		return err
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errs.WrapMsg(err, "marshal shimmed request body failed")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	return nil
+}
+
+// Rewrite applies the shim to a decoded body.
+func (s Shim) Rewrite(body map[string]any) error {
+	for _, path := range s.Drop {
+		takePath(body, path)
+	}
+	for from, to := range s.Rename {
+		if v, ok := takePath(body, from); ok {
+			if err := setPath(body, to, v); err != nil {
+				return err
+			}
+		}
+	}
+	for path, v := range s.Defaults {
+		if _, ok := lookupPath(body, path); !ok {
+			if err := setPath(body, path, v); err != nil {
+				return err
+			}
+		}
+	}
+	if s.Transform != nil {
+		return s.Transform(body)
+	}
+	return nil
+}
+
+func lookupPath(body map[string]any, path string) (any, bool) {
+	keys := strings.Split(path, ".")
+	cur := body
+	for i, key := range keys {
+		v, ok := cur[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(keys)-1 {
+			return v, true
+		}
+		if cur, ok = v.(map[string]any); !ok {
+			return nil, false
+		}
+	}
+	return nil, false
+}
+
+func takePath(body map[string]any, path string) (any, bool) {
+	parent := body
+	if i := strings.LastIndexByte(path, '.'); i >= 0 {
+		v, ok := lookupPath(body, path[:i])
+		if !ok {
+			return nil, false
+		}
+		if parent, ok = v.(map[string]any); !ok {
+			return nil, false
+		}
+		path = path[i+1:]
+	}
+	v, ok := parent[path]
+	delete(parent, path)
+	return v, ok
+}
+
+func setPath(body map[string]any, path string, value any) error {
+	keys := strings.Split(path, ".")
+	cur := body
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := cur[key]
+		if !ok {
+			m := make(map[string]any)
+			cur[key] = m
+			cur = m
+			continue
+		}
+		if cur, ok = next.(map[string]any); !ok {
+			return errs.ErrArgs.WrapMsg("shim path crosses a non object field", "path", path, "field", key)
+		}
+	}
+	cur[keys[len(keys)-1]] = value
+	return nil
+}
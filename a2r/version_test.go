@@ -0,0 +1,102 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package a2r
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sendMsgReq struct {
+	SendID     string `json:"sendID"`
+	RecvID     string `json:"recvID"`
+	Seq        int64  `json:"seq"`
+	PlatformID int    `json:"platformID"`
+	Content    struct {
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+func TestVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var got *sendMsgReq
+	var version string
+	handler := func(c *gin.Context) {
+		req, err := ParseRequestNotCheck[sendMsgReq](c)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		got, version = req, APIVersion(c)
+		apiresp.GinSuccess(c, nil)
+	}
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	Version(r, VersionConfig{Version: "v4"}).POST("/msg/send", handler)
+	Version(r, VersionConfig{Version: "v3", Deprecated: true, Sunset: sunset, Successor: "/v4"}).
+		POST("/msg/send", Shim{
+			Drop:     []string{"legacy"},
+			Rename:   map[string]string{"fromUserID": "sendID", "toUserID": "recvID", "text": "content.text"},
+			Defaults: map[string]any{"platformID": 5},
+		}.Handle(handler))
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v3/msg/send",
+		strings.NewReader(`{"fromUserID":"a","toUserID":"b","text":"hi","seq":9007199254740993,"legacy":true}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v4>; rel="successor-version"`, w.Header().Get("Link"))
+	require.NotNil(t, got)
+	assert.Equal(t, "v3", version)
+	assert.Equal(t, "a", got.SendID)
+	assert.Equal(t, "b", got.RecvID)
+	assert.Equal(t, "hi", got.Content.Text)
+	assert.Equal(t, int64(9007199254740993), got.Seq)
+	assert.Equal(t, 5, got.PlatformID)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v4/msg/send", strings.NewReader(`{"sendID":"c","platformID":1}`)))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Equal(t, "v4", version)
+	assert.Equal(t, "c", got.SendID)
+	assert.Equal(t, 1, got.PlatformID)
+}
+
+func TestShimRewrite(t *testing.T) {
+	body := map[string]any{"a": map[string]any{"b": 1, "c": 2}, "d": "x"}
+	require.NoError(t, Shim{
+		Drop:   []string{"a.c"},
+		Rename: map[string]string{"a.b": "e.f"},
+		Transform: func(body map[string]any) error {
+			body["d"] = body["d"].(string) + "y"
+			return nil
+		},
+	}.Rewrite(body))
+	data, err := json.Marshal(body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a":{},"d":"xy","e":{"f":1}}`, string(data))
+
+	assert.Error(t, Shim{Rename: map[string]string{"a": "d.x"}}.Rewrite(body))
+}
@@ -0,0 +1,103 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiclient
+
+import (
+	"context"
+)
+
+// Api is a typed endpoint taking Req and returning Resp.
+type Api[Req, Resp any] struct {
+	client     *Client
+	path       string
+	idempotent bool
+}
+
+// NewApi binds the endpoint at path to c.
+func NewApi[Req, Resp any](c *Client, path string) *Api[Req, Resp] {
+	return &Api[Req, Resp]{client: c, path: path}
+}
+
+// Path returns the path of the endpoint.
+func (a *Api[Req, Resp]) Path() string {
+	return a.path
+}
+
+// Idempotent returns a copy of the endpoint whose calls are retried like
+// Client.CallIdempotent. Use it only for endpoints that may safely run twice.
+func (a *Api[Req, Resp]) Idempotent() *Api[Req, Resp] {
+	api := *a
+	api.idempotent = true
+	return &api
+}
+
+// Call invokes the endpoint.
+func (a *Api[Req, Resp]) Call(ctx context.Context, req *Req) (*Resp, error) {
+	var resp Resp
+	if err := a.client.call(ctx, a.path, req, &resp, a.idempotent); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Page describes how an endpoint is paginated. OpenIM endpoints take a
+// pagination of 1-based pageNumber and showNumber and return one page of items.
+type Page[Req, Resp, E any] struct {
+	// ShowNumber is the page size, 0 means 100.
+	ShowNumber int32
+	// SetPage stores the page to fetch into the request.
+	SetPage func(req *Req, pageNumber, showNumber int32)
+	// Items extracts the items of a page from the response.
+	Items func(resp *Resp) []E
+}
+
+// Each calls fn for every item returned by api, fetching one page after the
+// other until a page is not full. Iteration stops at the first error returned
+// by the endpoint or by fn.
+func Each[Req, Resp, E any](ctx context.Context, api *Api[Req, Resp], req *Req, page Page[Req, Resp, E], fn func(item E) error) error {
+	showNumber := page.ShowNumber
+	if showNumber <= 0 {
+		showNumber = 100
+	}
+	for pageNumber := int32(1); ; pageNumber++ {
+		page.SetPage(req, pageNumber, showNumber)
+		resp, err := api.Call(ctx, req)
+		if err != nil {
+			return err
+		}
+		items := page.Items(resp)
+		for _, item := range items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if len(items) < int(showNumber) {
+			return nil
+		}
+	}
+}
+
+// All collects the items of every page of api.
+func All[Req, Resp, E any](ctx context.Context, api *Api[Req, Resp], req *Req, page Page[Req, Resp, E]) ([]E, error) {
+	var res []E
+	err := Each(ctx, api, req, page, func(item E) error {
+		res = append(res, item)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
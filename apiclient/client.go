@@ -0,0 +1,240 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package apiclient is a typed HTTP client for OpenIM style JSON APIs that
+// answer with the apiresp envelope.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/utils/idutil"
+	"github.com/openimsdk/tools/utils/jsonutil"
+)
+
+const (
+	DefaultTimeout       = 15 * time.Second
+	DefaultMaxRetry      = 2
+	DefaultRetryInterval = 200 * time.Millisecond
+)
+
+// TokenFunc returns the token sent with each request, for example a cached admin token.
+type TokenFunc func(ctx context.Context) (string, error)
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the underlying http.Client.
+func WithHTTPClient(cli *http.Client) Option {
+	return func(c *Client) {
+		c.http = cli
+	}
+}
+
+// WithToken sends a fixed token with every request.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = func(context.Context) (string, error) { return token, nil }
+	}
+}
+
+// WithTokenFunc obtains the token for every request from fn.
+func WithTokenFunc(fn TokenFunc) Option {
+	return func(c *Client) {
+		c.token = fn
+	}
+}
+
+// WithHeader adds a header to every request.
+func WithHeader(key, value string) Option {
+	return func(c *Client) {
+		c.header.Set(key, value)
+	}
+}
+
+// WithRetry sets how often a request is retried and the initial wait between
+// attempts, which doubles after each retry. A request is retried only when it
+// provably did not reach the server, i.e. it could not connect, or the server
+// rejected it with 429 or 503. Calls made with CallIdempotent are retried after
+// any transport failure and the statuses 502 and 504 as well. Business errors
+// are retried only when their code is classified errs.Retryable.
+func WithRetry(maxRetry int, interval time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetry = maxRetry
+		c.retryInterval = interval
+	}
+}
+
+// Client calls JSON APIs below a base URL.
+type Client struct {
+	baseURL       string
+	http          *http.Client
+	token         TokenFunc
+	header        http.Header
+	maxRetry      int
+	retryInterval time.Duration
+}
+
+// New creates a Client for the API served at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		http:          &http.Client{Timeout: DefaultTimeout},
+		header:        make(http.Header),
+		maxRetry:      DefaultMaxRetry,
+		retryInterval: DefaultRetryInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// response mirrors apiresp.ApiResponse with the data left undecoded.
+type response struct {
+	ErrCode int             `json:"errCode"`
+	ErrMsg  string          `json:"errMsg"`
+	ErrDlt  string          `json:"errDlt"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// Call posts req as JSON to path and decodes the data of the response into resp,
+// which may be nil. A non zero errCode is returned as an errs.CodeError.
+func (c *Client) Call(ctx context.Context, path string, req, resp any) error {
+	return c.call(ctx, path, req, resp, false)
+}
+
+// CallIdempotent is Call for endpoints that may safely run more than once, such
+// as queries, so that it is also retried when the request may have been
+// executed, e.g. after a timeout.
+func (c *Client) CallIdempotent(ctx context.Context, path string, req, resp any) error {
+	return c.call(ctx, path, req, resp, true)
+}
+
+func (c *Client) call(ctx context.Context, path string, req, resp any, idempotent bool) error {
+	body, err := jsonutil.JsonMarshal(req)
+	if err != nil {
+		return err
+	}
+	url := c.baseURL + "/" + strings.TrimPrefix(path, "/")
+	operationID := mcontext.GetOperationID(ctx)
+	if operationID == "" {
+		operationID = idutil.OperationIDGenerator()
+	}
+	header := c.header.Clone()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set(constant.OperationID, operationID)
+	if c.token != nil {
+		token, err := c.token(ctx)
+		if err != nil {
+			return err
+		}
+		header.Set(constant.Token, token)
+	}
+	res, err := c.do(ctx, url, header, body, idempotent)
+	if err != nil {
+		return err
+	}
+	if resp == nil || len(res.Data) == 0 || string(res.Data) == "null" {
+		return nil
+	}
+	if err := jsonutil.JsonUnmarshal(res.Data, resp); err != nil {
+		return errs.WrapMsg(err, "api response data decode failed", "url", url, "operationID", operationID)
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, url string, header http.Header, body []byte, idempotent bool) (*response, error) {
+	wait := c.retryInterval
+	for attempt := 0; ; attempt++ {
+		res, class, err := c.send(ctx, url, header, body)
+		retry := class == errs.Retryable || (idempotent && class == errs.Temporary)
+		if err == nil || !retry || attempt >= c.maxRetry {
+			return res, err
+		}
+		log.ZWarn(ctx, "api request failed, retrying", err, "url", url, "attempt", attempt+1)
+		select {
+		case <-ctx.Done():
+			return nil, errs.WrapMsg(ctx.Err(), "api request canceled", "url", url)
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// send posts the request once and decodes the envelope. The returned class
+// tells whether the server may have executed the request: Retryable only when
+// it certainly did not. Failed round trips and errCodes are classified by
+// errs.RetryClassOf.
+func (c *Client) send(ctx context.Context, url string, header http.Header, body []byte) (*response, errs.RetryClass, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errs.Permanent, errs.WrapMsg(err, "NewRequestWithContext failed", "url", url)
+	}
+	req.Header = header
+	resp, err := c.http.Do(req)
+	if err != nil {
+		class := errs.RetryClassOf(err)
+		if ctx.Err() != nil {
+			class = errs.Permanent
+		}
+		return nil, class, errs.WrapMsg(err, "api request failed", "url", url)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		// The server answered, so it received the request.
+		return nil, errs.Temporary, errs.WrapMsg(err, "read api response failed", "url", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := errs.New("unexpected api status", "url", url, "status", resp.StatusCode, "body", truncate(data, 256)).Wrap()
+		switch resp.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return nil, errs.Retryable, err
+		case http.StatusBadGateway, http.StatusGatewayTimeout:
+			// A gateway may have forwarded the request before failing.
+			return nil, errs.Temporary, err
+		}
+		return nil, errs.Permanent, err
+	}
+	var res response
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errs.Permanent, errs.WrapMsg(err, "api response is not json", "url", url, "operationID", header.Get(constant.OperationID))
+	}
+	if res.ErrCode != 0 {
+		codeErr := errs.NewCodeError(res.ErrCode, res.ErrMsg)
+		if res.ErrDlt != "" {
+			codeErr = codeErr.WithDetail(res.ErrDlt)
+		}
+		return nil, errs.RetryClassOf(codeErr), codeErr.Wrap()
+	}
+	return &res, errs.Permanent, nil
+}
+
+func truncate(data []byte, n int) string {
+	if len(data) > n {
+		data = data[:n]
+	}
+	return string(data)
+}
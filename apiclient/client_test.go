@@ -0,0 +1,206 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/protocol/sdkws"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+type getUsersReq struct {
+	Pagination *sdkws.RequestPagination `json:"pagination"`
+}
+
+type getUsersResp struct {
+	Total int32    `json:"total"`
+	Users []string `json:"users"`
+}
+
+func newServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCall(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/user/get_users", r.URL.Path)
+		assert.Equal(t, "admin-token", r.Header.Get(constant.Token))
+		assert.Equal(t, "op1", r.Header.Get(constant.OperationID))
+		var req getUsersReq
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		apiresp.HttpSuccess(w, &getUsersResp{Total: 1, Users: []string{"u1"}})
+	})
+	c := New(srv.URL+"/", WithToken("admin-token"))
+	api := NewApi[getUsersReq, getUsersResp](c, "/user/get_users")
+	resp, err := api.Call(mcontext.SetOperationID(context.Background(), "op1"), &getUsersReq{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, resp.Users)
+}
+
+func TestCallErrCode(t *testing.T) {
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		apiresp.HttpError(w, errs.ErrRecordNotFound.WrapMsg("user not found"))
+	})
+	var calls atomic.Int32
+	c := New(srv.URL, WithTokenFunc(func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "t", nil
+	}))
+	err := c.Call(context.Background(), "user/get_users", &getUsersReq{}, nil)
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	var codeErr errs.CodeError
+	require.ErrorAs(t, err, &codeErr)
+	assert.Equal(t, errs.RecordNotFoundError, codeErr.Code())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCallRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		apiresp.HttpSuccess(w, nil)
+	})
+	c := New(srv.URL, WithRetry(2, time.Millisecond))
+	require.NoError(t, c.Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(0)
+	c = New(srv.URL, WithRetry(1, time.Millisecond))
+	assert.Error(t, c.Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCallNoRetryOnClientError(t *testing.T) {
+	var calls atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	assert.Error(t, New(srv.URL, WithRetry(3, time.Millisecond)).Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCallRetryIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			// The request was executed, but the gateway failed to answer.
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		apiresp.HttpSuccess(w, nil)
+	})
+	c := New(srv.URL, WithRetry(2, time.Millisecond))
+	assert.Error(t, c.Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(1), calls.Load())
+
+	calls.Store(0)
+	require.NoError(t, c.CallIdempotent(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(0)
+	api := NewApi[getUsersReq, getUsersResp](c, "/ping").Idempotent()
+	_, err := api.Call(context.Background(), &getUsersReq{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCallNoRetryAfterTimeout(t *testing.T) {
+	var calls atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+		apiresp.HttpSuccess(w, nil)
+	})
+	c := New(srv.URL, WithRetry(2, time.Millisecond), WithHTTPClient(&http.Client{Timeout: 10 * time.Millisecond}))
+	assert.Error(t, c.Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCallRetryConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+	c := New(url)
+	_, class, err := c.send(context.Background(), url+"/ping", make(http.Header), nil)
+	assert.Error(t, err)
+	assert.Equal(t, errs.Retryable, class)
+}
+
+func TestCallRetryableCode(t *testing.T) {
+	var calls atomic.Int32
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			_, _ = fmt.Fprintf(w, `{"errCode":%d,"errMsg":"Unavailable"}`, codes.Unavailable)
+			return
+		}
+		apiresp.HttpSuccess(w, nil)
+	})
+	require.NoError(t, New(srv.URL, WithRetry(2, time.Millisecond)).Call(context.Background(), "/ping", nil, nil))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestEach(t *testing.T) {
+	users := []string{"u1", "u2", "u3", "u4", "u5"}
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var req getUsersReq
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		start := int((req.Pagination.PageNumber - 1) * req.Pagination.ShowNumber)
+		end := min(start+int(req.Pagination.ShowNumber), len(users))
+		apiresp.HttpSuccess(w, &getUsersResp{Total: int32(len(users)), Users: users[min(start, end):end]})
+	})
+	api := NewApi[getUsersReq, getUsersResp](New(srv.URL), "/user/get_users")
+	page := Page[getUsersReq, getUsersResp, string]{
+		ShowNumber: 2,
+		SetPage: func(req *getUsersReq, pageNumber, showNumber int32) {
+			req.Pagination = &sdkws.RequestPagination{PageNumber: pageNumber, ShowNumber: showNumber}
+		},
+		Items: func(resp *getUsersResp) []string { return resp.Users },
+	}
+	all, err := All(context.Background(), api, &getUsersReq{}, page)
+	require.NoError(t, err)
+	assert.Equal(t, users, all)
+
+	stop := errs.New("stop")
+	var seen []string
+	err = Each(context.Background(), api, &getUsersReq{}, page, func(u string) error {
+		seen = append(seen, u)
+		if len(seen) == 3 {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, users[:3], seen)
+}
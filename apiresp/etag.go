@@ -0,0 +1,115 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+)
+
+const PreconditionFailedError = 1881 // The resource changed since the client read it.
+
+var ErrPreconditionFailed = errs.NewCodeError(PreconditionFailedError, "PreconditionFailedError")
+
+// ETag returns a strong entity tag of data, computed from its canonical JSON
+// so equal payloads get the same tag regardless of map order or encoder.
+func ETag(data any) (string, error) {
+	raw, err := jsonutil.JsonMarshal(data)
+	if err != nil {
+		return "", errs.WrapMsg(err, "marshal etag payload failed")
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return "", errs.WrapMsg(err, "decode etag payload failed")
+	}
+	// encoding/json writes map keys sorted, which makes the encoding canonical.
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", errs.WrapMsg(err, "marshal canonical etag payload failed")
+	}
+	sum := sha256.Sum256(canonical)
+	return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// matchETag reports whether etag is listed in an If-Match or If-None-Match
+// header. weak compares ignoring the W/ prefix, as If-None-Match requires.
+func matchETag(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+			etag = strings.TrimPrefix(etag, "W/")
+		} else if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// GinSuccessETag writes data like GinSuccess with its ETag, or only 304 Not
+// Modified when the If-None-Match header of the request lists the tag.
+func GinSuccessETag(c *gin.Context, data any) {
+	etag, err := ETag(data)
+	if err != nil {
+		GinError(c, err)
+		return
+	}
+	c.Header("ETag", etag)
+	if inm := c.GetHeader("If-None-Match"); inm != "" && matchETag(inm, etag, true) {
+		c.Status(http.StatusNotModified)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	GinSuccess(c, data)
+}
+
+// CheckIfMatch implements If-Match for optimistic concurrency on updates:
+// current is the resource as stored, and ErrPreconditionFailed is returned
+// if the request carries If-Match and it does not list the tag of current.
+// Requests without the header pass.
+func CheckIfMatch(c *gin.Context, current any) error {
+	im := c.GetHeader("If-Match")
+	if im == "" {
+		return nil
+	}
+	etag, err := ETag(current)
+	if err != nil {
+		return err
+	}
+	return CheckIfMatchETag(c, etag)
+}
+
+// CheckIfMatchETag is CheckIfMatch for a tag the caller computed, e.g. from
+// a version field.
+func CheckIfMatchETag(c *gin.Context, etag string) error {
+	im := c.GetHeader("If-Match")
+	if im == "" || matchETag(im, etag, false) {
+		return nil
+	}
+	return ErrPreconditionFailed.WrapMsg("if-match does not match", "ifMatch", im, "etag", etag)
+}
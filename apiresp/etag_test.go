@@ -0,0 +1,98 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestETag(t *testing.T) {
+	type group struct {
+		GroupID string         `json:"groupID"`
+		Ex      map[string]int `json:"ex"`
+	}
+	a, err := ETag(group{GroupID: "g1", Ex: map[string]int{"a": 1, "b": 2}})
+	require.NoError(t, err)
+	b, err := ETag(map[string]any{"ex": map[string]int{"b": 2, "a": 1}, "groupID": "g1"})
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+	assert.Regexp(t, `^"[A-Za-z0-9_-]{22}"$`, a)
+	c, err := ETag(group{GroupID: "g2"})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, c)
+
+	assert.True(t, matchETag(`"x", `+a, a, false))
+	assert.True(t, matchETag(`*`, a, false))
+	assert.False(t, matchETag(`W/`+a, a, false))
+	assert.True(t, matchETag(`W/`+a, a, true))
+	assert.False(t, matchETag(`"other"`, a, true))
+}
+
+func TestGinETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	data := map[string]string{"groupID": "g1", "name": "old"}
+	r := gin.New()
+	r.GET("/group", func(c *gin.Context) { GinSuccessETag(c, data) })
+	r.POST("/group", func(c *gin.Context) {
+		if err := CheckIfMatch(c, data); err != nil {
+			GinError(c, err)
+			return
+		}
+		data = map[string]string{"groupID": "g1", "name": "new"}
+		GinSuccessETag(c, data)
+	})
+	do := func(method, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/group", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = do(http.MethodGet, "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = do(http.MethodPost, "If-Match", `"stale"`)
+	assert.Contains(t, w.Body.String(), `"errCode":1881`)
+	w = do(http.MethodPost, "If-Match", etag)
+	assert.Contains(t, w.Body.String(), `"errCode":0`)
+	assert.NotEqual(t, etag, w.Header().Get("ETag"))
+
+	// The old tag no longer matches the updated resource.
+	w = do(http.MethodGet, "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.NoError(t, CheckIfMatchETag(c, `"v1"`))
+	c.Request.Header.Set("If-Match", `"v2"`)
+	assert.True(t, errors.Is(CheckIfMatchETag(c, `"v1"`), ErrPreconditionFailed))
+}
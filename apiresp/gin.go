@@ -38,7 +38,13 @@ func GetGinApiResponse(c *gin.Context) *ApiResponse {
 	return resp
 }
 
+// GinError writes err in the legacy envelope, or as problem+json when the
+// route uses ProblemJSON or the client accepts application/problem+json.
 func GinError(c *gin.Context, err error) {
+	if wantsProblem(c) {
+		GinProblem(c, err)
+		return
+	}
 	ginJson(c, ParseError(err))
 }
 
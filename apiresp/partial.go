@@ -0,0 +1,77 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/utils/datautil"
+)
+
+// PartialData is the data of a batch response that succeeded for some keys
+// only. Found is ordered like the requested keys.
+type PartialData[K comparable, V any] struct {
+	Found   []V               `json:"found"`
+	Missing []K               `json:"missing"`
+	Failed  []PartialError[K] `json:"failed"`
+}
+
+// PartialError is the error of a single key, in the fields of ApiResponse.
+type PartialError[K comparable] struct {
+	Key     K      `json:"key"`
+	ErrCode int    `json:"errCode"`
+	ErrMsg  string `json:"errMsg"`
+	ErrDlt  string `json:"errDlt"`
+}
+
+// NewPartialData converts a partial result for the keys of a request.
+func NewPartialData[K comparable, V any](r *datautil.PartialResult[K, V], keys []K) *PartialData[K, V] {
+	data := &PartialData[K, V]{
+		Found:   r.Values(keys),
+		Missing: r.Missing,
+		Failed:  make([]PartialError[K], 0, len(r.Errors)),
+	}
+	if data.Missing == nil {
+		data.Missing = []K{}
+	}
+	for _, k := range datautil.Distinct(keys) {
+		if err, ok := r.Errors[k]; ok {
+			resp := ParseError(err)
+			data.Failed = append(data.Failed, PartialError[K]{Key: k, ErrCode: resp.ErrCode, ErrMsg: resp.ErrMsg, ErrDlt: resp.ErrDlt})
+		}
+	}
+	return data
+}
+
+// GinPartial writes a partial result with errCode 0, so clients read the
+// found values and retry the failed keys. A batch where every lookup failed is
+// written as the error of its first key instead.
+func GinPartial[K comparable, V any](c *gin.Context, r *datautil.PartialResult[K, V], keys []K) {
+	if r.Failed() {
+		GinError(c, r.Err(keys))
+		return
+	}
+	GinSuccess(c, NewPartialData(r, keys))
+}
+
+// HttpPartial is GinPartial for net/http handlers.
+func HttpPartial[K comparable, V any](w http.ResponseWriter, r *datautil.PartialResult[K, V], keys []K) {
+	if r.Failed() {
+		HttpError(w, r.Err(keys))
+		return
+	}
+	HttpSuccess(w, NewPartialData(r, keys))
+}
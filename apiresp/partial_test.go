@@ -0,0 +1,53 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/datautil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGinPartial(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := []string{"u3", "u1", "u2"}
+	r := datautil.NewPartialResult[string, string]()
+	r.Found["u1"], r.Found["u3"] = "alice", "carol"
+	r.Errors["u2"] = errs.ErrInternalServer.WithDetail("shard down")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	GinPartial(c, r, keys)
+	assert.JSONEq(t, `{"errCode":0,"errMsg":"","errDlt":"","data":{
+		"found":["carol","alice"],
+		"missing":[],
+		"failed":[{"key":"u2","errCode":500,"errMsg":"ServerInternalError","errDlt":"shard down"}]}}`, w.Body.String())
+
+	delete(r.Found, "u1")
+	delete(r.Found, "u3")
+	w = httptest.NewRecorder()
+	HttpPartial(w, r, keys)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp ApiResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, errs.ServerInternalError, resp.ErrCode)
+}
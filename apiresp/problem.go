@@ -0,0 +1,155 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/cow"
+	"github.com/openimsdk/tools/utils/jsonutil"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+const ginProblemKey = "gin_api_problem_key"
+
+// ProblemTypeBase prefixes the error code to build the type URI of a problem,
+// e.g. "https://docs.example.com/errors/" gives ".../errors/1004". When empty
+// the type is "about:blank".
+var ProblemTypeBase string
+
+// Problem is an RFC 7807 problem details body. ErrCode carries the errs code
+// as an extension member so clients can still branch on it.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	ErrCode  int    `json:"errCode"`
+}
+
+var problemStatus = cow.NewMap(map[int]int{
+	errs.ServerInternalError:         http.StatusInternalServerError,
+	errs.ArgsError:                   http.StatusBadRequest,
+	errs.NoPermissionError:           http.StatusForbidden,
+	errs.DuplicateKeyError:           http.StatusConflict,
+	errs.RecordNotFoundError:         http.StatusNotFound,
+	errs.ConcurrentModificationError: http.StatusConflict,
+	errs.TokenExpiredError:           http.StatusUnauthorized,
+	errs.TokenInvalidError:           http.StatusUnauthorized,
+	errs.TokenMalformedError:         http.StatusUnauthorized,
+	errs.TokenNotValidYetError:       http.StatusUnauthorized,
+	errs.TokenUnknownError:           http.StatusUnauthorized,
+	errs.TokenKickedError:            http.StatusUnauthorized,
+	errs.TokenNotExistError:          http.StatusUnauthorized,
+	errs.OrgUserNoPermissionError:    http.StatusForbidden,
+	PreconditionFailedError:          http.StatusPreconditionFailed,
+})
+
+// RegisterProblemStatus maps an errs code to the HTTP status of its problem
+// responses. Codes not registered are answered with 400 Bad Request.
+func RegisterProblemStatus(code int, status int) {
+	problemStatus.Set(code, status)
+}
+
+// ProblemStatus returns the HTTP status an errs code is reported with.
+func ProblemStatus(code int) int {
+	if status, ok := problemStatus.Get(code); ok {
+		return status
+	}
+	return http.StatusBadRequest
+}
+
+// ParseProblem converts err into problem details. Errors without a code are
+// reported as 500 without leaking their message into detail.
+func ParseProblem(err error, instance string) *Problem {
+	code, title, detail := errs.ServerInternalError, "ServerInternalError", ""
+	var codeErr errs.CodeError
+	if errors.As(err, &codeErr) {
+		code, title, detail = codeErr.Code(), codeErr.Msg(), codeErr.Detail()
+	}
+	typ := "about:blank"
+	if ProblemTypeBase != "" {
+		typ = ProblemTypeBase + strconv.Itoa(code)
+	}
+	return &Problem{
+		Type:     typ,
+		Title:    title,
+		Status:   ProblemStatus(code),
+		Detail:   detail,
+		Instance: instance,
+		ErrCode:  code,
+	}
+}
+
+// ProblemJSON makes GinError of the routes it is applied to answer with
+// problem+json, e.g. on an external facing group, while the other routes keep
+// the legacy envelope the SDKs expect.
+func ProblemJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ginProblemKey, true)
+		c.Next()
+	}
+}
+
+// wantsProblem reports whether the route opted into problem+json or the client
+// asked for it explicitly.
+func wantsProblem(c *gin.Context) bool {
+	if c.GetBool(ginProblemKey) {
+		return true
+	}
+	return c.Request != nil && strings.Contains(c.GetHeader("Accept"), ProblemContentType)
+}
+
+// GinProblem writes err as problem+json. The legacy response is still recorded
+// so GetGinApiResponse keeps working for logging middleware.
+func GinProblem(c *gin.Context, err error) {
+	var instance string
+	if c.Request != nil {
+		instance = c.Request.URL.Path
+	}
+	problem := ParseProblem(err, instance)
+	c.Set(ginApiResponseKey, ParseError(err))
+	body, err := jsonutil.JsonMarshal(problem)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "json marshal error: "+err.Error())
+		return
+	}
+	c.Data(problem.Status, ProblemContentType, body)
+}
+
+// HttpProblem writes err as problem+json.
+func HttpProblem(w http.ResponseWriter, r *http.Request, err error) {
+	var instance string
+	if r != nil {
+		instance = r.URL.Path
+	}
+	problem := ParseProblem(err, instance)
+	body, err := jsonutil.JsonMarshal(problem)
+	if err != nil {
+		http.Error(w, "json marshal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apiresp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProblem(t *testing.T) {
+	p := ParseProblem(errs.ErrRecordNotFound.WrapMsg("user not found"), "/user/get")
+	assert.Equal(t, "about:blank", p.Type)
+	assert.Equal(t, "RecordNotFoundError", p.Title)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, errs.RecordNotFoundError, p.ErrCode)
+	assert.Equal(t, "/user/get", p.Instance)
+
+	p = ParseProblem(errors.New("db password leaked"), "")
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Empty(t, p.Detail)
+
+	RegisterProblemStatus(1999, http.StatusTooManyRequests)
+	assert.Equal(t, http.StatusTooManyRequests, ParseProblem(errs.NewCodeError(1999, "Busy"), "").Status)
+	assert.Equal(t, http.StatusBadRequest, ParseProblem(errs.NewCodeError(1998, "Other"), "").Status)
+}
+
+func TestGinErrorProblemMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	fail := func(c *gin.Context) { GinError(c, errs.ErrArgs.WithDetail("name required")) }
+	r.GET("/legacy", fail)
+	r.Group("/ext", ProblemJSON()).GET("/x", fail)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/legacy", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var resp ApiResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, errs.ArgsError, resp.ErrCode)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/ext/x", nil),
+		func() *http.Request {
+			req := httptest.NewRequest(http.MethodGet, "/legacy", nil)
+			req.Header.Set("Accept", ProblemContentType)
+			return req
+		}(),
+	} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, ProblemContentType, w.Header().Get("Content-Type"))
+		var p Problem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, "ArgsError", p.Title)
+		assert.Equal(t, "name required", p.Detail)
+		assert.Equal(t, req.URL.Path, p.Instance)
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ldap authenticates users against an LDAP directory or Active
+// Directory. A pool of connections bound as a service account looks users up,
+// the user's own bind checks the password, and directory attributes and group
+// memberships are mapped to OpenIM user fields.
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/xtls"
+)
+
+const (
+	InvalidCredentialsError = 1851 // The username or password is wrong.
+)
+
+var ErrInvalidCredentials = errs.NewCodeError(InvalidCredentialsError, "InvalidCredentialsError")
+
+// Config configures a Client. Filters may reference {username} and, for
+// groups, {dn}; substituted values are escaped.
+type Config struct {
+	URL      string // ldap://host:389 or ldaps://host:636.
+	StartTLS bool   // Upgrade ldap:// connections with StartTLS.
+	TLS      *xtls.ClientConfig
+
+	// BindDN and BindPassword are the service account used to search.
+	BindDN       string
+	BindPassword string
+
+	BaseDN     string
+	UserFilter string // Defaults to "(|(uid={username})(sAMAccountName={username}))".
+	// GroupBaseDN defaults to BaseDN. Leave GroupFilter empty to rely on the
+	// memberOf attribute of the user only.
+	GroupBaseDN string
+	GroupFilter string // e.g. "(|(member={dn})(uniqueMember={dn})(memberUid={username}))".
+	Mapping     AttributeMapping
+
+	PoolSize int           // Idle service connections kept, defaults to 4.
+	Timeout  time.Duration // Dial and request timeout, defaults to 10 seconds.
+}
+
+// AttributeMapping names the directory attributes user fields are read from.
+type AttributeMapping struct {
+	UserID      string // Defaults to "uid", the login username is used when the attribute is empty.
+	Nickname    string // Defaults to "displayName".
+	Email       string // Defaults to "mail".
+	PhoneNumber string // Defaults to "telephoneNumber".
+	FaceURL     string // Optional.
+	GroupName   string // Attribute naming a group entry, defaults to "cn".
+	// Extra attributes returned in User.Attributes.
+	Extra []string
+}
+
+func (c *Config) setDefaults() error {
+	if c.URL == "" || c.BaseDN == "" {
+		return errs.ErrArgs.WrapMsg("ldap url and base dn are required")
+	}
+	if c.UserFilter == "" {
+		c.UserFilter = "(|(uid={username})(sAMAccountName={username}))"
+	}
+	if c.GroupBaseDN == "" {
+		c.GroupBaseDN = c.BaseDN
+	}
+	m := &c.Mapping
+	if m.UserID == "" {
+		m.UserID = "uid"
+	}
+	if m.Nickname == "" {
+		m.Nickname = "displayName"
+	}
+	if m.Email == "" {
+		m.Email = "mail"
+	}
+	if m.PhoneNumber == "" {
+		m.PhoneNumber = "telephoneNumber"
+	}
+	if m.GroupName == "" {
+		m.GroupName = "cn"
+	}
+	if c.PoolSize <= 0 {
+		c.PoolSize = 4
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	return nil
+}
+
+// User is a directory user.
+type User struct {
+	DN          string
+	Username    string
+	UserID      string
+	Nickname    string
+	Email       string
+	PhoneNumber string
+	FaceURL     string
+	Groups      []string
+	Attributes  map[string][]string
+}
+
+// InGroup reports whether the user is a member of group.
+func (u *User) InGroup(group string) bool {
+	for _, g := range u.Groups {
+		if strings.EqualFold(g, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// Client authenticates against one directory. It is safe for concurrent use.
+type Client struct {
+	conf Config
+	tls  *tls.Config
+	pool chan *ldap.Conn
+}
+
+// NewClient creates a Client. Connections are opened on demand.
+func NewClient(conf Config) (*Client, error) {
+	if err := conf.setDefaults(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "invalid ldap url", "url", conf.URL)
+	}
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.TLS != nil {
+		if tlsConf, err = conf.TLS.ClientTLSConfig(); err != nil {
+			return nil, errs.WrapMsg(err, "ldap tls config failed")
+		}
+	}
+	if tlsConf.ServerName == "" {
+		tlsConf.ServerName = u.Hostname()
+	}
+	return &Client{conf: conf, tls: tlsConf, pool: make(chan *ldap.Conn, conf.PoolSize)}, nil
+}
+
+func (c *Client) dial() (*ldap.Conn, error) {
+	conn, err := ldap.DialURL(c.conf.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: c.conf.Timeout}),
+		ldap.DialWithTLSConfig(c.tls))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "ldap dial failed", "url", c.conf.URL)
+	}
+	conn.SetTimeout(c.conf.Timeout)
+	if c.conf.StartTLS {
+		if err := conn.StartTLS(c.tls); err != nil {
+			conn.Close()
+			return nil, errs.WrapMsg(err, "ldap starttls failed", "url", c.conf.URL)
+		}
+	}
+	if err := c.bindService(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (c *Client) bindService(conn *ldap.Conn) error {
+	var err error
+	if c.conf.BindDN == "" {
+		err = conn.UnauthenticatedBind("")
+	} else {
+		err = conn.Bind(c.conf.BindDN, c.conf.BindPassword)
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "ldap service bind failed", "bindDN", c.conf.BindDN)
+	}
+	return nil
+}
+
+// get returns an idle pooled connection or dials a new one.
+func (c *Client) get() (*ldap.Conn, error) {
+	for {
+		select {
+		case conn := <-c.pool:
+			if conn.IsClosing() {
+				conn.Close()
+				continue
+			}
+			return conn, nil
+		default:
+			return c.dial()
+		}
+	}
+}
+
+// put returns a service bound connection to the pool, closing it when the pool is full.
+func (c *Client) put(conn *ldap.Conn) {
+	if conn.IsClosing() {
+		conn.Close()
+		return
+	}
+	select {
+	case c.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// discard closes a connection after an error left it in an unknown state.
+func (c *Client) discard(conn *ldap.Conn) {
+	conn.Close()
+}
+
+// Authenticate checks the password of username and returns the user. Unknown
+// users and wrong passwords both return ErrInvalidCredentials.
+func (c *Client) Authenticate(ctx context.Context, username string, password string) (*User, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials.WrapMsg("username and password are required")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := c.findUser(conn, username)
+	if err != nil {
+		if errs.ErrRecordNotFound.Is(err) {
+			c.put(conn)
+			return nil, ErrInvalidCredentials.WrapMsg("invalid username or password", "username", username)
+		}
+		c.discard(conn)
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			// The failed bind leaves the connection anonymous.
+			if err := c.bindService(conn); err != nil {
+				c.discard(conn)
+			} else {
+				c.put(conn)
+			}
+			return nil, ErrInvalidCredentials.WrapMsg("invalid username or password", "username", username)
+		}
+		c.discard(conn)
+		return nil, errs.WrapMsg(err, "ldap user bind failed", "dn", entry.DN)
+	}
+	if err := c.bindService(conn); err != nil {
+		c.discard(conn)
+		return nil, err
+	}
+	user, err := c.user(conn, username, entry)
+	if err != nil {
+		c.discard(conn)
+		return nil, err
+	}
+	c.put(conn)
+	return user, nil
+}
+
+// Lookup returns a user without checking a password, e.g. to sync profiles.
+// It returns errs.ErrRecordNotFound for unknown users.
+func (c *Client) Lookup(ctx context.Context, username string) (*User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errs.Wrap(err)
+	}
+	conn, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := c.findUser(conn, username)
+	if err != nil {
+		if errs.ErrRecordNotFound.Is(err) {
+			c.put(conn)
+		} else {
+			c.discard(conn)
+		}
+		return nil, err
+	}
+	user, err := c.user(conn, username, entry)
+	if err != nil {
+		c.discard(conn)
+		return nil, err
+	}
+	c.put(conn)
+	return user, nil
+}
+
+// Close closes the idle connections.
+func (c *Client) Close() {
+	for {
+		select {
+		case conn := <-c.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) attributes() []string {
+	m := c.conf.Mapping
+	attrs := []string{m.UserID, m.Nickname, m.Email, m.PhoneNumber, "memberOf"}
+	if m.FaceURL != "" {
+		attrs = append(attrs, m.FaceURL)
+	}
+	return append(attrs, m.Extra...)
+}
+
+func (c *Client) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(c.conf.UserFilter, "{username}", ldap.EscapeFilter(username))
+	req := ldap.NewSearchRequest(c.conf.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(c.conf.Timeout/time.Second), false, filter, c.attributes(), nil)
+	res, err := conn.Search(req)
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, errs.WrapMsg(err, "ldap user search failed", "filter", filter)
+	}
+	switch {
+	case res == nil || len(res.Entries) == 0:
+		return nil, errs.ErrRecordNotFound.WrapMsg("ldap user not found", "username", username)
+	case len(res.Entries) > 1:
+		return nil, errs.New("ldap user filter matched several entries", "username", username).Wrap()
+	}
+	return res.Entries[0], nil
+}
+
+func (c *Client) user(conn *ldap.Conn, username string, entry *ldap.Entry) (*User, error) {
+	m := c.conf.Mapping
+	u := &User{
+		DN:          entry.DN,
+		Username:    username,
+		UserID:      entry.GetAttributeValue(m.UserID),
+		Nickname:    entry.GetAttributeValue(m.Nickname),
+		Email:       entry.GetAttributeValue(m.Email),
+		PhoneNumber: entry.GetAttributeValue(m.PhoneNumber),
+		Attributes:  make(map[string][]string, len(entry.Attributes)),
+	}
+	if u.UserID == "" {
+		u.UserID = username
+	}
+	if m.FaceURL != "" {
+		u.FaceURL = entry.GetAttributeValue(m.FaceURL)
+	}
+	for _, attr := range entry.Attributes {
+		u.Attributes[attr.Name] = attr.Values
+	}
+	seen := make(map[string]bool)
+	addGroup := func(name string) {
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			u.Groups = append(u.Groups, name)
+		}
+	}
+	for _, dn := range entry.GetAttributeValues("memberOf") {
+		addGroup(firstRDNValue(dn, m.GroupName))
+	}
+	if c.conf.GroupFilter != "" {
+		filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(entry.DN), "{username}", ldap.EscapeFilter(username)).Replace(c.conf.GroupFilter)
+		req := ldap.NewSearchRequest(c.conf.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, int(c.conf.Timeout/time.Second), false, filter, []string{m.GroupName}, nil)
+		res, err := conn.SearchWithPaging(req, 500)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "ldap group search failed", "filter", filter)
+		}
+		for _, g := range res.Entries {
+			addGroup(g.GetAttributeValue(m.GroupName))
+		}
+	}
+	return u, nil
+}
+
+// firstRDNValue returns the value of the first attr component of dn, e.g. the
+// cn of "cn=admins,ou=groups,dc=example,dc=com".
+func firstRDNValue(dn string, attr string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, a := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(a.Type, attr) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,239 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ldap
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type entry struct {
+	dn    string
+	attrs map[string][]string
+}
+
+// fakeDirectory is a minimal LDAP server answering simple binds and searches.
+type fakeDirectory struct {
+	passwords map[string]string // DN -> password
+	users     []entry
+	groups    []entry
+
+	mu    sync.Mutex
+	dials int
+}
+
+const serviceDN = "cn=svc,dc=example,dc=com"
+
+func (d *fakeDirectory) serve(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			d.mu.Lock()
+			d.dials++
+			d.mu.Unlock()
+			go d.handle(conn)
+		}
+	}()
+	return "ldap://" + lis.Addr().String()
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", ""))
+	return op
+}
+
+func searchEntry(e entry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, ""))
+	attrs := ber.NewSequence("")
+	for name, values := range e.attrs {
+		attr := ber.NewSequence("")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, ""))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, ""))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+var equality = regexp.MustCompile(`\((\w+)=([^()*]+)\)`)
+
+// matches implements the equality terms of an OR filter, which is all the tests use.
+func matches(e entry, filter string) bool {
+	for _, m := range equality.FindAllStringSubmatch(filter, -1) {
+		for _, v := range e.attrs[m[1]] {
+			if v == m[2] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *fakeDirectory) handle(conn net.Conn) {
+	defer conn.Close()
+	bound := ""
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		write := func(resp *ber.Packet) {
+			msg := ber.NewSequence("")
+			msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, ""))
+			msg.AppendChild(resp)
+			_, _ = conn.Write(msg.Bytes())
+		}
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			if want, ok := d.passwords[dn]; ok && want == password && password != "" {
+				bound = dn
+				write(result(ldap.ApplicationBindResponse, ldap.LDAPResultSuccess))
+			} else {
+				bound = ""
+				write(result(ldap.ApplicationBindResponse, ldap.LDAPResultInvalidCredentials))
+			}
+		case ldap.ApplicationSearchRequest:
+			if bound != serviceDN {
+				write(result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights))
+				continue
+			}
+			base := op.Children[0].Value.(string)
+			filter, _ := ldap.DecompileFilter(op.Children[6])
+			list := d.users
+			if strings.HasPrefix(base, "ou=groups") {
+				list = d.groups
+			}
+			for _, e := range list {
+				if matches(e, filter) {
+					write(searchEntry(e))
+				}
+			}
+			write(result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		}
+	}
+}
+
+func newDirectory() *fakeDirectory {
+	aliceDN := "uid=alice,ou=people,dc=example,dc=com"
+	return &fakeDirectory{
+		passwords: map[string]string{serviceDN: "svc-pass", aliceDN: "alice-pass"},
+		users: []entry{{
+			dn: aliceDN,
+			attrs: map[string][]string{
+				"uid":         {"alice"},
+				"displayName": {"Alice"},
+				"mail":        {"alice@example.com"},
+				"memberOf":    {"cn=admins,ou=groups,dc=example,dc=com"},
+			},
+		}, {
+			dn:    "sAMAccountName=bob,ou=people,dc=example,dc=com",
+			attrs: map[string][]string{"sAMAccountName": {"bob"}},
+		}},
+		groups: []entry{
+			{dn: "cn=dev,ou=groups,dc=example,dc=com", attrs: map[string][]string{"cn": {"dev"}, "member": {aliceDN}}},
+			{dn: "cn=admins,ou=groups,dc=example,dc=com", attrs: map[string][]string{"cn": {"admins"}, "member": {aliceDN}}},
+		},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newDirectory()
+	c, err := NewClient(Config{
+		URL:          d.serve(t),
+		BindDN:       serviceDN,
+		BindPassword: "svc-pass",
+		BaseDN:       "ou=people,dc=example,dc=com",
+		GroupBaseDN:  "ou=groups,dc=example,dc=com",
+		GroupFilter:  "(member={dn})",
+		PoolSize:     1,
+	})
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	u, err := c.Authenticate(ctx, "alice", "alice-pass")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", u.UserID)
+	assert.Equal(t, "Alice", u.Nickname)
+	assert.Equal(t, "alice@example.com", u.Email)
+	assert.Equal(t, []string{"admins", "dev"}, u.Groups)
+	assert.True(t, u.InGroup("DEV"))
+
+	// The pooled connection is bound as the service account again after each
+	// user bind, otherwise the searches below would be refused.
+	_, err = c.Authenticate(ctx, "alice", "wrong")
+	assert.True(t, ErrInvalidCredentials.Is(err))
+	_, err = c.Authenticate(ctx, "nobody", "x")
+	assert.True(t, ErrInvalidCredentials.Is(err))
+	_, err = c.Authenticate(ctx, "alice", "")
+	assert.True(t, ErrInvalidCredentials.Is(err))
+	_, err = c.Authenticate(ctx, "*", "alice-pass")
+	assert.True(t, ErrInvalidCredentials.Is(err))
+
+	u, err = c.Lookup(ctx, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", u.UserID)
+	assert.Empty(t, u.Groups)
+	_, err = c.Lookup(ctx, "nobody")
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+
+	d.mu.Lock()
+	assert.Equal(t, 1, d.dials)
+	d.mu.Unlock()
+}
+
+func TestServiceBindFailure(t *testing.T) {
+	d := newDirectory()
+	c, err := NewClient(Config{URL: d.serve(t), BindDN: serviceDN, BindPassword: "wrong", BaseDN: "dc=example,dc=com"})
+	require.NoError(t, err)
+	_, err = c.Authenticate(context.Background(), "alice", "alice-pass")
+	assert.Error(t, err)
+	assert.False(t, ErrInvalidCredentials.Is(err))
+}
+
+func TestFirstRDNValue(t *testing.T) {
+	assert.Equal(t, "admins", firstRDNValue("CN=admins,OU=Groups,DC=corp,DC=local", "cn"))
+	assert.Equal(t, "", firstRDNValue("not a dn", "cn"))
+}
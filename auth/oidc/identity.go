@@ -0,0 +1,109 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// ClaimMapping names the claims identity fields are read from. Nested claims
+// are addressed with dots, e.g. "profile.nickname".
+type ClaimMapping struct {
+	UserID      string // Defaults to "sub".
+	Nickname    string // Defaults to "name".
+	FaceURL     string // Defaults to "picture".
+	Email       string // Defaults to "email".
+	PhoneNumber string // Defaults to "phone_number".
+}
+
+func (m *ClaimMapping) setDefaults() {
+	if m.UserID == "" {
+		m.UserID = "sub"
+	}
+	if m.Nickname == "" {
+		m.Nickname = "name"
+	}
+	if m.FaceURL == "" {
+		m.FaceURL = "picture"
+	}
+	if m.Email == "" {
+		m.Email = "email"
+	}
+	if m.PhoneNumber == "" {
+		m.PhoneNumber = "phone_number"
+	}
+}
+
+// Identity is an SSO user mapped to OpenIM user fields.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	UserID        string
+	Nickname      string
+	FaceURL       string
+	Email         string
+	EmailVerified bool
+	PhoneNumber   string
+	Claims        map[string]any
+}
+
+// Identity maps the claims of a verified ID token.
+func (m ClaimMapping) Identity(t *IDToken) (*Identity, error) {
+	return m.Map(t.Issuer, t.Subject, t.Claims)
+}
+
+// Map maps arbitrary claims, for example ID token claims merged with userinfo.
+func (m ClaimMapping) Map(issuer string, subject string, claims map[string]any) (*Identity, error) {
+	m.setDefaults()
+	id := &Identity{
+		Issuer:      issuer,
+		Subject:     subject,
+		UserID:      claimString(claims, m.UserID),
+		Nickname:    claimString(claims, m.Nickname),
+		FaceURL:     claimString(claims, m.FaceURL),
+		Email:       claimString(claims, m.Email),
+		PhoneNumber: claimString(claims, m.PhoneNumber),
+		Claims:      claims,
+	}
+	id.EmailVerified, _ = claims["email_verified"].(bool)
+	if id.UserID == "" {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc user id claim missing", "claim", m.UserID)
+	}
+	return id, nil
+}
+
+func claimString(claims map[string]any, path string) string {
+	var v any = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[part]
+	}
+	switch s := v.(type) {
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(s)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// minRefreshInterval bounds refreshes triggered by unknown key IDs.
+const minRefreshInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the JWKS of the provider.
+type keySet struct {
+	p   *Provider
+	url string
+	ttl time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func newKeySet(p *Provider, url string, ttl time.Duration) *keySet {
+	return &keySet{p: p, url: url, ttl: ttl}
+}
+
+// key returns the key with the given ID, refreshing the set when it is stale
+// or does not know the ID.
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.p.now()
+	stale := s.keys == nil || now.Sub(s.fetched) > s.ttl
+	key, ok := s.keys[kid]
+	if !ok && !stale && now.Sub(s.fetched) >= minRefreshInterval {
+		stale = true
+	}
+	if stale {
+		if err := s.refresh(ctx, now); err != nil {
+			if s.keys == nil {
+				return nil, err
+			}
+			// Keep serving the cached keys when the provider is unreachable.
+			log.ZWarn(ctx, "oidc jwks refresh failed", err, "url", s.url)
+		}
+		key, ok = s.keys[kid]
+	}
+	if !ok {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc signing key not found", "kid", kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) refresh(ctx context.Context, now time.Time) error {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := s.p.getJSON(ctx, s.url, "", &set); err != nil {
+		return err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.ZWarn(ctx, "oidc skip invalid jwk", err, "kid", k.Kid)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	s.keys, s.fetched = keys, now
+	return nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var (
+			curve elliptic.Curve
+			check ecdh.Curve
+		)
+		switch k.Crv {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, check = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, errs.New("unsupported jwk curve", "crv", k.Crv).Wrap()
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, errs.New("jwk coordinate too large", "kid", k.Kid).Wrap()
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, errs.WrapMsg(err, "jwk point not on curve", "kid", k.Kid)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, errs.New("unsupported jwk type", "kty", k.Kty).Wrap()
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errs.New("invalid jwk number").Wrap()
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,241 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testIssuer struct {
+	srv   *httptest.Server
+	mu    sync.Mutex
+	keys  map[string]any // kid -> private key
+	jwks  int            // JWKS fetch count
+	nonce string
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ti := &testIssuer{keys: map[string]any{"rsa": rsaKey, "ec": ecKey}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                ti.srv.URL,
+			"authorization_endpoint":                ti.srv.URL + "/auth",
+			"token_endpoint":                        ti.srv.URL + "/token",
+			"userinfo_endpoint":                     ti.srv.URL + "/userinfo",
+			"jwks_uri":                              ti.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256", "ES256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		ti.mu.Lock()
+		defer ti.mu.Unlock()
+		ti.jwks++
+		var keys []map[string]string
+		for kid, k := range ti.keys {
+			switch k := k.(type) {
+			case *rsa.PrivateKey:
+				keys = append(keys, map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())})
+			case *ecdsa.PrivateKey:
+				keys = append(keys, map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(k.X.Bytes()), "y": b64(k.Y.Bytes())})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "at",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     ti.sign(t, "rsa", ti.claims(map[string]any{"nonce": ti.nonce})),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer at" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": "u1", "locale": "zh-CN"})
+	})
+	ti.srv = httptest.NewServer(mux)
+	t.Cleanup(ti.srv.Close)
+	return ti
+}
+
+func (ti *testIssuer) claims(extra map[string]any) jwt.MapClaims {
+	now := time.Now()
+	c := jwt.MapClaims{
+		"iss":            ti.srv.URL,
+		"sub":            "u1",
+		"aud":            "openim",
+		"exp":            now.Add(time.Hour).Unix(),
+		"iat":            now.Unix(),
+		"name":           "Alice",
+		"picture":        "https://example.com/a.png",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"profile":        map[string]any{"im_id": "im_alice"},
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func (ti *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	ti.mu.Lock()
+	key := ti.keys[kid]
+	ti.mu.Unlock()
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestExchange(t *testing.T) {
+	ti := newTestIssuer(t)
+	ti.nonce = "n-1"
+	ctx := context.Background()
+	p, err := NewProvider(ctx, Config{Issuer: ti.srv.URL + "/", ClientID: "openim", ClientSecret: "secret", RedirectURL: "https://im.example.com/cb"})
+	require.NoError(t, err)
+
+	u, err := url.Parse(p.AuthCodeURL("state-1", "n-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "/auth", u.Path)
+	assert.Equal(t, "n-1", u.Query().Get("nonce"))
+	assert.Equal(t, "openid profile email", u.Query().Get("scope"))
+
+	res, err := p.Exchange(ctx, "good-code", "n-1")
+	require.NoError(t, err)
+	assert.Equal(t, "at", res.Token.AccessToken)
+	assert.Equal(t, "u1", res.Identity.UserID)
+	assert.Equal(t, "Alice", res.Identity.Nickname)
+	assert.Equal(t, "alice@example.com", res.Identity.Email)
+	assert.True(t, res.Identity.EmailVerified)
+
+	_, err = p.Exchange(ctx, "good-code", "other-nonce")
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+	_, err = p.Exchange(ctx, "bad-code", "n-1")
+	assert.Error(t, err)
+
+	info, err := p.UserInfo(ctx, res.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "zh-CN", info["locale"])
+
+	id, err := ClaimMapping{UserID: "profile.im_id"}.Identity(res.IDToken)
+	require.NoError(t, err)
+	assert.Equal(t, "im_alice", id.UserID)
+	_, err = ClaimMapping{UserID: "missing"}.Identity(res.IDToken)
+	assert.Error(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+	p, err := NewProvider(ctx, Config{Issuer: ti.srv.URL, ClientID: "openim"})
+	require.NoError(t, err)
+
+	tok, err := p.Verify(ctx, ti.sign(t, "ec", ti.claims(nil)), "")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", tok.Subject)
+
+	cases := map[string]struct {
+		raw  string
+		want errs.CodeError
+	}{
+		"audience": {ti.sign(t, "rsa", ti.claims(map[string]any{"aud": "other"})), errs.ErrTokenInvalid},
+		"issuer":   {ti.sign(t, "rsa", ti.claims(map[string]any{"iss": "https://evil"})), errs.ErrTokenInvalid},
+		"expired":  {ti.sign(t, "rsa", ti.claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})), errs.ErrTokenExpired},
+		"future":   {ti.sign(t, "rsa", ti.claims(map[string]any{"iat": time.Now().Add(time.Hour).Unix()})), errs.ErrTokenNotValidYet},
+		"azp":      {ti.sign(t, "rsa", ti.claims(map[string]any{"aud": []string{"openim", "x"}, "azp": "x"})), errs.ErrTokenInvalid},
+		"garbage":  {"not.a.jwt", errs.ErrTokenMalformed},
+	}
+	for name, c := range cases {
+		_, err := p.Verify(ctx, c.raw, "")
+		assert.True(t, c.want.Is(err), "%s: %v", name, err)
+	}
+
+	// alg none is never accepted.
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, ti.claims(nil)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = p.Verify(ctx, none, "")
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+}
+
+func TestKeyRotation(t *testing.T) {
+	ti := newTestIssuer(t)
+	ctx := context.Background()
+	p, err := NewProvider(ctx, Config{Issuer: ti.srv.URL, ClientID: "openim"})
+	require.NoError(t, err)
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	_, err = p.Verify(ctx, ti.sign(t, "rsa", ti.claims(nil)), "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, ti.jwks)
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ti.mu.Lock()
+	ti.keys["rotated"] = newKey
+	ti.mu.Unlock()
+	raw := ti.sign(t, "rotated", ti.claims(nil))
+
+	// Unknown key IDs do not refresh more than once per minute.
+	_, err = p.Verify(ctx, raw, "")
+	assert.Error(t, err)
+	assert.Equal(t, 1, ti.jwks)
+
+	now = now.Add(2 * time.Minute)
+	_, err = p.Verify(ctx, raw, "")
+	require.NoError(t, err)
+	assert.Equal(t, 2, ti.jwks)
+}
@@ -0,0 +1,194 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package oidc signs users in through an OpenID Connect provider: it discovers
+// the provider, builds the authorization URL, exchanges the code, verifies the
+// ID token against the cached JWKS and maps its claims to an OpenIM identity.
+package oidc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"golang.org/x/oauth2"
+)
+
+// Config configures a Provider.
+type Config struct {
+	Issuer       string // Issuer URL, the discovery document is read from Issuer + "/.well-known/openid-configuration".
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // Defaults to openid, profile and email.
+	// HTTPClient is used for discovery, JWKS, token and userinfo requests,
+	// http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// JWKSCacheTTL is how long signing keys are cached, defaults to one hour.
+	// Unknown key IDs refresh the keys earlier, at most once per minute.
+	JWKSCacheTTL time.Duration
+	// ClockSkew is tolerated when checking exp, iat and nbf, defaults to one minute.
+	ClockSkew time.Duration
+	Mapping   ClaimMapping
+}
+
+// Discovery is the subset of the provider metadata the helper uses.
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	SigningAlgs           []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Provider talks to one OpenID Connect provider. It is safe for concurrent use.
+type Provider struct {
+	conf      Config
+	client    *http.Client
+	discovery Discovery
+	oauth     *oauth2.Config
+	keys      *keySet
+	now       func() time.Time
+}
+
+// NewProvider reads the discovery document of conf.Issuer.
+func NewProvider(ctx context.Context, conf Config) (*Provider, error) {
+	if conf.Issuer == "" || conf.ClientID == "" {
+		return nil, errs.ErrArgs.WrapMsg("oidc issuer and client id are required")
+	}
+	conf.Issuer = strings.TrimSuffix(conf.Issuer, "/")
+	if len(conf.Scopes) == 0 {
+		conf.Scopes = []string{"openid", "profile", "email"}
+	}
+	if conf.JWKSCacheTTL <= 0 {
+		conf.JWKSCacheTTL = time.Hour
+	}
+	if conf.ClockSkew <= 0 {
+		conf.ClockSkew = time.Minute
+	}
+	conf.Mapping.setDefaults()
+	client := conf.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	p := &Provider{conf: conf, client: client, now: time.Now}
+	if err := p.getJSON(ctx, conf.Issuer+"/.well-known/openid-configuration", "", &p.discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(p.discovery.Issuer, "/") != conf.Issuer {
+		return nil, errs.New("oidc issuer mismatch", "expected", conf.Issuer, "discovered", p.discovery.Issuer).Wrap()
+	}
+	if p.discovery.JWKSURI == "" || p.discovery.TokenEndpoint == "" {
+		return nil, errs.New("oidc discovery document incomplete", "issuer", conf.Issuer).Wrap()
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     conf.ClientID,
+		ClientSecret: conf.ClientSecret,
+		RedirectURL:  conf.RedirectURL,
+		Scopes:       conf.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.discovery.AuthorizationEndpoint,
+			TokenURL: p.discovery.TokenEndpoint,
+		},
+	}
+	p.keys = newKeySet(p, p.discovery.JWKSURI, conf.JWKSCacheTTL)
+	return p, nil
+}
+
+// Discovery returns the provider metadata.
+func (p *Provider) Discovery() Discovery {
+	return p.discovery
+}
+
+// AuthCodeURL returns the URL to redirect the user to. The nonce is echoed in
+// the ID token and must be passed to Exchange.
+func (p *Provider) AuthCodeURL(state string, nonce string, opts ...oauth2.AuthCodeOption) string {
+	if nonce != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+	return p.oauth.AuthCodeURL(state, opts...)
+}
+
+// Result is the outcome of a code exchange.
+type Result struct {
+	Token    *oauth2.Token
+	IDToken  *IDToken
+	Identity *Identity
+}
+
+// Exchange trades the authorization code for tokens, verifies the ID token
+// and maps it to an identity. nonce must match the one used in AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code string, nonce string, opts ...oauth2.AuthCodeOption) (*Result, error) {
+	token, err := p.oauth.Exchange(context.WithValue(ctx, oauth2.HTTPClient, p.client), code, opts...)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "oidc code exchange failed", "issuer", p.conf.Issuer)
+	}
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc token response has no id_token")
+	}
+	idToken, err := p.Verify(ctx, raw, nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := p.conf.Mapping.Identity(idToken)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{Token: token, IDToken: idToken, Identity: identity}, nil
+}
+
+// UserInfo fetches the userinfo claims with the access token.
+func (p *Provider) UserInfo(ctx context.Context, token *oauth2.Token) (map[string]any, error) {
+	if p.discovery.UserinfoEndpoint == "" {
+		return nil, errs.New("oidc provider has no userinfo endpoint", "issuer", p.conf.Issuer).Wrap()
+	}
+	claims := make(map[string]any)
+	if err := p.getJSON(ctx, p.discovery.UserinfoEndpoint, token.AccessToken, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, bearer string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errs.WrapMsg(err, "oidc build request failed", "url", url)
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errs.WrapMsg(err, "oidc request failed", "url", url)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errs.WrapMsg(err, "oidc read response failed", "url", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errs.New("oidc unexpected status", "url", url, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	if err := jsonutil.JsonUnmarshal(body, v); err != nil {
+		return errs.WrapMsg(err, "oidc decode response failed", "url", url)
+	}
+	return nil
+}
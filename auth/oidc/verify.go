@@ -0,0 +1,139 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/openimsdk/tools/errs"
+)
+
+var supportedAlgs = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// IDToken is a verified ID token.
+type IDToken struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Expiry   time.Time
+	IssuedAt time.Time
+	Nonce    string
+	Claims   map[string]any
+	Raw      string
+}
+
+// Verify checks the signature and the standard claims of a raw ID token. An
+// empty nonce skips the nonce check.
+func (p *Provider) Verify(ctx context.Context, raw string, nonce string) (*IDToken, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods(p.algs()), jwt.WithoutClaimsValidation())
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.key(ctx, kid)
+	})
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok && ve.Errors&jwt.ValidationErrorMalformed != 0 {
+			return nil, errs.ErrTokenMalformed.WrapMsg("oidc id token malformed")
+		}
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token signature invalid", "cause", err.Error())
+	}
+	t := &IDToken{Claims: claims, Raw: raw}
+	t.Issuer, _ = claims["iss"].(string)
+	t.Subject, _ = claims["sub"].(string)
+	t.Nonce, _ = claims["nonce"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		t.Audience = []string{aud}
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				t.Audience = append(t.Audience, s)
+			}
+		}
+	}
+	if t.Issuer != p.conf.Issuer && t.Issuer != p.conf.Issuer+"/" {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token issuer mismatch", "iss", t.Issuer)
+	}
+	if t.Subject == "" {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token has no subject")
+	}
+	if !contains(t.Audience, p.conf.ClientID) {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token audience mismatch", "aud", t.Audience)
+	}
+	if azp, ok := claims["azp"].(string); ok && len(t.Audience) > 1 && azp != p.conf.ClientID {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token authorized party mismatch", "azp", azp)
+	}
+	now := p.now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token has no expiry")
+	}
+	t.Expiry = exp
+	if now.After(exp.Add(p.conf.ClockSkew)) {
+		return nil, errs.ErrTokenExpired.WrapMsg("oidc id token expired", "exp", exp)
+	}
+	if iat, ok := numericDate(claims["iat"]); ok {
+		t.IssuedAt = iat
+		if iat.After(now.Add(p.conf.ClockSkew)) {
+			return nil, errs.ErrTokenNotValidYet.WrapMsg("oidc id token issued in the future", "iat", iat)
+		}
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && nbf.After(now.Add(p.conf.ClockSkew)) {
+		return nil, errs.ErrTokenNotValidYet.WrapMsg("oidc id token not valid yet", "nbf", nbf)
+	}
+	if nonce != "" && t.Nonce != nonce {
+		return nil, errs.ErrTokenInvalid.WrapMsg("oidc id token nonce mismatch")
+	}
+	return t, nil
+}
+
+// algs returns the supported algorithms the provider advertises, RS256 when it
+// advertises none.
+func (p *Provider) algs() []string {
+	if len(p.discovery.SigningAlgs) == 0 {
+		return []string{"RS256"}
+	}
+	var algs []string
+	for _, alg := range p.discovery.SigningAlgs {
+		if contains(supportedAlgs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func numericDate(v any) (time.Time, bool) {
+	switch n := v.(type) {
+	case float64:
+		return time.Unix(int64(n), 0), true
+	case json.Number:
+		i, err := n.Int64()
+		return time.Unix(i, 0), err == nil
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package captcha generates image and slider captchas, keeps their answers in
+// Redis and provides gin and gRPC middleware that demand a solved captcha once
+// a trigger flags the caller, typically on login and registration endpoints.
+package captcha
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/randutil"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CaptchaRequiredError = 1831 // The request must carry a solved captcha.
+	CaptchaInvalidError  = 1832 // The captcha answer is wrong, expired or was already used.
+)
+
+var (
+	ErrCaptchaRequired = errs.NewCodeError(CaptchaRequiredError, "CaptchaRequiredError")
+	ErrCaptchaInvalid  = errs.NewCodeError(CaptchaInvalidError, "CaptchaInvalidError")
+)
+
+// Store keeps captcha answers. Take returns an empty answer when the id is
+// unknown and must remove the answer so it can only be checked once.
+type Store interface {
+	Set(ctx context.Context, id string, answer string, ttl time.Duration) error
+	Take(ctx context.Context, id string) (string, error)
+}
+
+// NewRedisStore returns a Store keeping answers under keyPrefix, "CAPTCHA:" when empty.
+func NewRedisStore(rdb redis.UniversalClient, keyPrefix string) Store {
+	if keyPrefix == "" {
+		keyPrefix = "CAPTCHA:"
+	}
+	return &redisStore{rdb: rdb, prefix: keyPrefix}
+}
+
+type redisStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func (s *redisStore) Set(ctx context.Context, id string, answer string, ttl time.Duration) error {
+	if err := s.rdb.Set(ctx, s.prefix+id, answer, ttl).Err(); err != nil {
+		return errs.WrapMsg(err, "captcha store set failed", "id", id)
+	}
+	return nil
+}
+
+func (s *redisStore) Take(ctx context.Context, id string) (string, error) {
+	pipe := s.rdb.TxPipeline()
+	get := pipe.Get(ctx, s.prefix+id)
+	pipe.Del(ctx, s.prefix+id)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return "", errs.WrapMsg(err, "captcha store take failed", "id", id)
+	}
+	return get.Val(), nil
+}
+
+// Config configures a Manager.
+type Config struct {
+	TTL time.Duration // How long a captcha can be solved, defaults to 2 minutes.
+	// Image captcha.
+	Length  int    // Characters per image captcha, defaults to 4.
+	Charset string // Defaults to digits and upper case letters without 0, 1, I and O.
+	Width   int    // Image width, defaults to 160.
+	Height  int    // Image height, defaults to 60.
+	// Slider captcha.
+	SliderWidth  int // Background width, defaults to 300.
+	SliderHeight int // Background height, defaults to 150.
+	PieceSize    int // Edge of the puzzle piece, defaults to 44.
+	Tolerance    int // Accepted distance in pixels from the correct offset, defaults to 4.
+}
+
+func (c *Config) setDefaults() {
+	if c.TTL <= 0 {
+		c.TTL = 2 * time.Minute
+	}
+	if c.Length <= 0 {
+		c.Length = 4
+	}
+	if c.Charset == "" {
+		c.Charset = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	}
+	if c.Width <= 0 {
+		c.Width = 160
+	}
+	if c.Height <= 0 {
+		c.Height = 60
+	}
+	if c.SliderWidth <= 0 {
+		c.SliderWidth = 300
+	}
+	if c.SliderHeight <= 0 {
+		c.SliderHeight = 150
+	}
+	if c.PieceSize <= 0 {
+		c.PieceSize = 44
+	}
+	if c.Tolerance <= 0 {
+		c.Tolerance = 4
+	}
+}
+
+// Kinds prefix stored answers so an answer is only checked the way its captcha expects.
+const (
+	kindImage  = "image:"
+	kindSlider = "slider:"
+)
+
+// Manager creates and verifies captchas.
+type Manager struct {
+	store Store
+	conf  Config
+}
+
+// New creates a Manager.
+func New(store Store, conf Config) *Manager {
+	conf.setDefaults()
+	return &Manager{store: store, conf: conf}
+}
+
+// Image is a generated image captcha.
+type Image struct {
+	ID  string
+	PNG []byte
+}
+
+// NewImage generates an image captcha showing random characters.
+func (m *Manager) NewImage(ctx context.Context) (*Image, error) {
+	text, err := randomText(m.conf.Charset, m.conf.Length)
+	if err != nil {
+		return nil, err
+	}
+	data, err := renderText(text, m.conf.Width, m.conf.Height)
+	if err != nil {
+		return nil, err
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Set(ctx, id, kindImage+text, m.conf.TTL); err != nil {
+		return nil, err
+	}
+	return &Image{ID: id, PNG: data}, nil
+}
+
+// Slider is a generated slider captcha. The client drags Piece horizontally
+// at height Y over Background and answers with the resulting x offset.
+type Slider struct {
+	ID         string
+	Background []byte // PNG with the hole of the piece.
+	Piece      []byte // Transparent PNG of the piece.
+	Y          int
+}
+
+// NewSlider generates a slider captcha.
+func (m *Manager) NewSlider(ctx context.Context) (*Slider, error) {
+	s, x, err := renderSlider(m.conf.SliderWidth, m.conf.SliderHeight, m.conf.PieceSize)
+	if err != nil {
+		return nil, err
+	}
+	if s.ID, err = newID(); err != nil {
+		return nil, err
+	}
+	if err := m.store.Set(ctx, s.ID, kindSlider+strconv.Itoa(x), m.conf.TTL); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Verify checks the answer of a captcha. Every captcha can be verified once,
+// whether the answer is right or not.
+func (m *Manager) Verify(ctx context.Context, id string, answer string) error {
+	if id == "" || answer == "" {
+		return ErrCaptchaRequired.WrapMsg("captcha id and answer are required")
+	}
+	stored, err := m.store.Take(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(stored, kindImage):
+		want := stored[len(kindImage):]
+		if subtle.ConstantTimeCompare([]byte(want), []byte(strings.ToUpper(answer))) == 1 {
+			return nil
+		}
+	case strings.HasPrefix(stored, kindSlider):
+		want, _ := strconv.Atoi(stored[len(kindSlider):])
+		got, err := strconv.Atoi(answer)
+		if err == nil && got >= want-m.conf.Tolerance && got <= want+m.conf.Tolerance {
+			return nil
+		}
+	}
+	return ErrCaptchaInvalid.WrapMsg("captcha verification failed", "id", id)
+}
+
+func newID() (string, error) {
+	id, err := randutil.SecureHex(16)
+	if err != nil {
+		return "", errs.WrapMsg(err, "generate captcha id failed")
+	}
+	return id, nil
+}
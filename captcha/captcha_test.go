@@ -0,0 +1,190 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	answers map[string]string
+}
+
+func (s *memoryStore) Set(ctx context.Context, id string, answer string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.answers[id] = answer
+	return nil
+}
+
+func (s *memoryStore) Take(ctx context.Context, id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	answer := s.answers[id]
+	delete(s.answers, id)
+	return answer, nil
+}
+
+func newTestManager() (*Manager, *memoryStore) {
+	store := &memoryStore{answers: make(map[string]string)}
+	return New(store, Config{}), store
+}
+
+func TestImage(t *testing.T) {
+	m, store := newTestManager()
+	ctx := context.Background()
+	img, err := m.NewImage(ctx)
+	require.NoError(t, err)
+	decoded, err := png.Decode(bytes.NewReader(img.PNG))
+	require.NoError(t, err)
+	assert.Equal(t, 160, decoded.Bounds().Dx())
+	assert.Equal(t, 60, decoded.Bounds().Dy())
+
+	answer := store.answers[img.ID][len(kindImage):]
+	assert.Len(t, answer, 4)
+	assert.True(t, ErrCaptchaInvalid.Is(m.Verify(ctx, img.ID, answer+"X")))
+	// The captcha was consumed by the failed attempt.
+	assert.True(t, ErrCaptchaInvalid.Is(m.Verify(ctx, img.ID, answer)))
+
+	img, err = m.NewImage(ctx)
+	require.NoError(t, err)
+	answer = store.answers[img.ID][len(kindImage):]
+	assert.NoError(t, m.Verify(ctx, img.ID, answer))
+}
+
+func TestSlider(t *testing.T) {
+	m, store := newTestManager()
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		s, err := m.NewSlider(ctx)
+		require.NoError(t, err)
+		bg, err := png.Decode(bytes.NewReader(s.Background))
+		require.NoError(t, err)
+		piece, err := png.Decode(bytes.NewReader(s.Piece))
+		require.NoError(t, err)
+		assert.Equal(t, 300, bg.Bounds().Dx())
+		assert.Equal(t, 44, piece.Bounds().Dx())
+		assert.True(t, s.Y >= 0 && s.Y+44 <= 150)
+		x, err := strconv.Atoi(store.answers[s.ID][len(kindSlider):])
+		require.NoError(t, err)
+		assert.True(t, x >= 0 && x+44 <= 300)
+		if i%2 == 0 {
+			assert.NoError(t, m.Verify(ctx, s.ID, strconv.Itoa(x+3)))
+		} else {
+			assert.True(t, ErrCaptchaInvalid.Is(m.Verify(ctx, s.ID, strconv.Itoa(x+5))))
+		}
+	}
+	assert.True(t, ErrCaptchaRequired.Is(m.Verify(ctx, "", "1")))
+}
+
+func TestPieceMask(t *testing.T) {
+	assert.True(t, pieceMask(50, 5, 45))
+	assert.False(t, pieceMask(50, 45, 45))
+	assert.True(t, pieceMask(50, 20, 2))
+	assert.False(t, pieceMask(50, 0, 0))
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, store := newTestManager()
+	flagged := map[string]bool{}
+	trigger := TriggerFunc(func(ctx context.Context, key string) (bool, error) {
+		return flagged[key], nil
+	})
+	r := gin.New()
+	r.Use(m.Gin(trigger, "/login"))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	r.POST("/login", ok)
+	r.POST("/other", ok)
+
+	do := func(path string, id string, answer string) string {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set(HeaderCaptchaID, id)
+		req.Header.Set(HeaderCaptchaAnswer, answer)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	assert.Equal(t, "ok", do("/login", "", ""))
+	flagged["10.0.0.1"] = true
+	assert.Contains(t, do("/login", "", ""), strconv.Itoa(CaptchaRequiredError))
+	assert.Equal(t, "ok", do("/other", "", ""))
+
+	img, err := m.NewImage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "ok", do("/login", img.ID, store.answers[img.ID][len(kindImage):]))
+	assert.Contains(t, do("/login", img.ID, "ABCD"), strconv.Itoa(CaptchaInvalidError))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	m, store := newTestManager()
+	interceptor := m.UnaryServerInterceptor(TriggerFunc(func(ctx context.Context, key string) (bool, error) {
+		return true, nil
+	}), "/user/login")
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/user/login"}
+
+	_, err := interceptor(context.Background(), nil, info, handler)
+	assert.True(t, ErrCaptchaRequired.Is(err))
+
+	s, err := m.NewSlider(context.Background())
+	require.NoError(t, err)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(HeaderCaptchaID, s.ID, HeaderCaptchaAnswer, store.answers[s.ID][len(kindSlider):]))
+	resp, err := interceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	resp, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/user/info"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+}
+
+func TestRedis(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	store := NewRedisStore(rdb, "")
+	require.NoError(t, store.Set(ctx, "id", "image:ABCD", time.Minute))
+	answer, err := store.Take(ctx, "id")
+	require.NoError(t, err)
+	assert.Equal(t, "image:ABCD", answer)
+	answer, err = store.Take(ctx, "id")
+	require.NoError(t, err)
+	assert.Empty(t, answer)
+
+	trigger := NewRateTrigger(rdb, "", 2, time.Minute)
+	key := "10.0.0.1:" + time.Now().Format(time.RFC3339Nano)
+	for i, want := range []bool{false, false, true} {
+		required, err := trigger.Required(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, required, i)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Headers carrying the solved captcha. gRPC metadata uses their lower case form.
+const (
+	HeaderCaptchaID     = "captchaID"
+	HeaderCaptchaAnswer = "captcha"
+)
+
+// Trigger decides whether the caller identified by key must solve a captcha.
+type Trigger interface {
+	Required(ctx context.Context, key string) (bool, error)
+}
+
+// TriggerFunc adapts a function to Trigger.
+type TriggerFunc func(ctx context.Context, key string) (bool, error)
+
+func (f TriggerFunc) Required(ctx context.Context, key string) (bool, error) {
+	return f(ctx, key)
+}
+
+// rateScript counts a request in a fixed window and returns the count.
+var rateScript = redis.NewScript(`
+local n = redis.call('INCR', KEYS[1])
+if n == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return n
+`)
+
+// NewRateTrigger returns a Trigger that flags a key once it made more than
+// max requests within window. Every later request of the window must carry a
+// captcha.
+func NewRateTrigger(rdb redis.UniversalClient, keyPrefix string, max int, window time.Duration) Trigger {
+	if keyPrefix == "" {
+		keyPrefix = "CAPTCHA_RATE:"
+	}
+	return TriggerFunc(func(ctx context.Context, key string) (bool, error) {
+		n, err := rateScript.Run(ctx, rdb, []string{keyPrefix + key}, window.Milliseconds()).Int64()
+		if err != nil {
+			return false, errs.WrapMsg(err, "captcha rate trigger failed", "key", key)
+		}
+		return n > int64(max), nil
+	})
+}
+
+// check returns nil when no captcha is required or the supplied one is solved.
+// Trigger failures let the request through so an unavailable Redis does not
+// lock every user out.
+func (m *Manager) check(ctx context.Context, trigger Trigger, key string, id string, answer string) error {
+	required, err := trigger.Required(ctx, key)
+	if err != nil {
+		log.ZWarn(ctx, "captcha trigger failed", err, "key", key)
+		return nil
+	}
+	if !required {
+		return nil
+	}
+	if id == "" || answer == "" {
+		return ErrCaptchaRequired.WrapMsg("captcha required", "key", key)
+	}
+	return m.Verify(ctx, id, answer)
+}
+
+func match(list []string, s string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Gin requires a solved captcha on the given paths, or on every request when
+// none are given, once the trigger flags the client IP.
+func (m *Manager) Gin(trigger Trigger, paths ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !match(paths, c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+		err := m.check(c, trigger, c.ClientIP(), c.GetHeader(HeaderCaptchaID), c.GetHeader(HeaderCaptchaAnswer))
+		if err != nil {
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor requires a solved captcha on the given methods, or on
+// every method when none are given, once the trigger flags the remote address.
+// Chain it after RpcServerInterceptor so its errors are converted to status codes.
+func (m *Manager) UnaryServerInterceptor(trigger Trigger, methods ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !match(methods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if err := m.check(ctx, trigger, remoteIP(ctx), first(md, HeaderCaptchaID), first(md, HeaderCaptchaAnswer)); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func remoteIP(ctx context.Context) string {
+	if addr := mcontext.GetRemoteAddr(ctx); addr != "" {
+		return addr
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,253 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package captcha
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/randutil"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	fontOnce sync.Once
+	fontData *opentype.Font
+	fontErr  error
+)
+
+func loadFont() (*opentype.Font, error) {
+	fontOnce.Do(func() {
+		fontData, fontErr = opentype.Parse(gobold.TTF)
+	})
+	if fontErr != nil {
+		return nil, errs.WrapMsg(fontErr, "parse captcha font failed")
+	}
+	return fontData, nil
+}
+
+// randomText draws the answer from crypto/rand, the drawing noise only uses
+// the replaceable randutil source.
+func randomText(charset string, length int) (string, error) {
+	text, err := randutil.SecureString(charset, length)
+	if err != nil {
+		return "", errs.WrapMsg(err, "generate captcha text failed")
+	}
+	return text, nil
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errs.WrapMsg(err, "encode captcha png failed")
+	}
+	return buf.Bytes(), nil
+}
+
+func randomColor(min, max int) color.RGBA {
+	c := func() uint8 { return uint8(min + randutil.Intn(max-min)) }
+	return color.RGBA{R: c(), G: c(), B: c(), A: 0xff}
+}
+
+// renderText draws text with per character jitter, noise lines and dots, then
+// bends the image along a sine wave.
+func renderText(text string, width int, height int) ([]byte, error) {
+	f, err := loadFont()
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: float64(height) * 0.6, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create captcha font face failed")
+	}
+	defer face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(randomColor(220, 255)), image.Point{}, draw.Src)
+	for i := 0; i < 4; i++ {
+		drawLine(img, randutil.Intn(width), randutil.Intn(height), randutil.Intn(width), randutil.Intn(height), randomColor(120, 200))
+	}
+	step := width / (len(text) + 1)
+	d := &font.Drawer{Dst: img, Face: face}
+	for i, ch := range text {
+		d.Src = image.NewUniform(randomColor(0, 110))
+		x := step/2 + i*step + randutil.Intn(step/3+1)
+		y := height*3/4 + randutil.Intn(height/8+1) - height/16
+		d.Dot = fixed.P(x, y)
+		d.DrawString(string(ch))
+	}
+	for i := 0; i < 2; i++ {
+		drawLine(img, 0, randutil.Intn(height), width-1, randutil.Intn(height), randomColor(0, 110))
+	}
+	for i := 0; i < width*height/30; i++ {
+		img.SetRGBA(randutil.Intn(width), randutil.Intn(height), randomColor(0, 255))
+	}
+	return encodePNG(wave(img, float64(height)/12, float64(width)/(1+randutil.Float64())))
+}
+
+func wave(src *image.RGBA, amplitude float64, period float64) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(b)
+	phase := randutil.Float64() * 2 * math.Pi
+	for x := b.Min.X; x < b.Max.X; x++ {
+		dy := int(amplitude * math.Sin(2*math.Pi*float64(x)/period+phase))
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			sy := y + dy
+			if sy < b.Min.Y {
+				sy = b.Min.Y
+			} else if sy >= b.Max.Y {
+				sy = b.Max.Y - 1
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(x, sy))
+		}
+	}
+	return dst
+}
+
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		img.SetRGBA(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// pieceMask reports whether (x, y) belongs to a puzzle piece of the given
+// size: a square with a round tab on its top and right edges.
+func pieceMask(size int, x int, y int) bool {
+	r := size / 5
+	body := size - r
+	if x < body && y >= r {
+		return true
+	}
+	in := func(cx, cy int) bool {
+		return (x-cx)*(x-cx)+(y-cy)*(y-cy) <= r*r
+	}
+	return in(body/2, r) || in(body, r+body/2)
+}
+
+// renderSlider draws a textured background, cuts a piece out at a random
+// position and returns the captcha along with the x offset of the piece.
+func renderSlider(width int, height int, size int) (*Slider, int, error) {
+	if width < size*3+20 || height < size+20 {
+		return nil, 0, errs.ErrArgs.WrapMsg("slider captcha too small for piece", "width", width, "height", height, "pieceSize", size)
+	}
+	bg := image.NewRGBA(image.Rect(0, 0, width, height))
+	from, to := randomColor(60, 200), randomColor(60, 200)
+	for x := 0; x < width; x++ {
+		t := float64(x) / float64(width)
+		c := color.RGBA{
+			R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+			G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+			B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+			A: 0xff,
+		}
+		for y := 0; y < height; y++ {
+			bg.SetRGBA(x, y, c)
+		}
+	}
+	// Shapes give the background a texture to match the piece against.
+	for i := 0; i < 12; i++ {
+		c := randomColor(30, 255)
+		c.A = 0x90
+		cx, cy, r := randutil.Intn(width), randutil.Intn(height), 8+randutil.Intn(height/4)
+		rect := image.Rect(cx-r, cy-r, cx+r, cy+r)
+		if i%2 == 0 {
+			draw.DrawMask(bg, rect, image.NewUniform(c), image.Point{}, &circle{r: r}, image.Point{}, draw.Over)
+		} else {
+			draw.Draw(bg, rect, image.NewUniform(c), image.Point{}, draw.Over)
+		}
+	}
+
+	px := size + 10 + randutil.Intn(width-3*size-10)
+	py := 10 + randutil.Intn(height-size-20)
+	piece := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		for y := 0; y < size; y++ {
+			if !pieceMask(size, x, y) {
+				continue
+			}
+			edge := !pieceMask(size, x-1, y) || !pieceMask(size, x+1, y) || !pieceMask(size, x, y-1) || !pieceMask(size, x, y+1)
+			c := bg.RGBAAt(px+x, py+y)
+			if edge {
+				piece.SetRGBA(x, y, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+			} else {
+				piece.SetRGBA(x, y, c)
+			}
+			// Darken the hole left in the background.
+			bg.SetRGBA(px+x, py+y, color.RGBA{R: c.R / 3, G: c.G / 3, B: c.B / 3, A: 0xff})
+		}
+	}
+	background, err := encodePNG(bg)
+	if err != nil {
+		return nil, 0, err
+	}
+	pieceData, err := encodePNG(piece)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &Slider{Background: background, Piece: pieceData, Y: py}, px, nil
+}
+
+// circle is an alpha mask of a disc of radius r centered in its 2r square.
+type circle struct {
+	r int
+}
+
+func (c *circle) ColorModel() color.Model { return color.AlphaModel }
+
+func (c *circle) Bounds() image.Rectangle { return image.Rect(0, 0, 2*c.r, 2*c.r) }
+
+func (c *circle) At(x, y int) color.Color {
+	dx, dy := x-c.r, y-c.r
+	if dx*dx+dy*dy <= c.r*c.r {
+		return color.Alpha{A: 0xff}
+	}
+	return color.Alpha{}
+}
@@ -0,0 +1,307 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cluster keeps a registry of live nodes on a kvstore. Nodes register
+// themselves with heartbeats, every member watches the registry, and a
+// consistent hash ring over the nodes assigns keys such as user IDs to a node,
+// e.g. to shard user connections across gateways.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/kvstore"
+	"github.com/openimsdk/tools/log"
+)
+
+// Node is a registered cluster member.
+type Node struct {
+	ID           string            `json:"id"`
+	Addrs        []string          `json:"addrs,omitempty"`
+	Capabilities []string          `json:"capabilities,omitempty"`
+	Meta         map[string]string `json:"meta,omitempty"`
+	StartedAt    time.Time         `json:"startedAt"`
+}
+
+// Has reports whether the node has capability.
+func (n *Node) Has(capability string) bool {
+	return slices.Contains(n.Capabilities, capability)
+}
+
+// Config configures a Cluster.
+type Config struct {
+	Store  kvstore.Store // Required.
+	Prefix string        // Key prefix of the registry, defaults to "cluster/".
+	// Heartbeat is how often a node renews its registration and members
+	// resynchronize the registry, defaults to 5 seconds.
+	Heartbeat time.Duration
+	// TTL is how long a registration outlives its last heartbeat, defaults
+	// to three heartbeats.
+	TTL time.Duration
+	// Capability restricts the ring to nodes having it, e.g. "gateway".
+	// Empty puts all nodes on the ring.
+	Capability string
+	Replicas   int // Ring points per node, defaults to 128.
+	// OnChange is called from Run with every new membership, starting with
+	// the initial one.
+	OnChange func(m *Membership)
+}
+
+// Membership is a snapshot of the registry.
+type Membership struct {
+	Nodes  []Node // Live nodes sorted by ID.
+	Joined []Node // Nodes added since the previous membership.
+	Left   []Node // Nodes removed since the previous membership.
+	Ring   *Ring  // Ring over the nodes with the configured capability.
+}
+
+// Node returns the node with id.
+func (m *Membership) Node(id string) (Node, bool) {
+	i, ok := slices.BinarySearchFunc(m.Nodes, id, func(n Node, id string) int { return strings.Compare(n.ID, id) })
+	if !ok {
+		return Node{}, false
+	}
+	return m.Nodes[i], true
+}
+
+// Owner returns the node key is assigned to.
+func (m *Membership) Owner(key string) (Node, bool) {
+	return m.Node(m.Ring.Get(key))
+}
+
+// Cluster is the view of one member on the registry.
+type Cluster struct {
+	conf    Config
+	mu      sync.RWMutex
+	current *Membership
+	loaded  bool // Whether the first membership was published.
+	ready   chan struct{}
+}
+
+// New creates a Cluster.
+func New(conf Config) (*Cluster, error) {
+	if conf.Store == nil {
+		return nil, errs.ErrArgs.WrapMsg("cluster store is nil")
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "cluster/"
+	}
+	if conf.Heartbeat <= 0 {
+		conf.Heartbeat = 5 * time.Second
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = 3 * conf.Heartbeat
+	}
+	return &Cluster{
+		conf:    conf,
+		current: &Membership{Ring: NewRing(conf.Replicas)},
+		ready:   make(chan struct{}),
+	}, nil
+}
+
+// Ready is closed once Run loaded the registry.
+func (c *Cluster) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Membership returns the current membership.
+func (c *Cluster) Membership() *Membership {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// Owner returns the node key is assigned to in the current membership.
+func (c *Cluster) Owner(key string) (Node, bool) {
+	return c.Membership().Owner(key)
+}
+
+// Run registers self, unless nil, and follows the registry until ctx is
+// done. self is deregistered before Run returns.
+func (c *Cluster) Run(ctx context.Context, self *Node) error {
+	if self != nil {
+		if self.ID == "" {
+			return errs.ErrArgs.WrapMsg("cluster node id is empty")
+		}
+		if self.StartedAt.IsZero() {
+			self.StartedAt = time.Now()
+		}
+		if err := c.register(ctx, self); err != nil {
+			return err
+		}
+		defer func() {
+			dctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.conf.Heartbeat)
+			defer cancel()
+			if err := c.conf.Store.Delete(dctx, c.conf.Prefix+self.ID); err != nil {
+				log.ZWarn(dctx, "cluster deregister failed", err, "node", self.ID)
+			}
+		}()
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := c.conf.Store.Watch(watchCtx, c.conf.Prefix)
+	if err != nil {
+		return err
+	}
+	if err := c.sync(ctx); err != nil {
+		return err
+	}
+	close(c.ready)
+	ticker := time.NewTicker(c.conf.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-events:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				// Restart a watch that failed and rely on the resync meanwhile.
+				log.ZWarn(ctx, "cluster watch closed", nil, "prefix", c.conf.Prefix)
+				events, err = c.conf.Store.Watch(watchCtx, c.conf.Prefix)
+				if err != nil {
+					log.ZWarn(ctx, "cluster watch failed", err, "prefix", c.conf.Prefix)
+					events = nil
+				}
+				continue
+			}
+			c.apply(ctx, ev)
+		case <-ticker.C:
+			if self != nil {
+				if err := c.register(ctx, self); err != nil {
+					log.ZWarn(ctx, "cluster heartbeat failed", err, "node", self.ID)
+				}
+			}
+			if events == nil {
+				events, _ = c.conf.Store.Watch(watchCtx, c.conf.Prefix)
+			}
+			if err := c.sync(ctx); err != nil && ctx.Err() == nil {
+				log.ZWarn(ctx, "cluster sync failed", err, "prefix", c.conf.Prefix)
+			}
+		}
+	}
+}
+
+func (c *Cluster) register(ctx context.Context, self *Node) error {
+	data, err := json.Marshal(self)
+	if err != nil {
+		return errs.WrapMsg(err, "marshal cluster node failed", "node", self.ID)
+	}
+	_, err = c.conf.Store.Set(ctx, c.conf.Prefix+self.ID, data, c.conf.TTL)
+	return err
+}
+
+func (c *Cluster) decode(ctx context.Context, key string, value []byte) (Node, bool) {
+	var n Node
+	if err := json.Unmarshal(value, &n); err != nil || n.ID == "" {
+		log.ZWarn(ctx, "cluster invalid node", err, "key", key)
+		return n, false
+	}
+	return n, true
+}
+
+// sync replaces the membership with the registry content.
+func (c *Cluster) sync(ctx context.Context) error {
+	entries, err := c.conf.Store.List(ctx, c.conf.Prefix)
+	if err != nil {
+		return err
+	}
+	nodes := make([]Node, 0, len(entries))
+	for _, e := range entries {
+		if n, ok := c.decode(ctx, e.Key, e.Value); ok {
+			nodes = append(nodes, n)
+		}
+	}
+	c.update(nodes)
+	return nil
+}
+
+// apply updates the membership with a watched change.
+func (c *Cluster) apply(ctx context.Context, ev kvstore.Event) {
+	id := strings.TrimPrefix(ev.Key, c.conf.Prefix)
+	nodes := slices.DeleteFunc(slices.Clone(c.Membership().Nodes), func(n Node) bool { return n.ID == id })
+	if ev.Type == kvstore.EventPut {
+		n, ok := c.decode(ctx, ev.Key, ev.Value)
+		if !ok {
+			return
+		}
+		nodes = append(nodes, n)
+	}
+	c.update(nodes)
+}
+
+// update publishes a new membership if the nodes changed.
+func (c *Cluster) update(nodes []Node) {
+	slices.SortFunc(nodes, func(a, b Node) int { return strings.Compare(a.ID, b.ID) })
+	c.mu.Lock()
+	prev := c.current
+	first := !c.loaded
+	c.loaded = true
+	m := &Membership{Nodes: nodes, Joined: diff(nodes, prev.Nodes), Left: diff(prev.Nodes, nodes)}
+	changed := len(m.Joined) > 0 || len(m.Left) > 0 || updated(prev.Nodes, nodes)
+	if !changed && !first {
+		c.mu.Unlock()
+		return
+	}
+	ids := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		if c.conf.Capability == "" || n.Has(c.conf.Capability) {
+			ids = append(ids, n.ID)
+		}
+	}
+	m.Ring = NewRing(c.conf.Replicas, ids...)
+	c.current = m
+	c.mu.Unlock()
+	if len(m.Joined) > 0 || len(m.Left) > 0 {
+		log.ZInfo(context.Background(), "cluster membership changed", "nodes", len(nodes), "joined", len(m.Joined), "left", len(m.Left))
+	}
+	if c.conf.OnChange != nil {
+		c.conf.OnChange(m)
+	}
+}
+
+// diff returns the nodes of a missing in b, both sorted by ID.
+func diff(a, b []Node) []Node {
+	var res []Node
+	for _, n := range a {
+		if _, ok := slices.BinarySearchFunc(b, n.ID, func(n Node, id string) int { return strings.Compare(n.ID, id) }); !ok {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// updated reports whether a node present in both a and b re-registered with
+// different details, e.g. after a restart.
+func updated(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].StartedAt.Equal(b[i].StartedAt) || !slices.Equal(a[i].Addrs, b[i].Addrs) || !slices.Equal(a[i].Capabilities, b[i].Capabilities) ||
+			!maps.Equal(a[i].Meta, b[i].Meta) {
+			return true
+		}
+	}
+	return false
+}
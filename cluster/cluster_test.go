@@ -0,0 +1,172 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRing(t *testing.T) {
+	assert.Equal(t, "", NewRing(0).Get("user"))
+	assert.Nil(t, NewRing(0).GetN("user", 2))
+
+	r := NewRing(0, "gw-1", "gw-2", "gw-3", "gw-2")
+	assert.Equal(t, []string{"gw-1", "gw-2", "gw-3"}, r.Nodes())
+	// The assignment does not depend on the registration order.
+	same := NewRing(0, "gw-3", "gw-1", "gw-2")
+
+	counts := make(map[string]int)
+	const keys = 30000
+	for i := 0; i < keys; i++ {
+		key := "user" + strconv.Itoa(i)
+		owner := r.Get(key)
+		assert.Equal(t, owner, same.Get(key))
+		counts[owner]++
+	}
+	for node, n := range counts {
+		assert.InDelta(t, keys/3, n, keys/3*0.2, node)
+	}
+
+	// Adding a node only moves keys to it.
+	grown := NewRing(0, "gw-1", "gw-2", "gw-3", "gw-4")
+	var moved int
+	for i := 0; i < keys; i++ {
+		key := "user" + strconv.Itoa(i)
+		if before, after := r.Get(key), grown.Get(key); before != after {
+			assert.Equal(t, "gw-4", after)
+			moved++
+		}
+	}
+	assert.InDelta(t, keys/4, moved, keys/4*0.2)
+
+	replicas := r.GetN("user1", 5)
+	assert.Len(t, replicas, 3)
+	assert.Equal(t, r.Get("user1"), replicas[0])
+	assert.ElementsMatch(t, []string{"gw-1", "gw-2", "gw-3"}, replicas)
+}
+
+type changes struct {
+	mu   sync.Mutex
+	list []*Membership
+}
+
+func (c *changes) add(m *Membership) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.list = append(c.list, m)
+}
+
+func (c *changes) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.list)
+}
+
+func (c *changes) last() *Membership {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.list) == 0 {
+		return nil
+	}
+	return c.list[len(c.list)-1]
+}
+
+func ids(nodes []Node) []string {
+	res := make([]string, len(nodes))
+	for i, n := range nodes {
+		res[i] = n.ID
+	}
+	return res
+}
+
+func TestCluster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := kvstore.NewMemory()
+	conf := Config{Store: store, Heartbeat: 50 * time.Millisecond, Capability: "gateway"}
+
+	var seen changes
+	observerConf := conf
+	observerConf.OnChange = seen.add
+	observer, err := New(observerConf)
+	require.NoError(t, err)
+	go observer.Run(ctx, nil)
+	<-observer.Ready()
+	require.NotNil(t, seen.last())
+	assert.Empty(t, seen.last().Nodes)
+
+	run := func(node Node) context.CancelFunc {
+		c, err := New(conf)
+		require.NoError(t, err)
+		nctx, ncancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			assert.NoError(t, c.Run(nctx, &node))
+		}()
+		return func() {
+			ncancel()
+			<-done
+		}
+	}
+	stop1 := run(Node{ID: "gw-1", Addrs: []string{"10.0.0.1:10001"}, Capabilities: []string{"gateway"}})
+	defer stop1()
+	stop2 := run(Node{ID: "gw-2", Addrs: []string{"10.0.0.2:10001"}, Capabilities: []string{"gateway"}})
+	stopAPI := run(Node{ID: "api-1", Capabilities: []string{"api"}})
+	defer stopAPI()
+
+	require.Eventually(t, func() bool { return len(observer.Membership().Nodes) == 3 }, time.Second, 5*time.Millisecond)
+	m := observer.Membership()
+	assert.Equal(t, []string{"api-1", "gw-1", "gw-2"}, ids(m.Nodes))
+	assert.Equal(t, []string{"gw-1", "gw-2"}, m.Ring.Nodes())
+	owner, ok := observer.Owner("user-42")
+	assert.True(t, ok)
+	assert.True(t, owner.Has("gateway"))
+	n, ok := m.Node("gw-1")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"10.0.0.1:10001"}, n.Addrs)
+
+	// Heartbeats alone do not change the membership.
+	count := seen.len()
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, count, seen.len())
+
+	stop2()
+	require.Eventually(t, func() bool { return len(observer.Membership().Nodes) == 2 }, time.Second, 5*time.Millisecond)
+	last := seen.last()
+	assert.Equal(t, []string{"gw-2"}, ids(last.Left))
+	assert.Equal(t, []string{"gw-1"}, last.Ring.Nodes())
+	owner, _ = observer.Owner("user-42")
+	assert.Equal(t, "gw-1", owner.ID)
+
+	// A node that stops heartbeating expires.
+	data, err := json.Marshal(Node{ID: "gw-3", Capabilities: []string{"gateway"}})
+	require.NoError(t, err)
+	_, err = store.Set(ctx, "cluster/gw-3", data, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(observer.Membership().Ring.Nodes()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"gw-3"}, ids(seen.last().Joined))
+	require.Eventually(t, func() bool { return len(observer.Membership().Ring.Nodes()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"gw-3"}, ids(seen.last().Left))
+}
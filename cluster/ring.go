@@ -0,0 +1,120 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// Ring is an immutable consistent hash ring over node IDs. Every node owns
+// replicas points on the ring, so adding or removing a node only moves the
+// keys next to its points, about 1/n of all keys.
+type Ring struct {
+	points []uint64
+	owners map[uint64]string
+	nodes  []string
+}
+
+// NewRing builds a ring with replicas points per node, 128 when zero.
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = 128
+	}
+	r := &Ring{owners: make(map[uint64]string, replicas*len(nodes))}
+	seen := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		if _, ok := seen[node]; ok {
+			continue
+		}
+		seen[node] = struct{}{}
+		r.nodes = append(r.nodes, node)
+		for i := 0; i < replicas; i++ {
+			p := hashKey(node + "#" + strconv.Itoa(i))
+			// Resolve collisions independently of the node order.
+			if owner, ok := r.owners[p]; !ok || node < owner {
+				r.owners[p] = node
+			}
+		}
+	}
+	r.points = make([]uint64, 0, len(r.owners))
+	for p := range r.owners {
+		r.points = append(r.points, p)
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	sort.Strings(r.nodes)
+	return r
+}
+
+// hashKey is FNV-1a with a final avalanche, as FNV alone clusters similar
+// keys like "node#1" and "node#2".
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// Nodes returns the node IDs on the ring, sorted.
+func (r *Ring) Nodes() []string {
+	return append([]string(nil), r.nodes...)
+}
+
+// Len returns the number of nodes.
+func (r *Ring) Len() int {
+	return len(r.nodes)
+}
+
+// Get returns the node owning key, or "" when the ring is empty.
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	return r.owners[r.points[r.search(key)]]
+}
+
+// GetN returns up to n distinct nodes for key in ring order, the owner first,
+// e.g. to place replicas.
+func (r *Ring) GetN(key string, n int) []string {
+	n = min(n, len(r.nodes))
+	if n <= 0 {
+		return nil
+	}
+	res := make([]string, 0, n)
+	seen := make(map[string]struct{}, n)
+	for i, start := 0, r.search(key); len(res) < n && i < len(r.points); i++ {
+		node := r.owners[r.points[(start+i)%len(r.points)]]
+		if _, ok := seen[node]; !ok {
+			seen[node] = struct{}{}
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+func (r *Ring) search(key string) int {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return i
+}
@@ -0,0 +1,246 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package connmap is a sharded registry of online connections keyed by user
+// and platform, as kept by gateways. All connections of a user live in one
+// shard, so enumerating a user and replacing connections on login are atomic
+// while different users rarely contend.
+package connmap
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// Entry is a registered connection.
+type Entry[C comparable] struct {
+	UserID     string
+	PlatformID int
+	Conn       C
+}
+
+type user[C comparable] struct {
+	platforms map[int][]C
+}
+
+type shard[C comparable] struct {
+	mu    sync.RWMutex
+	users map[string]*user[C]
+}
+
+// ConnMap maps users and platforms to connections. It is safe for
+// concurrent use.
+type ConnMap[C comparable] struct {
+	shards []shard[C]
+	users  atomic.Int64
+	conns  atomic.Int64
+}
+
+// New creates a ConnMap with n shards, 64 when n <= 0.
+func New[C comparable](n int) *ConnMap[C] {
+	if n <= 0 {
+		n = 64
+	}
+	m := &ConnMap[C]{shards: make([]shard[C], n)}
+	for i := range m.shards {
+		m.shards[i].users = make(map[string]*user[C])
+	}
+	return m
+}
+
+func (m *ConnMap[C]) shard(userID string) *shard[C] {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userID))
+	return &m.shards[h.Sum32()%uint32(len(m.shards))]
+}
+
+// Add registers conn next to the existing connections of the platform.
+func (m *ConnMap[C]) Add(userID string, platformID int, conn C) {
+	s := m.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[userID]
+	if u == nil {
+		u = &user[C]{platforms: make(map[int][]C)}
+		s.users[userID] = u
+		m.users.Add(1)
+	}
+	u.platforms[platformID] = append(u.platforms[platformID], conn)
+	m.conns.Add(1)
+}
+
+// Replace registers conn and, in the same step, removes the connections of
+// the user on every platform for which kick returns true. It returns the
+// removed connections so the caller can close them; a nil kick removes the
+// connections of platformID only. No other goroutine observes the user with
+// both the old and the new connection.
+func (m *ConnMap[C]) Replace(userID string, platformID int, conn C, kick func(platformID int) bool) []Entry[C] {
+	if kick == nil {
+		kick = func(p int) bool { return p == platformID }
+	}
+	s := m.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var removed []Entry[C]
+	u := s.users[userID]
+	if u == nil {
+		u = &user[C]{platforms: make(map[int][]C)}
+		s.users[userID] = u
+		m.users.Add(1)
+	}
+	for p, conns := range u.platforms {
+		if !kick(p) {
+			continue
+		}
+		for _, c := range conns {
+			removed = append(removed, Entry[C]{UserID: userID, PlatformID: p, Conn: c})
+		}
+		delete(u.platforms, p)
+		m.conns.Add(-int64(len(conns)))
+	}
+	u.platforms[platformID] = append(u.platforms[platformID], conn)
+	m.conns.Add(1)
+	return removed
+}
+
+// Remove unregisters conn and reports whether it was registered. A
+// connection that was already replaced is not found, so a late disconnect
+// does not remove its successor.
+func (m *ConnMap[C]) Remove(userID string, platformID int, conn C) bool {
+	s := m.shard(userID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.users[userID]
+	if u == nil {
+		return false
+	}
+	conns := u.platforms[platformID]
+	for i, c := range conns {
+		if c != conn {
+			continue
+		}
+		conns = append(conns[:i:i], conns[i+1:]...)
+		if len(conns) == 0 {
+			delete(u.platforms, platformID)
+		} else {
+			u.platforms[platformID] = conns
+		}
+		if len(u.platforms) == 0 {
+			delete(s.users, userID)
+			m.users.Add(-1)
+		}
+		m.conns.Add(-1)
+		return true
+	}
+	return false
+}
+
+// Get returns the connections of a user on a platform.
+func (m *ConnMap[C]) Get(userID string, platformID int) []C {
+	s := m.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[userID]
+	if u == nil {
+		return nil
+	}
+	return append([]C(nil), u.platforms[platformID]...)
+}
+
+// User returns all connections of a user.
+func (m *ConnMap[C]) User(userID string) []Entry[C] {
+	s := m.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u := s.users[userID]
+	if u == nil {
+		return nil
+	}
+	var entries []Entry[C]
+	for p, conns := range u.platforms {
+		for _, c := range conns {
+			entries = append(entries, Entry[C]{UserID: userID, PlatformID: p, Conn: c})
+		}
+	}
+	return entries
+}
+
+// Online reports whether a user has any connection.
+func (m *ConnMap[C]) Online(userID string) bool {
+	s := m.shard(userID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[userID] != nil
+}
+
+// Range calls fn for every connection until it returns false. Each shard is
+// read locked while its connections are visited, so fn must not modify the
+// map.
+func (m *ConnMap[C]) Range(fn func(e Entry[C]) bool) {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for userID, u := range s.users {
+			for p, conns := range u.platforms {
+				for _, c := range conns {
+					if !fn(Entry[C]{UserID: userID, PlatformID: p, Conn: c}) {
+						s.mu.RUnlock()
+						return
+					}
+				}
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// Users returns the number of users with at least one connection.
+func (m *ConnMap[C]) Users() int {
+	return int(m.users.Load())
+}
+
+// Len returns the number of connections.
+func (m *ConnMap[C]) Len() int {
+	return int(m.conns.Load())
+}
+
+// Stats describes the content of a ConnMap.
+type Stats struct {
+	Users     int
+	Conns     int
+	Platforms map[int]int // Connections per platform.
+	MaxShard  int         // Users in the fullest shard, to spot skew.
+}
+
+// Stats counts connections per platform. It visits every shard.
+func (m *ConnMap[C]) Stats() Stats {
+	stats := Stats{Platforms: make(map[int]int)}
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		stats.Users += len(s.users)
+		if len(s.users) > stats.MaxShard {
+			stats.MaxShard = len(s.users)
+		}
+		for _, u := range s.users {
+			for p, conns := range u.platforms {
+				stats.Platforms[p] += len(conns)
+				stats.Conns += len(conns)
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return stats
+}
@@ -0,0 +1,108 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type conn struct{ id int }
+
+func TestConnMap(t *testing.T) {
+	m := New[*conn](4)
+	ios, android, web := &conn{1}, &conn{2}, &conn{3}
+	m.Add("u1", 1, ios)
+	m.Add("u1", 2, android)
+	m.Add("u1", 5, web)
+	m.Add("u2", 1, &conn{4})
+	assert.Equal(t, 2, m.Users())
+	assert.Equal(t, 4, m.Len())
+	assert.True(t, m.Online("u1"))
+	assert.Len(t, m.User("u1"), 3)
+	assert.Equal(t, []*conn{ios}, m.Get("u1", 1))
+
+	// Login on another phone kicks both phone platforms, web stays.
+	phone := &conn{5}
+	removed := m.Replace("u1", 2, phone, func(p int) bool { return p == 1 || p == 2 })
+	assert.ElementsMatch(t, []Entry[*conn]{{UserID: "u1", PlatformID: 1, Conn: ios}, {UserID: "u1", PlatformID: 2, Conn: android}}, removed)
+	assert.Equal(t, 3, m.Len())
+	assert.Nil(t, m.Get("u1", 1))
+
+	// The late disconnect of a kicked connection does not remove its successor.
+	assert.False(t, m.Remove("u1", 2, android))
+	assert.Equal(t, []*conn{phone}, m.Get("u1", 2))
+
+	removed = m.Replace("u3", 1, &conn{6}, nil)
+	assert.Empty(t, removed)
+	assert.Equal(t, 3, m.Users())
+
+	assert.True(t, m.Remove("u1", 2, phone))
+	assert.True(t, m.Remove("u1", 5, web))
+	assert.False(t, m.Online("u1"))
+	assert.Equal(t, 2, m.Users())
+
+	stats := m.Stats()
+	assert.Equal(t, 2, stats.Users)
+	assert.Equal(t, 2, stats.Conns)
+	assert.Equal(t, map[int]int{1: 2}, stats.Platforms)
+
+	var n int
+	m.Range(func(e Entry[*conn]) bool {
+		n++
+		return false
+	})
+	assert.Equal(t, 1, n)
+}
+
+func TestConcurrent(t *testing.T) {
+	m := New[int](0)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				userID := strconv.Itoa(i % 50)
+				c := g*1000 + i
+				m.Replace(userID, g%3, c, nil)
+				m.Add(userID, 9, c)
+				m.Remove(userID, 9, c)
+				_ = m.User(userID)
+			}
+		}(g)
+	}
+	wg.Wait()
+	stats := m.Stats()
+	assert.Equal(t, stats.Users, m.Users())
+	assert.Equal(t, stats.Conns, m.Len())
+	assert.Equal(t, 0, stats.Platforms[9])
+}
+
+func BenchmarkAddRemove(b *testing.B) {
+	m := New[int](0)
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			userID := strconv.Itoa(i % 100000)
+			m.Add(userID, 1, i)
+			m.Remove(userID, 1, i)
+			i++
+		}
+	})
+}
@@ -0,0 +1,320 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cachekey builds Redis keys laid out as prefix:version:entity:id,
+// e.g. "IM:v2:user_info:u1". Schemas are registered once, which rejects two
+// caches claiming the same key space, and keys parse back into their ids, so
+// keys found by SCAN or in keyspace notifications can be attributed.
+//
+// Ids are escaped so that a ":" inside an id cannot shift the layout.
+package cachekey
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const sep = ":"
+
+var ErrCollision = errs.New("cache key schema collision")
+
+// Schema describes the keys of one cached entity.
+type Schema struct {
+	Prefix  string   // Application or service, e.g. "IM".
+	Version int      // Bumped when the value format changes, written as "v2".
+	Entity  string   // e.g. "user_info".
+	Fields  []string // Names of the ids following the entity, e.g. "userID".
+}
+
+// base returns the key part shared by all keys of the schema.
+func (s Schema) base() string {
+	return s.Prefix + sep + "v" + strconv.Itoa(s.Version) + sep + s.Entity
+}
+
+func (s Schema) validate() error {
+	for _, name := range []string{s.Prefix, s.Entity} {
+		if !validName(name) {
+			return errs.ErrArgs.WrapMsg("invalid cache key name", "name", name)
+		}
+	}
+	if s.Version < 0 {
+		return errs.ErrArgs.WrapMsg("invalid cache key version", "version", s.Version)
+	}
+	if len(s.Fields) == 0 {
+		return errs.ErrArgs.WrapMsg("cache key schema has no fields", "entity", s.Entity)
+	}
+	return nil
+}
+
+// validName accepts letters, digits, "_", "-" and ".".
+func validName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Registry holds the registered schemas.
+type Registry struct {
+	mu        sync.RWMutex
+	templates map[string]*Template // By base.
+}
+
+func NewRegistry() *Registry {
+	return &Registry{templates: make(map[string]*Template)}
+}
+
+// Default is the registry used by Register and MustRegister.
+var Default = NewRegistry()
+
+// Register adds a schema. It fails with ErrCollision when the same prefix,
+// version and entity are already registered.
+func (r *Registry) Register(s Schema) (*Template, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	s.Fields = append([]string(nil), s.Fields...)
+	t := &Template{schema: s, base: s.base()}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.templates[t.base]; ok {
+		return nil, ErrCollision.WrapMsg("cache key schema already registered", "key", t.base, "fields", old.schema.Fields)
+	}
+	r.templates[t.base] = t
+	return t, nil
+}
+
+// MustRegister is Register panicking on errors, for package level schemas.
+func (r *Registry) MustRegister(s Schema) *Template {
+	t, err := r.Register(s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Lookup finds the template of key and parses its ids.
+func (r *Registry) Lookup(key string) (*Template, []string, error) {
+	parts := strings.SplitN(key, sep, 4)
+	if len(parts) == 4 {
+		r.mu.RLock()
+		t, ok := r.templates[strings.Join(parts[:3], sep)]
+		r.mu.RUnlock()
+		if ok {
+			ids, err := t.Parse(key)
+			return t, ids, err
+		}
+	}
+	return nil, nil, errs.ErrRecordNotFound.WrapMsg("no cache key schema matches", "key", key)
+}
+
+// Schemas returns the registered schemas sorted by key.
+func (r *Registry) Schemas() []Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	schemas := make([]Schema, 0, len(r.templates))
+	for _, t := range r.templates {
+		schemas = append(schemas, t.schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].base() < schemas[j].base() })
+	return schemas
+}
+
+func Register(s Schema) (*Template, error) {
+	return Default.Register(s)
+}
+
+func MustRegister(s Schema) *Template {
+	return Default.MustRegister(s)
+}
+
+// Template builds and parses the keys of a schema.
+type Template struct {
+	schema Schema
+	base   string
+}
+
+func (t *Template) Schema() Schema {
+	return t.schema
+}
+
+// Key returns the key of ids, one per field, formatted like fmt's %v with
+// ":" and "%" escaped. It panics when the number of ids does not match.
+func (t *Template) Key(ids ...any) string {
+	if len(ids) != len(t.schema.Fields) {
+		panic("cachekey: " + t.base + " takes " + strconv.Itoa(len(t.schema.Fields)) + " ids, got " + strconv.Itoa(len(ids)))
+	}
+	var b strings.Builder
+	b.WriteString(t.base)
+	for _, id := range ids {
+		b.WriteString(sep)
+		b.WriteString(escape(formatID(reflect.ValueOf(id))))
+	}
+	return b.String()
+}
+
+// Pattern returns the SCAN pattern matching every key of the template.
+func (t *Template) Pattern() string {
+	return t.base + sep + "*"
+}
+
+// Parse returns the ids of a key built by the template.
+func (t *Template) Parse(key string) ([]string, error) {
+	rest, ok := strings.CutPrefix(key, t.base+sep)
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("cache key does not match schema", "key", key, "schema", t.base)
+	}
+	parts := strings.Split(rest, sep)
+	if len(parts) != len(t.schema.Fields) {
+		return nil, errs.ErrArgs.WrapMsg("cache key has wrong number of ids", "key", key, "fields", t.schema.Fields)
+	}
+	for i, p := range parts {
+		id, err := unescape(p)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "invalid cache key id", "key", key)
+		}
+		parts[i] = id
+	}
+	return parts, nil
+}
+
+// ID is the type of ids accepted by the typed keys.
+type ID interface {
+	~string | ~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+// Key1 builds keys of a schema with one id.
+type Key1[A ID] struct{ t *Template }
+
+// NewKey1 types a template with one field. It panics on other templates.
+func NewKey1[A ID](t *Template) Key1[A] {
+	mustFields(t, 1)
+	return Key1[A]{t: t}
+}
+
+func (k Key1[A]) Key(a A) string {
+	return k.t.Key(a)
+}
+
+func (k Key1[A]) Template() *Template {
+	return k.t
+}
+
+func (k Key1[A]) Parse(key string) (a A, err error) {
+	ids, err := k.t.Parse(key)
+	if err != nil {
+		return a, err
+	}
+	err = parseID(ids[0], &a)
+	return a, err
+}
+
+// Key2 builds keys of a schema with two ids.
+type Key2[A, B ID] struct{ t *Template }
+
+// NewKey2 types a template with two fields. It panics on other templates.
+func NewKey2[A, B ID](t *Template) Key2[A, B] {
+	mustFields(t, 2)
+	return Key2[A, B]{t: t}
+}
+
+func (k Key2[A, B]) Key(a A, b B) string {
+	return k.t.Key(a, b)
+}
+
+func (k Key2[A, B]) Template() *Template {
+	return k.t
+}
+
+func (k Key2[A, B]) Parse(key string) (a A, b B, err error) {
+	ids, err := k.t.Parse(key)
+	if err != nil {
+		return a, b, err
+	}
+	if err = parseID(ids[0], &a); err != nil {
+		return a, b, err
+	}
+	err = parseID(ids[1], &b)
+	return a, b, err
+}
+
+func mustFields(t *Template, n int) {
+	if len(t.schema.Fields) != n {
+		panic("cachekey: " + t.base + " has " + strconv.Itoa(len(t.schema.Fields)) + " fields, not " + strconv.Itoa(n))
+	}
+}
+
+func formatID(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	default:
+		panic("cachekey: unsupported id type " + v.Type().String())
+	}
+}
+
+func parseID[T ID](s string, out *T) error {
+	v := reflect.ValueOf(out).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errs.WrapMsg(err, "invalid integer cache key id", "id", s)
+		}
+		v.SetInt(n)
+	default:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errs.WrapMsg(err, "invalid integer cache key id", "id", s)
+		}
+		v.SetUint(n)
+	}
+	return nil
+}
+
+var (
+	escaper   = strings.NewReplacer("%", "%25", ":", "%3A")
+	unescaper = strings.NewReplacer("%25", "%", "%3A", ":")
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) (string, error) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && !strings.HasPrefix(s[i:], "%25") && !strings.HasPrefix(s[i:], "%3A") {
+			return "", errs.ErrArgs.WrapMsg("invalid escape in cache key id", "id", s)
+		}
+	}
+	return unescaper.Replace(s), nil
+}
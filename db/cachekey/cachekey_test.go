@@ -0,0 +1,83 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cachekey
+
+import (
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type userID string
+
+func TestTemplate(t *testing.T) {
+	r := NewRegistry()
+	tpl, err := r.Register(Schema{Prefix: "IM", Version: 2, Entity: "user_info", Fields: []string{"userID"}})
+	require.NoError(t, err)
+	assert.Equal(t, "IM:v2:user_info:u1", tpl.Key("u1"))
+	assert.Equal(t, "IM:v2:user_info:*", tpl.Pattern())
+
+	key := tpl.Key("a:b%c")
+	assert.Equal(t, "IM:v2:user_info:a%3Ab%25c", key)
+	ids, err := tpl.Parse(key)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a:b%c"}, ids)
+
+	_, err = tpl.Parse("IM:v2:user_info:a:b")
+	assert.Error(t, err)
+	_, err = tpl.Parse("IM:v2:user_info:a%zz")
+	assert.Error(t, err)
+	assert.Panics(t, func() { tpl.Key("a", "b") })
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(Schema{Prefix: "IM", Version: 1, Entity: "seq", Fields: []string{"conversationID"}})
+	_, err := r.Register(Schema{Prefix: "IM", Version: 1, Entity: "seq", Fields: []string{"userID"}})
+	assert.True(t, ErrCollision.Is(err))
+	_, err = r.Register(Schema{Prefix: "IM", Version: 2, Entity: "seq", Fields: []string{"conversationID"}})
+	assert.NoError(t, err)
+	_, err = r.Register(Schema{Prefix: "IM", Version: 1, Entity: "a:b", Fields: []string{"id"}})
+	assert.Error(t, err)
+
+	tpl, ids, err := r.Lookup("IM:v2:seq:si_1_2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, tpl.Schema().Version)
+	assert.Equal(t, []string{"si_1_2"}, ids)
+	_, _, err = r.Lookup("OTHER:v1:seq:x")
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	assert.Len(t, r.Schemas(), 2)
+}
+
+func TestTypedKeys(t *testing.T) {
+	r := NewRegistry()
+	k1 := NewKey1[userID](r.MustRegister(Schema{Prefix: "IM", Version: 1, Entity: "token", Fields: []string{"userID"}}))
+	id, err := k1.Parse(k1.Key("u:1"))
+	require.NoError(t, err)
+	assert.Equal(t, userID("u:1"), id)
+
+	k2 := NewKey2[string, int32](r.MustRegister(Schema{Prefix: "IM", Version: 1, Entity: "online", Fields: []string{"userID", "platformID"}}))
+	assert.Equal(t, "IM:v1:online:u1:5", k2.Key("u1", 5))
+	u, p, err := k2.Parse("IM:v1:online:u1:5")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", u)
+	assert.Equal(t, int32(5), p)
+	_, _, err = k2.Parse("IM:v1:online:u1:x")
+	assert.Error(t, err)
+
+	assert.Panics(t, func() { NewKey2[string, string](k1.Template()) })
+}
@@ -0,0 +1,264 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dualwrite helps migrating a storage layer, e.g. from a single Redis
+// to a Redis cluster or between databases. Writes go to both the primary and
+// the secondary implementation; reads are served by one side and shadowed on
+// the other asynchronously, counting how often the results diverge.
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/randutil"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DivergenceKind tells how a shadow read differed.
+type DivergenceKind string
+
+const (
+	Mismatch       DivergenceKind = "mismatch"        // Both sides succeeded with different values.
+	ServingError   DivergenceKind = "serving_error"   // Only the serving side failed.
+	ShadowError    DivergenceKind = "shadow_error"    // Only the shadow side failed.
+	ErrorsMismatch DivergenceKind = "errors_mismatch" // Both failed with different errors.
+)
+
+// Divergence describes one shadow read whose results differed.
+type Divergence[V any] struct {
+	Key          string
+	Kind         DivergenceKind
+	Primary      V
+	Secondary    V
+	PrimaryErr   error
+	SecondaryErr error
+}
+
+// Config configures a Dual.
+type Config[V any] struct {
+	Name string // Used in logs.
+	// Equal compares values, defaults to reflect.DeepEqual.
+	Equal func(primary, secondary V) bool
+	// ErrorEqual compares errors when both sides failed. The default treats
+	// errors as equal when one matches the other or both mean not found.
+	ErrorEqual func(primary, secondary error) bool
+	// SampleRate is the fraction of reads that are shadowed, defaults to 1.
+	SampleRate float64
+	// ShadowTimeout bounds a shadow read, defaults to 1 second.
+	ShadowTimeout time.Duration
+	// Workers run shadow reads, defaults to 4. QueueSize defaults to 1024;
+	// shadow reads are dropped while the queue is full.
+	Workers   int
+	QueueSize int
+	// StrictWrites fails a write when the secondary write fails. By default
+	// the failure is only counted and logged.
+	StrictWrites bool
+	// OnDivergence is called from a worker for every divergence. Without it
+	// divergences are logged.
+	OnDivergence func(ctx context.Context, d *Divergence[V])
+}
+
+// Stats are cumulative counters of a Dual.
+type Stats struct {
+	Writes               int64
+	SecondaryWriteErrors int64
+	Reads                int64
+	Shadowed             int64 // Shadow reads compared.
+	Dropped              int64 // Shadow reads dropped because the queue was full.
+	Matched              int64
+	Diverged             int64
+}
+
+// DivergenceRate is the fraction of compared shadow reads that diverged.
+func (s Stats) DivergenceRate() float64 {
+	if s.Shadowed == 0 {
+		return 0
+	}
+	return float64(s.Diverged) / float64(s.Shadowed)
+}
+
+type shadow[V any] struct {
+	ctx     context.Context
+	key     string
+	served  V
+	err     error
+	read    func(ctx context.Context) (V, error)
+	primary bool // Whether the primary served the read.
+}
+
+// Dual routes operations to a primary and a secondary storage.
+type Dual[V any] struct {
+	conf          Config[V]
+	readSecondary atomic.Bool
+	queue         chan *shadow[V]
+	wg            sync.WaitGroup
+	closeOnce     sync.Once
+
+	writes, secondaryWriteErrors, reads, shadowed, dropped, matched, diverged atomic.Int64
+}
+
+// New creates a Dual and starts its shadow read workers.
+func New[V any](conf Config[V]) *Dual[V] {
+	if conf.Equal == nil {
+		conf.Equal = func(a, b V) bool { return reflect.DeepEqual(a, b) }
+	}
+	if conf.ErrorEqual == nil {
+		conf.ErrorEqual = defaultErrorEqual
+	}
+	if conf.SampleRate <= 0 {
+		conf.SampleRate = 1
+	}
+	if conf.ShadowTimeout <= 0 {
+		conf.ShadowTimeout = time.Second
+	}
+	if conf.Workers <= 0 {
+		conf.Workers = 4
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 1024
+	}
+	d := &Dual[V]{conf: conf, queue: make(chan *shadow[V], conf.QueueSize)}
+	for i := 0; i < conf.Workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+func defaultErrorEqual(primary, secondary error) bool {
+	return errors.Is(primary, secondary) || errors.Is(secondary, primary) || (isNotFound(primary) && isNotFound(secondary))
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, errs.ErrRecordNotFound) || errors.Is(err, redis.Nil) || errors.Is(err, mongo.ErrNoDocuments)
+}
+
+// SetReadSecondary switches which side serves reads; the other side becomes
+// the shadow. Writes always go to the primary first.
+func (d *Dual[V]) SetReadSecondary(v bool) {
+	d.readSecondary.Store(v)
+}
+
+// Write runs write on the primary, then on the secondary. A primary failure
+// is returned without touching the secondary.
+func (d *Dual[V]) Write(ctx context.Context, key string, primary, secondary func(ctx context.Context) error) error {
+	d.writes.Add(1)
+	if err := primary(ctx); err != nil {
+		return err
+	}
+	if err := secondary(ctx); err != nil {
+		d.secondaryWriteErrors.Add(1)
+		if d.conf.StrictWrites {
+			return err
+		}
+		log.ZWarn(ctx, "dual write secondary failed", err, "name", d.conf.Name, "key", key)
+	}
+	return nil
+}
+
+// Read serves the read from the current serving side and queues a shadow
+// read on the other side to compare results.
+func (d *Dual[V]) Read(ctx context.Context, key string, primary, secondary func(ctx context.Context) (V, error)) (V, error) {
+	d.reads.Add(1)
+	serve, other, fromPrimary := primary, secondary, true
+	if d.readSecondary.Load() {
+		serve, other, fromPrimary = secondary, primary, false
+	}
+	v, err := serve(ctx)
+	if !randutil.Sample(d.conf.SampleRate) {
+		return v, err
+	}
+	s := &shadow[V]{ctx: context.WithoutCancel(ctx), key: key, served: v, err: err, read: other, primary: fromPrimary}
+	select {
+	case d.queue <- s:
+	default:
+		d.dropped.Add(1)
+	}
+	return v, err
+}
+
+func (d *Dual[V]) work() {
+	defer d.wg.Done()
+	for s := range d.queue {
+		d.compare(s)
+	}
+}
+
+func (d *Dual[V]) compare(s *shadow[V]) {
+	ctx, cancel := context.WithTimeout(s.ctx, d.conf.ShadowTimeout)
+	v, err := s.read(ctx)
+	cancel()
+	d.shadowed.Add(1)
+	div := &Divergence[V]{Key: s.key}
+	if s.primary {
+		div.Primary, div.PrimaryErr, div.Secondary, div.SecondaryErr = s.served, s.err, v, err
+	} else {
+		div.Primary, div.PrimaryErr, div.Secondary, div.SecondaryErr = v, err, s.served, s.err
+	}
+	switch {
+	case s.err == nil && err == nil:
+		if d.conf.Equal(div.Primary, div.Secondary) {
+			d.matched.Add(1)
+			return
+		}
+		div.Kind = Mismatch
+	case s.err != nil && err != nil:
+		if d.conf.ErrorEqual(div.PrimaryErr, div.SecondaryErr) {
+			d.matched.Add(1)
+			return
+		}
+		div.Kind = ErrorsMismatch
+	case s.err != nil:
+		div.Kind = ServingError
+	default:
+		div.Kind = ShadowError
+	}
+	d.diverged.Add(1)
+	if d.conf.OnDivergence != nil {
+		d.conf.OnDivergence(s.ctx, div)
+		return
+	}
+	log.ZWarn(s.ctx, "dual read diverged", nil, "name", d.conf.Name, "key", s.key, "kind", div.Kind,
+		"primaryErr", div.PrimaryErr, "secondaryErr", div.SecondaryErr)
+}
+
+// Stats returns a snapshot of the counters.
+func (d *Dual[V]) Stats() Stats {
+	return Stats{
+		Writes:               d.writes.Load(),
+		SecondaryWriteErrors: d.secondaryWriteErrors.Load(),
+		Reads:                d.reads.Load(),
+		Shadowed:             d.shadowed.Load(),
+		Dropped:              d.dropped.Load(),
+		Matched:              d.matched.Load(),
+		Diverged:             d.diverged.Load(),
+	}
+}
+
+// Close waits for queued shadow reads to finish. Read must not be called
+// after Close.
+func (d *Dual[V]) Close() {
+	d.closeOnce.Do(func() {
+		close(d.queue)
+		d.wg.Wait()
+	})
+}
@@ -0,0 +1,170 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dualwrite
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type store struct {
+	mu   sync.Mutex
+	data map[string]string
+	fail error
+}
+
+func newStore() *store {
+	return &store{data: make(map[string]string)}
+}
+
+func (s *store) set(key, value string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail != nil {
+			return s.fail
+		}
+		s.data[key] = value
+		return nil
+	}
+}
+
+func (s *store) get(key string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.fail != nil {
+			return "", s.fail
+		}
+		v, ok := s.data[key]
+		if !ok {
+			return "", redis.Nil
+		}
+		return v, nil
+	}
+}
+
+func TestWrite(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := newStore(), newStore()
+	d := New(Config[string]{})
+	defer d.Close()
+
+	require.NoError(t, d.Write(ctx, "a", primary.set("a", "1"), secondary.set("a", "1")))
+	assert.Equal(t, "1", secondary.data["a"])
+
+	secondary.fail = errs.New("secondary down")
+	require.NoError(t, d.Write(ctx, "b", primary.set("b", "2"), secondary.set("b", "2")))
+	assert.Equal(t, "2", primary.data["b"])
+
+	strict := New(Config[string]{StrictWrites: true})
+	defer strict.Close()
+	assert.Error(t, strict.Write(ctx, "c", primary.set("c", "3"), secondary.set("c", "3")))
+
+	primary.fail = errs.New("primary down")
+	secondary.fail = nil
+	assert.Error(t, d.Write(ctx, "d", primary.set("d", "4"), secondary.set("d", "4")))
+	_, ok := secondary.data["d"]
+	assert.False(t, ok, "secondary is not written when the primary fails")
+
+	stats := d.Stats()
+	assert.Equal(t, int64(3), stats.Writes)
+	assert.Equal(t, int64(1), stats.SecondaryWriteErrors)
+}
+
+func TestShadowRead(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := newStore(), newStore()
+	primary.data = map[string]string{"same": "1", "diff": "p", "onlyPrimary": "x"}
+	secondary.data = map[string]string{"same": "1", "diff": "s"}
+
+	var (
+		mu          sync.Mutex
+		divergences = map[string]DivergenceKind{}
+	)
+	d := New(Config[string]{Name: "cache", OnDivergence: func(ctx context.Context, div *Divergence[string]) {
+		mu.Lock()
+		defer mu.Unlock()
+		divergences[div.Key] = div.Kind
+	}})
+	for _, key := range []string{"same", "diff", "onlyPrimary", "missing"} {
+		v, err := d.Read(ctx, key, primary.get(key), secondary.get(key))
+		if key == "missing" {
+			assert.ErrorIs(t, err, redis.Nil)
+		} else {
+			require.NoError(t, err)
+			assert.Equal(t, primary.data[key], v)
+		}
+	}
+
+	d.SetReadSecondary(true)
+	v, err := d.Read(ctx, "diff", primary.get("diff"), secondary.get("diff"))
+	require.NoError(t, err)
+	assert.Equal(t, "s", v)
+	d.Close()
+
+	assert.Equal(t, map[string]DivergenceKind{"diff": Mismatch, "onlyPrimary": ShadowError}, divergences)
+	stats := d.Stats()
+	assert.Equal(t, int64(5), stats.Reads)
+	assert.Equal(t, int64(5), stats.Shadowed)
+	assert.Equal(t, int64(2), stats.Matched)
+	assert.Equal(t, int64(3), stats.Diverged)
+	assert.InDelta(t, 0.6, stats.DivergenceRate(), 1e-9)
+}
+
+func TestShadowReadDropsWhenBusy(t *testing.T) {
+	ctx := context.Background()
+	release := make(chan struct{})
+	d := New(Config[int]{Workers: 1, QueueSize: 1, ShadowTimeout: time.Minute})
+	serve := func(ctx context.Context) (int, error) { return 1, nil }
+	slow := func(ctx context.Context) (int, error) {
+		<-release
+		return 1, nil
+	}
+	for i := 0; i < 10; i++ {
+		_, err := d.Read(ctx, "k", serve, slow)
+		require.NoError(t, err)
+	}
+	close(release)
+	d.Close()
+	stats := d.Stats()
+	assert.Equal(t, int64(10), stats.Reads)
+	assert.Equal(t, stats.Reads, stats.Shadowed+stats.Dropped)
+	assert.GreaterOrEqual(t, stats.Dropped, int64(8))
+}
+
+func TestSampleRate(t *testing.T) {
+	d := New(Config[int]{SampleRate: 0.000001})
+	serve := func(ctx context.Context) (int, error) { return 1, nil }
+	for i := 0; i < 100; i++ {
+		_, _ = d.Read(context.Background(), "k", serve, serve)
+	}
+	d.Close()
+	assert.Less(t, d.Stats().Shadowed, int64(5))
+}
+
+func TestDefaultErrorEqual(t *testing.T) {
+	assert.True(t, defaultErrorEqual(redis.Nil, errs.ErrRecordNotFound.Wrap()))
+	boom := errs.New("boom")
+	assert.True(t, defaultErrorEqual(boom, errs.WrapMsg(boom, "get")))
+	assert.False(t, defaultErrorEqual(boom, redis.Nil))
+}
@@ -0,0 +1,130 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstore
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ApplyFunc folds an event into the state.
+type ApplyFunc[S any] func(state *S, e *Event) error
+
+// Aggregate loads and appends to streams whose state is of type S, which
+// must round-trip through BSON for snapshots.
+type Aggregate[S any] struct {
+	store *Store
+	apply ApplyFunc[S]
+	every int64
+}
+
+// NewAggregate returns an Aggregate folding events with apply that saves a
+// snapshot every snapshotEvery events, never when zero.
+func NewAggregate[S any](store *Store, apply ApplyFunc[S], snapshotEvery int64) *Aggregate[S] {
+	return &Aggregate[S]{store: store, apply: apply, every: snapshotEvery}
+}
+
+// Load returns the state of the aggregate and its version, the zero state
+// and zero for an empty stream. Snapshots that no longer decode, e.g. after
+// a change of S, are ignored and the state is folded from the first event.
+func (a *Aggregate[S]) Load(ctx context.Context, aggregateID string) (*S, int64, error) {
+	var (
+		state   S
+		version int64
+	)
+	if a.every > 0 {
+		snap, err := a.store.loadSnapshot(ctx, aggregateID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if snap != nil {
+			if err := bson.Unmarshal(snap.State, &state); err != nil {
+				log.ZWarn(ctx, "ignore undecodable snapshot", err, "aggregateID", aggregateID, "version", snap.Version)
+				state = *new(S)
+			} else {
+				version = snap.Version
+			}
+		}
+	}
+	events, err := a.store.Events(ctx, aggregateID, version, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	version, err = fold(&state, version, events, a.apply)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &state, version, nil
+}
+
+// fold applies events to state and returns the version of the last one.
+func fold[S any](state *S, version int64, events []*Event, apply ApplyFunc[S]) (int64, error) {
+	for _, e := range events {
+		if err := apply(state, e); err != nil {
+			return 0, err
+		}
+		version = e.Version
+	}
+	return version, nil
+}
+
+// Append adds events like Store.Append and saves a snapshot when the stream
+// crossed a multiple of snapshotEvery. Failing snapshots are only logged, as
+// the events are stored.
+func (a *Aggregate[S]) Append(ctx context.Context, aggregateID string, expected int64, events ...NewEvent) (int64, error) {
+	version, err := a.store.Append(ctx, aggregateID, expected, events...)
+	if err != nil {
+		return 0, err
+	}
+	if a.every > 0 && version/a.every > expected/a.every {
+		if err := a.Snapshot(ctx, aggregateID); err != nil {
+			log.ZWarn(ctx, "snapshot aggregate failed", err, "aggregateID", aggregateID, "version", version)
+		}
+	}
+	return version, nil
+}
+
+// Execute loads the aggregate, lets decide return the events for its state
+// and appends them, retrying up to retries times on ErrConflict.
+func (a *Aggregate[S]) Execute(ctx context.Context, aggregateID string, retries int, decide func(state *S, version int64) ([]NewEvent, error)) (int64, error) {
+	for i := 0; ; i++ {
+		state, version, err := a.Load(ctx, aggregateID)
+		if err != nil {
+			return 0, err
+		}
+		events, err := decide(state, version)
+		if err != nil {
+			return 0, err
+		}
+		version, err = a.Append(ctx, aggregateID, version, events...)
+		if err == nil || i >= retries || !ErrConflict.Is(err) {
+			return version, err
+		}
+	}
+}
+
+// Snapshot saves the current state of the aggregate.
+func (a *Aggregate[S]) Snapshot(ctx context.Context, aggregateID string) error {
+	state, version, err := a.Load(ctx, aggregateID)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	return a.store.saveSnapshot(ctx, aggregateID, version, state)
+}
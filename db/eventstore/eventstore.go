@@ -0,0 +1,212 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package eventstore keeps immutable event streams on Mongo, e.g. the
+// membership history of a group. Events of an aggregate are numbered from 1
+// and appended with optimistic concurrency: an append names the version it
+// expects the stream to be at and fails with ErrConflict when another writer
+// got there first. Aggregates load by folding their events into a state,
+// starting from the latest snapshot when there is one.
+package eventstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrConflict is returned by Append when the stream is not at the expected
+// version. Reload and decide again.
+var ErrConflict = errs.New("event stream version conflict")
+
+// Event is a stored event.
+type Event struct {
+	AggregateID string            `bson:"aggregate_id"`
+	Version     int64             `bson:"version"`
+	Type        string            `bson:"type"`
+	Data        bson.Raw          `bson:"data,omitempty"`
+	Meta        map[string]string `bson:"meta,omitempty"`
+	CreatedAt   time.Time         `bson:"created_at"`
+}
+
+// Decode unmarshals the event data into v.
+func (e *Event) Decode(v any) error {
+	if err := bson.Unmarshal(e.Data, v); err != nil {
+		return errs.WrapMsg(err, "decode event failed", "aggregateID", e.AggregateID, "version", e.Version, "type", e.Type)
+	}
+	return nil
+}
+
+// NewEvent is an event to append. Data must marshal to a BSON document.
+type NewEvent struct {
+	Type string
+	Data any
+	// Meta is stored with the event. The operationID and opUserID of the
+	// context are added when not set, so the history tells who did what.
+	Meta map[string]string
+}
+
+// Store appends and loads events and snapshots.
+type Store struct {
+	events    *mongo.Collection
+	snapshots *mongo.Collection
+}
+
+// New returns a Store keeping events in events and snapshots in snapshots.
+func New(events, snapshots *mongo.Collection) *Store {
+	return &Store{events: events, snapshots: snapshots}
+}
+
+// EnsureIndexes creates the unique index on (aggregate_id, version) that
+// Append relies on for concurrency control.
+func (s *Store) EnsureIndexes(ctx context.Context) error {
+	_, err := s.events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "aggregate_id", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create event indexes failed", "collection", s.events.Name())
+	}
+	return nil
+}
+
+// Append adds events to the stream of the aggregate, which must be at
+// expected, zero for a new stream, and returns the new version. Events are
+// inserted in order, so a failed append leaves a prefix of them at most;
+// append inside tx.Tx.Transaction to make several events atomic.
+func (s *Store) Append(ctx context.Context, aggregateID string, expected int64, events ...NewEvent) (int64, error) {
+	if aggregateID == "" {
+		return 0, errs.ErrArgs.WrapMsg("aggregateID is required")
+	}
+	if len(events) == 0 {
+		return expected, nil
+	}
+	now := time.Now().UTC()
+	docs := make([]any, len(events))
+	for i, e := range events {
+		if e.Type == "" {
+			return 0, errs.ErrArgs.WrapMsg("event requires a type", "aggregateID", aggregateID)
+		}
+		doc := &Event{
+			AggregateID: aggregateID,
+			Version:     expected + int64(i) + 1,
+			Type:        e.Type,
+			Meta:        meta(ctx, e.Meta),
+			CreatedAt:   now,
+		}
+		if e.Data != nil {
+			data, err := bson.Marshal(e.Data)
+			if err != nil {
+				return 0, errs.WrapMsg(err, "encode event failed", "aggregateID", aggregateID, "type", e.Type)
+			}
+			doc.Data = data
+		}
+		docs[i] = doc
+	}
+	if _, err := s.events.InsertMany(ctx, docs); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, ErrConflict.WrapMsg("event stream moved on", "aggregateID", aggregateID, "expected", expected)
+		}
+		return 0, errs.WrapMsg(err, "append events failed", "aggregateID", aggregateID, "expected", expected)
+	}
+	return expected + int64(len(events)), nil
+}
+
+func meta(ctx context.Context, m map[string]string) map[string]string {
+	res := make(map[string]string, len(m)+2)
+	if id := mcontext.GetOperationID(ctx); id != "" {
+		res["operationID"] = id
+	}
+	if id := mcontext.GetOpUserID(ctx); id != "" {
+		res["opUserID"] = id
+	}
+	for k, v := range m {
+		res[k] = v
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// Events returns up to limit events of the aggregate after version after,
+// oldest first. A limit of zero or less returns all of them.
+func (s *Store) Events(ctx context.Context, aggregateID string, after int64, limit int64) ([]*Event, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cur, err := s.events.Find(ctx, bson.M{"aggregate_id": aggregateID, "version": bson.M{"$gt": after}}, opts)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find events failed", "aggregateID", aggregateID)
+	}
+	var events []*Event
+	if err := cur.All(ctx, &events); err != nil {
+		return nil, errs.WrapMsg(err, "decode events failed", "aggregateID", aggregateID)
+	}
+	return events, nil
+}
+
+// Version returns the current version of the stream, zero when empty.
+func (s *Store) Version(ctx context.Context, aggregateID string) (int64, error) {
+	var e Event
+	err := s.events.FindOne(ctx, bson.M{"aggregate_id": aggregateID},
+		options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}}).SetProjection(bson.M{"version": 1})).Decode(&e)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, errs.WrapMsg(err, "find stream version failed", "aggregateID", aggregateID)
+	}
+	return e.Version, nil
+}
+
+type snapshot struct {
+	AggregateID string    `bson:"_id"`
+	Version     int64     `bson:"version"`
+	State       bson.Raw  `bson:"state"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+func (s *Store) loadSnapshot(ctx context.Context, aggregateID string) (*snapshot, error) {
+	var snap snapshot
+	if err := s.snapshots.FindOne(ctx, bson.M{"_id": aggregateID}).Decode(&snap); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, errs.WrapMsg(err, "load snapshot failed", "aggregateID", aggregateID)
+	}
+	return &snap, nil
+}
+
+// saveSnapshot stores a snapshot unless a newer one exists.
+func (s *Store) saveSnapshot(ctx context.Context, aggregateID string, version int64, state any) error {
+	data, err := bson.Marshal(state)
+	if err != nil {
+		return errs.WrapMsg(err, "encode snapshot failed", "aggregateID", aggregateID)
+	}
+	_, err = s.snapshots.UpdateOne(ctx,
+		bson.M{"_id": aggregateID, "version": bson.M{"$lt": version}},
+		bson.M{"$set": bson.M{"version": version, "state": bson.Raw(data), "created_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return errs.WrapMsg(err, "save snapshot failed", "aggregateID", aggregateID, "version", version)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type member struct {
+	UserID string `bson:"user_id"`
+}
+
+type group struct {
+	Members []string `bson:"members"`
+}
+
+func applyGroup(g *group, e *Event) error {
+	var m member
+	if err := e.Decode(&m); err != nil {
+		return err
+	}
+	switch e.Type {
+	case "joined":
+		g.Members = append(g.Members, m.UserID)
+	case "left":
+		for i, id := range g.Members {
+			if id == m.UserID {
+				g.Members = append(g.Members[:i], g.Members[i+1:]...)
+				break
+			}
+		}
+	default:
+		return errors.New("unknown event " + e.Type)
+	}
+	return nil
+}
+
+func event(t *testing.T, version int64, typ, userID string) *Event {
+	data, err := bson.Marshal(member{UserID: userID})
+	require.NoError(t, err)
+	return &Event{AggregateID: "g1", Version: version, Type: typ, Data: data}
+}
+
+func TestFold(t *testing.T) {
+	var g group
+	version, err := fold(&g, 0, []*Event{
+		event(t, 1, "joined", "u1"),
+		event(t, 2, "joined", "u2"),
+		event(t, 3, "left", "u1"),
+	}, applyGroup)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, []string{"u2"}, g.Members)
+
+	_, err = fold(&g, 3, []*Event{event(t, 4, "renamed", "")}, applyGroup)
+	assert.Error(t, err)
+}
+
+func TestMeta(t *testing.T) {
+	assert.Nil(t, meta(context.Background(), nil))
+	ctx := mcontext.SetOperationID(context.Background(), "op1")
+	ctx = mcontext.SetOpUserID(ctx, "admin")
+	assert.Equal(t, map[string]string{"operationID": "op1", "opUserID": "admin", "reason": "kick"},
+		meta(ctx, map[string]string{"reason": "kick"}))
+}
+
+func TestMongo(t *testing.T) {
+	ctx := context.Background()
+	db := containers.Mongo(t, "eventstore").GetDB()
+	store := New(db.Collection("events"), db.Collection("snapshots"))
+	require.NoError(t, store.EnsureIndexes(ctx))
+	agg := NewAggregate(store, applyGroup, 2)
+
+	version, err := agg.Append(ctx, "g1", 0,
+		NewEvent{Type: "joined", Data: member{UserID: "u1"}},
+		NewEvent{Type: "joined", Data: member{UserID: "u2"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	_, err = agg.Append(ctx, "g1", 1, NewEvent{Type: "left", Data: member{UserID: "u1"}})
+	assert.True(t, ErrConflict.Is(err))
+
+	version, err = agg.Execute(ctx, "g1", 1, func(g *group, version int64) ([]NewEvent, error) {
+		return []NewEvent{{Type: "left", Data: member{UserID: "u1"}}}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	snap, err := store.loadSnapshot(ctx, "g1")
+	require.NoError(t, err)
+	require.NotNil(t, snap)
+	assert.Equal(t, int64(2), snap.Version)
+
+	g, version, err := agg.Load(ctx, "g1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, []string{"u2"}, g.Members)
+
+	current, err := store.Version(ctx, "g1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), current)
+	events, err := store.Events(ctx, "g1", 1, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, int64(2), events[0].Version)
+}
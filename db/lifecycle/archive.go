@@ -0,0 +1,224 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sink stores archived documents. A batch may be written again after a
+// crash between writing it and deleting it from the source, so sinks must
+// accept repeated batches.
+type Sink interface {
+	Write(ctx context.Context, batch []bson.Raw) error
+}
+
+// CollectionSink archives into a cold collection, skipping documents that
+// were archived before.
+func CollectionSink(coll *mongo.Collection) Sink {
+	return &collectionSink{coll: coll}
+}
+
+type collectionSink struct {
+	coll *mongo.Collection
+}
+
+func (s *collectionSink) Write(ctx context.Context, batch []bson.Raw) error {
+	docs := make([]any, len(batch))
+	for i, doc := range batch {
+		docs[i] = doc
+	}
+	_, err := s.coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicates(err) {
+		return errs.WrapMsg(err, "insert archived documents failed", "collection", s.coll.Name())
+	}
+	return nil
+}
+
+func onlyDuplicates(err error) bool {
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok || bwe.WriteConcernError != nil {
+		return false
+	}
+	for _, we := range bwe.WriteErrors {
+		if we.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// S3Sink archives every batch as an object of canonical extended JSON lines,
+// named prefix plus the hex _id of its first document and ".jsonl", so a
+// repeated batch replaces its object. Uploads go to presigned URLs with
+// client, http.DefaultClient when nil.
+func S3Sink(storage s3.Interface, prefix string, client *http.Client) Sink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &s3Sink{storage: storage, prefix: prefix, client: client}
+}
+
+type s3Sink struct {
+	storage s3.Interface
+	prefix  string
+	client  *http.Client
+}
+
+func (s *s3Sink) Write(ctx context.Context, batch []bson.Raw) error {
+	var buf bytes.Buffer
+	for _, doc := range batch {
+		line, err := bson.MarshalExtJSON(doc, true, false)
+		if err != nil {
+			return errs.WrapMsg(err, "encode archived document failed")
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	name := s.prefix + idString(batch[0].Lookup("_id")) + ".jsonl"
+	const contentType = "application/x-ndjson"
+	sign, err := s.storage.PresignedPutObject(ctx, name, 15*time.Minute, &s3.PutOption{ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sign.URL, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return errs.WrapMsg(err, "create archive upload request failed")
+	}
+	for k, v := range sign.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errs.WrapMsg(err, "upload archive failed", "name", name)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return errs.New("upload archive failed", "name", name, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	return nil
+}
+
+// idString renders an _id for object names.
+func idString(id bson.RawValue) string {
+	if oid, ok := id.ObjectIDOK(); ok {
+		return oid.Hex()
+	}
+	if str, ok := id.StringValueOK(); ok {
+		return str
+	}
+	return id.String()
+}
+
+// ArchiveConfig configures an Archiver.
+type ArchiveConfig struct {
+	// Filter selects the documents to archive, e.g. those older than a
+	// cutoff. Required, so a zero config never archives everything.
+	Filter any
+	// BatchSize is the number of documents per batch, defaults to 500.
+	BatchSize int
+	// Pause waits between batches to spare the database.
+	Pause time.Duration
+	// MaxBatches stops a run after that many batches, unlimited when zero.
+	MaxBatches int
+}
+
+// Archiver moves documents from a collection to a Sink.
+type Archiver struct {
+	coll *mongo.Collection
+	sink Sink
+	conf ArchiveConfig
+}
+
+func NewArchiver(coll *mongo.Collection, sink Sink, conf ArchiveConfig) *Archiver {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+	return &Archiver{coll: coll, sink: sink, conf: conf}
+}
+
+// Run archives matching documents in _id order, writing each batch to the
+// sink before deleting it, until none match, and returns their number.
+func (a *Archiver) Run(ctx context.Context) (int64, error) {
+	if a.conf.Filter == nil {
+		return 0, errs.ErrArgs.WrapMsg("archive requires a filter")
+	}
+	var archived int64
+	for batches := 0; a.conf.MaxBatches <= 0 || batches < a.conf.MaxBatches; batches++ {
+		if batches > 0 && a.conf.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return archived, ctx.Err()
+			case <-time.After(a.conf.Pause):
+			}
+		}
+		n, err := a.batch(ctx)
+		archived += n
+		if err != nil {
+			return archived, err
+		}
+		if n == 0 {
+			break
+		}
+		log.ZDebug(ctx, "archived batch", "collection", a.coll.Name(), "count", n, "total", archived)
+	}
+	return archived, nil
+}
+
+func (a *Archiver) batch(ctx context.Context) (int64, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(a.conf.BatchSize))
+	cur, err := a.coll.Find(ctx, a.conf.Filter, opts)
+	if err != nil {
+		return 0, errs.WrapMsg(err, "find documents to archive failed", "collection", a.coll.Name())
+	}
+	defer cur.Close(ctx)
+	var (
+		batch []bson.Raw
+		ids   bson.A
+	)
+	for cur.Next(ctx) {
+		doc := make(bson.Raw, len(cur.Current))
+		copy(doc, cur.Current)
+		batch = append(batch, doc)
+		ids = append(ids, doc.Lookup("_id"))
+	}
+	if err := cur.Err(); err != nil {
+		return 0, errs.WrapMsg(err, "read documents to archive failed", "collection", a.coll.Name())
+	}
+	if len(batch) == 0 {
+		return 0, nil
+	}
+	if err := a.sink.Write(ctx, batch); err != nil {
+		return 0, err
+	}
+	res, err := a.coll.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, errs.WrapMsg(err, "delete archived documents failed", "collection", a.coll.Name())
+	}
+	return res.DeletedCount, nil
+}
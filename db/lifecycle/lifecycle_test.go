@@ -0,0 +1,123 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lifecycle
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type msg struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Text      string             `bson:"text"`
+	DeletedAt *time.Time         `bson:"deleted_at,omitempty"`
+}
+
+func TestFilter(t *testing.T) {
+	plain := NewRepo[msg](nil)
+	assert.Equal(t, bson.M{"a": 1}, plain.Filter(bson.M{"a": 1}))
+	assert.Equal(t, bson.M{}, plain.Filter(nil))
+
+	soft := NewRepo[msg](nil, WithDeletedField("removed_at"))
+	assert.Equal(t, bson.M{"removed_at": nil}, soft.Filter(nil))
+	assert.Equal(t, bson.M{"$and": bson.A{bson.M{"a": 1}, bson.M{"removed_at": nil}}}, soft.Filter(bson.M{"a": 1}))
+	assert.Equal(t, bson.M{"removed_at": bson.M{"$ne": nil}}, soft.deletedFilter(nil))
+}
+
+func TestOnlyDuplicates(t *testing.T) {
+	dup := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 11000}}}}
+	assert.True(t, onlyDuplicates(dup))
+	dup.WriteErrors = append(dup.WriteErrors, mongo.BulkWriteError{WriteError: mongo.WriteError{Code: 2}})
+	assert.False(t, onlyDuplicates(dup))
+	assert.False(t, onlyDuplicates(io.EOF))
+}
+
+func TestS3Sink(t *testing.T) {
+	storage := mock.NewStorage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		storage.PutObject(strings.TrimPrefix(r.URL.Path, "/bucket/"), data, r.Header.Get("Content-Type"))
+	}))
+	defer srv.Close()
+	storage.BaseURL = srv.URL + "/bucket"
+
+	id := primitive.NewObjectID()
+	doc, err := bson.Marshal(msg{ID: id, Text: "hello"})
+	require.NoError(t, err)
+	sink := S3Sink(storage, "archive/msg/", nil)
+	require.NoError(t, sink.Write(context.Background(), []bson.Raw{doc, doc}))
+
+	data, err := storage.GetObject("archive/msg/" + id.Hex() + ".jsonl")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var back msg
+	require.NoError(t, bson.UnmarshalExtJSON([]byte(lines[0]), true, &back))
+	assert.Equal(t, id, back.ID)
+	assert.Equal(t, "hello", back.Text)
+}
+
+func TestMongo(t *testing.T) {
+	ctx := context.Background()
+	db := containers.Mongo(t, "lifecycle").GetDB()
+	repo := NewRepo[msg](db.Collection("msg"), WithPurgeAfter(time.Hour))
+	require.NoError(t, repo.EnsureIndexes(ctx))
+	for _, text := range []string{"a", "b", "c"} {
+		_, err := repo.Collection().InsertOne(ctx, msg{ID: primitive.NewObjectID(), Text: text})
+		require.NoError(t, err)
+	}
+
+	n, err := repo.Delete(ctx, bson.M{"text": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	count, err := repo.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	deleted, err := repo.FindDeleted(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.NotNil(t, deleted[0].DeletedAt)
+
+	n, err = repo.Restore(ctx, bson.M{"text": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = repo.Delete(ctx, bson.M{"text": "a"})
+	require.NoError(t, err)
+	n, err = repo.Purge(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	cold := db.Collection("msg_cold")
+	archiver := NewArchiver(repo.Collection(), CollectionSink(cold), ArchiveConfig{Filter: bson.M{}, BatchSize: 1})
+	n, err = archiver.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	count, err = cold.CountDocuments(ctx, bson.M{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
@@ -0,0 +1,200 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lifecycle manages the end of life of Mongo documents: a Repo with
+// soft delete hides deleted documents from every query and purges them after
+// a retention period, and an Archiver moves old documents in batches to a
+// cold collection or to S3.
+package lifecycle
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/db/mongoutil"
+	"github.com/openimsdk/tools/db/pagination"
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultDeletedField holds the time a document was soft deleted.
+const DefaultDeletedField = "deleted_at"
+
+type repoOptions struct {
+	soft       bool
+	field      string
+	purgeAfter time.Duration
+}
+
+type Option func(*repoOptions)
+
+// WithSoftDelete makes Delete mark documents as deleted instead of removing
+// them, and hides marked documents from queries.
+func WithSoftDelete() Option {
+	return func(o *repoOptions) { o.soft = true }
+}
+
+// WithDeletedField stores the deletion time in field instead of
+// DefaultDeletedField. It implies WithSoftDelete.
+func WithDeletedField(field string) Option {
+	return func(o *repoOptions) { o.soft, o.field = true, field }
+}
+
+// WithPurgeAfter removes soft deleted documents after retention, by a TTL
+// index created by EnsureIndexes. It implies WithSoftDelete.
+func WithPurgeAfter(retention time.Duration) Option {
+	return func(o *repoOptions) { o.soft, o.purgeAfter = true, retention }
+}
+
+// Repo queries a collection of documents of type T. With soft delete, every
+// query only matches documents that are not deleted, unless it is one of the
+// Deleted methods.
+type Repo[T any] struct {
+	coll *mongo.Collection
+	opts repoOptions
+}
+
+func NewRepo[T any](coll *mongo.Collection, opts ...Option) *Repo[T] {
+	o := repoOptions{field: DefaultDeletedField}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Repo[T]{coll: coll, opts: o}
+}
+
+// Collection returns the underlying collection, whose queries see deleted
+// documents.
+func (r *Repo[T]) Collection() *mongo.Collection {
+	return r.coll
+}
+
+// EnsureIndexes creates the TTL index purging soft deleted documents when
+// WithPurgeAfter is set. Mongo never expires documents without the field.
+func (r *Repo[T]) EnsureIndexes(ctx context.Context) error {
+	if r.opts.purgeAfter <= 0 {
+		return nil
+	}
+	_, err := r.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: r.opts.field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(int32(r.opts.purgeAfter / time.Second)),
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create purge index failed", "collection", r.coll.Name())
+	}
+	return nil
+}
+
+// Filter returns filter restricted to documents that are not deleted. It is
+// applied by the query methods and is exported for queries the Repo does not
+// cover, e.g. updates.
+func (r *Repo[T]) Filter(filter any) any {
+	if !r.opts.soft {
+		if filter == nil {
+			return bson.M{}
+		}
+		return filter
+	}
+	alive := bson.M{r.opts.field: nil} // Missing or null.
+	if filter == nil {
+		return alive
+	}
+	return bson.M{"$and": bson.A{filter, alive}}
+}
+
+func (r *Repo[T]) deletedFilter(filter any) any {
+	deleted := bson.M{r.opts.field: bson.M{"$ne": nil}}
+	if filter == nil {
+		return deleted
+	}
+	return bson.M{"$and": bson.A{filter, deleted}}
+}
+
+func (r *Repo[T]) Find(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+	return mongoutil.Find[T](ctx, r.coll, r.Filter(filter), opts...)
+}
+
+func (r *Repo[T]) FindOne(ctx context.Context, filter any, opts ...*options.FindOneOptions) (T, error) {
+	return mongoutil.FindOne[T](ctx, r.coll, r.Filter(filter), opts...)
+}
+
+func (r *Repo[T]) FindPage(ctx context.Context, filter any, page pagination.Pagination, opts ...*options.FindOptions) (int64, []T, error) {
+	return mongoutil.FindPage[T](ctx, r.coll, r.Filter(filter), page, opts...)
+}
+
+func (r *Repo[T]) Count(ctx context.Context, filter any, opts ...*options.CountOptions) (int64, error) {
+	return mongoutil.Count(ctx, r.coll, r.Filter(filter), opts...)
+}
+
+func (r *Repo[T]) Exist(ctx context.Context, filter any) (bool, error) {
+	return mongoutil.Exist(ctx, r.coll, r.Filter(filter))
+}
+
+// Aggregate runs pipeline on the documents that are not deleted.
+func (r *Repo[T]) Aggregate(ctx context.Context, pipeline mongo.Pipeline, opts ...*options.AggregateOptions) ([]T, error) {
+	if r.opts.soft {
+		pipeline = append(mongo.Pipeline{{{Key: "$match", Value: r.Filter(nil)}}}, pipeline...)
+	}
+	return mongoutil.Aggregate[T](ctx, r.coll, pipeline, opts...)
+}
+
+// Delete soft deletes the matching documents, or removes them without soft
+// delete, and returns their number.
+func (r *Repo[T]) Delete(ctx context.Context, filter any) (int64, error) {
+	if !r.opts.soft {
+		return r.HardDelete(ctx, filter)
+	}
+	res, err := mongoutil.UpdateMany(ctx, r.coll, r.Filter(filter), bson.M{"$set": bson.M{r.opts.field: time.Now().UTC()}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// HardDelete removes the matching documents, deleted or not.
+func (r *Repo[T]) HardDelete(ctx context.Context, filter any) (int64, error) {
+	if filter == nil {
+		return 0, errs.ErrArgs.WrapMsg("delete requires a filter")
+	}
+	res, err := mongoutil.DeleteManyResult(ctx, r.coll, filter)
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// Restore undeletes the matching soft deleted documents.
+func (r *Repo[T]) Restore(ctx context.Context, filter any) (int64, error) {
+	res, err := mongoutil.UpdateMany(ctx, r.coll, r.deletedFilter(filter), bson.M{"$unset": bson.M{r.opts.field: ""}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// FindDeleted returns the matching soft deleted documents, e.g. for a trash
+// view.
+func (r *Repo[T]) FindDeleted(ctx context.Context, filter any, opts ...*options.FindOptions) ([]T, error) {
+	return mongoutil.Find[T](ctx, r.coll, r.deletedFilter(filter), opts...)
+}
+
+// Purge removes documents soft deleted more than retention ago, for
+// collections purged on demand instead of by WithPurgeAfter.
+func (r *Repo[T]) Purge(ctx context.Context, retention time.Duration) (int64, error) {
+	if !r.opts.soft {
+		return 0, nil
+	}
+	return r.HardDelete(ctx, bson.M{r.opts.field: bson.M{"$lt": time.Now().Add(-retention).UTC()}})
+}
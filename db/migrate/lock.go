@@ -0,0 +1,94 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const lockID = "migrate"
+
+var errLockLost = errs.New("migration lock lost")
+
+// locker is a lease on a single document. Acquiring upserts the document
+// only when it is missing or expired; a live lease of another owner makes
+// the upsert collide on _id.
+type locker struct {
+	coll  *mongo.Collection
+	owner string
+	ttl   time.Duration
+}
+
+func (l *locker) acquire(ctx context.Context) error {
+	now := time.Now()
+	filter := bson.M{"_id": lockID, "$or": bson.A{
+		bson.M{"owner": l.owner},
+		bson.M{"expire_at": bson.M{"$lt": now}},
+	}}
+	update := bson.M{"$set": bson.M{"owner": l.owner, "expire_at": now.Add(l.ttl), "locked_at": now}}
+	_, err := l.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		var holder struct {
+			Owner    string    `bson:"owner"`
+			ExpireAt time.Time `bson:"expire_at"`
+		}
+		_ = l.coll.FindOne(ctx, bson.M{"_id": lockID}).Decode(&holder)
+		return ErrLocked.WrapMsg("acquire migration lock failed", "owner", holder.Owner, "expireAt", holder.ExpireAt)
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "acquire migration lock failed")
+	}
+	return nil
+}
+
+// keepAlive renews the lease until ctx is done and cancels with errLockLost
+// when the lease was taken over.
+func (l *locker) keepAlive(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		res, err := l.coll.UpdateOne(ctx, bson.M{"_id": lockID, "owner": l.owner},
+			bson.M{"$set": bson.M{"expire_at": time.Now().Add(l.ttl)}})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.ZWarn(ctx, "renew migration lock failed", err)
+			}
+			continue
+		}
+		if res.MatchedCount == 0 {
+			cancel(errLockLost)
+			return
+		}
+	}
+}
+
+func (l *locker) release(ctx context.Context) error {
+	if _, err := l.coll.DeleteOne(ctx, bson.M{"_id": lockID, "owner": l.owner}); err != nil {
+		return errs.WrapMsg(err, "release migration lock failed")
+	}
+	return nil
+}
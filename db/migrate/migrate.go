@@ -0,0 +1,318 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate applies versioned schema migrations written as Go functions
+// to a Mongo database. Applied versions are recorded in a collection and runs
+// are serialized by a lock document, so several instances starting at once
+// apply each migration exactly once.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	// ErrLocked is returned when another runner holds the migration lock.
+	ErrLocked = errs.New("migration lock is held by another runner")
+	// ErrIrreversible is returned when reverting a migration without Down.
+	ErrIrreversible = errs.New("migration cannot be reverted")
+)
+
+// Migration is one schema change. Up and Down should be idempotent: a
+// migration interrupted before its version is recorded runs again.
+type Migration struct {
+	Version     int64
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error // Optional.
+}
+
+// Config configures a Migrator.
+type Config struct {
+	Collection     string        // Applied versions, defaults to "migrations".
+	LockCollection string        // Defaults to Collection + "_lock".
+	LockTTL        time.Duration // Lock lease, renewed while running, defaults to 1 minute.
+	Owner          string        // Lock owner shown to other runners, defaults to hostname and pid.
+}
+
+// Status describes one migration version.
+type Status struct {
+	Version     int64
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+	// Unknown is set for versions recorded in the database that no
+	// registered migration describes, e.g. after a rollback of the binary.
+	Unknown bool
+}
+
+type record struct {
+	Version     int64     `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrator runs migrations against a database.
+type Migrator struct {
+	db         *mongo.Database
+	coll       *mongo.Collection
+	lock       *locker
+	migrations []Migration
+}
+
+// New creates a Migrator. Versions must be positive and unique; migrations
+// are applied in ascending version order regardless of argument order.
+func New(db *mongo.Database, conf Config, migrations ...Migration) (*Migrator, error) {
+	if conf.Collection == "" {
+		conf.Collection = "migrations"
+	}
+	if conf.LockCollection == "" {
+		conf.LockCollection = conf.Collection + "_lock"
+	}
+	if conf.LockTTL <= 0 {
+		conf.LockTTL = time.Minute
+	}
+	if conf.Owner == "" {
+		host, _ := os.Hostname()
+		conf.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	sorted, err := sortMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		db:         db,
+		coll:       db.Collection(conf.Collection),
+		lock:       &locker{coll: db.Collection(conf.LockCollection), owner: conf.Owner, ttl: conf.LockTTL},
+		migrations: sorted,
+	}, nil
+}
+
+func sortMigrations(migrations []Migration) ([]Migration, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, errs.ErrArgs.WrapMsg("migration version must be positive", "version", m.Version)
+		}
+		if m.Up == nil {
+			return nil, errs.ErrArgs.WrapMsg("migration has no up func", "version", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, errs.ErrArgs.WrapMsg("duplicate migration version", "version", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// Up applies all pending migrations and returns the applied versions.
+func (m *Migrator) Up(ctx context.Context) ([]int64, error) {
+	return m.UpTo(ctx, 0)
+}
+
+// UpTo applies pending migrations up to and including version; zero means
+// all. Pending migrations below the highest applied version are applied too.
+func (m *Migrator) UpTo(ctx context.Context, version int64) ([]int64, error) {
+	var done []int64
+	err := m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		for _, mig := range pending(m.migrations, applied, version) {
+			log.ZInfo(ctx, "apply migration", "version", mig.Version, "description", mig.Description)
+			if err := mig.Up(ctx, m.db); err != nil {
+				return errs.WrapMsg(err, "apply migration failed", "version", mig.Version)
+			}
+			rec := record{Version: mig.Version, Description: mig.Description, AppliedAt: time.Now().UTC()}
+			if _, err := m.coll.InsertOne(ctx, rec); err != nil {
+				return errs.WrapMsg(err, "record migration failed", "version", mig.Version)
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last steps applied migrations and returns the reverted
+// versions, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]int64, error) {
+	if steps <= 0 {
+		return nil, errs.ErrArgs.WrapMsg("down steps must be positive", "steps", steps)
+	}
+	return m.down(ctx, func(applied []Migration) []Migration {
+		return applied[max(len(applied)-steps, 0):]
+	})
+}
+
+// DownTo reverts every applied migration above version.
+func (m *Migrator) DownTo(ctx context.Context, version int64) ([]int64, error) {
+	return m.down(ctx, func(applied []Migration) []Migration {
+		i := sort.Search(len(applied), func(i int) bool { return applied[i].Version > version })
+		return applied[i:]
+	})
+}
+
+func (m *Migrator) down(ctx context.Context, choose func(applied []Migration) []Migration) ([]int64, error) {
+	var done []int64
+	err := m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		var known []Migration
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				known = append(known, mig)
+			}
+		}
+		revert := choose(known)
+		for _, mig := range revert {
+			if mig.Down == nil {
+				return ErrIrreversible.WrapMsg("migration has no down func", "version", mig.Version)
+			}
+		}
+		for i := len(revert) - 1; i >= 0; i-- {
+			mig := revert[i]
+			log.ZInfo(ctx, "revert migration", "version", mig.Version, "description", mig.Description)
+			if err := mig.Down(ctx, m.db); err != nil {
+				return errs.WrapMsg(err, "revert migration failed", "version", mig.Version)
+			}
+			if _, err := m.coll.DeleteOne(ctx, bson.M{"_id": mig.Version}); err != nil {
+				return errs.WrapMsg(err, "unrecord migration failed", "version", mig.Version)
+			}
+			done = append(done, mig.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status lists registered and recorded versions in ascending order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status(m.migrations, applied), nil
+}
+
+// PrintStatus writes the status as a table, for a "migrate status" command.
+func (m *Migrator) PrintStatus(ctx context.Context, w io.Writer) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return WriteStatus(w, statuses)
+}
+
+// WriteStatus writes statuses as a table.
+func WriteStatus(w io.Writer, statuses []Status) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATE\tAPPLIED AT\tDESCRIPTION")
+	for _, s := range statuses {
+		state, at := "pending", "-"
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Unknown {
+			state = "unknown"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, state, at, s.Description)
+	}
+	return errs.Wrap(tw.Flush())
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]record, error) {
+	cur, err := m.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find applied migrations failed")
+	}
+	var records []record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, errs.WrapMsg(err, "decode applied migrations failed")
+	}
+	applied := make(map[int64]record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+func pending(migrations []Migration, applied map[int64]record, version int64) []Migration {
+	var res []Migration
+	for _, mig := range migrations {
+		if version > 0 && mig.Version > version {
+			break
+		}
+		if _, ok := applied[mig.Version]; !ok {
+			res = append(res, mig)
+		}
+	}
+	return res
+}
+
+func status(migrations []Migration, applied map[int64]record) []Status {
+	res := make([]Status, 0, len(migrations))
+	known := make(map[int64]bool, len(migrations))
+	for _, mig := range migrations {
+		known[mig.Version] = true
+		rec, ok := applied[mig.Version]
+		res = append(res, Status{Version: mig.Version, Description: mig.Description, Applied: ok, AppliedAt: rec.AppliedAt})
+	}
+	for version, rec := range applied {
+		if !known[version] {
+			res = append(res, Status{Version: version, Description: rec.Description, Applied: true, AppliedAt: rec.AppliedAt, Unknown: true})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res
+}
+
+// locked runs fn while holding the migration lock. fn's context is canceled
+// if the lease cannot be renewed.
+func (m *Migrator) locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := m.lock.acquire(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.lock.keepAlive(ctx, cancel)
+	}()
+	err := fn(ctx)
+	cancel(nil)
+	<-renewed
+	if rerr := m.lock.release(context.WithoutCancel(ctx)); rerr != nil {
+		log.ZWarn(ctx, "release migration lock failed", rerr)
+	}
+	if err != nil && errors.Is(context.Cause(ctx), errLockLost) {
+		return errs.WrapMsg(err, "migration lock lost")
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func noop(ctx context.Context, db *mongo.Database) error { return nil }
+
+func TestSortMigrations(t *testing.T) {
+	sorted, err := sortMigrations([]Migration{{Version: 3, Up: noop}, {Version: 1, Up: noop}, {Version: 2, Up: noop}})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, []int64{sorted[0].Version, sorted[1].Version, sorted[2].Version})
+
+	for _, migrations := range [][]Migration{
+		{{Version: 0, Up: noop}},
+		{{Version: 1}},
+		{{Version: 1, Up: noop}, {Version: 1, Up: noop}},
+	} {
+		_, err := sortMigrations(migrations)
+		assert.ErrorIs(t, err, errs.ErrArgs)
+	}
+}
+
+func TestPendingAndStatus(t *testing.T) {
+	migrations := []Migration{{Version: 1, Description: "a"}, {Version: 2, Description: "b"}, {Version: 3, Description: "c"}}
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	applied := map[int64]record{
+		2: {Version: 2, Description: "b", AppliedAt: at},
+		9: {Version: 9, Description: "removed", AppliedAt: at},
+	}
+	versions := func(ms []Migration) []int64 {
+		var vs []int64
+		for _, m := range ms {
+			vs = append(vs, m.Version)
+		}
+		return vs
+	}
+	assert.Equal(t, []int64{1, 3}, versions(pending(migrations, applied, 0)))
+	assert.Equal(t, []int64{1}, versions(pending(migrations, applied, 2)))
+
+	statuses := status(migrations, applied)
+	assert.Equal(t, []Status{
+		{Version: 1, Description: "a"},
+		{Version: 2, Description: "b", Applied: true, AppliedAt: at},
+		{Version: 3, Description: "c"},
+		{Version: 9, Description: "removed", Applied: true, AppliedAt: at, Unknown: true},
+	}, statuses)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteStatus(&buf, statuses))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, []string{"VERSION", "STATE", "APPLIED", "AT", "DESCRIPTION"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"2", "applied", "2024-01-02T03:04:05Z", "b"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"3", "pending", "-", "c"}, strings.Fields(lines[3]))
+	assert.Equal(t, []string{"9", "unknown", "2024-01-02T03:04:05Z", "removed"}, strings.Fields(lines[4]))
+}
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	db := containers.Mongo(t, "migrate").GetDB()
+	var order []string
+	step := func(name string) func(ctx context.Context, db *mongo.Database) error {
+		return func(ctx context.Context, db *mongo.Database) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+	migrations := []Migration{
+		{Version: 1, Description: "users index", Up: func(ctx context.Context, db *mongo.Database) error {
+			order = append(order, "up1")
+			_, err := db.Collection("user").Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true),
+			})
+			return err
+		}, Down: step("down1")},
+		{Version: 2, Description: "backfill", Up: step("up2"), Down: step("down2")},
+		{Version: 3, Description: "no way back", Up: step("up3")},
+	}
+	m, err := New(db, Config{Owner: "a"}, migrations...)
+	require.NoError(t, err)
+
+	applied, err := m.UpTo(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2}, applied)
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, applied)
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	_, err = m.Down(ctx, 1)
+	assert.ErrorIs(t, err, ErrIrreversible)
+	reverted, err := m.DownTo(ctx, 0)
+	assert.ErrorIs(t, err, ErrIrreversible)
+	assert.Empty(t, reverted)
+
+	m2, err := New(db, Config{Owner: "b"}, migrations[:2]...)
+	require.NoError(t, err)
+	reverted, err = m2.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, reverted)
+	statuses, err := m2.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 3)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+	assert.True(t, statuses[2].Unknown)
+	assert.Equal(t, []string{"up1", "up2", "up3", "down2"}, order)
+
+	// A live lease of another owner blocks the run.
+	require.NoError(t, m.lock.acquire(ctx))
+	_, err = m2.Up(ctx)
+	assert.True(t, errors.Is(err, ErrLocked))
+	require.NoError(t, m.lock.release(ctx))
+	applied, err = m2.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, applied)
+}
@@ -0,0 +1,257 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil
+
+import (
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/cow"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const ResultTooLargeError = 1911 // The query matched more documents than allowed.
+
+var ErrResultTooLarge = errs.NewCodeError(ResultTooLargeError, "ResultTooLargeError")
+
+// Guard bounds the queries the helpers of this package run on a collection,
+// so an unbounded query cannot take down the primary.
+type Guard struct {
+	// MaxTime caps the server side run time of finds, counts and
+	// aggregations. Callers may ask for less, never for more.
+	MaxTime time.Duration
+	// MaxResults caps the documents Find returns. Queries that would return
+	// more fail with ErrResultTooLarge instead of silently truncating, so
+	// callers paginate.
+	MaxResults int64
+	// Hints pick an index for queries that set none, by their filter fields.
+	Hints []Hint
+}
+
+// Hint forces Index for filters on all of Fields, e.g. where the planner
+// keeps choosing a worse index for a hot query.
+type Hint struct {
+	Fields []string
+	Index  any // Index name or key document.
+}
+
+// guards maps "database.collection" or "collection" to its guard, "*" to
+// the default. They apply to collections of clients without Config.Guards.
+var guards = cow.NewMap[string, Guard](nil)
+
+// clientGuards holds the Config.Guards of the clients created by NewMongoDB.
+// The helpers only see collections, so the guards are found by the driver
+// client of the collection.
+var clientGuards = cow.NewMap[*mongo.Client, map[string]Guard](nil)
+
+// SetGuard sets the process wide guard of a collection, named with or
+// without its database, or the default guard for name "*". Clients created
+// with Config.Guards use those instead.
+func SetGuard(name string, g Guard) {
+	guards.Set(name, g)
+}
+
+// SetGuards replaces all process wide guards, see SetGuard.
+func SetGuards(gs map[string]Guard) {
+	guards.Replace(gs)
+}
+
+// setClientGuards makes gs the guards of the collections of cli.
+func setClientGuards(cli *mongo.Client, gs map[string]Guard) {
+	own := make(map[string]Guard, len(gs))
+	for name, g := range gs {
+		own[name] = g
+	}
+	clientGuards.Set(cli, own)
+}
+
+func guardOf(coll *mongo.Collection) (Guard, bool) {
+	get := guards.Get
+	if gs, ok := clientGuards.Get(coll.Database().Client()); ok {
+		get = func(name string) (Guard, bool) {
+			g, ok := gs[name]
+			return g, ok
+		}
+	}
+	if g, ok := get(coll.Database().Name() + "." + coll.Name()); ok {
+		return g, true
+	}
+	if g, ok := get(coll.Name()); ok {
+		return g, true
+	}
+	return get("*")
+}
+
+// maxTime returns the guard's cap over the caller's max time, if any.
+func (g Guard) maxTime(caller *time.Duration) *time.Duration {
+	if g.MaxTime <= 0 || (caller != nil && *caller > 0 && *caller <= g.MaxTime) {
+		return nil
+	}
+	return &g.MaxTime
+}
+
+// hint returns the index hint for filter, nil when none applies.
+func (g Guard) hint(filter any) any {
+	if len(g.Hints) == 0 {
+		return nil
+	}
+	fields := filterFields(filter)
+	if len(fields) == 0 {
+		return nil
+	}
+	for _, h := range g.Hints {
+		match := len(h.Fields) > 0
+		for _, f := range h.Fields {
+			if _, ok := fields[f]; !ok {
+				match = false
+				break
+			}
+		}
+		if match {
+			return h.Index
+		}
+	}
+	return nil
+}
+
+// filterFields returns the top level fields of filter, including those of
+// a top level $and.
+func filterFields(filter any) map[string]struct{} {
+	fields := make(map[string]struct{})
+	var add func(v any)
+	add = func(v any) {
+		switch f := v.(type) {
+		case bson.M:
+			for k, v := range f {
+				addField(fields, k, v, add)
+			}
+		case map[string]any:
+			for k, v := range f {
+				addField(fields, k, v, add)
+			}
+		case bson.D:
+			for _, e := range f {
+				addField(fields, e.Key, e.Value, add)
+			}
+		}
+	}
+	add(filter)
+	return fields
+}
+
+func addField(fields map[string]struct{}, key string, value any, add func(any)) {
+	if key != "$and" {
+		fields[key] = struct{}{}
+		return
+	}
+	if clauses, ok := value.(bson.A); ok {
+		for _, c := range clauses {
+			add(c)
+		}
+	} else if clauses, ok := value.([]any); ok {
+		for _, c := range clauses {
+			add(c)
+		}
+	}
+}
+
+func guardFind(coll *mongo.Collection, filter any, opts []*options.FindOptions) ([]*options.FindOptions, int64) {
+	g, ok := guardOf(coll)
+	if !ok {
+		return opts, 0
+	}
+	merged := options.MergeFindOptions(opts...)
+	extra := options.Find()
+	if d := g.maxTime(merged.MaxTime); d != nil {
+		extra.SetMaxTime(*d)
+	}
+	if merged.Hint == nil {
+		if h := g.hint(filter); h != nil {
+			extra.SetHint(h)
+		}
+	}
+	var max int64
+	if g.MaxResults > 0 {
+		limit := int64(0)
+		if merged.Limit != nil {
+			limit = *merged.Limit
+			if limit < 0 {
+				limit = -limit
+			}
+		}
+		if limit == 0 || limit > g.MaxResults {
+			// One more than allowed tells a too large result from a full one.
+			extra.SetLimit(g.MaxResults + 1)
+			max = g.MaxResults
+		}
+	}
+	return append(opts, extra), max
+}
+
+func checkResults(coll *mongo.Collection, n int, max int64) error {
+	if max > 0 && int64(n) > max {
+		return ErrResultTooLarge.WrapMsg("query matched too many documents", "collection", coll.Name(), "max", max)
+	}
+	return nil
+}
+
+func guardFindOne(coll *mongo.Collection, filter any, opts []*options.FindOneOptions) []*options.FindOneOptions {
+	g, ok := guardOf(coll)
+	if !ok {
+		return opts
+	}
+	merged := options.MergeFindOneOptions(opts...)
+	extra := options.FindOne()
+	if d := g.maxTime(merged.MaxTime); d != nil {
+		extra.SetMaxTime(*d)
+	}
+	if merged.Hint == nil {
+		if h := g.hint(filter); h != nil {
+			extra.SetHint(h)
+		}
+	}
+	return append(opts, extra)
+}
+
+func guardCount(coll *mongo.Collection, filter any, opts []*options.CountOptions) []*options.CountOptions {
+	g, ok := guardOf(coll)
+	if !ok {
+		return opts
+	}
+	merged := options.MergeCountOptions(opts...)
+	extra := options.Count()
+	if d := g.maxTime(merged.MaxTime); d != nil {
+		extra.SetMaxTime(*d)
+	}
+	if merged.Hint == nil {
+		if h := g.hint(filter); h != nil {
+			extra.SetHint(h)
+		}
+	}
+	return append(opts, extra)
+}
+
+func guardAggregate(coll *mongo.Collection, opts []*options.AggregateOptions) []*options.AggregateOptions {
+	g, ok := guardOf(coll)
+	if !ok {
+		return opts
+	}
+	if d := g.maxTime(options.MergeAggregateOptions(opts...).MaxTime); d != nil {
+		opts = append(opts, options.Aggregate().SetMaxTime(*d))
+	}
+	return opts
+}
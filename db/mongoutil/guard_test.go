@@ -0,0 +1,95 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func testCollection(t *testing.T, name string) *mongo.Collection {
+	cli, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	require.NoError(t, err)
+	return cli.Database("im").Collection(name)
+}
+
+func TestGuardFind(t *testing.T) {
+	SetGuards(map[string]Guard{
+		"im.msg": {
+			MaxTime:    time.Second,
+			MaxResults: 100,
+			Hints:      []Hint{{Fields: []string{"conversation_id", "seq"}, Index: "conversation_id_1_seq_1"}},
+		},
+		"*": {MaxTime: 5 * time.Second},
+	})
+	defer SetGuards(nil)
+	msg := testCollection(t, "msg")
+
+	opts, max := guardFind(msg, bson.M{"$and": bson.A{bson.M{"conversation_id": "c"}, bson.D{{Key: "seq", Value: 1}}}}, nil)
+	merged := options.MergeFindOptions(opts...)
+	assert.Equal(t, time.Second, *merged.MaxTime)
+	assert.Equal(t, int64(101), *merged.Limit)
+	assert.Equal(t, "conversation_id_1_seq_1", merged.Hint)
+	assert.Equal(t, int64(100), max)
+	assert.Error(t, checkResults(msg, 101, max))
+	assert.NoError(t, checkResults(msg, 100, max))
+
+	// Callers may ask for less, their hints win.
+	opts, max = guardFind(msg, bson.M{"conversation_id": "c"},
+		[]*options.FindOptions{options.Find().SetLimit(10).SetMaxTime(time.Millisecond).SetHint("_id_")})
+	merged = options.MergeFindOptions(opts...)
+	assert.Equal(t, time.Millisecond, *merged.MaxTime)
+	assert.Equal(t, int64(10), *merged.Limit)
+	assert.Equal(t, "_id_", merged.Hint)
+	assert.Equal(t, int64(0), max)
+
+	// Callers may not ask for more; the default guard applies elsewhere.
+	oneOpts := guardFindOne(testCollection(t, "user"), bson.M{}, []*options.FindOneOptions{options.FindOne().SetMaxTime(time.Hour)})
+	assert.Equal(t, 5*time.Second, *options.MergeFindOneOptions(oneOpts...).MaxTime)
+	countOpts := guardCount(msg, bson.M{"seq": 1}, []*options.CountOptions{options.Count().SetMaxTime(time.Hour)})
+	assert.Equal(t, time.Second, *options.MergeCountOptions(countOpts...).MaxTime)
+	assert.Nil(t, options.MergeCountOptions(countOpts...).Hint)
+}
+
+func TestGuardNone(t *testing.T) {
+	coll := testCollection(t, "msg")
+	opts, max := guardFind(coll, nil, nil)
+	assert.Empty(t, opts)
+	assert.Zero(t, max)
+	assert.Empty(t, guardAggregate(coll, nil))
+}
+
+func TestClientGuards(t *testing.T) {
+	SetGuard("*", Guard{MaxTime: time.Minute})
+	defer SetGuards(nil)
+	own := testCollection(t, "msg")
+	setClientGuards(own.Database().Client(), map[string]Guard{"msg": {MaxResults: 10}})
+	other := testCollection(t, "msg")
+
+	g, ok := guardOf(own)
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), g.MaxResults)
+	_, ok = guardOf(own.Database().Collection("user"))
+	assert.False(t, ok, "the process wide default does not apply to clients with guards")
+	g, ok = guardOf(other)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, g.MaxTime)
+}
@@ -41,6 +41,9 @@ type Config struct {
 	AuthSource  string
 	MaxPoolSize int
 	MaxRetry    int
+	// Guards bound the queries of the helpers on the collections of this
+	// client, keyed like SetGuard. Nil uses the process wide guards.
+	Guards map[string]Guard
 }
 
 type Client struct {
@@ -81,6 +84,9 @@ func NewMongoDB(ctx context.Context, config *Config) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if config.Guards != nil {
+		setClientGuards(cli, config.Guards)
+	}
 	return &Client{
 		tx: mtx,
 		db: cli.Database(config.Database),
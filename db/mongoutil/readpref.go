@@ -0,0 +1,127 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// ReadMode selects the members of a replica set reads may go to.
+type ReadMode string
+
+const (
+	ReadPrimary            ReadMode = "primary"
+	ReadPrimaryPreferred   ReadMode = "primaryPreferred"
+	ReadSecondary          ReadMode = "secondary"
+	ReadSecondaryPreferred ReadMode = "secondaryPreferred"
+	ReadNearest            ReadMode = "nearest"
+)
+
+// MinMaxStaleness is the smallest staleness bound servers accept.
+const MinMaxStaleness = 90 * time.Second
+
+// ReadPreference routes reads, e.g. heavy analytical queries to secondaries.
+type ReadPreference struct {
+	Mode ReadMode
+	// MaxStaleness excludes secondaries lagging behind the primary by more,
+	// unbounded when zero. It must be at least MinMaxStaleness and is not
+	// allowed with ReadPrimary.
+	MaxStaleness time.Duration
+	// Tags are tag sets in order of preference, e.g. {"use": "analytics"}
+	// to prefer dedicated members. An empty set as the last element falls
+	// back to any eligible member. Not allowed with ReadPrimary.
+	Tags []map[string]string
+}
+
+// Analytics returns the preference for heavy queries that tolerate
+// maxStaleness of lag: secondaries, the primary only when none is available.
+func Analytics(maxStaleness time.Duration, tags ...map[string]string) ReadPreference {
+	return ReadPreference{Mode: ReadSecondaryPreferred, MaxStaleness: maxStaleness, Tags: tags}
+}
+
+func (p ReadPreference) driver() (*readpref.ReadPref, error) {
+	mode, err := readpref.ModeFromString(string(p.Mode))
+	if err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid read mode", "mode", p.Mode)
+	}
+	if p.MaxStaleness > 0 && p.MaxStaleness < MinMaxStaleness {
+		return nil, errs.ErrArgs.WrapMsg("max staleness is below the minimum", "maxStaleness", p.MaxStaleness, "min", MinMaxStaleness)
+	}
+	var opts []readpref.Option
+	if p.MaxStaleness > 0 {
+		opts = append(opts, readpref.WithMaxStaleness(p.MaxStaleness))
+	}
+	if len(p.Tags) > 0 {
+		opts = append(opts, readpref.WithTagSets(tag.NewTagSetsFromMaps(p.Tags)...))
+	}
+	rp, err := readpref.New(mode, opts...)
+	if err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid read preference", "mode", p.Mode, "err", err.Error())
+	}
+	return rp, nil
+}
+
+// ReadFrom returns coll reading with the preference. Keep the result for
+// repeated queries instead of calling ReadFrom per query.
+func ReadFrom(coll *mongo.Collection, pref ReadPreference) (*mongo.Collection, error) {
+	rp, err := pref.driver()
+	if err != nil {
+		return nil, err
+	}
+	return readFrom(coll, rp)
+}
+
+func readFrom(coll *mongo.Collection, rp *readpref.ReadPref) (*mongo.Collection, error) {
+	c, err := coll.Clone(options.Collection().SetReadPreference(rp))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "mongo clone collection", "collection", coll.Name())
+	}
+	return c, nil
+}
+
+type readPrefKey struct{}
+
+type ctxReadPref struct {
+	rp  *readpref.ReadPref
+	err error
+}
+
+// WithReadPreference makes the queries of this package called with the
+// returned context, like Find, Count and Aggregate, read with the
+// preference. Writes are not affected, nor are reads in a transaction,
+// which always go to the primary. An invalid preference fails the queries.
+func WithReadPreference(ctx context.Context, pref ReadPreference) context.Context {
+	rp, err := pref.driver()
+	return context.WithValue(ctx, readPrefKey{}, ctxReadPref{rp: rp, err: err})
+}
+
+// reader returns coll with the read preference of ctx, if any.
+func reader(ctx context.Context, coll *mongo.Collection) (*mongo.Collection, error) {
+	v, ok := ctx.Value(readPrefKey{}).(ctxReadPref)
+	if !ok || mongo.SessionFromContext(ctx) != nil {
+		return coll, nil
+	}
+	if v.err != nil {
+		return nil, v.err
+	}
+	return readFrom(coll, v.rp)
+}
@@ -0,0 +1,68 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestReadPreference(t *testing.T) {
+	rp, err := Analytics(2*time.Minute, map[string]string{"use": "analytics"}, map[string]string{}).driver()
+	require.NoError(t, err)
+	assert.Equal(t, readpref.SecondaryPreferredMode, rp.Mode())
+	staleness, ok := rp.MaxStaleness()
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, staleness)
+	require.Len(t, rp.TagSets(), 2)
+	assert.True(t, rp.TagSets()[0].Contains("use", "analytics"))
+
+	for _, pref := range []ReadPreference{
+		{Mode: "fastest"},
+		{Mode: ReadSecondary, MaxStaleness: time.Second},
+		{Mode: ReadPrimary, Tags: []map[string]string{{"use": "analytics"}}},
+	} {
+		_, err := pref.driver()
+		assert.True(t, errs.ErrArgs.Is(err), pref)
+	}
+}
+
+func TestReader(t *testing.T) {
+	cli, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	require.NoError(t, err)
+	coll := cli.Database("db").Collection("msg")
+
+	same, err := reader(context.Background(), coll)
+	require.NoError(t, err)
+	assert.Same(t, coll, same)
+
+	ctx := WithReadPreference(context.Background(), ReadPreference{Mode: ReadNearest})
+	routed, err := reader(ctx, coll)
+	require.NoError(t, err)
+	assert.NotSame(t, coll, routed)
+	assert.Equal(t, "msg", routed.Name())
+
+	ctx = WithReadPreference(context.Background(), ReadPreference{Mode: ReadSecondary, MaxStaleness: time.Second})
+	_, err = Find[bool](ctx, coll, nil)
+	assert.True(t, errs.ErrArgs.Is(err))
+}
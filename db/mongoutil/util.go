@@ -91,16 +91,32 @@ func UpdateMany(ctx context.Context, coll *mongo.Collection, filter any, update
 }
 
 func Find[T any](ctx context.Context, coll *mongo.Collection, filter any, opts ...*options.FindOptions) ([]T, error) {
+	coll, err := reader(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+	opts, max := guardFind(coll, filter, opts)
 	cur, err := coll.Find(ctx, filter, opts...)
 	if err != nil {
 		return nil, errs.WrapMsg(err, "mongo find")
 	}
 	defer cur.Close(ctx)
-	return Decodes[T](ctx, cur)
+	res, err := Decodes[T](ctx, cur)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResults(coll, len(res), max); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 func FindOne[T any](ctx context.Context, coll *mongo.Collection, filter any, opts ...*options.FindOneOptions) (res T, err error) {
-	cur := coll.FindOne(ctx, filter, opts...)
+	coll, err = reader(ctx, coll)
+	if err != nil {
+		return res, err
+	}
+	cur := coll.FindOne(ctx, filter, guardFindOne(coll, filter, opts)...)
 	if err := cur.Err(); err != nil {
 		return res, errs.WrapMsg(err, "mongo find one")
 	}
@@ -145,7 +161,11 @@ func FindPageOnly[T any](ctx context.Context, coll *mongo.Collection, filter any
 }
 
 func Count(ctx context.Context, coll *mongo.Collection, filter any, opts ...*options.CountOptions) (int64, error) {
-	count, err := coll.CountDocuments(ctx, filter, opts...)
+	coll, err := reader(ctx, coll)
+	if err != nil {
+		return 0, err
+	}
+	count, err := coll.CountDocuments(ctx, filter, guardCount(coll, filter, opts)...)
 	if err != nil {
 		return 0, errs.WrapMsg(err, "mongo count")
 	}
@@ -192,7 +212,11 @@ func DeleteManyResult(ctx context.Context, coll *mongo.Collection, filter any, o
 }
 
 func Aggregate[T any](ctx context.Context, coll *mongo.Collection, pipeline any, opts ...*options.AggregateOptions) ([]T, error) {
-	cur, err := coll.Aggregate(ctx, pipeline, opts...)
+	coll, err := reader(ctx, coll)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := coll.Aggregate(ctx, pipeline, guardAggregate(coll, opts)...)
 	if err != nil {
 		return nil, errs.WrapMsg(err, "mongo aggregate")
 	}
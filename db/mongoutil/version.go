@@ -0,0 +1,112 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VersionField is the document field UpdateWithVersion compares and
+// increments.
+const VersionField = "version"
+
+// UpdateWithVersion applies update to the document matching filter only if
+// its version is still version, incrementing the version with the same
+// write, and returns the new version. It fails with
+// errs.ErrConcurrentModification when the document changed in between and
+// with errs.ErrRecordNotFound when no document matches filter. Version 0
+// also matches documents without a version field, e.g. those written before
+// versioning.
+func UpdateWithVersion(ctx context.Context, coll *mongo.Collection, filter any, version int64, update bson.M) (int64, error) {
+	inc := bson.M{VersionField: 1}
+	if v, ok := update["$inc"]; ok {
+		m, ok := v.(bson.M)
+		if !ok {
+			return 0, errs.ErrArgs.WrapMsg("versioned update requires $inc to be a bson.M")
+		}
+		inc = cloneM(m)
+		inc[VersionField] = 1
+	}
+	update = cloneM(update)
+	update["$inc"] = inc
+	match := bson.M{VersionField: version}
+	if version == 0 {
+		match = bson.M{"$or": bson.A{match, bson.M{VersionField: bson.M{"$exists": false}}}}
+	}
+	versioned := bson.M{"$and": bson.A{filter, match}}
+	res, err := coll.UpdateOne(ctx, versioned, update)
+	if err != nil {
+		return 0, errs.WrapMsg(err, "mongo versioned update", "version", version)
+	}
+	if res.MatchedCount == 0 {
+		exist, err := Exist(ctx, coll, filter)
+		if err != nil {
+			return 0, err
+		}
+		if !exist {
+			return 0, errs.ErrRecordNotFound.WrapMsg("mongo versioned update matched no document")
+		}
+		return 0, errs.ErrConcurrentModification.WrapMsg("document was modified concurrently", "version", version)
+	}
+	return version + 1, nil
+}
+
+func cloneM(m bson.M) bson.M {
+	c := make(bson.M, len(m)+1)
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// UpdateWithVersionRetry reads the document matching filter, lets fn build
+// the update for it and applies it with UpdateWithVersion, reading again and
+// calling fn again up to retries times when the document was modified
+// concurrently. It returns the document as read for the applied update and
+// the new version. Documents without a version field count as version 0.
+func UpdateWithVersionRetry[T any](ctx context.Context, coll *mongo.Collection, filter any, retries int, fn func(doc T) (bson.M, error)) (T, int64, error) {
+	for i := 0; ; i++ {
+		var doc T
+		var raw bson.Raw
+		if err := coll.FindOne(ctx, filter).Decode(&raw); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return doc, 0, errs.ErrRecordNotFound.WrapMsg("mongo versioned update matched no document")
+			}
+			return doc, 0, errs.WrapMsg(err, "mongo find one")
+		}
+		if err := bson.Unmarshal(raw, &doc); err != nil {
+			return doc, 0, errs.WrapMsg(err, "mongo decode")
+		}
+		var version int64
+		if v, err := raw.LookupErr(VersionField); err == nil {
+			var ok bool
+			if version, ok = v.AsInt64OK(); !ok {
+				return doc, 0, errs.ErrArgs.WrapMsg("document version is not a number", "type", v.Type.String())
+			}
+		}
+		update, err := fn(doc)
+		if err != nil {
+			return doc, 0, err
+		}
+		version, err = UpdateWithVersion(ctx, coll, filter, version, update)
+		if err == nil || i >= retries || !errs.ErrConcurrentModification.Is(err) {
+			return doc, version, err
+		}
+	}
+}
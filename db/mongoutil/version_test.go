@@ -0,0 +1,72 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongoutil_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/openimsdk/tools/db/mongoutil"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type groupInfo struct {
+	ID      string `bson:"_id"`
+	Name    string `bson:"name"`
+	Edits   int    `bson:"edits"`
+	Version int64  `bson:"version"`
+}
+
+func TestUpdateWithVersionArgs(t *testing.T) {
+	_, err := mongoutil.UpdateWithVersion(context.Background(), nil, bson.M{}, 1, bson.M{"$inc": bson.D{}})
+	assert.True(t, errs.ErrArgs.Is(err))
+}
+
+func TestUpdateWithVersion(t *testing.T) {
+	ctx := context.Background()
+	coll := containers.Mongo(t, "version").GetDB().Collection("group")
+	_, err := coll.InsertOne(ctx, bson.M{"_id": "g1", "name": "old"}) // No version yet.
+	require.NoError(t, err)
+
+	version, err := mongoutil.UpdateWithVersion(ctx, coll, bson.M{"_id": "g1"}, 0, bson.M{"$set": bson.M{"name": "new"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	_, err = mongoutil.UpdateWithVersion(ctx, coll, bson.M{"_id": "g1"}, 0, bson.M{"$set": bson.M{"name": "stale"}})
+	assert.True(t, errs.ErrConcurrentModification.Is(err))
+	_, err = mongoutil.UpdateWithVersion(ctx, coll, bson.M{"_id": "g2"}, 0, bson.M{"$set": bson.M{"name": "none"}})
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := mongoutil.UpdateWithVersionRetry(ctx, coll, bson.M{"_id": "g1"}, 100, func(g groupInfo) (bson.M, error) {
+				return bson.M{"$set": bson.M{"edits": g.Edits + 1}}, nil
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	g, err := mongoutil.FindOne[groupInfo](ctx, coll, bson.M{"_id": "g1"})
+	require.NoError(t, err)
+	assert.Equal(t, 8, g.Edits)
+	assert.Equal(t, int64(9), g.Version)
+}
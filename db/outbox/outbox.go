@@ -0,0 +1,145 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package outbox implements the transactional outbox pattern on Mongo.
+// Events are inserted into an outbox collection inside the business
+// transaction, so they are stored if and only if the business data is. A
+// Relay then publishes stored events to the message queue and marks them as
+// sent; sent events are removed by a TTL index after a retention period.
+//
+// Delivery is at least once: an event is published again only when a relay
+// stops between publishing it and marking it sent, so consumers should be
+// idempotent, e.g. by deduplicating on the message key.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Status of a stored event.
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusDead    = "dead" // Gave up after RelayConfig.MaxAttempts.
+)
+
+// Event is a message to publish.
+type Event struct {
+	Topic string
+	Key   string
+	Value []byte
+}
+
+type document struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Topic         string             `bson:"topic"`
+	Key           string             `bson:"key"`
+	Value         []byte             `bson:"value"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"last_error,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at"`
+	LockedBy      string             `bson:"locked_by,omitempty"`
+	LockedUntil   time.Time          `bson:"locked_until,omitempty"`
+	SentAt        *time.Time         `bson:"sent_at,omitempty"`
+}
+
+// Outbox stores events in a collection.
+type Outbox struct {
+	coll *mongo.Collection
+}
+
+// New returns an Outbox on coll.
+func New(coll *mongo.Collection) *Outbox {
+	return &Outbox{coll: coll}
+}
+
+// EnsureIndexes creates the index the relay polls with and the TTL index
+// removing sent events retention after they were sent.
+func (o *Outbox) EnsureIndexes(ctx context.Context, retention time.Duration) error {
+	_, err := o.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "sent_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(retention / time.Second))},
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create outbox indexes failed", "collection", o.coll.Name())
+	}
+	return nil
+}
+
+// Add stores events. Call it with the context of the business transaction,
+// e.g. inside tx.Tx.Transaction, so the events commit with the business data.
+func (o *Outbox) Add(ctx context.Context, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	docs := make([]any, len(events))
+	for i, e := range events {
+		if e.Topic == "" {
+			return errs.ErrArgs.WrapMsg("outbox event requires a topic")
+		}
+		docs[i] = &document{
+			ID:            primitive.NewObjectID(),
+			Topic:         e.Topic,
+			Key:           e.Key,
+			Value:         e.Value,
+			Status:        StatusPending,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		}
+	}
+	if _, err := o.coll.InsertMany(ctx, docs); err != nil {
+		return errs.WrapMsg(err, "insert outbox events failed", "count", len(events))
+	}
+	return nil
+}
+
+// Counts returns the number of stored events per status.
+func (o *Outbox) Counts(ctx context.Context) (map[string]int64, error) {
+	cur, err := o.coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$group", Value: bson.M{"_id": "$status", "count": bson.M{"$sum": 1}}}}})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "count outbox events failed")
+	}
+	var rows []struct {
+		Status string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err := cur.All(ctx, &rows); err != nil {
+		return nil, errs.WrapMsg(err, "decode outbox counts failed")
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// Retry moves dead events back to pending, e.g. after fixing a topic.
+func (o *Outbox) Retry(ctx context.Context) (int64, error) {
+	res, err := o.coll.UpdateMany(ctx, bson.M{"status": StatusDead},
+		bson.M{"$set": bson.M{"status": StatusPending, "attempts": 0, "next_attempt_at": time.Now().UTC()}})
+	if err != nil {
+		return 0, errs.WrapMsg(err, "retry dead outbox events failed")
+	}
+	return res.ModifiedCount, nil
+}
@@ -0,0 +1,106 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mq"
+	"github.com/openimsdk/tools/mq/mock"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDefaultBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, defaultBackoff(1))
+	assert.Equal(t, 4*time.Second, defaultBackoff(3))
+	assert.Equal(t, 5*time.Minute, defaultBackoff(10))
+	assert.Equal(t, 5*time.Minute, defaultBackoff(100))
+}
+
+func TestBlock(t *testing.T) {
+	r := &Relay{}
+	first, second := primitive.NewObjectID(), primitive.NewObjectID()
+	require.True(t, before(first, second))
+	blocked := map[string]primitive.ObjectID{}
+	r.block(blocked, &document{ID: second, Key: "k"})
+	r.block(blocked, &document{ID: first, Key: "k"})
+	r.block(blocked, &document{ID: first})
+	assert.Equal(t, map[string]primitive.ObjectID{"k": first}, blocked)
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	coll := containers.Mongo(t, "outbox").GetDB().Collection("outbox")
+	box := New(coll)
+	require.NoError(t, box.EnsureIndexes(ctx, time.Hour))
+
+	users, groups := mock.NewProducer(), mock.NewProducer()
+	relay := NewRelay(box, map[string]mq.Producer{"user": users, "group": groups}, RelayConfig{
+		BatchSize:   10,
+		MaxAttempts: 2,
+		Backoff:     func(int) time.Duration { return 0 },
+	})
+
+	require.NoError(t, box.Add(ctx,
+		Event{Topic: "user", Key: "u1", Value: []byte("created")},
+		Event{Topic: "group", Key: "g1", Value: []byte("created")},
+		Event{Topic: "user", Key: "u1", Value: []byte("renamed")},
+		Event{Topic: "missing", Key: "m1", Value: []byte("lost")},
+	))
+	assert.ErrorIs(t, box.Add(ctx, Event{Key: "x"}), errs.ErrArgs)
+
+	// The group topic is down: g1 is retried, u1 is published in order.
+	groups.SetError(errs.New("broker down"))
+	n, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []mock.Message{{Key: "u1", Value: []byte("created")}, {Key: "u1", Value: []byte("renamed")}}, users.Messages())
+
+	groups.SetError(nil)
+	n, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []mock.Message{{Key: "g1", Value: []byte("created")}}, groups.Messages())
+
+	counts, err := box.Counts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{StatusSent: 3, StatusDead: 1}, counts)
+
+	// A failed event holds back later events of its key.
+	users.Reset()
+	require.NoError(t, box.Add(ctx, Event{Topic: "user", Key: "u2", Value: []byte("1")}))
+	users.SetError(errs.New("broker down"))
+	_, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.NoError(t, box.Add(ctx, Event{Topic: "user", Key: "u2", Value: []byte("2")}))
+	_, err = coll.UpdateMany(ctx, bson.M{"key": "u2", "attempts": 1}, bson.M{"$set": bson.M{"next_attempt_at": time.Now().Add(time.Hour)}})
+	require.NoError(t, err)
+	users.SetError(nil)
+	n, err = relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	assert.Empty(t, users.Messages())
+
+	retried, err := box.Retry(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), retried)
+}
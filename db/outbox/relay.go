@@ -0,0 +1,250 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mq"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RelayConfig configures a Relay.
+type RelayConfig struct {
+	BatchSize   int           // Events claimed per poll, defaults to 100.
+	Interval    time.Duration // Poll interval while idle, defaults to 1 second.
+	Lease       time.Duration // How long claimed events are reserved, defaults to 30 seconds.
+	MaxAttempts int           // Publish attempts before an event is dead, defaults to 10.
+	// Backoff returns the delay before retrying an event that failed attempt
+	// times. Defaults to doubling from 1 second up to 5 minutes.
+	Backoff func(attempt int) time.Duration
+	Owner   string // Identifies the relay in claimed events, defaults to hostname and pid.
+}
+
+// Relay publishes stored events. Several relays may run on the same outbox;
+// events are claimed with a lease so each is published by one relay at a
+// time, and events sharing a key are published in insertion order.
+type Relay struct {
+	outbox    *Outbox
+	producers map[string]mq.Producer
+	conf      RelayConfig
+}
+
+// NewRelay creates a relay publishing events to the producer of their topic.
+func NewRelay(outbox *Outbox, producers map[string]mq.Producer, conf RelayConfig) *Relay {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+	if conf.Lease <= 0 {
+		conf.Lease = 30 * time.Second
+	}
+	if conf.MaxAttempts <= 0 {
+		conf.MaxAttempts = 10
+	}
+	if conf.Backoff == nil {
+		conf.Backoff = defaultBackoff
+	}
+	if conf.Owner == "" {
+		host, _ := os.Hostname()
+		conf.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &Relay{outbox: outbox, producers: producers, conf: conf}
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	d := time.Second << min(attempt-1, 9)
+	return min(d, 5*time.Minute)
+}
+
+// Run relays events until ctx is done.
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.ZWarn(ctx, "outbox relay failed", err, "owner", r.conf.Owner)
+		}
+		if err == nil && n >= r.conf.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.conf.Interval):
+		}
+	}
+}
+
+// RelayOnce claims one batch of due events, publishes them and returns how
+// many were claimed.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	coll := r.outbox.coll
+	now := time.Now().UTC()
+	due := bson.M{
+		"status":          StatusPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or":             bson.A{bson.M{"locked_until": bson.M{"$exists": false}}, bson.M{"locked_until": bson.M{"$lt": now}}},
+	}
+	cur, err := coll.Find(ctx, due, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(r.conf.BatchSize)))
+	if err != nil {
+		return 0, errs.WrapMsg(err, "find outbox events failed")
+	}
+	var docs []*document
+	if err := cur.All(ctx, &docs); err != nil {
+		return 0, errs.WrapMsg(err, "decode outbox events failed")
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	blocked, err := r.blockedKeys(ctx, docs, now)
+	if err != nil {
+		return 0, err
+	}
+	var claimed int
+	for _, doc := range docs {
+		if doc.Key != "" {
+			if first, ok := blocked[doc.Key]; ok && before(first, doc.ID) {
+				continue
+			}
+		}
+		filter := bson.M{"_id": doc.ID}
+		for k, v := range due {
+			filter[k] = v
+		}
+		res, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"locked_by": r.conf.Owner, "locked_until": now.Add(r.conf.Lease)}})
+		if err != nil {
+			return claimed, errs.WrapMsg(err, "claim outbox event failed", "id", doc.ID.Hex())
+		}
+		if res.ModifiedCount == 0 {
+			// Another relay took it; later events of the key must wait.
+			r.block(blocked, doc)
+			continue
+		}
+		claimed++
+		if err := r.publish(ctx, doc); err != nil {
+			r.block(blocked, doc)
+			if err := r.fail(ctx, doc, err); err != nil {
+				return claimed, err
+			}
+			continue
+		}
+		if err := r.ack(ctx, doc); err != nil {
+			return claimed, err
+		}
+	}
+	return claimed, nil
+}
+
+// blockedKeys returns, per key of docs, the oldest pending event of that key
+// which is not due yet or claimed by another relay. Events of the key newer
+// than it are held back to keep per key order.
+func (r *Relay) blockedKeys(ctx context.Context, docs []*document, now time.Time) (map[string]primitive.ObjectID, error) {
+	keys := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if doc.Key != "" {
+			keys = append(keys, doc.Key)
+		}
+	}
+	blocked := make(map[string]primitive.ObjectID)
+	if len(keys) == 0 {
+		return blocked, nil
+	}
+	filter := bson.M{
+		"status": StatusPending,
+		"key":    bson.M{"$in": keys},
+		"_id":    bson.M{"$lt": docs[len(docs)-1].ID},
+		"$or":    bson.A{bson.M{"next_attempt_at": bson.M{"$gt": now}}, bson.M{"locked_until": bson.M{"$gte": now}}},
+	}
+	cur, err := r.outbox.coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"key": 1}).SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find blocked outbox keys failed")
+	}
+	var held []*document
+	if err := cur.All(ctx, &held); err != nil {
+		return nil, errs.WrapMsg(err, "decode blocked outbox keys failed")
+	}
+	for _, doc := range held {
+		r.block(blocked, doc)
+	}
+	return blocked, nil
+}
+
+func (r *Relay) block(blocked map[string]primitive.ObjectID, doc *document) {
+	if doc.Key == "" {
+		return
+	}
+	if first, ok := blocked[doc.Key]; !ok || before(doc.ID, first) {
+		blocked[doc.Key] = doc.ID
+	}
+}
+
+// before reports whether a sorts before b, which is insertion order for IDs
+// generated by Add.
+func before(a, b primitive.ObjectID) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
+func (r *Relay) publish(ctx context.Context, doc *document) error {
+	producer, ok := r.producers[doc.Topic]
+	if !ok {
+		return errs.New("no producer for outbox topic", "topic", doc.Topic).Wrap()
+	}
+	return producer.SendMessage(ctx, doc.Key, doc.Value)
+}
+
+func (r *Relay) ack(ctx context.Context, doc *document) error {
+	now := time.Now().UTC()
+	_, err := r.outbox.coll.UpdateOne(ctx, bson.M{"_id": doc.ID, "locked_by": r.conf.Owner}, bson.M{
+		"$set":   bson.M{"status": StatusSent, "sent_at": now},
+		"$unset": bson.M{"locked_by": "", "locked_until": ""},
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "mark outbox event sent failed", "id", doc.ID.Hex())
+	}
+	return nil
+}
+
+func (r *Relay) fail(ctx context.Context, doc *document, cause error) error {
+	attempts := doc.Attempts + 1
+	set := bson.M{
+		"attempts":        attempts,
+		"last_error":      cause.Error(),
+		"next_attempt_at": time.Now().UTC().Add(r.conf.Backoff(attempts)),
+	}
+	if attempts >= r.conf.MaxAttempts {
+		set["status"] = StatusDead
+		log.ZError(ctx, "outbox event dead", cause, "id", doc.ID.Hex(), "topic", doc.Topic, "key", doc.Key, "attempts", attempts)
+	} else {
+		log.ZWarn(ctx, "outbox publish failed", cause, "id", doc.ID.Hex(), "topic", doc.Topic, "key", doc.Key, "attempts", attempts)
+	}
+	_, err := r.outbox.coll.UpdateOne(ctx, bson.M{"_id": doc.ID, "locked_by": r.conf.Owner}, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"locked_by": "", "locked_until": ""},
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "mark outbox event failed", "id", doc.ID.Hex())
+	}
+	return nil
+}
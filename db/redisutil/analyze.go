@@ -0,0 +1,378 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+// AnalyzeConfig configures Analyze.
+type AnalyzeConfig struct {
+	// Prefixes are the key prefixes of the logical caches. A key belongs to
+	// the longest prefix it starts with. Without prefixes keys are grouped
+	// by their first Separator-terminated segment. Keys of no group are
+	// reported under the empty prefix.
+	Prefixes []string
+	// Separator defaults to ":".
+	Separator string
+	// SampleSize is the number of keys per prefix whose memory, type and
+	// TTL are read, defaults to 1000.
+	SampleSize int
+	// MaxScan stops the scan after that many keys, defaults to 1000000.
+	MaxScan int64
+	// ScanCount is the COUNT hint of each SCAN call, defaults to 1000.
+	ScanCount int64
+	// Pause is slept between SCAN calls to limit the load on the server.
+	Pause time.Duration
+	// BigKeyBytes is the memory from which a sampled key is reported as a
+	// big key, defaults to 1 MiB.
+	BigKeyBytes int64
+	// TopN bounds the big keys reported per prefix and overall, defaults
+	// to 10.
+	TopN int
+}
+
+func (c *AnalyzeConfig) applyDefaults() {
+	if c.Separator == "" {
+		c.Separator = ":"
+	}
+	if c.SampleSize <= 0 {
+		c.SampleSize = 1000
+	}
+	if c.MaxScan <= 0 {
+		c.MaxScan = 1000000
+	}
+	if c.ScanCount <= 0 {
+		c.ScanCount = 1000
+	}
+	if c.BigKeyBytes <= 0 {
+		c.BigKeyBytes = 1 << 20
+	}
+	if c.TopN <= 0 {
+		c.TopN = 10
+	}
+}
+
+// KeyInfo describes a sampled key. TTLSeconds is -1 for keys without TTL.
+type KeyInfo struct {
+	Key        string `json:"key"`
+	Type       string `json:"type"`
+	Bytes      int64  `json:"bytes"`
+	TTLSeconds int64  `json:"ttlSeconds"`
+}
+
+// TTLDistribution counts the sampled keys by remaining TTL.
+type TTLDistribution struct {
+	None   int `json:"none"`
+	Minute int `json:"minute"`
+	Hour   int `json:"hour"`
+	Day    int `json:"day"`
+	Week   int `json:"week"`
+	Longer int `json:"longer"`
+}
+
+func (d *TTLDistribution) add(ttl time.Duration) {
+	switch {
+	case ttl < 0:
+		d.None++
+	case ttl < time.Minute:
+		d.Minute++
+	case ttl < time.Hour:
+		d.Hour++
+	case ttl < 24*time.Hour:
+		d.Day++
+	case ttl < 7*24*time.Hour:
+		d.Week++
+	default:
+		d.Longer++
+	}
+}
+
+// PrefixStats are the statistics of a logical cache. Keys counts all
+// scanned keys, the other fields the sampled ones; EstimatedBytes
+// extrapolates the average to all keys.
+type PrefixStats struct {
+	Prefix         string          `json:"prefix"`
+	Keys           int64           `json:"keys"`
+	Sampled        int             `json:"sampled"`
+	SampledBytes   int64           `json:"sampledBytes"`
+	AvgBytes       int64           `json:"avgBytes"`
+	MaxBytes       int64           `json:"maxBytes"`
+	EstimatedBytes int64           `json:"estimatedBytes"`
+	Types          map[string]int  `json:"types"`
+	TTL            TTLDistribution `json:"ttl"`
+	BigKeys        []KeyInfo       `json:"bigKeys"`
+}
+
+// Report is the result of Analyze, prefixes ordered by EstimatedBytes.
+// Truncated is set when the scan stopped at MaxScan.
+type Report struct {
+	Scanned   int64          `json:"scanned"`
+	Truncated bool           `json:"truncated"`
+	Duration  string         `json:"duration"`
+	Prefixes  []*PrefixStats `json:"prefixes"`
+	BigKeys   []KeyInfo      `json:"bigKeys"`
+}
+
+// Analyze scans the keyspace, on every master of a cluster, and reports key
+// counts, memory usage, types and TTL distribution per logical cache along
+// with the biggest keys. It uses SCAN and MEMORY USAGE only, but still adds
+// load; run it against replicas or with a Pause where possible.
+func Analyze(ctx context.Context, rdb redis.UniversalClient, conf AnalyzeConfig) (*Report, error) {
+	conf.applyDefaults()
+	start := time.Now()
+	a := &analyzer{conf: conf, groups: make(map[string]*PrefixStats)}
+	var err error
+	if cluster, ok := rdb.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return a.scan(ctx, node)
+		})
+	} else {
+		err = a.scan(ctx, rdb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	report := a.report()
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+type analyzer struct {
+	conf AnalyzeConfig
+
+	mu        sync.Mutex
+	groups    map[string]*PrefixStats
+	scanned   int64
+	truncated bool
+}
+
+func (a *analyzer) scan(ctx context.Context, rdb redis.UniversalClient) error {
+	var match string
+	if len(a.conf.Prefixes) == 1 {
+		match = escapeGlob(a.conf.Prefixes[0]) + "*"
+	}
+	var cursor uint64
+	for {
+		keys, next, err := rdb.Scan(ctx, cursor, match, a.conf.ScanCount).Result()
+		if err != nil {
+			return errs.WrapMsg(err, "redis scan failed", "cursor", cursor)
+		}
+		sample, done := a.count(keys)
+		if err := a.sample(ctx, rdb, sample); err != nil {
+			return err
+		}
+		if done || next == 0 {
+			return nil
+		}
+		cursor = next
+		if a.conf.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return errs.Wrap(ctx.Err())
+			case <-time.After(a.conf.Pause):
+			}
+		}
+	}
+}
+
+// group returns the prefix key belongs to.
+func (a *analyzer) group(key string) string {
+	if len(a.conf.Prefixes) == 0 {
+		if i := strings.Index(key, a.conf.Separator); i >= 0 {
+			return key[:i+len(a.conf.Separator)]
+		}
+		return ""
+	}
+	var best string
+	for _, prefix := range a.conf.Prefixes {
+		if len(prefix) > len(best) && strings.HasPrefix(key, prefix) {
+			best = prefix
+		}
+	}
+	return best
+}
+
+func (a *analyzer) stats(prefix string) *PrefixStats {
+	s, ok := a.groups[prefix]
+	if !ok {
+		s = &PrefixStats{Prefix: prefix, Types: make(map[string]int)}
+		a.groups[prefix] = s
+	}
+	return s
+}
+
+// count counts keys and returns the ones to sample. done is set when
+// MaxScan is reached.
+func (a *analyzer) count(keys []string) (sample []string, done bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, key := range keys {
+		if a.scanned >= a.conf.MaxScan {
+			a.truncated = true
+			return sample, true
+		}
+		a.scanned++
+		s := a.stats(a.group(key))
+		s.Keys++
+		if s.Sampled < a.conf.SampleSize {
+			s.Sampled++
+			sample = append(sample, key)
+		}
+	}
+	return sample, false
+}
+
+func (a *analyzer) sample(ctx context.Context, rdb redis.UniversalClient, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	type cmds struct {
+		mem *redis.IntCmd
+		typ *redis.StatusCmd
+		ttl *redis.DurationCmd
+	}
+	pipe := rdb.Pipeline()
+	res := make([]cmds, len(keys))
+	for i, key := range keys {
+		res[i] = cmds{mem: pipe.MemoryUsage(ctx, key), typ: pipe.Type(ctx, key), ttl: pipe.PTTL(ctx, key)}
+	}
+	if err := pipeErr(pipe.Exec(ctx)); err != nil {
+		return errs.WrapMsg(err, "redis memory usage failed", "keys", len(keys))
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, key := range keys {
+		s := a.stats(a.group(key))
+		bytes, err := res[i].mem.Result()
+		if errors.Is(err, redis.Nil) {
+			// The key expired or was deleted since the scan.
+			s.Sampled--
+			continue
+		} else if err != nil {
+			return errs.WrapMsg(err, "redis memory usage failed", "key", key)
+		}
+		ttl := res[i].ttl.Val()
+		info := KeyInfo{Key: key, Type: res[i].typ.Val(), Bytes: bytes, TTLSeconds: -1}
+		if ttl >= 0 {
+			info.TTLSeconds = int64(ttl / time.Second)
+		}
+		s.SampledBytes += bytes
+		s.MaxBytes = max(s.MaxBytes, bytes)
+		s.Types[info.Type]++
+		s.TTL.add(ttl)
+		if bytes >= a.conf.BigKeyBytes {
+			s.BigKeys = topKeys(append(s.BigKeys, info), a.conf.TopN)
+		}
+	}
+	return nil
+}
+
+func (a *analyzer) report() *Report {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	report := &Report{Scanned: a.scanned, Truncated: a.truncated, Prefixes: make([]*PrefixStats, 0, len(a.groups))}
+	for _, s := range a.groups {
+		if s.Sampled > 0 {
+			s.AvgBytes = s.SampledBytes / int64(s.Sampled)
+		}
+		s.EstimatedBytes = s.AvgBytes * s.Keys
+		report.Prefixes = append(report.Prefixes, s)
+		report.BigKeys = append(report.BigKeys, s.BigKeys...)
+	}
+	sort.Slice(report.Prefixes, func(i, j int) bool {
+		if report.Prefixes[i].EstimatedBytes != report.Prefixes[j].EstimatedBytes {
+			return report.Prefixes[i].EstimatedBytes > report.Prefixes[j].EstimatedBytes
+		}
+		return report.Prefixes[i].Prefix < report.Prefixes[j].Prefix
+	})
+	report.BigKeys = topKeys(report.BigKeys, a.conf.TopN)
+	return report
+}
+
+// topKeys returns the n biggest keys, biggest first.
+func topKeys(keys []KeyInfo, n int) []KeyInfo {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Bytes > keys[j].Bytes })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// AnalyzeHandler serves Analyze as an admin command in the apiresp
+// envelope. The prefix query parameter, repeatable, replaces
+// conf.Prefixes and sample replaces conf.SampleSize. Mount it behind admin
+// authentication only.
+func AnalyzeHandler(rdb redis.UniversalClient, conf AnalyzeConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := analyzeRequest(r, rdb, conf)
+		if err != nil {
+			apiresp.HttpError(w, err)
+			return
+		}
+		apiresp.HttpSuccess(w, report)
+	})
+}
+
+// AnalyzeGin is AnalyzeHandler for gin.
+func AnalyzeGin(rdb redis.UniversalClient, conf AnalyzeConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := analyzeRequest(c.Request, rdb, conf)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		apiresp.GinSuccess(c, report)
+	}
+}
+
+func analyzeRequest(r *http.Request, rdb redis.UniversalClient, conf AnalyzeConfig) (*Report, error) {
+	query := r.URL.Query()
+	if prefixes := query["prefix"]; len(prefixes) > 0 {
+		conf.Prefixes = prefixes
+	}
+	if s := query.Get("sample"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, errs.ErrArgs.WrapMsg("invalid sample", "sample", s)
+		}
+		conf.SampleSize = n
+	}
+	return Analyze(r.Context(), rdb, conf)
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisutil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyzerGroup(t *testing.T) {
+	a := &analyzer{conf: AnalyzeConfig{Prefixes: []string{"MSG:", "MSG:CACHE:"}}}
+	a.conf.applyDefaults()
+	assert.Equal(t, "MSG:CACHE:", a.group("MSG:CACHE:1"))
+	assert.Equal(t, "MSG:", a.group("MSG:SEQ:1"))
+	assert.Equal(t, "", a.group("TOKEN:1"))
+
+	a.conf.Prefixes = nil
+	assert.Equal(t, "TOKEN:", a.group("TOKEN:1:2"))
+	assert.Equal(t, "", a.group("plain"))
+	assert.Equal(t, `a\*b\[1\]`, escapeGlob("a*b[1]"))
+}
+
+func TestAnalyzerReport(t *testing.T) {
+	a := &analyzer{conf: AnalyzeConfig{SampleSize: 2, MaxScan: 4}, groups: make(map[string]*PrefixStats)}
+	a.conf.applyDefaults()
+	sample, done := a.count([]string{"A:1", "A:2", "A:3", "B:1", "B:2"})
+	assert.Equal(t, []string{"A:1", "A:2", "B:1"}, sample)
+	assert.True(t, done)
+
+	// Record the samples the way sample does after reading them.
+	for key, bytes := range map[string]int64{"A:1": 100, "A:2": 300, "B:1": 2 << 20} {
+		s := a.stats(a.group(key))
+		s.SampledBytes += bytes
+		s.MaxBytes = max(s.MaxBytes, bytes)
+		if bytes >= a.conf.BigKeyBytes {
+			s.BigKeys = append(s.BigKeys, KeyInfo{Key: key, Bytes: bytes})
+		}
+	}
+	report := a.report()
+	assert.Equal(t, int64(4), report.Scanned)
+	assert.True(t, report.Truncated)
+	assert.Equal(t, "B:", report.Prefixes[0].Prefix)
+	assert.Equal(t, int64(2<<20), report.Prefixes[0].EstimatedBytes)
+	assert.Equal(t, int64(200), report.Prefixes[1].AvgBytes)
+	assert.Equal(t, int64(600), report.Prefixes[1].EstimatedBytes)
+	assert.Equal(t, []KeyInfo{{Key: "B:1", Bytes: 2 << 20}}, report.BigKeys)
+}
+
+func TestTTLDistribution(t *testing.T) {
+	var d TTLDistribution
+	for _, ttl := range []time.Duration{-1, time.Second, 2 * time.Hour, 30 * 24 * time.Hour} {
+		d.add(ttl)
+	}
+	assert.Equal(t, TTLDistribution{None: 1, Minute: 1, Day: 1, Longer: 1}, d)
+}
+
+func TestAnalyzeHandlerArgs(t *testing.T) {
+	w := httptest.NewRecorder()
+	AnalyzeHandler(nil, AnalyzeConfig{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/redis/analyze?sample=x", nil))
+	assert.Contains(t, w.Body.String(), `"errCode":1001`)
+}
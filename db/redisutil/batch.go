@@ -0,0 +1,124 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisutil
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/datautil"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultBatchSize is the number of keys sent per pipeline by BatchGet and
+// BatchSet when no size is given.
+const DefaultBatchSize = 500
+
+// BatchGet gets many keys in pipelines of at most batchSize, DefaultBatchSize
+// when zero, so a huge key list neither blocks the connection like a single
+// MGET nor fails with CROSSSLOT on a cluster. Keys that do not exist are
+// Missing, keys whose pipeline failed are kept in Errors.
+func BatchGet(ctx context.Context, rdb redis.UniversalClient, keys []string, batchSize int) *datautil.PartialResult[string, string] {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	res := datautil.NewPartialResult[string, string]()
+	keys = datautil.Distinct(keys)
+	for start := 0; start < len(keys); start += batchSize {
+		chunk := keys[start:min(start+batchSize, len(keys))]
+		pipe := rdb.Pipeline()
+		cmds := make([]*redis.StringCmd, len(chunk))
+		for i, key := range chunk {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		execErr := pipeErr(pipe.Exec(ctx))
+		for i, cmd := range cmds {
+			val, err := cmd.Result()
+			if execErr != nil {
+				err = execErr
+			}
+			switch {
+			case err == nil:
+				res.Found[chunk[i]] = val
+			case errors.Is(err, redis.Nil):
+				res.Missing = append(res.Missing, chunk[i])
+			default:
+				res.Errors[chunk[i]] = errs.WrapMsg(err, "redis batch get failed", "key", chunk[i])
+			}
+		}
+	}
+	return res
+}
+
+// BatchSet sets many keys with the expiration, none when zero, in pipelines
+// of at most batchSize, DefaultBatchSize when zero. It returns the first
+// failure with the number of keys that failed; the other keys are set.
+func BatchSet(ctx context.Context, rdb redis.UniversalClient, values map[string]string, expiration time.Duration, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	var (
+		first  error
+		failed int
+		pipe   = rdb.Pipeline()
+		cmds   = make(map[string]*redis.StatusCmd, min(len(values), batchSize))
+	)
+	flush := func() {
+		execErr := pipeErr(pipe.Exec(ctx))
+		for key, cmd := range cmds {
+			err := cmd.Err()
+			if execErr != nil {
+				err = execErr
+			}
+			if err != nil {
+				if first == nil {
+					first = errs.WrapMsg(err, "redis batch set failed", "key", key)
+				}
+				failed++
+			}
+		}
+		clear(cmds)
+	}
+	for key, val := range values {
+		cmds[key] = pipe.Set(ctx, key, val, expiration)
+		if len(cmds) == batchSize {
+			flush()
+		}
+	}
+	if len(cmds) > 0 {
+		flush()
+	}
+	if first != nil {
+		return errs.WrapMsg(first, "redis batch set incomplete", "failed", failed, "total", len(values))
+	}
+	return nil
+}
+
+// pipeErr returns the error of a pipeline that failed as a whole, e.g. to
+// connect, in which case its commands carry no error of their own. Errors of
+// single commands, including redis.Nil, are left to the commands.
+func pipeErr(cmds []redis.Cmder, err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, cmd := range cmds {
+		if cmd.Err() != nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,57 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redisutil_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/db/redisutil"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchUnavailable(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+	ctx := context.Background()
+	res := redisutil.BatchGet(ctx, rdb, []string{"a", "b", "a"}, 1)
+	assert.True(t, res.Failed())
+	assert.Len(t, res.Errors, 2)
+	assert.Error(t, redisutil.BatchSet(ctx, rdb, map[string]string{"a": "1"}, 0, 0))
+}
+
+func TestBatch(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	values := make(map[string]string)
+	keys := make([]string, 0, 1001)
+	for i := 0; i < 1000; i++ {
+		key := "BATCH_TEST:" + strconv.Itoa(i)
+		values[key] = strconv.Itoa(i)
+		keys = append(keys, key)
+	}
+	require.NoError(t, redisutil.BatchSet(ctx, rdb, values, time.Minute, 64))
+	keys = append(keys, "BATCH_TEST:missing")
+
+	res := redisutil.BatchGet(ctx, rdb, keys, 64)
+	assert.Equal(t, values, res.Found)
+	assert.Equal(t, []string{"BATCH_TEST:missing"}, res.Missing)
+	assert.Empty(t, res.Errors)
+}
@@ -0,0 +1,82 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package versionlog
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Delta is the answer to an incremental sync request. When Full is set the
+// client reloads everything; otherwise it applies Changes. Either way it then
+// stores LogID and Version for the next request.
+type Delta struct {
+	LogID   string
+	Version uint64
+	Full    bool
+	Changes []Elem // Ordered by version.
+}
+
+// Inserted returns the IDs of elements inserted since the client version.
+func (d *Delta) Inserted() []string {
+	return d.ids(StateInsert)
+}
+
+// Updated returns the IDs of elements updated since the client version.
+func (d *Delta) Updated() []string {
+	return d.ids(StateUpdate)
+}
+
+// Deleted returns the IDs of elements deleted since the client version.
+func (d *Delta) Deleted() []string {
+	return d.ids(StateDelete)
+}
+
+func (d *Delta) ids(state int) []string {
+	var ids []string
+	for _, e := range d.Changes {
+		if e.State == state {
+			ids = append(ids, e.EID)
+		}
+	}
+	return ids
+}
+
+// Delta computes the changes after version for a client that synced the log
+// identified by logID. l.Logs may already be filtered to entries after
+// version. A full sync is required when the client has no or another log ID,
+// when its version is ahead of the log or older than the trimmed entries, or
+// when more than limit elements changed; limit <= 0 means no limit.
+func (l *Log) Delta(logID string, version uint64, limit int) *Delta {
+	d := &Delta{Version: l.Version}
+	if l.ID.IsZero() {
+		// The key never changed: an empty full sync, unless the client is
+		// already at that state.
+		d.Full = logID != "" || version != 0
+		return d
+	}
+	d.LogID = l.ID.Hex()
+	if id, err := primitive.ObjectIDFromHex(logID); err != nil || id != l.ID || version > l.Version || version < l.Deleted {
+		d.Full = true
+		return d
+	}
+	for _, e := range l.Logs {
+		if e.Version > version {
+			d.Changes = append(d.Changes, e)
+		}
+	}
+	if limit > 0 && len(d.Changes) > limit {
+		d.Full = true
+		d.Changes = nil
+	}
+	return d
+}
@@ -0,0 +1,205 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package versionlog keeps a version and a change log per key in Mongo, e.g.
+// the friend list or joined groups of a user, so clients can sync
+// incrementally. Every change increments the version of the key and records
+// the changed element IDs; Delta tells a client with a known version which
+// elements changed since, or that it must fall back to a full sync.
+package versionlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// State of a change.
+const (
+	StateInsert = 1
+	StateDelete = 2
+	StateUpdate = 3
+)
+
+// Elem is the latest change of one element.
+type Elem struct {
+	EID        string    `bson:"e_id"`
+	State      int       `bson:"state"`
+	Version    uint64    `bson:"version"`
+	LastUpdate time.Time `bson:"last_update"`
+}
+
+// Log is the version log of a key. Logs holds at most one entry per element,
+// ordered by version. Changes up to Deleted were trimmed from Logs.
+type Log struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	DID        string             `bson:"d_id"`
+	Logs       []Elem             `bson:"logs"`
+	Version    uint64             `bson:"version"`
+	Deleted    uint64             `bson:"deleted"`
+	LastUpdate time.Time          `bson:"last_update"`
+}
+
+// Config configures a VersionLog.
+type Config struct {
+	// MaxLogs bounds the entries kept per key, defaults to 1000. Clients
+	// older than the trimmed entries do a full sync.
+	MaxLogs int
+}
+
+// VersionLog stores version logs in a collection.
+type VersionLog struct {
+	coll *mongo.Collection
+	conf Config
+}
+
+// New returns a VersionLog on coll.
+func New(coll *mongo.Collection, conf Config) *VersionLog {
+	if conf.MaxLogs <= 0 {
+		conf.MaxLogs = 1000
+	}
+	return &VersionLog{coll: coll, conf: conf}
+}
+
+// EnsureIndexes creates the unique index on the key.
+func (v *VersionLog) EnsureIndexes(ctx context.Context) error {
+	_, err := v.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "d_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create version log indexes failed", "collection", v.coll.Name())
+	}
+	return nil
+}
+
+// Incr records a change of eIDs under dID and returns the log with its new
+// version, without entries. An empty eIDs only bumps the version, e.g. when a
+// property of the key itself changed. Call it in the transaction of the
+// change so the version never runs ahead of the data.
+func (v *VersionLog) Incr(ctx context.Context, dID string, eIDs []string, state int) (*Log, error) {
+	if state != StateInsert && state != StateDelete && state != StateUpdate {
+		return nil, errs.ErrArgs.WrapMsg("invalid version log state", "state", state)
+	}
+	eIDs = distinct(eIDs)
+	now := time.Now().UTC()
+	elems := make([]bson.M, len(eIDs))
+	for i, eID := range eIDs {
+		elems[i] = bson.M{
+			"e_id":        bson.M{"$literal": eID},
+			"state":       state,
+			"version":     "$version",
+			"last_update": now,
+		}
+	}
+	size := bson.M{"$size": "$logs"}
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"version":     bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+			"deleted":     bson.M{"$ifNull": bson.A{"$deleted", 0}},
+			"last_update": now,
+			"logs": bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$logs", bson.A{}}},
+				"cond":  bson.M{"$not": bson.A{bson.M{"$in": bson.A{"$$this.e_id", eIDs}}}},
+			}},
+		}}},
+		{{Key: "$set", Value: bson.M{"logs": bson.M{"$concatArrays": bson.A{"$logs", elems}}}}},
+		{{Key: "$set", Value: bson.M{"deleted": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{size, v.conf.MaxLogs}},
+			bson.M{"$let": bson.M{
+				"vars": bson.M{"last": bson.M{"$arrayElemAt": bson.A{"$logs", bson.M{"$subtract": bson.A{size, v.conf.MaxLogs + 1}}}}},
+				"in":   "$$last.version",
+			}},
+			"$deleted",
+		}}}}},
+		{{Key: "$set", Value: bson.M{"logs": bson.M{"$cond": bson.A{
+			bson.M{"$gt": bson.A{size, v.conf.MaxLogs}},
+			bson.M{"$slice": bson.A{"$logs", -v.conf.MaxLogs}},
+			"$logs",
+		}}}}},
+	}
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"logs": 0})
+	var log Log
+	if err := v.coll.FindOneAndUpdate(ctx, bson.M{"d_id": dID}, pipeline, opts).Decode(&log); err != nil {
+		return nil, errs.WrapMsg(err, "increment version log failed", "dID", dID)
+	}
+	return &log, nil
+}
+
+// Current returns the log of dID without entries, or a zero log without an
+// ID when dID never changed. Clients store its ID and version after a full sync.
+func (v *VersionLog) Current(ctx context.Context, dID string) (*Log, error) {
+	var log Log
+	err := v.coll.FindOne(ctx, bson.M{"d_id": dID}, options.FindOne().SetProjection(bson.M{"logs": 0})).Decode(&log)
+	if err == mongo.ErrNoDocuments {
+		return &Log{DID: dID}, nil
+	}
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find version log failed", "dID", dID)
+	}
+	return &log, nil
+}
+
+// Delta returns the changes of dID since a client synced version of the log
+// identified by logID. See Log.Delta for when a full sync is required.
+func (v *VersionLog) Delta(ctx context.Context, dID string, logID string, version uint64, limit int) (*Delta, error) {
+	cur, err := v.coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"d_id": dID}}},
+		{{Key: "$set", Value: bson.M{"logs": bson.M{"$filter": bson.M{
+			"input": "$logs",
+			"cond":  bson.M{"$gt": bson.A{"$$this.version", version}},
+		}}}}},
+	})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find version log changes failed", "dID", dID)
+	}
+	var logs []Log
+	if err := cur.All(ctx, &logs); err != nil {
+		return nil, errs.WrapMsg(err, "decode version log failed", "dID", dID)
+	}
+	log := &Log{DID: dID}
+	if len(logs) > 0 {
+		log = &logs[0]
+	}
+	return log.Delta(logID, version, limit), nil
+}
+
+// Delete removes the log of dID, e.g. when a user is deleted. Clients then do
+// a full sync because the next log gets a new ID.
+func (v *VersionLog) Delete(ctx context.Context, dID string) error {
+	if _, err := v.coll.DeleteOne(ctx, bson.M{"d_id": dID}); err != nil {
+		return errs.WrapMsg(err, "delete version log failed", "dID", dID)
+	}
+	return nil
+}
+
+func distinct(ids []string) []string {
+	seen := make(map[string]struct{}, len(ids))
+	res := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			res = append(res, id)
+		}
+	}
+	return res
+}
@@ -0,0 +1,133 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package versionlog
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLogDelta(t *testing.T) {
+	id := primitive.NewObjectID()
+	log := &Log{
+		ID:      id,
+		Version: 10,
+		Deleted: 4,
+		Logs: []Elem{
+			{EID: "a", State: StateInsert, Version: 5},
+			{EID: "b", State: StateDelete, Version: 7},
+			{EID: "c", State: StateUpdate, Version: 9},
+			{EID: "d", State: StateInsert, Version: 10},
+		},
+	}
+
+	d := log.Delta(id.Hex(), 6, 0)
+	assert.False(t, d.Full)
+	assert.Equal(t, id.Hex(), d.LogID)
+	assert.Equal(t, uint64(10), d.Version)
+	assert.Equal(t, []string{"d"}, d.Inserted())
+	assert.Equal(t, []string{"c"}, d.Updated())
+	assert.Equal(t, []string{"b"}, d.Deleted())
+
+	d = log.Delta(id.Hex(), 10, 0)
+	assert.False(t, d.Full)
+	assert.Empty(t, d.Changes)
+
+	d = log.Delta(id.Hex(), 4, 0)
+	assert.False(t, d.Full)
+	assert.Len(t, d.Changes, 4)
+
+	for name, d := range map[string]*Delta{
+		"trimmed":      log.Delta(id.Hex(), 3, 0),
+		"ahead":        log.Delta(id.Hex(), 11, 0),
+		"other log":    log.Delta(primitive.NewObjectID().Hex(), 6, 0),
+		"no log":       log.Delta("", 0, 0),
+		"over limit":   log.Delta(id.Hex(), 6, 2),
+		"malformed id": log.Delta("x", 6, 0),
+	} {
+		assert.True(t, d.Full, name)
+		assert.Empty(t, d.Changes, name)
+		assert.Equal(t, id.Hex(), d.LogID, name)
+	}
+
+	empty := &Log{}
+	assert.False(t, empty.Delta("", 0, 0).Full)
+	assert.True(t, empty.Delta(id.Hex(), 3, 0).Full)
+}
+
+func TestVersionLog(t *testing.T) {
+	ctx := context.Background()
+	v := New(containers.Mongo(t, "versionlog").GetDB().Collection("version_log"), Config{MaxLogs: 3})
+	require.NoError(t, v.EnsureIndexes(ctx))
+
+	cur, err := v.Current(ctx, "u1")
+	require.NoError(t, err)
+	assert.True(t, cur.ID.IsZero())
+
+	log, err := v.Incr(ctx, "u1", []string{"f1", "f2", "f1"}, StateInsert)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), log.Version)
+	logID := log.ID.Hex()
+
+	d, err := v.Delta(ctx, "u1", "", 0, 100)
+	require.NoError(t, err)
+	assert.True(t, d.Full)
+	assert.Equal(t, logID, d.LogID)
+
+	_, err = v.Incr(ctx, "u1", []string{"f1"}, StateDelete)
+	require.NoError(t, err)
+	d, err = v.Delta(ctx, "u1", logID, 1, 100)
+	require.NoError(t, err)
+	assert.False(t, d.Full)
+	assert.Equal(t, uint64(2), d.Version)
+	assert.Equal(t, []string{"f1"}, d.Deleted())
+
+	// f1's entry was replaced, so syncing from 0 sees its latest state only.
+	d, err = v.Delta(ctx, "u1", logID, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"f2"}, d.Inserted())
+	assert.Equal(t, []string{"f1"}, d.Deleted())
+
+	for i := 3; i <= 5; i++ {
+		_, err = v.Incr(ctx, "u1", []string{"g" + strconv.Itoa(i)}, StateUpdate)
+		require.NoError(t, err)
+	}
+	// Only MaxLogs entries are kept, so f2 (version 1) and f1 (version 2) were trimmed.
+	cur, err = v.Current(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), cur.Version)
+	assert.Equal(t, uint64(2), cur.Deleted)
+	d, err = v.Delta(ctx, "u1", logID, 1, 100)
+	require.NoError(t, err)
+	assert.True(t, d.Full)
+	d, err = v.Delta(ctx, "u1", logID, 2, 100)
+	require.NoError(t, err)
+	assert.False(t, d.Full)
+	assert.Equal(t, []string{"g3", "g4", "g5"}, d.Updated())
+
+	require.NoError(t, v.Delete(ctx, "u1"))
+	log, err = v.Incr(ctx, "u1", nil, StateUpdate)
+	require.NoError(t, err)
+	assert.NotEqual(t, logID, log.ID.Hex())
+	d, err = v.Delta(ctx, "u1", logID, 5, 100)
+	require.NoError(t, err)
+	assert.True(t, d.Full)
+}
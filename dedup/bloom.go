@@ -0,0 +1,74 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// bloom is a fixed size bloom filter safe for concurrent use.
+type bloom struct {
+	mu   sync.RWMutex
+	bits []uint64
+	m    uint64 // Number of bits.
+	k    uint64 // Number of hash functions.
+}
+
+// newBloom sizes a filter for n items at false positive rate p.
+func newBloom(n uint, p float64) *bloom {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloom{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+// hashes returns two hashes for double hashing.
+func hashes(s string) (uint64, uint64) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	h1 := h.Sum64()
+	h2 := h1>>33 | h1<<31
+	return h1, h2 | 1
+}
+
+func (b *bloom) add(s string) {
+	h1, h2 := hashes(s)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloom) has(s string) bool {
+	h1, h2 := hashes(s)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,168 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedup answers whether an ID, e.g. a clientMsgID, was already seen
+// within a time window, so gateways and consumers can drop client retries.
+// Redis is the shared authority: the first caller marks an ID with SET NX and
+// every later sighting extends its TTL, so an ID that keeps being retried
+// stays known. A local rotating bloom filter remembers the IDs this instance
+// marked and keeps duplicates detectable while Redis is unavailable.
+package dedup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config configures a Deduper.
+type Config struct {
+	Window    time.Duration // How long an ID is remembered after its last sighting, defaults to 5 minutes.
+	KeyPrefix string        // Defaults to "DEDUP:".
+	// ExpectedIDs sizes the local filter for the IDs marked per window,
+	// defaults to 1,000,000.
+	ExpectedIDs uint
+	// FalsePositiveRate of the local filter, defaults to 0.001. It only
+	// matters while Redis is unavailable or not configured.
+	FalsePositiveRate float64
+}
+
+// Deduper detects repeated IDs.
+type Deduper struct {
+	rdb  redis.UniversalClient
+	conf Config
+	now  func() time.Time
+
+	mu       sync.Mutex
+	current  *bloom
+	previous *bloom
+	rotated  time.Time
+}
+
+// New creates a Deduper. With a nil rdb it only uses the local filter, which
+// neither sees other instances nor is exact.
+func New(rdb redis.UniversalClient, conf Config) *Deduper {
+	if conf.Window <= 0 {
+		conf.Window = 5 * time.Minute
+	}
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = "DEDUP:"
+	}
+	if conf.ExpectedIDs == 0 {
+		conf.ExpectedIDs = 1000000
+	}
+	if conf.FalsePositiveRate <= 0 || conf.FalsePositiveRate >= 1 {
+		conf.FalsePositiveRate = 0.001
+	}
+	d := &Deduper{rdb: rdb, conf: conf, now: time.Now}
+	d.current = newBloom(conf.ExpectedIDs, conf.FalsePositiveRate)
+	d.previous = newBloom(conf.ExpectedIDs, conf.FalsePositiveRate)
+	d.rotated = d.now()
+	return d
+}
+
+// seenScript marks KEYS[1] for ARGV[1] milliseconds and returns 0, or
+// extends the TTL of an existing mark and returns 1.
+var seenScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], 1, 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// filters returns the local filters, rotating them once per window so IDs
+// are remembered locally for one to two windows.
+func (d *Deduper) filters() (*bloom, *bloom) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	if elapsed := now.Sub(d.rotated); elapsed >= d.conf.Window {
+		if elapsed >= 2*d.conf.Window {
+			d.previous = newBloom(d.conf.ExpectedIDs, d.conf.FalsePositiveRate)
+		} else {
+			d.previous = d.current
+		}
+		d.current = newBloom(d.conf.ExpectedIDs, d.conf.FalsePositiveRate)
+		d.rotated = now
+	}
+	return d.current, d.previous
+}
+
+func (d *Deduper) local(id string) bool {
+	current, previous := d.filters()
+	seen := current.has(id) || previous.has(id)
+	current.add(id)
+	return seen
+}
+
+// Seen marks id and reports whether it was seen within the window before.
+// When Redis fails, the local answer is returned together with the error;
+// callers may act on it, accepting that it is approximate.
+func (d *Deduper) Seen(ctx context.Context, id string) (bool, error) {
+	localSeen := d.local(id)
+	if d.rdb == nil {
+		return localSeen, nil
+	}
+	res, err := seenScript.Run(ctx, d.rdb, []string{d.conf.KeyPrefix + id}, d.conf.Window.Milliseconds()).Int()
+	if err != nil {
+		return localSeen, errs.WrapMsg(err, "dedup mark failed", "id", id)
+	}
+	return res == 1, nil
+}
+
+// Filter returns the ids not seen before, in order, and marks all of them.
+// Repeats within ids count as seen. When Redis fails, the ids are filtered
+// by the local answer and the error is logged.
+func (d *Deduper) Filter(ctx context.Context, ids []string) []string {
+	res := make([]string, 0, len(ids))
+	if d.rdb == nil {
+		for _, id := range ids {
+			if !d.local(id) {
+				res = append(res, id)
+			}
+		}
+		return res
+	}
+	localSeen := make([]bool, len(ids))
+	for i, id := range ids {
+		localSeen[i] = d.local(id)
+	}
+	pipe := d.rdb.Pipeline()
+	cmds := make([]*redis.Cmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = seenScript.Eval(ctx, pipe, []string{d.conf.KeyPrefix + id}, d.conf.Window.Milliseconds())
+	}
+	_, err := pipe.Exec(ctx)
+	for i, id := range ids {
+		seen := localSeen[i]
+		if err == nil {
+			n, cmdErr := cmds[i].Int()
+			if cmdErr == nil {
+				seen = n == 1
+			}
+		}
+		if !seen {
+			res = append(res, id)
+		}
+	}
+	if err != nil {
+		log.ZWarn(ctx, "dedup filter failed, using local filter", err, "count", len(ids))
+	}
+	return res
+}
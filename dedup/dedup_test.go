@@ -0,0 +1,95 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloom(t *testing.T) {
+	b := newBloom(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		b.add("in" + strconv.Itoa(i))
+	}
+	for i := 0; i < 10000; i++ {
+		require.True(t, b.has("in"+strconv.Itoa(i)))
+	}
+	var fp int
+	for i := 0; i < 10000; i++ {
+		if b.has("out" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	assert.Less(t, fp, 300)
+}
+
+func TestLocal(t *testing.T) {
+	d := New(nil, Config{Window: time.Minute, ExpectedIDs: 1000})
+	now := time.Unix(1700000000, 0)
+	d.now = func() time.Time { return now }
+	d.rotated = now
+
+	ctx := context.Background()
+	seen, err := d.Seen(ctx, "m1")
+	require.NoError(t, err)
+	assert.False(t, seen)
+	seen, _ = d.Seen(ctx, "m1")
+	assert.True(t, seen)
+
+	// Remembered through one rotation, forgotten after the second.
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"m2"}, d.Filter(ctx, []string{"m1", "m2", "m2"}))
+	now = now.Add(time.Minute)
+	seen, _ = d.Seen(ctx, "m3")
+	assert.False(t, seen)
+	now = now.Add(2 * time.Minute)
+	seen, _ = d.Seen(ctx, "m2")
+	assert.False(t, seen)
+}
+
+func TestRedis(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	conf := Config{Window: time.Second, KeyPrefix: "DEDUP_TEST:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":"}
+	a, b := New(rdb, conf), New(rdb, conf)
+
+	seen, err := a.Seen(ctx, "m1")
+	require.NoError(t, err)
+	assert.False(t, seen)
+	// A retry reaching another instance is detected through Redis.
+	seen, err = b.Seen(ctx, "m1")
+	require.NoError(t, err)
+	assert.True(t, seen)
+
+	assert.Equal(t, []string{"m2", "m3"}, b.Filter(ctx, []string{"m1", "m2", "m3", "m2"}))
+
+	// Sightings extend the window.
+	time.Sleep(700 * time.Millisecond)
+	seen, _ = a.Seen(ctx, "m1")
+	assert.True(t, seen)
+	time.Sleep(700 * time.Millisecond)
+	seen, _ = b.Seen(ctx, "m1")
+	assert.True(t, seen)
+	time.Sleep(1200 * time.Millisecond)
+	seen, _ = New(rdb, conf).Seen(ctx, "m1")
+	assert.False(t, seen)
+}
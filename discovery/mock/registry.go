@@ -0,0 +1,210 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mock provides an in-memory discovery.SvcDiscoveryRegistry for unit tests.
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openimsdk/tools/discovery"
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc"
+)
+
+// Registration records a call to Register.
+type Registration struct {
+	ServiceName string
+	Host        string
+	Port        int
+}
+
+// Registry is an in-memory discovery registry. Connections are supplied by the test with SetConns;
+// keys set with SetKey are delivered to running WatchKey calls.
+type Registry struct {
+	lock          sync.RWMutex
+	conns         map[string][]grpc.ClientConnInterface
+	self          grpc.ClientConnInterface
+	kv            map[string][]byte
+	watchers      map[string]map[chan []byte]struct{}
+	registrations []Registration
+	options       []grpc.DialOption
+	gatewayHost   func(userID string) (string, error)
+	closed        bool
+}
+
+var _ discovery.SvcDiscoveryRegistry = (*Registry)(nil)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		conns:    make(map[string][]grpc.ClientConnInterface),
+		kv:       make(map[string][]byte),
+		watchers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// SetConns sets the connections returned for serviceName. Passing none removes the service.
+func (r *Registry) SetConns(serviceName string, conns ...grpc.ClientConnInterface) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(conns) == 0 {
+		delete(r.conns, serviceName)
+		return
+	}
+	r.conns[serviceName] = conns
+}
+
+// SetSelf sets the connection IsSelfNode reports as the local node.
+func (r *Registry) SetSelf(cc grpc.ClientConnInterface) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.self = cc
+}
+
+// SetGatewayHost sets the function used by GetUserIdHashGatewayHost.
+func (r *Registry) SetGatewayHost(fn func(userID string) (string, error)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.gatewayHost = fn
+}
+
+// Registrations returns the services registered so far.
+func (r *Registry) Registrations() []Registration {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]Registration(nil), r.registrations...)
+}
+
+// Options returns the dial options added with AddOption.
+func (r *Registry) Options() []grpc.DialOption {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return append([]grpc.DialOption(nil), r.options...)
+}
+
+func (r *Registry) Closed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.closed
+}
+
+func (r *Registry) GetConn(ctx context.Context, serviceName string, opts ...grpc.DialOption) (grpc.ClientConnInterface, error) {
+	conns, err := r.GetConns(ctx, serviceName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return conns[0], nil
+}
+
+func (r *Registry) GetConns(ctx context.Context, serviceName string, opts ...grpc.DialOption) ([]grpc.ClientConnInterface, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	conns, ok := r.conns[serviceName]
+	if !ok {
+		return nil, errs.New("service not found", "serviceName", serviceName).Wrap()
+	}
+	return append([]grpc.ClientConnInterface(nil), conns...), nil
+}
+
+func (r *Registry) IsSelfNode(cc grpc.ClientConnInterface) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.self != nil && r.self == cc
+}
+
+func (r *Registry) SetKey(ctx context.Context, key string, value []byte) error {
+	tmp := append([]byte(nil), value...)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.kv[key] = tmp
+	for ch := range r.watchers[key] {
+		select {
+		case ch <- tmp:
+		default:
+			// The watcher is busy with a previous value; drop the oldest pending one.
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- tmp
+		}
+	}
+	return nil
+}
+
+func (r *Registry) GetKey(ctx context.Context, key string) ([]byte, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	v, ok := r.kv[key]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// WatchKey blocks until ctx is done or fn returns an error, invoking fn for every SetKey on key.
+func (r *Registry) WatchKey(ctx context.Context, key string, fn discovery.WatchKeyHandler) error {
+	ch := make(chan []byte, 1)
+	r.lock.Lock()
+	if r.watchers[key] == nil {
+		r.watchers[key] = make(map[chan []byte]struct{})
+	}
+	r.watchers[key][ch] = struct{}{}
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.watchers[key], ch)
+		r.lock.Unlock()
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case v := <-ch:
+			if err := fn(&discovery.WatchKey{Value: v}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *Registry) AddOption(opts ...grpc.DialOption) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.options = append(r.options, opts...)
+}
+
+func (r *Registry) Register(ctx context.Context, serviceName, host string, port int, opts ...grpc.DialOption) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.registrations = append(r.registrations, Registration{ServiceName: serviceName, Host: host, Port: port})
+	return nil
+}
+
+func (r *Registry) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.closed = true
+}
+
+func (r *Registry) GetUserIdHashGatewayHost(ctx context.Context, userId string) (string, error) {
+	r.lock.RLock()
+	fn := r.gatewayHost
+	r.lock.RUnlock()
+	if fn == nil {
+		return "", nil
+	}
+	return fn(userId)
+}
@@ -0,0 +1,81 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/discovery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type fakeConn struct {
+	grpc.ClientConnInterface
+	name string
+}
+
+func TestRegistryConns(t *testing.T) {
+	ctx := context.Background()
+	r := NewRegistry()
+	_, err := r.GetConn(ctx, "user")
+	assert.Error(t, err)
+
+	a, b := &fakeConn{name: "a"}, &fakeConn{name: "b"}
+	r.SetConns("user", a, b)
+	r.SetSelf(b)
+	conn, err := r.GetConn(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, a, conn)
+	conns, err := r.GetConns(ctx, "user")
+	require.NoError(t, err)
+	assert.Len(t, conns, 2)
+	assert.True(t, r.IsSelfNode(b))
+	assert.False(t, r.IsSelfNode(a))
+
+	require.NoError(t, r.Register(ctx, "msg", "127.0.0.1", 10300))
+	assert.Equal(t, []Registration{{ServiceName: "msg", Host: "127.0.0.1", Port: 10300}}, r.Registrations())
+}
+
+func TestRegistryWatchKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRegistry()
+	got := make(chan string, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.WatchKey(ctx, "config", func(data *discovery.WatchKey) error {
+			got <- string(data.Value)
+			return nil
+		})
+	}()
+	require.Eventually(t, func() bool {
+		r.lock.RLock()
+		defer r.lock.RUnlock()
+		return len(r.watchers["config"]) == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, r.SetKey(ctx, "config", []byte("v1")))
+	assert.Equal(t, "v1", <-got)
+	v, err := r.GetKey(ctx, "config")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(v))
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,463 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dynamicconfig serves runtime flags stored in etcd, or any other
+// kvstore, next to the file based config loader. Values are validated against
+// the declared flags, cached on disk so a service starts with the last known
+// values while etcd is unreachable, and pushed to subscribers on change.
+package dynamicconfig
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/kvstore"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/atomicvalue"
+)
+
+// Kind is the type of a flag value.
+type Kind int
+
+const (
+	String Kind = iota
+	Int
+	Float
+	Bool
+	Duration
+	JSON
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Int:
+		return "int"
+	case Float:
+		return "float"
+	case Bool:
+		return "bool"
+	case Duration:
+		return "duration"
+	case JSON:
+		return "json"
+	default:
+		return "string"
+	}
+}
+
+// Flag declares a key and the schema its values must satisfy. Keys not
+// declared are ignored.
+type Flag struct {
+	Key     string
+	Kind    Kind
+	Default string // Raw default value, parsed like stored values.
+	// Enum restricts the raw value to one of the listed ones.
+	Enum []string
+	// Min and Max bound Int, Float and Duration values when not nil.
+	Min, Max *float64
+	// Validate checks the parsed value: a string, int64, float64, bool,
+	// time.Duration or json.RawMessage depending on Kind.
+	Validate func(value any) error
+}
+
+func (f *Flag) parse(raw string) (any, error) {
+	if len(f.Enum) > 0 && !slices.Contains(f.Enum, raw) {
+		return nil, errs.ErrArgs.WrapMsg("value not in enum", "key", f.Key, "value", raw, "enum", f.Enum)
+	}
+	var (
+		v   any
+		num float64
+		err error
+	)
+	switch f.Kind {
+	case String:
+		v = raw
+	case Int:
+		var n int64
+		n, err = strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		v, num = n, float64(n)
+	case Float:
+		num, err = strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		v = num
+	case Bool:
+		v, err = strconv.ParseBool(strings.TrimSpace(raw))
+	case Duration:
+		var d time.Duration
+		d, err = time.ParseDuration(strings.TrimSpace(raw))
+		v, num = d, d.Seconds()
+	case JSON:
+		if !json.Valid([]byte(raw)) {
+			err = errs.New("invalid json")
+		}
+		v = json.RawMessage(raw)
+	default:
+		err = errs.New("unknown kind")
+	}
+	if err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid value", "key", f.Key, "kind", f.Kind.String(), "value", raw, "cause", err.Error())
+	}
+	if f.Kind == Int || f.Kind == Float || f.Kind == Duration {
+		// Duration bounds are in seconds.
+		if f.Min != nil && num < *f.Min {
+			return nil, errs.ErrArgs.WrapMsg("value below minimum", "key", f.Key, "value", raw, "min", *f.Min)
+		}
+		if f.Max != nil && num > *f.Max {
+			return nil, errs.ErrArgs.WrapMsg("value above maximum", "key", f.Key, "value", raw, "max", *f.Max)
+		}
+	}
+	if f.Validate != nil {
+		if err := f.Validate(v); err != nil {
+			return nil, errs.WrapMsg(err, "value rejected", "key", f.Key, "value", raw)
+		}
+	}
+	return v, nil
+}
+
+// Bound returns a pointer to v for Flag.Min and Flag.Max.
+func Bound(v float64) *float64 {
+	return &v
+}
+
+// Source tells where the current values were loaded from.
+type Source int
+
+const (
+	SourceDefault Source = iota // Neither the store nor the cache was available.
+	SourceCache                 // The store was unreachable, values come from the cache file.
+	SourceStore                 // Values come from the store.
+)
+
+// Config configures a Client.
+type Config struct {
+	Store  kvstore.Store // Required, e.g. kvstore.NewEtcd.
+	Prefix string        // Prefix of the keys in the store, defaults to "config/".
+	Flags  []Flag
+	// CacheFile keeps the last values loaded from the store. Empty disables
+	// the cache.
+	CacheFile string
+	// LoadTimeout bounds the initial load from the store, defaults to 5s.
+	LoadTimeout time.Duration
+	// RetryInterval is how often Run retries an unreachable store, defaults
+	// to 5s.
+	RetryInterval time.Duration
+}
+
+type value struct {
+	raw    string
+	parsed any
+}
+
+// Client serves the flag values.
+type Client struct {
+	conf  Config
+	flags map[string]*Flag
+	// values and source are replaced as a whole, so reads never lock.
+	values atomicvalue.Value[map[string]value]
+	source atomicvalue.Value[Source]
+	mu     sync.Mutex // Guards writes and subs.
+	subs   map[string]map[int]func(old, new any)
+	nextID int
+}
+
+// New creates a Client and loads the values from the store, falling back
+// to the cache file and then to the defaults. Invalid defaults are an error.
+func New(ctx context.Context, conf Config) (*Client, error) {
+	if conf.Store == nil {
+		return nil, errs.ErrArgs.WrapMsg("dynamic config store is nil")
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "config/"
+	}
+	if conf.LoadTimeout <= 0 {
+		conf.LoadTimeout = 5 * time.Second
+	}
+	if conf.RetryInterval <= 0 {
+		conf.RetryInterval = 5 * time.Second
+	}
+	c := &Client{
+		conf:  conf,
+		flags: make(map[string]*Flag, len(conf.Flags)),
+		subs:  make(map[string]map[int]func(old, new any)),
+	}
+	values := make(map[string]value, len(conf.Flags))
+	for i := range conf.Flags {
+		f := &conf.Flags[i]
+		if _, ok := c.flags[f.Key]; ok {
+			return nil, errs.ErrArgs.WrapMsg("duplicate dynamic config flag", "key", f.Key)
+		}
+		v, err := f.parse(f.Default)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "invalid dynamic config default", "key", f.Key)
+		}
+		c.flags[f.Key] = f
+		values[f.Key] = value{raw: f.Default, parsed: v}
+	}
+	c.values.Store(values)
+	lctx, cancel := context.WithTimeout(ctx, conf.LoadTimeout)
+	defer cancel()
+	if err := c.load(lctx); err != nil {
+		log.ZWarn(ctx, "dynamic config store unavailable, using cache", err, "prefix", conf.Prefix)
+		raws, err := c.readCache()
+		if err != nil {
+			log.ZWarn(ctx, "dynamic config cache unavailable, using defaults", err, "file", conf.CacheFile)
+			return c, nil
+		}
+		c.replace(ctx, raws, SourceCache)
+	}
+	return c, nil
+}
+
+// Source returns where the current values were loaded from.
+func (c *Client) Source() Source {
+	return c.source.Load()
+}
+
+// load reads all values from the store.
+func (c *Client) load(ctx context.Context) error {
+	entries, err := c.conf.Store.List(ctx, c.conf.Prefix)
+	if err != nil {
+		return err
+	}
+	raws := make(map[string]string, len(entries))
+	for _, e := range entries {
+		raws[strings.TrimPrefix(e.Key, c.conf.Prefix)] = string(e.Value)
+	}
+	c.replace(ctx, raws, SourceStore)
+	c.writeCache(ctx)
+	return nil
+}
+
+// replace sets every flag to its value in raws or to its default.
+func (c *Client) replace(ctx context.Context, raws map[string]string, source Source) {
+	c.source.Store(source)
+	for key, f := range c.flags {
+		raw, ok := raws[key]
+		if !ok {
+			raw = f.Default
+		}
+		c.set(ctx, key, raw)
+	}
+}
+
+// set validates and stores one raw value, notifying the subscribers. Invalid
+// values are logged and keep the previous value.
+func (c *Client) set(ctx context.Context, key, raw string) bool {
+	f, ok := c.flags[key]
+	if !ok {
+		return false
+	}
+	parsed, err := f.parse(raw)
+	if err != nil {
+		log.ZWarn(ctx, "dynamic config value rejected", err, "key", key)
+		return false
+	}
+	c.mu.Lock()
+	values := c.values.Load()
+	old := values[key]
+	if old.raw == raw {
+		c.mu.Unlock()
+		return false
+	}
+	values = maps.Clone(values)
+	values[key] = value{raw: raw, parsed: parsed}
+	c.values.Store(values)
+	subs := make([]func(old, new any), 0, len(c.subs[key]))
+	for _, fn := range c.subs[key] {
+		subs = append(subs, fn)
+	}
+	c.mu.Unlock()
+	log.ZInfo(ctx, "dynamic config changed", "key", key, "value", raw)
+	for _, fn := range subs {
+		fn(old.parsed, parsed)
+	}
+	return true
+}
+
+// Run follows the store until ctx is done, retrying while it is unreachable.
+func (c *Client) Run(ctx context.Context) error {
+	for {
+		err := c.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.ZWarn(ctx, "dynamic config watch failed", err, "prefix", c.conf.Prefix)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.conf.RetryInterval):
+		}
+	}
+}
+
+func (c *Client) watch(ctx context.Context) error {
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := c.conf.Store.Watch(wctx, c.conf.Prefix)
+	if err != nil {
+		return err
+	}
+	// Catch up with changes made before the watch started.
+	if err := c.load(wctx); err != nil {
+		return err
+	}
+	for ev := range events {
+		key := strings.TrimPrefix(ev.Key, c.conf.Prefix)
+		f, ok := c.flags[key]
+		if !ok {
+			continue
+		}
+		raw := f.Default
+		if ev.Type == kvstore.EventPut {
+			raw = string(ev.Value)
+		}
+		if c.set(ctx, key, raw) {
+			c.writeCache(ctx)
+		}
+	}
+	return errs.New("dynamic config watch closed").Wrap()
+}
+
+func (c *Client) readCache() (map[string]string, error) {
+	if c.conf.CacheFile == "" {
+		return nil, errs.New("no cache file configured").Wrap()
+	}
+	data, err := os.ReadFile(c.conf.CacheFile)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "read dynamic config cache failed", "file", c.conf.CacheFile)
+	}
+	var raws map[string]string
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, errs.WrapMsg(err, "decode dynamic config cache failed", "file", c.conf.CacheFile)
+	}
+	return raws, nil
+}
+
+// writeCache replaces the cache file with the current values.
+func (c *Client) writeCache(ctx context.Context) {
+	if c.conf.CacheFile == "" {
+		return
+	}
+	values := c.values.Load()
+	raws := make(map[string]string, len(values))
+	for key, v := range values {
+		raws[key] = v.raw
+	}
+	if err := writeFile(c.conf.CacheFile, raws); err != nil {
+		log.ZWarn(ctx, "write dynamic config cache failed", err, "file", c.conf.CacheFile)
+	}
+}
+
+func writeFile(name string, raws map[string]string) error {
+	data, err := json.MarshalIndent(raws, "", "  ")
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errs.Wrap(err)
+	}
+	tmp, err := os.CreateTemp(dir, ".dynamicconfig-*")
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errs.Wrap(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errs.Wrap(err)
+	}
+	return errs.Wrap(os.Rename(tmp.Name(), name))
+}
+
+// Subscribe calls fn with the old and new parsed value whenever key changes,
+// until the returned function is called.
+func (c *Client) Subscribe(key string, fn func(old, new any)) (cancel func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	id := c.nextID
+	if c.subs[key] == nil {
+		c.subs[key] = make(map[int]func(old, new any))
+	}
+	c.subs[key][id] = fn
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.subs[key], id)
+	}
+}
+
+// Value returns the parsed value of key, or false if the key is not declared.
+func (c *Client) Value(key string) (any, bool) {
+	v, ok := c.values.Load()[key]
+	return v.parsed, ok
+}
+
+// Raw returns the raw value of key.
+func (c *Client) Raw(key string) string {
+	return c.values.Load()[key].raw
+}
+
+func get[T any](c *Client, key string) T {
+	v, _ := c.Value(key)
+	t, _ := v.(T)
+	return t
+}
+
+// String returns the value of a String flag.
+func (c *Client) String(key string) string {
+	return get[string](c, key)
+}
+
+// Int returns the value of an Int flag.
+func (c *Client) Int(key string) int64 {
+	return get[int64](c, key)
+}
+
+// Float returns the value of a Float flag.
+func (c *Client) Float(key string) float64 {
+	return get[float64](c, key)
+}
+
+// Bool returns the value of a Bool flag.
+func (c *Client) Bool(key string) bool {
+	return get[bool](c, key)
+}
+
+// Duration returns the value of a Duration flag.
+func (c *Client) Duration(key string) time.Duration {
+	return get[time.Duration](c, key)
+}
+
+// JSON decodes the value of a JSON flag into out.
+func (c *Client) JSON(key string, out any) error {
+	if f, ok := c.flags[key]; !ok || f.Kind != JSON {
+		return errs.ErrArgs.WrapMsg("not a json flag", "key", key)
+	}
+	if err := json.Unmarshal(get[json.RawMessage](c, key), out); err != nil {
+		return errs.WrapMsg(err, "decode dynamic config failed", "key", key)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dynamicconfig
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// downStore fails every call while down is set.
+type downStore struct {
+	kvstore.Store
+	down atomic.Bool
+}
+
+var errDown = errors.New("store down")
+
+func (s *downStore) List(ctx context.Context, prefix string) ([]*kvstore.Entry, error) {
+	if s.down.Load() {
+		return nil, errDown
+	}
+	return s.Store.List(ctx, prefix)
+}
+
+func (s *downStore) Watch(ctx context.Context, prefix string) (<-chan kvstore.Event, error) {
+	if s.down.Load() {
+		return nil, errDown
+	}
+	return s.Store.Watch(ctx, prefix)
+}
+
+var flags = []Flag{
+	{Key: "push.enabled", Kind: Bool, Default: "true"},
+	{Key: "push.batch", Kind: Int, Default: "100", Min: Bound(1), Max: Bound(1000)},
+	{Key: "push.timeout", Kind: Duration, Default: "5s"},
+	{Key: "push.mode", Kind: String, Default: "online", Enum: []string{"online", "all"}},
+	{Key: "push.ratio", Kind: Float, Default: "0.5", Validate: func(v any) error {
+		if v.(float64) > 1 {
+			return errors.New("ratio above 1")
+		}
+		return nil
+	}},
+	{Key: "push.vendors", Kind: JSON, Default: `["fcm"]`},
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store := kvstore.NewMemory()
+	_, err := store.Set(ctx, "config/push.batch", []byte("200"), 0)
+	require.NoError(t, err)
+	_, err = store.Set(ctx, "config/unknown", []byte("x"), 0)
+	require.NoError(t, err)
+	cache := filepath.Join(t.TempDir(), "dynamic.json")
+
+	c, err := New(ctx, Config{Store: store, Flags: flags, CacheFile: cache, RetryInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, SourceStore, c.Source())
+	assert.True(t, c.Bool("push.enabled"))
+	assert.Equal(t, int64(200), c.Int("push.batch"))
+	assert.Equal(t, 5*time.Second, c.Duration("push.timeout"))
+	assert.Equal(t, "online", c.String("push.mode"))
+	assert.Equal(t, 0.5, c.Float("push.ratio"))
+	var vendors []string
+	require.NoError(t, c.JSON("push.vendors", &vendors))
+	assert.Equal(t, []string{"fcm"}, vendors)
+	assert.Error(t, c.JSON("push.mode", &vendors))
+	_, ok := c.Value("unknown")
+	assert.False(t, ok)
+
+	changed := make(chan [2]any, 10)
+	unsubscribe := c.Subscribe("push.batch", func(old, new any) { changed <- [2]any{old, new} })
+	go c.Run(ctx)
+
+	_, err = store.Set(ctx, "config/push.batch", []byte("300"), 0)
+	require.NoError(t, err)
+	select {
+	case got := <-changed:
+		assert.Equal(t, [2]any{int64(200), int64(300)}, got)
+	case <-time.After(time.Second):
+		t.Fatal("no change")
+	}
+
+	// Invalid values are rejected and keep the previous one.
+	for key, raw := range map[string]string{
+		"push.batch": "5000", "push.mode": "none", "push.ratio": "2", "push.enabled": "maybe", "push.vendors": "[",
+	} {
+		_, err = store.Set(ctx, "config/"+key, []byte(raw), 0)
+		require.NoError(t, err)
+	}
+	_, err = store.Set(ctx, "config/push.timeout", []byte("10s"), 0)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return c.Duration("push.timeout") == 10*time.Second }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int64(300), c.Int("push.batch"))
+	assert.Equal(t, "online", c.String("push.mode"))
+	assert.Equal(t, 0.5, c.Float("push.ratio"))
+	assert.True(t, c.Bool("push.enabled"))
+
+	// Deleting a key restores the default.
+	unsubscribe()
+	require.NoError(t, store.Delete(ctx, "config/push.batch"))
+	require.Eventually(t, func() bool { return c.Int("push.batch") == 100 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, changed)
+
+	// Starting while the store is down uses the cache.
+	down := &downStore{Store: store}
+	down.down.Store(true)
+	cached, err := New(ctx, Config{Store: down, Flags: flags, CacheFile: cache, RetryInterval: 20 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal(t, SourceCache, cached.Source())
+	assert.Equal(t, 10*time.Second, cached.Duration("push.timeout"))
+	assert.Equal(t, int64(100), cached.Int("push.batch"))
+
+	// Run catches up once the store is back.
+	go cached.Run(ctx)
+	_, err = store.Set(ctx, "config/push.mode", []byte("all"), 0)
+	require.NoError(t, err)
+	down.down.Store(false)
+	require.Eventually(t, func() bool { return cached.String("push.mode") == "all" }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, SourceStore, cached.Source())
+
+	// Without store and cache the defaults apply.
+	down.down.Store(true)
+	defaults, err := New(ctx, Config{Store: down, Flags: flags, CacheFile: filepath.Join(t.TempDir(), "missing.json")})
+	require.NoError(t, err)
+	assert.Equal(t, SourceDefault, defaults.Source())
+	assert.Equal(t, "online", defaults.String("push.mode"))
+	assert.Equal(t, 5*time.Second, defaults.Duration("push.timeout"))
+}
+
+func TestInvalidDefault(t *testing.T) {
+	_, err := New(context.Background(), Config{Store: kvstore.NewMemory(), Flags: []Flag{{Key: "n", Kind: Int, Default: "x"}}})
+	assert.Error(t, err)
+	_, err = New(context.Background(), Config{Store: kvstore.NewMemory(), Flags: []Flag{{Key: "n"}, {Key: "n"}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,256 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// NewEtcdBackend returns a Backend keeping leader keys under prefix,
+// "election/" when empty. A term is a lease the key is attached to and its
+// fencing token is the revision the key was created at.
+func NewEtcdBackend(cli *clientv3.Client, prefix string) Backend {
+	if prefix == "" {
+		prefix = "election/"
+	}
+	return &etcdBackend{cli: cli, prefix: prefix, leases: make(map[int64]clientv3.LeaseID)}
+}
+
+type etcdBackend struct {
+	cli    *clientv3.Client
+	prefix string
+	mu     sync.Mutex
+	leases map[int64]clientv3.LeaseID // Lease of every held token.
+}
+
+func ttlSeconds(ttl time.Duration) int64 {
+	return max(int64((ttl+time.Second-1)/time.Second), 1)
+}
+
+func (b *etcdBackend) Acquire(ctx context.Context, key, id string, ttl time.Duration) (int64, string, error) {
+	lease, err := b.cli.Grant(ctx, ttlSeconds(ttl))
+	if err != nil {
+		return 0, "", errs.WrapMsg(err, "etcd grant lease failed", "key", key)
+	}
+	k := b.prefix + key
+	resp, err := b.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(k), "=", 0)).
+		Then(clientv3.OpPut(k, id, clientv3.WithLease(lease.ID))).
+		Else(clientv3.OpGet(k)).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		_, _ = b.cli.Revoke(context.WithoutCancel(ctx), lease.ID)
+	}
+	if err != nil {
+		return 0, "", errs.WrapMsg(err, "etcd txn failed", "key", key)
+	}
+	if !resp.Succeeded {
+		var leader string
+		if kvs := resp.Responses[0].GetResponseRange().GetKvs(); len(kvs) > 0 {
+			leader = string(kvs[0].Value)
+		}
+		return 0, leader, nil
+	}
+	token := resp.Header.Revision
+	b.mu.Lock()
+	b.leases[token] = lease.ID
+	b.mu.Unlock()
+	return token, id, nil
+}
+
+func (b *etcdBackend) lease(token int64) (clientv3.LeaseID, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lease, ok := b.leases[token]
+	return lease, ok
+}
+
+func (b *etcdBackend) Renew(ctx context.Context, key, id string, token int64, ttl time.Duration) (bool, error) {
+	lease, ok := b.lease(token)
+	if !ok {
+		return false, nil
+	}
+	if _, err := b.cli.KeepAliveOnce(ctx, lease); err != nil {
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			b.mu.Lock()
+			delete(b.leases, token)
+			b.mu.Unlock()
+			return false, nil
+		}
+		return false, errs.WrapMsg(err, "etcd keep alive failed", "key", key)
+	}
+	resp, err := b.cli.Get(ctx, b.prefix+key)
+	if err != nil {
+		return false, errs.WrapMsg(err, "etcd get failed", "key", key)
+	}
+	return len(resp.Kvs) > 0 && resp.Kvs[0].CreateRevision == token, nil
+}
+
+func (b *etcdBackend) Release(ctx context.Context, key, id string, token int64) error {
+	lease, ok := b.lease(token)
+	if !ok {
+		return nil
+	}
+	b.mu.Lock()
+	delete(b.leases, token)
+	b.mu.Unlock()
+	// Revoking the lease deletes the key attached to it.
+	if _, err := b.cli.Revoke(ctx, lease); err != nil {
+		return errs.WrapMsg(err, "etcd revoke lease failed", "key", key)
+	}
+	return nil
+}
+
+// acquireScript sets the lock to "token:id" unless it is held and returns
+// the new token, or 0 and the current value. KEYS[2] counts the terms.
+var acquireScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	return {0, cur}
+end
+local token = redis.call('INCR', KEYS[2])
+redis.call('SET', KEYS[1], token .. ':' .. ARGV[1], 'PX', ARGV[2])
+return {token, ''}
+`)
+
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// NewRedisBackend returns a Backend using locks under keyPrefix, "ELECTION:"
+// when empty. The fencing token counter of a key shares its hash slot, so it
+// works on Redis Cluster; the counter never expires, keeping tokens
+// increasing across terms.
+func NewRedisBackend(rdb redis.UniversalClient, keyPrefix string) Backend {
+	if keyPrefix == "" {
+		keyPrefix = "ELECTION:"
+	}
+	return &redisBackend{rdb: rdb, prefix: keyPrefix}
+}
+
+type redisBackend struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func (b *redisBackend) lockKey(key string) string {
+	return b.prefix + "{" + key + "}"
+}
+
+func lockValue(id string, token int64) string {
+	return strconv.FormatInt(token, 10) + ":" + id
+}
+
+func (b *redisBackend) Acquire(ctx context.Context, key, id string, ttl time.Duration) (int64, string, error) {
+	lock := b.lockKey(key)
+	res, err := acquireScript.Run(ctx, b.rdb, []string{lock, lock + ":TOKEN"}, id, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return 0, "", errs.WrapMsg(err, "redis acquire failed", "key", key)
+	}
+	token, _ := res[0].(int64)
+	if token != 0 {
+		return token, id, nil
+	}
+	cur, _ := res[1].(string)
+	_, leader, _ := strings.Cut(cur, ":")
+	return 0, leader, nil
+}
+
+func (b *redisBackend) Renew(ctx context.Context, key, id string, token int64, ttl time.Duration) (bool, error) {
+	n, err := renewScript.Run(ctx, b.rdb, []string{b.lockKey(key)}, lockValue(id, token), ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, errs.WrapMsg(err, "redis renew failed", "key", key)
+	}
+	return n == 1, nil
+}
+
+func (b *redisBackend) Release(ctx context.Context, key, id string, token int64) error {
+	if err := releaseScript.Run(ctx, b.rdb, []string{b.lockKey(key)}, lockValue(id, token)).Err(); err != nil {
+		return errs.WrapMsg(err, "redis release failed", "key", key)
+	}
+	return nil
+}
+
+// NewMemoryBackend returns a Backend for candidates of one process, for
+// tests and standalone deployments.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{terms: make(map[string]memoryTerm)}
+}
+
+type memoryTerm struct {
+	id      string
+	token   int64
+	expires time.Time
+}
+
+type memoryBackend struct {
+	mu    sync.Mutex
+	token int64
+	terms map[string]memoryTerm
+}
+
+func (b *memoryBackend) Acquire(ctx context.Context, key, id string, ttl time.Duration) (int64, string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	if t, ok := b.terms[key]; ok && now.Before(t.expires) {
+		return 0, t.id, nil
+	}
+	b.token++
+	b.terms[key] = memoryTerm{id: id, token: b.token, expires: now.Add(ttl)}
+	return b.token, id, nil
+}
+
+func (b *memoryBackend) Renew(ctx context.Context, key, id string, token int64, ttl time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	t, ok := b.terms[key]
+	if !ok || t.token != token || !now.Before(t.expires) {
+		return false, nil
+	}
+	t.expires = now.Add(ttl)
+	b.terms[key] = t
+	return true, nil
+}
+
+func (b *memoryBackend) Release(ctx context.Context, key, id string, token int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.terms[key]; ok && t.token == token {
+		delete(b.terms, key)
+	}
+	return nil
+}
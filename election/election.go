@@ -0,0 +1,258 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election elects one leader among the instances campaigning for a
+// key, e.g. to run singleton cron tasks or the outbox relay on one node only.
+// Leadership is held with an etcd lease or a Redis lock that is renewed in
+// the background; when the leader stops renewing, another candidate takes
+// over. Every term carries a fencing token that increases with every new
+// leader, so writes of a deposed leader that is still running can be
+// rejected by the storage they target.
+package election
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// Backend holds the leadership of keys.
+type Backend interface {
+	// Acquire takes key for id unless another candidate holds it. It returns
+	// the fencing token of the new term, or zero and the current leader.
+	Acquire(ctx context.Context, key, id string, ttl time.Duration) (token int64, leader string, err error)
+	// Renew extends the term of token, returning false once it was lost.
+	Renew(ctx context.Context, key, id string, token int64, ttl time.Duration) (bool, error)
+	// Release ends the term of token if it is still held.
+	Release(ctx context.Context, key, id string, token int64) error
+}
+
+// Options configures a campaign.
+type Options struct {
+	Backend Backend // Required.
+	// ID identifies the candidate, defaults to hostname and pid.
+	ID string
+	// TTL is how long a term lasts without renewal, defaults to 10 seconds.
+	// It bounds how long a crashed leader blocks the others.
+	TTL time.Duration
+	// RetryInterval is how often followers try to take over, defaults to a
+	// third of TTL. The leader renews its term at the same interval.
+	RetryInterval time.Duration
+	// OnElected is called in its own goroutine when the candidate becomes the
+	// leader. ctx is canceled when the term ends and OnElected must return
+	// soon after; the next term does not start before it did.
+	OnElected func(ctx context.Context, token int64)
+	// OnLeaderChange is called with the ID of every newly observed leader,
+	// the candidate itself included, and with "" when the leader is unknown.
+	OnLeaderChange func(leader string)
+}
+
+// Election is a running campaign.
+type Election struct {
+	key    string
+	opts   Options
+	mu     sync.Mutex
+	leader string
+	token  int64 // Token of the current term of this candidate, zero if follower.
+	resign chan struct{}
+	done   chan struct{}
+}
+
+// Campaign runs for the leadership of key until ctx is done, then releases
+// it. Lost terms are followed by new campaigns.
+func Campaign(ctx context.Context, key string, opts Options) (*Election, error) {
+	if key == "" {
+		return nil, errs.ErrArgs.WrapMsg("election key is empty")
+	}
+	if opts.Backend == nil {
+		return nil, errs.ErrArgs.WrapMsg("election backend is nil", "key", key)
+	}
+	if opts.ID == "" {
+		host, _ := os.Hostname()
+		opts.ID = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 10 * time.Second
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = opts.TTL / 3
+	}
+	e := &Election{key: key, opts: opts, resign: make(chan struct{}, 1), done: make(chan struct{})}
+	go e.run(ctx)
+	return e, nil
+}
+
+// ID returns the ID of the candidate.
+func (e *Election) ID() string {
+	return e.opts.ID
+}
+
+// IsLeader reports whether the candidate holds the leadership.
+func (e *Election) IsLeader() bool {
+	_, ok := e.Token()
+	return ok
+}
+
+// Token returns the fencing token of the current term, or false when the
+// candidate is not the leader.
+func (e *Election) Token() (int64, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.token, e.token != 0
+}
+
+// Leader returns the ID of the last observed leader, "" if unknown.
+func (e *Election) Leader() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+// Resign ends the current term, if any, and lets the others take over. The
+// candidate campaigns again after TTL.
+func (e *Election) Resign() {
+	select {
+	case e.resign <- struct{}{}:
+	default:
+	}
+}
+
+// Done is closed once the campaign stopped after ctx was done.
+func (e *Election) Done() <-chan struct{} {
+	return e.done
+}
+
+func (e *Election) setLeader(leader string) {
+	e.mu.Lock()
+	changed := e.leader != leader
+	e.leader = leader
+	e.mu.Unlock()
+	if changed {
+		if leader == "" {
+			log.ZInfo(context.Background(), "election leader unknown", "key", e.key, "id", e.opts.ID)
+		} else {
+			log.ZInfo(context.Background(), "election leader changed", "key", e.key, "id", e.opts.ID, "leader", leader)
+		}
+		if e.opts.OnLeaderChange != nil {
+			e.opts.OnLeaderChange(leader)
+		}
+	}
+}
+
+func (e *Election) run(ctx context.Context) {
+	defer close(e.done)
+	for {
+		token, leader, err := e.opts.Backend.Acquire(ctx, e.key, e.opts.ID, e.opts.TTL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.ZWarn(ctx, "election acquire failed", err, "key", e.key, "id", e.opts.ID)
+		} else if token != 0 {
+			if !e.lead(ctx, token) {
+				continue
+			}
+			// Resigned, give the other candidates time to take over.
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.opts.TTL):
+			}
+			continue
+		} else {
+			e.setLeader(leader)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.resign:
+			// Not the leader, nothing to resign.
+		case <-time.After(e.opts.RetryInterval):
+		}
+	}
+}
+
+// lead holds the term of token until it is lost, resigned or ctx is done,
+// and reports whether it was resigned.
+func (e *Election) lead(ctx context.Context, token int64) bool {
+	e.mu.Lock()
+	e.token = token
+	e.mu.Unlock()
+	e.setLeader(e.opts.ID)
+	log.ZInfo(ctx, "election won", "key", e.key, "id", e.opts.ID, "token", token)
+
+	termCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	if e.opts.OnElected != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.opts.OnElected(termCtx, token)
+		}()
+	}
+	resigned, release := e.hold(ctx, token)
+	cancel()
+	wg.Wait()
+	e.mu.Lock()
+	e.token = 0
+	e.mu.Unlock()
+	if release {
+		// Release with a fresh context, ctx may already be done.
+		rctx, rcancel := context.WithTimeout(context.Background(), e.opts.RetryInterval)
+		if err := e.opts.Backend.Release(rctx, e.key, e.opts.ID, token); err != nil {
+			log.ZWarn(rctx, "election release failed", err, "key", e.key, "id", e.opts.ID, "token", token)
+		}
+		rcancel()
+	}
+	log.ZInfo(ctx, "election term ended", "key", e.key, "id", e.opts.ID, "token", token)
+	e.setLeader("")
+	return resigned
+}
+
+// hold renews the term of token and returns when it ends, whether it was
+// resigned and whether it is still held and must be released.
+func (e *Election) hold(ctx context.Context, token int64) (bool, bool) {
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return false, true
+		case <-e.resign:
+			return true, true
+		case <-time.After(e.opts.RetryInterval):
+		}
+		ok, err := e.opts.Backend.Renew(ctx, e.key, e.opts.ID, token, e.opts.TTL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, true
+			}
+			log.ZWarn(ctx, "election renew failed", err, "key", e.key, "id", e.opts.ID, "token", token)
+			// Step down before the term may expire at the backend.
+			if time.Since(renewed)+e.opts.RetryInterval >= e.opts.TTL {
+				return false, false
+			}
+			continue
+		}
+		if !ok {
+			log.ZWarn(ctx, "election term lost", nil, "key", e.key, "id", e.opts.ID, "token", token)
+			return false, false
+		}
+		renewed = time.Now()
+	}
+}
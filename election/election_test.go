@@ -0,0 +1,160 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu      sync.Mutex
+	tokens  []int64
+	leaders []string
+}
+
+func (r *recorder) options(b Backend, id string) Options {
+	return Options{
+		Backend:       b,
+		ID:            id,
+		TTL:           300 * time.Millisecond,
+		RetryInterval: 50 * time.Millisecond,
+		OnElected: func(ctx context.Context, token int64) {
+			r.mu.Lock()
+			r.tokens = append(r.tokens, token)
+			r.mu.Unlock()
+			<-ctx.Done()
+		},
+	}
+}
+
+func leaderOf(t *testing.T, es ...*Election) *Election {
+	t.Helper()
+	var leader *Election
+	require.Eventually(t, func() bool {
+		leader = nil
+		var n int
+		for _, e := range es {
+			if e.IsLeader() {
+				leader = e
+				n++
+			}
+		}
+		return n == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	return leader
+}
+
+func testBackend(t *testing.T, b Backend) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var r recorder
+	ctxA, cancelA := context.WithCancel(ctx)
+	a, err := Campaign(ctxA, "cron", r.options(b, "a"))
+	require.NoError(t, err)
+	first := leaderOf(t, a)
+	tokenA, _ := first.Token()
+
+	opts := r.options(b, "b")
+	opts.OnLeaderChange = func(leader string) {
+		r.mu.Lock()
+		r.leaders = append(r.leaders, leader)
+		r.mu.Unlock()
+	}
+	bb, err := Campaign(ctx, "cron", opts)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return bb.Leader() == "a" }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, bb.IsLeader())
+
+	// Resigning hands the leadership over, with a higher fencing token.
+	a.Resign()
+	leaderOf(t, a, bb)
+	require.Eventually(t, bb.IsLeader, 5*time.Second, 10*time.Millisecond)
+	tokenB, ok := bb.Token()
+	assert.True(t, ok)
+	assert.Greater(t, tokenB, tokenA)
+	require.Eventually(t, func() bool { return a.Leader() == "b" }, 5*time.Second, 10*time.Millisecond)
+
+	// Stopping the leader releases the term for the other candidate.
+	cancelA()
+	<-a.Done()
+	assert.False(t, a.IsLeader())
+
+	r.mu.Lock()
+	assert.Equal(t, []int64{tokenA, tokenB}, r.tokens)
+	assert.Equal(t, []string{"a", "b"}, r.leaders[:2])
+	r.mu.Unlock()
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemoryBackend())
+}
+
+func TestRedisBackend(t *testing.T) {
+	testBackend(t, NewRedisBackend(containers.Redis(t), "ELECTION_TEST:"))
+}
+
+func TestEtcdBackend(t *testing.T) {
+	testBackend(t, NewEtcdBackend(containers.Etcd(t, "openim").GetClient(), "election-test/"))
+}
+
+func TestTermLost(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	b := NewMemoryBackend()
+	ended := make(chan int64, 1)
+	opts := Options{
+		Backend:       b,
+		ID:            "a",
+		TTL:           200 * time.Millisecond,
+		RetryInterval: 50 * time.Millisecond,
+		OnElected: func(ctx context.Context, token int64) {
+			<-ctx.Done()
+			ended <- token
+		},
+	}
+	e, err := Campaign(ctx, "relay", opts)
+	require.NoError(t, err)
+	require.Eventually(t, e.IsLeader, time.Second, 10*time.Millisecond)
+	token, _ := e.Token()
+
+	// Another holder takes the key, e.g. after a network partition.
+	require.NoError(t, b.Release(ctx, "relay", "a", token))
+	other, _, err := b.Acquire(ctx, "relay", "b", time.Minute)
+	require.NoError(t, err)
+	assert.Greater(t, other, token)
+
+	select {
+	case got := <-ended:
+		assert.Equal(t, token, got)
+	case <-time.After(time.Second):
+		t.Fatal("term not ended")
+	}
+	require.Eventually(t, func() bool { return e.Leader() == "b" }, time.Second, 10*time.Millisecond)
+	assert.False(t, e.IsLeader())
+}
+
+func TestCampaignArgs(t *testing.T) {
+	_, err := Campaign(context.Background(), "", Options{Backend: NewMemoryBackend()})
+	assert.Error(t, err)
+	_, err = Campaign(context.Background(), "cron", Options{})
+	assert.Error(t, err)
+}
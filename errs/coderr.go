@@ -123,7 +123,7 @@ func WrapMsg(err error, msg string, kv ...any) error {
 	if err == nil {
 		return nil
 	}
-	err = NewErrorWrapper(err, toString(msg, kv))
+	err = &errorWrapper{error: err, s: toString(msg, kv), msg: msg, kv: kv}
 	return stack.New(err, stackSkip)
 }
 
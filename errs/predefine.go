@@ -2,11 +2,12 @@ package errs
 
 const (
 	// General error codes.
-	ServerInternalError = 500  // Server internal error
-	ArgsError           = 1001 // Input parameter error
-	NoPermissionError   = 1002 // Insufficient permission
-	DuplicateKeyError   = 1003
-	RecordNotFoundError = 1004 // Record does not exist
+	ServerInternalError         = 500  // Server internal error
+	ArgsError                   = 1001 // Input parameter error
+	NoPermissionError           = 1002 // Insufficient permission
+	DuplicateKeyError           = 1003
+	RecordNotFoundError         = 1004 // Record does not exist
+	ConcurrentModificationError = 1005 // Record changed since it was read
 
 	TokenExpiredError     = 1501
 	TokenInvalidError     = 1502
@@ -20,17 +21,18 @@ const (
 )
 
 var (
-	ErrArgs             = NewCodeError(ArgsError, "ArgsError")
-	ErrNoPermission     = NewCodeError(NoPermissionError, "NoPermissionError")
-	ErrInternalServer   = NewCodeError(ServerInternalError, "ServerInternalError")
-	ErrRecordNotFound   = NewCodeError(RecordNotFoundError, "RecordNotFoundError")
-	ErrDuplicateKey     = NewCodeError(DuplicateKeyError, "DuplicateKeyError")
-	ErrTokenExpired     = NewCodeError(TokenExpiredError, "TokenExpiredError")
-	ErrTokenInvalid     = NewCodeError(TokenInvalidError, "TokenInvalidError")
-	ErrTokenMalformed   = NewCodeError(TokenMalformedError, "TokenMalformedError")
-	ErrTokenNotValidYet = NewCodeError(TokenNotValidYetError, "TokenNotValidYetError")
-	ErrTokenUnknown     = NewCodeError(TokenUnknownError, "TokenUnknownError")
-	ErrTokenKicked      = NewCodeError(TokenKickedError, "TokenKickedError")
-	ErrTokenNotExist    = NewCodeError(TokenNotExistError, "TokenNotExistError")
+	ErrArgs                     = NewCodeError(ArgsError, "ArgsError")
+	ErrNoPermission             = NewCodeError(NoPermissionError, "NoPermissionError")
+	ErrInternalServer           = NewCodeError(ServerInternalError, "ServerInternalError")
+	ErrRecordNotFound           = NewCodeError(RecordNotFoundError, "RecordNotFoundError")
+	ErrDuplicateKey             = NewCodeError(DuplicateKeyError, "DuplicateKeyError")
+	ErrConcurrentModification   = NewCodeError(ConcurrentModificationError, "ConcurrentModificationError")
+	ErrTokenExpired             = NewCodeError(TokenExpiredError, "TokenExpiredError")
+	ErrTokenInvalid             = NewCodeError(TokenInvalidError, "TokenInvalidError")
+	ErrTokenMalformed           = NewCodeError(TokenMalformedError, "TokenMalformedError")
+	ErrTokenNotValidYet         = NewCodeError(TokenNotValidYetError, "TokenNotValidYetError")
+	ErrTokenUnknown             = NewCodeError(TokenUnknownError, "TokenUnknownError")
+	ErrTokenKicked              = NewCodeError(TokenKickedError, "TokenKickedError")
+	ErrTokenNotExist            = NewCodeError(TokenNotExistError, "TokenNotExistError")
 	ErrOrgUserNoPermissionError = NewCodeError(OrgUserNoPermissionError, "OrgUserNoPermissionError")
 )
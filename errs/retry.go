@@ -0,0 +1,108 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/openimsdk/tools/utils/cow"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryClass tells whether a failed call may be retried.
+type RetryClass int
+
+const (
+	// Permanent failures fail again when retried, e.g. invalid arguments.
+	Permanent RetryClass = iota
+	// Temporary failures may clear up, but the call may have taken effect,
+	// e.g. a deadline exceeded while the server was still working. Only
+	// idempotent calls should be retried.
+	Temporary
+	// Retryable failures are temporary and the call had no effect, e.g. the
+	// server was unavailable or shed the call, so it is safe to retry.
+	Retryable
+)
+
+func (c RetryClass) String() string {
+	switch c {
+	case Temporary:
+		return "temporary"
+	case Retryable:
+		return "retryable"
+	default:
+		return "permanent"
+	}
+}
+
+// retryClasses is keyed by errs codes. The gRPC codes share the table, since
+// errors received from other services carry the status code.
+// ConcurrentModificationError is left Permanent: resending the same request
+// repeats the stale version, callers must read again before retrying, see
+// mongoutil.UpdateWithVersionRetry.
+var retryClasses = cow.NewMap(map[int]RetryClass{
+	int(codes.Canceled):          Permanent,
+	int(codes.Unknown):           Temporary,
+	int(codes.DeadlineExceeded):  Temporary,
+	int(codes.Internal):          Temporary,
+	int(codes.ResourceExhausted): Retryable,
+	int(codes.Aborted):           Retryable,
+	int(codes.Unavailable):       Retryable,
+	ServerInternalError:          Temporary,
+})
+
+// SetRetryClass classifies an errs or gRPC code, e.g. from the package that
+// defines it. Unclassified codes are Permanent.
+func SetRetryClass(code int, class RetryClass) {
+	retryClasses.Set(code, class)
+}
+
+// RetryClassOf classifies err by its code, its gRPC status or, for errors
+// without either, by context and network failures. A failure to connect is
+// Retryable, since the call was never sent; other network failures and
+// truncated responses are Temporary.
+func RetryClassOf(err error) RetryClass {
+	if err == nil {
+		return Permanent
+	}
+	var codeErr CodeError
+	if errors.As(err, &codeErr) {
+		return codeRetryClass(codeErr.Code())
+	}
+	if st, ok := status.FromError(Unwrap(err)); ok {
+		return codeRetryClass(int(st.Code()))
+	}
+	if errors.Is(err, context.Canceled) {
+		return Permanent
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Temporary
+	}
+	var opErr *net.OpError
+	if (errors.As(err, &opErr) && opErr.Op == "dial") || errors.Is(err, syscall.ECONNREFUSED) {
+		return Retryable
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return Temporary
+	}
+	return Permanent
+}
+
+func codeRetryClass(code int) RetryClass {
+	class, _ := retryClasses.Get(code)
+	return class
+}
+
+// IsRetryable reports whether retrying the call that failed with err is safe.
+func IsRetryable(err error) bool {
+	return RetryClassOf(err) == Retryable
+}
+
+// IsTemporary reports whether err may clear up on a later attempt.
+func IsTemporary(err error) bool {
+	return RetryClassOf(err) != Permanent
+}
@@ -0,0 +1,36 @@
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryClassOf(t *testing.T) {
+	assert.False(t, IsTemporary(nil))
+	assert.False(t, IsRetryable(ErrArgs.WrapMsg("bad request")))
+	assert.True(t, IsRetryable(NewCodeError(int(codes.Unavailable), "unavailable").Wrap()))
+	assert.True(t, IsRetryable(fmt.Errorf("call: %w", status.Error(codes.ResourceExhausted, "quota"))))
+	assert.True(t, IsTemporary(status.Error(codes.DeadlineExceeded, "slow")))
+	assert.False(t, IsRetryable(status.Error(codes.DeadlineExceeded, "slow")))
+	assert.Equal(t, Temporary, RetryClassOf(Wrap(context.DeadlineExceeded)))
+	assert.Equal(t, Permanent, RetryClassOf(errors.New("boom")))
+	assert.Equal(t, Permanent, RetryClassOf(ErrConcurrentModification.WrapMsg("stale version")))
+	assert.Equal(t, Temporary, RetryClassOf(ErrInternalServer.WrapMsg("db down")))
+	assert.Equal(t, Permanent, RetryClassOf(Wrap(context.Canceled)))
+	assert.Equal(t, Temporary, RetryClassOf(fmt.Errorf("read: %w", io.ErrUnexpectedEOF)))
+
+	_, err := net.Dial("tcp", "127.0.0.1:1")
+	assert.Equal(t, Retryable, RetryClassOf(WrapMsg(err, "dial")))
+
+	SetRetryClass(1999, Retryable)
+	assert.True(t, IsRetryable(NewCodeError(1999, "Busy").WrapMsg("try later")))
+	assert.Equal(t, "retryable", RetryClassOf(NewCodeError(1999, "Busy")).String())
+}
@@ -0,0 +1,257 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpcstatus converts errs coded errors to google.rpc.Status and back,
+// so the detail, field violations and, where allowed, the wrap messages and
+// key-values of an error survive a gRPC call instead of being flattened into
+// the detail string.
+//
+// A status carries, besides the legacy errinfo.ErrorInfo read by older
+// clients, an errdetails.ErrorInfo and a BadRequest for errors created with
+// BadRequest. Since statuses may be relayed to external clients, the
+// ErrorInfo metadata holds only the WrapMsg keys listed in MetadataKeys, plus
+// the metadata received from downstream services, and the wrap messages are
+// sent in a DebugInfo only when Debug is set.
+package rpcstatus
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/openimsdk/protocol/errinfo"
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+var (
+	// Domain is the ErrorInfo domain of the errors sent by this process.
+	Domain = "openim"
+	// MetadataKeys lists the WrapMsg keys sent in the ErrorInfo metadata.
+	// Key-values often hold user IDs or request fields, so none are sent
+	// unless listed.
+	MetadataKeys []string
+	// Debug sends the wrap messages with all their key-values and the
+	// detail in a DebugInfo, e.g. between trusted internal services.
+	Debug bool
+)
+
+// FieldViolation describes an invalid request field.
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// detailError is a coded error carrying the structured details of a status.
+type detailError struct {
+	errs.CodeError
+	violations []FieldViolation
+	domain     string
+	metadata   map[string]string
+}
+
+func (e *detailError) WithDetail(detail string) errs.CodeError {
+	return &detailError{CodeError: e.CodeError.WithDetail(detail), violations: e.violations, domain: e.domain, metadata: e.metadata}
+}
+
+func (e *detailError) Wrap() error {
+	return errs.Wrap(e)
+}
+
+func (e *detailError) WrapMsg(msg string, kv ...any) error {
+	return errs.WrapMsg(e, msg, kv...)
+}
+
+// BadRequest returns an ArgsError listing the invalid fields, sent as a
+// BadRequest detail.
+func BadRequest(violations ...FieldViolation) error {
+	desc := make([]string, 0, len(violations))
+	for _, v := range violations {
+		desc = append(desc, v.Field+": "+v.Description)
+	}
+	return errs.Wrap(&detailError{
+		CodeError:  errs.ErrArgs.WithDetail(strings.Join(desc, "; ")),
+		violations: violations,
+	})
+}
+
+// FieldViolations returns the invalid fields of an error made by BadRequest,
+// locally or on the other side of a call.
+func FieldViolations(err error) []FieldViolation {
+	var e *detailError
+	if errors.As(err, &e) {
+		return e.violations
+	}
+	return nil
+}
+
+// Metadata returns the key-values of an error received with FromStatus, and
+// the domain of the service that sent it.
+func Metadata(err error) (domain string, metadata map[string]string) {
+	var e *detailError
+	if errors.As(err, &e) {
+		return e.domain, e.metadata
+	}
+	return "", nil
+}
+
+// ToStatus converts err to a status. Errors without a code become
+// ServerInternalError.
+func ToStatus(err error) *status.Status {
+	if err == nil {
+		return status.New(codes.OK, "")
+	}
+	var codeErr errs.CodeError
+	if !errors.As(err, &codeErr) {
+		codeErr = errs.NewCodeError(errs.ServerInternalError, errs.Unwrap(err).Error())
+	}
+	return NewStatus(codeErr, err)
+}
+
+// NewStatus converts err to a status with the code, message and detail of
+// codeErr, e.g. one resolved by specialerror for an uncoded err.
+func NewStatus(codeErr errs.CodeError, err error) *status.Status {
+	code := codeErr.Code()
+	if code <= 0 || int64(code) > int64(math.MaxUint32) {
+		code = errs.ServerInternalError
+	}
+	st := status.New(codes.Code(code), codeErr.Msg())
+	info := &errdetails.ErrorInfo{Reason: codeErr.Msg(), Domain: Domain, Metadata: metadata(err)}
+	details := []protoadapt.MessageV1{&errinfo.ErrorInfo{Cause: codeErr.Detail()}, info}
+	if Debug {
+		details = append(details, debugInfo(codeErr, err))
+	}
+	if violations := FieldViolations(err); len(violations) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, v := range violations {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{Field: v.Field, Description: v.Description})
+		}
+		details = append(details, br)
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// metadata returns the metadata received with err, overlaid with the
+// allowed key-values of its frames.
+func metadata(err error) map[string]string {
+	_, received := Metadata(err)
+	md := make(map[string]string, len(received))
+	for k, v := range received {
+		md[k] = v
+	}
+	frames := errs.WrapFrames(err)
+	// Inner frames first, so the keys of outer frames win.
+	for i := len(frames) - 1; i >= 0; i-- {
+		kv := frames[i].KV
+		for j := 0; j+1 < len(kv); j += 2 {
+			if key := fmt.Sprint(kv[j]); slices.Contains(MetadataKeys, key) {
+				md[key] = fmt.Sprint(kv[j+1])
+			}
+		}
+	}
+	if len(md) == 0 {
+		return nil
+	}
+	return md
+}
+
+func debugInfo(codeErr errs.CodeError, err error) *errdetails.DebugInfo {
+	debug := &errdetails.DebugInfo{Detail: codeErr.Detail()}
+	for _, f := range errs.WrapFrames(err) {
+		entry := f.Msg
+		for j := 0; j < len(f.KV); j += 2 {
+			if entry != "" {
+				entry += ", "
+			}
+			entry += fmt.Sprint(f.KV[j]) + "="
+			if j+1 < len(f.KV) {
+				entry += fmt.Sprint(f.KV[j+1])
+			} else {
+				entry += "MISSING"
+			}
+		}
+		debug.StackEntries = append(debug.StackEntries, entry)
+	}
+	return debug
+}
+
+// FromStatus converts a status received from a call to a coded error,
+// restoring its wrap messages, key-values and field violations. It returns nil
+// for an OK status.
+func FromStatus(st *status.Status) error {
+	if st == nil || st.Code() == codes.OK {
+		return nil
+	}
+	var (
+		detail string
+		info   *errdetails.ErrorInfo
+		debug  *errdetails.DebugInfo
+		br     *errdetails.BadRequest
+	)
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errinfo.ErrorInfo:
+			detail = strings.Join(d.Warp, "->") + d.Cause
+		case *errdetails.ErrorInfo:
+			info = d
+		case *errdetails.DebugInfo:
+			debug = d
+		case *errdetails.BadRequest:
+			br = d
+		}
+	}
+	if debug != nil {
+		detail = debug.Detail
+	}
+	e := &detailError{CodeError: errs.NewCodeError(int(st.Code()), st.Message())}
+	if detail != "" {
+		e.CodeError = e.CodeError.WithDetail(detail)
+	}
+	if info != nil {
+		e.domain, e.metadata = info.Domain, info.Metadata
+	}
+	if br != nil {
+		for _, v := range br.FieldViolations {
+			e.violations = append(e.violations, FieldViolation{Field: v.Field, Description: v.Description})
+		}
+	}
+	var err error = e
+	if debug != nil {
+		for i := len(debug.StackEntries) - 1; i >= 0; i-- {
+			err = errs.WrapMsg(err, debug.StackEntries[i])
+		}
+	}
+	return err
+}
+
+// FromError converts an error returned by a gRPC call with FromStatus. Errors
+// that carry no status are returned unchanged.
+func FromError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return FromStatus(st)
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpcstatus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/openimsdk/protocol/errinfo"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func expose(t *testing.T, keys ...string) {
+	MetadataKeys, Debug = keys, true
+	t.Cleanup(func() { MetadataKeys, Debug = nil, false })
+}
+
+func TestRoundTrip(t *testing.T) {
+	expose(t, "userID", "db")
+	err := errs.ErrRecordNotFound.WithDetail("user").WrapMsg("get user failed", "userID", "u1", "db", "mongo")
+	err = errs.WrapMsg(err, "get profile failed", "userID", "u2")
+
+	st := ToStatus(err)
+	assert.Equal(t, codes.Code(errs.RecordNotFoundError), st.Code())
+	assert.Equal(t, "RecordNotFoundError", st.Message())
+	// Older clients read the detail from the first errinfo.ErrorInfo.
+	require.NotEmpty(t, st.Details())
+	assert.Equal(t, "user", st.Details()[0].(*errinfo.ErrorInfo).Cause)
+
+	got := FromError(st.Err())
+	assert.True(t, errs.ErrRecordNotFound.Is(got))
+	var codeErr errs.CodeError
+	require.True(t, errors.As(got, &codeErr))
+	assert.Equal(t, "user", codeErr.Detail())
+	domain, md := Metadata(got)
+	assert.Equal(t, Domain, domain)
+	assert.Equal(t, map[string]string{"userID": "u2", "db": "mongo"}, md)
+	assert.Equal(t, errs.WrapFrames(err)[0].Msg+", userID=u2", errs.WrapFrames(got)[0].Msg)
+	assert.Len(t, errs.WrapFrames(got), 2)
+}
+
+func TestHiddenByDefault(t *testing.T) {
+	err := errs.ErrRecordNotFound.WithDetail("user").WrapMsg("get user failed", "userID", "u1", "path", "/srv/user.go")
+	st := ToStatus(err)
+	for _, d := range st.Details() {
+		_, ok := d.(*errdetails.DebugInfo)
+		assert.False(t, ok)
+	}
+	got := FromError(st.Err())
+	_, md := Metadata(got)
+	assert.Empty(t, md)
+	assert.Empty(t, errs.WrapFrames(got))
+	var codeErr errs.CodeError
+	require.True(t, errors.As(got, &codeErr))
+	assert.Equal(t, "user", codeErr.Detail())
+}
+
+func TestMetadataForwarded(t *testing.T) {
+	MetadataKeys = []string{"shard"}
+	downstream := FromStatus(ToStatus(errs.ErrInternalServer.WrapMsg("query failed", "shard", "3")))
+	MetadataKeys = []string{"conversationID"}
+	t.Cleanup(func() { MetadataKeys = nil })
+	got := FromStatus(ToStatus(errs.WrapMsg(downstream, "sync failed", "conversationID", "c1", "userID", "u1")))
+	_, md := Metadata(got)
+	assert.Equal(t, map[string]string{"shard": "3", "conversationID": "c1"}, md)
+}
+
+func TestBadRequest(t *testing.T) {
+	err := BadRequest(FieldViolation{Field: "userID", Description: "required"})
+	assert.True(t, errs.ErrArgs.Is(err))
+	got := FromStatus(ToStatus(errs.WrapMsg(err, "check request failed")))
+	assert.True(t, errs.ErrArgs.Is(got))
+	assert.Equal(t, []FieldViolation{{Field: "userID", Description: "required"}}, FieldViolations(got))
+}
+
+func TestLegacyAndPlain(t *testing.T) {
+	st, err := status.New(codes.Code(errs.ArgsError), "ArgsError").WithDetails(&errinfo.ErrorInfo{Cause: "old detail"})
+	require.NoError(t, err)
+	var codeErr errs.CodeError
+	require.True(t, errors.As(FromStatus(st), &codeErr))
+	assert.Equal(t, "old detail", codeErr.Detail())
+
+	st = ToStatus(errors.New("boom"))
+	assert.Equal(t, codes.Code(errs.ServerInternalError), st.Code())
+	assert.Nil(t, FromStatus(status.New(codes.OK, "")))
+	plain := errors.New("not a status")
+	assert.Equal(t, plain, FromError(plain))
+}
@@ -20,6 +20,9 @@ func NewErrorWrapper(err error, s string) ErrWrapper {
 type errorWrapper struct {
 	error
 	s string
+	// msg and kv are the arguments of WrapMsg, kept for WrapFrames.
+	msg string
+	kv  []any
 }
 
 func (e *errorWrapper) Is(err error) bool {
@@ -46,3 +49,29 @@ func (e *errorWrapper) WrapMsg(msg string, kv ...any) error {
 func (e *errorWrapper) Unwrap() error {
 	return e.error
 }
+
+// WrapFrame is a message added to an error by WrapMsg, with its key-values.
+type WrapFrame struct {
+	Msg string
+	KV  []any
+}
+
+// WrapFrames returns the messages added to err by WrapMsg, outermost first.
+func WrapFrames(err error) []WrapFrame {
+	var frames []WrapFrame
+	for err != nil {
+		if w, ok := err.(*errorWrapper); ok {
+			if w.msg == "" && w.kv == nil {
+				frames = append(frames, WrapFrame{Msg: w.s})
+			} else {
+				frames = append(frames, WrapFrame{Msg: w.msg, KV: w.kv})
+			}
+		}
+		unwrap, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = unwrap.Unwrap()
+	}
+	return frames
+}
@@ -0,0 +1,382 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// partServer serves the signed part URLs of a mock storage. Once failAfter
+// parts were uploaded every further upload fails; a negative value never fails.
+type partServer struct {
+	mu        sync.Mutex
+	storage   *mock.Storage
+	failAfter int
+	uploaded  int
+}
+
+func newStorage(t *testing.T) (*mock.Storage, *partServer) {
+	ps := &partServer{storage: mock.NewStorage(), failAfter: -1}
+	srv := httptest.NewServer(ps)
+	t.Cleanup(srv.Close)
+	ps.storage.BaseURL = srv.URL + "/bucket"
+	return ps.storage, ps
+}
+
+func (s *partServer) setFailAfter(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failAfter, s.uploaded = n, 0
+}
+
+func (s *partServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failAfter >= 0 && s.uploaded >= s.failAfter {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	partNumber, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || r.Method != http.MethodPut {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	etag, err := s.storage.UploadPart(r.URL.Query().Get("uploadId"), partNumber, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	s.uploaded++
+	w.Header().Set("ETag", `"`+etag+`"`)
+}
+
+type memoryStates struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func (m *memoryStates) Load(ctx context.Context, jobID string) (*State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state, ok := m.states[jobID]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (m *memoryStates) Save(ctx context.Context, state *State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *state
+	cp.Parts = append(cp.Parts[:0:0], state.Parts...)
+	m.states[state.JobID] = cp
+	return nil
+}
+
+func (m *memoryStates) Delete(ctx context.Context, jobID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.states, jobID)
+	return nil
+}
+
+func users(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			"userID":   "u" + strconv.Itoa(i),
+			"nickname": strings.Repeat("n", 200) + strconv.Itoa(i),
+			"age":      int64(i % 90),
+			"created":  time.Unix(int64(1700000000+i), 0).UTC(),
+			"password": "secret",
+		}
+	}
+	return records
+}
+
+func TestRunCSV(t *testing.T) {
+	storage, _ := newStorage(t)
+	var progress []Progress
+	exp := New(storage, Config{BatchSize: 100})
+	res, err := exp.Run(context.Background(), &Job{
+		ID:           "job",
+		Name:         "export/users.csv",
+		Source:       Records(users(60000)),
+		Transformers: []Transformer{Drop("password"), Filter(func(r Record) bool { return r["age"].(int64) != 0 })},
+		Format:       CSV("userID", "nickname", "age", "created"),
+		Progress:     func(ctx context.Context, p Progress) { progress = append(progress, p) },
+	})
+	require.NoError(t, err)
+	assert.Greater(t, res.Parts, 1)
+	assert.Equal(t, int64(60000-667), res.Records)
+
+	data, err := storage.GetObject("export/users.csv")
+	require.NoError(t, err)
+	assert.Equal(t, res.Bytes, int64(len(data)))
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, int(res.Records)+1)
+	assert.Equal(t, []string{"userID", "nickname", "age", "created"}, rows[0])
+	assert.Equal(t, []string{"u1", strings.Repeat("n", 200) + "1", "1", "2023-11-14T22:13:21Z"}, rows[1])
+
+	require.NotEmpty(t, progress)
+	last := progress[len(progress)-1]
+	assert.True(t, last.Done)
+	assert.Equal(t, res.Parts, last.Parts)
+	assert.Equal(t, res.Records, last.Records)
+}
+
+func TestRunResume(t *testing.T) {
+	ctx := context.Background()
+	storage, srv := newStorage(t)
+	states := &memoryStates{states: make(map[string]State)}
+	records := users(60000)
+	var opened []string
+	job := &Job{
+		ID:   "job",
+		Name: "export/users.jsonl",
+		Source: func(ctx context.Context, checkpoint string) (Source, error) {
+			opened = append(opened, checkpoint)
+			return Records(records)(ctx, checkpoint)
+		},
+		Format: JSONL(),
+	}
+	exp := New(storage, Config{States: states})
+
+	srv.setFailAfter(2)
+	_, err := exp.Run(ctx, job)
+	require.Error(t, err)
+	state, err := states.Load(ctx, "job")
+	require.NoError(t, err)
+	require.NotNil(t, state)
+	require.Len(t, state.Parts, 2)
+	require.NotEmpty(t, state.Checkpoint)
+
+	srv.setFailAfter(-1)
+	res, err := exp.Run(ctx, job)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", state.Checkpoint}, opened)
+	assert.Equal(t, int64(len(records)), res.Records)
+
+	state, err = states.Load(ctx, "job")
+	require.NoError(t, err)
+	assert.Nil(t, state)
+
+	data, err := storage.GetObject("export/users.jsonl")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, len(records))
+	for i, line := range lines {
+		var r map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		require.Equal(t, "u"+strconv.Itoa(i), r["userID"])
+	}
+}
+
+func TestRunWithoutStatesAborts(t *testing.T) {
+	storage, srv := newStorage(t)
+	srv.setFailAfter(0)
+	_, err := New(storage, Config{}).Run(context.Background(), &Job{
+		Name:   "export/users.jsonl",
+		Source: Records(users(10)),
+		Format: JSONL(),
+	})
+	require.Error(t, err)
+	_, err = storage.ListUploadedParts(context.Background(), "1", "export/users.jsonl", 0, 0)
+	assert.True(t, storage.IsNotFound(err))
+}
+
+func TestRunParquetRestarts(t *testing.T) {
+	ctx := context.Background()
+	storage, srv := newStorage(t)
+	states := &memoryStates{states: make(map[string]State)}
+	// Hashed names keep the file larger than one part after compression.
+	name := func(i int) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(strconv.Itoa(i))))
+	}
+	records := make([]Record, 300000)
+	for i := range records {
+		records[i] = Record{"id": int64(i), "name": name(i), "score": float64(i) / 2, "active": i%2 == 0}
+		if i%10 == 0 {
+			delete(records[i], "name")
+		}
+	}
+	job := &Job{
+		ID:     "job",
+		Name:   "export/users.parquet",
+		Source: Records(records),
+		Format: Parquet(Column{"id", ColumnInt64}, Column{"name", ColumnString}, Column{"score", ColumnDouble}, Column{"active", ColumnBool}),
+	}
+	exp := New(storage, Config{States: states, BatchSize: 10000})
+
+	srv.setFailAfter(1)
+	_, err := exp.Run(ctx, job)
+	require.Error(t, err)
+	state, err := states.Load(ctx, "job")
+	require.NoError(t, err)
+	require.Len(t, state.Parts, 1)
+
+	srv.setFailAfter(-1)
+	res, err := exp.Run(ctx, job)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(records)), res.Records)
+
+	data, err := storage.GetObject("export/users.parquet")
+	require.NoError(t, err)
+	type row struct {
+		ID     *int64   `parquet:"id,optional"`
+		Name   *string  `parquet:"name,optional"`
+		Score  *float64 `parquet:"score,optional"`
+		Active *bool    `parquet:"active,optional"`
+	}
+	rows, err := parquet.Read[row](bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, rows, len(records))
+	for _, i := range []int{0, 1, 12345, len(records) - 1} {
+		require.NotNil(t, rows[i].ID)
+		assert.Equal(t, int64(i), *rows[i].ID)
+		assert.Equal(t, float64(i)/2, *rows[i].Score)
+		assert.Equal(t, i%2 == 0, *rows[i].Active)
+		if i%10 == 0 {
+			assert.Nil(t, rows[i].Name)
+		} else {
+			assert.Equal(t, name(i), *rows[i].Name)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		in   any
+		want string
+	}{
+		{nil, ""},
+		{"a,b", "a,b"},
+		{[]byte("hi"), "aGk="},
+		{true, "true"},
+		{int64(-3), "-3"},
+		{1.5, "1.5"},
+		{time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02T03:04:05Z"},
+		{time.Time{}, ""},
+		{map[string]any{"a": int64(1)}, `{"a":1}`},
+		{[]any{"x", int64(2)}, `["x",2]`},
+	} {
+		got, err := formatValue(tc.in)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "%v", tc.in)
+	}
+}
+
+func TestTransformers(t *testing.T) {
+	ctx := context.Background()
+	r, err := Rename(map[string]string{"a": "b"})(ctx, Record{"a": 1, "c": 2})
+	require.NoError(t, err)
+	assert.Equal(t, Record{"b": 1, "c": 2}, r)
+	r, err = Select("b")(ctx, r)
+	require.NoError(t, err)
+	assert.Equal(t, Record{"b": 1}, r)
+	r, err = Filter(func(r Record) bool { return r["b"] == 2 })(ctx, r)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestMongoCheckpoint(t *testing.T) {
+	id := primitive.NewObjectID()
+	doc, err := bson.Marshal(bson.M{"_id": id})
+	require.NoError(t, err)
+	checkpoint, err := mongoCheckpoint(bson.Raw(doc).Lookup("_id"))
+	require.NoError(t, err)
+	var decoded bson.M
+	require.NoError(t, bson.UnmarshalExtJSON([]byte(checkpoint), true, &decoded))
+	assert.Equal(t, id, decoded["_id"])
+
+	created := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	r := normalizeDocument(bson.M{
+		"_id":     id,
+		"created": primitive.NewDateTimeFromTime(created),
+		"count":   int32(3),
+		"tags":    bson.A{"a", int32(1)},
+		"profile": bson.M{"owner": id},
+	})
+	assert.Equal(t, Record{
+		"_id":     id.Hex(),
+		"created": created,
+		"count":   int64(3),
+		"tags":    []any{"a", int64(1)},
+		"profile": map[string]any{"owner": id.Hex()},
+	}, r)
+}
+
+func TestMongoSource(t *testing.T) {
+	ctx := context.Background()
+	cli := containers.Mongo(t, "export")
+	coll := cli.GetDB().Collection("users")
+	docs := make([]any, 25)
+	for i := range docs {
+		docs[i] = bson.M{"_id": int64(i), "name": "user-" + strconv.Itoa(i), "deleted": i%5 == 0}
+	}
+	_, err := coll.InsertMany(ctx, docs)
+	require.NoError(t, err)
+
+	open := Mongo(coll, bson.M{"deleted": false})
+	read := func(checkpoint string, n int) ([]int64, string) {
+		src, err := open(ctx, checkpoint)
+		require.NoError(t, err)
+		defer src.Close(ctx)
+		var ids []int64
+		for n < 0 || len(ids) < n {
+			r, err := src.Next(ctx)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			require.NoError(t, err)
+			ids = append(ids, r["_id"].(int64))
+		}
+		checkpoint, err = src.Checkpoint()
+		require.NoError(t, err)
+		return ids, checkpoint
+	}
+	first, checkpoint := read("", 7)
+	rest, _ := read(checkpoint, -1)
+	all := append(first, rest...)
+	require.Len(t, all, 20)
+	for i := 1; i < len(all); i++ {
+		assert.Less(t, all[i-1], all[i])
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+)
+
+// Format encodes records into a file.
+type Format interface {
+	// Ext is the file extension without the dot.
+	Ext() string
+	ContentType() string
+	// Resumable reports whether an encoder can continue a file whose earlier
+	// bytes were produced by another encoder. Jobs in formats that are not
+	// resumable start over after an interruption.
+	Resumable() bool
+	// NewEncoder returns an encoder writing to w. resume is true when w
+	// continues a partially written file, e.g. the CSV header is omitted.
+	NewEncoder(w io.Writer, resume bool) (Encoder, error)
+}
+
+// Encoder writes records in a Format. Encode may buffer, Flush writes all
+// buffered records to the underlying writer and Close writes any trailer.
+type Encoder interface {
+	Encode(r Record) error
+	Flush() error
+	Close() error
+}
+
+// CSV writes a header line with columns followed by one line per record.
+// Times are formatted as RFC 3339, binary values as base64 and nested values
+// as JSON.
+func CSV(columns ...string) Format {
+	return csvFormat{columns: columns}
+}
+
+type csvFormat struct {
+	columns []string
+}
+
+func (csvFormat) Ext() string { return "csv" }
+
+func (csvFormat) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (csvFormat) Resumable() bool { return true }
+
+func (f csvFormat) NewEncoder(w io.Writer, resume bool) (Encoder, error) {
+	if len(f.columns) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("csv export requires columns")
+	}
+	e := &csvEncoder{w: csv.NewWriter(w), columns: f.columns, row: make([]string, len(f.columns))}
+	if !resume {
+		if err := e.w.Write(f.columns); err != nil {
+			return nil, errs.WrapMsg(err, "write csv header failed")
+		}
+	}
+	return e, nil
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+func (e *csvEncoder) Encode(r Record) error {
+	for i, column := range e.columns {
+		s, err := formatValue(r[column])
+		if err != nil {
+			return err
+		}
+		e.row[i] = s
+	}
+	if err := e.w.Write(e.row); err != nil {
+		return errs.WrapMsg(err, "write csv record failed")
+	}
+	return nil
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	if err := e.w.Error(); err != nil {
+		return errs.WrapMsg(err, "flush csv failed")
+	}
+	return nil
+}
+
+func (e *csvEncoder) Close() error {
+	return e.Flush()
+}
+
+func formatValue(v any) (string, error) {
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.Itoa(val), nil
+	case int32:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64), nil
+	case time.Time:
+		if val.IsZero() {
+			return "", nil
+		}
+		return val.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return val.String(), nil
+	case map[string]any, []any, Record:
+		data, err := jsonutil.Marshal(val)
+		if err != nil {
+			return "", errs.WrapMsg(err, "marshal export value failed")
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// JSONL writes one JSON object per line.
+func JSONL() Format {
+	return jsonlFormat{}
+}
+
+type jsonlFormat struct{}
+
+func (jsonlFormat) Ext() string { return "jsonl" }
+
+func (jsonlFormat) ContentType() string { return "application/x-ndjson" }
+
+func (jsonlFormat) Resumable() bool { return true }
+
+func (jsonlFormat) NewEncoder(w io.Writer, resume bool) (Encoder, error) {
+	return &jsonlEncoder{w: bufio.NewWriter(w)}, nil
+}
+
+type jsonlEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *jsonlEncoder) Encode(r Record) error {
+	data, err := jsonutil.Marshal(r)
+	if err != nil {
+		return errs.WrapMsg(err, "marshal export record failed")
+	}
+	if _, err := e.w.Write(data); err != nil {
+		return errs.WrapMsg(err, "write jsonl record failed")
+	}
+	return errs.Wrap(e.w.WriteByte('\n'))
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return errs.Wrap(e.w.Flush())
+}
+
+func (e *jsonlEncoder) Close() error {
+	return e.Flush()
+}
@@ -0,0 +1,345 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// States persists job progress. Without it, or for jobs without an ID,
+	// jobs cannot be resumed and the multipart upload of a failed job is aborted.
+	States StateStore
+	// PartSize is the minimum size of uploaded parts, raised to the storage's
+	// minimum part size. Defaults to that minimum.
+	PartSize int64
+	// BatchSize is the number of records encoded between flushes, defaults to 1000.
+	BatchSize int
+	// HTTPClient uploads parts to the signed part URLs, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// SignExpire is the validity of signed part URLs, defaults to 15 minutes.
+	SignExpire time.Duration
+}
+
+// Progress reports how far a job got.
+type Progress struct {
+	JobID   string
+	Records int64 // Records encoded, including those not yet uploaded.
+	Bytes   int64 // Bytes uploaded.
+	Parts   int   // Parts uploaded.
+	Done    bool
+}
+
+// ProgressFunc is called after every uploaded part and once the job completes.
+type ProgressFunc func(ctx context.Context, p Progress)
+
+// Job describes one export.
+type Job struct {
+	// ID identifies the job in the StateStore. Running a job again with the
+	// same ID after a failure resumes it.
+	ID           string
+	Name         string // Object name of the exported file.
+	Source       OpenFunc
+	Transformers []Transformer
+	Format       Format
+	Progress     ProgressFunc
+}
+
+// Result describes a completed export.
+type Result struct {
+	Name     string
+	Location string
+	Records  int64
+	Bytes    int64
+	Parts    int
+}
+
+// Exporter runs export jobs against a storage.
+type Exporter struct {
+	storage s3.Interface
+	conf    Config
+}
+
+// New creates an Exporter.
+func New(storage s3.Interface, conf Config) *Exporter {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 1000
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	if conf.SignExpire <= 0 {
+		conf.SignExpire = 15 * time.Minute
+	}
+	return &Exporter{storage: storage, conf: conf}
+}
+
+// Run runs the job to completion. When a previous run of the job left a state
+// behind, Run continues its multipart upload from the last uploaded part.
+func (e *Exporter) Run(ctx context.Context, job *Job) (*Result, error) {
+	if job.Name == "" || job.Source == nil || job.Format == nil {
+		return nil, errs.ErrArgs.WrapMsg("export job requires name, source and format", "jobID", job.ID)
+	}
+	limit, err := e.storage.PartLimit()
+	if err != nil {
+		return nil, err
+	}
+	r := &run{Exporter: e, job: job, limit: limit, partSize: max(e.conf.PartSize, limit.MinPartSize)}
+	if err := r.start(ctx); err != nil {
+		return nil, err
+	}
+	res, err := r.export(ctx)
+	if err != nil && !r.persistent() {
+		if err := e.storage.AbortMultipartUpload(context.WithoutCancel(ctx), r.state.UploadID, job.Name); err != nil {
+			log.ZWarn(ctx, "abort export upload failed", err, "jobID", job.ID, "uploadID", r.state.UploadID)
+		}
+	}
+	return res, err
+}
+
+type run struct {
+	*Exporter
+	job      *Job
+	limit    *s3.PartLimit
+	partSize int64
+	state    *State
+	records  int64
+	buf      bytes.Buffer
+}
+
+// start loads the job state or initiates a new multipart upload.
+func (r *run) start(ctx context.Context) error {
+	if r.persistent() {
+		state, err := r.conf.States.Load(ctx, r.job.ID)
+		if err != nil {
+			return err
+		}
+		if state != nil && state.Name == r.job.Name && (len(state.Parts) == 0 || r.job.Format.Resumable()) {
+			log.ZInfo(ctx, "resume export", "jobID", r.job.ID, "parts", len(state.Parts), "records", state.Records)
+			r.state = state
+			r.records = state.Records
+			return nil
+		}
+		if state != nil {
+			if err := r.storage.AbortMultipartUpload(ctx, state.UploadID, state.Name); err != nil {
+				log.ZWarn(ctx, "abort stale export upload failed", err, "jobID", r.job.ID, "uploadID", state.UploadID)
+			}
+		}
+	}
+	upload, err := r.storage.InitiateMultipartUpload(ctx, r.job.Name, &s3.PutOption{ContentType: r.job.Format.ContentType()})
+	if err != nil {
+		return err
+	}
+	r.state = &State{JobID: r.job.ID, Name: r.job.Name, UploadID: upload.UploadID}
+	return r.save(ctx)
+}
+
+// persistent reports whether the job state is saved and can be resumed.
+func (r *run) persistent() bool {
+	return r.conf.States != nil && r.job.ID != ""
+}
+
+func (r *run) save(ctx context.Context) error {
+	if !r.persistent() {
+		return nil
+	}
+	return r.conf.States.Save(ctx, r.state)
+}
+
+func (r *run) export(ctx context.Context) (*Result, error) {
+	src, err := r.job.Source(ctx, r.state.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := src.Close(ctx); err != nil {
+			log.ZWarn(ctx, "close export source failed", err, "jobID", r.job.ID)
+		}
+	}()
+	enc, err := r.job.Format.NewEncoder(&r.buf, len(r.state.Parts) > 0)
+	if err != nil {
+		return nil, err
+	}
+	var batch int
+	for {
+		record, err := src.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record, err = r.transform(ctx, record); err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+		if err := enc.Encode(record); err != nil {
+			return nil, err
+		}
+		r.records++
+		if batch++; batch < r.conf.BatchSize {
+			continue
+		}
+		batch = 0
+		if err := enc.Flush(); err != nil {
+			return nil, err
+		}
+		if int64(r.buf.Len()) < r.partSize {
+			continue
+		}
+		// Everything read so far is in the buffer, so the source position is
+		// a valid resume point once the part is uploaded.
+		checkpoint, err := src.Checkpoint()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.uploadPart(ctx, checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	if r.buf.Len() > 0 || len(r.state.Parts) == 0 {
+		checkpoint, err := src.Checkpoint()
+		if err != nil {
+			return nil, err
+		}
+		if err := r.uploadPart(ctx, checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	complete, err := r.storage.CompleteMultipartUpload(ctx, r.state.UploadID, r.job.Name, r.state.Parts)
+	if err != nil {
+		return nil, err
+	}
+	if r.persistent() {
+		if err := r.conf.States.Delete(ctx, r.job.ID); err != nil {
+			log.ZWarn(ctx, "delete export state failed", err, "jobID", r.job.ID)
+		}
+	}
+	r.report(ctx, true)
+	return &Result{
+		Name:     r.job.Name,
+		Location: complete.Location,
+		Records:  r.records,
+		Bytes:    r.state.Bytes,
+		Parts:    len(r.state.Parts),
+	}, nil
+}
+
+func (r *run) transform(ctx context.Context, record Record) (Record, error) {
+	var err error
+	for _, t := range r.job.Transformers {
+		if record, err = t(ctx, record); err != nil || record == nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// uploadPart uploads the buffer as the next part and saves the state.
+func (r *run) uploadPart(ctx context.Context, checkpoint string) error {
+	partNumber := len(r.state.Parts) + 1
+	if int64(partNumber) > r.limit.MaxNumSize {
+		return errs.ErrArgs.WrapMsg("export exceeds the maximum number of parts", "jobID", r.job.ID, "parts", partNumber)
+	}
+	etag, err := r.put(ctx, partNumber, r.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	r.state.Parts = append(r.state.Parts, s3.Part{PartNumber: partNumber, ETag: etag})
+	r.state.Checkpoint = checkpoint
+	r.state.Records = r.records
+	r.state.Bytes += int64(r.buf.Len())
+	r.buf.Reset()
+	if err := r.save(ctx); err != nil {
+		return err
+	}
+	r.report(ctx, false)
+	return nil
+}
+
+// put uploads one part to its signed URL and returns the part's ETag.
+func (r *run) put(ctx context.Context, partNumber int, data []byte) (string, error) {
+	sign, err := r.storage.AuthSign(ctx, r.state.UploadID, r.job.Name, r.conf.SignExpire, []int{partNumber})
+	if err != nil {
+		return "", err
+	}
+	if len(sign.Parts) != 1 {
+		return "", errs.New("export part was not signed", "jobID", r.job.ID, "partNumber", partNumber).Wrap()
+	}
+	part := sign.Parts[0]
+	rawURL := part.URL
+	if rawURL == "" {
+		rawURL = sign.URL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", errs.WrapMsg(err, "parse signed part url failed", "url", rawURL)
+	}
+	query := u.Query()
+	for _, values := range []url.Values{sign.Query, part.Query} {
+		for k, v := range values {
+			query[k] = v
+		}
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return "", errs.WrapMsg(err, "create part upload request failed")
+	}
+	for _, header := range []http.Header{sign.Header, part.Header} {
+		for k, v := range header {
+			req.Header[k] = v
+		}
+	}
+	resp, err := r.conf.HTTPClient.Do(req)
+	if err != nil {
+		return "", errs.WrapMsg(err, "upload export part failed", "jobID", r.job.ID, "partNumber", partNumber)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return "", errs.New("upload export part failed", "jobID", r.job.ID, "partNumber", partNumber, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	return strings.Trim(resp.Header.Get("ETag"), `"`), nil
+}
+
+func (r *run) report(ctx context.Context, done bool) {
+	if r.job.Progress == nil {
+		return
+	}
+	r.job.Progress(ctx, Progress{
+		JobID:   r.job.ID,
+		Records: r.records,
+		Bytes:   r.state.Bytes,
+		Parts:   len(r.state.Parts),
+		Done:    done,
+	})
+}
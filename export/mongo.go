@@ -0,0 +1,144 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Mongo returns an OpenFunc streaming the documents of coll that match filter
+// in _id order. The checkpoint is the last _id in extended JSON, so a resumed
+// source continues with documents whose _id is greater. opts may set a
+// projection or batch size; the sort is always by _id.
+func Mongo(coll *mongo.Collection, filter any, opts ...*options.FindOptions) OpenFunc {
+	if filter == nil {
+		filter = bson.M{}
+	}
+	findOpts := append(append([]*options.FindOptions{}, opts...), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	return func(ctx context.Context, checkpoint string) (Source, error) {
+		query := filter
+		if checkpoint != "" {
+			var doc bson.M
+			if err := bson.UnmarshalExtJSON([]byte(checkpoint), true, &doc); err != nil {
+				return nil, errs.ErrArgs.WrapMsg("invalid export checkpoint", "checkpoint", checkpoint)
+			}
+			query = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": doc["_id"]}}}}
+		}
+		cur, err := coll.Find(ctx, query, findOpts...)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "export mongo find failed", "collection", coll.Name())
+		}
+		return &mongoSource{cur: cur, checkpoint: checkpoint}, nil
+	}
+}
+
+type mongoSource struct {
+	cur        *mongo.Cursor
+	checkpoint string
+}
+
+func (s *mongoSource) Next(ctx context.Context) (Record, error) {
+	if !s.cur.Next(ctx) {
+		if err := s.cur.Err(); err != nil {
+			return nil, errs.WrapMsg(err, "export mongo cursor failed")
+		}
+		return nil, io.EOF
+	}
+	var doc bson.M
+	if err := s.cur.Decode(&doc); err != nil {
+		return nil, errs.WrapMsg(err, "export mongo decode failed")
+	}
+	checkpoint, err := mongoCheckpoint(s.cur.Current.Lookup("_id"))
+	if err != nil {
+		return nil, err
+	}
+	s.checkpoint = checkpoint
+	return normalizeDocument(doc), nil
+}
+
+func (s *mongoSource) Checkpoint() (string, error) {
+	return s.checkpoint, nil
+}
+
+func (s *mongoSource) Close(ctx context.Context) error {
+	return s.cur.Close(ctx)
+}
+
+func mongoCheckpoint(id bson.RawValue) (string, error) {
+	if id.Type == 0 {
+		return "", errs.New("export mongo document has no _id").Wrap()
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: id}}, true, false)
+	if err != nil {
+		return "", errs.WrapMsg(err, "export mongo checkpoint failed")
+	}
+	return string(data), nil
+}
+
+// normalizeDocument converts BSON specific types into plain Go values the
+// formats understand: ObjectIDs become hex strings and dates time.Time.
+func normalizeDocument(doc bson.M) Record {
+	r := make(Record, len(doc))
+	for k, v := range doc {
+		r[k] = normalize(v)
+	}
+	return r
+}
+
+func normalize(v any) any {
+	switch val := v.(type) {
+	case primitive.ObjectID:
+		return val.Hex()
+	case primitive.DateTime:
+		return val.Time().UTC()
+	case primitive.Timestamp:
+		return time.Unix(int64(val.T), 0).UTC()
+	case primitive.Decimal128:
+		return val.String()
+	case primitive.Binary:
+		return val.Data
+	case primitive.M:
+		m := make(map[string]any, len(val))
+		for k, v := range val {
+			m[k] = normalize(v)
+		}
+		return m
+	case primitive.D:
+		m := make(map[string]any, len(val))
+		for _, e := range val {
+			m[e.Key] = normalize(e.Value)
+		}
+		return m
+	case primitive.A:
+		a := make([]any, len(val))
+		for i, v := range val {
+			a[i] = normalize(v)
+		}
+		return a
+	case int32:
+		return int64(val)
+	case primitive.Null, primitive.Undefined:
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,176 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"io"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/parquet-go/parquet-go"
+)
+
+// ColumnType is the Parquet type of a column.
+type ColumnType int
+
+const (
+	ColumnString ColumnType = iota
+	ColumnInt64
+	ColumnDouble
+	ColumnBool
+	ColumnTimestamp // Milliseconds since the Unix epoch, UTC.
+)
+
+// Column describes one optional Parquet column; missing and nil values are
+// written as nulls.
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Parquet writes a snappy compressed Parquet file. Every encoder flush
+// becomes a row group. The footer depends on all row groups written before,
+// so Parquet jobs are not resumable and start over after an interruption.
+func Parquet(columns ...Column) Format {
+	return parquetFormat{columns: columns}
+}
+
+type parquetFormat struct {
+	columns []Column
+}
+
+func (parquetFormat) Ext() string { return "parquet" }
+
+func (parquetFormat) ContentType() string { return "application/vnd.apache.parquet" }
+
+func (parquetFormat) Resumable() bool { return false }
+
+func (f parquetFormat) NewEncoder(w io.Writer, resume bool) (Encoder, error) {
+	if len(f.columns) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("parquet export requires columns")
+	}
+	if resume {
+		return nil, errs.ErrArgs.WrapMsg("parquet export cannot be resumed")
+	}
+	group := make(parquet.Group, len(f.columns))
+	types := make(map[string]ColumnType, len(f.columns))
+	for _, column := range f.columns {
+		var node parquet.Node
+		switch column.Type {
+		case ColumnString:
+			node = parquet.String()
+		case ColumnInt64:
+			node = parquet.Int(64)
+		case ColumnDouble:
+			node = parquet.Leaf(parquet.DoubleType)
+		case ColumnBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		case ColumnTimestamp:
+			node = parquet.Timestamp(parquet.Millisecond)
+		default:
+			return nil, errs.ErrArgs.WrapMsg("unknown parquet column type", "column", column.Name, "type", column.Type)
+		}
+		if _, ok := group[column.Name]; ok {
+			return nil, errs.ErrArgs.WrapMsg("duplicate parquet column", "column", column.Name)
+		}
+		group[column.Name] = parquet.Compressed(parquet.Optional(node), &parquet.Snappy)
+		types[column.Name] = column.Type
+	}
+	schema := parquet.NewSchema("export", group)
+	// The schema orders columns by name, rows must follow the same order.
+	e := &parquetEncoder{w: parquet.NewWriter(w, schema)}
+	for _, path := range schema.Columns() {
+		e.columns = append(e.columns, Column{Name: path[0], Type: types[path[0]]})
+	}
+	return e, nil
+}
+
+type parquetEncoder struct {
+	w       *parquet.Writer
+	columns []Column
+	row     parquet.Row
+}
+
+func (e *parquetEncoder) Encode(r Record) error {
+	e.row = e.row[:0]
+	for i, column := range e.columns {
+		v, err := parquetValue(column, r[column.Name])
+		if err != nil {
+			return err
+		}
+		if v.IsNull() {
+			e.row = append(e.row, v.Level(0, 0, i))
+		} else {
+			e.row = append(e.row, v.Level(0, 1, i))
+		}
+	}
+	if _, err := e.w.WriteRows([]parquet.Row{e.row}); err != nil {
+		return errs.WrapMsg(err, "write parquet row failed")
+	}
+	return nil
+}
+
+func (e *parquetEncoder) Flush() error {
+	return errs.WrapMsg(e.w.Flush(), "flush parquet row group failed")
+}
+
+func (e *parquetEncoder) Close() error {
+	return errs.WrapMsg(e.w.Close(), "close parquet writer failed")
+}
+
+func parquetValue(column Column, v any) (parquet.Value, error) {
+	if v == nil {
+		return parquet.NullValue(), nil
+	}
+	switch column.Type {
+	case ColumnString:
+		s, err := formatValue(v)
+		if err != nil {
+			return parquet.Value{}, err
+		}
+		return parquet.ByteArrayValue([]byte(s)), nil
+	case ColumnInt64:
+		switch val := v.(type) {
+		case int:
+			return parquet.Int64Value(int64(val)), nil
+		case int32:
+			return parquet.Int64Value(int64(val)), nil
+		case int64:
+			return parquet.Int64Value(val), nil
+		}
+	case ColumnDouble:
+		switch val := v.(type) {
+		case float32:
+			return parquet.DoubleValue(float64(val)), nil
+		case float64:
+			return parquet.DoubleValue(val), nil
+		case int:
+			return parquet.DoubleValue(float64(val)), nil
+		case int32:
+			return parquet.DoubleValue(float64(val)), nil
+		case int64:
+			return parquet.DoubleValue(float64(val)), nil
+		}
+	case ColumnBool:
+		if val, ok := v.(bool); ok {
+			return parquet.BooleanValue(val), nil
+		}
+	case ColumnTimestamp:
+		if val, ok := v.(time.Time); ok {
+			return parquet.Int64Value(val.UnixMilli()), nil
+		}
+	}
+	return parquet.Value{}, errs.ErrArgs.WrapMsg("value does not match parquet column type", "column", column.Name, "type", column.Type, "value", v)
+}
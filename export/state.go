@@ -0,0 +1,96 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// State is the persisted progress of a job. It is saved after every uploaded
+// part; Checkpoint is the source position right after the last record of the
+// last uploaded part.
+type State struct {
+	JobID      string    `json:"jobID"`
+	Name       string    `json:"name"`
+	UploadID   string    `json:"uploadID"`
+	Parts      []s3.Part `json:"parts"`
+	Checkpoint string    `json:"checkpoint"`
+	Records    int64     `json:"records"`
+	Bytes      int64     `json:"bytes"`
+}
+
+// StateStore persists job states. Load returns nil without an error when the
+// job has no state.
+type StateStore interface {
+	Load(ctx context.Context, jobID string) (*State, error)
+	Save(ctx context.Context, state *State) error
+	Delete(ctx context.Context, jobID string) error
+}
+
+// NewRedisStateStore returns a StateStore keeping states as JSON under
+// keyPrefix, "EXPORT:" when empty. ttl bounds how long an interrupted job can
+// be resumed and should not exceed the bucket's incomplete upload lifecycle.
+func NewRedisStateStore(rdb redis.UniversalClient, keyPrefix string, ttl time.Duration) StateStore {
+	if keyPrefix == "" {
+		keyPrefix = "EXPORT:"
+	}
+	return &redisStateStore{rdb: rdb, prefix: keyPrefix, ttl: ttl}
+}
+
+type redisStateStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func (s *redisStateStore) Load(ctx context.Context, jobID string) (*State, error) {
+	data, err := s.rdb.Get(ctx, s.prefix+jobID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errs.WrapMsg(err, "export state load failed", "jobID", jobID)
+	}
+	var state State
+	if err := jsonutil.Unmarshal(data, &state); err != nil {
+		return nil, errs.WrapMsg(err, "export state decode failed", "jobID", jobID)
+	}
+	return &state, nil
+}
+
+func (s *redisStateStore) Save(ctx context.Context, state *State) error {
+	data, err := jsonutil.Marshal(state)
+	if err != nil {
+		return errs.WrapMsg(err, "export state encode failed", "jobID", state.JobID)
+	}
+	if err := s.rdb.Set(ctx, s.prefix+state.JobID, data, s.ttl).Err(); err != nil {
+		return errs.WrapMsg(err, "export state save failed", "jobID", state.JobID)
+	}
+	return nil
+}
+
+func (s *redisStateStore) Delete(ctx context.Context, jobID string) error {
+	if err := s.rdb.Del(ctx, s.prefix+jobID).Err(); err != nil {
+		return errs.WrapMsg(err, "export state delete failed", "jobID", jobID)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package importer reads CSV or JSONL files from local disk or S3, validates
+// every row with the checker package and inserts valid rows in batches with
+// configurable concurrency. Row level errors are collected into a Report; in
+// dry-run mode nothing is inserted and only the report is produced.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/tableutil"
+)
+
+// RowError is the error reported for a single row. For CSV, Row counts the
+// header row; for JSONL it is the line number.
+type RowError = tableutil.RowError
+
+// InsertFunc inserts a batch of valid rows. Returning a *BatchError fails
+// individual rows; any other error fails the whole batch.
+type InsertFunc[T any] func(ctx context.Context, rows []*T) error
+
+// BatchError reports the rows of a batch that could not be inserted, keyed by
+// their index in the batch. Rows not listed were inserted.
+type BatchError struct {
+	Errs map[int]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d rows of the batch failed", len(e.Errs))
+}
+
+// Config configures an Importer.
+type Config struct {
+	BatchSize   int  // Rows per insert, defaults to 500.
+	Concurrency int  // Concurrent inserts, defaults to 1.
+	MaxErrors   int  // Stop once this many row errors were collected, zero means unlimited.
+	DryRun      bool // Validate only and insert nothing.
+}
+
+// Report summarizes an import.
+type Report struct {
+	Total    int         `json:"total"`    // Data rows read.
+	Valid    int         `json:"valid"`    // Rows that parsed and passed validation.
+	Inserted int         `json:"inserted"` // Rows inserted, zero in dry-run mode.
+	Errors   []*RowError `json:"errors"`   // Sorted by row.
+	// Truncated is set when the import stopped because Config.MaxErrors was reached.
+	Truncated bool `json:"truncated"`
+	DryRun    bool `json:"dryRun"`
+}
+
+func (r *Report) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// Importer imports rows of T.
+type Importer[T any] struct {
+	insert InsertFunc[T]
+	conf   Config
+}
+
+// New creates an Importer inserting with insert.
+func New[T any](insert InsertFunc[T], conf Config) *Importer[T] {
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 500
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 1
+	}
+	return &Importer[T]{insert: insert, conf: conf}
+}
+
+type row[T any] struct {
+	n int
+	v *T
+}
+
+// Run imports the file opened by open in format f.
+func (im *Importer[T]) Run(ctx context.Context, f Format, open Opener) (*Report, error) {
+	if !im.conf.DryRun && im.insert == nil {
+		return nil, errs.ErrArgs.WrapMsg("importer requires an insert func")
+	}
+	rc, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	r := &run[T]{Importer: im, report: &Report{DryRun: im.conf.DryRun}, batches: make(chan []row[T])}
+	var wg sync.WaitGroup
+	if !im.conf.DryRun {
+		for i := 0; i < im.conf.Concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for batch := range r.batches {
+					r.flush(ctx, batch)
+				}
+			}()
+		}
+	}
+	err = decode(ctx, f, &stopReader{ctx: ctx, r: rc, stopped: &r.stopped}, im.conf.MaxErrors, r.add, r.fail)
+	if err == nil && len(r.batch) > 0 && !r.stopped.Load() {
+		r.send(ctx, r.batch)
+	}
+	close(r.batches)
+	wg.Wait()
+	if errors.Is(err, errStopped) {
+		err = nil
+	}
+	sort.SliceStable(r.report.Errors, func(i, j int) bool {
+		return r.report.Errors[i].Row < r.report.Errors[j].Row
+	})
+	if err != nil {
+		return r.report, err
+	}
+	log.ZInfo(ctx, "import finished", "total", r.report.Total, "valid", r.report.Valid, "inserted", r.report.Inserted,
+		"errors", len(r.report.Errors), "dryRun", im.conf.DryRun)
+	return r.report, nil
+}
+
+type run[T any] struct {
+	*Importer[T]
+	mu      sync.Mutex
+	report  *Report
+	batch   []row[T]
+	batches chan []row[T]
+	stopped atomic.Bool
+}
+
+// add is called by the decoder for every valid row.
+func (r *run[T]) add(ctx context.Context, n int, v *T) {
+	r.mu.Lock()
+	r.report.Total++
+	r.report.Valid++
+	r.mu.Unlock()
+	if r.conf.DryRun {
+		return
+	}
+	r.batch = append(r.batch, row[T]{n: n, v: v})
+	if len(r.batch) >= r.conf.BatchSize {
+		r.send(ctx, r.batch)
+		r.batch = nil
+	}
+}
+
+// fail is called by the decoder for every invalid row.
+func (r *run[T]) fail(rowErrs ...*RowError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Total++
+	r.appendErrors(rowErrs...)
+}
+
+func (r *run[T]) send(ctx context.Context, batch []row[T]) {
+	select {
+	case r.batches <- batch:
+	case <-ctx.Done():
+	}
+}
+
+func (r *run[T]) flush(ctx context.Context, batch []row[T]) {
+	if r.stopped.Load() || ctx.Err() != nil {
+		return
+	}
+	values := make([]*T, len(batch))
+	for i, row := range batch {
+		values[i] = row.v
+	}
+	err := r.insert(ctx, values)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		r.report.Inserted += len(batch)
+		return
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		r.report.Inserted += len(batch) - len(batchErr.Errs)
+		for i, row := range batch {
+			if rowErr, ok := batchErr.Errs[i]; ok {
+				r.appendErrors(&RowError{Row: row.n, Err: rowErr})
+			}
+		}
+		return
+	}
+	log.ZWarn(ctx, "import batch failed", err, "rows", len(batch), "firstRow", batch[0].n)
+	for _, row := range batch {
+		r.appendErrors(&RowError{Row: row.n, Err: err})
+	}
+}
+
+// appendErrors records errors and stops the import once MaxErrors is
+// reached. r.mu must be held.
+func (r *run[T]) appendErrors(rowErrs ...*RowError) {
+	if r.report.Truncated {
+		return
+	}
+	r.report.Errors = append(r.report.Errors, rowErrs...)
+	if r.conf.MaxErrors > 0 && len(r.report.Errors) >= r.conf.MaxErrors {
+		r.report.Errors = r.report.Errors[:r.conf.MaxErrors]
+		r.report.Truncated = true
+		r.stopped.Store(true)
+	}
+}
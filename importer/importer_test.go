@@ -0,0 +1,239 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type user struct {
+	UserID   string `table:"userID" json:"userID"`
+	Nickname string `table:"nickname" json:"nickname"`
+	Age      int    `table:"age" json:"age"`
+}
+
+func (u *user) Check() error {
+	if u.UserID == "" {
+		return errs.New("userID is empty")
+	}
+	if u.Age < 0 {
+		return errs.New("age is negative")
+	}
+	return nil
+}
+
+type sink struct {
+	mu      sync.Mutex
+	users   []*user
+	batches int
+	fail    func(rows []*user) error
+}
+
+func (s *sink) insert(ctx context.Context, rows []*user) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	if s.fail != nil {
+		if err := s.fail(rows); err != nil {
+			var batchErr *BatchError
+			if errors.As(err, &batchErr) {
+				for i, row := range rows {
+					if _, ok := batchErr.Errs[i]; !ok {
+						s.users = append(s.users, row)
+					}
+				}
+			}
+			return err
+		}
+	}
+	s.users = append(s.users, rows...)
+	return nil
+}
+
+func (s *sink) ids() []string {
+	ids := make([]string, len(s.users))
+	for i, u := range s.users {
+		ids[i] = u.UserID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func openString(t *testing.T, s string) Opener {
+	name := filepath.Join(t.TempDir(), "import")
+	require.NoError(t, os.WriteFile(name, []byte(s), 0o600))
+	return FromFile(name)
+}
+
+const usersCSV = `userID,nickname,age
+u1,alice,20
+,nobody,30
+u3,carol,abc
+
+u4,dave,-1
+u5,eve,25
+`
+
+func TestRunCSV(t *testing.T) {
+	s := &sink{}
+	report, err := New(s.insert, Config{BatchSize: 1, Concurrency: 2}).Run(context.Background(), CSV, openString(t, usersCSV))
+	require.NoError(t, err)
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, 2, report.Valid)
+	assert.Equal(t, 2, report.Inserted)
+	assert.Equal(t, []string{"u1", "u5"}, s.ids())
+	require.Len(t, report.Errors, 3)
+	assert.Equal(t, []int{3, 4, 5}, []int{report.Errors[0].Row, report.Errors[1].Row, report.Errors[2].Row})
+	assert.Equal(t, "age", report.Errors[1].Column)
+}
+
+func TestRunDryRun(t *testing.T) {
+	s := &sink{}
+	report, err := New(s.insert, Config{DryRun: true}).Run(context.Background(), CSV, openString(t, usersCSV))
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Valid)
+	assert.Zero(t, report.Inserted)
+	assert.Zero(t, s.batches)
+	assert.Len(t, report.Errors, 3)
+}
+
+func TestRunJSONL(t *testing.T) {
+	var sb strings.Builder
+	for i := 1; i <= 100; i++ {
+		switch {
+		case i == 10:
+			sb.WriteString("{not json\n")
+		case i == 20:
+			sb.WriteString("\n")
+		default:
+			fmt.Fprintf(&sb, `{"userID":"u%03d","nickname":"n%d","age":%d}`+"\n", i, i, i)
+		}
+	}
+	s := &sink{fail: func(rows []*user) error {
+		batchErr := &BatchError{Errs: map[int]error{}}
+		for i, row := range rows {
+			if row.UserID == "u050" {
+				batchErr.Errs[i] = errs.ErrDuplicateKey.WrapMsg("duplicate")
+			}
+		}
+		if len(batchErr.Errs) > 0 {
+			return batchErr
+		}
+		return nil
+	}}
+	report, err := New(s.insert, Config{BatchSize: 7, Concurrency: 4}).Run(context.Background(), JSONL, openString(t, sb.String()))
+	require.NoError(t, err)
+	assert.Equal(t, 99, report.Total)
+	assert.Equal(t, 98, report.Valid)
+	assert.Equal(t, 97, report.Inserted)
+	assert.Len(t, s.users, 97)
+	require.Len(t, report.Errors, 2)
+	assert.Equal(t, 10, report.Errors[0].Row)
+	assert.ErrorIs(t, report.Errors[0].Err, errs.ErrArgs)
+	assert.Equal(t, 50, report.Errors[1].Row)
+	assert.ErrorIs(t, report.Errors[1].Err, errs.ErrDuplicateKey)
+}
+
+func TestRunBatchFailure(t *testing.T) {
+	s := &sink{fail: func(rows []*user) error { return errs.New("connection reset") }}
+	report, err := New(s.insert, Config{BatchSize: 2}).Run(context.Background(), CSV, openString(t, usersCSV))
+	require.NoError(t, err)
+	assert.Zero(t, report.Inserted)
+	require.Len(t, report.Errors, 5)
+	assert.Equal(t, 2, report.Errors[0].Row)
+	assert.Contains(t, report.Errors[0].Error(), "connection reset")
+}
+
+func TestRunMaxErrors(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("userID,nickname,age\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, ",n%d,%d\n", i, i)
+	}
+	s := &sink{}
+	report, err := New(s.insert, Config{MaxErrors: 5}).Run(context.Background(), CSV, openString(t, sb.String()))
+	require.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.Len(t, report.Errors, 5)
+	assert.Less(t, report.Total, 10000)
+
+	sb.Reset()
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&sb, `{"userID":"u%d"}`+"\n", i)
+	}
+	s = &sink{fail: func(rows []*user) error { return errs.New("down") }}
+	report, err = New(s.insert, Config{BatchSize: 10, MaxErrors: 25}).Run(context.Background(), JSONL, openString(t, sb.String()))
+	require.NoError(t, err)
+	assert.True(t, report.Truncated)
+	assert.Len(t, report.Errors, 25)
+}
+
+func TestFromS3(t *testing.T) {
+	storage := mock.NewStorage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := storage.GetObject(strings.TrimPrefix(r.URL.Path, "/bucket/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+	storage.BaseURL = srv.URL + "/bucket"
+	storage.PutObject("imports/users.csv", []byte(usersCSV), "text/csv")
+
+	f, err := FormatOf("imports/users.csv")
+	require.NoError(t, err)
+	s := &sink{}
+	report, err := New(s.insert, Config{}).Run(context.Background(), f, FromS3(storage, "imports/users.csv", nil))
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Inserted)
+
+	_, err = New(s.insert, Config{}).Run(context.Background(), f, FromS3(storage, "imports/missing.csv", nil))
+	assert.True(t, storage.IsNotFound(err))
+}
+
+func TestMongoBatchError(t *testing.T) {
+	err := mongoBatchError(mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "E11000 duplicate key"}},
+		{WriteError: mongo.WriteError{Index: 3, Code: 121, Message: "validation failed"}},
+	}})
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errs, 2)
+	assert.ErrorIs(t, batchErr.Errs[1], errs.ErrDuplicateKey)
+	assert.Contains(t, batchErr.Errs[3].Error(), "validation failed")
+
+	assert.Nil(t, mongoBatchError(nil))
+	other := errors.New("timeout")
+	assert.ErrorIs(t, mongoBatchError(other), other)
+}
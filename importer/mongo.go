@@ -0,0 +1,55 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"context"
+	"errors"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoInsert returns an InsertFunc inserting batches into coll with an
+// unordered InsertMany, so one duplicate key does not fail the whole batch.
+func MongoInsert[T any](coll *mongo.Collection) InsertFunc[T] {
+	return func(ctx context.Context, rows []*T) error {
+		docs := make([]any, len(rows))
+		for i, row := range rows {
+			docs[i] = row
+		}
+		_, err := coll.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		return mongoBatchError(err)
+	}
+}
+
+// mongoBatchError converts the write errors of a bulk write into a BatchError.
+func mongoBatchError(err error) error {
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil || len(bwe.WriteErrors) == 0 {
+		return errs.Wrap(err)
+	}
+	batchErr := &BatchError{Errs: make(map[int]error, len(bwe.WriteErrors))}
+	for _, we := range bwe.WriteErrors {
+		switch we.Code {
+		case 11000, 11001, 12582:
+			batchErr.Errs[we.Index] = errs.ErrDuplicateKey.WrapMsg(we.Message)
+		default:
+			batchErr.Errs[we.Index] = errs.New(we.Message, "code", we.Code).Wrap()
+		}
+	}
+	return batchErr
+}
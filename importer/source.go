@@ -0,0 +1,175 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/checker"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/openimsdk/tools/utils/tableutil"
+)
+
+// Format is the file format of an import.
+type Format int
+
+const (
+	// CSV files have a header row; columns are bound to fields with the
+	// tableutil "table" struct tag.
+	CSV Format = iota + 1
+	// JSONL files hold one JSON object per line; blank lines are skipped.
+	JSONL
+)
+
+// FormatOf returns the format for the extension of name.
+func FormatOf(name string) (Format, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".csv":
+		return CSV, nil
+	case ".jsonl", ".ndjson":
+		return JSONL, nil
+	}
+	return 0, errs.ErrArgs.WrapMsg("unsupported import file format", "name", name)
+}
+
+// Opener opens the file to import.
+type Opener func(ctx context.Context) (io.ReadCloser, error)
+
+// FromFile opens a local file.
+func FromFile(name string) Opener {
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "open import file failed", "name", name)
+		}
+		return f, nil
+	}
+}
+
+// FromS3 downloads an object through a short lived access URL. A nil client
+// uses http.DefaultClient.
+func FromS3(storage s3.Interface, name string, client *http.Client) Opener {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) (io.ReadCloser, error) {
+		rawURL, err := storage.AccessURL(ctx, name, 10*time.Minute, nil)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "create import download request failed")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "download import file failed", "name", name)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, errs.New("download import file failed", "name", name, "status", resp.StatusCode).Wrap()
+		}
+		return resp.Body, nil
+	}
+}
+
+var errStopped = errs.New("import stopped")
+
+// stopReader fails reads once stopped is set or ctx is done, ending the
+// decoder early.
+type stopReader struct {
+	ctx     context.Context
+	r       io.Reader
+	stopped *atomic.Bool
+}
+
+func (s *stopReader) Read(p []byte) (int, error) {
+	if s.stopped.Load() {
+		return 0, errStopped
+	}
+	if err := s.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return s.r.Read(p)
+}
+
+type (
+	addFunc[T any] func(ctx context.Context, n int, v *T)
+	failFunc       func(rowErrs ...*RowError)
+)
+
+func decode[T any](ctx context.Context, f Format, r io.Reader, limit int, add addFunc[T], fail failFunc) error {
+	switch f {
+	case CSV:
+		return decodeCSV(ctx, r, limit, add, fail)
+	case JSONL:
+		return decodeJSONL(ctx, r, add, fail)
+	}
+	return errs.ErrArgs.WrapMsg("unsupported import format", "format", f)
+}
+
+func decodeCSV[T any](ctx context.Context, r io.Reader, limit int, add addFunc[T], fail failFunc) error {
+	report, err := tableutil.ReadCSV[T](r, &tableutil.ReadOptions{SkipEmptyRows: true, MaxErrors: limit}, func(n int, v *T) error {
+		add(ctx, n, v)
+		return nil
+	})
+	if report != nil {
+		// tableutil collects parse and validation errors itself, forward them
+		// grouped by row.
+		for i := 0; i < len(report.Errors); {
+			j := i + 1
+			for j < len(report.Errors) && report.Errors[j].Row == report.Errors[i].Row {
+				j++
+			}
+			fail(report.Errors[i:j]...)
+			i = j
+		}
+	}
+	return err
+}
+
+func decodeJSONL[T any](ctx context.Context, r io.Reader, add addFunc[T], fail failFunc) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			v := new(T)
+			if err := jsonutil.Unmarshal(line, v); err != nil {
+				fail(&RowError{Row: n, Err: errs.ErrArgs.WrapMsg("invalid json", "err", err.Error())})
+			} else if err := checker.Validate(v); err != nil {
+				fail(&RowError{Row: n, Err: err})
+			} else {
+				add(ctx, n, v)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errs.WrapMsg(err, "read jsonl failed")
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// NewEtcd returns a Store keeping keys under prefix, "kvstore/" when empty.
+// Versions are etcd mod revisions and never repeat. Keys with a ttl are
+// attached to a lease of their own, rounded up to whole seconds.
+func NewEtcd(cli *clientv3.Client, prefix string) Store {
+	if prefix == "" {
+		prefix = "kvstore/"
+	}
+	return &etcdStore{cli: cli, prefix: prefix}
+}
+
+type etcdStore struct {
+	cli    *clientv3.Client
+	prefix string
+}
+
+func (s *etcdStore) Get(ctx context.Context, key string) (*Entry, error) {
+	resp, err := s.cli.Get(ctx, s.prefix+key)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "etcd get failed", "key", key)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound.WrapMsg("key not found", "key", key)
+	}
+	return &Entry{Key: key, Value: resp.Kvs[0].Value, Version: resp.Kvs[0].ModRevision}, nil
+}
+
+func (s *etcdStore) List(ctx context.Context, prefix string) ([]*Entry, error) {
+	resp, err := s.cli.Get(ctx, s.prefix+prefix, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "etcd list failed", "prefix", prefix)
+	}
+	entries := make([]*Entry, len(resp.Kvs))
+	for i, kv := range resp.Kvs {
+		entries[i] = &Entry{Key: strings.TrimPrefix(string(kv.Key), s.prefix), Value: kv.Value, Version: kv.ModRevision}
+	}
+	return entries, nil
+}
+
+func (s *etcdStore) putOp(ctx context.Context, key string, value []byte, ttl time.Duration) (clientv3.Op, error) {
+	if ttl <= 0 {
+		return clientv3.OpPut(s.prefix+key, string(value)), nil
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	lease, err := s.cli.Grant(ctx, seconds)
+	if err != nil {
+		return clientv3.Op{}, errs.WrapMsg(err, "etcd grant lease failed", "key", key, "ttl", ttl)
+	}
+	return clientv3.OpPut(s.prefix+key, string(value), clientv3.WithLease(lease.ID)), nil
+}
+
+func (s *etcdStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (int64, error) {
+	op, err := s.putOp(ctx, key, value, ttl)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.cli.Do(ctx, op)
+	if err != nil {
+		return 0, errs.WrapMsg(err, "etcd put failed", "key", key)
+	}
+	return resp.Put().Header.Revision, nil
+}
+
+func (s *etcdStore) CompareAndSwap(ctx context.Context, key string, version int64, value []byte, ttl time.Duration) (int64, error) {
+	op, err := s.putOp(ctx, key, value, ttl)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := s.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(s.prefix+key), "=", version)).
+		Then(op).
+		Commit()
+	if err != nil {
+		return 0, errs.WrapMsg(err, "etcd txn failed", "key", key)
+	}
+	if !resp.Succeeded {
+		return 0, ErrConflict.WrapMsg("version mismatch", "key", key, "version", version)
+	}
+	return resp.Header.Revision, nil
+}
+
+func (s *etcdStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.cli.Delete(ctx, s.prefix+key); err != nil {
+		return errs.WrapMsg(err, "etcd delete failed", "key", key)
+	}
+	return nil
+}
+
+func (s *etcdStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	// Start after the current revision so only later changes are reported.
+	resp, err := s.cli.Get(ctx, s.prefix+prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return nil, errs.WrapMsg(err, "etcd get revision failed", "prefix", prefix)
+	}
+	wch := s.cli.Watch(clientv3.WithRequireLeader(ctx), s.prefix+prefix,
+		clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	out := make(chan Event, watchBuffer)
+	go func() {
+		defer close(out)
+		for wr := range wch {
+			if err := wr.Err(); err != nil {
+				log.ZWarn(ctx, "kvstore etcd watch failed", err, "prefix", prefix)
+				return
+			}
+			for _, e := range wr.Events {
+				ev := Event{Key: strings.TrimPrefix(string(e.Kv.Key), s.prefix)}
+				if e.Type == clientv3.EventTypeDelete {
+					ev.Type = EventDelete
+				} else {
+					ev.Type = EventPut
+					ev.Value = e.Kv.Value
+					ev.Version = e.Kv.ModRevision
+				}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,236 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kvstore is a small key-value abstraction for cluster metadata such
+// as leader info or schema versions, with etcd, Redis, Mongo and in-memory
+// implementations. Values are meant to be tiny; it is not a general cache.
+package kvstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+var (
+	ErrNotFound = errs.New("kvstore key not found")
+	ErrConflict = errs.New("kvstore version conflict")
+)
+
+// Entry is a stored value.
+type Entry struct {
+	Key   string
+	Value []byte
+	// Version is positive and changes with every write of the key. It is the
+	// version CompareAndSwap expects. Depending on the backend versions may
+	// start over once a key is deleted or expired.
+	Version int64
+}
+
+// EventType is the kind of change reported by Watch.
+type EventType int
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+func (t EventType) String() string {
+	if t == EventDelete {
+		return "delete"
+	}
+	return "put"
+}
+
+// Event is a change of a watched key. Deletes, including expirations, carry
+// neither a value nor a version.
+type Event struct {
+	Type    EventType
+	Key     string
+	Value   []byte
+	Version int64
+}
+
+// Store stores small values by key.
+type Store interface {
+	// Get returns the entry of key, or ErrNotFound.
+	Get(ctx context.Context, key string) (*Entry, error)
+	// List returns the entries of the keys starting with prefix, sorted by
+	// key.
+	List(ctx context.Context, prefix string) ([]*Entry, error)
+	// Set writes key unconditionally and returns the new version. A positive
+	// ttl expires the key, zero keeps it until deleted.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) (int64, error)
+	// CompareAndSwap writes key only if its current version is version, zero
+	// meaning the key must not exist. It returns the new version, or
+	// ErrConflict when the version did not match.
+	CompareAndSwap(ctx context.Context, key string, version int64, value []byte, ttl time.Duration) (int64, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// Watch reports changes of the keys starting with prefix until ctx is
+	// done, then the channel is closed. Only changes after Watch returned are
+	// reported; call Get for the current state.
+	Watch(ctx context.Context, prefix string) (<-chan Event, error)
+}
+
+// watchBuffer is the capacity of the channels returned by Watch.
+const watchBuffer = 64
+
+// NewMemory returns a Store kept in process memory, for tests and standalone
+// deployments.
+func NewMemory() Store {
+	return &memoryStore{entries: make(map[string]*memoryEntry), watchers: make(map[*memoryWatcher]struct{})}
+}
+
+type memoryEntry struct {
+	value   []byte
+	version int64
+	timer   *time.Timer
+}
+
+type memoryWatcher struct {
+	prefix string
+	ch     chan Event
+	done   chan struct{}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	version  int64
+	entries  map[string]*memoryEntry
+	watchers map[*memoryWatcher]struct{}
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, ErrNotFound.WrapMsg("key not found", "key", key)
+	}
+	return &Entry{Key: key, Value: append([]byte(nil), e.value...), Version: e.version}, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, prefix string) ([]*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []*Entry
+	for key, e := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			entries = append(entries, &Entry{Key: key, Value: append([]byte(nil), e.value...), Version: e.version})
+		}
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func sortEntries(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.put(key, value, ttl), nil
+}
+
+func (s *memoryStore) CompareAndSwap(ctx context.Context, key string, version int64, value []byte, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var current int64
+	if e, ok := s.entries[key]; ok {
+		current = e.version
+	}
+	if current != version {
+		return 0, ErrConflict.WrapMsg("version mismatch", "key", key, "version", version, "current", current)
+	}
+	return s.put(key, value, ttl), nil
+}
+
+// put writes key and notifies the watchers. Called with mu held.
+func (s *memoryStore) put(key string, value []byte, ttl time.Duration) int64 {
+	if e, ok := s.entries[key]; ok && e.timer != nil {
+		e.timer.Stop()
+	}
+	s.version++
+	e := &memoryEntry{value: append([]byte(nil), value...), version: s.version}
+	if ttl > 0 {
+		version := e.version
+		e.timer = time.AfterFunc(ttl, func() { s.expire(key, version) })
+	}
+	s.entries[key] = e
+	s.notify(Event{Type: EventPut, Key: key, Value: e.value, Version: e.version})
+	return e.version
+}
+
+func (s *memoryStore) expire(key string, version int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && e.version == version {
+		delete(s.entries, key)
+		s.notify(Event{Type: EventDelete, Key: key})
+	}
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return nil
+	}
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	delete(s.entries, key)
+	s.notify(Event{Type: EventDelete, Key: key})
+	return nil
+}
+
+// notify sends event to the matching watchers. Called with mu held, so a
+// watcher that does not keep up blocks writers, like a slow etcd watcher.
+func (s *memoryStore) notify(event Event) {
+	for w := range s.watchers {
+		if !strings.HasPrefix(event.Key, w.prefix) {
+			continue
+		}
+		ev := event
+		ev.Value = append([]byte(nil), event.Value...)
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+		}
+	}
+}
+
+func (s *memoryStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	w := &memoryWatcher{prefix: prefix, ch: make(chan Event, watchBuffer), done: make(chan struct{})}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		// Unblock a writer waiting on the channel before taking the lock.
+		close(w.done)
+		s.mu.Lock()
+		delete(s.watchers, w)
+		close(w.ch)
+		s.mu.Unlock()
+	}()
+	return w.ch, nil
+}
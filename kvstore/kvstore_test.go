@@ -0,0 +1,132 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStore(t *testing.T, s Store, ttl time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := s.Watch(ctx, "leader/")
+	require.NoError(t, err)
+	next := func() Event {
+		t.Helper()
+		select {
+		case ev, ok := <-events:
+			require.True(t, ok, "watch closed")
+			return ev
+		case <-time.After(ttl + 5*time.Second):
+			t.Fatal("no watch event")
+			return Event{}
+		}
+	}
+
+	_, err = s.Get(ctx, "leader/chat")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	v1, err := s.CompareAndSwap(ctx, "leader/chat", 0, []byte("a"), 0)
+	require.NoError(t, err)
+	assert.Positive(t, v1)
+	_, err = s.CompareAndSwap(ctx, "leader/chat", 0, []byte("b"), 0)
+	assert.True(t, errors.Is(err, ErrConflict))
+
+	e, err := s.Get(ctx, "leader/chat")
+	require.NoError(t, err)
+	assert.Equal(t, &Entry{Key: "leader/chat", Value: []byte("a"), Version: v1}, e)
+	assert.Equal(t, Event{Type: EventPut, Key: "leader/chat", Value: []byte("a"), Version: v1}, next())
+
+	v2, err := s.CompareAndSwap(ctx, "leader/chat", v1, []byte("b"), 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, v1, v2)
+	_, err = s.CompareAndSwap(ctx, "leader/chat", v1, []byte("c"), 0)
+	assert.True(t, errors.Is(err, ErrConflict))
+	assert.Equal(t, Event{Type: EventPut, Key: "leader/chat", Value: []byte("b"), Version: v2}, next())
+
+	// Keys outside the watched prefix are not reported.
+	_, err = s.Set(ctx, "schema/user", []byte("3"), 0)
+	require.NoError(t, err)
+	entries, err := s.List(ctx, "leader/")
+	require.NoError(t, err)
+	assert.Equal(t, []*Entry{{Key: "leader/chat", Value: []byte("b"), Version: v2}}, entries)
+	entries, err = s.List(ctx, "")
+	require.NoError(t, err)
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "leader/chat", entries[0].Key)
+		assert.Equal(t, "schema/user", entries[1].Key)
+	}
+
+	require.NoError(t, s.Delete(ctx, "leader/chat"))
+	require.NoError(t, s.Delete(ctx, "leader/chat"))
+	assert.Equal(t, Event{Type: EventDelete, Key: "leader/chat"}, next())
+	_, err = s.Get(ctx, "leader/chat")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	v3, err := s.Set(ctx, "leader/push", []byte("x"), ttl)
+	require.NoError(t, err)
+	assert.Equal(t, Event{Type: EventPut, Key: "leader/push", Value: []byte("x"), Version: v3}, next())
+	assert.Equal(t, Event{Type: EventDelete, Key: "leader/push"}, next())
+	_, err = s.Get(ctx, "leader/push")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	// An expired key can be created again.
+	_, err = s.CompareAndSwap(ctx, "leader/push", 0, []byte("y"), 0)
+	assert.NoError(t, err)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory(), 50*time.Millisecond)
+}
+
+func TestRedis(t *testing.T) {
+	testStore(t, NewRedis(containers.Redis(t), "KV_TEST:"), 500*time.Millisecond)
+}
+
+func TestMongo(t *testing.T) {
+	coll := containers.Mongo(t, "kvstore").GetDB().Collection("kvstore")
+	s, err := NewMongo(context.Background(), coll, MongoConfig{PollInterval: 50 * time.Millisecond})
+	require.NoError(t, err)
+	testStore(t, s, 500*time.Millisecond)
+}
+
+func TestEtcd(t *testing.T) {
+	testStore(t, NewEtcd(containers.Etcd(t, "openim").GetClient(), "kvstore-test/"), time.Second)
+}
+
+func TestParseRedisEvent(t *testing.T) {
+	ev, ttl, ok := parseRedisEvent("0:7:1500:8:a:b:c:dva:l:ue")
+	assert.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, ttl)
+	assert.Equal(t, Event{Type: EventPut, Key: "a:b:c:dv", Value: []byte("a:l:ue"), Version: 7}, ev)
+
+	ev, _, ok = parseRedisEvent("1:0:0:3:abc")
+	assert.True(t, ok)
+	assert.Equal(t, Event{Type: EventDelete, Key: "abc"}, ev)
+
+	_, _, ok = parseRedisEvent("0:1:0:9:abc")
+	assert.False(t, ok)
+}
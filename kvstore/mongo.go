@@ -0,0 +1,237 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoEntry struct {
+	Key      string     `bson:"_id"`
+	Value    []byte     `bson:"value"`
+	Version  int64      `bson:"version"`
+	ExpireAt *time.Time `bson:"expire_at,omitempty"`
+}
+
+func (e *mongoEntry) expired(now time.Time) bool {
+	return e.ExpireAt != nil && !e.ExpireAt.After(now)
+}
+
+// MongoConfig configures a Mongo Store.
+type MongoConfig struct {
+	// PollInterval is how often watchers scan for changes, defaults to 1s.
+	// Polling keeps watches working on standalone servers, which do not
+	// support change streams; intermediate writes between scans are not
+	// reported.
+	PollInterval time.Duration
+}
+
+// NewMongo returns a Store keeping one document per key in coll and creates
+// the TTL index removing expired keys. Expired documents are hidden until the
+// TTL monitor deletes them.
+func NewMongo(ctx context.Context, coll *mongo.Collection, conf MongoConfig) (Store, error) {
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expire_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create kvstore indexes failed", "collection", coll.Name())
+	}
+	return &mongoStore{coll: coll, conf: conf, now: time.Now}, nil
+}
+
+type mongoStore struct {
+	coll *mongo.Collection
+	conf MongoConfig
+	now  func() time.Time
+}
+
+func (s *mongoStore) Get(ctx context.Context, key string) (*Entry, error) {
+	var e mongoEntry
+	if err := s.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&e); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound.WrapMsg("key not found", "key", key)
+		}
+		return nil, errs.WrapMsg(err, "mongo get failed", "key", key)
+	}
+	if e.expired(s.now()) {
+		return nil, ErrNotFound.WrapMsg("key expired", "key", key)
+	}
+	return &Entry{Key: key, Value: e.Value, Version: e.Version}, nil
+}
+
+func (s *mongoStore) List(ctx context.Context, prefix string) ([]*Entry, error) {
+	current, err := s.scan(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*Entry, 0, len(current))
+	for _, e := range current {
+		entries = append(entries, &Entry{Key: e.Key, Value: e.Value, Version: e.Version})
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+func (s *mongoStore) update(value []byte, ttl time.Duration, now time.Time) bson.M {
+	if value == nil {
+		value = []byte{}
+	}
+	update := bson.M{"$inc": bson.M{"version": 1}}
+	if ttl > 0 {
+		update["$set"] = bson.M{"value": value, "expire_at": now.Add(ttl)}
+	} else {
+		update["$set"] = bson.M{"value": value}
+		update["$unset"] = bson.M{"expire_at": ""}
+	}
+	return update
+}
+
+func (s *mongoStore) write(ctx context.Context, key string, filter bson.M, upsert bool, value []byte, ttl time.Duration, now time.Time) (*mongoEntry, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(upsert).SetReturnDocument(options.After)
+	var e mongoEntry
+	err := s.coll.FindOneAndUpdate(ctx, filter, s.update(value, ttl, now), opts).Decode(&e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (s *mongoStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (int64, error) {
+	e, err := s.write(ctx, key, bson.M{"_id": key}, true, value, ttl, s.now())
+	if err != nil {
+		return 0, errs.WrapMsg(err, "mongo set failed", "key", key)
+	}
+	return e.Version, nil
+}
+
+func (s *mongoStore) CompareAndSwap(ctx context.Context, key string, version int64, value []byte, ttl time.Duration) (int64, error) {
+	now := s.now()
+	var filter bson.M
+	if version == 0 {
+		// Either no document, which the upsert inserts, or an expired one.
+		filter = bson.M{"_id": key, "expire_at": bson.M{"$lte": now}}
+	} else {
+		filter = bson.M{"_id": key, "version": version, "$or": bson.A{
+			bson.M{"expire_at": bson.M{"$exists": false}},
+			bson.M{"expire_at": bson.M{"$gt": now}},
+		}}
+	}
+	e, err := s.write(ctx, key, filter, version == 0, value, ttl, now)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) || mongo.IsDuplicateKeyError(err) {
+			return 0, ErrConflict.WrapMsg("version mismatch", "key", key, "version", version)
+		}
+		return 0, errs.WrapMsg(err, "mongo compare and swap failed", "key", key)
+	}
+	return e.Version, nil
+}
+
+func (s *mongoStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.coll.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return errs.WrapMsg(err, "mongo delete failed", "key", key)
+	}
+	return nil
+}
+
+// scan returns the live versions of the keys starting with prefix.
+func (s *mongoStore) scan(ctx context.Context, prefix string) (map[string]*mongoEntry, error) {
+	filter := bson.M{}
+	if prefix != "" {
+		filter["_id"] = bson.M{"$regex": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(prefix)}}
+	}
+	cur, err := s.coll.Find(ctx, filter)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "mongo scan failed", "prefix", prefix)
+	}
+	var entries []*mongoEntry
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, errs.WrapMsg(err, "mongo scan decode failed", "prefix", prefix)
+	}
+	now := s.now()
+	res := make(map[string]*mongoEntry, len(entries))
+	for _, e := range entries {
+		if !e.expired(now) {
+			res[e.Key] = e
+		}
+	}
+	return res, nil
+}
+
+func (s *mongoStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	seen, err := s.scan(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan Event, watchBuffer)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(s.conf.PollInterval)
+		defer ticker.Stop()
+		send := func(ev Event) bool {
+			select {
+			case out <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := s.scan(ctx, prefix)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.ZWarn(ctx, "kvstore mongo watch scan failed", err, "prefix", prefix)
+				}
+				continue
+			}
+			for key, e := range current {
+				if old, ok := seen[key]; ok && old.Version == e.Version {
+					continue
+				}
+				if !send(Event{Type: EventPut, Key: key, Value: e.Value, Version: e.Version}) {
+					return
+				}
+			}
+			for key := range seen {
+				if _, ok := current[key]; ok {
+					continue
+				}
+				if !send(Event{Type: EventDelete, Key: key}) {
+					return
+				}
+			}
+			seen = current
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,288 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// setScript writes the value and version of a key hash and publishes the
+// change. ARGV[5] is the expected version, -1 to write unconditionally.
+// Events are "type:version:ttl:keylen:" followed by the key and the value.
+var setScript = redis.NewScript(`
+local cur = tonumber(redis.call('HGET', KEYS[1], 'ver') or '0')
+local expect = tonumber(ARGV[5])
+if expect >= 0 and cur ~= expect then
+	return -1
+end
+local ver = redis.call('HINCRBY', KEYS[1], 'ver', 1)
+redis.call('HSET', KEYS[1], 'v', ARGV[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+else
+	redis.call('PERSIST', KEYS[1])
+end
+redis.call('PUBLISH', ARGV[3], '0:' .. ver .. ':' .. ARGV[2] .. ':' .. #ARGV[4] .. ':' .. ARGV[4] .. ARGV[1])
+return ver
+`)
+
+var deleteScript = redis.NewScript(`
+if redis.call('DEL', KEYS[1]) == 1 then
+	redis.call('PUBLISH', ARGV[1], '1:0:0:' .. #ARGV[2] .. ':' .. ARGV[2])
+end
+return 0
+`)
+
+// NewRedis returns a Store keeping one hash per key under keyPrefix, "KV:"
+// when empty. Changes are published on the keyPrefix+"EVENTS" channel.
+// Redis does not publish expirations, so watchers report a delete when the
+// ttl of the last write has passed and the key is gone. Versions start over
+// once a key is deleted or expired.
+func NewRedis(rdb redis.UniversalClient, keyPrefix string) Store {
+	if keyPrefix == "" {
+		keyPrefix = "KV:"
+	}
+	return &redisStore{rdb: rdb, prefix: keyPrefix, channel: keyPrefix + "EVENTS"}
+}
+
+type redisStore struct {
+	rdb     redis.UniversalClient
+	prefix  string
+	channel string
+	mu      sync.Mutex // Guards results of concurrent cluster scans.
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) (*Entry, error) {
+	res, err := s.rdb.HMGet(ctx, s.prefix+key, "v", "ver").Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "redis get failed", "key", key)
+	}
+	value, _ := res[0].(string)
+	ver, _ := res[1].(string)
+	if ver == "" {
+		return nil, ErrNotFound.WrapMsg("key not found", "key", key)
+	}
+	version, err := strconv.ParseInt(ver, 10, 64)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "invalid kvstore version", "key", key, "version", ver)
+	}
+	return &Entry{Key: key, Value: []byte(value), Version: version}, nil
+}
+
+func (s *redisStore) List(ctx context.Context, prefix string) ([]*Entry, error) {
+	pattern := escapePattern(s.prefix+prefix) + "*"
+	var keys []string
+	scan := func(ctx context.Context, rdb redis.UniversalClient) error {
+		iter := rdb.Scan(ctx, 0, pattern, 100).Iterator()
+		var found []string
+		for iter.Next(ctx) {
+			found = append(found, iter.Val())
+		}
+		if err := iter.Err(); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		keys = append(keys, found...)
+		s.mu.Unlock()
+		return nil
+	}
+	var err error
+	if cluster, ok := s.rdb.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, rdb *redis.Client) error {
+			return scan(ctx, rdb)
+		})
+	} else {
+		err = scan(ctx, s.rdb)
+	}
+	if err != nil {
+		return nil, errs.WrapMsg(err, "redis scan failed", "prefix", prefix)
+	}
+	entries := make([]*Entry, 0, len(keys))
+	for _, key := range keys {
+		e, err := s.Get(ctx, strings.TrimPrefix(key, s.prefix))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	sortEntries(entries)
+	return entries, nil
+}
+
+// escapePattern escapes the glob characters of a SCAN pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *redisStore) set(ctx context.Context, key string, expect int64, value []byte, ttl time.Duration) (int64, error) {
+	version, err := setScript.Run(ctx, s.rdb, []string{s.prefix + key},
+		value, ttl.Milliseconds(), s.channel, key, expect).Int64()
+	if err != nil {
+		return 0, errs.WrapMsg(err, "redis set failed", "key", key)
+	}
+	if version < 0 {
+		return 0, ErrConflict.WrapMsg("version mismatch", "key", key, "version", expect)
+	}
+	return version, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (int64, error) {
+	return s.set(ctx, key, -1, value, ttl)
+}
+
+func (s *redisStore) CompareAndSwap(ctx context.Context, key string, version int64, value []byte, ttl time.Duration) (int64, error) {
+	if version < 0 {
+		return 0, errs.ErrArgs.WrapMsg("negative version", "key", key, "version", version)
+	}
+	return s.set(ctx, key, version, value, ttl)
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	if err := deleteScript.Run(ctx, s.rdb, []string{s.prefix + key}, s.channel, key).Err(); err != nil {
+		return errs.WrapMsg(err, "redis delete failed", "key", key)
+	}
+	return nil
+}
+
+// parseRedisEvent decodes a published change and the ttl it was written with.
+func parseRedisEvent(payload string) (Event, time.Duration, bool) {
+	fields := strings.SplitN(payload, ":", 5)
+	if len(fields) != 5 {
+		return Event{}, 0, false
+	}
+	typ, err1 := strconv.Atoi(fields[0])
+	version, err2 := strconv.ParseInt(fields[1], 10, 64)
+	ttl, err3 := strconv.ParseInt(fields[2], 10, 64)
+	keyLen, err4 := strconv.Atoi(fields[3])
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || keyLen > len(fields[4]) {
+		return Event{}, 0, false
+	}
+	ev := Event{Type: EventType(typ), Key: fields[4][:keyLen]}
+	if ev.Type == EventPut {
+		ev.Value = []byte(fields[4][keyLen:])
+		ev.Version = version
+	}
+	return ev, time.Duration(ttl) * time.Millisecond, true
+}
+
+func (s *redisStore) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	sub := s.rdb.Subscribe(ctx, s.channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		_ = sub.Close()
+		return nil, errs.WrapMsg(err, "redis subscribe failed", "channel", s.channel)
+	}
+	out := make(chan Event, watchBuffer)
+	go s.watch(ctx, sub, prefix, out)
+	return out, nil
+}
+
+type redisExpiry struct {
+	key     string
+	version int64
+	timer   *time.Timer
+}
+
+func (s *redisStore) watch(ctx context.Context, sub *redis.PubSub, prefix string, out chan<- Event) {
+	defer close(out)
+	defer sub.Close()
+	// The pending expiry of every key written with a ttl.
+	expiries := make(map[string]*redisExpiry)
+	defer func() {
+		for _, e := range expiries {
+			e.timer.Stop()
+		}
+	}()
+	expired := make(chan *redisExpiry)
+	schedule := func(e *redisExpiry, d time.Duration) {
+		e.timer = time.AfterFunc(d, func() {
+			select {
+			case expired <- e:
+			case <-ctx.Done():
+			}
+		})
+		expiries[e.key] = e
+	}
+	msgs := sub.Channel()
+	for {
+		var ev Event
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-msgs:
+			if !ok {
+				return
+			}
+			var ttl time.Duration
+			if ev, ttl, ok = parseRedisEvent(msg.Payload); !ok {
+				log.ZWarn(ctx, "kvstore invalid redis event", nil, "channel", msg.Channel)
+				continue
+			}
+			if !strings.HasPrefix(ev.Key, prefix) {
+				continue
+			}
+			if e, ok := expiries[ev.Key]; ok {
+				e.timer.Stop()
+				delete(expiries, ev.Key)
+			}
+			if ev.Type == EventPut && ttl > 0 {
+				schedule(&redisExpiry{key: ev.Key, version: ev.Version}, ttl)
+			}
+		case e := <-expired:
+			if expiries[e.key] != e {
+				// Replaced by a later write after the timer fired.
+				continue
+			}
+			delete(expiries, e.key)
+			entry, err := s.Get(ctx, e.key)
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				log.ZWarn(ctx, "kvstore check expired key failed", err, "key", e.key)
+				continue
+			}
+			if err == nil {
+				if entry.Version == e.version {
+					// The key outlived its ttl by a moment, check again.
+					schedule(e, 100*time.Millisecond)
+				}
+				// Otherwise a newer write is still to be delivered.
+				continue
+			}
+			ev = Event{Type: EventDelete, Key: e.key}
+		}
+		select {
+		case out <- ev:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
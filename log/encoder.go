@@ -15,12 +15,16 @@
 package log
 
 import (
-	"fmt"
+	"unicode/utf8"
 
 	"go.uber.org/zap/buffer"
 	"go.uber.org/zap/zapcore"
 )
 
+const alignWidth = 50
+
+const alignPadding = "                                                  "
+
 type alignEncoder struct {
 	zapcore.Encoder
 }
@@ -29,7 +33,9 @@ type alignEncoder struct {
 func (ae *alignEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
 	// Here we can manipulate the entry.Message to align it as we want
 	// For left alignment, you might want to pad it with spaces to a certain width
-	entry.Message = fmt.Sprintf("%-50s", entry.Message) // Left align and pad to 50 characters
+	if pad := alignWidth - utf8.RuneCountInString(entry.Message); pad > 0 { // Left align and pad to 50 characters
+		entry.Message += alignPadding[:pad]
+	}
 
 	// Call the original Encoder's EncodeEntry method with the modified entry.
 	return ae.Encoder.EncodeEntry(entry, fields)
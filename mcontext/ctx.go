@@ -21,6 +21,22 @@ import (
 	"github.com/openimsdk/tools/errs"
 )
 
+// TenantID is the context key, HTTP header and gRPC metadata key carrying the
+// tenant of a request in multi-tenant deployments.
+const TenantID = "tenantID"
+
+// Priority is the context key, HTTP header, gRPC metadata key and Kafka header
+// carrying the priority of a request. Lower values are more important.
+const Priority = "priority"
+
+// Common priorities. Requests without a priority count as PriorityDefault.
+const (
+	PrioritySystem      = 0 // System messages and control traffic.
+	PriorityInteractive = 1 // Requests a user is waiting for.
+	PriorityDefault     = 2
+	PriorityBulk        = 3 // Imports, backfills and other batch work.
+)
+
 var mapper = []string{constant.OperationID, constant.OpUserID, constant.OpUserPlatform, constant.ConnID}
 
 func WithOpUserIDContext(ctx context.Context, opUserID string) context.Context {
@@ -53,6 +69,14 @@ func SetConnID(ctx context.Context, connID string) context.Context {
 	return context.WithValue(ctx, constant.ConnID, connID)
 }
 
+func SetTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, TenantID, tenantID)
+}
+
+func SetPriority(ctx context.Context, priority int) context.Context {
+	return context.WithValue(ctx, Priority, priority)
+}
+
 func GetOperationID(ctx context.Context) string {
 	if ctx.Value(constant.OperationID) != nil {
 		s, ok := ctx.Value(constant.OperationID).(string)
@@ -103,6 +127,27 @@ func GetOpUserPlatform(ctx context.Context) string {
 	return ""
 }
 
+func GetTenantID(ctx context.Context) string {
+	s, _ := ctx.Value(TenantID).(string)
+	return s
+}
+
+// GetPriority returns the priority of the request, PriorityDefault when unset.
+func GetPriority(ctx context.Context) int {
+	if p, ok := LookupPriority(ctx); ok {
+		return p
+	}
+	return PriorityDefault
+}
+
+// LookupPriority returns the priority of the request and whether one was set.
+// SetPriority, the gRPC server interceptor and GinParsePriority all store it
+// as an int.
+func LookupPriority(ctx context.Context) (int, bool) {
+	p, ok := ctx.Value(Priority).(int)
+	return p, ok
+}
+
 func GetRemoteAddr(ctx context.Context) string {
 	if ctx.Value(constant.RemoteAddr) != "" {
 		s, ok := ctx.Value(constant.RemoteAddr).(string)
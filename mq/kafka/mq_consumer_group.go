@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync"
 
@@ -12,6 +11,7 @@ import (
 	"github.com/openimsdk/tools/log"
 	"github.com/openimsdk/tools/mcontext"
 	"github.com/openimsdk/tools/mq"
+	"github.com/openimsdk/tools/utils/randutil"
 )
 
 func NewMConsumerGroupV2(ctx context.Context, conf *Config, groupID string, topics []string, autoCommitEnable bool) (mq.Consumer, error) {
@@ -69,7 +69,7 @@ func (x *mqConsumerGroup) closeMsgChan() {
 func (x *mqConsumerGroup) loopConsume() {
 	go func() {
 		defer x.closeMsgChan()
-		ctx := mcontext.SetOperationID(x.ctx, fmt.Sprintf("consumer_group_%s_%s_%d", strings.Join(x.topics, "_"), x.groupID, rand.Uint32()))
+		ctx := mcontext.SetOperationID(x.ctx, fmt.Sprintf("consumer_group_%s_%s_%d", strings.Join(x.topics, "_"), x.groupID, randutil.Uint32()))
 		for {
 			if err := x.consumer.Consume(x.ctx, x.topics, x); err != nil {
 				switch {
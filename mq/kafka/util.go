@@ -3,6 +3,7 @@ package kafka
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/IBM/sarama"
 	"github.com/openimsdk/protocol/constant"
@@ -17,19 +18,37 @@ func GetMQHeaderWithContext(ctx context.Context) ([]sarama.RecordHeader, error)
 	if err != nil {
 		return nil, err
 	}
-	return []sarama.RecordHeader{
+	headers := []sarama.RecordHeader{
 		{Key: []byte(constant.OperationID), Value: []byte(operationID)},
 		{Key: []byte(constant.OpUserID), Value: []byte(opUserID)},
 		{Key: []byte(constant.OpUserPlatform), Value: []byte(platform)},
 		{Key: []byte(constant.ConnID), Value: []byte(connID)},
-	}, nil
+	}
+	if priority, ok := mcontext.LookupPriority(ctx); ok {
+		headers = append(headers, sarama.RecordHeader{Key: []byte(mcontext.Priority), Value: []byte(strconv.Itoa(priority))})
+	}
+	return headers, nil
 }
 
-// GetContextWithMQHeader creates a context from message queue headers.
+// GetContextWithMQHeader creates a context from message queue headers. The
+// first four headers are the ones written by GetMQHeaderWithContext; later
+// ones, such as the priority, are matched by key.
 func GetContextWithMQHeader(header []*sarama.RecordHeader) context.Context {
 	var values []string
 	for _, recordHeader := range header {
+		if len(values) == 4 {
+			break
+		}
 		values = append(values, string(recordHeader.Value))
 	}
-	return mcontext.WithMustInfoCtx(values) // Attach extracted values to context
+	ctx := mcontext.WithMustInfoCtx(values) // Attach extracted values to context
+	for _, recordHeader := range header {
+		if string(recordHeader.Key) != mcontext.Priority {
+			continue
+		}
+		if priority, err := strconv.Atoi(string(recordHeader.Value)); err == nil {
+			ctx = mcontext.SetPriority(ctx, priority)
+		}
+	}
+	return ctx
 }
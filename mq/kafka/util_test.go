@@ -0,0 +1,32 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMQHeaderPriority(t *testing.T) {
+	ctx := mcontext.SetOperationID(context.Background(), "op")
+	ctx = mcontext.SetOpUserID(ctx, "u1")
+	ctx = mcontext.SetPriority(ctx, mcontext.PriorityBulk)
+	headers, err := GetMQHeaderWithContext(ctx)
+	require.NoError(t, err)
+	require.Len(t, headers, 5)
+
+	ptrs := make([]*sarama.RecordHeader, len(headers))
+	for i := range headers {
+		ptrs[i] = &headers[i]
+	}
+	got := GetContextWithMQHeader(ptrs)
+	assert.Equal(t, "op", mcontext.GetOperationID(got))
+	assert.Equal(t, "u1", mcontext.GetOpUserID(got))
+	assert.Equal(t, mcontext.PriorityBulk, mcontext.GetPriority(got))
+
+	got = GetContextWithMQHeader(ptrs[:4])
+	assert.Equal(t, mcontext.PriorityDefault, mcontext.GetPriority(got))
+}
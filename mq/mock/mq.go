@@ -0,0 +1,190 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mock provides recording mq.Producer and mq.Consumer implementations for unit tests.
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mq"
+)
+
+var ErrClosed = errs.New("mock mq closed")
+
+type Message struct {
+	Key   string
+	Value []byte
+}
+
+// Producer records every sent message.
+type Producer struct {
+	lock     sync.Mutex
+	messages []Message
+	err      error
+	closed   bool
+	forward  *Consumer
+}
+
+var _ mq.Producer = (*Producer)(nil)
+
+func NewProducer() *Producer {
+	return &Producer{}
+}
+
+// SetError makes subsequent SendMessage calls return err; nil restores normal behavior.
+func (p *Producer) SetError(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.err = err
+}
+
+func (p *Producer) SendMessage(ctx context.Context, key string, value []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.closed {
+		return errs.Wrap(ErrClosed)
+	}
+	if p.err != nil {
+		return p.err
+	}
+	msg := Message{Key: key, Value: append([]byte(nil), value...)}
+	p.messages = append(p.messages, msg)
+	if p.forward != nil {
+		p.forward.Push(msg.Key, msg.Value)
+	}
+	return nil
+}
+
+// Messages returns a copy of the messages sent so far.
+func (p *Producer) Messages() []Message {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// Reset clears recorded messages.
+func (p *Producer) Reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.messages = nil
+}
+
+func (p *Producer) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.closed = true
+	return nil
+}
+
+// Consumer delivers messages queued with Push, one per Subscribe call, like the real consumers.
+type Consumer struct {
+	lock    sync.Mutex
+	queue   []Message
+	notify  chan struct{}
+	done    chan struct{}
+	handled []Message
+	failed  []Message
+}
+
+var _ mq.Consumer = (*Consumer)(nil)
+
+func NewConsumer() *Consumer {
+	return &Consumer{
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// Push queues a message for delivery.
+func (c *Consumer) Push(key string, value []byte) {
+	c.lock.Lock()
+	c.queue = append(c.queue, Message{Key: key, Value: value})
+	c.lock.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Subscribe waits for one message and passes it to fn. It returns ctx.Err() when ctx is done,
+// ErrClosed after Close, and fn's error otherwise.
+func (c *Consumer) Subscribe(ctx context.Context, fn mq.Handler) error {
+	for {
+		c.lock.Lock()
+		if len(c.queue) > 0 {
+			msg := c.queue[0]
+			c.queue = c.queue[1:]
+			c.lock.Unlock()
+			err := fn(ctx, msg.Key, msg.Value)
+			c.lock.Lock()
+			if err != nil {
+				c.failed = append(c.failed, msg)
+			} else {
+				c.handled = append(c.handled, msg)
+			}
+			c.lock.Unlock()
+			return err
+		}
+		c.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return errs.Wrap(ErrClosed)
+		case <-c.notify:
+		}
+	}
+}
+
+// Handled returns messages whose handler returned nil.
+func (c *Consumer) Handled() []Message {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Message(nil), c.handled...)
+}
+
+// Failed returns messages whose handler returned an error.
+func (c *Consumer) Failed() []Message {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]Message(nil), c.failed...)
+}
+
+// Pending returns the number of queued, undelivered messages.
+func (c *Consumer) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.queue)
+}
+
+func (c *Consumer) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	return nil
+}
+
+// Pipe returns a producer and consumer connected to each other: sent messages are recorded by the
+// producer and delivered by the consumer.
+func Pipe() (*Producer, *Consumer) {
+	c := NewConsumer()
+	return &Producer{forward: c}, c
+}
@@ -0,0 +1,61 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProducer(t *testing.T) {
+	ctx := context.Background()
+	p := NewProducer()
+	require.NoError(t, p.SendMessage(ctx, "k1", []byte("v1")))
+	p.SetError(errs.New("broker down"))
+	assert.Error(t, p.SendMessage(ctx, "k2", []byte("v2")))
+	assert.Equal(t, []Message{{Key: "k1", Value: []byte("v1")}}, p.Messages())
+	require.NoError(t, p.Close())
+	p.SetError(nil)
+	assert.ErrorIs(t, p.SendMessage(ctx, "k3", nil), ErrClosed)
+}
+
+func TestPipe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	p, c := Pipe()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = p.SendMessage(ctx, "k", []byte("hello"))
+	}()
+	var got string
+	require.NoError(t, c.Subscribe(ctx, func(ctx context.Context, key string, value []byte) error {
+		got = string(value)
+		return nil
+	}))
+	assert.Equal(t, "hello", got)
+	assert.Len(t, c.Handled(), 1)
+
+	c.Push("bad", nil)
+	assert.Error(t, c.Subscribe(ctx, func(context.Context, string, []byte) error { return errs.New("handle failed") }))
+	assert.Len(t, c.Failed(), 1)
+
+	require.NoError(t, c.Close())
+	assert.ErrorIs(t, c.Subscribe(ctx, func(context.Context, string, []byte) error { return nil }), ErrClosed)
+}
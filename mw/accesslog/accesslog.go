@@ -0,0 +1,202 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package accesslog is the standard access log middleware for gin APIs. It
+// assigns every request an ID, propagated from the X-Request-ID header when
+// present, and logs one line per request with the log package, correlated
+// with the operationID.
+package accesslog
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mw/recorder"
+	"github.com/openimsdk/tools/utils/idutil"
+	"github.com/openimsdk/tools/utils/randutil"
+)
+
+const (
+	// Header carries the request ID in requests and responses.
+	Header = "X-Request-ID"
+	// ContextKey is the gin context key of the request ID.
+	ContextKey = "requestID"
+)
+
+// Config configures the middleware.
+type Config struct {
+	// SkipPaths are not logged, e.g. health checks. Entries ending with "/"
+	// match as prefixes.
+	SkipPaths []string
+	// SlowThreshold logs slower requests as warnings. Zero disables it.
+	SlowThreshold time.Duration
+	// BodySampleRate is the fraction (0-1) of requests logged with their
+	// request and response bodies, masked with MaskFields.
+	BodySampleRate float64
+	// MaxBodySize truncates logged bodies, defaults to 4096 bytes.
+	MaxBodySize int
+	// MaskFields are masked in logged bodies. Nil uses recorder.DefaultMaskFields.
+	MaskFields []string
+	// NewID generates request IDs, defaults to idutil.UUIDv7.
+	NewID func() string
+}
+
+// RequestID returns the request ID of c.
+func RequestID(c *gin.Context) string {
+	return c.GetString(ContextKey)
+}
+
+// validID accepts propagated IDs up to 128 printable ASCII characters so
+// clients cannot inject arbitrary content into logs and headers.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type bodyWriter struct {
+	gin.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *bodyWriter) capture(p []byte) {
+	if remain := w.limit - w.buf.Len(); remain > 0 {
+		w.buf.Write(p[:min(len(p), remain)])
+	}
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Gin returns the middleware. Place it first so rejected requests are logged
+// too. Requests without an operationID header use the request ID as
+// operationID, so log lines of the handlers are correlated as well.
+func Gin(conf Config) gin.HandlerFunc {
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = 4096
+	}
+	if conf.MaskFields == nil {
+		conf.MaskFields = recorder.DefaultMaskFields
+	}
+	if conf.NewID == nil {
+		conf.NewID = idutil.UUIDv7
+	}
+	masker := recorder.NewMasker(conf.MaskFields)
+	skip := func(path string) bool {
+		for _, p := range conf.SkipPaths {
+			if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(c *gin.Context) {
+		id := c.GetHeader(Header)
+		if !validID(id) {
+			id = conf.NewID()
+		}
+		c.Set(ContextKey, id)
+		c.Header(Header, id)
+		operationID := c.GetHeader(constant.OperationID)
+		if operationID == "" {
+			operationID = id
+			c.Set(constant.OperationID, id)
+		}
+		if skip(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		var reqBody []byte
+		var w *bodyWriter
+		withBody := randutil.Sample(conf.BodySampleRate)
+		if withBody {
+			if c.Request.Body != nil {
+				head, _ := io.ReadAll(io.LimitReader(c.Request.Body, int64(conf.MaxBodySize)))
+				c.Request.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+				reqBody = head
+			}
+			w = &bodyWriter{ResponseWriter: c.Writer, limit: conf.MaxBodySize}
+			c.Writer = w
+		}
+		start := time.Now()
+		c.Next()
+		latency := time.Since(start)
+		if w != nil {
+			c.Writer = w.ResponseWriter
+		}
+
+		status := c.Writer.Status()
+		kv := []any{
+			"requestID", id,
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency", latency,
+			"reqSize", max(c.Request.ContentLength, 0),
+			"respSize", max(c.Writer.Size(), 0),
+			"clientIP", c.ClientIP(),
+		}
+		if operationID != id {
+			kv = append(kv, "operationID", operationID)
+		}
+		if userID := c.GetString(constant.OpUserID); userID != "" {
+			kv = append(kv, "userID", userID)
+		}
+		var errCode int
+		if resp := apiresp.GetGinApiResponse(c); resp != nil && resp.ErrCode != 0 {
+			errCode = resp.ErrCode
+			kv = append(kv, "errCode", resp.ErrCode, "errMsg", resp.ErrMsg)
+		}
+		if withBody {
+			kv = append(kv, "reqBody", string(masker.Mask(reqBody)), "respBody", string(masker.Mask(w.buf.Bytes())))
+		}
+		var err error
+		if len(c.Errors) > 0 {
+			err = c.Errors.Last()
+		}
+		switch {
+		case status >= http.StatusInternalServerError:
+			log.ZError(c, "api access", err, kv...)
+		case status >= http.StatusBadRequest || errCode != 0 || conf.SlowThreshold > 0 && latency >= conf.SlowThreshold:
+			log.ZWarn(c, "api access", err, kv...)
+		default:
+			log.ZInfo(c, "api access", kv...)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var n int
+	r := gin.New()
+	r.Use(Gin(Config{
+		SkipPaths:      []string{"/healthz", "/debug/"},
+		BodySampleRate: 1,
+		SlowThreshold:  time.Millisecond,
+		NewID:          func() string { n++; return "gen-" + string(rune('0'+n)) },
+	}))
+	var seen struct{ requestID, operationID, body string }
+	handler := func(c *gin.Context) {
+		seen.requestID = RequestID(c)
+		seen.operationID = c.GetString(constant.OperationID)
+		body, _ := io.ReadAll(c.Request.Body)
+		seen.body = string(body)
+		if strings.Contains(seen.body, "fail") {
+			apiresp.GinError(c, errs.ErrArgs.WrapMsg("bad"))
+			return
+		}
+		apiresp.GinSuccess(c, map[string]string{"token": "secret"})
+	}
+	r.POST("/user/login", handler)
+	r.GET("/healthz", handler)
+	r.GET("/debug/pprof", handler)
+
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// A new ID is generated and doubles as operationID.
+	w := do(http.MethodPost, "/user/login", `{"userID":"u1","password":"p"}`, nil)
+	assert.Equal(t, "gen-1", w.Header().Get(Header))
+	assert.Equal(t, "gen-1", seen.requestID)
+	assert.Equal(t, "gen-1", seen.operationID)
+	// The handler still reads the complete body.
+	assert.Equal(t, `{"userID":"u1","password":"p"}`, seen.body)
+	assert.Contains(t, w.Body.String(), "secret")
+
+	// Incoming IDs are propagated, the operationID header is kept.
+	w = do(http.MethodPost, "/user/login", `fail`, map[string]string{Header: "req-1", constant.OperationID: "op-1"})
+	assert.Equal(t, "req-1", w.Header().Get(Header))
+	assert.Equal(t, "req-1", seen.requestID)
+	assert.Equal(t, "", seen.operationID)
+
+	// Invalid incoming IDs are replaced.
+	w = do(http.MethodPost, "/user/login", `{}`, map[string]string{Header: "bad id\n"})
+	assert.Equal(t, "gen-2", w.Header().Get(Header))
+	w = do(http.MethodPost, "/user/login", `{}`, map[string]string{Header: strings.Repeat("x", 129)})
+	assert.Equal(t, "gen-3", w.Header().Get(Header))
+
+	// Skipped paths still get an ID.
+	w = do(http.MethodGet, "/healthz", "", nil)
+	assert.Equal(t, "gen-4", w.Header().Get(Header))
+	w = do(http.MethodGet, "/debug/pprof", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDefaultID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Gin(Config{}))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, w.Header().Get(Header), 36)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
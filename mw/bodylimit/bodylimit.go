@@ -0,0 +1,239 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bodylimit protects gin APIs from oversized request bodies and
+// decompression bombs. It enforces a size limit per route group and inflates
+// gzip and deflate encoded bodies with bounds on the expanded size and ratio.
+package bodylimit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+const (
+	BodyTooLargeError        = 1891 // The request body exceeds the size limit.
+	UnsupportedEncodingError = 1892 // The Content-Encoding of the request body is not supported.
+	MalformedBodyError       = 1893 // The encoded request body cannot be decoded.
+)
+
+var (
+	ErrBodyTooLarge        = errs.NewCodeError(BodyTooLargeError, "BodyTooLargeError")
+	ErrUnsupportedEncoding = errs.NewCodeError(UnsupportedEncodingError, "UnsupportedEncodingError")
+	ErrMalformedBody       = errs.NewCodeError(MalformedBodyError, "MalformedBodyError")
+)
+
+func init() {
+	apiresp.RegisterProblemStatus(BodyTooLargeError, http.StatusRequestEntityTooLarge)
+	apiresp.RegisterProblemStatus(UnsupportedEncodingError, http.StatusUnsupportedMediaType)
+	apiresp.RegisterProblemStatus(MalformedBodyError, http.StatusBadRequest)
+}
+
+// ratioSlack is the decompressed size below which MaxRatio is not checked,
+// since tiny bodies of repeated bytes compress extremely well.
+const ratioSlack = 64 << 10
+
+// Config configures the middleware.
+type Config struct {
+	// MaxBodySize limits the body as sent, defaults to 4 MiB.
+	MaxBodySize int64
+	// MaxDecompressedSize limits an encoded body once inflated, defaults to
+	// 4 times MaxBodySize.
+	MaxDecompressedSize int64
+	// MaxRatio limits how much an encoded body may expand, defaults to 100.
+	MaxRatio float64
+	// DisableDecompression rejects encoded bodies instead of inflating them.
+	DisableDecompression bool
+	// Stream hands the body to the handler as it arrives, for uploads that
+	// should not be buffered. Reads then fail with the errors of this package
+	// once a limit is crossed. By default the body is read before the handler
+	// runs, so violations are answered with a clear error code.
+	Stream bool
+}
+
+func (c *Config) setDefaults() {
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = 4 << 20
+	}
+	if c.MaxDecompressedSize <= 0 {
+		c.MaxDecompressedSize = 4 * c.MaxBodySize
+	}
+	if c.MaxRatio <= 0 {
+		c.MaxRatio = 100
+	}
+}
+
+// Gin returns the middleware. Apply it to route groups with different
+// configs, e.g. a small limit on the API group and a streaming one on uploads.
+func Gin(conf Config) gin.HandlerFunc {
+	conf.setDefaults()
+	return func(c *gin.Context) {
+		body, err := Wrap(c.Request, conf)
+		if err == nil && !conf.Stream {
+			var data []byte
+			if data, err = io.ReadAll(body); err == nil {
+				c.Request.Body = io.NopCloser(bytes.NewReader(data))
+				c.Request.ContentLength = int64(len(data))
+			}
+		}
+		if err != nil {
+			log.ZWarn(c, "request body rejected", err, "path", c.Request.URL.Path,
+				"contentLength", c.Request.ContentLength, "contentEncoding", c.GetHeader("Content-Encoding"))
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Wrap limits the body of r and inflates it according to its
+// Content-Encoding, replacing r.Body and dropping the encoding headers. It
+// fails right away when the declared length or the encoding is not accepted.
+func Wrap(r *http.Request, conf Config) (io.ReadCloser, error) {
+	conf.setDefaults()
+	if r.Body == nil || r.Body == http.NoBody {
+		return http.NoBody, nil
+	}
+	if r.ContentLength > conf.MaxBodySize {
+		return nil, ErrBodyTooLarge.WrapMsg("request body too large", "contentLength", r.ContentLength, "limit", conf.MaxBodySize)
+	}
+	raw := &limitReader{r: r.Body, n: conf.MaxBodySize}
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var body io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		body = readCloser{raw, r.Body}
+	case "gzip", "x-gzip", "deflate":
+		if conf.DisableDecompression {
+			return nil, ErrUnsupportedEncoding.WrapMsg("request body encoding not accepted", "encoding", encoding)
+		}
+		body = &inflater{conf: conf, raw: raw, body: r.Body, encoding: encoding}
+	default:
+		return nil, ErrUnsupportedEncoding.WrapMsg("unsupported request body encoding", "encoding", encoding)
+	}
+	if encoding != "" {
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+	}
+	r.Body = body
+	return body, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// limitReader fails with ErrBodyTooLarge once more than n bytes are read,
+// unlike io.LimitReader which silently truncates.
+type limitReader struct {
+	r    io.Reader
+	n    int64 // Remaining bytes.
+	read int64
+	err  error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		n = int(l.n)
+		l.err = ErrBodyTooLarge.WrapMsg("request body too large", "limit", l.read+l.n)
+		err = l.err
+	}
+	l.n -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
+
+// inflater decompresses the raw body lazily, so the decompressor reads the
+// header only when the handler starts reading.
+type inflater struct {
+	conf     Config
+	raw      *limitReader
+	body     io.Closer
+	encoding string
+
+	r   io.ReadCloser
+	out int64
+	err error
+}
+
+func (f *inflater) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	if f.r == nil {
+		var err error
+		if f.encoding == "deflate" {
+			f.r, err = zlib.NewReader(f.raw)
+		} else {
+			f.r, err = gzip.NewReader(f.raw)
+		}
+		if err != nil {
+			f.err = f.decodeError(err)
+			return 0, f.err
+		}
+	}
+	if remain := f.conf.MaxDecompressedSize - f.out + 1; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := f.r.Read(p)
+	f.out += int64(n)
+	if f.out > f.conf.MaxDecompressedSize {
+		f.err = ErrBodyTooLarge.WrapMsg("decompressed request body too large", "limit", f.conf.MaxDecompressedSize)
+		return 0, f.err
+	}
+	if f.out > ratioSlack && float64(f.out) > f.conf.MaxRatio*float64(f.raw.read) {
+		f.err = ErrBodyTooLarge.WrapMsg("request body compression ratio too high",
+			"compressed", f.raw.read, "decompressed", f.out, "maxRatio", f.conf.MaxRatio)
+		return 0, f.err
+	}
+	if err != nil && err != io.EOF {
+		f.err = f.decodeError(err)
+		return n, f.err
+	}
+	return n, err
+}
+
+func (f *inflater) decodeError(err error) error {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return err
+	}
+	return ErrMalformedBody.WrapMsg("decode request body failed", "encoding", f.encoding, "err", err.Error())
+}
+
+func (f *inflater) Close() error {
+	if f.r != nil {
+		_ = f.r.Close()
+	}
+	return f.body.Close()
+}
@@ -0,0 +1,127 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bodylimit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func serve(conf Config, body []byte, encoding string, chunked bool) (*httptest.ResponseRecorder, string) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var got string
+	r.POST("/", Gin(conf), func(c *gin.Context) {
+		data, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		got = string(data)
+		apiresp.GinSuccess(c, nil)
+	})
+	var reader io.Reader = bytes.NewReader(body)
+	if chunked {
+		reader = io.MultiReader(reader) // Hides the length from httptest.
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", reader)
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, got
+}
+
+func errCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	var resp apiresp.ApiResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.ErrCode
+}
+
+func TestLimit(t *testing.T) {
+	conf := Config{MaxBodySize: 10}
+	w, got := serve(conf, []byte("0123456789"), "", false)
+	assert.Equal(t, 0, errCode(t, w))
+	assert.Equal(t, "0123456789", got)
+
+	w, _ = serve(conf, []byte("0123456789a"), "", false)
+	assert.Equal(t, BodyTooLargeError, errCode(t, w))
+	w, _ = serve(conf, []byte("0123456789a"), "", true)
+	assert.Equal(t, BodyTooLargeError, errCode(t, w))
+
+	conf.Stream = true
+	w, _ = serve(conf, []byte("0123456789a"), "", true)
+	assert.Equal(t, BodyTooLargeError, errCode(t, w))
+}
+
+func TestDecompress(t *testing.T) {
+	payload := []byte(strings.Repeat("hello ", 100))
+	w, got := serve(Config{}, gzipped(t, payload), "gzip", false)
+	assert.Equal(t, 0, errCode(t, w))
+	assert.Equal(t, string(payload), got)
+
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write(payload)
+	_ = zw.Close()
+	w, got = serve(Config{Stream: true}, buf.Bytes(), "deflate", false)
+	assert.Equal(t, 0, errCode(t, w))
+	assert.Equal(t, string(payload), got)
+
+	w, _ = serve(Config{}, []byte("not gzip"), "gzip", false)
+	assert.Equal(t, MalformedBodyError, errCode(t, w))
+	w, _ = serve(Config{}, payload, "br", false)
+	assert.Equal(t, UnsupportedEncodingError, errCode(t, w))
+	w, _ = serve(Config{DisableDecompression: true}, gzipped(t, payload), "gzip", false)
+	assert.Equal(t, UnsupportedEncodingError, errCode(t, w))
+}
+
+func TestZipBomb(t *testing.T) {
+	bomb := gzipped(t, make([]byte, 8<<20))
+	require.Less(t, len(bomb), 64<<10)
+
+	// Stopped by the ratio, then by the decompressed size.
+	w, _ := serve(Config{MaxBodySize: 64 << 10, MaxDecompressedSize: 1 << 30}, bomb, "gzip", false)
+	assert.Equal(t, BodyTooLargeError, errCode(t, w))
+	w, _ = serve(Config{MaxBodySize: 64 << 10, MaxRatio: 1 << 20}, bomb, "gzip", false)
+	assert.Equal(t, BodyTooLargeError, errCode(t, w))
+}
+
+func TestProblemStatus(t *testing.T) {
+	p := apiresp.ParseProblem(ErrBodyTooLarge.WrapMsg("too large"), "")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, p.Status)
+}
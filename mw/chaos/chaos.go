@@ -0,0 +1,160 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package chaos injects latency, errors and connection resets into HTTP and gRPC calls.
+// It is meant for staging environments to exercise the resilience of callers; keep it disabled in production.
+package chaos
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/randutil"
+)
+
+// Rule describes one fault. A call matches when its method has one of the Methods prefixes (or Methods is empty)
+// and its user is listed in UserIDs (or UserIDs is empty); a matching call is then affected with probability Percent/100.
+type Rule struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+	UserIDs []string `json:"userIDs"`
+	Percent float64  `json:"percent"`
+
+	// Latency is added before the call proceeds. When LatencyJitter is set a random extra delay in
+	// [0, LatencyJitter) is added on top.
+	Latency       time.Duration `json:"latency"`
+	LatencyJitter time.Duration `json:"latencyJitter"`
+	// ErrCode, when non-zero, fails the call with errs.NewCodeError(ErrCode, ErrMsg).
+	ErrCode int    `json:"errCode"`
+	ErrMsg  string `json:"errMsg"`
+	// Reset drops the connection (HTTP) or fails with codes.Unavailable (gRPC).
+	Reset bool `json:"reset"`
+}
+
+func (r *Rule) match(method, userID string) bool {
+	if len(r.Methods) > 0 {
+		var ok bool
+		for _, m := range r.Methods {
+			if strings.HasPrefix(method, m) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(r.UserIDs) > 0 {
+		var ok bool
+		for _, u := range r.UserIDs {
+			if u == userID {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type Config struct {
+	Enable bool   `json:"enable"`
+	Rules  []Rule `json:"rules"`
+}
+
+// Fault is the outcome of evaluating the rules for one call.
+type Fault struct {
+	Rule    string
+	Latency time.Duration
+	Err     errs.CodeError
+	Reset   bool
+}
+
+// Injector evaluates rules for incoming calls. Its configuration can be replaced at runtime.
+type Injector struct {
+	cfg atomic.Pointer[Config]
+}
+
+func New(cfg Config) *Injector {
+	i := &Injector{}
+	i.SetConfig(cfg)
+	return i
+}
+
+func (i *Injector) SetConfig(cfg Config) {
+	i.cfg.Store(&cfg)
+}
+
+func (i *Injector) Config() Config {
+	return *i.cfg.Load()
+}
+
+// Enable toggles injection without touching the rules.
+func (i *Injector) Enable(enable bool) {
+	cfg := i.Config()
+	cfg.Enable = enable
+	i.SetConfig(cfg)
+}
+
+// Evaluate returns the fault for a call, or nil if the call should proceed untouched.
+// The first matching rule whose dice roll succeeds wins.
+func (i *Injector) Evaluate(method, userID string) *Fault {
+	cfg := i.cfg.Load()
+	if !cfg.Enable {
+		return nil
+	}
+	for _, rule := range cfg.Rules {
+		if rule.Percent <= 0 || !rule.match(method, userID) {
+			continue
+		}
+		if rule.Percent < 100 && randutil.Float64()*100 >= rule.Percent {
+			continue
+		}
+		f := &Fault{Rule: rule.Name, Latency: rule.Latency, Reset: rule.Reset}
+		if rule.LatencyJitter > 0 {
+			f.Latency += time.Duration(randutil.Float64() * float64(rule.LatencyJitter))
+		}
+		if rule.ErrCode != 0 {
+			msg := rule.ErrMsg
+			if msg == "" {
+				msg = "chaos injected error"
+			}
+			f.Err = errs.NewCodeError(rule.ErrCode, msg)
+		}
+		return f
+	}
+	return nil
+}
+
+// apply sleeps for the injected latency, honoring ctx cancellation.
+func (f *Fault) apply(ctx context.Context, method string) error {
+	log.ZDebug(ctx, "chaos fault injected", "rule", f.Rule, "method", method, "latency", f.Latency, "reset", f.Reset, "err", f.Err)
+	if f.Latency <= 0 {
+		return nil
+	}
+	t := time.NewTimer(f.Latency)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return errs.WrapMsg(ctx.Err(), "chaos latency interrupted")
+	case <-t.C:
+		return nil
+	}
+}
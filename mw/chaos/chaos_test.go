@@ -0,0 +1,117 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEvaluate(t *testing.T) {
+	i := New(Config{Enable: true, Rules: []Rule{
+		{Name: "slow", Methods: []string{"/user"}, UserIDs: []string{"u1"}, Percent: 100, Latency: time.Millisecond},
+		{Name: "fail", Methods: []string{"/group"}, Percent: 100, ErrCode: 1500},
+		{Name: "never", Percent: 0, Reset: true},
+	}})
+	f := i.Evaluate("/user/get", "u1")
+	require.NotNil(t, f)
+	assert.Equal(t, "slow", f.Rule)
+	assert.Nil(t, i.Evaluate("/user/get", "u2"))
+	f = i.Evaluate("/group/get", "")
+	require.NotNil(t, f)
+	assert.Equal(t, 1500, f.Err.Code())
+	assert.Nil(t, i.Evaluate("/msg/send", ""))
+
+	i.Enable(false)
+	assert.Nil(t, i.Evaluate("/group/get", ""))
+	assert.Len(t, i.Config().Rules, 3)
+}
+
+func TestEvaluatePercent(t *testing.T) {
+	i := New(Config{Enable: true, Rules: []Rule{{Percent: 30, Reset: true}}})
+	var hits int
+	for range 10000 {
+		if i.Evaluate("/m", "") != nil {
+			hits++
+		}
+	}
+	assert.InDelta(t, 3000, hits, 300)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	i := New(Config{Enable: true, Rules: []Rule{{Methods: []string{"/svc/Fail"}, Percent: 100, ErrCode: 1001}, {Methods: []string{"/svc/Reset"}, Percent: 100, Reset: true}}})
+	interceptor := i.UnaryServerInterceptor()
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	ctx := mcontext.SetOpUserID(context.Background(), "u1")
+
+	resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Ok"}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Fail"}, handler)
+	assert.Error(t, err)
+	_, err = interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/svc/Reset"}, handler)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestUnaryClientInterceptorLatencyCanceled(t *testing.T) {
+	i := New(Config{Enable: true, Rules: []Rule{{Percent: 100, Latency: time.Minute}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := i.UnaryClientInterceptor()(ctx, "/svc/M", nil, nil, nil, func(context.Context, string, any, any, *grpc.ClientConn, ...grpc.CallOption) error {
+		return nil
+	})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	i := New(Config{Enable: true, Rules: []Rule{{Methods: []string{"/fail"}, Percent: 100, ErrCode: 1002, ErrMsg: "injected"}}})
+	engine := gin.New()
+	engine.Use(i.Gin())
+	engine.GET("/fail", func(c *gin.Context) { c.String(http.StatusOK, "handler") })
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	var resp apiresp.ApiResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1002, resp.ErrCode)
+	assert.Equal(t, "injected", resp.ErrMsg)
+}
+
+func TestGinReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	i := New(Config{Enable: true, Rules: []Rule{{Percent: 100, Reset: true}}})
+	engine := gin.New()
+	engine.Use(i.Gin())
+	engine.GET("/x", func(c *gin.Context) { c.String(http.StatusOK, "handler") })
+	srv := httptest.NewServer(engine)
+	defer srv.Close()
+	_, err := http.Get(srv.URL + "/x")
+	assert.Error(t, err)
+}
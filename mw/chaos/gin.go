@@ -0,0 +1,63 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+)
+
+// Gin injects faults into HTTP requests. Place it after GinParseToken so rules can match on the user.
+func (i *Injector) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		f := i.Evaluate(c.Request.URL.Path, c.GetString(constant.OpUserID))
+		if f == nil {
+			c.Next()
+			return
+		}
+		if err := f.apply(c, c.Request.URL.Path); err != nil {
+			c.Abort()
+			return
+		}
+		if f.Reset {
+			resetConn(c)
+			return
+		}
+		if f.Err != nil {
+			apiresp.GinError(c, f.Err)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// resetConn hijacks the connection and closes it with SO_LINGER 0 so the client sees a TCP reset.
+func resetConn(c *gin.Context) {
+	c.Abort()
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		c.Status(http.StatusBadGateway)
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
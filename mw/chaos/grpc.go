@@ -0,0 +1,67 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chaos
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/mcontext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errReset = status.Error(codes.Unavailable, "chaos: connection reset by peer")
+
+// UnaryServerInterceptor injects faults into incoming calls. Chain it after RpcServerInterceptor so the
+// operating user is available and injected error codes are converted like any other handler error.
+func (i *Injector) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		f := i.Evaluate(info.FullMethod, mcontext.GetOpUserID(ctx))
+		if f == nil {
+			return handler(ctx, req)
+		}
+		if err := f.apply(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		if f.Reset {
+			return nil, errReset
+		}
+		if f.Err != nil {
+			return nil, f.Err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClientInterceptor injects faults into outgoing calls before they reach the network.
+func (i *Injector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		f := i.Evaluate(method, mcontext.GetOpUserID(ctx))
+		if f == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if err := f.apply(ctx, method); err != nil {
+			return err
+		}
+		if f.Reset {
+			return errReset
+		}
+		if f.Err != nil {
+			return status.Error(codes.Code(f.Err.Code()), f.Err.Msg())
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -16,10 +16,12 @@ package mw
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
 	"github.com/openimsdk/tools/tokenverify"
 
 	"github.com/gin-gonic/gin"
@@ -76,6 +78,20 @@ func GinParseOperationID() gin.HandlerFunc {
 	}
 }
 
+// GinParsePriority reads the priority header into the gin context. Clients
+// cannot claim a priority more important than highest, so external traffic
+// cannot outrank system messages; invalid values are ignored.
+func GinParsePriority(highest int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v := c.GetHeader(mcontext.Priority); v != "" {
+			if priority, err := strconv.Atoi(v); err == nil {
+				c.Set(mcontext.Priority, max(priority, highest))
+			}
+		}
+		c.Next()
+	}
+}
+
 func GinParseToken(secretKey jwt.Keyfunc, whitelist []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		switch c.Request.Method {
@@ -0,0 +1,131 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+)
+
+type bodyWriter struct {
+	gin.ResponseWriter
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *bodyWriter) capture(p []byte) {
+	if remain := w.limit + 1 - w.buf.Len(); remain > 0 {
+		w.buf.Write(p[:min(len(p), remain)])
+	}
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Gin returns a middleware recording matching HTTP calls. Place it after GinParseToken so that the
+// operating user is known when the call finishes.
+func (r *Recorder) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := r.cfg.Load()
+		if !cfg.Enable {
+			c.Next()
+			return
+		}
+		var reqBody []byte
+		if c.Request.Body != nil {
+			// Read one byte past the limit so truncation can be detected, then hand the full body on.
+			head, _ := io.ReadAll(io.LimitReader(c.Request.Body, int64(cfg.MaxBodySize)+1))
+			c.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), c.Request.Body), c.Request.Body}
+			reqBody = head
+		}
+		w := &bodyWriter{ResponseWriter: c.Writer, limit: cfg.MaxBodySize}
+		c.Writer = w
+		start := time.Now()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		operationID := c.Request.Header.Get(constant.OperationID)
+		cfg, ok := r.match(c.Request.URL.Path, operationID, c.GetString(constant.OpUserID))
+		if !ok {
+			return
+		}
+		rec := &Record{
+			Kind:        KindHTTP,
+			Method:      c.Request.Method + " " + c.Request.URL.Path,
+			OperationID: operationID,
+			UserID:      c.GetString(constant.OpUserID),
+			Time:        start,
+			Latency:     time.Since(start),
+			Status:      c.Writer.Status(),
+			Request:     reqBody,
+			Response:    w.buf.Bytes(),
+		}
+		if len(c.Errors) > 0 {
+			rec.Error = c.Errors.String()
+		}
+		r.save(cfg, rec)
+	}
+}
+
+// ListHandler serves recorded calls filtered by the operationID, userID, method and limit query parameters.
+func (r *Recorder) ListHandler(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	recs, err := r.store.List(c, Filter{
+		OperationID: c.Query("operationID"),
+		UserID:      c.Query("userID"),
+		Method:      c.Query("method"),
+		Limit:       limit,
+	})
+	if err != nil {
+		apiresp.GinError(c, err)
+		return
+	}
+	apiresp.GinSuccess(c, recs)
+}
+
+// GetHandler serves a single record by the id query parameter.
+func (r *Recorder) GetHandler(c *gin.Context) {
+	id := c.Query("id")
+	if id == "" {
+		apiresp.GinError(c, errs.ErrArgs.WrapMsg("id is empty"))
+		return
+	}
+	rec, err := r.store.Get(c, id)
+	if err != nil {
+		apiresp.GinError(c, err)
+		return
+	}
+	apiresp.GinSuccess(c, rec)
+}
@@ -0,0 +1,92 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/mcontext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryServerInterceptor records matching gRPC calls. It can run before or after RpcServerInterceptor;
+// the operationID and user are taken from the context or, failing that, from the incoming metadata.
+func (r *Recorder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		operationID, userID := callIdentity(ctx)
+		cfg, ok := r.match(info.FullMethod, operationID, userID)
+		if !ok {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		rec := &Record{
+			Kind:        KindGRPC,
+			Method:      info.FullMethod,
+			OperationID: operationID,
+			UserID:      userID,
+			Time:        start,
+			Latency:     time.Since(start),
+			Request:     marshalMessage(req),
+		}
+		if err != nil {
+			rec.Status = int(status.Code(err))
+			rec.Error = err.Error()
+		} else {
+			rec.Response = marshalMessage(resp)
+		}
+		r.save(cfg, rec)
+		return resp, err
+	}
+}
+
+func callIdentity(ctx context.Context) (operationID, userID string) {
+	operationID, userID = mcontext.GetOperationID(ctx), mcontext.GetOpUserID(ctx)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vs := md.Get(constant.OperationID); operationID == "" && len(vs) > 0 {
+			operationID = vs[0]
+		}
+		if vs := md.Get(constant.OpUserID); userID == "" && len(vs) > 0 {
+			userID = vs[0]
+		}
+	}
+	return operationID, userID
+}
+
+func marshalMessage(v any) []byte {
+	if v == nil {
+		return nil
+	}
+	var (
+		data []byte
+		err  error
+	)
+	if msg, ok := v.(proto.Message); ok {
+		data, err = protojson.Marshal(msg)
+	} else {
+		data, err = json.Marshal(v)
+	}
+	if err != nil {
+		return nil
+	}
+	return data
+}
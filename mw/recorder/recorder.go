@@ -0,0 +1,330 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recorder captures request and response payloads of selected HTTP and gRPC calls,
+// so that client reported problems can be replayed and inspected later.
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/utils/idutil"
+	"github.com/openimsdk/tools/utils/randutil"
+)
+
+const (
+	KindHTTP = "http"
+	KindGRPC = "grpc"
+)
+
+// maskValue replaces the value of sensitive fields in recorded payloads.
+const maskValue = "***"
+
+// Record is a single captured call.
+type Record struct {
+	ID          string        `json:"id"`
+	Kind        string        `json:"kind"`
+	Method      string        `json:"method"`
+	OperationID string        `json:"operationID"`
+	UserID      string        `json:"userID"`
+	Time        time.Time     `json:"time"`
+	Latency     time.Duration `json:"latency"`
+	Status      int           `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	Request     []byte        `json:"request"`
+	Response    []byte        `json:"response"`
+	Truncated   bool          `json:"truncated,omitempty"`
+}
+
+// Config decides which calls are recorded. The zero value records nothing.
+type Config struct {
+	Enable bool `json:"enable"`
+	// SampleRate is the fraction (0-1) of calls recorded regardless of operationID or user.
+	SampleRate float64 `json:"sampleRate"`
+	// OperationIDs and UserIDs are always recorded when Enable is set.
+	OperationIDs []string `json:"operationIDs"`
+	UserIDs      []string `json:"userIDs"`
+	// Methods restricts recording to full gRPC method names or HTTP path prefixes. Empty means all.
+	Methods []string `json:"methods"`
+	// MaxBodySize caps each stored payload in bytes. Zero uses DefaultMaxBodySize.
+	MaxBodySize int `json:"maxBodySize"`
+	// MaskFields lists JSON keys (case-insensitive) whose values are replaced before storing.
+	// Nil uses DefaultMaskFields.
+	MaskFields []string `json:"maskFields"`
+	// QueueSize bounds the records waiting to be stored; records arriving at a full queue are
+	// dropped. Zero uses DefaultQueueSize. Only the value passed to New is used.
+	QueueSize int `json:"queueSize"`
+}
+
+const (
+	DefaultMaxBodySize = 64 << 10
+	DefaultQueueSize   = 1024
+)
+
+var DefaultMaskFields = []string{"password", "token", "secret", "accessToken", "refreshToken", "authorization", "verifyCode"}
+
+type compiledConfig struct {
+	Config
+	operationIDs map[string]struct{}
+	userIDs      map[string]struct{}
+	masker       *Masker
+}
+
+func compile(cfg Config) *compiledConfig {
+	c := &compiledConfig{
+		Config:       cfg,
+		operationIDs: toSet(cfg.OperationIDs, false),
+		userIDs:      toSet(cfg.UserIDs, false),
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = DefaultMaxBodySize
+	}
+	if cfg.MaskFields == nil {
+		c.masker = NewMasker(DefaultMaskFields)
+	} else {
+		c.masker = NewMasker(cfg.MaskFields)
+	}
+	return c
+}
+
+func toSet(vs []string, lower bool) map[string]struct{} {
+	m := make(map[string]struct{}, len(vs))
+	for _, v := range vs {
+		if lower {
+			v = strings.ToLower(v)
+		}
+		m[v] = struct{}{}
+	}
+	return m
+}
+
+// Recorder selects, masks and stores calls. It is safe for concurrent use and its Config can be
+// changed at runtime with SetConfig. Records are stored by a background worker, stop it with Close.
+type Recorder struct {
+	store Store
+	cfg   atomic.Pointer[compiledConfig]
+	rand  func() float64
+
+	queue   chan pending
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// pending is a record waiting for the worker, with the config snapshot it matched.
+type pending struct {
+	cfg *compiledConfig
+	rec *Record
+}
+
+func New(store Store, cfg Config) *Recorder {
+	size := cfg.QueueSize
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	r := &Recorder{
+		store: store,
+		rand:  randutil.Float64,
+		queue: make(chan pending, size),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	r.SetConfig(cfg)
+	go r.run()
+	return r
+}
+
+// Close stores the records already queued and stops the worker. Records arriving afterwards are
+// dropped.
+func (r *Recorder) Close() {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+}
+
+// Dropped returns the number of records dropped because the queue was full or the Recorder closed.
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+func (r *Recorder) SetConfig(cfg Config) {
+	r.cfg.Store(compile(cfg))
+}
+
+func (r *Recorder) Config() Config {
+	return r.cfg.Load().Config
+}
+
+func (r *Recorder) Store() Store {
+	return r.store
+}
+
+// match reports whether a call should be recorded, returning the config snapshot to use for it.
+func (r *Recorder) match(method, operationID, userID string) (*compiledConfig, bool) {
+	cfg := r.cfg.Load()
+	if !cfg.Enable {
+		return nil, false
+	}
+	if len(cfg.Methods) > 0 {
+		var ok bool
+		for _, m := range cfg.Methods {
+			if strings.HasPrefix(method, m) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	if _, ok := cfg.operationIDs[operationID]; ok && operationID != "" {
+		return cfg, true
+	}
+	if _, ok := cfg.userIDs[userID]; ok && userID != "" {
+		return cfg, true
+	}
+	if cfg.SampleRate > 0 && r.rand() < cfg.SampleRate {
+		return cfg, true
+	}
+	return nil, false
+}
+
+// save queues the record for the worker without blocking, so that recording never affects the call
+// being recorded. The record is dropped when the queue is full.
+func (r *Recorder) save(cfg *compiledConfig, rec *Record) {
+	select {
+	case <-r.stop:
+		r.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case r.queue <- pending{cfg: cfg, rec: rec}:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	for {
+		select {
+		case p := <-r.queue:
+			r.write(p)
+		case <-r.stop:
+			for {
+				select {
+				case p := <-r.queue:
+					r.write(p)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write masks and truncates the payloads and stores the record. Failures are only logged.
+func (r *Recorder) write(p pending) {
+	rec := p.rec
+	ctx := mcontext.SetOperationID(context.Background(), rec.OperationID)
+	rec.ID = idutil.OperationIDGenerator()
+	var truncated bool
+	rec.Request, truncated = p.cfg.prepare(rec.Request)
+	rec.Truncated = truncated
+	rec.Response, truncated = p.cfg.prepare(rec.Response)
+	rec.Truncated = rec.Truncated || truncated
+	if err := r.store.Save(ctx, rec); err != nil {
+		log.ZWarn(ctx, "recorder save failed", err, "method", rec.Method)
+	}
+}
+
+func (c *compiledConfig) prepare(data []byte) ([]byte, bool) {
+	var truncated bool
+	if len(data) > c.MaxBodySize {
+		data, truncated = data[:c.MaxBodySize], true
+	}
+	return c.masker.Mask(data), truncated
+}
+
+// Masker hides the values of sensitive fields in JSON payloads.
+type Masker struct {
+	fields map[string]struct{}
+	// raw matches "key": value pairs textually, for payloads that are not valid JSON (e.g. truncated).
+	raw *regexp.Regexp
+}
+
+func NewMasker(fields []string) *Masker {
+	m := &Masker{fields: toSet(fields, true)}
+	if len(fields) > 0 {
+		quoted := make([]string, 0, len(fields))
+		for _, f := range fields {
+			quoted = append(quoted, regexp.QuoteMeta(f))
+		}
+		m.raw = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoted, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	}
+	return m
+}
+
+// Mask replaces the values of the configured keys anywhere in a JSON document. Data that is not valid
+// JSON is masked textually wherever a quoted key is followed by a colon.
+func (m *Masker) Mask(data []byte) []byte {
+	if len(m.fields) == 0 || len(data) == 0 {
+		return data
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return m.raw.ReplaceAll(data, []byte(`${1}"`+maskValue+`"`))
+	}
+	if !maskValueOf(v, m.fields) {
+		return data
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
+
+func maskValueOf(v any, fields map[string]struct{}) bool {
+	var changed bool
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if _, ok := fields[strings.ToLower(k)]; ok {
+				val[k] = maskValue
+				changed = true
+				continue
+			}
+			if maskValueOf(item, fields) {
+				changed = true
+			}
+		}
+	case []any:
+		for _, item := range val {
+			if maskValueOf(item, fields) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
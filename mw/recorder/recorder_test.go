@@ -0,0 +1,170 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestMask(t *testing.T) {
+	m := NewMasker(DefaultMaskFields)
+	out := m.Mask([]byte(`{"userID":"u1","Password":"p","nested":[{"token":"t","x":1}]}`))
+	assert.JSONEq(t, `{"userID":"u1","Password":"***","nested":[{"token":"***","x":1}]}`, string(out))
+	assert.Equal(t, "not json", string(m.Mask([]byte("not json"))))
+	assert.Equal(t, `{"token": "***", "secret":"***","name":"ab`, string(m.Mask([]byte(`{"token": "a\"b", "secret":12,"name":"ab`))))
+}
+
+func TestRingStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewRingStore(3)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, s.Save(ctx, &Record{ID: id, UserID: "u" + id}))
+	}
+	recs, err := s.List(ctx, Filter{})
+	require.NoError(t, err)
+	var ids []string
+	for _, rec := range recs {
+		ids = append(ids, rec.ID)
+	}
+	assert.Equal(t, []string{"d", "c", "b"}, ids)
+
+	_, err = s.Get(ctx, "a")
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	rec, err := s.Get(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, "uc", rec.UserID)
+
+	recs, err = s.List(ctx, Filter{UserID: "ub"})
+	require.NoError(t, err)
+	assert.Len(t, recs, 1)
+}
+
+func TestRecorderMatch(t *testing.T) {
+	r := New(NewRingStore(10), Config{Enable: true, OperationIDs: []string{"op1"}, UserIDs: []string{"u1"}})
+	r.rand = func() float64 { return 0.5 }
+	_, ok := r.match("/m", "op1", "")
+	assert.True(t, ok)
+	_, ok = r.match("/m", "", "u1")
+	assert.True(t, ok)
+	_, ok = r.match("/m", "op2", "u2")
+	assert.False(t, ok)
+
+	r.SetConfig(Config{Enable: true, SampleRate: 0.6, Methods: []string{"/user"}})
+	_, ok = r.match("/user/get", "", "")
+	assert.True(t, ok)
+	_, ok = r.match("/group/get", "", "")
+	assert.False(t, ok)
+
+	r.SetConfig(Config{OperationIDs: []string{"op1"}})
+	_, ok = r.match("/m", "op1", "")
+	assert.False(t, ok)
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewRingStore(10)
+	r := New(store, Config{Enable: true, UserIDs: []string{"u1"}, MaxBodySize: 32})
+	engine := gin.New()
+	engine.POST("/user/update", func(c *gin.Context) {
+		c.Set(constant.OpUserID, "u1")
+		c.Next()
+	}, r.Gin(), func(c *gin.Context) {
+		body, _ := c.GetRawData()
+		c.String(http.StatusOK, "echo:"+string(body))
+	})
+
+	payload := `{"password":"secret","nickname":"` + strings.Repeat("x", 40) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/user/update", strings.NewReader(payload))
+	req.Header.Set(constant.OperationID, "op-gin")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, "echo:"+payload, w.Body.String())
+	r.Close()
+
+	recs, err := store.List(context.Background(), Filter{OperationID: "op-gin"})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	rec := recs[0]
+	assert.Equal(t, "POST /user/update", rec.Method)
+	assert.Equal(t, http.StatusOK, rec.Status)
+	assert.True(t, rec.Truncated)
+	assert.Contains(t, string(rec.Request), `"password":"***"`)
+	assert.NotContains(t, string(rec.Request), "secret")
+	assert.NotEmpty(t, rec.ID)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	store := NewRingStore(10)
+	r := New(store, Config{Enable: true, OperationIDs: []string{"op-rpc"}})
+	ctx := mcontext.SetOperationID(context.Background(), "op-rpc")
+	interceptor := r.UnaryServerInterceptor()
+	resp, err := interceptor(ctx, wrapperspb.String("ping"), &grpc.UnaryServerInfo{FullMethod: "/svc/Ping"},
+		func(ctx context.Context, req any) (any, error) {
+			return wrapperspb.String("pong"), nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "pong", resp.(*wrapperspb.StringValue).Value)
+	r.Close()
+
+	recs, err := store.List(ctx, Filter{Method: "/svc/Ping"})
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	assert.Equal(t, `"ping"`, string(recs[0].Request))
+	assert.Equal(t, `"pong"`, string(recs[0].Response))
+}
+
+type blockingStore struct {
+	*RingStore
+	release chan struct{}
+}
+
+func (s *blockingStore) Save(ctx context.Context, rec *Record) error {
+	<-s.release
+	return s.RingStore.Save(ctx, rec)
+}
+
+func TestRecorderQueueFull(t *testing.T) {
+	store := &blockingStore{RingStore: NewRingStore(10), release: make(chan struct{})}
+	r := New(store, Config{Enable: true, OperationIDs: []string{"op"}, QueueSize: 1})
+	cfg := r.cfg.Load()
+	// The worker takes the first record and blocks on it, the second fills the queue.
+	r.save(cfg, &Record{OperationID: "op", Method: "1"})
+	require.Eventually(t, func() bool { return len(r.queue) == 0 }, time.Second, time.Millisecond)
+	r.save(cfg, &Record{OperationID: "op", Method: "2"})
+	r.save(cfg, &Record{OperationID: "op", Method: "3"})
+	assert.Equal(t, int64(1), r.Dropped())
+
+	close(store.release)
+	r.Close()
+	recs, err := store.List(context.Background(), Filter{})
+	require.NoError(t, err)
+	assert.Len(t, recs, 2)
+	r.save(cfg, &Record{OperationID: "op"})
+	assert.Equal(t, int64(2), r.Dropped())
+}
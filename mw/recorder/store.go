@@ -0,0 +1,199 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Filter narrows List results. Empty fields match everything.
+type Filter struct {
+	OperationID string
+	UserID      string
+	Method      string
+	Limit       int
+}
+
+func (f *Filter) match(rec *Record) bool {
+	return (f.OperationID == "" || f.OperationID == rec.OperationID) &&
+		(f.UserID == "" || f.UserID == rec.UserID) &&
+		(f.Method == "" || f.Method == rec.Method)
+}
+
+type Store interface {
+	Save(ctx context.Context, rec *Record) error
+	Get(ctx context.Context, id string) (*Record, error)
+	// List returns matching records, newest first.
+	List(ctx context.Context, filter Filter) ([]*Record, error)
+}
+
+// RingStore keeps the most recent records in memory.
+type RingStore struct {
+	mu    sync.RWMutex
+	buf   []*Record
+	next  int
+	count int
+}
+
+func NewRingStore(capacity int) *RingStore {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+	return &RingStore{buf: make([]*Record, capacity)}
+}
+
+func (s *RingStore) Save(_ context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf[s.next] = rec
+	s.next = (s.next + 1) % len(s.buf)
+	if s.count < len(s.buf) {
+		s.count++
+	}
+	return nil
+}
+
+func (s *RingStore) Get(_ context.Context, id string) (*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for i := 0; i < s.count; i++ {
+		if rec := s.at(i); rec.ID == id {
+			return rec, nil
+		}
+	}
+	return nil, errs.ErrRecordNotFound.WrapMsg("record not found", "id", id)
+}
+
+func (s *RingStore) List(_ context.Context, filter Filter) ([]*Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var res []*Record
+	for i := 0; i < s.count; i++ {
+		rec := s.at(i)
+		if !filter.match(rec) {
+			continue
+		}
+		res = append(res, rec)
+		if filter.Limit > 0 && len(res) >= filter.Limit {
+			break
+		}
+	}
+	return res, nil
+}
+
+// at returns the i-th newest record.
+func (s *RingStore) at(i int) *Record {
+	return s.buf[(s.next-1-i+2*len(s.buf))%len(s.buf)]
+}
+
+// S3Store uploads each record as a JSON object through presigned URLs, so it works with any s3.Interface
+// implementation. Records are indexed in a RingStore so that List and Get of recent records stay local;
+// older records can still be fetched from the bucket by ID.
+type S3Store struct {
+	s3     s3.Interface
+	prefix string
+	client *http.Client
+	index  *RingStore
+}
+
+func NewS3Store(impl s3.Interface, prefix string, indexCapacity int) *S3Store {
+	return &S3Store{
+		s3:     impl,
+		prefix: prefix,
+		client: &http.Client{Timeout: 30 * time.Second},
+		index:  NewRingStore(indexCapacity),
+	}
+}
+
+func (s *S3Store) objectName(id string) string {
+	return path.Join(s.prefix, id+".json")
+}
+
+func (s *S3Store) Save(ctx context.Context, rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errs.WrapMsg(err, "record marshal failed")
+	}
+	res, err := s.s3.PresignedPutObject(ctx, s.objectName(rec.ID), time.Minute, &s3.PutOption{ContentType: "application/json"})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, res.URL, bytes.NewReader(data))
+	if err != nil {
+		return errs.WrapMsg(err, "new put request failed")
+	}
+	for k, vs := range res.Header {
+		req.Header[k] = vs
+	}
+	if err := s.do(req, nil); err != nil {
+		return err
+	}
+	// Keep only metadata in memory; payloads are fetched from the bucket on Get.
+	meta := *rec
+	meta.Request, meta.Response = nil, nil
+	return s.index.Save(ctx, &meta)
+}
+
+func (s *S3Store) Get(ctx context.Context, id string) (*Record, error) {
+	u, err := s.s3.AccessURL(ctx, s.objectName(id), time.Minute, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "new get request failed")
+	}
+	var rec Record
+	if err := s.do(req, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+func (s *S3Store) List(ctx context.Context, filter Filter) ([]*Record, error) {
+	return s.index.List(ctx, filter)
+}
+
+func (s *S3Store) do(req *http.Request, out any) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errs.WrapMsg(err, "s3 request failed", "method", req.Method)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errs.ErrRecordNotFound.WrapMsg("record not found", "url", req.URL.Path)
+	}
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return errs.New("s3 request failed", "method", req.Method, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errs.WrapMsg(err, "record unmarshal failed")
+	}
+	return nil
+}
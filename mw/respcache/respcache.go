@@ -0,0 +1,324 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package respcache caches successful GET responses in Redis, keyed by the
+// normalized URL and the requesting user, to take load off hot read
+// endpoints like public group info. Entries are grouped by tags so writes
+// can invalidate them explicitly.
+package respcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// Header reports whether a response was served from the cache.
+const Header = "X-Cache"
+
+// Config configures a Cache.
+type Config struct {
+	KeyPrefix string        // Defaults to "RESPCACHE:".
+	TTL       time.Duration // Defaults to 1 minute. A shorter max-age of the response wins.
+	// Shared caches one response for all users. Only use it for responses
+	// that do not depend on the caller.
+	Shared bool
+	// IgnoreParams are query parameters left out of the key, e.g. cache
+	// busters like "_".
+	IgnoreParams []string
+	// MaxBodySize skips caching larger responses, defaults to 1 MiB.
+	MaxBodySize int
+	// Tags returns the tags of a cached response for InvalidateTags, e.g.
+	// "group:"+groupID. The route path is always a tag.
+	Tags func(c *gin.Context) []string
+}
+
+// Cache caches responses in Redis.
+type Cache struct {
+	rdb    redis.UniversalClient
+	conf   Config
+	ignore map[string]struct{}
+}
+
+// New creates a Cache.
+func New(rdb redis.UniversalClient, conf Config) *Cache {
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = "RESPCACHE:"
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = time.Minute
+	}
+	if conf.MaxBodySize <= 0 {
+		conf.MaxBodySize = 1 << 20
+	}
+	ignore := make(map[string]struct{}, len(conf.IgnoreParams))
+	for _, p := range conf.IgnoreParams {
+		ignore[p] = struct{}{}
+	}
+	return &Cache{rdb: rdb, conf: conf, ignore: ignore}
+}
+
+type entry struct {
+	Status      int       `json:"status"`
+	ContentType string    `json:"contentType"`
+	Body        []byte    `json:"body"`
+	Stored      time.Time `json:"stored"`
+}
+
+// key returns the cache key of the request, or false if it is not cacheable.
+func (c *Cache) key(ctx *gin.Context) (string, bool) {
+	user := ctx.GetString(constant.OpUserID)
+	if !c.conf.Shared && user == "" {
+		// Without a user the response could be mixed up between callers.
+		return "", false
+	}
+	query := ctx.Request.URL.Query()
+	for p := range c.ignore {
+		query.Del(p)
+	}
+	u := path.Clean("/"+ctx.Request.URL.Path) + "?" + query.Encode()
+	if !c.conf.Shared {
+		u += "\x00" + user
+	}
+	sum := sha1.Sum([]byte(u))
+	return c.conf.KeyPrefix + hex.EncodeToString(sum[:]), true
+}
+
+func (c *Cache) tagKey(tag string) string {
+	return c.conf.KeyPrefix + "TAG:" + tag
+}
+
+// pathTag is the tag every response of a route carries.
+func pathTag(route string) string {
+	return "path:" + route
+}
+
+// directives parses a Cache-Control header.
+func directives(header string) map[string]string {
+	res := make(map[string]string)
+	for _, d := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if k != "" {
+			res[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return res
+}
+
+type bodyWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *bodyWriter) capture(p []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(p) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(p)
+}
+
+func (w *bodyWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Gin returns the caching middleware. Place it after GinParseToken so the
+// user is known. Requests with "Cache-Control: no-cache" skip the lookup and
+// refresh the entry, "no-store" bypasses the cache. Responses are stored if
+// they are 200 with a successful apiresp envelope and do not say no-store
+// or, for shared caches, private.
+func (c *Cache) Gin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet {
+			ctx.Next()
+			return
+		}
+		req := directives(ctx.GetHeader("Cache-Control"))
+		if _, ok := req["no-store"]; ok {
+			ctx.Next()
+			return
+		}
+		key, ok := c.key(ctx)
+		if !ok {
+			ctx.Next()
+			return
+		}
+		if _, ok := req["no-cache"]; !ok {
+			if e, err := c.load(ctx, key); err != nil {
+				log.ZWarn(ctx, "load cached response failed", err, "path", ctx.Request.URL.Path)
+			} else if e != nil {
+				ctx.Header(Header, "HIT")
+				ctx.Header("Age", strconv.Itoa(int(time.Since(e.Stored).Seconds())))
+				ctx.Data(e.Status, e.ContentType, e.Body)
+				ctx.Abort()
+				return
+			}
+		}
+		ctx.Header(Header, "MISS")
+		w := &bodyWriter{ResponseWriter: ctx.Writer, limit: c.conf.MaxBodySize}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+
+		ttl, ok := c.ttl(ctx, w)
+		if !ok {
+			return
+		}
+		e := &entry{Status: w.Status(), ContentType: w.Header().Get("Content-Type"), Body: w.buf.Bytes(), Stored: time.Now()}
+		var tags []string
+		if route := ctx.FullPath(); route != "" {
+			tags = append(tags, pathTag(route))
+		}
+		if c.conf.Tags != nil {
+			tags = append(tags, c.conf.Tags(ctx)...)
+		}
+		if err := c.store(ctx, key, e, ttl, tags); err != nil {
+			log.ZWarn(ctx, "store cached response failed", err, "path", ctx.Request.URL.Path)
+		}
+	}
+}
+
+// ttl decides whether the response is stored and for how long.
+func (c *Cache) ttl(ctx *gin.Context, w *bodyWriter) (time.Duration, bool) {
+	if w.Status() != http.StatusOK || w.overflow || len(ctx.Errors) > 0 {
+		return 0, false
+	}
+	if resp := apiresp.GetGinApiResponse(ctx); resp != nil && resp.ErrCode != 0 {
+		return 0, false
+	}
+	ttl := c.conf.TTL
+	resp := directives(w.Header().Get("Cache-Control"))
+	if _, ok := resp["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := resp["private"]; ok && c.conf.Shared {
+		return 0, false
+	}
+	if v, ok := resp["max-age"]; ok {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			return 0, false
+		}
+		ttl = min(ttl, time.Duration(seconds)*time.Second)
+	}
+	return ttl, true
+}
+
+func (c *Cache) load(ctx context.Context, key string) (*entry, error) {
+	data, err := c.rdb.Get(ctx, key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errs.Wrap(err)
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, errs.WrapMsg(err, "decode cached response failed", "key", key)
+	}
+	return &e, nil
+}
+
+func (c *Cache) store(ctx context.Context, key string, e *entry, ttl time.Duration, tags []string) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	pipe := c.rdb.Pipeline()
+	pipe.Set(ctx, key, data, ttl)
+	for _, tag := range tags {
+		tk := c.tagKey(tag)
+		pipe.SAdd(ctx, tk, key)
+		// Members may outlive their entry, the set only needs to outlive the
+		// newest one.
+		pipe.Expire(ctx, tk, c.conf.TTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errs.WrapMsg(err, "store cached response failed", "key", key)
+	}
+	return nil
+}
+
+// InvalidateTags removes the cached responses carrying any of tags.
+func (c *Cache) InvalidateTags(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		tk := c.tagKey(tag)
+		keys, err := c.rdb.SMembers(ctx, tk).Result()
+		if err != nil {
+			return errs.WrapMsg(err, "load cache tag failed", "tag", tag)
+		}
+		// Delete one by one, the keys may live in different cluster slots.
+		for _, key := range append(keys, tk) {
+			if err := c.rdb.Del(ctx, key).Err(); err != nil {
+				return errs.WrapMsg(err, "invalidate cached response failed", "tag", tag)
+			}
+		}
+	}
+	return nil
+}
+
+// InvalidatePaths removes the cached responses of routes, given as
+// registered with gin, e.g. "/group/info/:groupID".
+func (c *Cache) InvalidatePaths(ctx context.Context, routes ...string) error {
+	tags := make([]string, len(routes))
+	for i, route := range routes {
+		tags[i] = pathTag(route)
+	}
+	return c.InvalidateTags(ctx, tags...)
+}
+
+// Invalidate returns a middleware for write routes that invalidates the
+// tags returned by tags after the handler succeeded, e.g. the group info of
+// a group after it was renamed.
+func (c *Cache) Invalidate(tags func(ctx *gin.Context) []string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Next()
+		if ctx.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		if resp := apiresp.GetGinApiResponse(ctx); resp != nil && resp.ErrCode != 0 {
+			return
+		}
+		if err := c.InvalidateTags(ctx, tags(ctx)...); err != nil {
+			log.ZWarn(ctx, "invalidate cached responses failed", err, "path", ctx.Request.URL.Path)
+		}
+	}
+}
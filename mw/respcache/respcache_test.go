@@ -0,0 +1,118 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package respcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/protocol/constant"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+)
+
+func request(target, user string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	if user != "" {
+		c.Set(constant.OpUserID, user)
+	}
+	return c
+}
+
+func TestKey(t *testing.T) {
+	c := New(nil, Config{IgnoreParams: []string{"_"}})
+	k1, ok := c.key(request("/group/info?b=2&a=1&_=123", "u1"))
+	assert.True(t, ok)
+	k2, _ := c.key(request("/group//info?a=1&b=2", "u1"))
+	assert.Equal(t, k1, k2)
+	k3, _ := c.key(request("/group/info?a=1&b=2", "u2"))
+	assert.NotEqual(t, k1, k3)
+	k4, _ := c.key(request("/group/info?a=1&b=3", "u1"))
+	assert.NotEqual(t, k1, k4)
+	_, ok = c.key(request("/group/info", ""))
+	assert.False(t, ok)
+
+	shared := New(nil, Config{Shared: true})
+	s1, ok := shared.key(request("/group/info?a=1", ""))
+	assert.True(t, ok)
+	s2, _ := shared.key(request("/group/info?a=1", "u1"))
+	assert.Equal(t, s1, s2)
+}
+
+func TestDirectives(t *testing.T) {
+	assert.Equal(t, map[string]string{"no-cache": "", "max-age": "30", "private": ""}, directives(`no-cache, max-age="30",Private`))
+	assert.Empty(t, directives(""))
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := New(containers.Redis(t), Config{KeyPrefix: "RESPCACHE_TEST:", TTL: time.Minute})
+	var calls int
+	r := gin.New()
+	r.Use(func(ctx *gin.Context) { ctx.Set(constant.OpUserID, ctx.GetHeader("user")) })
+	r.GET("/group/info", c.Gin(), func(ctx *gin.Context) {
+		calls++
+		if ctx.Query("fail") != "" {
+			apiresp.GinError(ctx, errs.ErrArgs)
+			return
+		}
+		if ctx.Query("nostore") != "" {
+			ctx.Header("Cache-Control", "no-store")
+		}
+		apiresp.GinSuccess(ctx, map[string]int{"calls": calls})
+	})
+	r.POST("/group/set", c.Invalidate(func(ctx *gin.Context) []string { return []string{"path:/group/info"} }), func(ctx *gin.Context) {
+		apiresp.GinSuccess(ctx, nil)
+	})
+	get := func(target string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("user", "u1")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/group/info?id=1")
+	assert.Equal(t, "MISS", w.Header().Get(Header))
+	hit := get("/group/info?id=1")
+	assert.Equal(t, "HIT", hit.Header().Get(Header))
+	assert.Equal(t, w.Body.String(), hit.Body.String())
+	assert.Equal(t, 1, calls)
+
+	get("/group/info?id=1", "Cache-Control", "no-cache")
+	assert.Equal(t, 2, calls)
+	get("/group/info?id=1&fail=1")
+	get("/group/info?id=1&fail=1")
+	assert.Equal(t, 4, calls)
+	get("/group/info?id=1&nostore=1")
+	get("/group/info?id=1&nostore=1")
+	assert.Equal(t, 6, calls)
+
+	post := httptest.NewRequest(http.MethodPost, "/group/set", nil)
+	r.ServeHTTP(httptest.NewRecorder(), post)
+	assert.Equal(t, "MISS", get("/group/info?id=1").Header().Get(Header))
+	assert.NoError(t, c.InvalidatePaths(context.Background(), "/group/info"))
+	assert.Equal(t, "MISS", get("/group/info?id=1").Header().Get(Header))
+}
@@ -17,12 +17,15 @@ package mw
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/openimsdk/protocol/constant"
-	"github.com/openimsdk/protocol/errinfo"
 	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/errs/rpcstatus"
 	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/utils/ctxutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -52,6 +55,11 @@ func RpcClientInterceptor(ctx context.Context, method string, req, resp any, cc
 		log.ZInfo(ctx, "rpc client response success", "method", method, "resp", resp)
 		return nil
 	}
+	if ctxutil.IsContextError(err) {
+		cErr := ctxutil.ClassifyClient(ctx, err)
+		log.ZWarn(ctx, "rpc client call interrupted", cErr, "method", method, "req", req)
+		return cErr
+	}
 	if errors.As(err, new(errs.CodeError)) {
 		return err
 	}
@@ -65,16 +73,7 @@ func RpcClientInterceptor(ctx context.Context, method string, req, resp any, cc
 		log.ZError(ctx, "rpc client response failed GRPCStatus code is 0", err, "method", method, "req", req)
 		return errs.NewCodeError(errs.ServerInternalError, err.Error()).Wrap()
 	}
-	if details := sta.Details(); len(details) > 0 {
-		errInfo, ok := details[0].(*errinfo.ErrorInfo)
-		if ok {
-			s := strings.Join(errInfo.Warp, "->") + errInfo.Cause
-			cErr := errs.NewCodeError(int(sta.Code()), sta.Message()).WithDetail(s).Wrap()
-			log.ZAdaptive(ctx, "rpc client response failed", cErr, "method", method, "req", req)
-			return cErr
-		}
-	}
-	cErr := errs.NewCodeError(int(sta.Code()), sta.Message()).Wrap()
+	cErr := errs.Wrap(rpcstatus.FromStatus(sta))
 	log.ZAdaptive(ctx, "rpc client response failed", cErr, "method", method, "req", req)
 	return cErr
 }
@@ -112,6 +111,12 @@ func getRpcContext(ctx context.Context) (context.Context, error) {
 	if ok {
 		md.Set(constant.ConnID, connID)
 	}
+	if tenantID := mcontext.GetTenantID(ctx); tenantID != "" {
+		md.Set(mcontext.TenantID, tenantID)
+	}
+	if priority, ok := mcontext.LookupPriority(ctx); ok {
+		md.Set(mcontext.Priority, strconv.Itoa(priority))
+	}
 	return metadata.NewOutgoingContext(ctx, md), nil
 }
 
@@ -0,0 +1,217 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mw
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	CompressorGzip = gzip.Name
+	CompressorZstd = "zstd"
+)
+
+func init() {
+	encoding.RegisterCompressor(newZstdCompressor())
+}
+
+// compressionCounters are keyed by compressor name. The registered compressors
+// are left as they are, gzip in particular is grpc's own, and the traffic is
+// counted by compressionStatsHandler instead.
+var compressionCounters = []*compressionCounter{
+	{name: CompressorGzip},
+	{name: CompressorZstd},
+}
+
+// CompressionCounter counts messages passing through a compressor in one direction.
+type CompressionCounter struct {
+	Messages        int64
+	RawBytes        int64
+	CompressedBytes int64
+}
+
+// CompressionStats reports the traffic handled by a registered compressor.
+type CompressionStats struct {
+	Name     string
+	Sent     CompressionCounter
+	Received CompressionCounter
+}
+
+// CompressorStats returns the traffic counters of the gzip and zstd compressors,
+// counted on the servers and connections configured by RpcMessageConfig.
+func CompressorStats() []CompressionStats {
+	stats := make([]CompressionStats, 0, len(compressionCounters))
+	for _, c := range compressionCounters {
+		stats = append(stats, CompressionStats{
+			Name:     c.name,
+			Sent:     c.sent.load(),
+			Received: c.received.load(),
+		})
+	}
+	return stats
+}
+
+func counterOf(name string) *compressionCounter {
+	for _, c := range compressionCounters {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+type compressionCounter struct {
+	name     string
+	sent     counter
+	received counter
+}
+
+type counter struct {
+	messages, raw, compressed atomic.Int64
+}
+
+func (c *counter) add(raw, compressed int64) {
+	c.messages.Add(1)
+	c.raw.Add(raw)
+	c.compressed.Add(compressed)
+}
+
+func (c *counter) load() CompressionCounter {
+	return CompressionCounter{
+		Messages:        c.messages.Load(),
+		RawBytes:        c.raw.Load(),
+		CompressedBytes: c.compressed.Load(),
+	}
+}
+
+// compressionStatsHandler counts compressed payloads by the compressor named in
+// the headers of their call.
+type compressionStatsHandler struct{}
+
+type compressionStatsKey struct{}
+
+// rpcCompression holds the compressors of one call. Headers are handled before
+// the payloads they announce, but sends and receives of a stream may overlap.
+type rpcCompression struct {
+	mu         sync.Mutex
+	send, recv *compressionCounter
+}
+
+func (compressionStatsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, compressionStatsKey{}, &rpcCompression{})
+}
+
+func (compressionStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	rc, ok := ctx.Value(compressionStatsKey{}).(*rpcCompression)
+	if !ok {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	switch s := s.(type) {
+	case *stats.OutHeader:
+		rc.send = counterOf(s.Compression)
+	case *stats.InHeader:
+		rc.recv = counterOf(s.Compression)
+	case *stats.OutPayload:
+		if rc.send != nil {
+			rc.send.sent.add(int64(s.Length), int64(s.CompressedLength))
+		}
+	case *stats.InPayload:
+		if rc.recv != nil {
+			rc.recv.received.add(int64(s.Length), int64(s.CompressedLength))
+		}
+	}
+}
+
+func (compressionStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (compressionStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// zstdCompressor implements encoding.Compressor with pooled zstd encoders and decoders.
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func newZstdCompressor() *zstdCompressor {
+	c := &zstdCompressor{}
+	c.encoders.New = func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return enc
+	}
+	c.decoders.New = func() any {
+		dec, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		return dec
+	}
+	return c
+}
+
+func (c *zstdCompressor) Name() string {
+	return CompressorZstd
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc := c.encoders.Get().(*zstd.Encoder)
+	enc.Reset(w)
+	return &zstdWriter{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec := c.decoders.Get().(*zstd.Decoder)
+	if err := dec.Reset(r); err != nil {
+		c.decoders.Put(dec)
+		return nil, err
+	}
+	return &zstdReader{Decoder: dec, pool: &c.decoders}, nil
+}
+
+type zstdWriter struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriter) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.Decoder == nil {
+		return 0, io.EOF
+	}
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.Decoder)
+		r.Decoder = nil
+	}
+	return n, err
+}
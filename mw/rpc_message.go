@@ -0,0 +1,116 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mw
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// RpcMessageConfig configures the message size limits and compression of a gRPC service.
+// Each service keeps its own config, so large responses such as group member lists
+// can be allowed and compressed only where they are needed.
+type RpcMessageConfig struct {
+	MaxRecvMsgSize    int    // Maximum size of a received message in bytes, 0 keeps the gRPC default of 4MB.
+	MaxSendMsgSize    int    // Maximum size of a sent message in bytes, 0 keeps the gRPC default.
+	Compressor        string // CompressorGzip, CompressorZstd or empty to disable compression.
+	CompressThreshold int    // Messages smaller than this many bytes are sent uncompressed.
+}
+
+// Validate checks that the sizes are not negative and the compressor is known.
+func (c *RpcMessageConfig) Validate() error {
+	if c.MaxRecvMsgSize < 0 || c.MaxSendMsgSize < 0 || c.CompressThreshold < 0 {
+		return errs.ErrArgs.WrapMsg("negative rpc message size", "maxRecvMsgSize", c.MaxRecvMsgSize,
+			"maxSendMsgSize", c.MaxSendMsgSize, "compressThreshold", c.CompressThreshold)
+	}
+	if c.Compressor != "" && encoding.GetCompressor(c.Compressor) == nil {
+		return errs.ErrArgs.WrapMsg("unknown rpc compressor", "compressor", c.Compressor)
+	}
+	return nil
+}
+
+// ServerOptions returns the options to pass to grpc.NewServer.
+func (c *RpcMessageConfig) ServerOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if c.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsgSize))
+	}
+	if c.Compressor != "" {
+		opts = append(opts, grpc.ChainUnaryInterceptor(c.serverCompressInterceptor),
+			grpc.StatsHandler(compressionStatsHandler{}))
+	}
+	return opts
+}
+
+// DialOptions returns the options to pass to grpc.Dial when dialing the service.
+func (c *RpcMessageConfig) DialOptions() []grpc.DialOption {
+	var (
+		opts     []grpc.DialOption
+		callOpts []grpc.CallOption
+	)
+	if c.MaxRecvMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(c.MaxRecvMsgSize))
+	}
+	if c.MaxSendMsgSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallSendMsgSize(c.MaxSendMsgSize))
+	}
+	if len(callOpts) > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(callOpts...))
+	}
+	if c.Compressor != "" {
+		opts = append(opts, grpc.WithChainUnaryInterceptor(c.clientCompressInterceptor),
+			grpc.WithStatsHandler(compressionStatsHandler{}))
+	}
+	return opts
+}
+
+func (c *RpcMessageConfig) shouldCompress(msg any) bool {
+	if c.CompressThreshold <= 0 {
+		return true
+	}
+	m, ok := msg.(proto.Message)
+	return ok && proto.Size(m) >= c.CompressThreshold
+}
+
+func (c *RpcMessageConfig) serverCompressInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	name := encoding.Identity
+	if c.shouldCompress(resp) {
+		name = c.Compressor
+	}
+	if err := grpc.SetSendCompressor(ctx, name); err != nil {
+		// The client did not advertise the compressor, keep the gRPC default.
+		log.ZDebug(ctx, "rpc set send compressor failed", "method", info.FullMethod, "compressor", name, "err", err)
+	}
+	return resp, nil
+}
+
+func (c *RpcMessageConfig) clientCompressInterceptor(ctx context.Context, method string, req, resp any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if c.shouldCompress(req) {
+		opts = append(opts, grpc.UseCompressor(c.Compressor))
+	}
+	return invoker(ctx, method, req, resp, cc, opts...)
+}
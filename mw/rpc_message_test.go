@@ -0,0 +1,141 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mw
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// echoService echoes the request payload repeated "times" times, where times
+// is the first byte of the payload.
+var echoService = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Echo",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			req := new(wrapperspb.BytesValue)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req any) (any, error) {
+				in := req.(*wrapperspb.BytesValue).Value
+				return wrapperspb.Bytes(bytes.Repeat(in, int(in[0]))), nil
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Echo"}, handler)
+		},
+	}},
+}
+
+func startEcho(t *testing.T, conf *RpcMessageConfig) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(conf.ServerOptions()...)
+	srv.RegisterService(&echoService, struct{}{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	opts := append(conf.DialOptions(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+	)
+	conn, err := grpc.Dial("bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func echo(conn *grpc.ClientConn, payload []byte) (*wrapperspb.BytesValue, error) {
+	resp := new(wrapperspb.BytesValue)
+	err := conn.Invoke(context.Background(), "/test.Echo/Echo", wrapperspb.Bytes(payload), resp)
+	return resp, err
+}
+
+func compressorStats(name string) CompressionStats {
+	for _, s := range CompressorStats() {
+		if s.Name == name {
+			return s
+		}
+	}
+	return CompressionStats{}
+}
+
+func TestRpcMessageCompression(t *testing.T) {
+	for _, name := range []string{CompressorGzip, CompressorZstd} {
+		t.Run(name, func(t *testing.T) {
+			conn := startEcho(t, &RpcMessageConfig{Compressor: name, CompressThreshold: 1024})
+			before := compressorStats(name)
+
+			small := []byte{1, 'a'}
+			resp, err := echo(conn, small)
+			require.NoError(t, err)
+			assert.Equal(t, small, resp.Value)
+			assert.Equal(t, before, compressorStats(name))
+
+			large := append([]byte{4}, bytes.Repeat([]byte("openim"), 1000)...)
+			resp, err = echo(conn, large)
+			require.NoError(t, err)
+			assert.Equal(t, bytes.Repeat(large, 4), resp.Value)
+
+			after := compressorStats(name)
+			// The request is compressed by the client and the response by the server,
+			// each side counts both directions.
+			assert.Equal(t, before.Sent.Messages+2, after.Sent.Messages)
+			assert.Equal(t, before.Received.Messages+2, after.Received.Messages)
+			sentRaw := after.Sent.RawBytes - before.Sent.RawBytes
+			sentCompressed := after.Sent.CompressedBytes - before.Sent.CompressedBytes
+			assert.Greater(t, sentRaw, int64(len(large)*5))
+			assert.Less(t, sentCompressed, sentRaw/10)
+		})
+	}
+}
+
+func TestRpcMessageSize(t *testing.T) {
+	conn := startEcho(t, &RpcMessageConfig{MaxRecvMsgSize: 8 << 20, MaxSendMsgSize: 8 << 20})
+	payload := append([]byte{2}, bytes.Repeat([]byte{'x'}, 3<<20)...)
+	resp, err := echo(conn, payload)
+	require.NoError(t, err)
+	assert.Len(t, resp.Value, len(payload)*2)
+
+	conn = startEcho(t, &RpcMessageConfig{})
+	_, err = echo(conn, payload)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRpcMessageConfigValidate(t *testing.T) {
+	assert.NoError(t, (&RpcMessageConfig{Compressor: CompressorZstd}).Validate())
+	assert.Error(t, (&RpcMessageConfig{Compressor: "brotli"}).Validate())
+	assert.Error(t, (&RpcMessageConfig{MaxRecvMsgSize: -1}).Validate())
+}
+
+func TestGzipRegistrationUntouched(t *testing.T) {
+	// grpc's gzip.SetLevel asserts the registered compressor is its own.
+	assert.NotPanics(t, func() { assert.NoError(t, gzip.SetLevel(6)) })
+}
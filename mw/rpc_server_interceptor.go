@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"strconv"
 
 	"github.com/openimsdk/protocol/constant"
-	"github.com/openimsdk/protocol/errinfo"
 	"github.com/openimsdk/tools/checker"
 	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/errs/rpcstatus"
 	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
 	"github.com/openimsdk/tools/mw/specialerror"
+	"github.com/openimsdk/tools/utils/ctxutil"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -39,7 +42,7 @@ func RpcServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerIn
 	}
 	resp, err := handler(ctx, req)
 	if err != nil {
-		return nil, handleError(ctx, method, req, err)
+		return nil, handleError(ctx, method, req, ctxutil.Classify(ctx, err))
 	}
 	log.ZInfo(ctx, "rpc server response success", "method", method, "req", req, "resp", resp)
 	return resp, nil
@@ -77,20 +80,21 @@ func enrichContextWithMetadata(ctx context.Context, md metadata.MD) (context.Con
 	if opts := md.Get(constant.ConnID); len(opts) == 1 {
 		ctx = context.WithValue(ctx, constant.ConnID, opts[0])
 	}
+	if opts := md.Get(mcontext.TenantID); len(opts) == 1 {
+		ctx = mcontext.SetTenantID(ctx, opts[0])
+	}
+	if opts := md.Get(mcontext.Priority); len(opts) == 1 {
+		if priority, err := strconv.Atoi(opts[0]); err == nil {
+			ctx = mcontext.SetPriority(ctx, priority)
+		}
+	}
 	return ctx, nil
 }
 
 func handleError(ctx context.Context, method string, req any, err error) error {
 	codeErr := getErrData(err)
 	log.ZAdaptive(ctx, "rpc server response failed", err, "method", method, "req", req)
-	grpcStatus := status.New(codes.Code(codeErr.Code()), codeErr.Msg())
-	errInfo := &errinfo.ErrorInfo{Cause: codeErr.Detail()}
-	details, err := grpcStatus.WithDetails(errInfo)
-	if err != nil {
-		log.ZError(ctx, "rpc server response WithDetails failed", err, "method", method, "req", req)
-		return errs.WrapMsg(err, "rpc server resp WithDetails error", "err", err)
-	}
-	return details.Err()
+	return rpcstatus.NewStatus(codeErr, err).Err()
 }
 
 func getErrData(err error) errs.CodeError {
@@ -0,0 +1,63 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shed
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// HeaderRetryAfter carries the suggested back-off of a rejected call, in
+// seconds for HTTP and milliseconds in the gRPC header "retry-after-ms".
+const (
+	HeaderRetryAfter   = "Retry-After"
+	HeaderRetryAfterMs = "retry-after-ms"
+)
+
+// Gin sheds HTTP requests, using the request path as method.
+func (s *Shedder) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done, err := s.Admit(s.Priority(c, c.Request.URL.Path))
+		if err != nil {
+			c.Header(HeaderRetryAfter, strconv.Itoa(int(math.Ceil(s.conf.RetryAfter.Seconds()))))
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		defer done()
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor sheds gRPC calls. Chain it after
+// RpcServerInterceptor so its errors are converted to status codes and
+// priorities can use the request context.
+func (s *Shedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done, err := s.Admit(s.Priority(ctx, info.FullMethod))
+		if err != nil {
+			_ = grpc.SetHeader(ctx, metadata.Pairs(HeaderRetryAfterMs, strconv.FormatInt(s.conf.RetryAfter.Milliseconds(), 10)))
+			return nil, err
+		}
+		defer done()
+		return handler(ctx, req)
+	}
+}
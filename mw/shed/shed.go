@@ -0,0 +1,290 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package shed implements adaptive load shedding for HTTP and gRPC servers.
+// Calls carry a priority, 0 being the most important. When the server is
+// overloaded, judged by in-flight calls, p99 latency and CPU usage, the lowest
+// priorities are rejected first with ErrOverloaded so clients can back off.
+// Priority 0 is never shed.
+package shed
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/shirou/gopsutil/cpu"
+)
+
+const OverloadedError = 1871 // The server sheds load, retry later.
+
+var ErrOverloaded = errs.NewCodeError(OverloadedError, "OverloadedError")
+
+func init() {
+	// Rejected calls never ran, so they are safe to retry elsewhere or later.
+	errs.SetRetryClass(OverloadedError, errs.Retryable)
+}
+
+// Config configures a Shedder. Every signal is disabled when its limit is zero.
+type Config struct {
+	Levels int // Number of priorities, defaults to 4.
+	// MaxInflight is the number of concurrent calls above which calls below
+	// priority 0 are rejected right away.
+	MaxInflight int64
+	// TargetLatency is the p99 latency above which the server counts as
+	// overloaded.
+	TargetLatency time.Duration
+	// MaxCPU is the CPU usage in percent above which the server counts as
+	// overloaded.
+	MaxCPU float64
+	// Interval is how often Run samples latency and CPU and adjusts the shed
+	// priorities, defaults to 1 second.
+	Interval time.Duration
+	// RetryAfter is suggested to rejected clients, defaults to 1 second.
+	RetryAfter time.Duration
+	// Methods maps method prefixes, e.g. gRPC full methods or HTTP paths, to
+	// priorities. The longest matching prefix wins.
+	Methods map[string]int
+	// DefaultPriority applies to unmatched methods.
+	DefaultPriority int
+	// Priority overrides how the priority of a call is derived. By default
+	// a priority set in mcontext wins over Methods.
+	Priority func(ctx context.Context, method string) int
+	// CPU samples the CPU usage in percent since the previous call, defaults
+	// to the usage of all cores.
+	CPU func() (float64, error)
+}
+
+// Stats reports the state of a Shedder.
+type Stats struct {
+	Inflight int64
+	P99      time.Duration // Of the last interval.
+	CPU      float64       // Of the last interval.
+	// Shed is the number of lowest priorities currently rejected.
+	Shed     int
+	Admitted []int64 // Admitted calls by priority.
+	Rejected []int64 // Rejected calls by priority.
+}
+
+// Shedder decides whether calls are admitted.
+type Shedder struct {
+	conf     Config
+	prefixes []string // Method prefixes, longest first.
+
+	inflight atomic.Int64
+	shed     atomic.Int32
+	admitted []atomic.Int64
+	rejected []atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	p99       time.Duration
+	cpu       float64
+}
+
+// New creates a Shedder.
+func New(conf Config) *Shedder {
+	if conf.Levels <= 0 {
+		conf.Levels = 4
+	}
+	if conf.Interval <= 0 {
+		conf.Interval = time.Second
+	}
+	if conf.RetryAfter <= 0 {
+		conf.RetryAfter = time.Second
+	}
+	if conf.CPU == nil {
+		conf.CPU = func() (float64, error) {
+			res, err := cpu.Percent(0, false)
+			if err != nil || len(res) == 0 {
+				return 0, err
+			}
+			return res[0], nil
+		}
+	}
+	s := &Shedder{
+		conf:     conf,
+		admitted: make([]atomic.Int64, conf.Levels),
+		rejected: make([]atomic.Int64, conf.Levels),
+	}
+	for prefix := range conf.Methods {
+		s.prefixes = append(s.prefixes, prefix)
+	}
+	sort.Slice(s.prefixes, func(i, j int) bool { return len(s.prefixes[i]) > len(s.prefixes[j]) })
+	return s
+}
+
+// Priority returns the priority of a call, clamped to the configured levels.
+func (s *Shedder) Priority(ctx context.Context, method string) int {
+	p := s.conf.DefaultPriority
+	if s.conf.Priority != nil {
+		p = s.conf.Priority(ctx, method)
+	} else if v, ok := mcontext.LookupPriority(ctx); ok {
+		p = v
+	} else {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(method, prefix) {
+				p = s.conf.Methods[prefix]
+				break
+			}
+		}
+	}
+	return s.clamp(p)
+}
+
+// clamp bounds p to the levels of s.
+func (s *Shedder) clamp(p int) int {
+	if p < 0 {
+		return 0
+	}
+	if p >= s.conf.Levels {
+		return s.conf.Levels - 1
+	}
+	return p
+}
+
+// Admit decides whether a call of the priority runs. When it does, the
+// returned function must be called once the call finished. Priorities out
+// of range are clamped like Priority does.
+func (s *Shedder) Admit(priority int) (func(), error) {
+	priority = s.clamp(priority)
+	if priority > 0 {
+		shed := int(s.shed.Load())
+		if priority >= s.conf.Levels-shed ||
+			(s.conf.MaxInflight > 0 && s.inflight.Load() >= s.conf.MaxInflight) {
+			s.rejected[priority].Add(1)
+			return nil, ErrOverloaded.WrapMsg("server overloaded", "priority", priority, "shed", shed)
+		}
+	}
+	s.admitted[priority].Add(1)
+	s.inflight.Add(1)
+	start := time.Now()
+	return func() {
+		s.inflight.Add(-1)
+		s.observe(time.Since(start))
+	}, nil
+}
+
+// maxSamples bounds the latencies kept per interval.
+const maxSamples = 4096
+
+func (s *Shedder) observe(d time.Duration) {
+	if s.conf.TargetLatency <= 0 {
+		return
+	}
+	s.mu.Lock()
+	if len(s.latencies) < maxSamples {
+		s.latencies = append(s.latencies, d)
+	}
+	s.mu.Unlock()
+}
+
+// p99 returns the 99th percentile of latencies, which it sorts.
+func p99(latencies []time.Duration) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies[(len(latencies)*99-1)/100]
+}
+
+// load returns how far the busiest signal is above its limit, 1 meaning at
+// the limit.
+func (s *Shedder) load(latency time.Duration, cpu float64) float64 {
+	var load float64
+	if s.conf.MaxInflight > 0 {
+		load = max(load, float64(s.inflight.Load())/float64(s.conf.MaxInflight))
+	}
+	if s.conf.TargetLatency > 0 {
+		load = max(load, float64(latency)/float64(s.conf.TargetLatency))
+	}
+	if s.conf.MaxCPU > 0 {
+		load = max(load, cpu/s.conf.MaxCPU)
+	}
+	return load
+}
+
+// adjust sheds one more priority while overloaded and readmits one once the
+// load dropped clearly below the limits, so the level does not flap.
+func (s *Shedder) adjust(load float64) int {
+	shed := int(s.shed.Load())
+	switch {
+	case load > 1 && shed < s.conf.Levels-1:
+		shed++
+	case load < 0.8 && shed > 0:
+		shed--
+	}
+	s.shed.Store(int32(shed))
+	return shed
+}
+
+// tick samples the signals of the last interval and adjusts shedding.
+func (s *Shedder) tick(ctx context.Context) {
+	s.mu.Lock()
+	latencies := s.latencies
+	s.latencies = make([]time.Duration, 0, len(latencies))
+	s.mu.Unlock()
+	latency := p99(latencies)
+	var usage float64
+	if s.conf.MaxCPU > 0 {
+		var err error
+		if usage, err = s.conf.CPU(); err != nil {
+			log.ZWarn(ctx, "sample cpu failed", err)
+		}
+	}
+	s.mu.Lock()
+	s.p99, s.cpu = latency, usage
+	s.mu.Unlock()
+	before := int(s.shed.Load())
+	if shed := s.adjust(s.load(latency, usage)); shed != before {
+		log.ZWarn(ctx, "load shedding changed", nil, "shed", shed, "p99", latency, "cpu", usage, "inflight", s.inflight.Load())
+	}
+}
+
+// Run adjusts shedding by latency and CPU every Interval until ctx is done.
+// Without Run only MaxInflight is enforced.
+func (s *Shedder) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.tick(ctx)
+		}
+	}
+}
+
+// Stats returns the state of the shedder.
+func (s *Shedder) Stats() Stats {
+	s.mu.Lock()
+	st := Stats{P99: s.p99, CPU: s.cpu}
+	s.mu.Unlock()
+	st.Inflight = s.inflight.Load()
+	st.Shed = int(s.shed.Load())
+	st.Admitted = make([]int64, s.conf.Levels)
+	st.Rejected = make([]int64, s.conf.Levels)
+	for i := range st.Admitted {
+		st.Admitted[i] = s.admitted[i].Load()
+		st.Rejected[i] = s.rejected[i].Load()
+	}
+	return st
+}
@@ -0,0 +1,136 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shed
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriority(t *testing.T) {
+	s := New(Config{
+		Methods:         map[string]int{"/msg.": 0, "/msg.msg/Import": 3, "/user.": 1},
+		DefaultPriority: 2,
+	})
+	ctx := context.Background()
+	assert.Equal(t, 0, s.Priority(ctx, "/msg.msg/SendMsg"))
+	assert.Equal(t, 3, s.Priority(ctx, "/msg.msg/ImportMsgs"))
+	assert.Equal(t, 1, s.Priority(ctx, "/user.user/GetUsers"))
+	assert.Equal(t, 2, s.Priority(ctx, "/group.group/GetGroups"))
+
+	assert.Equal(t, 0, s.Priority(mcontext.SetPriority(ctx, mcontext.PrioritySystem), "/msg.msg/ImportMsgs"))
+
+	s = New(Config{Levels: 2, Priority: func(ctx context.Context, method string) int { return 9 }})
+	assert.Equal(t, 1, s.Priority(ctx, ""))
+}
+
+func TestShedLowestFirst(t *testing.T) {
+	s := New(Config{TargetLatency: time.Millisecond})
+	for i := 0; i < 2; i++ {
+		s.adjust(s.load(10*time.Millisecond, 0))
+	}
+	_, err := s.Admit(3)
+	assert.True(t, errors.Is(err, ErrOverloaded))
+	_, err = s.Admit(2)
+	assert.True(t, errors.Is(err, ErrOverloaded))
+	done, err := s.Admit(1)
+	require.NoError(t, err)
+	done()
+
+	for i := 0; i < 5; i++ {
+		s.adjust(s.load(10*time.Millisecond, 0))
+	}
+	assert.Equal(t, 3, int(s.shed.Load()))
+	done, err = s.Admit(0)
+	require.NoError(t, err)
+	done()
+
+	s.adjust(s.load(900*time.Microsecond, 0))
+	assert.Equal(t, 3, int(s.shed.Load()))
+	s.adjust(s.load(100*time.Microsecond, 0))
+	assert.Equal(t, 2, int(s.shed.Load()))
+
+	st := s.Stats()
+	assert.Equal(t, []int64{1, 1, 0, 0}, st.Admitted)
+	assert.Equal(t, []int64{0, 0, 1, 1}, st.Rejected)
+}
+
+func TestMaxInflight(t *testing.T) {
+	s := New(Config{MaxInflight: 1})
+	done, err := s.Admit(1)
+	require.NoError(t, err)
+	_, err = s.Admit(1)
+	assert.True(t, errors.Is(err, ErrOverloaded))
+	done2, err := s.Admit(0)
+	require.NoError(t, err)
+	done()
+	done2()
+	done, err = s.Admit(1)
+	require.NoError(t, err)
+	done()
+}
+
+func TestAdmitOutOfRange(t *testing.T) {
+	s := New(Config{Levels: 3})
+	done, err := s.Admit(mcontext.PriorityBulk)
+	require.NoError(t, err)
+	done()
+	done, err = s.Admit(-1)
+	require.NoError(t, err)
+	done()
+}
+
+func TestCPU(t *testing.T) {
+	usage := 95.0
+	s := New(Config{MaxCPU: 80, CPU: func() (float64, error) { return usage, nil }})
+	s.tick(context.Background())
+	assert.Equal(t, 1, s.Stats().Shed)
+	usage = 10
+	s.tick(context.Background())
+	assert.Equal(t, 0, s.Stats().Shed)
+}
+
+func TestP99(t *testing.T) {
+	var latencies []time.Duration
+	for i := 100; i > 0; i-- {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 99*time.Millisecond, p99(latencies))
+	assert.Equal(t, time.Duration(0), p99(nil))
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := New(Config{MaxInflight: 1, DefaultPriority: 1})
+	done, err := s.Admit(0)
+	require.NoError(t, err)
+	defer done()
+	r := gin.New()
+	r.Use(s.Gin())
+	r.GET("/x", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+	assert.Equal(t, "1", w.Header().Get(HeaderRetryAfter))
+	assert.Contains(t, w.Body.String(), "1871")
+}
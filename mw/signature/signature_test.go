@@ -0,0 +1,144 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryNonces struct {
+	mu   sync.Mutex
+	used map[string]bool
+}
+
+func (m *memoryNonces) Use(ctx context.Context, keyID string, nonce string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.used[keyID+nonce] {
+		return false, nil
+	}
+	m.used[keyID+nonce] = true
+	return true, nil
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	v := &Verifier{Secrets: Secrets(map[string]string{"partner": "s3cret"}), Nonces: &memoryNonces{used: map[string]bool{}}}
+	r := gin.New()
+	r.Use(v.Gin())
+	r.POST("/callback", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, c.GetString(ContextKeyID)+":"+string(body))
+	})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func send(t *testing.T, req *http.Request) string {
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestSignAndVerify(t *testing.T) {
+	srv := newServer(t)
+	signer := &Signer{KeyID: "partner", Secret: []byte("s3cret")}
+	cli := &http.Client{Transport: signer.Transport(nil)}
+
+	resp, err := cli.Post(srv.URL+"/callback?b=2&a=1", "application/json", strings.NewReader(`{"x":1}`))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, `partner:{"x":1}`, string(body))
+
+	// Replaying the exact signed request is rejected.
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/callback", strings.NewReader("payload"))
+	require.NoError(t, signer.Sign(req))
+	header := req.Header.Clone()
+	assert.Equal(t, "partner:payload", send(t, req))
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", strings.NewReader("payload"))
+	req.Header = header
+	assert.Contains(t, send(t, req), strconv.Itoa(NonceReusedError))
+
+	// A tampered body fails.
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", strings.NewReader("payload"))
+	require.NoError(t, signer.Sign(req))
+	header = req.Header.Clone()
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", strings.NewReader("tampered"))
+	req.Header = header
+	assert.Contains(t, send(t, req), strconv.Itoa(SignatureInvalidError))
+
+	// Wrong secret and unknown key fail.
+	for _, s := range []*Signer{{KeyID: "partner", Secret: []byte("wrong")}, {KeyID: "other", Secret: []byte("s3cret")}} {
+		req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", nil)
+		require.NoError(t, s.Sign(req))
+		assert.Contains(t, send(t, req), strconv.Itoa(SignatureInvalidError))
+	}
+
+	// Stale timestamps fail.
+	old := &Signer{KeyID: "partner", Secret: []byte("s3cret"), Now: func() time.Time { return time.Now().Add(-time.Hour) }}
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", nil)
+	require.NoError(t, old.Sign(req))
+	assert.Contains(t, send(t, req), strconv.Itoa(SignatureExpiredError))
+
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/callback", nil)
+	assert.Contains(t, send(t, req), strconv.Itoa(SignatureInvalidError))
+}
+
+func TestStringToSign(t *testing.T) {
+	s := StringToSign("post", "/a", map[string][]string{"b": {"2", "1"}, "a": {"x y"}}, "1700000000", "n", nil)
+	assert.Equal(t, "POST\n/a\na=x+y&b=1&b=2\n1700000000\nn\ne3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", s)
+}
+
+func TestHandler(t *testing.T) {
+	v := &Verifier{Secrets: Secrets(map[string]string{"k": "s"})}
+	h := v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/admin?x=1", nil)
+	require.NoError(t, (&Signer{KeyID: "k", Secret: []byte("s")}).Sign(req))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, "ok", w.Body.String())
+}
+
+func TestRedisNonceCache(t *testing.T) {
+	rdb := containers.Redis(t)
+	c := NewRedisNonceCache(rdb, "")
+	nonce := strconv.FormatInt(time.Now().UnixNano(), 10)
+	ok, err := c.Use(context.Background(), "k", nonce, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Use(context.Background(), "k", nonce, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,80 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Signer signs outgoing requests with one key.
+type Signer struct {
+	KeyID  string
+	Secret []byte
+	// Now returns the signing time, time.Now when nil.
+	Now func() time.Time
+}
+
+// Sign adds the signature headers to r. The body is read and replaced so it
+// can still be sent.
+func (s *Signer) Sign(r *http.Request) error {
+	body, err := readBody(r, math.MaxInt64-1)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return errs.WrapMsg(err, "generate nonce failed")
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	timestamp := unixString(now())
+	nonceStr := hex.EncodeToString(nonce)
+	r.Header.Set(HeaderKeyID, s.KeyID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonceStr)
+	r.Header.Set(HeaderSignature, Sum(s.Secret, StringToSign(r.Method, r.URL.EscapedPath(), r.URL.Query(), timestamp, nonceStr, body)))
+	return nil
+}
+
+// Transport returns a RoundTripper signing every request before passing it to
+// base, http.DefaultTransport when nil.
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{signer: s, base: base}
+}
+
+type transport struct {
+	signer *Signer
+	base   http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// RoundTrippers must not modify the caller's request.
+	r = r.Clone(r.Context())
+	if err := t.signer.Sign(r); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(r)
+}
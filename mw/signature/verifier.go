@@ -0,0 +1,169 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package signature
+
+import (
+	"context"
+	"crypto/hmac"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+// ContextKeyID is the gin context key holding the verified key ID.
+const ContextKeyID = "signatureKeyID"
+
+// SecretFunc returns the secret of a key ID, or an error when the key is unknown.
+type SecretFunc func(ctx context.Context, keyID string) ([]byte, error)
+
+// Secrets returns a SecretFunc backed by a static map.
+func Secrets(secrets map[string]string) SecretFunc {
+	return func(ctx context.Context, keyID string) ([]byte, error) {
+		secret, ok := secrets[keyID]
+		if !ok {
+			return nil, ErrSignatureInvalid.WrapMsg("unknown signature key", "keyID", keyID)
+		}
+		return []byte(secret), nil
+	}
+}
+
+// NonceCache remembers used nonces. Use returns false when the nonce was
+// already used within ttl.
+type NonceCache interface {
+	Use(ctx context.Context, keyID string, nonce string, ttl time.Duration) (bool, error)
+}
+
+// NewRedisNonceCache returns a NonceCache storing nonces under keyPrefix,
+// "SIGNATURE_NONCE:" when empty.
+func NewRedisNonceCache(rdb redis.UniversalClient, keyPrefix string) NonceCache {
+	if keyPrefix == "" {
+		keyPrefix = "SIGNATURE_NONCE:"
+	}
+	return &redisNonceCache{rdb: rdb, prefix: keyPrefix}
+}
+
+type redisNonceCache struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func (c *redisNonceCache) Use(ctx context.Context, keyID string, nonce string, ttl time.Duration) (bool, error) {
+	ok, err := c.rdb.SetNX(ctx, c.prefix+keyID+":"+nonce, 1, ttl).Result()
+	if err != nil {
+		return false, errs.WrapMsg(err, "nonce cache set failed", "keyID", keyID)
+	}
+	return ok, nil
+}
+
+// Verifier checks signed requests.
+type Verifier struct {
+	Secrets SecretFunc
+	Nonces  NonceCache
+	// MaxSkew is the accepted distance between the timestamp and the local
+	// clock, defaults to 5 minutes. Nonces are kept twice as long.
+	MaxSkew time.Duration
+	// MaxBodySize bounds the body read for hashing, defaults to 4 MiB.
+	MaxBodySize int64
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+}
+
+// Verify checks the signature of r and returns the key ID it was signed with.
+// The body is read and replaced so handlers can still consume it.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	keyID := r.Header.Get(HeaderKeyID)
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if keyID == "" || timestamp == "" || nonce == "" || signature == "" {
+		return "", ErrSignatureInvalid.WrapMsg("missing signature headers")
+	}
+	if len(nonce) > 64 {
+		return "", ErrSignatureInvalid.WrapMsg("nonce too long")
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrSignatureInvalid.WrapMsg("invalid signature timestamp", "timestamp", timestamp)
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if skew := now().Sub(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+		return "", ErrSignatureExpired.WrapMsg("signature timestamp out of range", "timestamp", timestamp)
+	}
+	secret, err := v.Secrets(r.Context(), keyID)
+	if err != nil {
+		return "", err
+	}
+	limit := v.MaxBodySize
+	if limit <= 0 {
+		limit = 4 << 20
+	}
+	body, err := readBody(r, limit)
+	if err != nil {
+		return "", err
+	}
+	expected := Sum(secret, StringToSign(r.Method, r.URL.EscapedPath(), r.URL.Query(), timestamp, nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "", ErrSignatureInvalid.WrapMsg("signature mismatch", "keyID", keyID)
+	}
+	// The nonce is only recorded for valid signatures so forged requests
+	// cannot burn nonces of legitimate callers.
+	if v.Nonces != nil {
+		ok, err := v.Nonces.Use(r.Context(), keyID, nonce, 2*maxSkew)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			return "", ErrNonceReused.WrapMsg("signature nonce reused", "keyID", keyID, "nonce", nonce)
+		}
+	}
+	return keyID, nil
+}
+
+// Gin rejects requests without a valid signature and stores the key ID under ContextKeyID.
+func (v *Verifier) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID, err := v.Verify(c.Request)
+		if err != nil {
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		c.Set(ContextKeyID, keyID)
+		c.Next()
+	}
+}
+
+// Handler rejects requests without a valid signature before calling next.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := v.Verify(r); err != nil {
+			apiresp.HttpError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
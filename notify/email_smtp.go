@@ -0,0 +1,158 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// SMTPConfig configures the SMTP email sender.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // Empty disables authentication.
+	Password string
+	From     string // Sender address.
+	FromName string
+	// ImplicitTLS connects with TLS right away (usually port 465). Otherwise
+	// STARTTLS is used when the server offers it.
+	ImplicitTLS bool
+	TLSConfig   *tls.Config   // Nil verifies the server certificate against Host.
+	Timeout     time.Duration // Connection timeout, 0 for 10 seconds.
+}
+
+// SMTP sends email through an SMTP server, one connection per message.
+type SMTP struct {
+	conf SMTPConfig
+}
+
+// NewSMTP creates an SMTP sender.
+func NewSMTP(conf SMTPConfig) *SMTP {
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	if conf.TLSConfig == nil {
+		conf.TLSConfig = &tls.Config{ServerName: conf.Host}
+	}
+	return &SMTP{conf: conf}
+}
+
+func (s *SMTP) Name() string {
+	return "smtp"
+}
+
+func (s *SMTP) Channel() Channel {
+	return ChannelEmail
+}
+
+func (s *SMTP) Send(ctx context.Context, msg *Message) (*Result, error) {
+	addr := net.JoinHostPort(s.conf.Host, strconv.Itoa(s.conf.Port))
+	dialer := &net.Dialer{Timeout: s.conf.Timeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if s.conf.ImplicitTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: s.conf.TLSConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "addr", addr)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(s.conf.Timeout * 3)
+	}
+	_ = conn.SetDeadline(deadline)
+	c, err := smtp.NewClient(conn, s.conf.Host)
+	if err != nil {
+		conn.Close()
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "addr", addr)
+	}
+	defer c.Close()
+	if !s.conf.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(s.conf.TLSConfig); err != nil {
+				return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "starttls")
+			}
+		}
+	}
+	if s.conf.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.conf.Username, s.conf.Password, s.conf.Host)); err != nil {
+			return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "auth")
+		}
+	}
+	messageID, data := s.build(msg, time.Now())
+	if err := c.Mail(s.conf.From); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "mail")
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "rcpt", "to", msg.To)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "data")
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "data")
+	}
+	if err := w.Close(); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(err.Error(), "provider", s.Name(), "step", "data")
+	}
+	if err := c.Quit(); err != nil {
+		return nil, errs.WrapMsg(err, "smtp quit failed")
+	}
+	return &Result{MessageID: messageID}, nil
+}
+
+func (s *SMTP) build(msg *Message, now time.Time) (string, []byte) {
+	messageID := "<" + nonce() + "@" + s.conf.Host + ">"
+	contentType := "text/plain; charset=UTF-8"
+	if msg.HTML {
+		contentType = "text/html; charset=UTF-8"
+	}
+	var buf bytes.Buffer
+	header := func(k, v string) {
+		buf.WriteString(k + ": " + v + "\r\n")
+	}
+	header("From", (&mail.Address{Name: s.conf.FromName, Address: s.conf.From}).String())
+	header("To", (&mail.Address{Address: msg.To}).String())
+	header("Subject", mime.QEncoding.Encode("UTF-8", msg.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID)
+	header("MIME-Version", "1.0")
+	header("Content-Type", contentType)
+	header("Content-Transfer-Encoding", "base64")
+	buf.WriteString("\r\n")
+	body := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(body) > 76 {
+		buf.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	buf.WriteString(body + "\r\n")
+	return messageID, buf.Bytes()
+}
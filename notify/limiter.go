@@ -0,0 +1,90 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"sync"
+	"time"
+)
+
+// RecipientLimit limits messages per recipient within this process. Zero
+// fields disable the corresponding check.
+type RecipientLimit struct {
+	Interval     time.Duration // Minimum time between two messages.
+	Window       time.Duration // Length of the counting window.
+	MaxPerWindow int           // Maximum messages within Window.
+}
+
+type recipientLimiter struct {
+	limit RecipientLimit
+
+	mu    sync.Mutex
+	sent  map[string][]time.Time
+	calls int
+}
+
+func newRecipientLimiter(limit RecipientLimit) *recipientLimiter {
+	return &recipientLimiter{limit: limit, sent: make(map[string][]time.Time)}
+}
+
+func (l *recipientLimiter) retention() time.Duration {
+	return max(l.limit.Interval, l.limit.Window)
+}
+
+func (l *recipientLimiter) allow(key string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls++
+	if l.calls%1024 == 0 {
+		l.prune(now)
+	}
+	times := l.sent[key]
+	if len(times) > 0 && l.limit.Interval > 0 {
+		if wait := l.limit.Interval - now.Sub(times[len(times)-1]); wait > 0 {
+			return ErrRecipientRateLimited.WrapMsg("recipient messaged too recently", "retryAfter", wait.Round(time.Second).String())
+		}
+	}
+	if l.limit.Window > 0 && l.limit.MaxPerWindow > 0 {
+		times = trimBefore(times, now.Add(-l.limit.Window))
+		if len(times) >= l.limit.MaxPerWindow {
+			return ErrRecipientRateLimited.WrapMsg("recipient message quota exceeded", "max", l.limit.MaxPerWindow, "window", l.limit.Window.String())
+		}
+	}
+	if l.limit.Window <= 0 || l.limit.MaxPerWindow <= 0 {
+		// Only the last message matters for the interval check.
+		times = times[:0]
+	}
+	l.sent[key] = append(times, now)
+	return nil
+}
+
+func (l *recipientLimiter) prune(now time.Time) {
+	cutoff := now.Add(-l.retention())
+	for key, times := range l.sent {
+		if times = trimBefore(times, cutoff); len(times) == 0 {
+			delete(l.sent, key)
+		} else {
+			l.sent[key] = times
+		}
+	}
+}
+
+func trimBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,201 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package notify sends SMS and email through pluggable providers, rendering
+// content from named templates, limiting how often one recipient is messaged
+// and reporting every delivery attempt to callbacks.
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// Channel is the medium a Sender delivers through.
+type Channel string
+
+const (
+	ChannelSMS   Channel = "sms"
+	ChannelEmail Channel = "email"
+)
+
+const (
+	RecipientRateLimitedError = 1811 // The recipient was messaged too recently or too often.
+	DeliveryFailedError       = 1812 // The provider did not accept the message.
+)
+
+var (
+	ErrRecipientRateLimited = errs.NewCodeError(RecipientRateLimitedError, "RecipientRateLimitedError")
+	ErrDeliveryFailed       = errs.NewCodeError(DeliveryFailedError, "DeliveryFailedError")
+)
+
+// Message is a rendered message handed to a Sender.
+type Message struct {
+	To      string // Phone number in E.164 format or email address.
+	Subject string
+	Body    string
+	HTML    bool
+	// VendorTemplate is the template registered at the SMS vendor, for vendors
+	// that only send pre-approved templates.
+	VendorTemplate string
+	Params         map[string]string
+	// ParamNames orders Params for vendors with positional template parameters.
+	ParamNames []string
+}
+
+// OrderedParams returns the values of Params in ParamNames order.
+func (m *Message) OrderedParams() []string {
+	values := make([]string, len(m.ParamNames))
+	for i, name := range m.ParamNames {
+		values[i] = m.Params[name]
+	}
+	return values
+}
+
+// Result is returned by a Sender for an accepted message.
+type Result struct {
+	MessageID string // ID assigned by the provider.
+}
+
+// Sender delivers messages through one provider.
+type Sender interface {
+	Name() string
+	Channel() Channel
+	Send(ctx context.Context, msg *Message) (*Result, error)
+}
+
+// Delivery describes one delivery attempt passed to callbacks.
+type Delivery struct {
+	Channel  Channel
+	Provider string
+	To       string
+	Template string
+	Result   *Result
+	Err      error
+	Duration time.Duration
+}
+
+// Callback is invoked synchronously after every delivery attempt, including
+// attempts rejected by the recipient limit.
+type Callback func(ctx context.Context, d *Delivery)
+
+// Option configures a Notifier.
+type Option func(*Notifier)
+
+// WithSender sets the sender used for its channel.
+func WithSender(s Sender) Option {
+	return func(n *Notifier) {
+		n.senders[s.Channel()] = s
+	}
+}
+
+// WithTemplate registers a template under name.
+func WithTemplate(name string, t *Template) Option {
+	return func(n *Notifier) {
+		n.templates[name] = t
+	}
+}
+
+// WithRecipientLimit limits how often a single recipient is messaged.
+func WithRecipientLimit(limit RecipientLimit) Option {
+	return func(n *Notifier) {
+		n.limiter = newRecipientLimiter(limit)
+	}
+}
+
+// WithCallback adds a delivery callback.
+func WithCallback(cb Callback) Option {
+	return func(n *Notifier) {
+		n.callbacks = append(n.callbacks, cb)
+	}
+}
+
+// Notifier renders templates and sends them through the sender of a channel.
+type Notifier struct {
+	mu        sync.RWMutex
+	senders   map[Channel]Sender
+	templates map[string]*Template
+	limiter   *recipientLimiter
+	callbacks []Callback
+}
+
+// New creates a Notifier.
+func New(opts ...Option) *Notifier {
+	n := &Notifier{
+		senders:   make(map[Channel]Sender),
+		templates: make(map[string]*Template),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// SetSender replaces the sender of its channel at runtime.
+func (n *Notifier) SetSender(s Sender) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.senders[s.Channel()] = s
+}
+
+// SetTemplate registers or replaces a template at runtime.
+func (n *Notifier) SetTemplate(name string, t *Template) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.templates[name] = t
+}
+
+// Send renders the template with params and sends it to the recipient over channel.
+func (n *Notifier) Send(ctx context.Context, channel Channel, to string, template string, params map[string]string) (*Result, error) {
+	n.mu.RLock()
+	sender, ok := n.senders[channel]
+	tmpl := n.templates[template]
+	n.mu.RUnlock()
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("no sender for channel", "channel", channel)
+	}
+	if tmpl == nil {
+		return nil, errs.ErrArgs.WrapMsg("template not found", "template", template)
+	}
+	msg, err := tmpl.Render(sender.Name(), to, params)
+	if err != nil {
+		return nil, err
+	}
+	d := &Delivery{Channel: channel, Provider: sender.Name(), To: to, Template: template}
+	if n.limiter != nil {
+		if err := n.limiter.allow(string(channel)+":"+to, time.Now()); err != nil {
+			d.Err = err
+			n.notify(ctx, d)
+			return nil, err
+		}
+	}
+	start := time.Now()
+	d.Result, d.Err = sender.Send(ctx, msg)
+	d.Duration = time.Since(start)
+	if d.Err != nil {
+		log.ZWarn(ctx, "notify send failed", d.Err, "channel", channel, "provider", d.Provider, "template", template)
+	}
+	n.notify(ctx, d)
+	return d.Result, d.Err
+}
+
+func (n *Notifier) notify(ctx context.Context, d *Delivery) {
+	for _, cb := range n.callbacks {
+		cb(ctx, d)
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSender struct {
+	channel Channel
+	sent    []*Message
+	err     error
+}
+
+func (f *fakeSender) Name() string     { return "fake" }
+func (f *fakeSender) Channel() Channel { return f.channel }
+
+func (f *fakeSender) Send(ctx context.Context, msg *Message) (*Result, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.sent = append(f.sent, msg)
+	return &Result{MessageID: strconv.Itoa(len(f.sent))}, nil
+}
+
+var codeTemplate = &Template{
+	Subject:         "Your code",
+	Body:            "Code {{.code}}, valid for {{.minutes}} minutes.",
+	VendorTemplates: map[string]string{"fake": "SMS_1", "aliyun": "SMS_2", "tencent": "1001"},
+	ParamNames:      []string{"code", "minutes"},
+}
+
+func TestNotifier(t *testing.T) {
+	sms := &fakeSender{channel: ChannelSMS}
+	email := &fakeSender{channel: ChannelEmail}
+	var deliveries []*Delivery
+	n := New(
+		WithSender(sms),
+		WithSender(email),
+		WithTemplate("code", codeTemplate),
+		WithTemplate("welcome", &Template{Subject: "Hi {{.name}}", Body: "<b>{{.name}}</b>", HTML: true}),
+		WithRecipientLimit(RecipientLimit{Interval: time.Hour}),
+		WithCallback(func(ctx context.Context, d *Delivery) { deliveries = append(deliveries, d) }),
+	)
+	ctx := context.Background()
+	res, err := n.Send(ctx, ChannelSMS, "+8613800000000", "code", map[string]string{"code": "123456", "minutes": "5"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", res.MessageID)
+	assert.Equal(t, "Code 123456, valid for 5 minutes.", sms.sent[0].Body)
+	assert.Equal(t, "SMS_1", sms.sent[0].VendorTemplate)
+	assert.Equal(t, []string{"123456", "5"}, sms.sent[0].OrderedParams())
+
+	_, err = n.Send(ctx, ChannelSMS, "+8613800000000", "code", map[string]string{"code": "1"})
+	assert.True(t, ErrRecipientRateLimited.Is(err))
+	// The limit is per channel and recipient.
+	_, err = n.Send(ctx, ChannelEmail, "a@example.com", "welcome", map[string]string{"name": "<Ann>"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hi <Ann>", email.sent[0].Subject)
+	assert.Equal(t, "<b>&lt;Ann&gt;</b>", email.sent[0].Body)
+
+	_, err = n.Send(ctx, ChannelSMS, "+1", "missing", nil)
+	assert.True(t, errs.ErrArgs.Is(err))
+
+	require.Len(t, deliveries, 3)
+	assert.NoError(t, deliveries[0].Err)
+	assert.True(t, ErrRecipientRateLimited.Is(deliveries[1].Err))
+	assert.Equal(t, "welcome", deliveries[2].Template)
+}
+
+func TestRecipientLimitWindow(t *testing.T) {
+	l := newRecipientLimiter(RecipientLimit{Window: time.Hour, MaxPerWindow: 2})
+	now := time.Now()
+	require.NoError(t, l.allow("a", now))
+	require.NoError(t, l.allow("a", now.Add(time.Minute)))
+	assert.Error(t, l.allow("a", now.Add(2*time.Minute)))
+	require.NoError(t, l.allow("b", now.Add(2*time.Minute)))
+	require.NoError(t, l.allow("a", now.Add(61*time.Minute)))
+	l.prune(now.Add(3 * time.Hour))
+	assert.Empty(t, l.sent)
+}
+
+func TestAliyunSMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		signature := q.Get("Signature")
+		q.Del("Signature")
+		assert.Equal(t, aliyunSign("secret", http.MethodGet, aliyunCanonicalQuery(q)), signature)
+		assert.Equal(t, "SMS_2", q.Get("TemplateCode"))
+		assert.JSONEq(t, `{"code":"123456","minutes":"5"}`, q.Get("TemplateParam"))
+		if q.Get("PhoneNumbers") == "limited" {
+			_, _ = w.Write([]byte(`{"Code":"isv.BUSINESS_LIMIT_CONTROL","Message":"limited"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Code":"OK","Message":"OK","BizId":"biz1","RequestId":"r1"}`))
+	}))
+	defer srv.Close()
+	a := NewAliyunSMS(AliyunSMSConfig{AccessKeyID: "id", AccessKeySecret: "secret", SignName: "OpenIM", Endpoint: srv.URL})
+	msg, err := codeTemplate.Render(a.Name(), "13800000000", map[string]string{"code": "123456", "minutes": "5"})
+	require.NoError(t, err)
+	res, err := a.Send(context.Background(), msg)
+	require.NoError(t, err)
+	assert.Equal(t, "biz1", res.MessageID)
+
+	msg.To = "limited"
+	_, err = a.Send(context.Background(), msg)
+	assert.True(t, ErrRecipientRateLimited.Is(err))
+}
+
+func TestAliyunEncode(t *testing.T) {
+	assert.Equal(t, "a%20b%2A~%2F", aliyunEncode("a b*~/"))
+}
+
+func TestTencentSMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get("X-TC-Timestamp"), 10, 64)
+		want := tc3Authorization("sid", "skey", "sms", r.Host, payload, time.Unix(ts, 0))
+		assert.Equal(t, want, r.Header.Get("Authorization"))
+		assert.Equal(t, "SendSms", r.Header.Get("X-TC-Action"))
+		var req map[string]any
+		require.NoError(t, json.Unmarshal(payload, &req))
+		assert.Equal(t, []any{"123456", "5"}, req["TemplateParamSet"])
+		assert.Equal(t, "1001", req["TemplateId"])
+		_, _ = w.Write([]byte(`{"Response":{"SendStatusSet":[{"SerialNo":"s1","Code":"Ok","Message":"send success"}],"RequestId":"r1"}}`))
+	}))
+	defer srv.Close()
+	tc := NewTencentSMS(TencentSMSConfig{SecretID: "sid", SecretKey: "skey", SdkAppID: "1400", SignName: "OpenIM", Endpoint: srv.URL})
+	msg, err := codeTemplate.Render(tc.Name(), "+8613800000000", map[string]string{"code": "123456", "minutes": "5"})
+	require.NoError(t, err)
+	res, err := tc.Send(context.Background(), msg)
+	require.NoError(t, err)
+	assert.Equal(t, "s1", res.MessageID)
+}
+
+func TestTwilioSMS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		assert.Equal(t, "AC1", user)
+		assert.Equal(t, "tok", pass)
+		assert.Equal(t, "/2010-04-01/Accounts/AC1/Messages.json", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("To") == "+10" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":21211,"message":"invalid To"}`))
+			return
+		}
+		assert.Equal(t, "+15550000000", r.PostForm.Get("From"))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"sid":"SM1"}`))
+	}))
+	defer srv.Close()
+	tw := NewTwilioSMS(TwilioSMSConfig{AccountSID: "AC1", AuthToken: "tok", From: "+15550000000", Endpoint: srv.URL})
+	res, err := tw.Send(context.Background(), &Message{To: "+15551111111", Body: "hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "SM1", res.MessageID)
+	_, err = tw.Send(context.Background(), &Message{To: "+10", Body: "hi"})
+	assert.True(t, ErrDeliveryFailed.Is(err))
+}
+
+// fakeSMTP accepts a single message without TLS or authentication.
+func fakeSMTP(t *testing.T) (int, <-chan string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { lis.Close() })
+	data := make(chan string, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 fake")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				var body strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					body.WriteString(l)
+				}
+				data <- body.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return lis.Addr().(*net.TCPAddr).Port, data
+}
+
+func TestSMTP(t *testing.T) {
+	port, data := fakeSMTP(t)
+	s := NewSMTP(SMTPConfig{Host: "127.0.0.1", Port: port, From: "noreply@openim.io", FromName: "OpenIM"})
+	res, err := s.Send(context.Background(), &Message{To: "a@example.com", Subject: "验证码", Body: "Code 123456"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, res.MessageID)
+
+	mail := <-data
+	assert.Contains(t, mail, `From: "OpenIM" <noreply@openim.io>`)
+	assert.Contains(t, mail, "Subject: =?UTF-8?q?")
+	assert.Contains(t, mail, "Content-Type: text/plain; charset=UTF-8")
+	assert.Contains(t, mail, base64.StdEncoding.EncodeToString([]byte("Code 123456")))
+	assert.Contains(t, mail, "Message-ID: "+res.MessageID)
+}
@@ -0,0 +1,170 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const aliyunSMSEndpoint = "https://dysmsapi.aliyuncs.com"
+
+// AliyunSMSConfig configures the Aliyun SMS sender.
+type AliyunSMSConfig struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SignName        string
+	RegionID        string       // Empty for cn-hangzhou.
+	Endpoint        string       // Empty for https://dysmsapi.aliyuncs.com.
+	HTTPClient      *http.Client // Nil for http.DefaultClient.
+}
+
+// AliyunSMS sends template SMS through Aliyun. Messages must carry a vendor template.
+type AliyunSMS struct {
+	conf AliyunSMSConfig
+}
+
+// NewAliyunSMS creates an Aliyun SMS sender.
+func NewAliyunSMS(conf AliyunSMSConfig) *AliyunSMS {
+	if conf.RegionID == "" {
+		conf.RegionID = "cn-hangzhou"
+	}
+	if conf.Endpoint == "" {
+		conf.Endpoint = aliyunSMSEndpoint
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	return &AliyunSMS{conf: conf}
+}
+
+func (a *AliyunSMS) Name() string {
+	return "aliyun"
+}
+
+func (a *AliyunSMS) Channel() Channel {
+	return ChannelSMS
+}
+
+func (a *AliyunSMS) Send(ctx context.Context, msg *Message) (*Result, error) {
+	if msg.VendorTemplate == "" {
+		return nil, errs.ErrArgs.WrapMsg("aliyun sms requires a vendor template")
+	}
+	templateParam, err := json.Marshal(msg.Params)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "marshal template params failed")
+	}
+	query := url.Values{
+		"AccessKeyId":      {a.conf.AccessKeyID},
+		"Action":           {"SendSms"},
+		"Format":           {"JSON"},
+		"RegionId":         {a.conf.RegionID},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {nonce()},
+		"SignatureVersion": {"1.0"},
+		"Timestamp":        {time.Now().UTC().Format("2006-01-02T15:04:05Z")},
+		"Version":          {"2017-05-25"},
+		"PhoneNumbers":     {msg.To},
+		"SignName":         {a.conf.SignName},
+		"TemplateCode":     {msg.VendorTemplate},
+		"TemplateParam":    {string(templateParam)},
+	}
+	canonical := aliyunCanonicalQuery(query)
+	query.Set("Signature", aliyunSign(a.conf.AccessKeySecret, http.MethodGet, canonical))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.conf.Endpoint+"/?"+aliyunCanonicalQuery(query), nil)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create aliyun sms request failed")
+	}
+	_, body, err := doRequest(a.conf.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Code      string `json:"Code"`
+		Message   string `json:"Message"`
+		BizID     string `json:"BizId"`
+		RequestID string `json:"RequestId"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg("invalid aliyun response", "body", string(body))
+	}
+	if resp.Code != "OK" {
+		if resp.Code == "isv.BUSINESS_LIMIT_CONTROL" {
+			return nil, ErrRecipientRateLimited.WrapMsg(resp.Message, "provider", a.Name(), "code", resp.Code)
+		}
+		return nil, ErrDeliveryFailed.WrapMsg(resp.Message, "provider", a.Name(), "code", resp.Code, "requestID", resp.RequestID)
+	}
+	return &Result{MessageID: resp.BizID}, nil
+}
+
+// aliyunEncode percent-encodes as required by the Aliyun RPC signature.
+func aliyunEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.ReplaceAll(s, "+", "%20")
+	s = strings.ReplaceAll(s, "*", "%2A")
+	return strings.ReplaceAll(s, "%7E", "~")
+}
+
+func aliyunCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, aliyunEncode(k)+"="+aliyunEncode(query.Get(k)))
+	}
+	return strings.Join(parts, "&")
+}
+
+func aliyunSign(secret, method, canonical string) string {
+	stringToSign := method + "&" + aliyunEncode("/") + "&" + aliyunEncode(canonical)
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func nonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func doRequest(cli *http.Client, req *http.Request) (int, []byte, error) {
+	resp, err := cli.Do(req)
+	if err != nil {
+		return 0, nil, ErrDeliveryFailed.WrapMsg(err.Error(), "url", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, ErrDeliveryFailed.WrapMsg(err.Error(), "url", req.URL.Host)
+	}
+	return resp.StatusCode, body, nil
+}
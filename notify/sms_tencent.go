@@ -0,0 +1,159 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const tencentSMSEndpoint = "https://sms.tencentcloudapi.com"
+
+// TencentSMSConfig configures the Tencent Cloud SMS sender.
+type TencentSMSConfig struct {
+	SecretID   string
+	SecretKey  string
+	SdkAppID   string
+	SignName   string
+	Region     string       // Empty for ap-guangzhou.
+	Endpoint   string       // Empty for https://sms.tencentcloudapi.com.
+	HTTPClient *http.Client // Nil for http.DefaultClient.
+}
+
+// TencentSMS sends template SMS through Tencent Cloud. Its templates take
+// positional parameters, ordered by the template's ParamNames.
+type TencentSMS struct {
+	conf TencentSMSConfig
+}
+
+// NewTencentSMS creates a Tencent Cloud SMS sender.
+func NewTencentSMS(conf TencentSMSConfig) *TencentSMS {
+	if conf.Region == "" {
+		conf.Region = "ap-guangzhou"
+	}
+	if conf.Endpoint == "" {
+		conf.Endpoint = tencentSMSEndpoint
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	return &TencentSMS{conf: conf}
+}
+
+func (t *TencentSMS) Name() string {
+	return "tencent"
+}
+
+func (t *TencentSMS) Channel() Channel {
+	return ChannelSMS
+}
+
+func (t *TencentSMS) Send(ctx context.Context, msg *Message) (*Result, error) {
+	if msg.VendorTemplate == "" {
+		return nil, errs.ErrArgs.WrapMsg("tencent sms requires a vendor template")
+	}
+	payload, err := json.Marshal(map[string]any{
+		"PhoneNumberSet":   []string{msg.To},
+		"SmsSdkAppId":      t.conf.SdkAppID,
+		"SignName":         t.conf.SignName,
+		"TemplateId":       msg.VendorTemplate,
+		"TemplateParamSet": msg.OrderedParams(),
+	})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "marshal tencent sms request failed")
+	}
+	u, err := url.Parse(t.conf.Endpoint)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "invalid tencent sms endpoint", "endpoint", t.conf.Endpoint)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.conf.Endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create tencent sms request failed")
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-TC-Action", "SendSms")
+	req.Header.Set("X-TC-Version", "2021-01-11")
+	req.Header.Set("X-TC-Region", t.conf.Region)
+	req.Header.Set("X-TC-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("Authorization", tc3Authorization(t.conf.SecretID, t.conf.SecretKey, "sms", u.Host, payload, now))
+	_, body, err := doRequest(t.conf.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Response struct {
+			SendStatusSet []struct {
+				SerialNo string `json:"SerialNo"`
+				Code     string `json:"Code"`
+				Message  string `json:"Message"`
+			} `json:"SendStatusSet"`
+			Error *struct {
+				Code    string `json:"Code"`
+				Message string `json:"Message"`
+			} `json:"Error"`
+			RequestID string `json:"RequestId"`
+		} `json:"Response"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, ErrDeliveryFailed.WrapMsg("invalid tencent response", "body", string(body))
+	}
+	if e := resp.Response.Error; e != nil {
+		return nil, ErrDeliveryFailed.WrapMsg(e.Message, "provider", t.Name(), "code", e.Code, "requestID", resp.Response.RequestID)
+	}
+	if len(resp.Response.SendStatusSet) == 0 {
+		return nil, ErrDeliveryFailed.WrapMsg("empty tencent send status", "requestID", resp.Response.RequestID)
+	}
+	status := resp.Response.SendStatusSet[0]
+	if !strings.EqualFold(status.Code, "Ok") {
+		if strings.Contains(status.Code, "LimitExceeded") {
+			return nil, ErrRecipientRateLimited.WrapMsg(status.Message, "provider", t.Name(), "code", status.Code)
+		}
+		return nil, ErrDeliveryFailed.WrapMsg(status.Message, "provider", t.Name(), "code", status.Code)
+	}
+	return &Result{MessageID: status.SerialNo}, nil
+}
+
+// tc3Authorization signs a JSON POST with the TC3-HMAC-SHA256 algorithm.
+func tc3Authorization(secretID, secretKey, service, host string, payload []byte, now time.Time) string {
+	date := now.UTC().Format("2006-01-02")
+	payloadHash := sha256.Sum256(payload)
+	canonicalRequest := "POST\n/\n\ncontent-type:application/json; charset=utf-8\nhost:" + host + "\n\ncontent-type;host\n" + hex.EncodeToString(payloadHash[:])
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + service + "/tc3_request"
+	stringToSign := "TC3-HMAC-SHA256\n" + strconv.FormatInt(now.Unix(), 10) + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+	key := hmacSHA256([]byte("TC3"+secretKey), date)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "tc3_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	return "TC3-HMAC-SHA256 Credential=" + secretID + "/" + scope + ", SignedHeaders=content-type;host, Signature=" + signature
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
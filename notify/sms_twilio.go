@@ -0,0 +1,93 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const twilioEndpoint = "https://api.twilio.com"
+
+// TwilioSMSConfig configures the Twilio SMS sender.
+type TwilioSMSConfig struct {
+	AccountSID string
+	AuthToken  string
+	From       string       // Sender number or messaging service SID.
+	Endpoint   string       // Empty for https://api.twilio.com.
+	HTTPClient *http.Client // Nil for http.DefaultClient.
+}
+
+// TwilioSMS sends the rendered body as free text SMS through Twilio.
+type TwilioSMS struct {
+	conf TwilioSMSConfig
+}
+
+// NewTwilioSMS creates a Twilio SMS sender.
+func NewTwilioSMS(conf TwilioSMSConfig) *TwilioSMS {
+	if conf.Endpoint == "" {
+		conf.Endpoint = twilioEndpoint
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	return &TwilioSMS{conf: conf}
+}
+
+func (t *TwilioSMS) Name() string {
+	return "twilio"
+}
+
+func (t *TwilioSMS) Channel() Channel {
+	return ChannelSMS
+}
+
+func (t *TwilioSMS) Send(ctx context.Context, msg *Message) (*Result, error) {
+	form := url.Values{"To": {msg.To}, "Body": {msg.Body}}
+	if strings.HasPrefix(t.conf.From, "MG") {
+		form.Set("MessagingServiceSid", t.conf.From)
+	} else {
+		form.Set("From", t.conf.From)
+	}
+	endpoint := t.conf.Endpoint + "/2010-04-01/Accounts/" + t.conf.AccountSID + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create twilio request failed")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(t.conf.AccountSID, t.conf.AuthToken)
+	status, body, err := doRequest(t.conf.HTTPClient, req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		SID     string `json:"sid"`
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	_ = json.Unmarshal(body, &resp)
+	if status >= 300 {
+		if status == http.StatusTooManyRequests {
+			return nil, ErrRecipientRateLimited.WrapMsg(resp.Message, "provider", t.Name(), "code", resp.Code)
+		}
+		return nil, ErrDeliveryFailed.WrapMsg(resp.Message, "provider", t.Name(), "status", status, "code", resp.Code)
+	}
+	return &Result{MessageID: resp.SID}, nil
+}
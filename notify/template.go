@@ -0,0 +1,89 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notify
+
+import (
+	"bytes"
+	"sync"
+	"text/template"
+
+	htmltemplate "html/template"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Template describes how a message is rendered. Subject and Body are Go
+// templates executed with the params map, HTML bodies are escaped with
+// html/template. Vendors that only send pre-approved SMS templates use
+// VendorTemplates and ParamNames instead of the rendered body.
+type Template struct {
+	Subject         string
+	Body            string
+	HTML            bool
+	VendorTemplates map[string]string // Template code per sender name, e.g. "aliyun": "SMS_123".
+	ParamNames      []string
+
+	once    sync.Once
+	subject *template.Template
+	text    *template.Template
+	html    *htmltemplate.Template
+	err     error
+}
+
+func (t *Template) parse() error {
+	t.once.Do(func() {
+		if t.subject, t.err = template.New("subject").Option("missingkey=zero").Parse(t.Subject); t.err != nil {
+			return
+		}
+		if t.HTML {
+			t.html, t.err = htmltemplate.New("body").Option("missingkey=zero").Parse(t.Body)
+		} else {
+			t.text, t.err = template.New("body").Option("missingkey=zero").Parse(t.Body)
+		}
+	})
+	if t.err != nil {
+		return errs.WrapMsg(t.err, "parse notify template failed")
+	}
+	return nil
+}
+
+// Render renders the template for the named sender.
+func (t *Template) Render(sender string, to string, params map[string]string) (*Message, error) {
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, params); err != nil {
+		return nil, errs.WrapMsg(err, "render notify subject failed")
+	}
+	var err error
+	if t.HTML {
+		err = t.html.Execute(&body, params)
+	} else {
+		err = t.text.Execute(&body, params)
+	}
+	if err != nil {
+		return nil, errs.WrapMsg(err, "render notify body failed")
+	}
+	return &Message{
+		To:             to,
+		Subject:        subject.String(),
+		Body:           body.String(),
+		HTML:           t.HTML,
+		VendorTemplate: t.VendorTemplates[sender],
+		Params:         params,
+		ParamNames:     t.ParamNames,
+	}, nil
+}
@@ -0,0 +1,358 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pipeline composes processing stages, e.g. decode, enrich, persist
+// and publish, connected by bounded queues. Every stage runs its own workers;
+// a full queue blocks the stage before it, so a slow stage slows down
+// Submit instead of buffering without limit. Cancelling the context stops all
+// stages, and Stats reports throughput and latency per stage.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+var (
+	// ErrDrop is returned by a stage function to discard an item silently.
+	ErrDrop = errs.New("pipeline item dropped")
+	// ErrClosed is returned by Submit after Close.
+	ErrClosed = errs.New("pipeline is closed")
+)
+
+// Stage is one step of a pipeline, created with NewStage.
+type Stage struct {
+	name    string
+	in, out reflect.Type
+	fn      func(ctx context.Context, item any) (any, error)
+	workers int
+	queue   int
+	key     func(item any) string
+}
+
+// StageOption configures a Stage.
+type StageOption func(*Stage)
+
+// WithWorkers sets the number of goroutines of a stage, defaults to 1.
+func WithWorkers(n int) StageOption {
+	return func(s *Stage) {
+		s.workers = n
+	}
+}
+
+// WithQueue sets the capacity of the queue in front of a stage, defaults to 64.
+func WithQueue(n int) StageOption {
+	return func(s *Stage) {
+		s.queue = n
+	}
+}
+
+// WithKey routes items with the same key to the same worker, keeping their
+// order through the stage, e.g. messages of one conversation. Every worker
+// then has its own queue.
+func WithKey[In any](key func(item In) string) StageOption {
+	return func(s *Stage) {
+		s.key = func(item any) string {
+			return key(item.(In))
+		}
+	}
+}
+
+// NewStage creates a stage applying fn to every item. Returning ErrDrop
+// discards the item; other errors are reported to Config.OnError.
+func NewStage[In, Out any](name string, fn func(ctx context.Context, in In) (Out, error), opts ...StageOption) Stage {
+	s := Stage{
+		name: name,
+		in:   reflect.TypeOf((*In)(nil)).Elem(),
+		out:  reflect.TypeOf((*Out)(nil)).Elem(),
+		fn: func(ctx context.Context, item any) (any, error) {
+			return fn(ctx, item.(In))
+		},
+		workers: 1,
+		queue:   64,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if s.workers <= 0 {
+		s.workers = 1
+	}
+	if s.queue < 0 {
+		s.queue = 0
+	}
+	return s
+}
+
+// Config configures a Pipeline.
+type Config struct {
+	// OnError is called for every failed item. It defaults to logging.
+	OnError func(ctx context.Context, stage string, item any, err error)
+	// StopOnError cancels the pipeline on the first failed item; Close then
+	// returns that error.
+	StopOnError bool
+}
+
+// StageStats reports the activity of a stage.
+type StageStats struct {
+	Name       string
+	Workers    int
+	Queued     int   // Items waiting in the queue of the stage.
+	Processed  int64 // Items the stage function returned successfully.
+	Failed     int64
+	Dropped    int64
+	Latency    time.Duration // Summed time spent in the stage function.
+	MaxLatency time.Duration
+}
+
+// AvgLatency returns the mean time an item spent in the stage function.
+func (s *StageStats) AvgLatency() time.Duration {
+	n := s.Processed + s.Failed + s.Dropped
+	if n == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(n)
+}
+
+type runningStage struct {
+	Stage
+	inputs    []chan any
+	wg        sync.WaitGroup
+	processed atomic.Int64
+	failed    atomic.Int64
+	dropped   atomic.Int64
+	latency   atomic.Int64
+	maxLat    atomic.Int64
+}
+
+// input returns the queue of the worker handling item.
+func (s *runningStage) input(item any) chan any {
+	if len(s.inputs) == 1 {
+		return s.inputs[0]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s.key(item)))
+	return s.inputs[h.Sum32()%uint32(len(s.inputs))]
+}
+
+func (s *runningStage) send(ctx context.Context, item any) error {
+	select {
+	case s.input(item) <- item:
+		return nil
+	case <-ctx.Done():
+		return errs.Wrap(context.Cause(ctx))
+	}
+}
+
+func (s *runningStage) observe(d time.Duration) {
+	s.latency.Add(int64(d))
+	for {
+		max := s.maxLat.Load()
+		if int64(d) <= max || s.maxLat.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// Pipeline runs stages connected by bounded queues.
+type Pipeline struct {
+	conf   Config
+	stages []*runningStage
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu     sync.RWMutex
+	closed bool
+	done   chan struct{}
+	err    error
+}
+
+// Start validates that every stage accepts the output of the previous one
+// and starts the workers. Cancelling ctx stops the pipeline.
+func Start(ctx context.Context, conf Config, stages ...Stage) (*Pipeline, error) {
+	if len(stages) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("pipeline requires stages")
+	}
+	for i := 1; i < len(stages); i++ {
+		if !stages[i-1].out.AssignableTo(stages[i].in) {
+			return nil, errs.ErrArgs.WrapMsg("pipeline stage input does not match previous output",
+				"stage", stages[i].name, "input", stages[i].in.String(), "previous", stages[i-1].out.String())
+		}
+	}
+	if conf.OnError == nil {
+		conf.OnError = func(ctx context.Context, stage string, item any, err error) {
+			log.ZWarn(ctx, "pipeline item failed", err, "stage", stage)
+		}
+	}
+	p := &Pipeline{conf: conf, done: make(chan struct{})}
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+	for _, stage := range stages {
+		rs := &runningStage{Stage: stage}
+		n := 1
+		if stage.key != nil {
+			n = stage.workers
+		}
+		rs.inputs = make([]chan any, n)
+		for i := range rs.inputs {
+			rs.inputs[i] = make(chan any, stage.queue)
+		}
+		p.stages = append(p.stages, rs)
+	}
+	for i, rs := range p.stages {
+		var next *runningStage
+		if i+1 < len(p.stages) {
+			next = p.stages[i+1]
+		}
+		for w := 0; w < rs.workers; w++ {
+			rs.wg.Add(1)
+			go p.work(rs, rs.inputs[w%len(rs.inputs)], next)
+		}
+	}
+	// Close every queue once the stage feeding it has finished.
+	go func() {
+		for i, rs := range p.stages {
+			rs.wg.Wait()
+			if i+1 < len(p.stages) {
+				for _, ch := range p.stages[i+1].inputs {
+					close(ch)
+				}
+			}
+		}
+		close(p.done)
+	}()
+	return p, nil
+}
+
+func (p *Pipeline) work(s *runningStage, in <-chan any, next *runningStage) {
+	defer s.wg.Done()
+	for {
+		var item any
+		var ok bool
+		select {
+		case item, ok = <-in:
+		case <-p.ctx.Done():
+			return
+		}
+		if !ok {
+			return
+		}
+		start := time.Now()
+		out, err := s.fn(p.ctx, item)
+		s.observe(time.Since(start))
+		switch {
+		case err == nil:
+			s.processed.Add(1)
+		case errors.Is(err, ErrDrop):
+			s.dropped.Add(1)
+			continue
+		default:
+			s.failed.Add(1)
+			p.conf.OnError(p.ctx, s.name, item, err)
+			if p.conf.StopOnError {
+				p.fail(errs.WrapMsg(err, "pipeline stage failed", "stage", s.name))
+				return
+			}
+			continue
+		}
+		if next != nil {
+			if err := next.send(p.ctx, out); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (p *Pipeline) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+	p.cancel(err)
+}
+
+// Submit enqueues an item into the first stage, blocking while its queue is
+// full. It fails when ctx or the pipeline is cancelled, or after Close.
+func (p *Pipeline) Submit(ctx context.Context, item any) error {
+	first := p.stages[0]
+	if item == nil || !reflect.TypeOf(item).AssignableTo(first.in) {
+		return errs.ErrArgs.WrapMsg("pipeline item does not match first stage input", "stage", first.name, "input", first.in.String())
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	select {
+	case first.input(item) <- item:
+		return nil
+	case <-ctx.Done():
+		return errs.Wrap(ctx.Err())
+	case <-p.ctx.Done():
+		return errs.Wrap(context.Cause(p.ctx))
+	}
+}
+
+// Close stops accepting items, waits until the queued items went through all
+// stages and returns the error that stopped the pipeline, if any. Items still
+// queued when the pipeline was cancelled are discarded.
+func (p *Pipeline) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, ch := range p.stages[0].inputs {
+			close(ch)
+		}
+	}
+	p.mu.Unlock()
+	<-p.done
+	p.cancel(nil)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.err
+}
+
+// Done is closed once all stages have stopped.
+func (p *Pipeline) Done() <-chan struct{} {
+	return p.done
+}
+
+// Stats returns the statistics of every stage in order.
+func (p *Pipeline) Stats() []StageStats {
+	stats := make([]StageStats, len(p.stages))
+	for i, s := range p.stages {
+		var queued int
+		for _, ch := range s.inputs {
+			queued += len(ch)
+		}
+		stats[i] = StageStats{
+			Name:       s.name,
+			Workers:    s.workers,
+			Queued:     queued,
+			Processed:  s.processed.Load(),
+			Failed:     s.failed.Load(),
+			Dropped:    s.dropped.Load(),
+			Latency:    time.Duration(s.latency.Load()),
+			MaxLatency: time.Duration(s.maxLat.Load()),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,200 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type msg struct {
+	Conversation string
+	Seq          int
+}
+
+func decode(ctx context.Context, data []byte) (*msg, error) {
+	conv, seq, ok := cut(string(data))
+	if !ok {
+		return nil, errors.New("malformed message")
+	}
+	n, err := strconv.Atoi(seq)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, ErrDrop
+	}
+	return &msg{Conversation: conv, Seq: n}, nil
+}
+
+func cut(s string) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '/' {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return "", "", false
+}
+
+func TestPipeline(t *testing.T) {
+	testutil.VerifyNoLeaks(t)
+	var (
+		mu        sync.Mutex
+		persisted = make(map[string][]int)
+		failed    []string
+	)
+	persist := func(ctx context.Context, m *msg) (*msg, error) {
+		mu.Lock()
+		persisted[m.Conversation] = append(persisted[m.Conversation], m.Seq)
+		mu.Unlock()
+		return m, nil
+	}
+	p, err := Start(context.Background(), Config{
+		OnError: func(ctx context.Context, stage string, item any, err error) {
+			mu.Lock()
+			failed = append(failed, stage+":"+string(item.([]byte)))
+			mu.Unlock()
+		},
+	},
+		NewStage("decode", decode, WithWorkers(4)),
+		NewStage("persist", persist, WithWorkers(4), WithKey(func(m *msg) string { return m.Conversation })),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, p.Submit(context.Background(), []byte("c"+strconv.Itoa(i%5)+"/"+strconv.Itoa(i))))
+	}
+	require.NoError(t, p.Submit(context.Background(), []byte("garbage")))
+	require.NoError(t, p.Submit(context.Background(), []byte("c1/-1")))
+	assert.ErrorIs(t, p.Submit(context.Background(), "wrong type"), errs.ErrArgs)
+	require.NoError(t, p.Close())
+	assert.ErrorIs(t, p.Submit(context.Background(), []byte("c1/1")), ErrClosed)
+
+	assert.Equal(t, []string{"decode:garbage"}, failed)
+	assert.Len(t, persisted, 5)
+	stats := p.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, int64(100), stats[0].Processed)
+	assert.Equal(t, int64(1), stats[0].Failed)
+	assert.Equal(t, int64(1), stats[0].Dropped)
+	assert.Equal(t, int64(100), stats[1].Processed)
+	assert.Equal(t, 4, stats[1].Workers)
+	assert.Equal(t, 0, stats[1].Queued)
+}
+
+func TestKeyedOrder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seqs = make(map[string][]int)
+	)
+	p, err := Start(context.Background(), Config{},
+		NewStage("persist", func(ctx context.Context, m msg) (msg, error) {
+			mu.Lock()
+			seqs[m.Conversation] = append(seqs[m.Conversation], m.Seq)
+			mu.Unlock()
+			return m, nil
+		}, WithWorkers(8), WithKey(func(m msg) string { return m.Conversation })),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, p.Submit(context.Background(), msg{Conversation: strconv.Itoa(i % 7), Seq: i}))
+	}
+	require.NoError(t, p.Close())
+	for conv, list := range seqs {
+		for i := 1; i < len(list); i++ {
+			assert.Less(t, list[i-1], list[i], conv)
+		}
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	p, err := Start(context.Background(), Config{},
+		NewStage("slow", func(ctx context.Context, n int) (int, error) {
+			<-release
+			return n, nil
+		}, WithQueue(2)),
+	)
+	require.NoError(t, err)
+	// One item in the worker and two queued fill the stage.
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.Submit(context.Background(), i))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, p.Submit(ctx, 3), context.DeadlineExceeded)
+	close(release)
+	require.NoError(t, p.Close())
+	assert.Equal(t, int64(3), p.Stats()[0].Processed)
+}
+
+func TestStopOnError(t *testing.T) {
+	p, err := Start(context.Background(), Config{StopOnError: true, OnError: func(context.Context, string, any, error) {}},
+		NewStage("check", func(ctx context.Context, n int) (int, error) {
+			if n == 3 {
+				return 0, errors.New("bad item")
+			}
+			return n, nil
+		}),
+		NewStage("sink", func(ctx context.Context, n int) (struct{}, error) {
+			return struct{}{}, nil
+		}),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		if err := p.Submit(context.Background(), i); err != nil {
+			break
+		}
+	}
+	err = p.Close()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad item")
+}
+
+func TestCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := Start(ctx, Config{}, NewStage("block", func(ctx context.Context, n int) (int, error) {
+		<-ctx.Done()
+		return n, ctx.Err()
+	}, WithQueue(0)))
+	require.NoError(t, err)
+	require.NoError(t, p.Submit(context.Background(), 1))
+	cancel()
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Fatal("pipeline did not stop")
+	}
+	assert.Error(t, p.Submit(context.Background(), 2))
+}
+
+func TestStartValidates(t *testing.T) {
+	_, err := Start(context.Background(), Config{})
+	assert.Error(t, err)
+	_, err = Start(context.Background(), Config{},
+		NewStage("a", func(ctx context.Context, n int) (string, error) { return "", nil }),
+		NewStage("b", func(ctx context.Context, n int) (int, error) { return n, nil }),
+	)
+	assert.ErrorIs(t, err, errs.ErrArgs)
+}
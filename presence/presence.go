@@ -0,0 +1,399 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package presence tracks the online status of users in Redis. Every
+// connection is registered with a heartbeat deadline; a user is online while
+// any connection's deadline lies ahead. Status changes are published to a
+// message queue, and connections of crashed gateways time out through Sweep.
+// Reads go through a short lived local cache, refreshed by watched events.
+package presence
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mq"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// Status is the presence of a user.
+type Status struct {
+	UserID    string `json:"userID"`
+	Online    bool   `json:"online"`
+	Platforms []int  `json:"platforms,omitempty"` // Sorted platform IDs with a live connection.
+}
+
+// Event announces a status change.
+type Event struct {
+	Status
+	Time int64 `json:"time"` // Unix milliseconds.
+}
+
+// Config configures a Tracker.
+type Config struct {
+	KeyPrefix string        // Defaults to "PRESENCE:".
+	TTL       time.Duration // Deadline after each heartbeat, defaults to 1 minute.
+	// CacheTTL is how long Get may serve a status from the local cache,
+	// defaults to 2 seconds. Negative disables the cache.
+	CacheTTL  time.Duration
+	CacheSize int // Maximum cached users, defaults to 100,000.
+	// Producer publishes an Event keyed by userID for every change. Optional.
+	Producer      mq.Producer
+	SweepInterval time.Duration // Interval of Run, defaults to 10 seconds.
+	SweepBatch    int           // Users checked per Sweep step, defaults to 500.
+}
+
+// Tracker records and queries presence.
+type Tracker struct {
+	rdb  redis.UniversalClient
+	conf Config
+	now  func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	status  Status
+	expires time.Time
+}
+
+// New creates a Tracker.
+func New(rdb redis.UniversalClient, conf Config) *Tracker {
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = "PRESENCE:"
+	}
+	if conf.TTL <= 0 {
+		conf.TTL = time.Minute
+	}
+	if conf.CacheTTL == 0 {
+		conf.CacheTTL = 2 * time.Second
+	}
+	if conf.CacheSize <= 0 {
+		conf.CacheSize = 100000
+	}
+	if conf.SweepInterval <= 0 {
+		conf.SweepInterval = 10 * time.Second
+	}
+	if conf.SweepBatch <= 0 {
+		conf.SweepBatch = 500
+	}
+	return &Tracker{rdb: rdb, conf: conf, now: time.Now, cache: make(map[string]cached)}
+}
+
+// onlineScript drops expired connections, registers ARGV[3] until ARGV[2]
+// and returns whether the user came online followed by the live members.
+// ARGV[1] is the current time and ARGV[4] the key TTL in milliseconds.
+var onlineScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local before = redis.call('ZCARD', KEYS[1])
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[3])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+local res = {before == 0 and 1 or 0}
+for _, m in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	table.insert(res, m)
+end
+return res
+`)
+
+// offlineScript drops expired connections and ARGV[2], and returns whether
+// the user went offline followed by the live members.
+var offlineScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local removed = redis.call('ZREM', KEYS[1], ARGV[2])
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+local res = {(removed == 1 and #members == 0) and 1 or 0}
+for _, m in ipairs(members) do
+	table.insert(res, m)
+end
+return res
+`)
+
+// sweepScript drops expired connections and returns the latest deadline
+// left, or 0.
+var sweepScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local last = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+if #last == 0 then
+	return 0
+end
+return tonumber(last[2])
+`)
+
+// unindexScript removes ARGV[1] from the index KEYS[1] if its score is
+// still ARGV[2], i.e. no heartbeat arrived meanwhile.
+var unindexScript = redis.NewScript(`
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func (t *Tracker) userKey(userID string) string {
+	return t.conf.KeyPrefix + "u:" + userID
+}
+
+// indexKey is a sorted set of users scored by their latest deadline, used by
+// Sweep to find users whose connections all timed out.
+func (t *Tracker) indexKey() string {
+	return t.conf.KeyPrefix + "deadlines"
+}
+
+func member(platformID int, connID string) string {
+	return strconv.Itoa(platformID) + ":" + connID
+}
+
+func platforms(members []string) []int {
+	var res []int
+	for _, m := range members {
+		p, _, _ := strings.Cut(m, ":")
+		id, err := strconv.Atoi(p)
+		if err != nil {
+			continue
+		}
+		if i := sort.SearchInts(res, id); i == len(res) || res[i] != id {
+			res = append(res, 0)
+			copy(res[i+1:], res[i:])
+			res[i] = id
+		}
+	}
+	return res
+}
+
+func parseResult(v any) (bool, []string) {
+	values, _ := v.([]any)
+	if len(values) == 0 {
+		return false, nil
+	}
+	changed, _ := values[0].(int64)
+	members := make([]string, 0, len(values)-1)
+	for _, m := range values[1:] {
+		if s, ok := m.(string); ok {
+			members = append(members, s)
+		}
+	}
+	return changed == 1, members
+}
+
+// Online registers a connection or renews its heartbeat. Call it on connect
+// and on every heartbeat. It reports whether the user came online.
+func (t *Tracker) Online(ctx context.Context, userID string, platformID int, connID string) (bool, error) {
+	now := t.now()
+	deadline := now.Add(t.conf.TTL).UnixMilli()
+	res, err := onlineScript.Run(ctx, t.rdb, []string{t.userKey(userID)},
+		now.UnixMilli(), deadline, member(platformID, connID), t.conf.TTL.Milliseconds()).Result()
+	if err != nil {
+		return false, errs.WrapMsg(err, "presence online failed", "userID", userID)
+	}
+	if err := t.rdb.ZAdd(ctx, t.indexKey(), redis.Z{Score: float64(deadline), Member: userID}).Err(); err != nil {
+		return false, errs.WrapMsg(err, "presence index failed", "userID", userID)
+	}
+	changed, members := parseResult(res)
+	status := Status{UserID: userID, Online: true, Platforms: platforms(members)}
+	t.store(status)
+	if changed {
+		t.publish(ctx, status, now)
+	}
+	return changed, nil
+}
+
+// Offline unregisters a connection and reports whether the user went offline.
+func (t *Tracker) Offline(ctx context.Context, userID string, platformID int, connID string) (bool, error) {
+	now := t.now()
+	res, err := offlineScript.Run(ctx, t.rdb, []string{t.userKey(userID)}, now.UnixMilli(), member(platformID, connID)).Result()
+	if err != nil {
+		return false, errs.WrapMsg(err, "presence offline failed", "userID", userID)
+	}
+	changed, members := parseResult(res)
+	status := Status{UserID: userID, Online: len(members) > 0, Platforms: platforms(members)}
+	t.store(status)
+	if changed {
+		if err := t.rdb.ZRem(ctx, t.indexKey(), userID).Err(); err != nil {
+			log.ZWarn(ctx, "presence unindex failed", err, "userID", userID)
+		}
+		t.publish(ctx, status, now)
+	}
+	return changed, nil
+}
+
+func (t *Tracker) publish(ctx context.Context, status Status, now time.Time) {
+	if t.conf.Producer == nil {
+		return
+	}
+	data, err := jsonutil.Marshal(&Event{Status: status, Time: now.UnixMilli()})
+	if err == nil {
+		err = t.conf.Producer.SendMessage(ctx, status.UserID, data)
+	}
+	if err != nil {
+		log.ZWarn(ctx, "presence publish failed", err, "userID", status.UserID, "online", status.Online)
+	}
+}
+
+// Get returns the status of every user, in the order of userIDs.
+func (t *Tracker) Get(ctx context.Context, userIDs ...string) ([]Status, error) {
+	res := make([]Status, len(userIDs))
+	var missing []int
+	now := t.now()
+	t.mu.Lock()
+	for i, userID := range userIDs {
+		if c, ok := t.cache[userID]; ok && now.Before(c.expires) {
+			res[i] = c.status
+		} else {
+			missing = append(missing, i)
+		}
+	}
+	t.mu.Unlock()
+	if len(missing) == 0 {
+		return res, nil
+	}
+	pipe := t.rdb.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(missing))
+	min := "(" + strconv.FormatInt(now.UnixMilli(), 10)
+	for j, i := range missing {
+		cmds[j] = pipe.ZRangeByScore(ctx, t.userKey(userIDs[i]), &redis.ZRangeBy{Min: min, Max: "+inf"})
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errs.WrapMsg(err, "presence get failed", "count", len(missing))
+	}
+	for j, i := range missing {
+		members := cmds[j].Val()
+		res[i] = Status{UserID: userIDs[i], Online: len(members) > 0, Platforms: platforms(members)}
+		t.store(res[i])
+	}
+	return res, nil
+}
+
+// IsOnline reports whether a user is online.
+func (t *Tracker) IsOnline(ctx context.Context, userID string) (bool, error) {
+	res, err := t.Get(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return res[0].Online, nil
+}
+
+func (t *Tracker) store(status Status) {
+	if t.conf.CacheTTL < 0 {
+		return
+	}
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.cache) >= t.conf.CacheSize {
+		for userID, c := range t.cache {
+			if !now.Before(c.expires) {
+				delete(t.cache, userID)
+			}
+		}
+		if len(t.cache) >= t.conf.CacheSize {
+			t.cache = make(map[string]cached)
+		}
+	}
+	t.cache[status.UserID] = cached{status: status, expires: now.Add(t.conf.CacheTTL)}
+}
+
+// Sweep finds users whose connections all missed their heartbeat, e.g.
+// behind a crashed gateway, publishes their offline event and returns how
+// many went offline.
+func (t *Tracker) Sweep(ctx context.Context) (int, error) {
+	var n int
+	for {
+		now := t.now()
+		users, err := t.rdb.ZRangeByScoreWithScores(ctx, t.indexKey(), &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now.UnixMilli(), 10),
+			Count: int64(t.conf.SweepBatch),
+		}).Result()
+		if err != nil {
+			return n, errs.WrapMsg(err, "presence sweep failed")
+		}
+		for _, z := range users {
+			userID := z.Member.(string)
+			deadline, err := sweepScript.Run(ctx, t.rdb, []string{t.userKey(userID)}, now.UnixMilli()).Int64()
+			if err != nil {
+				return n, errs.WrapMsg(err, "presence sweep user failed", "userID", userID)
+			}
+			score := strconv.FormatFloat(z.Score, 'f', -1, 64)
+			removed, err := unindexScript.Run(ctx, t.rdb, []string{t.indexKey()}, userID, score).Int()
+			if err != nil {
+				return n, errs.WrapMsg(err, "presence unindex failed", "userID", userID)
+			}
+			if removed == 0 {
+				continue // A heartbeat arrived meanwhile.
+			}
+			if deadline > 0 {
+				// Still online, e.g. after clock skew between instances.
+				if err := t.rdb.ZAdd(ctx, t.indexKey(), redis.Z{Score: float64(deadline), Member: userID}).Err(); err != nil {
+					return n, errs.WrapMsg(err, "presence index failed", "userID", userID)
+				}
+				continue
+			}
+			status := Status{UserID: userID}
+			t.store(status)
+			t.publish(ctx, status, now)
+			n++
+		}
+		if len(users) < t.conf.SweepBatch {
+			return n, nil
+		}
+	}
+}
+
+// Run sweeps every SweepInterval until ctx is done. Running it on several
+// instances is safe; each timed out user is reported once.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.conf.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.Sweep(ctx); err != nil && ctx.Err() == nil {
+				log.ZWarn(ctx, "presence sweep failed", err)
+			}
+		}
+	}
+}
+
+// Watch consumes status events until ctx is done or consuming fails,
+// refreshes the local cache with them and passes them to fn, which may be
+// nil. An error of fn stops Watch and is returned.
+func (t *Tracker) Watch(ctx context.Context, consumer mq.Consumer, fn func(ctx context.Context, e *Event) error) error {
+	handler := func(ctx context.Context, key string, value []byte) error {
+		var e Event
+		if err := jsonutil.Unmarshal(value, &e); err != nil {
+			log.ZWarn(ctx, "presence event malformed", err, "key", key)
+			return nil
+		}
+		t.store(e.Status)
+		if fn == nil {
+			return nil
+		}
+		return fn(ctx, &e)
+	}
+	for {
+		if err := consumer.Subscribe(ctx, handler); err != nil {
+			return err
+		}
+	}
+}
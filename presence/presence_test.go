@@ -0,0 +1,130 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package presence
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/mq/mock"
+	"github.com/openimsdk/tools/mq/simmq"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatforms(t *testing.T) {
+	assert.Equal(t, []int{1, 2, 5}, platforms([]string{"5:c1", "1:c2", "2:c3", "1:c4", "bad"}))
+	assert.Nil(t, platforms(nil))
+
+	changed, members := parseResult([]any{int64(1), "1:a", "2:b"})
+	assert.True(t, changed)
+	assert.Equal(t, []string{"1:a", "2:b"}, members)
+	changed, members = parseResult(nil)
+	assert.False(t, changed)
+	assert.Empty(t, members)
+}
+
+func TestWatch(t *testing.T) {
+	producer, consumer := simmq.NewMemory(8)
+	tr := New(nil, Config{CacheTTL: time.Minute})
+	for _, e := range []Event{
+		{Status: Status{UserID: "u1", Online: true, Platforms: []int{1}}, Time: 1},
+		{Status: Status{UserID: "u2", Online: false}, Time: 2},
+	} {
+		data, err := jsonutil.Marshal(&e)
+		require.NoError(t, err)
+		require.NoError(t, producer.SendMessage(context.Background(), e.UserID, data))
+	}
+	require.NoError(t, producer.SendMessage(context.Background(), "bad", []byte("{")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var events []*Event
+	err := tr.Watch(ctx, consumer, func(ctx context.Context, e *Event) error {
+		events = append(events, e)
+		if len(events) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "u1", events[0].UserID)
+
+	// Served from the cache without touching Redis.
+	status, err := tr.Get(context.Background(), "u1", "u2")
+	require.NoError(t, err)
+	assert.Equal(t, []Status{{UserID: "u1", Online: true, Platforms: []int{1}}, {UserID: "u2"}}, status)
+}
+
+func TestTracker(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	producer := mock.NewProducer()
+	tr := New(rdb, Config{
+		KeyPrefix: "PRESENCE_TEST:" + strconv.FormatInt(time.Now().UnixNano(), 36) + ":",
+		TTL:       time.Minute,
+		CacheTTL:  -1,
+		Producer:  producer,
+	})
+	now := time.Now()
+	tr.now = func() time.Time { return now }
+
+	changed, err := tr.Online(ctx, "u1", 1, "c1")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	changed, err = tr.Online(ctx, "u1", 5, "c2")
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	status, err := tr.Get(ctx, "u1", "u2")
+	require.NoError(t, err)
+	assert.Equal(t, []Status{{UserID: "u1", Online: true, Platforms: []int{1, 5}}, {UserID: "u2"}}, status)
+
+	changed, err = tr.Offline(ctx, "u1", 1, "c1")
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = tr.Offline(ctx, "u1", 5, "c2")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	online, err := tr.IsOnline(ctx, "u1")
+	require.NoError(t, err)
+	assert.False(t, online)
+
+	// u2's gateway crashes: its connection times out and Sweep reports it.
+	_, err = tr.Online(ctx, "u2", 1, "c3")
+	require.NoError(t, err)
+	n, err := tr.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	now = now.Add(2 * time.Minute)
+	n, err = tr.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	var events []Event
+	for _, m := range producer.Messages() {
+		var e Event
+		require.NoError(t, jsonutil.Unmarshal(m.Value, &e))
+		events = append(events, e)
+	}
+	require.Len(t, events, 4)
+	assert.Equal(t, []bool{true, false, true, false}, []bool{events[0].Online, events[1].Online, events[2].Online, events[3].Online})
+	assert.Equal(t, "u2", events[3].UserID)
+}
@@ -0,0 +1,65 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progress
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+)
+
+// Handler serves the progress of the job named by the jobID query parameter,
+// or by the last path segment, in the apiresp envelope.
+func Handler(store Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jobID := r.URL.Query().Get("jobID")
+		if jobID == "" {
+			jobID = r.URL.Path[strings.LastIndexByte(r.URL.Path, '/')+1:]
+		}
+		job, err := load(r, store, jobID)
+		if err != nil {
+			apiresp.HttpError(w, err)
+			return
+		}
+		apiresp.HttpSuccess(w, job)
+	})
+}
+
+// Gin serves the progress of the job named by the jobID route parameter or
+// query parameter.
+func Gin(store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobID := c.Param("jobID")
+		if jobID == "" {
+			jobID = c.Query("jobID")
+		}
+		job, err := load(c.Request, store, jobID)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		apiresp.GinSuccess(c, job)
+	}
+}
+
+func load(r *http.Request, store Store, jobID string) (*Job, error) {
+	if jobID == "" {
+		return nil, errs.ErrArgs.WrapMsg("jobID is required")
+	}
+	return store.Load(r.Context(), jobID)
+}
@@ -0,0 +1,286 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package progress lets long running jobs, like imports, migrations and S3
+// cleanups, publish their stage, completion, ETA and errors to a Store, from
+// where an HTTP handler serves them for polling by job ID.
+package progress
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+type Status string
+
+const (
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Job is the reported progress of a job.
+type Job struct {
+	ID         string    `json:"jobID"`
+	Name       string    `json:"name"`
+	Status     Status    `json:"status"`
+	Stage      string    `json:"stage"`
+	Done       int64     `json:"done"`
+	Total      int64     `json:"total"` // Zero when unknown.
+	Percent    float64   `json:"percent"`
+	ETASeconds int64     `json:"etaSeconds"` // Estimated rest of the stage, -1 when unknown.
+	ErrorCount int64     `json:"errorCount"`
+	Errors     []string  `json:"errors,omitempty"` // The latest errors.
+	Error      string    `json:"error,omitempty"`  // Why the job failed.
+	StartedAt  time.Time `json:"startedAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job ended.
+func (j *Job) Finished() bool {
+	return j.Status != StatusRunning
+}
+
+// Store keeps the progress of jobs. Load fails with errs.ErrRecordNotFound
+// for unknown jobs.
+type Store interface {
+	Save(ctx context.Context, job *Job) error
+	Load(ctx context.Context, jobID string) (*Job, error)
+}
+
+// NewRedisStore returns a Store keeping jobs as JSON under keyPrefix,
+// "PROGRESS:" when empty, for ttl after their last update, 24 hours when zero.
+func NewRedisStore(rdb redis.UniversalClient, keyPrefix string, ttl time.Duration) Store {
+	if keyPrefix == "" {
+		keyPrefix = "PROGRESS:"
+	}
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	return &redisStore{rdb: rdb, prefix: keyPrefix, ttl: ttl}
+}
+
+type redisStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func (s *redisStore) Save(ctx context.Context, job *Job) error {
+	data, err := jsonutil.Marshal(job)
+	if err != nil {
+		return errs.WrapMsg(err, "progress encode failed", "jobID", job.ID)
+	}
+	if err := s.rdb.Set(ctx, s.prefix+job.ID, data, s.ttl).Err(); err != nil {
+		return errs.WrapMsg(err, "progress save failed", "jobID", job.ID)
+	}
+	return nil
+}
+
+func (s *redisStore) Load(ctx context.Context, jobID string) (*Job, error) {
+	data, err := s.rdb.Get(ctx, s.prefix+jobID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errs.ErrRecordNotFound.WrapMsg("progress not found", "jobID", jobID)
+		}
+		return nil, errs.WrapMsg(err, "progress load failed", "jobID", jobID)
+	}
+	var job Job
+	if err := jsonutil.Unmarshal(data, &job); err != nil {
+		return nil, errs.WrapMsg(err, "progress decode failed", "jobID", jobID)
+	}
+	return &job, nil
+}
+
+// NewMemoryStore returns a Store for a single process and tests.
+func NewMemoryStore() Store {
+	return &memoryStore{jobs: make(map[string]Job)}
+}
+
+type memoryStore struct {
+	mu   sync.Mutex
+	jobs map[string]Job
+}
+
+func (s *memoryStore) Save(_ context.Context, job *Job) error {
+	j := *job
+	j.Errors = append([]string(nil), job.Errors...)
+	s.mu.Lock()
+	s.jobs[job.ID] = j
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStore) Load(_ context.Context, jobID string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[jobID]
+	if !ok {
+		return nil, errs.ErrRecordNotFound.WrapMsg("progress not found", "jobID", jobID)
+	}
+	j.Errors = append([]string(nil), j.Errors...)
+	return &j, nil
+}
+
+// Config configures a Reporter.
+type Config struct {
+	// MinInterval throttles saves of Add and Set, defaults to 1 second.
+	// Stage changes, errors and the end of the job are saved right away.
+	MinInterval time.Duration
+	// MaxErrors is the number of latest errors kept, defaults to 20.
+	MaxErrors int
+}
+
+// Reporter publishes the progress of one job. It is safe for concurrent
+// use, e.g. by the workers of an import. Save failures are logged only, so
+// reporting never fails the job.
+type Reporter struct {
+	store Store
+	conf  Config
+	now   func() time.Time
+
+	mu         sync.Mutex
+	job        Job
+	stageStart time.Time
+	stageDone  int64 // Done when the stage started.
+	saved      time.Time
+}
+
+// Start reports a job as running.
+func Start(ctx context.Context, store Store, jobID, name string, conf Config) *Reporter {
+	if conf.MinInterval <= 0 {
+		conf.MinInterval = time.Second
+	}
+	if conf.MaxErrors <= 0 {
+		conf.MaxErrors = 20
+	}
+	r := &Reporter{store: store, conf: conf, now: time.Now}
+	now := r.now()
+	r.job = Job{ID: jobID, Name: name, Status: StatusRunning, ETASeconds: -1, StartedAt: now}
+	r.stageStart = now
+	r.mu.Lock()
+	r.save(ctx, true)
+	r.mu.Unlock()
+	return r
+}
+
+// Stage starts a named stage of total units, zero when unknown.
+func (r *Reporter) Stage(ctx context.Context, stage string, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Stage, r.job.Total, r.job.Done = stage, total, 0
+	r.stageStart, r.stageDone = r.now(), 0
+	r.save(ctx, true)
+}
+
+// SetTotal updates the units of the current stage once they are known.
+func (r *Reporter) SetTotal(ctx context.Context, total int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Total = total
+	r.save(ctx, false)
+}
+
+// Add counts n more units done.
+func (r *Reporter) Add(ctx context.Context, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Done += n
+	r.save(ctx, false)
+}
+
+// Set sets the units done.
+func (r *Reporter) Set(ctx context.Context, done int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.Done = done
+	r.save(ctx, false)
+}
+
+// Error records a non fatal error, e.g. a rejected row.
+func (r *Reporter) Error(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.job.ErrorCount++
+	r.job.Errors = append(r.job.Errors, err.Error())
+	if n := len(r.job.Errors) - r.conf.MaxErrors; n > 0 {
+		r.job.Errors = append(r.job.Errors[:0], r.job.Errors[n:]...)
+	}
+	r.save(ctx, true)
+}
+
+// Finish ends the job, as failed when err is not nil and as canceled when
+// err is a context cancellation.
+func (r *Reporter) Finish(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case err == nil:
+		r.job.Status = StatusSucceeded
+		if r.job.Total > 0 {
+			r.job.Done = r.job.Total
+		}
+	case errors.Is(err, context.Canceled):
+		r.job.Status, r.job.Error = StatusCanceled, err.Error()
+	default:
+		r.job.Status, r.job.Error = StatusFailed, err.Error()
+	}
+	r.job.FinishedAt = r.now()
+	// The job's own context may be the reason it ended.
+	r.save(context.WithoutCancel(ctx), true)
+}
+
+// Job returns the current progress.
+func (r *Reporter) Job() Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j := r.job
+	j.Errors = append([]string(nil), r.job.Errors...)
+	return j
+}
+
+// save publishes the job, at most every MinInterval unless force is set.
+// r.mu must be held.
+func (r *Reporter) save(ctx context.Context, force bool) {
+	now := r.now()
+	if !force && now.Sub(r.saved) < r.conf.MinInterval {
+		return
+	}
+	r.saved = now
+	r.job.UpdatedAt = now
+	r.job.Percent, r.job.ETASeconds = 0, -1
+	if r.job.Total > 0 {
+		r.job.Percent = min(100, float64(r.job.Done)*100/float64(r.job.Total))
+		elapsed := now.Sub(r.stageStart)
+		if done := r.job.Done - r.stageDone; done > 0 && elapsed > 0 && r.job.Status == StatusRunning {
+			rest := time.Duration(float64(elapsed) * float64(r.job.Total-r.job.Done) / float64(done))
+			r.job.ETASeconds = int64(max(0, rest.Seconds()))
+		}
+	}
+	if r.job.Status != StatusRunning {
+		r.job.ETASeconds = 0
+	}
+	if err := r.store.Save(ctx, &r.job); err != nil {
+		log.ZWarn(ctx, "save progress failed", err, "jobID", r.job.ID)
+	}
+}
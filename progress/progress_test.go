@@ -0,0 +1,93 @@
+package progress
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Unix(1000, 0)
+	r := Start(ctx, store, "job1", "import", Config{MinInterval: time.Second, MaxErrors: 2})
+	r.now = func() time.Time { return now }
+
+	r.Stage(ctx, "rows", 100)
+	now = now.Add(10 * time.Second)
+	r.Add(ctx, 25)
+	job, err := store.Load(ctx, "job1")
+	require.NoError(t, err)
+	assert.Equal(t, "rows", job.Stage)
+	assert.Equal(t, int64(25), job.Done)
+	assert.Equal(t, 25.0, job.Percent)
+	assert.Equal(t, int64(30), job.ETASeconds)
+
+	// Throttled within MinInterval.
+	r.Add(ctx, 25)
+	job, _ = store.Load(ctx, "job1")
+	assert.Equal(t, int64(25), job.Done)
+
+	for i := 0; i < 3; i++ {
+		r.Error(ctx, errors.New("bad row"+string(rune('a'+i))))
+	}
+	job, _ = store.Load(ctx, "job1")
+	assert.Equal(t, int64(50), job.Done)
+	assert.Equal(t, int64(3), job.ErrorCount)
+	assert.Equal(t, []string{"bad rowb", "bad rowc"}, job.Errors)
+
+	r.Finish(ctx, nil)
+	job, _ = store.Load(ctx, "job1")
+	assert.Equal(t, StatusSucceeded, job.Status)
+	assert.Equal(t, 100.0, job.Percent)
+	assert.True(t, job.Finished())
+}
+
+func TestReporterFinishFailed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store := NewMemoryStore()
+	r := Start(ctx, store, "job1", "cleanup", Config{})
+	cancel()
+	r.Finish(ctx, ctx.Err())
+	job, err := store.Load(context.Background(), "job1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCanceled, job.Status)
+
+	r = Start(context.Background(), store, "job2", "cleanup", Config{})
+	r.Finish(context.Background(), errors.New("boom"))
+	job, _ = store.Load(context.Background(), "job2")
+	assert.Equal(t, StatusFailed, job.Status)
+	assert.Equal(t, "boom", job.Error)
+}
+
+func TestHandler(t *testing.T) {
+	store := NewMemoryStore()
+	Start(context.Background(), store, "job1", "migrate", Config{})
+	h := Handler(store)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress?jobID=job1", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"jobID":"job1"`)
+	assert.Contains(t, w.Body.String(), `"status":"running"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress/job1", nil))
+	assert.Contains(t, w.Body.String(), `"jobID":"job1"`)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/progress/unknown", nil))
+	assert.True(t, strings.Contains(w.Body.String(), `"errCode":`))
+	assert.NotContains(t, w.Body.String(), `"jobID"`)
+
+	_, err := store.Load(context.Background(), "unknown")
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+}
@@ -0,0 +1,183 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// Event is a keyspace event type as named by Redis.
+type Event string
+
+const (
+	EventExpired Event = "expired"
+	EventEvicted Event = "evicted"
+	EventDel     Event = "del"
+)
+
+// eventFlags maps events to their notify-keyspace-events flags.
+var eventFlags = map[Event]string{
+	EventExpired: "x",
+	EventEvicted: "e",
+	EventDel:     "g",
+}
+
+// KeyEvent is a keyspace event of a watched key. ID is the key without the
+// prefix it was registered under.
+type KeyEvent struct {
+	Event Event
+	Key   string
+	ID    string
+}
+
+// KeyspaceConfig configures a KeyspaceWatcher.
+type KeyspaceConfig struct {
+	// DB is the database whose events are watched.
+	DB int
+	// Events defaults to EventExpired and EventEvicted.
+	Events []Event
+	// Configure enables the required notify-keyspace-events flags on the
+	// server, in addition to the ones already set. Leave it off where
+	// CONFIG is not permitted and set the flags in redis.conf instead.
+	Configure bool
+}
+
+type keyHandler struct {
+	prefix string
+	fn     func(ctx context.Context, e KeyEvent)
+}
+
+// KeyspaceWatcher dispatches Redis keyspace events, such as presence keys
+// expiring, to callbacks registered by key prefix. Events are delivered at
+// most once: Redis does not buffer them, so events during a reconnection
+// are lost. In a cluster the events of the node the Bus is connected to
+// are received only.
+type KeyspaceWatcher struct {
+	bus  *Bus
+	conf KeyspaceConfig
+
+	mu       sync.RWMutex
+	handlers []keyHandler
+}
+
+func NewKeyspaceWatcher(bus *Bus, conf KeyspaceConfig) *KeyspaceWatcher {
+	if len(conf.Events) == 0 {
+		conf.Events = []Event{EventExpired, EventEvicted}
+	}
+	return &KeyspaceWatcher{bus: bus, conf: conf}
+}
+
+// Handle calls fn for events of keys starting with prefix. A key matching
+// several prefixes is passed to each of their handlers.
+func (w *KeyspaceWatcher) Handle(prefix string, fn func(ctx context.Context, e KeyEvent)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.handlers = append(w.handlers, keyHandler{prefix: prefix, fn: fn})
+}
+
+// Run receives events until ctx is done or the bus is closed.
+func (w *KeyspaceWatcher) Run(ctx context.Context) error {
+	if w.conf.Configure {
+		if err := w.configure(ctx); err != nil {
+			return err
+		}
+	}
+	channels := make([]string, 0, len(w.conf.Events))
+	for _, event := range w.conf.Events {
+		channels = append(channels, w.channel(event))
+	}
+	sub, err := w.bus.Subscribe(ctx, channels...)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-sub.C:
+			if !ok {
+				return ErrClosed.Wrap()
+			}
+			w.dispatch(ctx, m)
+		}
+	}
+}
+
+func (w *KeyspaceWatcher) channel(event Event) string {
+	return "__keyevent@" + strconv.Itoa(w.conf.DB) + "__:" + string(event)
+}
+
+func (w *KeyspaceWatcher) dispatch(ctx context.Context, m Message) {
+	i := strings.LastIndexByte(m.Channel, ':')
+	if i < 0 {
+		return
+	}
+	event := Event(m.Channel[i+1:])
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	for _, h := range w.handlers {
+		if !strings.HasPrefix(m.Payload, h.prefix) {
+			continue
+		}
+		w.call(ctx, h, KeyEvent{Event: event, Key: m.Payload, ID: m.Payload[len(h.prefix):]})
+	}
+}
+
+func (w *KeyspaceWatcher) call(ctx context.Context, h keyHandler, e KeyEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.ZError(ctx, "keyspace handler panic", errs.ErrPanic(r), "key", e.Key, "event", e.Event)
+		}
+	}()
+	h.fn(ctx, e)
+}
+
+// configure adds the keyevent flag and the flags of the watched events to
+// notify-keyspace-events.
+func (w *KeyspaceWatcher) configure(ctx context.Context) error {
+	const name = "notify-keyspace-events"
+	current, err := w.bus.rdb.ConfigGet(ctx, name).Result()
+	if err != nil {
+		return errs.WrapMsg(err, "redis config get failed", "name", name)
+	}
+	flags := current[name]
+	want := "E"
+	for _, event := range w.conf.Events {
+		want += eventFlags[event]
+	}
+	updated := flags
+	for _, c := range want {
+		// "A" is an alias for all event classes but "m", "n" and "t".
+		if strings.ContainsRune(updated, c) || (c != 'E' && strings.ContainsRune(updated, 'A')) {
+			continue
+		}
+		updated += string(c)
+	}
+	if updated == flags {
+		return nil
+	}
+	if err := w.bus.rdb.ConfigSet(ctx, name, updated).Err(); err != nil {
+		return errs.WrapMsg(err, "redis config set failed", "name", name, "value", updated)
+	}
+	log.ZInfo(ctx, "redis keyspace notifications enabled", "value", updated)
+	return nil
+}
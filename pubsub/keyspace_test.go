@@ -0,0 +1,63 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyspaceDispatch(t *testing.T) {
+	w := NewKeyspaceWatcher(New(nil, Config{}), KeyspaceConfig{DB: 2})
+	assert.Equal(t, "__keyevent@2__:expired", w.channel(EventExpired))
+
+	var got []KeyEvent
+	w.Handle("ONLINE:", func(ctx context.Context, e KeyEvent) { got = append(got, e) })
+	w.Handle("ONLINE:u", func(ctx context.Context, e KeyEvent) { panic("boom") })
+	ctx := context.Background()
+	w.dispatch(ctx, Message{Channel: "__keyevent@2__:expired", Payload: "ONLINE:u1"})
+	w.dispatch(ctx, Message{Channel: "__keyevent@2__:evicted", Payload: "CACHE:u1"})
+	assert.Equal(t, []KeyEvent{{Event: EventExpired, Key: "ONLINE:u1", ID: "u1"}}, got)
+}
+
+func TestKeyspaceRedis(t *testing.T) {
+	rdb := containers.Redis(t)
+	b := New(rdb, Config{})
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := NewKeyspaceWatcher(b, KeyspaceConfig{Configure: true})
+	got := make(chan KeyEvent, 1)
+	w.Handle("ONLINE:", func(ctx context.Context, e KeyEvent) { got <- e })
+	go func() { _ = w.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		n, err := rdb.PubSubNumSub(ctx, w.channel(EventExpired)).Result()
+		return err == nil && n[w.channel(EventExpired)] > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, rdb.Set(ctx, "ONLINE:u1", "1", 10*time.Millisecond).Err())
+	select {
+	case e := <-got:
+		assert.Equal(t, KeyEvent{Event: EventExpired, Key: "ONLINE:u1", ID: "u1"}, e)
+	case <-ctx.Done():
+		t.Fatal("no expired event")
+	}
+}
@@ -0,0 +1,399 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pubsub broadcasts messages between nodes over Redis pub/sub, e.g.
+// kick and online notifications. All subscriptions of a Bus share one
+// connection, which is re-established with its channels and patterns after
+// a connection loss. Messages published while disconnected are lost, so
+// Config.OnReconnect lets subscribers resync. Every subscription has a
+// bounded buffer; messages for a full subscription are dropped and counted
+// rather than stalling the others.
+package pubsub
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrClosed is returned when subscribing to a closed Bus.
+var ErrClosed = errs.New("pubsub bus is closed")
+
+// Config configures a Bus.
+type Config struct {
+	// Buffer is the number of messages a subscription holds before further
+	// messages are dropped, defaults to 256.
+	Buffer int
+	// MinBackoff and MaxBackoff bound the wait between reconnection
+	// attempts, default to 100 milliseconds and 5 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// OnReconnect is called after the connection was re-established.
+	// Messages published in between were lost.
+	OnReconnect func(ctx context.Context)
+}
+
+// Message is a received message. Pattern is set for messages of pattern
+// subscriptions.
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// Stats counts the messages of a Bus.
+type Stats struct {
+	Published  int64
+	Received   int64
+	Dropped    int64
+	Reconnects int64
+}
+
+// Bus publishes and subscribes over a Redis client.
+type Bus struct {
+	rdb  redis.UniversalClient
+	conf Config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	ps       *redis.PubSub
+	channels map[string]map[*Subscription]struct{}
+	patterns map[string]map[*Subscription]struct{}
+	closed   bool
+	done     chan struct{}
+
+	published  atomic.Int64
+	received   atomic.Int64
+	dropped    atomic.Int64
+	reconnects atomic.Int64
+}
+
+func New(rdb redis.UniversalClient, conf Config) *Bus {
+	if conf.Buffer <= 0 {
+		conf.Buffer = 256
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = max(conf.MinBackoff, 5*time.Second)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bus{
+		rdb:      rdb,
+		conf:     conf,
+		ctx:      ctx,
+		cancel:   cancel,
+		channels: make(map[string]map[*Subscription]struct{}),
+		patterns: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends payload to the subscribers of channel on all nodes.
+func (b *Bus) Publish(ctx context.Context, channel string, payload string) error {
+	if err := b.rdb.Publish(ctx, channel, payload).Err(); err != nil {
+		return errs.WrapMsg(err, "redis publish failed", "channel", channel)
+	}
+	b.published.Add(1)
+	return nil
+}
+
+// Subscription receives the messages of its channels or patterns on C
+// until it is closed.
+type Subscription struct {
+	bus     *Bus
+	names   []string
+	pattern bool
+	c       chan Message
+	dropped atomic.Int64
+	once    sync.Once
+	C       <-chan Message
+}
+
+// Dropped returns the number of messages dropped because C was full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unsubscribes and closes C.
+func (s *Subscription) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.bus.remove(s)
+	})
+	return err
+}
+
+// Subscribe receives the messages published to channels.
+func (b *Bus) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	return b.add(ctx, channels, false)
+}
+
+// PSubscribe receives the messages published to channels matching the glob
+// patterns, e.g. "kick:*".
+func (b *Bus) PSubscribe(ctx context.Context, patterns ...string) (*Subscription, error) {
+	return b.add(ctx, patterns, true)
+}
+
+func (b *Bus) add(ctx context.Context, names []string, pattern bool) (*Subscription, error) {
+	if len(names) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("subscribe requires a channel or pattern")
+	}
+	c := make(chan Message, b.conf.Buffer)
+	s := &Subscription{bus: b, names: names, pattern: pattern, c: c, C: c}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed.Wrap()
+	}
+	index := b.index(pattern)
+	var fresh []string
+	for _, name := range names {
+		if len(index[name]) == 0 {
+			fresh = append(fresh, name)
+		}
+	}
+	if len(fresh) > 0 {
+		if err := b.subscribe(ctx, fresh, pattern); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range names {
+		if index[name] == nil {
+			index[name] = make(map[*Subscription]struct{})
+		}
+		index[name][s] = struct{}{}
+	}
+	return s, nil
+}
+
+func (b *Bus) index(pattern bool) map[string]map[*Subscription]struct{} {
+	if pattern {
+		return b.patterns
+	}
+	return b.channels
+}
+
+// subscribe subscribes the shared connection, starting it on first use.
+// b.mu must be held.
+func (b *Bus) subscribe(ctx context.Context, names []string, pattern bool) error {
+	if b.ps == nil {
+		b.ps = b.rdb.Subscribe(b.ctx)
+		b.done = make(chan struct{})
+		go b.receive(b.ps, b.done)
+	}
+	var err error
+	if pattern {
+		err = b.ps.PSubscribe(ctx, names...)
+	} else {
+		err = b.ps.Subscribe(ctx, names...)
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "redis subscribe failed", "names", names, "pattern", pattern)
+	}
+	return nil
+}
+
+func (b *Bus) remove(s *Subscription) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	index := b.index(s.pattern)
+	var stale []string
+	for _, name := range s.names {
+		delete(index[name], s)
+		if len(index[name]) == 0 {
+			delete(index, name)
+			stale = append(stale, name)
+		}
+	}
+	close(s.c)
+	if len(stale) == 0 || b.ps == nil || b.closed {
+		return nil
+	}
+	var err error
+	if s.pattern {
+		err = b.ps.PUnsubscribe(b.ctx, stale...)
+	} else {
+		err = b.ps.Unsubscribe(b.ctx, stale...)
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "redis unsubscribe failed", "names", stale)
+	}
+	return nil
+}
+
+// receive dispatches messages until the bus is closed. go-redis reconnects
+// and resubscribes on the next receive after an error; the confirmations of
+// the resubscription tell that the connection is back.
+func (b *Bus) receive(ps *redis.PubSub, done chan struct{}) {
+	defer close(done)
+	var (
+		failures     int
+		reconnecting bool
+	)
+	for {
+		msg, err := ps.Receive(b.ctx)
+		if err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			if !reconnecting {
+				log.ZWarn(b.ctx, "redis pubsub connection lost", err)
+			}
+			reconnecting = true
+			failures++
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(b.backoff(failures)):
+			}
+			continue
+		}
+		failures = 0
+		switch m := msg.(type) {
+		case *redis.Message:
+			b.dispatch(Message{Channel: m.Channel, Pattern: m.Pattern, Payload: m.Payload})
+		case *redis.Subscription:
+			if reconnecting {
+				reconnecting = false
+				b.reconnects.Add(1)
+				log.ZInfo(b.ctx, "redis pubsub reconnected")
+				if b.conf.OnReconnect != nil {
+					b.conf.OnReconnect(b.ctx)
+				}
+			}
+		}
+	}
+}
+
+func (b *Bus) backoff(failures int) time.Duration {
+	d := b.conf.MinBackoff
+	for i := 1; i < failures && d < b.conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, b.conf.MaxBackoff)
+}
+
+// dispatch hands a message to every subscription of its channel or pattern
+// without blocking.
+func (b *Bus) dispatch(m Message) {
+	b.received.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.channels[m.Channel]
+	if m.Pattern != "" {
+		subs = b.patterns[m.Pattern]
+	}
+	for s := range subs {
+		select {
+		case s.c <- m:
+		default:
+			s.dropped.Add(1)
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns the message counts since the bus was created.
+func (b *Bus) Stats() Stats {
+	return Stats{
+		Published:  b.published.Load(),
+		Received:   b.received.Load(),
+		Dropped:    b.dropped.Load(),
+		Reconnects: b.reconnects.Load(),
+	}
+}
+
+// Close closes the connection and all subscriptions.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.cancel()
+	ps, done := b.ps, b.done
+	for _, index := range []map[string]map[*Subscription]struct{}{b.channels, b.patterns} {
+		for _, subs := range index {
+			for s := range subs {
+				s.once.Do(func() { close(s.c) })
+			}
+		}
+	}
+	clear(b.channels)
+	clear(b.patterns)
+	b.mu.Unlock()
+	if ps == nil {
+		return nil
+	}
+	err := ps.Close()
+	<-done
+	if err != nil {
+		return errs.WrapMsg(err, "redis pubsub close failed")
+	}
+	return nil
+}
+
+// Topic publishes and receives values of type T as JSON on a channel.
+type Topic[T any] struct {
+	bus     *Bus
+	channel string
+}
+
+func NewTopic[T any](bus *Bus, channel string) *Topic[T] {
+	return &Topic[T]{bus: bus, channel: channel}
+}
+
+func (t *Topic[T]) Publish(ctx context.Context, v T) error {
+	data, err := jsonutil.Marshal(v)
+	if err != nil {
+		return errs.WrapMsg(err, "pubsub encode failed", "channel", t.channel)
+	}
+	return t.bus.Publish(ctx, t.channel, string(data))
+}
+
+// Listen calls fn with every value published to the topic until ctx is done
+// or the bus is closed. Payloads that do not decode are logged and skipped.
+func (t *Topic[T]) Listen(ctx context.Context, fn func(ctx context.Context, v T)) error {
+	sub, err := t.bus.Subscribe(ctx, t.channel)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-sub.C:
+			if !ok {
+				return ErrClosed.Wrap()
+			}
+			var v T
+			if err := jsonutil.Unmarshal([]byte(m.Payload), &v); err != nil {
+				log.ZWarn(ctx, "pubsub decode failed", err, "channel", m.Channel)
+				continue
+			}
+			fn(ctx, v)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attach registers a subscription without a Redis connection.
+func attach(b *Bus, pattern bool, names ...string) *Subscription {
+	c := make(chan Message, b.conf.Buffer)
+	s := &Subscription{bus: b, names: names, pattern: pattern, c: c, C: c}
+	index := b.index(pattern)
+	for _, name := range names {
+		if index[name] == nil {
+			index[name] = make(map[*Subscription]struct{})
+		}
+		index[name][s] = struct{}{}
+	}
+	return s
+}
+
+func TestDispatch(t *testing.T) {
+	b := New(nil, Config{Buffer: 1})
+	kick := attach(b, false, "kick")
+	all := attach(b, true, "kick:*")
+
+	b.dispatch(Message{Channel: "kick", Payload: "u1"})
+	b.dispatch(Message{Channel: "kick", Payload: "u2"}) // Buffer full.
+	b.dispatch(Message{Channel: "kick:u3", Pattern: "kick:*", Payload: "u3"})
+
+	assert.Equal(t, Message{Channel: "kick", Payload: "u1"}, <-kick.C)
+	assert.Equal(t, "u3", (<-all.C).Payload)
+	assert.Equal(t, int64(1), kick.Dropped())
+	assert.Equal(t, Stats{Received: 3, Dropped: 1}, b.Stats())
+
+	require.NoError(t, b.Close())
+	_, ok := <-kick.C
+	assert.False(t, ok)
+	assert.NoError(t, kick.Close())
+	_, err := b.Subscribe(context.Background(), "kick")
+	assert.True(t, ErrClosed.Is(err))
+}
+
+func TestBackoff(t *testing.T) {
+	b := New(nil, Config{MinBackoff: time.Second, MaxBackoff: 3 * time.Second})
+	assert.Equal(t, time.Second, b.backoff(1))
+	assert.Equal(t, 2*time.Second, b.backoff(2))
+	assert.Equal(t, 3*time.Second, b.backoff(5))
+}
+
+type kickEvent struct {
+	UserID   string `json:"userID"`
+	Platform int    `json:"platform"`
+}
+
+func TestRedis(t *testing.T) {
+	rdb := containers.Redis(t)
+	b := New(rdb, Config{})
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sub, err := b.PSubscribe(ctx, "online:*")
+	require.NoError(t, err)
+	topic := NewTopic[kickEvent](b, "kick")
+	got := make(chan kickEvent, 1)
+	go func() {
+		_ = topic.Listen(ctx, func(ctx context.Context, v kickEvent) { got <- v })
+	}()
+	require.Eventually(t, func() bool {
+		n, err := rdb.PubSubNumSub(ctx, "kick").Result()
+		return err == nil && n["kick"] > 0
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, topic.Publish(ctx, kickEvent{UserID: "u1", Platform: 1}))
+	require.NoError(t, b.Publish(ctx, "online:u2", "1"))
+	assert.Equal(t, kickEvent{UserID: "u1", Platform: 1}, <-got)
+	assert.Equal(t, Message{Channel: "online:u2", Pattern: "online:*", Payload: "1"}, <-sub.C)
+	assert.Equal(t, int64(2), b.Stats().Published)
+}
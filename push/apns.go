@@ -0,0 +1,203 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	apnsProductionEndpoint  = "https://api.push.apple.com"
+	apnsDevelopmentEndpoint = "https://api.sandbox.push.apple.com"
+	// Apple rejects provider tokens older than an hour and throttles tokens
+	// refreshed more often than every 20 minutes.
+	apnsTokenLifetime = 50 * time.Minute
+)
+
+// APNsCredentials is a token based (.p8) APNs signing key.
+type APNsCredentials struct {
+	KeyID      string
+	TeamID     string
+	PrivateKey string // Content of the .p8 file.
+}
+
+// APNsConfig configures the APNs provider.
+type APNsConfig struct {
+	Credentials *APNsCredentials
+	Topic       string       // The app bundle ID.
+	Production  bool         // Use the production instead of the sandbox environment.
+	Endpoint    string       // Overrides the environment endpoint.
+	HTTPClient  *http.Client // Nil for a client speaking HTTP/2 as APNs requires.
+	Concurrency int          // Parallel requests of SendBatch, 0 for 16.
+}
+
+type apnsState struct {
+	creds APNsCredentials
+	key   *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// bearer returns the cached provider token, signing a new one when it is too old.
+func (s *apnsState) bearer(now time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && now.Sub(s.issuedAt) < apnsTokenLifetime {
+		return s.token, nil
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": s.creds.TeamID, "iat": now.Unix()})
+	t.Header["kid"] = s.creds.KeyID
+	token, err := t.SignedString(s.key)
+	if err != nil {
+		return "", ErrCredential.WrapMsg(err.Error(), "provider", "apns")
+	}
+	s.token, s.issuedAt = token, now
+	return token, nil
+}
+
+func (s *apnsState) invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+}
+
+// APNs sends through the Apple Push Notification service.
+type APNs struct {
+	conf  APNsConfig
+	state atomic.Pointer[apnsState]
+}
+
+// NewAPNs creates an APNs provider.
+func NewAPNs(conf APNsConfig) (*APNs, error) {
+	if conf.Topic == "" {
+		return nil, errs.ErrArgs.WrapMsg("apns topic is empty")
+	}
+	if conf.Endpoint == "" {
+		conf.Endpoint = apnsDevelopmentEndpoint
+		if conf.Production {
+			conf.Endpoint = apnsProductionEndpoint
+		}
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = &http.Client{Transport: &http.Transport{ForceAttemptHTTP2: true}, Timeout: 30 * time.Second}
+	}
+	a := &APNs{conf: conf}
+	if err := a.SetCredentials(conf.Credentials); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetCredentials replaces the signing key, for example after a key rotation.
+func (a *APNs) SetCredentials(creds *APNsCredentials) error {
+	if creds == nil || creds.KeyID == "" || creds.TeamID == "" {
+		return errs.ErrArgs.WrapMsg("apns credentials incomplete")
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM([]byte(creds.PrivateKey))
+	if err != nil {
+		return errs.ErrArgs.WrapMsg("apns private key invalid", "keyID", creds.KeyID, "err", err)
+	}
+	a.state.Store(&apnsState{creds: *creds, key: key})
+	return nil
+}
+
+func (a *APNs) Name() string {
+	return "apns"
+}
+
+func (a *APNs) Send(ctx context.Context, token string, msg *Message) error {
+	state := a.state.Load()
+	bearer, err := state.bearer(time.Now())
+	if err != nil {
+		return err
+	}
+	header := http.Header{
+		"Authorization":  {"bearer " + bearer},
+		"Apns-Topic":     {a.conf.Topic},
+		"Apns-Push-Type": {"alert"},
+		"Apns-Priority":  {"10"},
+	}
+	if msg.TTL > 0 {
+		header.Set("Apns-Expiration", strconv.FormatInt(time.Now().Add(msg.TTL).Unix(), 10))
+	}
+	status, resp, err := postJSON(ctx, a.conf.HTTPClient, a.conf.Endpoint+"/3/device/"+token, header, apnsPayload(msg))
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	_ = json.Unmarshal(resp, &body)
+	switch body.Reason {
+	case "BadDeviceToken", "Unregistered", "DeviceTokenNotForTopic", "ExpiredToken":
+		return ErrInvalidToken.WrapMsg(body.Reason, "provider", a.Name(), "status", status)
+	case "ExpiredProviderToken", "InvalidProviderToken":
+		state.invalidate(bearer)
+		return ErrCredential.WrapMsg(body.Reason, "provider", a.Name(), "status", status)
+	case "TooManyRequests", "TooManyProviderTokenUpdates":
+		return ErrRateLimited.WrapMsg(body.Reason, "provider", a.Name(), "status", status)
+	}
+	if status == http.StatusGone {
+		return ErrInvalidToken.WrapMsg(body.Reason, "provider", a.Name(), "status", status)
+	}
+	return statusError(status, body.Reason, "provider", a.Name())
+}
+
+func (a *APNs) SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error) {
+	return sendEach(ctx, tokens, a.conf.Concurrency, func(ctx context.Context, token string) error {
+		return a.Send(ctx, token, msg)
+	}), nil
+}
+
+// SendTopic is not supported, APNs has no topic subscriptions.
+func (a *APNs) SendTopic(ctx context.Context, topic string, msg *Message) error {
+	return ErrUnsupported.WrapMsg("apns does not support topics", "topic", topic)
+}
+
+func apnsPayload(msg *Message) map[string]any {
+	aps := map[string]any{
+		"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+	}
+	if msg.Badge != nil {
+		aps["badge"] = *msg.Badge
+	}
+	if msg.Sound != "" {
+		aps["sound"] = msg.Sound
+	}
+	payload := map[string]any{"aps": aps}
+	for k, v := range msg.Data {
+		if k != "aps" {
+			payload[k] = v
+		}
+	}
+	return payload
+}
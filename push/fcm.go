@@ -0,0 +1,221 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openimsdk/tools/errs"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	fcmScope           = "https://www.googleapis.com/auth/firebase.messaging"
+	fcmDefaultEndpoint = "https://fcm.googleapis.com"
+	googleTokenURL     = "https://oauth2.googleapis.com/token"
+)
+
+// FCMCredentials is a Firebase service account.
+type FCMCredentials struct {
+	ProjectID   string `json:"project_id"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"` // PEM encoded RSA key.
+	TokenURI    string `json:"token_uri"`   // Empty for the Google default.
+}
+
+// ParseFCMCredentials parses a service account JSON file as downloaded from the Firebase console.
+func ParseFCMCredentials(data []byte) (*FCMCredentials, error) {
+	var c FCMCredentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errs.WrapMsg(err, "parse fcm service account failed")
+	}
+	return &c, nil
+}
+
+// FCMConfig configures the FCM HTTP v1 provider.
+type FCMConfig struct {
+	Credentials *FCMCredentials
+	Endpoint    string       // Empty for https://fcm.googleapis.com.
+	HTTPClient  *http.Client // Nil for http.DefaultClient.
+	Concurrency int          // Parallel requests of SendBatch, 0 for 16.
+}
+
+type fcmState struct {
+	creds  FCMCredentials
+	tokens oauth2.TokenSource
+}
+
+// FCM sends through Firebase Cloud Messaging.
+type FCM struct {
+	conf  FCMConfig
+	state atomic.Pointer[fcmState]
+}
+
+// NewFCM creates an FCM provider.
+func NewFCM(conf FCMConfig) (*FCM, error) {
+	if conf.Endpoint == "" {
+		conf.Endpoint = fcmDefaultEndpoint
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	f := &FCM{conf: conf}
+	if err := f.SetCredentials(conf.Credentials); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// SetCredentials replaces the service account, for example after a key rotation.
+// Requests already in flight finish with the old credentials.
+func (f *FCM) SetCredentials(creds *FCMCredentials) error {
+	if creds == nil || creds.ProjectID == "" || creds.ClientEmail == "" || creds.PrivateKey == "" {
+		return errs.ErrArgs.WrapMsg("fcm credentials incomplete")
+	}
+	tokenURL := creds.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	conf := &jwt.Config{
+		Email:      creds.ClientEmail,
+		PrivateKey: []byte(creds.PrivateKey),
+		Scopes:     []string{fcmScope},
+		TokenURL:   tokenURL,
+	}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, f.conf.HTTPClient)
+	f.state.Store(&fcmState{creds: *creds, tokens: oauth2.ReuseTokenSource(nil, conf.TokenSource(ctx))})
+	return nil
+}
+
+func (f *FCM) Name() string {
+	return "fcm"
+}
+
+func (f *FCM) Send(ctx context.Context, token string, msg *Message) error {
+	return f.send(ctx, fcmTarget{Token: token}, msg)
+}
+
+func (f *FCM) SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error) {
+	return sendEach(ctx, tokens, f.conf.Concurrency, func(ctx context.Context, token string) error {
+		return f.Send(ctx, token, msg)
+	}), nil
+}
+
+func (f *FCM) SendTopic(ctx context.Context, topic string, msg *Message) error {
+	return f.send(ctx, fcmTarget{Topic: topic}, msg)
+}
+
+type fcmTarget struct {
+	Token string
+	Topic string
+}
+
+func (f *FCM) send(ctx context.Context, target fcmTarget, msg *Message) error {
+	state := f.state.Load()
+	tok, err := state.tokens.Token()
+	if err != nil {
+		return ErrCredential.WrapMsg(err.Error(), "provider", f.Name())
+	}
+	body := map[string]any{"message": fcmMessage(target, msg)}
+	header := http.Header{"Authorization": {"Bearer " + tok.AccessToken}}
+	url := f.conf.Endpoint + "/v1/projects/" + state.creds.ProjectID + "/messages:send"
+	status, resp, err := postJSON(ctx, f.conf.HTTPClient, url, header, body)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	return fcmError(status, resp)
+}
+
+func fcmMessage(target fcmTarget, msg *Message) map[string]any {
+	m := map[string]any{
+		"notification": map[string]string{"title": msg.Title, "body": msg.Body},
+	}
+	if target.Topic != "" {
+		m["topic"] = target.Topic
+	} else {
+		m["token"] = target.Token
+	}
+	if len(msg.Data) > 0 {
+		m["data"] = msg.Data
+	}
+	android := map[string]any{"priority": "high"}
+	if msg.TTL > 0 {
+		android["ttl"] = strconv.FormatInt(int64(msg.TTL.Seconds()), 10) + "s"
+	}
+	if msg.Sound != "" {
+		android["notification"] = map[string]string{"sound": msg.Sound}
+	}
+	m["android"] = android
+	aps := map[string]any{}
+	if msg.Badge != nil {
+		aps["badge"] = *msg.Badge
+	}
+	if msg.Sound != "" {
+		aps["sound"] = msg.Sound
+	}
+	if len(aps) > 0 {
+		m["apns"] = map[string]any{"payload": map[string]any{"aps": aps}}
+	}
+	return m
+}
+
+type fcmErrorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+		Details []struct {
+			Type      string `json:"@type"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+func fcmError(status int, data []byte) error {
+	var body fcmErrorBody
+	_ = json.Unmarshal(data, &body)
+	reason := body.Error.Status
+	for _, d := range body.Error.Details {
+		if strings.HasSuffix(d.Type, "FcmError") && d.ErrorCode != "" {
+			reason = d.ErrorCode
+		}
+	}
+	kv := []any{"provider", "fcm", "status", status, "message", body.Error.Message}
+	switch reason {
+	case "UNREGISTERED", "SENDER_ID_MISMATCH":
+		return ErrInvalidToken.WrapMsg(reason, kv...)
+	case "INVALID_ARGUMENT":
+		if strings.Contains(body.Error.Message, "registration token") {
+			return ErrInvalidToken.WrapMsg(reason, kv...)
+		}
+		return ErrProviderRejected.WrapMsg(reason, kv...)
+	case "QUOTA_EXCEEDED":
+		return ErrRateLimited.WrapMsg(reason, kv...)
+	case "UNAVAILABLE", "INTERNAL":
+		return ErrProviderUnavailable.WrapMsg(reason, kv...)
+	case "THIRD_PARTY_AUTH_ERROR", "PERMISSION_DENIED", "UNAUTHENTICATED":
+		return ErrCredential.WrapMsg(reason, kv...)
+	}
+	return statusError(status, reason, "provider", "fcm", "message", body.Error.Message)
+}
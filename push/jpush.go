@@ -0,0 +1,160 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	jpushDefaultEndpoint = "https://api.jpush.cn"
+	// jpushMaxAudience is the maximum number of registration IDs per request.
+	jpushMaxAudience = 1000
+)
+
+// JPushCredentials are the app key and master secret of a JPush app.
+type JPushCredentials struct {
+	AppKey       string
+	MasterSecret string
+}
+
+// JPushConfig configures the JPush provider.
+type JPushConfig struct {
+	Credentials *JPushCredentials
+	Production  bool         // Deliver iOS messages through the APNs production environment.
+	Endpoint    string       // Empty for https://api.jpush.cn.
+	HTTPClient  *http.Client // Nil for http.DefaultClient.
+}
+
+// JPush sends through JPush (Aurora), addressing devices by registration ID
+// and topics by tag.
+type JPush struct {
+	conf JPushConfig
+	auth atomic.Pointer[string]
+}
+
+// NewJPush creates a JPush provider.
+func NewJPush(conf JPushConfig) (*JPush, error) {
+	if conf.Endpoint == "" {
+		conf.Endpoint = jpushDefaultEndpoint
+	}
+	if conf.HTTPClient == nil {
+		conf.HTTPClient = http.DefaultClient
+	}
+	j := &JPush{conf: conf}
+	if err := j.SetCredentials(conf.Credentials); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// SetCredentials replaces the app key and master secret.
+func (j *JPush) SetCredentials(creds *JPushCredentials) error {
+	if creds == nil || creds.AppKey == "" || creds.MasterSecret == "" {
+		return errs.ErrArgs.WrapMsg("jpush credentials incomplete")
+	}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.AppKey+":"+creds.MasterSecret))
+	j.auth.Store(&auth)
+	return nil
+}
+
+func (j *JPush) Name() string {
+	return "jpush"
+}
+
+func (j *JPush) Send(ctx context.Context, token string, msg *Message) error {
+	return j.push(ctx, map[string]any{"registration_id": []string{token}}, msg)
+}
+
+// SendBatch sends in chunks of 1000 registration IDs. JPush does not report
+// which IDs are invalid, so tokens are only marked invalid when a whole chunk
+// matches no device.
+func (j *JPush) SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error) {
+	res := &BatchResult{}
+	for start := 0; start < len(tokens); start += jpushMaxAudience {
+		chunk := tokens[start:min(start+jpushMaxAudience, len(tokens))]
+		err := j.push(ctx, map[string]any{"registration_id": chunk}, msg)
+		for _, token := range chunk {
+			res.add(token, err)
+		}
+	}
+	return res, nil
+}
+
+func (j *JPush) SendTopic(ctx context.Context, topic string, msg *Message) error {
+	return j.push(ctx, map[string]any{"tag": []string{topic}}, msg)
+}
+
+func (j *JPush) push(ctx context.Context, audience map[string]any, msg *Message) error {
+	extras := make(map[string]string, len(msg.Data))
+	for k, v := range msg.Data {
+		extras[k] = v
+	}
+	ios := map[string]any{
+		"alert":  map[string]string{"title": msg.Title, "body": msg.Body},
+		"extras": extras,
+	}
+	if msg.Badge != nil {
+		ios["badge"] = *msg.Badge
+	}
+	if msg.Sound != "" {
+		ios["sound"] = msg.Sound
+	}
+	options := map[string]any{"apns_production": j.conf.Production}
+	if msg.TTL > 0 {
+		options["time_to_live"] = int64(msg.TTL.Seconds())
+	}
+	body := map[string]any{
+		"platform": "all",
+		"audience": audience,
+		"notification": map[string]any{
+			"alert":   msg.Body,
+			"android": map[string]any{"alert": msg.Body, "title": msg.Title, "extras": extras},
+			"ios":     ios,
+		},
+		"options": options,
+	}
+	header := http.Header{"Authorization": {*j.auth.Load()}}
+	status, resp, err := postJSON(ctx, j.conf.HTTPClient, j.conf.Endpoint+"/v3/push", header, body)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		return nil
+	}
+	var res struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(resp, &res)
+	kv := []any{"provider", j.Name(), "status", status, "code", res.Error.Code}
+	switch res.Error.Code {
+	case 1011: // Cannot find user by this audience.
+		return ErrInvalidToken.WrapMsg(res.Error.Message, kv...)
+	case 1004, 1008: // Authentication failed, app key invalid.
+		return ErrCredential.WrapMsg(res.Error.Message, kv...)
+	case 2002, 2008: // API call frequency or quota exceeded.
+		return ErrRateLimited.WrapMsg(res.Error.Message, kv...)
+	}
+	return statusError(status, res.Error.Message, "provider", j.Name(), "code", res.Error.Code)
+}
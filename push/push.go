@@ -0,0 +1,181 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push sends notifications to devices through vendor push services.
+// Every vendor implements Provider and reports failures with the error codes
+// below, so callers can for example delete tokens rejected with ErrInvalidToken
+// regardless of the vendor.
+package push
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	InvalidTokenError        = 1801 // The device token is unknown, expired or belongs to another app and should be removed.
+	RateLimitedError         = 1802 // The vendor throttled the request.
+	ProviderUnavailableError = 1803 // The vendor failed or was unreachable, the request may be retried.
+	CredentialError          = 1804 // The vendor rejected the configured credentials.
+	ProviderRejectedError    = 1805 // The vendor rejected the message itself.
+	UnsupportedError         = 1806 // The vendor does not support the operation.
+)
+
+var (
+	ErrInvalidToken        = errs.NewCodeError(InvalidTokenError, "PushInvalidTokenError")
+	ErrRateLimited         = errs.NewCodeError(RateLimitedError, "PushRateLimitedError")
+	ErrProviderUnavailable = errs.NewCodeError(ProviderUnavailableError, "PushProviderUnavailableError")
+	ErrCredential          = errs.NewCodeError(CredentialError, "PushCredentialError")
+	ErrProviderRejected    = errs.NewCodeError(ProviderRejectedError, "PushProviderRejectedError")
+	ErrUnsupported         = errs.NewCodeError(UnsupportedError, "PushUnsupportedError")
+)
+
+func init() {
+	errs.SetRetryClass(RateLimitedError, errs.Retryable)
+	errs.SetRetryClass(ProviderUnavailableError, errs.Temporary)
+}
+
+// IsInvalidToken reports whether err means the device token should be removed.
+func IsInvalidToken(err error) bool {
+	return ErrInvalidToken.Is(err)
+}
+
+// Message is a vendor neutral notification.
+type Message struct {
+	Title string
+	Body  string
+	Data  map[string]string // Custom key/values delivered to the app.
+	Sound string            // Sound name, empty for the vendor default.
+	Badge *int              // Badge count on iOS, nil leaves it unchanged.
+	TTL   time.Duration     // How long the vendor keeps the message for offline devices, 0 for the vendor default.
+}
+
+// Provider is a push vendor.
+type Provider interface {
+	// Name returns the vendor name, for example "fcm".
+	Name() string
+	// Send pushes msg to a single device.
+	Send(ctx context.Context, token string, msg *Message) error
+	// SendBatch pushes msg to several devices. Failures of individual devices are
+	// reported in the result, the error is only set when the whole batch failed.
+	SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error)
+	// SendTopic pushes msg to all devices subscribed to topic.
+	SendTopic(ctx context.Context, topic string, msg *Message) error
+}
+
+// BatchResult is the outcome of SendBatch.
+type BatchResult struct {
+	Success int
+	Failed  map[string]error // Error per failed token.
+}
+
+// InvalidTokens returns the tokens that failed with ErrInvalidToken.
+func (r *BatchResult) InvalidTokens() []string {
+	var tokens []string
+	for token, err := range r.Failed {
+		if IsInvalidToken(err) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func (r *BatchResult) add(token string, err error) {
+	if err == nil {
+		r.Success++
+		return
+	}
+	if r.Failed == nil {
+		r.Failed = make(map[string]error)
+	}
+	r.Failed[token] = err
+}
+
+// sendEach implements SendBatch for vendors without a batch API by calling
+// send for every token with at most concurrency requests in flight.
+func sendEach(ctx context.Context, tokens []string, concurrency int, send func(ctx context.Context, token string) error) *BatchResult {
+	if concurrency <= 0 {
+		concurrency = 16
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		res = &BatchResult{}
+		sem = make(chan struct{}, concurrency)
+	)
+	for _, token := range tokens {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(token string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			err := send(ctx, token)
+			mu.Lock()
+			res.add(token, err)
+			mu.Unlock()
+		}(token)
+	}
+	wg.Wait()
+	return res
+}
+
+// postJSON posts body as JSON and returns the status code and response body.
+func postJSON(ctx context.Context, cli *http.Client, url string, header http.Header, body any) (int, []byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, errs.WrapMsg(err, "push request marshal failed")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return 0, nil, errs.WrapMsg(err, "push request create failed", "url", url)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := cli.Do(req)
+	if err != nil {
+		return 0, nil, ErrProviderUnavailable.WrapMsg(err.Error(), "url", url)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, ErrProviderUnavailable.WrapMsg(err.Error(), "url", url)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// statusError maps an HTTP status without a more specific vendor reason.
+func statusError(status int, reason string, kv ...any) error {
+	kv = append(kv, "status", status)
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited.WrapMsg(reason, kv...)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrCredential.WrapMsg(reason, kv...)
+	case status >= 500:
+		return ErrProviderUnavailable.WrapMsg(reason, kv...)
+	default:
+		return ErrProviderRejected.WrapMsg(reason, kv...)
+	}
+}
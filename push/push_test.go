@@ -0,0 +1,246 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rsaPEM(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func ecPEM(t *testing.T) (string, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), key
+}
+
+func TestFCM(t *testing.T) {
+	var tokenRequests atomic.Int32
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			tokenRequests.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"at","token_type":"Bearer","expires_in":3600}`))
+		case r.URL.Path == "/v1/projects/p1/messages:send":
+			assert.Equal(t, "Bearer at", r.Header.Get("Authorization"))
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			msg := body["message"].(map[string]any)
+			if msg["token"] == "gone" {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Requested entity was not found.","status":"NOT_FOUND","details":[{"@type":"type.googleapis.com/google.firebase.fcm.v1.FcmError","errorCode":"UNREGISTERED"}]}}`))
+				return
+			}
+			if msg["token"] == "busy" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			got = msg
+			_, _ = w.Write([]byte(`{"name":"projects/p1/messages/1"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	creds, err := ParseFCMCredentials([]byte(`{"project_id":"p1","client_email":"svc@p1.iam","private_key":` + jsonString(rsaPEM(t)) + `,"token_uri":"` + srv.URL + `/token"}`))
+	require.NoError(t, err)
+	f, err := NewFCM(FCMConfig{Credentials: creds, Endpoint: srv.URL})
+	require.NoError(t, err)
+
+	badge := 3
+	msg := &Message{Title: "t", Body: "b", Data: map[string]string{"k": "v"}, Badge: &badge, TTL: time.Hour}
+	require.NoError(t, f.Send(context.Background(), "dev1", msg))
+	assert.Equal(t, "dev1", got["token"])
+	assert.Equal(t, map[string]any{"k": "v"}, got["data"])
+	assert.Equal(t, "3600s", got["android"].(map[string]any)["ttl"])
+
+	require.NoError(t, f.SendTopic(context.Background(), "news", msg))
+	assert.Equal(t, "news", got["topic"])
+
+	res, err := f.SendBatch(context.Background(), []string{"dev1", "gone", "busy"}, msg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Success)
+	assert.Equal(t, []string{"gone"}, res.InvalidTokens())
+	assert.True(t, ErrProviderUnavailable.Is(res.Failed["busy"]))
+	assert.Equal(t, int32(1), tokenRequests.Load(), "access token is reused")
+
+	// Rotating the credentials fetches a new access token.
+	require.NoError(t, f.SetCredentials(creds))
+	require.NoError(t, f.Send(context.Background(), "dev1", msg))
+	assert.Equal(t, int32(2), tokenRequests.Load())
+	assert.Error(t, f.SetCredentials(&FCMCredentials{ProjectID: "p1"}))
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func TestAPNs(t *testing.T) {
+	keyPEM, key := ecPEM(t)
+	var bearers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "bearer ")
+		bearers = append(bearers, bearer)
+		tok, err := jwt.Parse(bearer, func(*jwt.Token) (any, error) { return &key.PublicKey, nil })
+		require.NoError(t, err)
+		assert.Equal(t, "KEY1", tok.Header["kid"])
+		assert.Equal(t, "TEAM1", tok.Claims.(jwt.MapClaims)["iss"])
+		assert.Equal(t, "com.openim.app", r.Header.Get("apns-topic"))
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered"}`))
+		case "expired":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		default:
+			var payload map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+			assert.Equal(t, "v", payload["k"])
+			assert.Equal(t, map[string]any{"title": "t", "body": "b"}, payload["aps"].(map[string]any)["alert"])
+		}
+	}))
+	defer srv.Close()
+
+	a, err := NewAPNs(APNsConfig{
+		Credentials: &APNsCredentials{KeyID: "KEY1", TeamID: "TEAM1", PrivateKey: keyPEM},
+		Topic:       "com.openim.app",
+		Endpoint:    srv.URL,
+		HTTPClient:  srv.Client(),
+	})
+	require.NoError(t, err)
+	msg := &Message{Title: "t", Body: "b", Data: map[string]string{"k": "v"}}
+	require.NoError(t, a.Send(context.Background(), "dev1", msg))
+	require.NoError(t, a.Send(context.Background(), "dev2", msg))
+	assert.Equal(t, bearers[0], bearers[1], "provider token is cached")
+
+	assert.True(t, IsInvalidToken(a.Send(context.Background(), "gone", msg)))
+	assert.True(t, ErrCredential.Is(a.Send(context.Background(), "expired", msg)))
+	time.Sleep(time.Second) // iat has second resolution
+	require.NoError(t, a.Send(context.Background(), "dev1", msg))
+	assert.NotEqual(t, bearers[0], bearers[len(bearers)-1], "rejected provider token is replaced")
+
+	assert.True(t, ErrUnsupported.Is(a.SendTopic(context.Background(), "news", msg)))
+}
+
+func TestJPush(t *testing.T) {
+	var audiences []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "app" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":1004,"message":"Authen failed"}}`))
+			return
+		}
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		audience := body["audience"].(map[string]any)
+		audiences = append(audiences, audience)
+		if ids, ok := audience["registration_id"].([]any); ok && ids[0] == "gone" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"code":1011,"message":"cannot find user by this audience"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"sendno":"0","msg_id":"1"}`))
+	}))
+	defer srv.Close()
+
+	j, err := NewJPush(JPushConfig{Credentials: &JPushCredentials{AppKey: "app", MasterSecret: "secret"}, Endpoint: srv.URL})
+	require.NoError(t, err)
+	msg := &Message{Title: "t", Body: "b"}
+	require.NoError(t, j.Send(context.Background(), "rid", msg))
+	require.NoError(t, j.SendTopic(context.Background(), "news", msg))
+	assert.Equal(t, []any{"news"}, audiences[1]["tag"])
+	assert.True(t, IsInvalidToken(j.Send(context.Background(), "gone", msg)))
+
+	tokens := make([]string, 1500)
+	for i := range tokens {
+		tokens[i] = "rid"
+	}
+	audiences = nil
+	res, err := j.SendBatch(context.Background(), tokens, msg)
+	require.NoError(t, err)
+	assert.Len(t, audiences, 2)
+	assert.Equal(t, 1500, res.Success)
+
+	require.NoError(t, j.SetCredentials(&JPushCredentials{AppKey: "app", MasterSecret: "rotated"}))
+	assert.True(t, ErrCredential.Is(j.Send(context.Background(), "rid", msg)))
+}
+
+type countProvider struct {
+	sent atomic.Int32
+}
+
+func (c *countProvider) Name() string { return "count" }
+
+func (c *countProvider) Send(ctx context.Context, token string, msg *Message) error {
+	c.sent.Add(1)
+	return nil
+}
+
+func (c *countProvider) SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error) {
+	c.sent.Add(int32(len(tokens)))
+	return &BatchResult{Success: len(tokens)}, nil
+}
+
+func (c *countProvider) SendTopic(ctx context.Context, topic string, msg *Message) error {
+	c.sent.Add(1)
+	return nil
+}
+
+func TestRateLimit(t *testing.T) {
+	inner := &countProvider{}
+	p := RateLimit(inner, 100, 5)
+	assert.Equal(t, "count", p.Name())
+
+	start := time.Now()
+	_, err := p.SendBatch(context.Background(), make([]string, 15), &Message{})
+	require.NoError(t, err)
+	// The burst of 5 is free, the remaining 10 need about 100ms at 100/s.
+	assert.GreaterOrEqual(t, time.Since(start), 80*time.Millisecond)
+	assert.Equal(t, int32(15), inner.sent.Load())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = p.SendBatch(ctx, make([]string, 50), &Message{})
+	assert.True(t, ErrRateLimited.Is(err))
+}
@@ -0,0 +1,73 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package push
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimit wraps p so that it sends at most limit messages per second with
+// the given burst. Each token of a batch counts as one message, topic
+// messages count as one.
+func RateLimit(p Provider, limit float64, burst int) Provider {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimited{Provider: p, limiter: rate.NewLimiter(rate.Limit(limit), burst)}
+}
+
+type rateLimited struct {
+	Provider
+	limiter *rate.Limiter
+}
+
+func (r *rateLimited) wait(ctx context.Context, n int) error {
+	for n > 0 {
+		step := min(n, r.limiter.Burst())
+		if err := r.limiter.WaitN(ctx, step); err != nil {
+			return ErrRateLimited.WrapMsg(err.Error(), "provider", r.Name())
+		}
+		n -= step
+	}
+	return nil
+}
+
+func (r *rateLimited) Send(ctx context.Context, token string, msg *Message) error {
+	if err := r.wait(ctx, 1); err != nil {
+		return err
+	}
+	return r.Provider.Send(ctx, token, msg)
+}
+
+func (r *rateLimited) SendBatch(ctx context.Context, tokens []string, msg *Message) (*BatchResult, error) {
+	if err := r.wait(ctx, len(tokens)); err != nil {
+		return nil, err
+	}
+	return r.Provider.SendBatch(ctx, tokens, msg)
+}
+
+func (r *rateLimited) SendTopic(ctx context.Context, topic string, msg *Message) error {
+	if err := r.wait(ctx, 1); err != nil {
+		return err
+	}
+	return r.Provider.SendTopic(ctx, topic, msg)
+}
+
+// Unwrap returns the wrapped provider.
+func (r *rateLimited) Unwrap() Provider {
+	return r.Provider
+}
@@ -0,0 +1,265 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Broker persists queued jobs. Implementations must be safe for concurrent
+// use by clients and servers on many instances.
+type Broker interface {
+	// Enqueue adds a pending task, or a scheduled one when processAt is in
+	// the future. A task with a UniqueKey holds it until it is done or dead,
+	// for at most uniqueTTL.
+	Enqueue(ctx context.Context, task *Task, processAt time.Time, uniqueTTL time.Duration) error
+	// Dequeue leases the oldest pending task of the queue for its timeout,
+	// or timeout when it has none, plus grace. It returns nil when the queue
+	// is empty.
+	Dequeue(ctx context.Context, queue string, timeout, grace time.Duration) (*Task, error)
+	// Forward makes due scheduled tasks and tasks with expired leases
+	// pending again and returns their number.
+	Forward(ctx context.Context, queue string) (int, error)
+	// Done removes a leased task that succeeded.
+	Done(ctx context.Context, task *Task) error
+	// Retry schedules a leased task that failed for at.
+	Retry(ctx context.Context, task *Task, at time.Time) error
+	// Kill moves a leased task to the dead-letter set.
+	Kill(ctx context.Context, task *Task) error
+
+	Info(ctx context.Context, queue string) (*QueueInfo, error)
+	// Dead lists dead tasks, the latest first.
+	Dead(ctx context.Context, queue string, offset, limit int) ([]*Task, error)
+	// Requeue makes a dead task pending again with its retries reset. It
+	// fails with errs.ErrRecordNotFound for unknown tasks.
+	Requeue(ctx context.Context, queue, id string) error
+	DeleteDead(ctx context.Context, queue, id string) error
+}
+
+// NewMemoryBroker returns a Broker for a single process and tests. It keeps
+// at most maxDead dead tasks per queue, 10000 when zero.
+func NewMemoryBroker(maxDead int) Broker {
+	if maxDead <= 0 {
+		maxDead = 10000
+	}
+	return &memoryBroker{maxDead: maxDead, queues: make(map[string]*memoryQueue), unique: make(map[string]memoryLock)}
+}
+
+type memoryBroker struct {
+	mu      sync.Mutex
+	maxDead int
+	queues  map[string]*memoryQueue
+	unique  map[string]memoryLock
+}
+
+type memoryQueue struct {
+	tasks     map[string]Task
+	pending   []string
+	scheduled map[string]time.Time
+	active    map[string]time.Time
+	dead      map[string]time.Time
+}
+
+type memoryLock struct {
+	id      string
+	expires time.Time
+}
+
+func (b *memoryBroker) queue(name string) *memoryQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memoryQueue{
+			tasks:     make(map[string]Task),
+			scheduled: make(map[string]time.Time),
+			active:    make(map[string]time.Time),
+			dead:      make(map[string]time.Time),
+		}
+		b.queues[name] = q
+	}
+	return q
+}
+
+func (b *memoryBroker) Enqueue(_ context.Context, task *Task, processAt time.Time, uniqueTTL time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	q := b.queue(task.Queue)
+	if _, ok := q.tasks[task.ID]; ok {
+		return ErrIDConflict.WrapMsg("job id is in use", "id", task.ID)
+	}
+	if task.UniqueKey != "" {
+		if l, ok := b.unique[task.UniqueKey]; ok && l.expires.After(now) {
+			return ErrDuplicate.WrapMsg("duplicate job", "type", task.Type, "queuedID", l.id)
+		}
+		b.unique[task.UniqueKey] = memoryLock{id: task.ID, expires: now.Add(uniqueTTL)}
+	}
+	q.tasks[task.ID] = *task
+	if processAt.After(now) {
+		q.scheduled[task.ID] = processAt
+	} else {
+		q.pending = append(q.pending, task.ID)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Dequeue(_ context.Context, queue string, timeout, grace time.Duration) (*Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queue)
+	if len(q.pending) == 0 {
+		return nil, nil
+	}
+	id := q.pending[0]
+	q.pending = q.pending[1:]
+	task := q.tasks[id]
+	if task.Timeout > 0 {
+		timeout = task.Timeout
+	}
+	q.active[id] = time.Now().Add(timeout + grace)
+	return &task, nil
+}
+
+func (b *memoryBroker) Forward(_ context.Context, queue string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	q := b.queue(queue)
+	var n int
+	for _, set := range []map[string]time.Time{q.scheduled, q.active} {
+		for id, at := range set {
+			if !at.After(now) {
+				delete(set, id)
+				q.pending = append(q.pending, id)
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+func (b *memoryBroker) release(task *Task) {
+	if l, ok := b.unique[task.UniqueKey]; ok && l.id == task.ID {
+		delete(b.unique, task.UniqueKey)
+	}
+}
+
+func (b *memoryBroker) Done(_ context.Context, task *Task) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(task.Queue)
+	delete(q.active, task.ID)
+	delete(q.tasks, task.ID)
+	b.release(task)
+	return nil
+}
+
+func (b *memoryBroker) Retry(_ context.Context, task *Task, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(task.Queue)
+	delete(q.active, task.ID)
+	q.tasks[task.ID] = *task
+	q.scheduled[task.ID] = at
+	return nil
+}
+
+func (b *memoryBroker) Kill(_ context.Context, task *Task) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(task.Queue)
+	delete(q.active, task.ID)
+	q.tasks[task.ID] = *task
+	q.dead[task.ID] = time.Now()
+	b.release(task)
+	if n := len(q.dead) - b.maxDead; n > 0 {
+		for _, id := range q.deadIDs()[len(q.dead)-n:] {
+			delete(q.dead, id)
+			delete(q.tasks, id)
+		}
+	}
+	return nil
+}
+
+// deadIDs returns the dead task ids, the latest first.
+func (q *memoryQueue) deadIDs() []string {
+	ids := make([]string, 0, len(q.dead))
+	for id := range q.dead {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return q.dead[ids[i]].After(q.dead[ids[j]]) })
+	return ids
+}
+
+func (b *memoryBroker) Info(_ context.Context, queue string) (*QueueInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queue)
+	return &QueueInfo{
+		Queue:     queue,
+		Pending:   int64(len(q.pending)),
+		Scheduled: int64(len(q.scheduled)),
+		Active:    int64(len(q.active)),
+		Dead:      int64(len(q.dead)),
+	}, nil
+}
+
+func (b *memoryBroker) Dead(_ context.Context, queue string, offset, limit int) ([]*Task, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queue)
+	ids := q.deadIDs()
+	if offset >= len(ids) {
+		return nil, nil
+	}
+	ids = ids[offset:min(len(ids), offset+limit)]
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		task := q.tasks[id]
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (b *memoryBroker) Requeue(_ context.Context, queue, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queue)
+	if _, ok := q.dead[id]; !ok {
+		return errs.ErrRecordNotFound.WrapMsg("dead job not found", "queue", queue, "id", id)
+	}
+	delete(q.dead, id)
+	task := q.tasks[id]
+	task.Retried = 0
+	q.tasks[id] = task
+	q.pending = append(q.pending, id)
+	return nil
+}
+
+func (b *memoryBroker) DeleteDead(_ context.Context, queue, id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q := b.queue(queue)
+	if _, ok := q.dead[id]; !ok {
+		return errs.ErrRecordNotFound.WrapMsg("dead job not found", "queue", queue, "id", id)
+	}
+	delete(q.dead, id)
+	delete(q.tasks, id)
+	return nil
+}
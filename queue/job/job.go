@@ -0,0 +1,205 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package job runs background jobs from persistent queues. A Client enqueues
+// typed payloads, now or later and optionally unique, and a Server processes
+// them with a pool of workers, retrying failed jobs with backoff and moving
+// those that keep failing to a dead-letter set, where an Inspector lists,
+// requeues and deletes them.
+//
+// Jobs run at least once: a worker that dies mid-job leaves the job leased,
+// and it runs again once the lease expires, so handlers must be idempotent.
+package job
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/utils/idutil"
+	"github.com/openimsdk/tools/utils/jsonutil"
+)
+
+// DefaultQueue is used by jobs enqueued without a Queue option.
+const DefaultQueue = "default"
+
+var (
+	// ErrDuplicate is returned by Enqueue for a unique job that is already
+	// queued or running.
+	ErrDuplicate = errs.New("job is a duplicate")
+	// ErrIDConflict is returned by Enqueue for a job id that is in use.
+	ErrIDConflict = errs.New("job id is in use")
+	// ErrSkipRetry is wrapped by handlers to send a job to the dead-letter
+	// set right away, e.g. for a payload that never decodes.
+	ErrSkipRetry = errs.New("skip retry")
+	// ErrNoHandler is the error of jobs whose type has no handler. They are
+	// retried, as a newer deployment may handle them.
+	ErrNoHandler = errs.New("no handler for job type")
+)
+
+// Task is a queued job.
+type Task struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	Queue       string          `json:"queue"`
+	MaxRetry    int             `json:"maxRetry"`
+	Retried     int             `json:"retried"`
+	Timeout     time.Duration   `json:"timeout,omitempty"` // Zero uses Config.Timeout.
+	UniqueKey   string          `json:"uniqueKey,omitempty"`
+	OperationID string          `json:"operationID,omitempty"`
+	EnqueuedAt  time.Time       `json:"enqueuedAt"`
+	LastError   string          `json:"lastError,omitempty"`
+	FailedAt    time.Time       `json:"failedAt,omitempty"`
+}
+
+// Decode unmarshals the payload into v.
+func (t *Task) Decode(v any) error {
+	if err := jsonutil.Unmarshal(t.Payload, v); err != nil {
+		return ErrSkipRetry.WrapMsg("decode job payload failed", "id", t.ID, "type", t.Type, "err", err.Error())
+	}
+	return nil
+}
+
+type options struct {
+	id        string
+	queue     string
+	maxRetry  int
+	timeout   time.Duration
+	processAt time.Time
+	uniqueTTL time.Duration
+}
+
+type Option func(*options)
+
+// ID sets the job id instead of a generated one. Enqueue fails with
+// ErrIDConflict while a job with the id exists.
+func ID(id string) Option {
+	return func(o *options) { o.id = id }
+}
+
+// Queue names the queue of the job.
+func Queue(name string) Option {
+	return func(o *options) { o.queue = name }
+}
+
+// MaxRetry sets how often a failed job is retried, 25 by default.
+func MaxRetry(n int) Option {
+	return func(o *options) { o.maxRetry = n }
+}
+
+// Timeout bounds a single run of the job.
+func Timeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// ProcessAt delays the job until t.
+func ProcessAt(t time.Time) Option {
+	return func(o *options) { o.processAt = t }
+}
+
+// ProcessIn delays the job by d.
+func ProcessIn(d time.Duration) Option {
+	return func(o *options) { o.processAt = time.Now().Add(d) }
+}
+
+// Unique rejects the job with ErrDuplicate while a job of the same type,
+// queue and payload is queued or running, for at most ttl.
+func Unique(ttl time.Duration) Option {
+	return func(o *options) { o.uniqueTTL = ttl }
+}
+
+// Client enqueues jobs.
+type Client struct {
+	broker Broker
+}
+
+func NewClient(broker Broker) *Client {
+	return &Client{broker: broker}
+}
+
+// Enqueue queues a job of the type with payload encoded as JSON. The
+// operationID of ctx is passed on to the handler.
+func (c *Client) Enqueue(ctx context.Context, typ string, payload any, opts ...Option) (*Task, error) {
+	o := options{queue: DefaultQueue, maxRetry: 25}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := jsonutil.Marshal(payload)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "encode job payload failed", "type", typ)
+	}
+	task := &Task{
+		ID:          o.id,
+		Type:        typ,
+		Payload:     data,
+		Queue:       o.queue,
+		MaxRetry:    o.maxRetry,
+		Timeout:     o.timeout,
+		OperationID: mcontext.GetOperationID(ctx),
+		EnqueuedAt:  time.Now(),
+	}
+	if task.ID == "" {
+		task.ID = idutil.UUIDv7()
+	}
+	if o.uniqueTTL > 0 {
+		sum := sha256.Sum256(append([]byte(o.queue+"\x00"+typ+"\x00"), data...))
+		task.UniqueKey = hex.EncodeToString(sum[:])
+	}
+	if err := c.broker.Enqueue(ctx, task, o.processAt, o.uniqueTTL); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// QueueInfo counts the jobs of a queue by state.
+type QueueInfo struct {
+	Queue     string `json:"queue"`
+	Pending   int64  `json:"pending"`
+	Scheduled int64  `json:"scheduled"` // Delayed and waiting for a retry.
+	Active    int64  `json:"active"`
+	Dead      int64  `json:"dead"`
+}
+
+// Inspector inspects queues and manages their dead jobs.
+type Inspector struct {
+	broker Broker
+}
+
+func NewInspector(broker Broker) *Inspector {
+	return &Inspector{broker: broker}
+}
+
+func (i *Inspector) Info(ctx context.Context, queue string) (*QueueInfo, error) {
+	return i.broker.Info(ctx, queue)
+}
+
+// Dead lists dead jobs, the latest first.
+func (i *Inspector) Dead(ctx context.Context, queue string, offset, limit int) ([]*Task, error) {
+	return i.broker.Dead(ctx, queue, offset, limit)
+}
+
+// Requeue queues a dead job again with its retries reset.
+func (i *Inspector) Requeue(ctx context.Context, queue, id string) error {
+	return i.broker.Requeue(ctx, queue, id)
+}
+
+// Delete removes a dead job.
+func (i *Inspector) Delete(ctx context.Context, queue, id string) error {
+	return i.broker.DeleteDead(ctx, queue, id)
+}
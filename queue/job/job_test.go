@@ -0,0 +1,258 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type archive struct {
+	ConversationID string `json:"conversationID"`
+}
+
+func testServer(broker Broker) *Server {
+	return NewServer(broker, Config{
+		Concurrency:  2,
+		PollInterval: 5 * time.Millisecond,
+		RetryDelay:   func(int, error) time.Duration { return time.Millisecond },
+	})
+}
+
+func runServer(t *testing.T, s *Server, h Handler) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, s.Run(ctx, h))
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestServerProcesses(t *testing.T) {
+	broker := NewMemoryBroker(0)
+	client := NewClient(broker)
+	mux := NewServeMux()
+	var order []string
+	var mu sync.Mutex
+	mux.Use(func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, task *Task) error {
+			mu.Lock()
+			order = append(order, "mw")
+			mu.Unlock()
+			return next.ProcessTask(ctx, task)
+		})
+	})
+	got := make(chan string, 1)
+	Handle(mux, "archive", func(ctx context.Context, p archive) error {
+		assert.Equal(t, "op1", mcontext.GetOperationID(ctx))
+		got <- p.ConversationID
+		return nil
+	})
+
+	ctx := mcontext.SetOperationID(context.Background(), "op1")
+	task, err := client.Enqueue(ctx, "archive", archive{ConversationID: "si_1_2"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, task.ID)
+
+	stop := runServer(t, testServer(broker), mux)
+	defer stop()
+	select {
+	case id := <-got:
+		assert.Equal(t, "si_1_2", id)
+	case <-time.After(time.Second):
+		t.Fatal("job not processed")
+	}
+	assert.Eventually(t, func() bool { return infoOf(t, broker).Active == 0 }, time.Second, time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"mw"}, order)
+	mu.Unlock()
+}
+
+func infoOf(t *testing.T, broker Broker) *QueueInfo {
+	info, err := broker.Info(context.Background(), DefaultQueue)
+	require.NoError(t, err)
+	return info
+}
+
+func TestServerRetriesAndKills(t *testing.T) {
+	broker := NewMemoryBroker(0)
+	client := NewClient(broker)
+	var calls atomic.Int32
+	h := HandlerFunc(func(ctx context.Context, task *Task) error {
+		if task.Type == "panic" {
+			panic("boom")
+		}
+		if calls.Add(1) < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	_, err := client.Enqueue(context.Background(), "flaky", nil, MaxRetry(5))
+	require.NoError(t, err)
+	_, err = client.Enqueue(context.Background(), "panic", nil, MaxRetry(1))
+	require.NoError(t, err)
+
+	s := testServer(broker)
+	stop := runServer(t, s, h)
+	assert.Eventually(t, func() bool {
+		st := s.Stats()
+		return st.Succeeded == 1 && st.Dead == 1
+	}, 2*time.Second, time.Millisecond)
+	stop()
+	st := s.Stats()
+	assert.Equal(t, int64(3), st.Retried) // Twice flaky, once panic.
+	assert.Equal(t, int32(3), calls.Load())
+
+	dead, err := NewInspector(broker).Dead(context.Background(), DefaultQueue, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "panic", dead[0].Type)
+	assert.Equal(t, 1, dead[0].Retried)
+	assert.NotEmpty(t, dead[0].LastError)
+}
+
+func TestSkipRetryAndNoHandler(t *testing.T) {
+	broker := NewMemoryBroker(0)
+	client := NewClient(broker)
+	mux := NewServeMux()
+	Handle(mux, "archive", func(ctx context.Context, p archive) error { return nil })
+	_, err := client.Enqueue(context.Background(), "archive", "not an object")
+	require.NoError(t, err)
+	_, err = client.Enqueue(context.Background(), "unknown", nil, MaxRetry(0))
+	require.NoError(t, err)
+
+	s := testServer(broker)
+	stop := runServer(t, s, mux)
+	assert.Eventually(t, func() bool { return s.Stats().Dead == 2 }, time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, int64(0), s.Stats().Retried)
+	dead, err := broker.Dead(context.Background(), DefaultQueue, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+}
+
+func TestPermanentErrors(t *testing.T) {
+	assert.True(t, permanent(errs.ErrArgs.WrapMsg("bad payload")))
+	assert.False(t, permanent(errs.ErrInternalServer.WrapMsg("db down")))
+	assert.True(t, permanent(errs.ErrConcurrentModification.Wrap()))
+	assert.False(t, permanent(errors.New("unclassified")))
+
+	broker := NewMemoryBroker(0)
+	mux := NewServeMux()
+	Handle(mux, "archive", func(ctx context.Context, p archive) error { return errs.ErrArgs.WrapMsg("invalid conversation") })
+	_, err := NewClient(broker).Enqueue(context.Background(), "archive", archive{ConversationID: "c"})
+	require.NoError(t, err)
+	s := testServer(broker)
+	stop := runServer(t, s, mux)
+	assert.Eventually(t, func() bool { return s.Stats().Dead == 1 }, time.Second, time.Millisecond)
+	stop()
+	assert.Equal(t, int64(0), s.Stats().Retried)
+}
+
+func TestMemoryBroker(t *testing.T) {
+	testBroker(t, NewMemoryBroker(2))
+}
+
+func TestRedisBroker(t *testing.T) {
+	testBroker(t, NewRedisBroker(containers.Redis(t), "JOB_TEST:", 2))
+}
+
+func testBroker(t *testing.T, broker Broker) {
+	ctx := context.Background()
+	client := NewClient(broker)
+	queue := "q" + time.Now().Format("150405.000000")
+
+	first, err := client.Enqueue(ctx, "archive", archive{ConversationID: "a"}, Queue(queue), Unique(time.Minute))
+	require.NoError(t, err)
+	_, err = client.Enqueue(ctx, "archive", archive{ConversationID: "a"}, Queue(queue), Unique(time.Minute))
+	assert.True(t, errors.Is(err, ErrDuplicate))
+	_, err = client.Enqueue(ctx, "archive", nil, Queue(queue), ID(first.ID))
+	assert.True(t, errors.Is(err, ErrIDConflict))
+	_, err = client.Enqueue(ctx, "archive", archive{ConversationID: "b"}, Queue(queue), ProcessIn(time.Hour))
+	require.NoError(t, err)
+
+	info, err := broker.Info(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), info.Pending)
+	assert.Equal(t, int64(1), info.Scheduled)
+
+	task, err := broker.Dequeue(ctx, queue, time.Minute, 0)
+	require.NoError(t, err)
+	require.NotNil(t, task)
+	assert.Equal(t, first.ID, task.ID)
+	none, err := broker.Dequeue(ctx, queue, time.Minute, 0)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	// Done releases the unique key.
+	require.NoError(t, broker.Done(ctx, task))
+	_, err = client.Enqueue(ctx, "archive", archive{ConversationID: "a"}, Queue(queue), Unique(time.Minute))
+	require.NoError(t, err)
+
+	// Retries become pending once due, expired leases right away.
+	task, err = broker.Dequeue(ctx, queue, time.Minute, 0)
+	require.NoError(t, err)
+	require.NoError(t, broker.Retry(ctx, task, time.Now().Add(-time.Second)))
+	n, err := broker.Forward(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	task, err = broker.Dequeue(ctx, queue, time.Nanosecond, 0)
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	n, err = broker.Forward(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	task, err = broker.Dequeue(ctx, queue, time.Minute, 0)
+	require.NoError(t, err)
+	require.NoError(t, broker.Done(ctx, task))
+
+	// Dead tasks are capped, listed latest first, requeued and deleted.
+	for i := 0; i < 3; i++ {
+		_, err = client.Enqueue(ctx, "fail", i, Queue(queue))
+		require.NoError(t, err)
+		task, err = broker.Dequeue(ctx, queue, time.Minute, 0)
+		require.NoError(t, err)
+		task.Retried = 4
+		require.NoError(t, broker.Kill(ctx, task))
+		time.Sleep(2 * time.Millisecond)
+	}
+	dead, err := broker.Dead(ctx, queue, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 2)
+	assert.Equal(t, task.ID, dead[0].ID)
+	require.NoError(t, broker.Requeue(ctx, queue, dead[0].ID))
+	require.NoError(t, broker.DeleteDead(ctx, queue, dead[1].ID))
+	err = broker.DeleteDead(ctx, queue, dead[1].ID)
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	info, err = broker.Info(ctx, queue)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), info.Dead)
+	assert.Equal(t, int64(1), info.Pending)
+	assert.Equal(t, int64(0), info.Active)
+}
@@ -0,0 +1,352 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// enqueueScript adds a task unless its id or unique key is taken.
+// KEYS[1] tasks hash, KEYS[2] pending list, KEYS[3] scheduled zset,
+// KEYS[4] unique lock; ARGV[1] id, ARGV[2] task JSON, ARGV[3] process at
+// in milliseconds or 0, ARGV[4] unique ttl in milliseconds or 0.
+var enqueueScript = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 1 then
+	return -1
+end
+if ARGV[4] ~= "0" and not redis.call("SET", KEYS[4], ARGV[1], "NX", "PX", ARGV[4]) then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+if ARGV[3] == "0" then
+	redis.call("LPUSH", KEYS[2], ARGV[1])
+else
+	redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+end
+return 1
+`)
+
+// dequeueScript leases the oldest pending task.
+// KEYS[1] pending list, KEYS[2] active zset, KEYS[3] tasks hash; ARGV[1] now
+// in milliseconds, ARGV[2] default timeout and ARGV[3] grace in milliseconds.
+var dequeueScript = redis.NewScript(`
+local id = redis.call("RPOP", KEYS[1])
+if not id then
+	return false
+end
+local data = redis.call("HGET", KEYS[3], id)
+if not data then
+	return false
+end
+local timeout = tonumber(ARGV[2])
+local ok, task = pcall(cjson.decode, data)
+if ok and type(task.timeout) == "number" and task.timeout > 0 then
+	timeout = math.floor(task.timeout / 1000000)
+end
+redis.call("ZADD", KEYS[2], tonumber(ARGV[1]) + timeout + tonumber(ARGV[3]), id)
+return data
+`)
+
+// forwardScript makes due scheduled and expired active tasks pending.
+// KEYS[1] scheduled zset, KEYS[2] active zset, KEYS[3] pending list;
+// ARGV[1] now in milliseconds.
+var forwardScript = redis.NewScript(`
+local n = 0
+for i = 1, 2 do
+	local ids = redis.call("ZRANGEBYSCORE", KEYS[i], "-inf", ARGV[1], "LIMIT", 0, 100)
+	for _, id in ipairs(ids) do
+		redis.call("ZREM", KEYS[i], id)
+		redis.call("LPUSH", KEYS[3], id)
+	end
+	n = n + #ids
+end
+return n
+`)
+
+// doneScript removes a task and releases its unique lock.
+// KEYS[1] tasks hash, KEYS[2] active zset, KEYS[3] unique lock; ARGV[1] id.
+var doneScript = redis.NewScript(`
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[1], ARGV[1])
+if redis.call("GET", KEYS[3]) == ARGV[1] then
+	redis.call("DEL", KEYS[3])
+end
+return 1
+`)
+
+// retryScript schedules a failed task.
+// KEYS[1] tasks hash, KEYS[2] active zset, KEYS[3] scheduled zset;
+// ARGV[1] id, ARGV[2] task JSON, ARGV[3] retry at in milliseconds.
+var retryScript = redis.NewScript(`
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+return 1
+`)
+
+// killScript moves a task to the dead set, dropping the oldest beyond max.
+// KEYS[1] tasks hash, KEYS[2] active zset, KEYS[3] dead zset, KEYS[4] unique
+// lock; ARGV[1] id, ARGV[2] task JSON, ARGV[3] now in milliseconds,
+// ARGV[4] max dead tasks.
+var killScript = redis.NewScript(`
+redis.call("ZREM", KEYS[2], ARGV[1])
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZADD", KEYS[3], ARGV[3], ARGV[1])
+if redis.call("GET", KEYS[4]) == ARGV[1] then
+	redis.call("DEL", KEYS[4])
+end
+local over = redis.call("ZCARD", KEYS[3]) - tonumber(ARGV[4])
+if over > 0 then
+	local ids = redis.call("ZRANGE", KEYS[3], 0, over - 1)
+	for _, id in ipairs(ids) do
+		redis.call("ZREM", KEYS[3], id)
+		redis.call("HDEL", KEYS[1], id)
+	end
+end
+return 1
+`)
+
+// requeueScript makes a dead task pending again.
+// KEYS[1] tasks hash, KEYS[2] dead zset, KEYS[3] pending list; ARGV[1] id,
+// ARGV[2] task JSON.
+var requeueScript = redis.NewScript(`
+if redis.call("ZREM", KEYS[2], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("LPUSH", KEYS[3], ARGV[1])
+return 1
+`)
+
+// NewRedisBroker returns a Broker keeping queues under keyPrefix, "JOB:"
+// when empty, with at most maxDead dead tasks per queue, 10000 when zero.
+// The keys of a queue share a hash tag, so queues work on Redis Cluster.
+func NewRedisBroker(rdb redis.UniversalClient, keyPrefix string, maxDead int) Broker {
+	if keyPrefix == "" {
+		keyPrefix = "JOB:"
+	}
+	if maxDead <= 0 {
+		maxDead = 10000
+	}
+	return &redisBroker{rdb: rdb, prefix: keyPrefix, maxDead: maxDead}
+}
+
+type redisBroker struct {
+	rdb     redis.UniversalClient
+	prefix  string
+	maxDead int
+}
+
+func (b *redisBroker) key(queue, name string) string {
+	return b.prefix + "{" + queue + "}:" + name
+}
+
+func (b *redisBroker) uniqueKey(task *Task) string {
+	return b.key(task.Queue, "unique:"+task.UniqueKey)
+}
+
+func (b *redisBroker) Enqueue(ctx context.Context, task *Task, processAt time.Time, uniqueTTL time.Duration) error {
+	data, err := jsonutil.Marshal(task)
+	if err != nil {
+		return errs.WrapMsg(err, "encode job failed", "id", task.ID)
+	}
+	var at, ttl int64
+	if processAt.After(time.Now()) {
+		at = processAt.UnixMilli()
+	}
+	if task.UniqueKey != "" {
+		ttl = max(1, uniqueTTL.Milliseconds())
+	}
+	q := task.Queue
+	res, err := enqueueScript.Run(ctx, b.rdb,
+		[]string{b.key(q, "tasks"), b.key(q, "pending"), b.key(q, "scheduled"), b.uniqueKey(task)},
+		task.ID, data, at, ttl).Int()
+	if err != nil {
+		return errs.WrapMsg(err, "enqueue job failed", "id", task.ID, "type", task.Type)
+	}
+	switch res {
+	case -1:
+		return ErrIDConflict.WrapMsg("job id is in use", "id", task.ID)
+	case 0:
+		return ErrDuplicate.WrapMsg("duplicate job", "type", task.Type)
+	}
+	return nil
+}
+
+func (b *redisBroker) Dequeue(ctx context.Context, queue string, timeout, grace time.Duration) (*Task, error) {
+	data, err := dequeueScript.Run(ctx, b.rdb,
+		[]string{b.key(queue, "pending"), b.key(queue, "active"), b.key(queue, "tasks")},
+		time.Now().UnixMilli(), timeout.Milliseconds(), grace.Milliseconds()).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, errs.WrapMsg(err, "dequeue job failed", "queue", queue)
+	}
+	var task Task
+	if err := jsonutil.Unmarshal([]byte(data), &task); err != nil {
+		return nil, errs.WrapMsg(err, "decode job failed", "queue", queue)
+	}
+	return &task, nil
+}
+
+func (b *redisBroker) Forward(ctx context.Context, queue string) (int, error) {
+	n, err := forwardScript.Run(ctx, b.rdb,
+		[]string{b.key(queue, "scheduled"), b.key(queue, "active"), b.key(queue, "pending")},
+		time.Now().UnixMilli()).Int()
+	if err != nil {
+		return 0, errs.WrapMsg(err, "forward jobs failed", "queue", queue)
+	}
+	return n, nil
+}
+
+func (b *redisBroker) Done(ctx context.Context, task *Task) error {
+	q := task.Queue
+	err := doneScript.Run(ctx, b.rdb, []string{b.key(q, "tasks"), b.key(q, "active"), b.uniqueKey(task)}, task.ID).Err()
+	if err != nil {
+		return errs.WrapMsg(err, "complete job failed", "id", task.ID)
+	}
+	return nil
+}
+
+func (b *redisBroker) Retry(ctx context.Context, task *Task, at time.Time) error {
+	data, err := jsonutil.Marshal(task)
+	if err != nil {
+		return errs.WrapMsg(err, "encode job failed", "id", task.ID)
+	}
+	q := task.Queue
+	err = retryScript.Run(ctx, b.rdb, []string{b.key(q, "tasks"), b.key(q, "active"), b.key(q, "scheduled")},
+		task.ID, data, at.UnixMilli()).Err()
+	if err != nil {
+		return errs.WrapMsg(err, "retry job failed", "id", task.ID)
+	}
+	return nil
+}
+
+func (b *redisBroker) Kill(ctx context.Context, task *Task) error {
+	data, err := jsonutil.Marshal(task)
+	if err != nil {
+		return errs.WrapMsg(err, "encode job failed", "id", task.ID)
+	}
+	q := task.Queue
+	err = killScript.Run(ctx, b.rdb,
+		[]string{b.key(q, "tasks"), b.key(q, "active"), b.key(q, "dead"), b.uniqueKey(task)},
+		task.ID, data, time.Now().UnixMilli(), b.maxDead).Err()
+	if err != nil {
+		return errs.WrapMsg(err, "kill job failed", "id", task.ID)
+	}
+	return nil
+}
+
+func (b *redisBroker) Info(ctx context.Context, queue string) (*QueueInfo, error) {
+	pipe := b.rdb.Pipeline()
+	pending := pipe.LLen(ctx, b.key(queue, "pending"))
+	scheduled := pipe.ZCard(ctx, b.key(queue, "scheduled"))
+	active := pipe.ZCard(ctx, b.key(queue, "active"))
+	dead := pipe.ZCard(ctx, b.key(queue, "dead"))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, errs.WrapMsg(err, "get queue info failed", "queue", queue)
+	}
+	return &QueueInfo{
+		Queue:     queue,
+		Pending:   pending.Val(),
+		Scheduled: scheduled.Val(),
+		Active:    active.Val(),
+		Dead:      dead.Val(),
+	}, nil
+}
+
+func (b *redisBroker) Dead(ctx context.Context, queue string, offset, limit int) ([]*Task, error) {
+	ids, err := b.rdb.ZRevRange(ctx, b.key(queue, "dead"), int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "list dead jobs failed", "queue", queue)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	values, err := b.rdb.HMGet(ctx, b.key(queue, "tasks"), ids...).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "list dead jobs failed", "queue", queue)
+	}
+	tasks := make([]*Task, 0, len(values))
+	for _, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var task Task
+		if err := jsonutil.Unmarshal([]byte(data), &task); err != nil {
+			return nil, errs.WrapMsg(err, "decode job failed", "queue", queue)
+		}
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (b *redisBroker) load(ctx context.Context, queue, id string) (*Task, error) {
+	data, err := b.rdb.HGet(ctx, b.key(queue, "tasks"), id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errs.ErrRecordNotFound.WrapMsg("job not found", "queue", queue, "id", id)
+		}
+		return nil, errs.WrapMsg(err, "load job failed", "queue", queue, "id", id)
+	}
+	var task Task
+	if err := jsonutil.Unmarshal(data, &task); err != nil {
+		return nil, errs.WrapMsg(err, "decode job failed", "queue", queue, "id", id)
+	}
+	return &task, nil
+}
+
+func (b *redisBroker) Requeue(ctx context.Context, queue, id string) error {
+	task, err := b.load(ctx, queue, id)
+	if err != nil {
+		return err
+	}
+	task.Retried = 0
+	data, err := jsonutil.Marshal(task)
+	if err != nil {
+		return errs.WrapMsg(err, "encode job failed", "id", id)
+	}
+	res, err := requeueScript.Run(ctx, b.rdb,
+		[]string{b.key(queue, "tasks"), b.key(queue, "dead"), b.key(queue, "pending")}, id, data).Int()
+	if err != nil {
+		return errs.WrapMsg(err, "requeue job failed", "queue", queue, "id", id)
+	}
+	if res == 0 {
+		return errs.ErrRecordNotFound.WrapMsg("dead job not found", "queue", queue, "id", id)
+	}
+	return nil
+}
+
+func (b *redisBroker) DeleteDead(ctx context.Context, queue, id string) error {
+	removed, err := b.rdb.ZRem(ctx, b.key(queue, "dead"), id).Result()
+	if err != nil {
+		return errs.WrapMsg(err, "delete dead job failed", "queue", queue, "id", id)
+	}
+	if removed == 0 {
+		return errs.ErrRecordNotFound.WrapMsg("dead job not found", "queue", queue, "id", id)
+	}
+	if err := b.rdb.HDel(ctx, b.key(queue, "tasks"), id).Err(); err != nil {
+		return errs.WrapMsg(err, "delete dead job failed", "queue", queue, "id", id)
+	}
+	return nil
+}
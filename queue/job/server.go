@@ -0,0 +1,308 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package job
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/utils/randutil"
+	"google.golang.org/grpc/status"
+)
+
+// Handler processes jobs. A returned error retries the job, unless it wraps
+// ErrSkipRetry, carries an errs code or gRPC status that errs.RetryClassOf
+// classifies as Permanent, e.g. errs.ErrArgs, or the job ran out of retries,
+// which makes it dead.
+type Handler interface {
+	ProcessTask(ctx context.Context, task *Task) error
+}
+
+type HandlerFunc func(ctx context.Context, task *Task) error
+
+func (f HandlerFunc) ProcessTask(ctx context.Context, task *Task) error {
+	return f(ctx, task)
+}
+
+// Middleware wraps the handler of every job, e.g. for logging or tracing.
+type Middleware func(Handler) Handler
+
+// ServeMux dispatches jobs to handlers by type.
+type ServeMux struct {
+	handlers    map[string]Handler
+	middlewares []Middleware
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{handlers: make(map[string]Handler)}
+}
+
+// Use appends middlewares, the first being the outermost. They apply to
+// handlers registered later.
+func (m *ServeMux) Use(mws ...Middleware) {
+	m.middlewares = append(m.middlewares, mws...)
+}
+
+func (m *ServeMux) Handle(typ string, h Handler) {
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		h = m.middlewares[i](h)
+	}
+	m.handlers[typ] = h
+}
+
+func (m *ServeMux) HandleFunc(typ string, fn func(ctx context.Context, task *Task) error) {
+	m.Handle(typ, HandlerFunc(fn))
+}
+
+func (m *ServeMux) ProcessTask(ctx context.Context, task *Task) error {
+	h, ok := m.handlers[task.Type]
+	if !ok {
+		return ErrNoHandler.WrapMsg("no handler", "type", task.Type)
+	}
+	return h.ProcessTask(ctx, task)
+}
+
+// Handle registers fn for jobs of the type with a payload of type T.
+// Payloads that do not decode make the job dead.
+func Handle[T any](mux *ServeMux, typ string, fn func(ctx context.Context, payload T) error) {
+	mux.HandleFunc(typ, func(ctx context.Context, task *Task) error {
+		var payload T
+		if err := task.Decode(&payload); err != nil {
+			return err
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// Config configures a Server.
+type Config struct {
+	// Queues are polled in order, so earlier queues have strict priority.
+	// Defaults to DefaultQueue.
+	Queues []string
+	// Concurrency is the number of workers, defaults to 10.
+	Concurrency int
+	// PollInterval is how long idle workers wait before polling again and
+	// how often scheduled jobs are made pending, defaults to 1 second.
+	PollInterval time.Duration
+	// Timeout bounds a run of jobs without their own, defaults to 30 minutes.
+	Timeout time.Duration
+	// LeaseGrace is added to the timeout of a job to lease it. A job whose
+	// lease expired runs again. Defaults to 1 minute.
+	LeaseGrace time.Duration
+	// RetryDelay returns the delay before the retried-th retry, defaults to
+	// exponential backoff from 1 second up to 1 hour with jitter.
+	RetryDelay func(retried int, err error) time.Duration
+}
+
+// DefaultRetryDelay doubles the delay with every retry from 1 second up to
+// 1 hour, with 20% jitter.
+func DefaultRetryDelay(retried int, _ error) time.Duration {
+	d := time.Hour
+	if retried < 12 {
+		d = min(d, time.Second<<retried)
+	}
+	return randutil.Jitter(d, 0.2)
+}
+
+// Stats counts the jobs processed by a Server.
+type Stats struct {
+	Active    int64 `json:"active"`
+	Processed int64 `json:"processed"`
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+	Retried   int64 `json:"retried"`
+	Dead      int64 `json:"dead"`
+}
+
+// Server processes queued jobs.
+type Server struct {
+	broker Broker
+	conf   Config
+
+	active    atomic.Int64
+	processed atomic.Int64
+	succeeded atomic.Int64
+	failed    atomic.Int64
+	retried   atomic.Int64
+	dead      atomic.Int64
+}
+
+func NewServer(broker Broker, conf Config) *Server {
+	if len(conf.Queues) == 0 {
+		conf.Queues = []string{DefaultQueue}
+	}
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = 10
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 30 * time.Minute
+	}
+	if conf.LeaseGrace <= 0 {
+		conf.LeaseGrace = time.Minute
+	}
+	if conf.RetryDelay == nil {
+		conf.RetryDelay = DefaultRetryDelay
+	}
+	return &Server{broker: broker, conf: conf}
+}
+
+// Run processes jobs with h until ctx is done, then waits for the running
+// jobs to finish.
+func (s *Server) Run(ctx context.Context, h Handler) error {
+	var wg sync.WaitGroup
+	wg.Add(s.conf.Concurrency + 1)
+	go func() {
+		defer wg.Done()
+		s.forward(ctx)
+	}()
+	for i := 0; i < s.conf.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			s.work(ctx, h)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// forward makes due jobs pending every PollInterval.
+func (s *Server) forward(ctx context.Context) {
+	ticker := time.NewTicker(s.conf.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, queue := range s.conf.Queues {
+			if _, err := s.broker.Forward(ctx, queue); err != nil && ctx.Err() == nil {
+				log.ZWarn(ctx, "forward jobs failed", err, "queue", queue)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) work(ctx context.Context, h Handler) {
+	for ctx.Err() == nil {
+		task, err := s.dequeue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.ZWarn(ctx, "dequeue job failed", err)
+		}
+		if task == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.conf.PollInterval):
+			}
+			continue
+		}
+		s.process(ctx, h, task)
+	}
+}
+
+func (s *Server) dequeue(ctx context.Context) (*Task, error) {
+	for _, queue := range s.conf.Queues {
+		task, err := s.broker.Dequeue(ctx, queue, s.conf.Timeout, s.conf.LeaseGrace)
+		if task != nil || err != nil {
+			return task, err
+		}
+	}
+	return nil, nil
+}
+
+// process runs a job and records its outcome. Running jobs are not canceled
+// with ctx, only bounded by their timeout.
+func (s *Server) process(ctx context.Context, h Handler, task *Task) {
+	s.active.Add(1)
+	defer s.active.Add(-1)
+	timeout := task.Timeout
+	if timeout <= 0 {
+		timeout = s.conf.Timeout
+	}
+	ctx = context.WithoutCancel(ctx)
+	if task.OperationID != "" {
+		ctx = mcontext.SetOperationID(ctx, task.OperationID)
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeout)
+	err := call(runCtx, h, task)
+	cancel()
+	s.processed.Add(1)
+	if err == nil {
+		s.succeeded.Add(1)
+		if err := s.broker.Done(ctx, task); err != nil {
+			log.ZWarn(ctx, "complete job failed", err, "id", task.ID, "type", task.Type)
+		}
+		return
+	}
+	s.failed.Add(1)
+	task.LastError = err.Error()
+	task.FailedAt = time.Now()
+	if errors.Is(err, ErrSkipRetry) || permanent(err) || task.Retried >= task.MaxRetry {
+		s.dead.Add(1)
+		log.ZError(ctx, "job is dead", err, "id", task.ID, "type", task.Type, "retried", task.Retried)
+		if err := s.broker.Kill(ctx, task); err != nil {
+			log.ZWarn(ctx, "kill job failed", err, "id", task.ID, "type", task.Type)
+		}
+		return
+	}
+	delay := s.conf.RetryDelay(task.Retried, err)
+	task.Retried++
+	s.retried.Add(1)
+	log.ZWarn(ctx, "job failed, retrying", err, "id", task.ID, "type", task.Type, "retried", task.Retried, "delay", delay)
+	if err := s.broker.Retry(ctx, task, task.FailedAt.Add(delay)); err != nil {
+		log.ZWarn(ctx, "retry job failed", err, "id", task.ID, "type", task.Type)
+	}
+}
+
+// permanent reports whether err is classified as failing again on every
+// retry. Errors without a code are not classified and are retried.
+func permanent(err error) bool {
+	var codeErr errs.CodeError
+	_, isStatus := status.FromError(errs.Unwrap(err))
+	if !errors.As(err, &codeErr) && !isStatus {
+		return false
+	}
+	return errs.RetryClassOf(err) == errs.Permanent
+}
+
+func call(ctx context.Context, h Handler, task *Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errs.ErrPanic(r)
+		}
+	}()
+	return h.ProcessTask(ctx, task)
+}
+
+// Stats returns the jobs processed since the server was created.
+func (s *Server) Stats() Stats {
+	return Stats{
+		Active:    s.active.Load(),
+		Processed: s.processed.Load(),
+		Succeeded: s.succeeded.Load(),
+		Failed:    s.failed.Load(),
+		Retried:   s.retried.Load(),
+		Dead:      s.dead.Load(),
+	}
+}
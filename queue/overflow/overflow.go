@@ -0,0 +1,256 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package overflow provides a FIFO queue with a bounded in-memory head that
+// spills to disk segments once the head is full, so bursts such as push
+// notification fan-out are absorbed without dropping items or exhausting
+// memory. Spilled items survive a restart and are delivered by the next queue
+// opened on the same directory; items held in memory are not.
+package overflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/wal"
+)
+
+var (
+	ErrQueueFull = errs.New("overflow queue is full")
+	ErrClosed    = errs.New("overflow queue is closed")
+)
+
+// Config configures a Queue.
+type Config struct {
+	Dir         string // Directory of the disk segments.
+	MemoryItems int    // Items kept in memory, defaults to 1024.
+	// MaxDiskItems bounds the spilled items; zero is unbounded.
+	MaxDiskItems int64
+	SegmentSize  int64 // Size of a disk segment, defaults to 16 MiB.
+}
+
+// Stats reports the state of a Queue.
+type Stats struct {
+	Memory  int   // Items in memory.
+	Disk    int64 // Items on disk.
+	Spilled int64 // Items written to disk since the queue was opened.
+}
+
+// Queue is a concurrency safe FIFO queue of JSON serializable items.
+type Queue[T any] struct {
+	conf Config
+	log  *wal.WAL
+
+	mu      sync.Mutex
+	head    []T
+	it      *wal.Iterator
+	read    uint64 // Index of the next record to read from disk.
+	disk    int64
+	spilled int64
+	closed  bool
+	notify  chan struct{}
+	done    chan struct{}
+}
+
+// New opens a Queue on conf.Dir. Items left on disk by an earlier queue are
+// delivered first.
+func New[T any](conf Config) (*Queue[T], error) {
+	if conf.MemoryItems <= 0 {
+		conf.MemoryItems = 1024
+	}
+	if conf.SegmentSize <= 0 {
+		conf.SegmentSize = 16 << 20
+	}
+	log, err := wal.Open(wal.Config{Dir: conf.Dir, SegmentSize: conf.SegmentSize, Sync: wal.SyncNever})
+	if err != nil {
+		return nil, err
+	}
+	q := &Queue[T]{
+		conf:   conf,
+		log:    log,
+		read:   log.FirstIndex(),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	q.disk = int64(log.LastIndex() + 1 - q.read)
+	return q, nil
+}
+
+// Push appends an item. It goes to memory while the head has room and
+// nothing is spilled, otherwise to disk.
+func (q *Queue[T]) Push(item T) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed.Wrap()
+	}
+	if q.disk == 0 && len(q.head) < q.conf.MemoryItems {
+		q.head = append(q.head, item)
+		q.mu.Unlock()
+		q.signal()
+		return nil
+	}
+	if q.conf.MaxDiskItems > 0 && q.disk >= q.conf.MaxDiskItems {
+		q.mu.Unlock()
+		return ErrQueueFull.WrapMsg("overflow queue disk is full", "max", q.conf.MaxDiskItems)
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		q.mu.Unlock()
+		return errs.WrapMsg(err, "marshal overflow item failed")
+	}
+	if _, err := q.log.Write(data); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	q.disk++
+	q.spilled++
+	q.mu.Unlock()
+	q.signal()
+	return nil
+}
+
+func (q *Queue[T]) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// refill moves up to MemoryItems spilled items into the empty head and frees
+// the disk segments read completely. Called with mu held.
+func (q *Queue[T]) refill() error {
+	if q.it == nil {
+		it, err := q.log.Iterator(q.read)
+		if err != nil {
+			return err
+		}
+		q.it = it
+	}
+	for q.disk > 0 && len(q.head) < q.conf.MemoryItems {
+		index, data, err := q.it.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		q.read = index + 1
+		q.disk--
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			return errs.WrapMsg(err, "unmarshal overflow item failed", "index", index)
+		}
+		q.head = append(q.head, item)
+	}
+	return q.log.TruncateFront(q.read)
+}
+
+// take pops the oldest item. Called with mu held.
+func (q *Queue[T]) take() (T, bool, error) {
+	var zero T
+	if len(q.head) == 0 && q.disk > 0 && !q.closed {
+		if err := q.refill(); err != nil {
+			return zero, false, err
+		}
+	}
+	if len(q.head) == 0 {
+		return zero, false, nil
+	}
+	item := q.head[0]
+	q.head[0] = zero
+	q.head = q.head[1:]
+	return item, true, nil
+}
+
+func (q *Queue[T]) more() bool {
+	return len(q.head) > 0 || (q.disk > 0 && !q.closed)
+}
+
+// TryPop returns the oldest item, or false when the queue is empty.
+func (q *Queue[T]) TryPop() (T, bool, error) {
+	q.mu.Lock()
+	item, ok, err := q.take()
+	more := q.more()
+	q.mu.Unlock()
+	if ok && more {
+		q.signal()
+	}
+	return item, ok, err
+}
+
+// Pop waits for the oldest item. Once the queue is closed it returns the
+// items left in memory and then ErrClosed.
+func (q *Queue[T]) Pop(ctx context.Context) (T, error) {
+	var zero T
+	for {
+		q.mu.Lock()
+		item, ok, err := q.take()
+		more, closed := q.more(), q.closed
+		q.mu.Unlock()
+		if err != nil {
+			return zero, err
+		}
+		if ok {
+			if more {
+				// Wake another consumer for the remaining items.
+				q.signal()
+			}
+			return item, nil
+		}
+		if closed {
+			return zero, ErrClosed.Wrap()
+		}
+		select {
+		case <-ctx.Done():
+			return zero, errs.Wrap(ctx.Err())
+		case <-q.notify:
+		case <-q.done:
+		}
+	}
+}
+
+// Len returns the number of queued items.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.head) + int(q.disk)
+}
+
+// Stats returns the state of the queue.
+func (q *Queue[T]) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return Stats{Memory: len(q.head), Disk: q.disk, Spilled: q.spilled}
+}
+
+// Close rejects further pushes and closes the disk segments. Spilled items
+// stay on disk for the next queue opened on the directory.
+func (q *Queue[T]) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	close(q.done)
+	if q.it != nil {
+		q.it.Close()
+	}
+	return q.log.Close()
+}
@@ -0,0 +1,107 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overflow
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpillFIFO(t *testing.T) {
+	q, err := New[int](Config{Dir: t.TempDir(), MemoryItems: 4, SegmentSize: 64})
+	require.NoError(t, err)
+	defer q.Close()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, q.Push(i))
+	}
+	assert.Equal(t, Stats{Memory: 4, Disk: 16, Spilled: 16}, q.Stats())
+	for i := 0; i < 10; i++ {
+		item, ok, err := q.TryPop()
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, i, item)
+	}
+	for i := 20; i < 25; i++ {
+		require.NoError(t, q.Push(i))
+	}
+	for i := 10; i < 25; i++ {
+		item, err := q.Pop(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, i, item)
+	}
+	_, ok, err := q.TryPop()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestRestart(t *testing.T) {
+	dir := t.TempDir()
+	q, err := New[string](Config{Dir: dir, MemoryItems: 1})
+	require.NoError(t, err)
+	for _, s := range []string{"a", "b", "c"} {
+		require.NoError(t, q.Push(s))
+	}
+	require.NoError(t, q.Close())
+	assert.True(t, errors.Is(q.Push("d"), ErrClosed))
+
+	q, err = New[string](Config{Dir: dir, MemoryItems: 1})
+	require.NoError(t, err)
+	defer q.Close()
+	assert.Equal(t, 2, q.Len())
+	for _, want := range []string{"b", "c"} {
+		item, err := q.Pop(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, want, item)
+	}
+}
+
+func TestDiskFull(t *testing.T) {
+	q, err := New[int](Config{Dir: t.TempDir(), MemoryItems: 1, MaxDiskItems: 1})
+	require.NoError(t, err)
+	defer q.Close()
+	require.NoError(t, q.Push(1))
+	require.NoError(t, q.Push(2))
+	assert.True(t, errors.Is(q.Push(3), ErrQueueFull))
+}
+
+func TestConcurrent(t *testing.T) {
+	q, err := New[int](Config{Dir: t.TempDir(), MemoryItems: 8, SegmentSize: 256})
+	require.NoError(t, err)
+	defer q.Close()
+	const n = 500
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < n; i++ {
+			assert.NoError(t, q.Push(i))
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		item, err := q.Pop(ctx)
+		require.NoError(t, err)
+		require.Equal(t, i, item)
+	}
+	wg.Wait()
+}
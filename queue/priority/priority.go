@@ -0,0 +1,277 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package priority provides a multi-level priority queue. Level 0 is served
+// first; tasks waiting longer than the aging interval move up one level at a
+// time, so low priority work is delayed but never starved, e.g. offline push
+// fan-out behind online ACKs.
+package priority
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+)
+
+var (
+	ErrQueueFull = errs.New("priority queue is full")
+	ErrClosed    = errs.New("priority queue is closed")
+)
+
+// Config configures a Queue.
+type Config struct {
+	// Levels is the number of priority classes, defaults to one per
+	// mcontext priority so PushContext keeps them apart.
+	Levels int
+	// Capacity bounds the tasks of every level; zero is unbounded.
+	Capacity int
+	// Aging is how long a task waits in a level before it moves up one.
+	// Zero disables aging.
+	Aging time.Duration
+}
+
+type entry[T any] struct {
+	item     T
+	priority int       // Priority the task was pushed with.
+	pushed   time.Time // When the task was pushed.
+	since    time.Time // When the task entered its current level.
+}
+
+type level[T any] struct {
+	entries []entry[T]
+	stats   LevelStats
+}
+
+// LevelStats reports the activity of a priority class.
+type LevelStats struct {
+	Priority int
+	Len      int   // Tasks currently waiting in the level.
+	Pushed   int64 // Tasks pushed with this priority.
+	Rejected int64 // Pushes refused because the level was full.
+	Promoted int64 // Tasks that aged out of this level into the next higher one.
+	Popped   int64 // Tasks popped from this level.
+	// WaitTotal is the summed wait of the tasks popped from this level,
+	// measured from their push.
+	WaitTotal time.Duration
+	MaxWait   time.Duration
+}
+
+// AvgWait returns the mean wait of the popped tasks.
+func (s *LevelStats) AvgWait() time.Duration {
+	if s.Popped == 0 {
+		return 0
+	}
+	return s.WaitTotal / time.Duration(s.Popped)
+}
+
+// Queue is a concurrency safe multi-level priority queue.
+type Queue[T any] struct {
+	conf   Config
+	now    func() time.Time
+	mu     sync.Mutex
+	levels []level[T]
+	size   int
+	closed bool
+	notify chan struct{}
+	done   chan struct{}
+}
+
+// New creates a Queue.
+func New[T any](conf Config) *Queue[T] {
+	if conf.Levels <= 0 {
+		conf.Levels = mcontext.PriorityBulk + 1
+	}
+	q := &Queue[T]{
+		conf:   conf,
+		now:    time.Now,
+		levels: make([]level[T], conf.Levels),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	for i := range q.levels {
+		q.levels[i].stats.Priority = i
+	}
+	return q
+}
+
+// Push adds a task with a priority, which is clamped to the configured levels.
+func (q *Queue[T]) Push(item T, priority int) error {
+	if priority < 0 {
+		priority = 0
+	} else if priority >= len(q.levels) {
+		priority = len(q.levels) - 1
+	}
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrClosed
+	}
+	l := &q.levels[priority]
+	if q.conf.Capacity > 0 && len(l.entries) >= q.conf.Capacity {
+		l.stats.Rejected++
+		q.mu.Unlock()
+		return ErrQueueFull.WrapMsg("priority level is full", "priority", priority, "capacity", q.conf.Capacity)
+	}
+	now := q.now()
+	// Age waiting tasks first so they stay ahead of the new one.
+	q.promote(now)
+	l.entries = append(l.entries, entry[T]{item: item, priority: priority, pushed: now, since: now})
+	l.stats.Pushed++
+	q.size++
+	q.mu.Unlock()
+	q.signal()
+	return nil
+}
+
+// PushContext adds a task with the request priority of ctx, see
+// mcontext.GetPriority.
+func (q *Queue[T]) PushContext(ctx context.Context, item T) error {
+	return q.Push(item, mcontext.GetPriority(ctx))
+}
+
+func (q *Queue[T]) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// promote moves tasks that waited longer than the aging interval up one
+// level. Levels are FIFO by the time tasks entered them, so only the heads
+// need to be checked. Called with mu held.
+func (q *Queue[T]) promote(now time.Time) {
+	if q.conf.Aging <= 0 {
+		return
+	}
+	for i := 1; i < len(q.levels); i++ {
+		l := &q.levels[i]
+		var n int
+		for n < len(l.entries) && now.Sub(l.entries[n].since) >= q.conf.Aging {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		up := &q.levels[i-1]
+		for _, e := range l.entries[:n] {
+			e.since = now
+			up.entries = append(up.entries, e)
+		}
+		clear(l.entries[:n])
+		l.entries = l.entries[n:]
+		l.stats.Promoted += int64(n)
+	}
+}
+
+// take pops the head of the highest non-empty level. Called with mu held.
+func (q *Queue[T]) take() (T, int, bool) {
+	now := q.now()
+	q.promote(now)
+	for i := range q.levels {
+		l := &q.levels[i]
+		if len(l.entries) == 0 {
+			continue
+		}
+		e := l.entries[0]
+		var zero entry[T]
+		l.entries[0] = zero
+		l.entries = l.entries[1:]
+		q.size--
+		wait := now.Sub(e.pushed)
+		l.stats.Popped++
+		l.stats.WaitTotal += wait
+		if wait > l.stats.MaxWait {
+			l.stats.MaxWait = wait
+		}
+		return e.item, e.priority, true
+	}
+	var zero T
+	return zero, 0, false
+}
+
+// TryPop returns the next task and the priority it was pushed with, or false
+// when the queue is empty.
+func (q *Queue[T]) TryPop() (T, int, bool) {
+	q.mu.Lock()
+	item, priority, ok := q.take()
+	more := q.size > 0
+	q.mu.Unlock()
+	if ok && more {
+		q.signal()
+	}
+	return item, priority, ok
+}
+
+// Pop waits for the next task and returns it with the priority it was pushed
+// with. It returns ErrClosed once the queue is closed and drained.
+func (q *Queue[T]) Pop(ctx context.Context) (T, int, error) {
+	for {
+		q.mu.Lock()
+		item, priority, ok := q.take()
+		more, closed := q.size > 0, q.closed
+		q.mu.Unlock()
+		if ok {
+			if more {
+				// Wake another consumer for the remaining tasks.
+				q.signal()
+			}
+			return item, priority, nil
+		}
+		if closed {
+			var zero T
+			return zero, 0, ErrClosed
+		}
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, 0, errs.Wrap(ctx.Err())
+		case <-q.notify:
+		case <-q.done:
+		}
+	}
+}
+
+// Len returns the number of waiting tasks.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
+
+// Close rejects further pushes. Pop keeps returning the remaining tasks and
+// then ErrClosed.
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
+
+// Stats returns the statistics of every priority class, highest first.
+func (q *Queue[T]) Stats() []LevelStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.promote(q.now())
+	stats := make([]LevelStats, len(q.levels))
+	for i := range q.levels {
+		stats[i] = q.levels[i].stats
+		stats[i].Len = len(q.levels[i].entries)
+	}
+	return stats
+}
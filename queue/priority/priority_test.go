@@ -0,0 +1,159 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package priority
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestQueue(conf Config) (*Queue[string], *clock) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	q := New[string](conf)
+	q.now = c.Now
+	return q, c
+}
+
+func popAll(q *Queue[string]) []string {
+	var items []string
+	for {
+		item, _, ok := q.TryPop()
+		if !ok {
+			return items
+		}
+		items = append(items, item)
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	q, _ := newTestQueue(Config{})
+	require.NoError(t, q.Push("offline-1", 2))
+	require.NoError(t, q.Push("ack-1", 0))
+	require.NoError(t, q.Push("normal-1", 1))
+	require.NoError(t, q.Push("ack-2", -5))
+	require.NoError(t, q.Push("offline-2", 9))
+	assert.Equal(t, 5, q.Len())
+	assert.Equal(t, []string{"ack-1", "ack-2", "normal-1", "offline-1", "offline-2"}, popAll(q))
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestPushContext(t *testing.T) {
+	q, _ := newTestQueue(Config{})
+	ctx := context.Background()
+	require.NoError(t, q.PushContext(mcontext.SetPriority(ctx, mcontext.PriorityBulk), "import"))
+	require.NoError(t, q.PushContext(ctx, "default"))
+	require.NoError(t, q.PushContext(mcontext.SetPriority(ctx, mcontext.PrioritySystem), "system"))
+	assert.Equal(t, []string{"system", "default", "import"}, popAll(q))
+}
+
+func TestAging(t *testing.T) {
+	q, c := newTestQueue(Config{Levels: 3, Aging: time.Second})
+	require.NoError(t, q.Push("offline", 2))
+	c.Add(1500 * time.Millisecond)
+	require.NoError(t, q.Push("normal", 1))
+	require.NoError(t, q.Push("ack", 0))
+
+	// offline aged into level 1 ahead of normal, which is younger.
+	item, priority, ok := q.TryPop()
+	require.True(t, ok)
+	assert.Equal(t, "ack", item)
+	assert.Equal(t, 0, priority)
+
+	c.Add(time.Second)
+	// Both aged into level 0 now, offline first.
+	require.NoError(t, q.Push("ack-late", 0))
+	item, priority, ok = q.TryPop()
+	require.True(t, ok)
+	assert.Equal(t, "offline", item)
+	assert.Equal(t, 2, priority)
+	assert.Equal(t, []string{"normal", "ack-late"}, popAll(q))
+
+	stats := q.Stats()
+	require.Len(t, stats, 3)
+	assert.Equal(t, int64(1), stats[2].Pushed)
+	assert.Equal(t, int64(1), stats[2].Promoted)
+	assert.Equal(t, int64(2), stats[1].Promoted)
+	assert.Equal(t, int64(4), stats[0].Popped)
+	assert.Equal(t, 2500*time.Millisecond, stats[0].MaxWait)
+}
+
+func TestCapacity(t *testing.T) {
+	q, _ := newTestQueue(Config{Levels: 2, Capacity: 1})
+	require.NoError(t, q.Push("a", 0))
+	assert.ErrorIs(t, q.Push("b", 0), ErrQueueFull)
+	require.NoError(t, q.Push("c", 1))
+	assert.Equal(t, int64(1), q.Stats()[0].Rejected)
+}
+
+func TestPopBlocks(t *testing.T) {
+	q := New[int](Config{})
+	const n = 100
+	var wg sync.WaitGroup
+	results := make(chan int, n)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				item, _, err := q.Pop(context.Background())
+				if err != nil {
+					assert.ErrorIs(t, err, ErrClosed)
+					return
+				}
+				results <- item
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		require.NoError(t, q.Push(i, i%3))
+	}
+	q.Close()
+	assert.ErrorIs(t, q.Push(0, 0), ErrClosed)
+	wg.Wait()
+	close(results)
+	seen := make(map[int]bool)
+	for item := range results {
+		seen[item] = true
+	}
+	assert.Len(t, seen, n)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := New[int](Config{}).Pop(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,93 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/mcontext"
+	"google.golang.org/grpc"
+)
+
+// Rule consumes a limit for each call of a gRPC method or HTTP path.
+type Rule struct {
+	Limit string
+	// Subject returns who is charged, defaults to DefaultSubject. Calls
+	// with an empty subject are not charged.
+	Subject func(ctx context.Context, req any) string
+	// Cost returns the amount consumed, defaults to 1.
+	Cost func(req any) int64
+}
+
+// DefaultSubject charges the tenant of the request when there is one and
+// the operating user otherwise.
+func DefaultSubject(ctx context.Context, req any) string {
+	if id := mcontext.GetTenantID(ctx); id != "" {
+		return "tenant:" + id
+	}
+	if id := mcontext.GetOpUserID(ctx); id != "" {
+		return "user:" + id
+	}
+	return ""
+}
+
+func (m *Manager) apply(ctx context.Context, rule Rule, req any) error {
+	subject := DefaultSubject
+	if rule.Subject != nil {
+		subject = rule.Subject
+	}
+	s := subject(ctx, req)
+	if s == "" {
+		return nil
+	}
+	n := int64(1)
+	if rule.Cost != nil {
+		n = rule.Cost(req)
+	}
+	_, err := m.Consume(ctx, s, rule.Limit, n)
+	return err
+}
+
+// UnaryServerInterceptor consumes the rule of each called method, keyed by
+// full method name, and rejects calls over quota with ErrQuotaExceeded.
+// Chain it after RpcServerInterceptor so the context carries the caller and
+// errors are converted to status codes.
+func (m *Manager) UnaryServerInterceptor(rules map[string]Rule) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if rule, ok := rules[info.FullMethod]; ok {
+			if err := m.apply(ctx, rule, req); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Gin consumes the rule of each requested path. Rules see the gin context
+// and a nil request, as the body is not decoded yet.
+func (m *Manager) Gin(rules map[string]Rule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rule, ok := rules[c.Request.URL.Path]; ok {
+			if err := m.apply(c, rule, nil); err != nil {
+				apiresp.GinError(c, err)
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
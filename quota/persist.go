@@ -0,0 +1,91 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Record is a persisted counter. WindowStart is zero for cumulative limits.
+type Record struct {
+	Subject     string    `bson:"subject"`
+	Name        string    `bson:"name"`
+	WindowStart time.Time `bson:"window_start"`
+	Used        int64     `bson:"used"`
+	UpdatedAt   time.Time `bson:"updated_at"`
+}
+
+// Persister stores counter snapshots.
+type Persister interface {
+	Save(ctx context.Context, records []Record) error
+}
+
+// NewMongoPersister returns a Persister upserting one document per subject,
+// limit and window into coll.
+func NewMongoPersister(coll *mongo.Collection) *MongoPersister {
+	return &MongoPersister{coll: coll}
+}
+
+// MongoPersister is a Persister on a Mongo collection.
+type MongoPersister struct {
+	coll *mongo.Collection
+}
+
+// EnsureIndexes creates the unique index the upserts rely on.
+func (p *MongoPersister) EnsureIndexes(ctx context.Context) error {
+	_, err := p.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "subject", Value: 1}, {Key: "name", Value: 1}, {Key: "window_start", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create quota indexes failed", "collection", p.coll.Name())
+	}
+	return nil
+}
+
+func (p *MongoPersister) Save(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(records))
+	for i, r := range records {
+		filter := bson.M{"subject": r.Subject, "name": r.Name, "window_start": r.WindowStart}
+		models[i] = mongo.NewUpdateOneModel().SetFilter(filter).
+			SetUpdate(bson.M{"$set": bson.M{"used": r.Used, "updated_at": r.UpdatedAt}}).SetUpsert(true)
+	}
+	if _, err := p.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return errs.WrapMsg(err, "save quota records failed", "count", len(records))
+	}
+	return nil
+}
+
+// Find returns the persisted records of subject.
+func (p *MongoPersister) Find(ctx context.Context, subject string) ([]Record, error) {
+	cur, err := p.coll.Find(ctx, bson.M{"subject": subject}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "window_start", Value: 1}}))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find quota records failed", "subject", subject)
+	}
+	var records []Record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, errs.WrapMsg(err, "decode quota records failed", "subject", subject)
+	}
+	return records, nil
+}
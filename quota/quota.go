@@ -0,0 +1,382 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package quota accounts usage against limits per subject, e.g. messages per
+// day of a user or storage bytes of a tenant. Counters live in Redis so every
+// instance sees the same usage; Run flushes changed counters to a Persister
+// for reporting and billing.
+package quota
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	QuotaExceededError = 1861 // A quota limit would be exceeded.
+)
+
+var ErrQuotaExceeded = errs.NewCodeError(QuotaExceededError, "QuotaExceededError")
+
+// Unlimited disables a limit for a subject when returned by Config.Override.
+const Unlimited int64 = -1
+
+// Limit is a named quota. Windowed limits, like messages per day, reset at
+// every multiple of Window since the Unix epoch; limits without a window,
+// like storage bytes or group counts, are cumulative and decreased with
+// Release.
+type Limit struct {
+	Name   string
+	Max    int64
+	Window time.Duration
+}
+
+// Usage is the state of a limit for a subject.
+type Usage struct {
+	Subject string
+	Name    string
+	Used    int64
+	Max     int64     // Unlimited when the limit is disabled for the subject.
+	ResetAt time.Time // Zero for cumulative limits.
+}
+
+// Remaining returns how much can still be consumed.
+func (u *Usage) Remaining() int64 {
+	if u.Max == Unlimited {
+		return Unlimited
+	}
+	if u.Used >= u.Max {
+		return 0
+	}
+	return u.Max - u.Used
+}
+
+// Config configures a Manager.
+type Config struct {
+	KeyPrefix string // Defaults to "QUOTA:".
+	Limits    []Limit
+	// Override returns the max of a limit for a subject, e.g. from a tenant
+	// plan. It defaults to limit.Max.
+	Override func(ctx context.Context, subject string, limit Limit) (int64, error)
+	// Persister receives changed counters every PersistInterval, which
+	// defaults to 1 minute.
+	Persister       Persister
+	PersistInterval time.Duration
+}
+
+// Manager checks and consumes quotas.
+type Manager struct {
+	rdb    redis.UniversalClient
+	conf   Config
+	limits map[string]Limit
+
+	mu    sync.Mutex
+	dirty map[counter]struct{}
+}
+
+type counter struct {
+	subject string
+	name    string
+	window  int64 // Window index, 0 for cumulative limits.
+}
+
+// New creates a Manager.
+func New(rdb redis.UniversalClient, conf Config) (*Manager, error) {
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = "QUOTA:"
+	}
+	if conf.PersistInterval <= 0 {
+		conf.PersistInterval = time.Minute
+	}
+	limits := make(map[string]Limit, len(conf.Limits))
+	for _, limit := range conf.Limits {
+		if limit.Name == "" || limit.Window < 0 {
+			return nil, errs.ErrArgs.WrapMsg("invalid quota limit", "name", limit.Name)
+		}
+		if _, ok := limits[limit.Name]; ok {
+			return nil, errs.ErrArgs.WrapMsg("duplicate quota limit", "name", limit.Name)
+		}
+		limits[limit.Name] = limit
+	}
+	return &Manager{rdb: rdb, conf: conf, limits: limits, dirty: make(map[counter]struct{})}, nil
+}
+
+// consumeScript adds ARGV[1] unless the result exceeds ARGV[2] (negative
+// for unlimited) and returns {allowed, usage}. ARGV[3] is the expiry in
+// milliseconds for windowed counters.
+var consumeScript = redis.NewScript(`
+local used = tonumber(redis.call('GET', KEYS[1]) or '0')
+local n = tonumber(ARGV[1])
+local max = tonumber(ARGV[2])
+if max >= 0 and used + n > max then
+	return {0, used}
+end
+used = redis.call('INCRBY', KEYS[1], n)
+local ttl = tonumber(ARGV[3])
+if ttl > 0 and redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return {1, used}
+`)
+
+// releaseScript subtracts ARGV[1] without going below zero and returns the
+// usage, or -1 when the counter does not exist. A missing counter is left
+// alone, a SET would create a windowed counter without expiry.
+var releaseScript = redis.NewScript(`
+local used = redis.call('GET', KEYS[1])
+if not used then
+	return -1
+end
+used = tonumber(used) - tonumber(ARGV[1])
+if used < 0 then
+	used = 0
+end
+redis.call('SET', KEYS[1], used, 'KEEPTTL')
+return used
+`)
+
+func (m *Manager) limit(name string) (Limit, error) {
+	limit, ok := m.limits[name]
+	if !ok {
+		return Limit{}, errs.ErrArgs.WrapMsg("unknown quota limit", "name", name)
+	}
+	return limit, nil
+}
+
+func (m *Manager) max(ctx context.Context, subject string, limit Limit) (int64, error) {
+	if m.conf.Override == nil {
+		return limit.Max, nil
+	}
+	return m.conf.Override(ctx, subject, limit)
+}
+
+func (m *Manager) counter(subject string, limit Limit, now time.Time) counter {
+	c := counter{subject: subject, name: limit.Name}
+	if limit.Window > 0 {
+		c.window = now.UnixMilli() / limit.Window.Milliseconds()
+	}
+	return c
+}
+
+func (m *Manager) key(c counter) string {
+	key := m.conf.KeyPrefix + c.name + ":" + c.subject
+	if c.window != 0 {
+		key += ":" + strconv.FormatInt(c.window, 10)
+	}
+	return key
+}
+
+func resetAt(c counter, limit Limit) time.Time {
+	if limit.Window <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli((c.window + 1) * limit.Window.Milliseconds()).UTC()
+}
+
+func (m *Manager) markDirty(c counter) {
+	if m.conf.Persister == nil {
+		return
+	}
+	m.mu.Lock()
+	m.dirty[c] = struct{}{}
+	m.mu.Unlock()
+}
+
+// Consume adds n to the usage of subject when the limit allows it, and
+// otherwise returns ErrQuotaExceeded without changing the usage.
+func (m *Manager) Consume(ctx context.Context, subject string, name string, n int64) (*Usage, error) {
+	limit, err := m.limit(name)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errs.ErrArgs.WrapMsg("quota amount must not be negative", "name", name, "n", n)
+	}
+	max, err := m.max(ctx, subject, limit)
+	if err != nil {
+		return nil, err
+	}
+	c := m.counter(subject, limit, time.Now())
+	var ttl int64
+	if limit.Window > 0 {
+		// Keep windowed counters one extra window for late persistence.
+		ttl = time.Until(resetAt(c, limit)).Milliseconds() + limit.Window.Milliseconds()
+	}
+	res, err := consumeScript.Run(ctx, m.rdb, []string{m.key(c)}, n, max, ttl).Int64Slice()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "consume quota failed", "subject", subject, "name", name)
+	}
+	usage := &Usage{Subject: subject, Name: name, Used: res[1], Max: max, ResetAt: resetAt(c, limit)}
+	if res[0] == 0 {
+		return usage, ErrQuotaExceeded.WrapMsg("quota exceeded", "subject", subject, "name", name, "used", usage.Used, "max", max, "n", n)
+	}
+	m.markDirty(c)
+	return usage, nil
+}
+
+// Check returns ErrQuotaExceeded when consuming n would exceed the limit,
+// without consuming anything. Use Consume to reserve atomically.
+func (m *Manager) Check(ctx context.Context, subject string, name string, n int64) error {
+	usage, err := m.Usage(ctx, subject, name)
+	if err != nil {
+		return err
+	}
+	if usage.Max != Unlimited && usage.Used+n > usage.Max {
+		return ErrQuotaExceeded.WrapMsg("quota exceeded", "subject", subject, "name", name, "used", usage.Used, "max", usage.Max, "n", n)
+	}
+	return nil
+}
+
+// Release subtracts n from a usage, e.g. when storage is freed or a group is
+// dismissed. Usage does not go below zero; releasing from a counter without
+// usage does nothing.
+func (m *Manager) Release(ctx context.Context, subject string, name string, n int64) error {
+	limit, err := m.limit(name)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return errs.ErrArgs.WrapMsg("quota amount must not be negative", "name", name, "n", n)
+	}
+	c := m.counter(subject, limit, time.Now())
+	used, err := releaseScript.Run(ctx, m.rdb, []string{m.key(c)}, n).Int64()
+	if err != nil {
+		return errs.WrapMsg(err, "release quota failed", "subject", subject, "name", name)
+	}
+	if used >= 0 {
+		m.markDirty(c)
+	}
+	return nil
+}
+
+// Set overwrites a cumulative usage, e.g. to reconcile it with the source of
+// truth after a Redis data loss.
+func (m *Manager) Set(ctx context.Context, subject string, name string, used int64) error {
+	limit, err := m.limit(name)
+	if err != nil {
+		return err
+	}
+	if limit.Window > 0 {
+		return errs.ErrArgs.WrapMsg("only cumulative quota usage can be set", "name", name)
+	}
+	c := m.counter(subject, limit, time.Now())
+	if err := m.rdb.Set(ctx, m.key(c), used, 0).Err(); err != nil {
+		return errs.WrapMsg(err, "set quota usage failed", "subject", subject, "name", name)
+	}
+	m.markDirty(c)
+	return nil
+}
+
+// Usage returns the current usage of subject.
+func (m *Manager) Usage(ctx context.Context, subject string, name string) (*Usage, error) {
+	limit, err := m.limit(name)
+	if err != nil {
+		return nil, err
+	}
+	max, err := m.max(ctx, subject, limit)
+	if err != nil {
+		return nil, err
+	}
+	c := m.counter(subject, limit, time.Now())
+	used, err := m.rdb.Get(ctx, m.key(c)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errs.WrapMsg(err, "get quota usage failed", "subject", subject, "name", name)
+	}
+	return &Usage{Subject: subject, Name: name, Used: used, Max: max, ResetAt: resetAt(c, limit)}, nil
+}
+
+// Run flushes changed counters to the Persister every PersistInterval until
+// ctx is done, then flushes once more.
+func (m *Manager) Run(ctx context.Context) {
+	if m.conf.Persister == nil {
+		return
+	}
+	ticker := time.NewTicker(m.conf.PersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := m.Flush(context.WithoutCancel(ctx)); err != nil {
+				log.ZWarn(ctx, "quota flush failed", err)
+			}
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				log.ZWarn(ctx, "quota flush failed", err)
+			}
+		}
+	}
+}
+
+// Flush persists the counters changed since the last flush. Counters that
+// fail to persist are retried by the next flush.
+func (m *Manager) Flush(ctx context.Context) error {
+	if m.conf.Persister == nil {
+		return nil
+	}
+	m.mu.Lock()
+	dirty := m.dirty
+	m.dirty = make(map[counter]struct{})
+	m.mu.Unlock()
+	if len(dirty) == 0 {
+		return nil
+	}
+	counters := make([]counter, 0, len(dirty))
+	keys := make([]string, 0, len(dirty))
+	for c := range dirty {
+		counters = append(counters, c)
+		keys = append(keys, m.key(c))
+	}
+	records := make([]Record, 0, len(counters))
+	// Keys may be in different cluster slots, so read them one by one in a pipeline.
+	pipe := m.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		m.requeue(counters)
+		return errs.WrapMsg(err, "read quota counters failed", "count", len(keys))
+	}
+	now := time.Now().UTC()
+	for i, c := range counters {
+		used, _ := cmds[i].Int64()
+		limit := m.limits[c.name]
+		record := Record{Subject: c.subject, Name: c.name, Used: used, UpdatedAt: now}
+		if limit.Window > 0 {
+			record.WindowStart = time.UnixMilli(c.window * limit.Window.Milliseconds()).UTC()
+		}
+		records = append(records, record)
+	}
+	if err := m.conf.Persister.Save(ctx, records); err != nil {
+		m.requeue(counters)
+		return err
+	}
+	return nil
+}
+
+func (m *Manager) requeue(counters []counter) {
+	m.mu.Lock()
+	for _, c := range counters {
+		m.dirty[c] = struct{}{}
+	}
+	m.mu.Unlock()
+}
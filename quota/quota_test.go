@@ -0,0 +1,167 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package quota
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+type memoryPersister struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func (p *memoryPersister) Save(ctx context.Context, records []Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range records {
+		p.records[r.Subject+"/"+r.Name] = r
+	}
+	return nil
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil, Config{Limits: []Limit{{Name: "a"}, {Name: "a"}}})
+	assert.Error(t, err)
+	_, err = New(nil, Config{Limits: []Limit{{Max: 1}}})
+	assert.Error(t, err)
+}
+
+func TestWindow(t *testing.T) {
+	m, err := New(nil, Config{})
+	require.NoError(t, err)
+	day := Limit{Name: "messages", Window: 24 * time.Hour}
+	now := time.Date(2024, 5, 6, 13, 0, 0, 0, time.UTC)
+	c := m.counter("user:1", day, now)
+	assert.Equal(t, time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC), resetAt(c, day))
+	assert.Equal(t, "QUOTA:messages:user:1:19849", m.key(c))
+
+	storage := Limit{Name: "storage"}
+	c = m.counter("tenant:acme", storage, now)
+	assert.True(t, resetAt(c, storage).IsZero())
+	assert.Equal(t, "QUOTA:storage:tenant:acme", m.key(c))
+
+	u := &Usage{Used: 7, Max: 5}
+	assert.Equal(t, int64(0), u.Remaining())
+	u.Max = Unlimited
+	assert.Equal(t, Unlimited, u.Remaining())
+}
+
+func TestDefaultSubject(t *testing.T) {
+	ctx := context.Background()
+	assert.Empty(t, DefaultSubject(ctx, nil))
+	ctx = mcontext.SetOpUserID(ctx, "u1")
+	assert.Equal(t, "user:u1", DefaultSubject(ctx, nil))
+	ctx = mcontext.SetTenantID(ctx, "acme")
+	assert.Equal(t, "tenant:acme", DefaultSubject(ctx, nil))
+}
+
+func TestManager(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	persister := &memoryPersister{records: make(map[string]Record)}
+	m, err := New(rdb, Config{
+		KeyPrefix: "QUOTA_TEST:" + time.Now().Format("150405.000") + ":",
+		Limits: []Limit{
+			{Name: "messages", Max: 3, Window: time.Hour},
+			{Name: "storage", Max: 100},
+		},
+		Override: func(ctx context.Context, subject string, limit Limit) (int64, error) {
+			if subject == "vip" {
+				return Unlimited, nil
+			}
+			return limit.Max, nil
+		},
+		Persister: persister,
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := m.Consume(ctx, "u1", "messages", 1)
+		require.NoError(t, err)
+	}
+	usage, err := m.Consume(ctx, "u1", "messages", 1)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	assert.Equal(t, int64(3), usage.Used)
+	assert.False(t, usage.ResetAt.IsZero())
+	assert.ErrorIs(t, m.Check(ctx, "u1", "messages", 1), ErrQuotaExceeded)
+	assert.NoError(t, m.Check(ctx, "u2", "messages", 3))
+
+	for i := 0; i < 10; i++ {
+		_, err := m.Consume(ctx, "vip", "messages", 1)
+		require.NoError(t, err)
+	}
+
+	_, err = m.Consume(ctx, "acme", "storage", 80)
+	require.NoError(t, err)
+	_, err = m.Consume(ctx, "acme", "storage", 30)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	require.NoError(t, m.Release(ctx, "acme", "storage", 50))
+	_, err = m.Consume(ctx, "acme", "storage", 30)
+	require.NoError(t, err)
+	require.NoError(t, m.Release(ctx, "acme", "storage", 500))
+	usage, err = m.Usage(ctx, "acme", "storage")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), usage.Used)
+	assert.ErrorIs(t, m.Release(ctx, "acme", "storage", -1), errs.ErrArgs)
+	require.NoError(t, m.Release(ctx, "u9", "messages", 1))
+	n, err := rdb.Exists(ctx, m.key(m.counter("u9", m.limits["messages"], time.Now()))).Result()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.NoError(t, m.Set(ctx, "acme", "storage", 42))
+	assert.Error(t, m.Set(ctx, "u1", "messages", 1))
+
+	_, err = m.Consume(ctx, "u1", "unknown", 1)
+	assert.ErrorIs(t, err, errs.ErrArgs)
+
+	require.NoError(t, m.Flush(ctx))
+	assert.Equal(t, int64(42), persister.records["acme/storage"].Used)
+	assert.True(t, persister.records["acme/storage"].WindowStart.IsZero())
+	assert.Equal(t, int64(3), persister.records["u1/messages"].Used)
+	assert.False(t, persister.records["u1/messages"].WindowStart.IsZero())
+
+	interceptor := m.UnaryServerInterceptor(map[string]Rule{"/msg.msg/sendMsg": {Limit: "messages"}})
+	info := &grpc.UnaryServerInfo{FullMethod: "/msg.msg/sendMsg"}
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	_, err = interceptor(mcontext.SetOpUserID(ctx, "u1"), nil, info, handler)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	resp, err := interceptor(mcontext.SetOpUserID(ctx, "u3"), nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+}
+
+func TestMongoPersister(t *testing.T) {
+	ctx := context.Background()
+	p := NewMongoPersister(containers.Mongo(t, "quota").GetDB().Collection("quota"))
+	require.NoError(t, p.EnsureIndexes(ctx))
+	day := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, p.Save(ctx, []Record{{Subject: "u1", Name: "messages", WindowStart: day, Used: 1}, {Subject: "u1", Name: "storage", Used: 10}}))
+	require.NoError(t, p.Save(ctx, []Record{{Subject: "u1", Name: "messages", WindowStart: day, Used: 5}}))
+	records, err := p.Find(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, int64(5), records[0].Used)
+	assert.Equal(t, int64(10), records[1].Used)
+}
@@ -17,6 +17,7 @@ import (
 	aws3 "github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/throttle"
 )
 
 const (
@@ -31,6 +32,8 @@ type Config struct {
 	AccessKeyID     string
 	SecretAccessKey string
 	SessionToken    string
+	// Throttle limits the bandwidth of transfers made by the server.
+	Throttle *throttle.Throttle
 }
 
 func NewAws(conf Config) (*Aws, error) {
@@ -38,6 +41,9 @@ func NewAws(conf Config) (*Aws, error) {
 		Region:      conf.Region,
 		Credentials: credentials.NewStaticCredentialsProvider(conf.AccessKeyID, conf.SecretAccessKey, conf.SessionToken),
 	}
+	if conf.Throttle != nil {
+		cfg.HTTPClient = &http.Client{Transport: conf.Throttle.Transport(nil)}
+	}
 	client := aws3.NewFromConfig(cfg)
 	return &Aws{
 		bucket:  conf.Bucket,
@@ -0,0 +1,220 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cdn builds signed CDN URLs for s3 object names, so object URLs
+// returned by APIs are served by a CDN in front of the bucket rather than
+// by presigned bucket URLs. It supports the URL authentication of Aliyun
+// (type A), Tencent Cloud (types A and D) and CloudFront canned policies.
+package cdn
+
+import (
+	"context"
+	"crypto"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Type is a CDN URL authentication scheme.
+type Type string
+
+const (
+	// AliyunA appends auth_key=<expires>-<rand>-<uid>-<md5>. The CDN
+	// rejects the URL after expires.
+	AliyunA Type = "aliyun-a"
+	// TencentA appends sign=<timestamp>-<rand>-<uid>-<md5>. The timestamp
+	// is the signing time; the validity is configured in the console.
+	TencentA Type = "tencent-a"
+	// TencentD appends sign=<md5>&t=<hex timestamp>, the timestamp being
+	// the signing time as for TencentA.
+	TencentD Type = "tencent-d"
+	// CloudFront appends Expires, Signature and Key-Pair-Id of a canned
+	// policy signed with the RSA key of the key pair.
+	CloudFront Type = "cloudfront"
+)
+
+// Config configures a CDN.
+type Config struct {
+	Type Type
+	// BaseURL is the CDN origin object names are appended to, e.g.
+	// "https://cdn.example.com" or "https://cdn.example.com/media".
+	BaseURL string
+	// Key is the authentication key of the Aliyun and Tencent types.
+	Key string
+	// BackupKey, when set, is used instead of Key while rotating keys:
+	// configure the new key as backup in the console, switch here, then
+	// make it primary.
+	BackupKey string
+	// UID is the user field of the type A schemes, defaults to "0".
+	UID string
+	// ParamName overrides the query parameter of the signature for the
+	// Aliyun and Tencent types.
+	ParamName string
+	// KeyPairID and PrivateKey are the CloudFront key pair; PrivateKey is
+	// a PEM encoded RSA key in PKCS #1 or PKCS #8.
+	KeyPairID  string
+	PrivateKey string
+	// Expire is the validity of CloudFront and Aliyun URLs when none is
+	// given, defaults to 1 hour.
+	Expire time.Duration
+}
+
+// CDN signs object URLs.
+type CDN struct {
+	conf   Config
+	base   *url.URL
+	rsaKey *rsa.PrivateKey
+	now    func() time.Time
+	rand   func() string
+}
+
+func New(conf Config) (*CDN, error) {
+	base, err := url.Parse(strings.TrimSuffix(conf.BaseURL, "/"))
+	if err != nil || base.Host == "" {
+		return nil, errs.ErrArgs.WrapMsg("invalid cdn base url", "baseURL", conf.BaseURL)
+	}
+	if conf.Expire <= 0 {
+		conf.Expire = time.Hour
+	}
+	if conf.UID == "" {
+		conf.UID = "0"
+	}
+	c := &CDN{conf: conf, base: base, now: time.Now, rand: randString}
+	switch conf.Type {
+	case AliyunA:
+		if conf.ParamName == "" {
+			c.conf.ParamName = "auth_key"
+		}
+	case TencentA, TencentD:
+		if conf.ParamName == "" {
+			c.conf.ParamName = "sign"
+		}
+	case CloudFront:
+		if conf.KeyPairID == "" {
+			return nil, errs.ErrArgs.WrapMsg("cloudfront key pair id is required")
+		}
+		if c.rsaKey, err = parseRSAKey(conf.PrivateKey); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, errs.ErrArgs.WrapMsg("unknown cdn type", "type", conf.Type)
+	}
+	if conf.Key == "" && conf.BackupKey == "" {
+		return nil, errs.ErrArgs.WrapMsg("cdn key is required", "type", conf.Type)
+	}
+	return c, nil
+}
+
+func parseRSAKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errs.ErrArgs.WrapMsg("cloudfront private key is not pem encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid cloudfront private key", "err", err.Error())
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("cloudfront private key is not rsa")
+	}
+	return rsaKey, nil
+}
+
+// URL returns the signed CDN URL of the object name, valid for expire or
+// Config.Expire when zero, where the scheme carries an expiry.
+func (c *CDN) URL(name string, expire time.Duration) (string, error) {
+	if expire <= 0 {
+		expire = c.conf.Expire
+	}
+	segments := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	// The signatures cover the path as sent to the CDN.
+	path := c.base.EscapedPath() + "/" + strings.Join(segments, "/")
+	resource := c.base.Scheme + "://" + c.base.Host + path
+	now := c.now()
+	query := make(url.Values)
+	switch c.conf.Type {
+	case AliyunA, TencentA:
+		ts := now.Unix()
+		if c.conf.Type == AliyunA {
+			ts = now.Add(expire).Unix()
+		}
+		rnd := c.rand()
+		fields := strconv.FormatInt(ts, 10) + "-" + rnd + "-" + c.conf.UID
+		query.Set(c.conf.ParamName, fields+"-"+md5Hex(path+"-"+fields+"-"+c.key()))
+	case TencentD:
+		ts := strconv.FormatInt(now.Unix(), 16)
+		query.Set(c.conf.ParamName, md5Hex(c.key()+path+ts))
+		query.Set("t", ts)
+	case CloudFront:
+		expires := strconv.FormatInt(now.Add(expire).Unix(), 10)
+		policy := `{"Statement":[{"Resource":"` + resource + `","Condition":{"DateLessThan":{"AWS:EpochTime":` + expires + `}}}]}`
+		sum := sha1.Sum([]byte(policy))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, c.rsaKey, crypto.SHA1, sum[:])
+		if err != nil {
+			return "", errs.WrapMsg(err, "cloudfront sign failed")
+		}
+		query.Set("Expires", expires)
+		query.Set("Signature", cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(sig)))
+		query.Set("Key-Pair-Id", c.conf.KeyPairID)
+	}
+	return resource + "?" + query.Encode(), nil
+}
+
+// AccessURL implements the AccessURL method of s3.Interface, so a CDN can
+// stand in for presigned URLs. The options are not supported by CDN
+// signing and ignored.
+func (c *CDN) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
+	return c.URL(name, expire)
+}
+
+func (c *CDN) key() string {
+	if c.conf.BackupKey != "" {
+		return c.conf.BackupKey
+	}
+	return c.conf.Key
+}
+
+// cloudFrontEncoding makes base64 URL safe the way CloudFront expects.
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func randString() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
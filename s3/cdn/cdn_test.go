@@ -0,0 +1,94 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdn
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fixed(t *testing.T, conf Config) *CDN {
+	c, err := New(conf)
+	require.NoError(t, err)
+	c.now = func() time.Time { return time.Unix(1444435200, 0).Add(-time.Hour) }
+	c.rand = func() string { return "0" }
+	return c
+}
+
+func TestAliyunA(t *testing.T) {
+	// The example of the Aliyun documentation.
+	c := fixed(t, Config{Type: AliyunA, BaseURL: "http://cdn.example.com/", Key: "aliyuncdnexp1234"})
+	rawURL, err := c.URL("video/standard/1K.html", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "http://cdn.example.com/video/standard/1K.html?auth_key=1444435200-0-0-80cd3862d699b7118eed99103f2a3a4f", rawURL)
+}
+
+func TestTencent(t *testing.T) {
+	c := fixed(t, Config{Type: TencentD, BaseURL: "https://cdn.example.com", Key: "old", BackupKey: "tencentkey"})
+	c.now = func() time.Time { return time.Unix(1444435200, 0) }
+	rawURL, err := c.URL("a b/c.jpg", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/a%20b/c.jpg?sign=51249a2e2523845924ff69f3edeb82cf&t=56185500", rawURL)
+
+	c = fixed(t, Config{Type: TencentA, BaseURL: "https://cdn.example.com/media", Key: "k", UID: "7", ParamName: "s"})
+	rawURL, err = c.URL("/x.png", 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(rawURL, "https://cdn.example.com/media/x.png?s=1444431600-0-7-"))
+	assert.Equal(t, md5Hex("/media/x.png-1444431600-0-7-k"), rawURL[strings.LastIndexByte(rawURL, '-')+1:])
+}
+
+func TestCloudFront(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	c := fixed(t, Config{Type: CloudFront, BaseURL: "https://d111111abcdef8.cloudfront.net", KeyPairID: "K2JCJMDEHXQW5F", PrivateKey: pemKey})
+	rawURL, err := c.URL("images/a.jpg", 2*time.Hour)
+	require.NoError(t, err)
+
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	query := u.Query()
+	assert.Equal(t, "1444438800", query.Get("Expires"))
+	assert.Equal(t, "K2JCJMDEHXQW5F", query.Get("Key-Pair-Id"))
+	sig, err := base64.StdEncoding.DecodeString(strings.NewReplacer("-", "+", "_", "=", "~", "/").Replace(query.Get("Signature")))
+	require.NoError(t, err)
+	policy := `{"Statement":[{"Resource":"https://d111111abcdef8.cloudfront.net/images/a.jpg","Condition":{"DateLessThan":{"AWS:EpochTime":1444438800}}}]}`
+	sum := sha1.Sum([]byte(policy))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, sum[:], sig))
+
+	_, err = New(Config{Type: CloudFront, BaseURL: "https://d.cloudfront.net", KeyPairID: "K", PrivateKey: "x"})
+	assert.Error(t, err)
+}
+
+func TestConfig(t *testing.T) {
+	_, err := New(Config{Type: AliyunA, BaseURL: "https://cdn.example.com"})
+	assert.Error(t, err)
+	_, err = New(Config{Type: "unknown", BaseURL: "https://cdn.example.com", Key: "k"})
+	assert.Error(t, err)
+	_, err = New(Config{Type: AliyunA, BaseURL: "cdn.example.com", Key: "k"})
+	assert.Error(t, err)
+}
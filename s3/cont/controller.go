@@ -25,6 +25,8 @@ import (
 	"time"
 
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/dedup"
+	"github.com/openimsdk/tools/s3/scan"
 
 	"github.com/google/uuid"
 	"github.com/openimsdk/tools/errs"
@@ -38,9 +40,36 @@ func New(cache S3Cache, impl s3.Interface) *Controller {
 	}
 }
 
+// Controller manages uploads through presigned URLs. Clients transfer the
+// content directly with the storage, so it is never encrypted by s3/crypt;
+// see that package for explicit client-side encryption.
 type Controller struct {
 	cache S3Cache
 	impl  s3.Interface
+	scan  *scan.Pipeline
+	dedup *dedup.Deduper
+}
+
+// SetScanner submits every completed upload to p and refuses access URLs
+// of objects p found infected.
+func (c *Controller) SetScanner(p *scan.Pipeline) {
+	c.scan = p
+}
+
+// SetDedup counts the references of completed uploads by hash in d, see
+// ReleaseHash.
+func (c *Controller) SetDedup(d *dedup.Deduper) {
+	c.dedup = d
+}
+
+// ReleaseHash drops a reference taken by CompleteUpload and deletes the
+// hash object with the last one. Without a Deduper it does nothing.
+func (c *Controller) ReleaseHash(ctx context.Context, hash string) error {
+	if c.dedup == nil {
+		return nil
+	}
+	_, err := c.dedup.Release(ctx, hash)
+	return err
 }
 
 func (c *Controller) Engine() string {
@@ -284,6 +313,11 @@ func (c *Controller) CompleteUpload(ctx context.Context, uploadID string, partHa
 		return nil, errors.New("md5 mismatching")
 	}
 	if info, err := c.StatObject(ctx, c.HashPath(upload.Hash)); err == nil {
+		if c.dedup != nil {
+			if _, err := c.dedup.Adopt(ctx, upload.Hash, info.Key, info.Size); err != nil {
+				return nil, err
+			}
+		}
 		return &UploadResult{
 			Key:  info.Key,
 			Size: info.Size,
@@ -348,6 +382,16 @@ func (c *Controller) CompleteUpload(ctx context.Context, uploadID string, partHa
 	if err := c.cache.DelS3Key(ctx, c.impl.Engine(), targetKey); err != nil {
 		return nil, err
 	}
+	if c.dedup != nil {
+		if _, err := c.dedup.Adopt(ctx, upload.Hash, targetKey, upload.Size); err != nil {
+			return nil, err
+		}
+	}
+	if c.scan != nil {
+		if err := c.scan.Submit(ctx, targetKey, upload.Size); err != nil {
+			log.ZWarn(ctx, "submit upload scan failed", err, "key", targetKey)
+		}
+	}
 	return &UploadResult{
 		Key:  targetKey,
 		Size: upload.Size,
@@ -379,6 +423,11 @@ func (c *Controller) AccessURL(ctx context.Context, name string, expire time.Dur
 	//	opt.Filename = ""
 	//	opt.ContentType = ""
 	//}
+	if c.scan != nil {
+		if err := c.scan.Check(ctx, name); err != nil {
+			return "", err
+		}
+	}
 	return c.impl.AccessURL(ctx, name, expire, opt)
 }
 
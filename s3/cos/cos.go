@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/throttle"
 	"github.com/tencentyun/cos-go-sdk-v5"
 
 	"github.com/openimsdk/tools/errs"
@@ -59,6 +60,8 @@ type Config struct {
 	SecretKey    string
 	SessionToken string
 	PublicRead   bool
+	// Throttle limits the bandwidth of transfers made by the server.
+	Throttle *throttle.Throttle
 }
 
 func NewCos(conf Config) (*Cos, error) {
@@ -66,13 +69,15 @@ func NewCos(conf Config) (*Cos, error) {
 	if err != nil {
 		panic(err)
 	}
-	client := cos.NewClient(&cos.BaseURL{BucketURL: u}, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:     conf.SecretID,
-			SecretKey:    conf.SecretKey,
-			SessionToken: conf.SessionToken,
-		},
-	})
+	transport := &cos.AuthorizationTransport{
+		SecretID:     conf.SecretID,
+		SecretKey:    conf.SecretKey,
+		SessionToken: conf.SessionToken,
+	}
+	if conf.Throttle != nil {
+		transport.Transport = conf.Throttle.Transport(nil)
+	}
+	client := cos.NewClient(&cos.BaseURL{BucketURL: u}, &http.Client{Transport: transport})
 	return &Cos{
 		publicRead: conf.PublicRead,
 		copyURL:    u.Host + "/",
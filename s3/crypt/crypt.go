@@ -0,0 +1,367 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crypt encrypts s3 objects on the client with AES-256-GCM envelope
+// encryption: every object gets its own data key, which a KeyProvider wraps
+// with a master key, static or held by a KMS. Since s3.Interface carries no
+// user metadata, the master key ID and the wrapped data key are stored in a
+// header in front of the ciphertext. The content follows in authenticated
+// chunks, so objects stream in constant memory and truncation, reordering
+// or a changed header are detected on decryption.
+//
+// Encryption is opt-in per call: only objects written with Crypter.Put or
+// Encrypt are encrypted. cont.Controller hands out presigned URLs, so
+// uploads and downloads through it reach the storage directly and stay in
+// plain text; callers that need encrypted objects must store and read them
+// through a Crypter themselves.
+package crypt
+
+import (
+	"bufio"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+var (
+	// ErrDecrypt is returned for objects that are not encrypted, were
+	// modified or were encrypted with another key.
+	ErrDecrypt = errs.New("s3 object decryption failed")
+	// ErrUnknownKey is returned when a master key ID is not known.
+	ErrUnknownKey = errs.New("s3 encryption key unknown")
+)
+
+const (
+	magic            = "OIMC"
+	version          = 1
+	noncePrefixSize  = 7
+	defaultChunkSize = 64 << 10
+	maxChunkSize     = 16 << 20
+	// fixedHeaderSize covers magic, version, chunk size, nonce prefix and
+	// the two length fields.
+	fixedHeaderSize = len(magic) + 1 + 4 + noncePrefixSize + 2 + 2
+)
+
+// Config configures a Crypter.
+type Config struct {
+	// ChunkSize is the plaintext size of an authenticated chunk, defaults
+	// to 64 KiB.
+	ChunkSize int
+	// Client uploads and downloads objects for Put and Get, defaults to
+	// http.DefaultClient.
+	Client *http.Client
+}
+
+// Crypter encrypts and decrypts objects.
+type Crypter struct {
+	keys KeyProvider
+	conf Config
+}
+
+func New(keys KeyProvider, conf Config) *Crypter {
+	if conf.ChunkSize <= 0 {
+		conf.ChunkSize = defaultChunkSize
+	}
+	conf.ChunkSize = min(conf.ChunkSize, maxChunkSize)
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	return &Crypter{keys: keys, conf: conf}
+}
+
+// header is the envelope in front of the ciphertext. raw is its encoding,
+// authenticated with every chunk.
+type header struct {
+	raw         []byte
+	keyID       string
+	wrapped     []byte
+	chunkSize   int
+	noncePrefix []byte
+}
+
+func (h *header) encode() {
+	raw := make([]byte, 0, fixedHeaderSize+len(h.keyID)+len(h.wrapped))
+	raw = append(raw, magic...)
+	raw = append(raw, version)
+	raw = binary.BigEndian.AppendUint32(raw, uint32(h.chunkSize))
+	raw = append(raw, h.noncePrefix...)
+	raw = binary.BigEndian.AppendUint16(raw, uint16(len(h.keyID)))
+	raw = append(raw, h.keyID...)
+	raw = binary.BigEndian.AppendUint16(raw, uint16(len(h.wrapped)))
+	raw = append(raw, h.wrapped...)
+	h.raw = raw
+}
+
+func readHeader(r io.Reader) (*header, error) {
+	fixed := make([]byte, len(magic)+1+4+noncePrefixSize+2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, ErrDecrypt.WrapMsg("read header failed", "err", err.Error())
+	}
+	if string(fixed[:len(magic)]) != magic || fixed[len(magic)] != version {
+		return nil, ErrDecrypt.WrapMsg("not an encrypted object")
+	}
+	rest := fixed[len(magic)+1:]
+	h := &header{
+		chunkSize:   int(binary.BigEndian.Uint32(rest)),
+		noncePrefix: rest[4 : 4+noncePrefixSize],
+	}
+	if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+		return nil, ErrDecrypt.WrapMsg("invalid chunk size", "chunkSize", h.chunkSize)
+	}
+	keyID, err := readField(r, binary.BigEndian.Uint16(rest[4+noncePrefixSize:]))
+	if err != nil {
+		return nil, err
+	}
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, ErrDecrypt.WrapMsg("read header failed", "err", err.Error())
+	}
+	if h.wrapped, err = readField(r, binary.BigEndian.Uint16(size[:])); err != nil {
+		return nil, err
+	}
+	h.keyID = string(keyID)
+	h.encode()
+	return h, nil
+}
+
+func readField(r io.Reader, size uint16) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrDecrypt.WrapMsg("read header failed", "err", err.Error())
+	}
+	return b, nil
+}
+
+// nonce returns the nonce of chunk i: the random prefix, the counter and
+// whether it is the last chunk.
+func (h *header) nonce(i uint32, last bool) []byte {
+	nonce := make([]byte, 0, noncePrefixSize+5)
+	nonce = append(nonce, h.noncePrefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, i)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// size returns the encrypted size of plain bytes.
+func (h *header) size(plain int64, overhead int) int64 {
+	chunks := max((plain+int64(h.chunkSize)-1)/int64(h.chunkSize), 1)
+	return int64(len(h.raw)) + plain + chunks*int64(overhead)
+}
+
+// newHeader creates the header and cipher of a new object.
+func (c *Crypter) newHeader(ctx context.Context) (*header, cipher.AEAD, error) {
+	key := make([]byte, dataKeySize)
+	noncePrefix := make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, nil, errs.WrapMsg(err, "generate data key failed")
+	}
+	if _, err := io.ReadFull(rand.Reader, noncePrefix); err != nil {
+		return nil, nil, errs.WrapMsg(err, "generate nonce failed")
+	}
+	keyID, wrapped, err := c.keys.WrapKey(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keyID) > 0xffff || len(wrapped) > 0xffff {
+		return nil, nil, errs.ErrArgs.WrapMsg("key ID or wrapped key too long", "keyID", keyID)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, errs.WrapMsg(err, "create cipher failed")
+	}
+	h := &header{keyID: keyID, wrapped: wrapped, chunkSize: c.conf.ChunkSize, noncePrefix: noncePrefix}
+	h.encode()
+	return h, aead, nil
+}
+
+// Encrypt returns a writer encrypting to w. The header is written at once;
+// Close writes the last chunk and must be called.
+func (c *Crypter) Encrypt(ctx context.Context, w io.Writer) (io.WriteCloser, error) {
+	h, aead, err := c.newHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newWriter(w, h, aead)
+}
+
+func newWriter(w io.Writer, h *header, aead cipher.AEAD) (*writer, error) {
+	if _, err := w.Write(h.raw); err != nil {
+		return nil, errs.WrapMsg(err, "write encryption header failed")
+	}
+	return &writer{
+		w:      w,
+		aead:   aead,
+		header: h,
+		buf:    make([]byte, 0, h.chunkSize),
+		sealed: make([]byte, 0, h.chunkSize+aead.Overhead()),
+	}, nil
+}
+
+type writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header *header
+	buf    []byte
+	sealed []byte
+	chunk  uint32
+	closed bool
+	err    error
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errs.New("encrypted object writer closed").Wrap()
+	}
+	var written int
+	for len(p) > 0 {
+		if w.err != nil {
+			return written, w.err
+		}
+		// A full chunk is sealed only once more data follows, as the last
+		// chunk is marked.
+		if len(w.buf) == cap(w.buf) {
+			w.flush(false)
+			continue
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) flush(last bool) {
+	if w.chunk == ^uint32(0) {
+		w.err = errs.ErrArgs.WrapMsg("object too large to encrypt")
+		return
+	}
+	w.sealed = w.aead.Seal(w.sealed[:0], w.header.nonce(w.chunk, last), w.buf, w.header.raw)
+	if _, err := w.w.Write(w.sealed); err != nil {
+		w.err = errs.WrapMsg(err, "write encrypted chunk failed")
+		return
+	}
+	w.chunk++
+	w.buf = w.buf[:0]
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err == nil {
+		w.flush(true)
+	}
+	return w.err
+}
+
+// Decrypt returns a reader decrypting r. Reading fails with ErrDecrypt when
+// the object was modified or truncated.
+func (c *Crypter) Decrypt(ctx context.Context, r io.Reader) (io.Reader, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.keys.UnwrapKey(ctx, h.keyID, h.wrapped)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, ErrDecrypt.WrapMsg("invalid data key", "keyID", h.keyID)
+	}
+	return &reader{
+		r:      bufio.NewReaderSize(r, h.chunkSize+aead.Overhead()+1),
+		aead:   aead,
+		header: h,
+		sealed: make([]byte, h.chunkSize+aead.Overhead()),
+	}, nil
+}
+
+// KeyID returns the master key ID in the header of an encrypted object,
+// e.g. to find objects to re-encrypt after a key rotation.
+func KeyID(r io.Reader) (string, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return "", err
+	}
+	return h.keyID, nil
+}
+
+type reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header *header
+	sealed []byte
+	plain  []byte
+	chunk  uint32
+	done   bool
+	err    error
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk into plain.
+func (r *reader) next() {
+	n, err := io.ReadFull(r.r, r.sealed)
+	var last bool
+	switch {
+	case err == nil:
+		_, err = r.r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			r.err = errs.WrapMsg(err, "read encrypted object failed")
+			return
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		r.err = ErrDecrypt.WrapMsg("encrypted object truncated")
+		return
+	default:
+		r.err = errs.WrapMsg(err, "read encrypted object failed")
+		return
+	}
+	plain, err := r.aead.Open(r.sealed[:0], r.header.nonce(r.chunk, last), r.sealed[:n], r.header.raw)
+	if err != nil {
+		r.err = ErrDecrypt.WrapMsg("encrypted chunk authentication failed", "chunk", r.chunk)
+		return
+	}
+	r.plain = plain
+	r.chunk++
+	r.done = last
+}
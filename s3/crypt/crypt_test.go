@@ -0,0 +1,159 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T, current string) KeyProvider {
+	keys, err := StaticKeys(current, map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32), "k2": bytes.Repeat([]byte{2}, 16)})
+	require.NoError(t, err)
+	return keys
+}
+
+func encrypt(t *testing.T, c *Crypter, plain []byte) []byte {
+	var buf bytes.Buffer
+	w, err := c.Encrypt(context.Background(), &buf)
+	require.NoError(t, err)
+	_, err = w.Write(plain)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := New(testKeys(t, "k1"), Config{ChunkSize: 16})
+	for _, size := range []int{0, 1, 16, 17, 48, 100} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+		sealed := encrypt(t, c, plain)
+
+		h, err := readHeader(bytes.NewReader(sealed))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(sealed)), h.size(int64(size), 16), "size %d", size)
+
+		r, err := c.Decrypt(context.Background(), bytes.NewReader(sealed))
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, plain, got, "size %d", size)
+	}
+}
+
+func TestTampered(t *testing.T) {
+	c := New(testKeys(t, "k1"), Config{ChunkSize: 16})
+	sealed := encrypt(t, c, []byte(strings.Repeat("secret", 10)))
+	decrypt := func(b []byte) error {
+		r, err := c.Decrypt(context.Background(), bytes.NewReader(b))
+		if err != nil {
+			return err
+		}
+		_, err = io.ReadAll(r)
+		return err
+	}
+
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)-1] ^= 1
+	assert.True(t, ErrDecrypt.Is(decrypt(flipped)))
+	// Dropping whole chunks leaves a non-last chunk at the end.
+	assert.True(t, ErrDecrypt.Is(decrypt(sealed[:len(sealed)-16-16])))
+	assert.True(t, ErrDecrypt.Is(decrypt([]byte("plain text object"))))
+
+	other := New(testKeys(t, "k2"), Config{})
+	_, err := other.Decrypt(context.Background(), bytes.NewReader(sealed))
+	assert.NoError(t, err, "k1 is still known to other")
+	unknown, err := StaticKeys("k3", map[string][]byte{"k3": bytes.Repeat([]byte{3}, 32)})
+	require.NoError(t, err)
+	_, err = New(unknown, Config{}).Decrypt(context.Background(), bytes.NewReader(sealed))
+	assert.True(t, ErrUnknownKey.Is(err))
+}
+
+func TestKMS(t *testing.T) {
+	// A reversible stand-in for a KMS.
+	xor := func(ctx context.Context, keyID string, b []byte) ([]byte, error) {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ 0x5a
+		}
+		return out, nil
+	}
+	c := New(&KMS{KeyID: "arn:kms:1", Encrypt: xor, Decrypt: xor}, Config{})
+	sealed := encrypt(t, c, []byte("hello"))
+	keyID, err := KeyID(bytes.NewReader(sealed))
+	require.NoError(t, err)
+	assert.Equal(t, "arn:kms:1", keyID)
+	r, err := c.Decrypt(context.Background(), bytes.NewReader(sealed))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(got))
+}
+
+func TestPutGet(t *testing.T) {
+	storage := mock.NewStorage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		switch r.Method {
+		case http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			assert.Equal(t, r.ContentLength, int64(len(data)))
+			storage.PutObject(name, data, r.Header.Get("Content-Type"))
+		case http.MethodGet:
+			data, err := storage.GetObject(name)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(data)
+		}
+	}))
+	defer srv.Close()
+	storage.BaseURL = srv.URL
+
+	ctx := context.Background()
+	c := New(testKeys(t, "k2"), Config{ChunkSize: 1024})
+	plain := bytes.Repeat([]byte("media"), 1000)
+	require.NoError(t, c.Put(ctx, storage, "a/b", bytes.NewReader(plain), int64(len(plain))))
+	stored, err := storage.GetObject("a/b")
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(stored, []byte("media")))
+
+	r, err := c.Get(ctx, storage, "a/b")
+	require.NoError(t, err)
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, plain, got)
+
+	assert.Error(t, c.Put(ctx, storage, "a/c", bytes.NewReader(plain), int64(len(plain))+1))
+	_, err = c.Get(ctx, storage, "missing")
+	assert.Error(t, err)
+}
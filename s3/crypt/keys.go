@@ -0,0 +1,117 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// dataKeySize is the size of the AES-256 key generated per object.
+const dataKeySize = 32
+
+// KeyProvider wraps the data key of every object with a master key.
+type KeyProvider interface {
+	// WrapKey encrypts a new data key with the current master key and
+	// returns the master key ID stored in the object header.
+	WrapKey(ctx context.Context, key []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the master key keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeys wraps data keys with AES-GCM under local master keys of 16, 24
+// or 32 bytes. New objects use the key current; the others still decrypt
+// older objects after a rotation.
+func StaticKeys(current string, keys map[string][]byte) (KeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errs.ErrArgs.WrapMsg("current master key missing", "keyID", current)
+	}
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for id, key := range keys {
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, errs.ErrArgs.WrapMsg("invalid master key", "keyID", id, "size", len(key))
+		}
+		aeads[id] = aead
+	}
+	return &staticKeys{current: current, aeads: aeads}, nil
+}
+
+type staticKeys struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+func (s *staticKeys) WrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	aead := s.aeads[s.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(key)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, errs.WrapMsg(err, "generate nonce failed")
+	}
+	return s.current, aead.Seal(nonce, nonce, key, []byte(s.current)), nil
+}
+
+func (s *staticKeys) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.aeads[keyID]
+	if !ok {
+		return nil, ErrUnknownKey.WrapMsg("unknown master key", "keyID", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecrypt.WrapMsg("wrapped key too short", "keyID", keyID)
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrDecrypt.WrapMsg("unwrap data key failed", "keyID", keyID)
+	}
+	return key, nil
+}
+
+// KMS wraps data keys with a key management service through callbacks,
+// e.g. the Encrypt and Decrypt calls of a cloud KMS. KeyID is the master
+// key used for new objects.
+type KMS struct {
+	KeyID   string
+	Encrypt func(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt func(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+func (k *KMS) WrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	wrapped, err := k.Encrypt(ctx, k.KeyID, key)
+	if err != nil {
+		return "", nil, errs.WrapMsg(err, "kms encrypt failed", "keyID", k.KeyID)
+	}
+	return k.KeyID, wrapped, nil
+}
+
+func (k *KMS) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, err := k.Decrypt(ctx, keyID, wrapped)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "kms decrypt failed", "keyID", keyID)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,115 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crypt
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+// signExpire is the validity of the presigned URLs used by Put and Get.
+const signExpire = 15 * time.Minute
+
+// Put encrypts size bytes read from r and uploads them to name through a
+// presigned URL, streaming without buffering the object.
+func (c *Crypter) Put(ctx context.Context, storage s3.Interface, name string, r io.Reader, size int64) error {
+	h, aead, err := c.newHeader(ctx)
+	if err != nil {
+		return err
+	}
+	const contentType = "application/octet-stream"
+	sign, err := storage.PresignedPutObject(ctx, name, signExpire, &s3.PutOption{ContentType: contentType})
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := newWriter(pw, h, aead)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		n, err := io.Copy(w, io.LimitReader(r, size))
+		if err == nil && n != size {
+			err = errs.ErrArgs.WrapMsg("object shorter than its size", "name", name, "size", size, "read", n)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	defer pr.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sign.URL, pr)
+	if err != nil {
+		return errs.WrapMsg(err, "create encrypted upload request failed")
+	}
+	req.ContentLength = h.size(size, aead.Overhead())
+	for k, v := range sign.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.conf.Client.Do(req)
+	if err != nil {
+		return errs.WrapMsg(err, "upload encrypted object failed", "name", name)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return errs.New("upload encrypted object failed", "name", name, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	return nil
+}
+
+// Get downloads name through an access URL and returns its decrypted
+// content. Read errors other than io.EOF mean the content is incomplete
+// or was modified.
+func (c *Crypter) Get(ctx context.Context, storage s3.Interface, name string) (io.ReadCloser, error) {
+	rawURL, err := storage.AccessURL(ctx, name, signExpire, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "create encrypted download request failed")
+	}
+	resp, err := c.conf.Client.Do(req)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "download encrypted object failed", "name", name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, errs.ErrRecordNotFound.WrapMsg("encrypted object not found", "name", name)
+		}
+		return nil, errs.New("download encrypted object failed", "name", name, "status", resp.StatusCode, "body", string(body)).Wrap()
+	}
+	r, err := c.Decrypt(ctx, resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return readCloser{Reader: r, Closer: resp.Body}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
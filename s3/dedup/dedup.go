@@ -0,0 +1,215 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dedup stores each distinct content once. Uploads are hashed
+// while they are stored, a hash index maps the content to the object
+// holding it and counts its references, and the object is deleted when
+// the last reference is released.
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/utils/idutil"
+)
+
+// signExpire is the validity of the presigned URL used by Put.
+const signExpire = 15 * time.Minute
+
+// Config configures a Deduper.
+type Config struct {
+	// Prefix is where deduplicated objects are stored,
+	// "openim/dedup/" when empty.
+	Prefix string
+	// TempPrefix is where uploads are staged while hashed,
+	// "openim/temp/dedup/" when empty.
+	TempPrefix string
+	// Client uploads to presigned URLs, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Ref references a deduplicated object.
+type Ref struct {
+	Hash string `json:"hash"`
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// Duplicate reports whether the content was already stored.
+	Duplicate bool `json:"duplicate"`
+}
+
+// Deduper stores content through an s3.Interface once per hash.
+type Deduper struct {
+	storage s3.Interface
+	index   Index
+	conf    Config
+}
+
+func New(storage s3.Interface, index Index, conf Config) *Deduper {
+	if conf.Prefix == "" {
+		conf.Prefix = "openim/dedup/"
+	}
+	if conf.TempPrefix == "" {
+		conf.TempPrefix = "openim/temp/dedup/"
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	return &Deduper{storage: storage, index: index, conf: conf}
+}
+
+// Put uploads size bytes read from r, hashing them with SHA-256 on the
+// way. When the content is already stored the upload is discarded and
+// the existing object is referenced instead. Every successful Put must be
+// balanced by a Release of the returned hash.
+func (d *Deduper) Put(ctx context.Context, r io.Reader, size int64, contentType string) (*Ref, error) {
+	temp := d.conf.TempPrefix + idutil.UUIDv7()
+	defer func() {
+		if err := d.storage.DeleteObject(context.WithoutCancel(ctx), temp); err != nil {
+			log.ZWarn(ctx, "delete dedup temp object failed", err, "key", temp)
+		}
+	}()
+	sum, err := d.upload(ctx, temp, r, size, contentType)
+	if err != nil {
+		return nil, err
+	}
+	hash := "sha256:" + sum
+	// Every stored generation of a content gets its own key, so releasing
+	// the last reference never deletes an object a concurrent Put created.
+	key := d.conf.Prefix + sum + "-" + idutil.UUIDv7()
+	entry, created, err := d.index.Acquire(ctx, hash, key, size)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		return &Ref{Hash: hash, Key: entry.Key, Size: entry.Size, Duplicate: true}, nil
+	}
+	if _, err := d.storage.CopyObject(ctx, temp, key); err != nil {
+		d.abandon(ctx, hash, key)
+		return nil, err
+	}
+	return &Ref{Hash: hash, Key: key, Size: size}, nil
+}
+
+// Adopt registers name, stored outside of Put, as holding the content of
+// hash. When the content is already stored elsewhere name is deleted and
+// the existing object is referenced instead.
+func (d *Deduper) Adopt(ctx context.Context, hash string, name string, size int64) (*Ref, error) {
+	entry, created, err := d.index.Acquire(ctx, hash, name, size)
+	if err != nil {
+		return nil, err
+	}
+	if created || entry.Key == name {
+		return &Ref{Hash: hash, Key: entry.Key, Size: entry.Size, Duplicate: !created}, nil
+	}
+	if err := d.storage.DeleteObject(ctx, name); err != nil {
+		log.ZWarn(ctx, "delete duplicate object failed", err, "key", name, "hash", hash)
+	}
+	return &Ref{Hash: hash, Key: entry.Key, Size: entry.Size, Duplicate: true}, nil
+}
+
+// Lookup returns the stored object of hash, errs.ErrRecordNotFound if
+// there is none.
+func (d *Deduper) Lookup(ctx context.Context, hash string) (*Ref, error) {
+	entry, err := d.index.Lookup(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &Ref{Hash: hash, Key: entry.Key, Size: entry.Size, Duplicate: true}, nil
+}
+
+// Release drops a reference to hash and deletes the object with the last
+// one. It reports whether the object was deleted.
+func (d *Deduper) Release(ctx context.Context, hash string) (bool, error) {
+	entry, last, err := d.index.Release(ctx, hash)
+	if err != nil {
+		return false, err
+	}
+	if !last {
+		return false, nil
+	}
+	if err := d.storage.DeleteObject(ctx, entry.Key); err != nil && !d.storage.IsNotFound(err) {
+		// The entry stays unreferenced and is replaced by the next upload,
+		// the object is left for the storage lifecycle rules.
+		return false, err
+	}
+	if err := d.index.Remove(ctx, hash, entry.Key); err != nil {
+		log.ZWarn(ctx, "remove dedup entry failed", err, "hash", hash)
+	}
+	return true, nil
+}
+
+// abandon undoes an Acquire whose object could not be stored.
+func (d *Deduper) abandon(ctx context.Context, hash string, key string) {
+	ctx = context.WithoutCancel(ctx)
+	if _, _, err := d.index.Release(ctx, hash); err != nil {
+		log.ZWarn(ctx, "release dedup entry failed", err, "hash", hash)
+		return
+	}
+	if err := d.index.Remove(ctx, hash, key); err != nil {
+		log.ZWarn(ctx, "remove dedup entry failed", err, "hash", hash)
+	}
+}
+
+// upload streams size bytes of r to name and returns their hex SHA-256.
+func (d *Deduper) upload(ctx context.Context, name string, r io.Reader, size int64, contentType string) (string, error) {
+	sign, err := d.storage.PresignedPutObject(ctx, name, signExpire, &s3.PutOption{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	body := &countReader{r: io.TeeReader(io.LimitReader(r, size), h)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sign.URL, body)
+	if err != nil {
+		return "", errs.WrapMsg(err, "create dedup upload request failed")
+	}
+	req.ContentLength = size
+	for k, v := range sign.Header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := d.conf.Client.Do(req)
+	if err != nil {
+		return "", errs.WrapMsg(err, "upload dedup object failed", "name", name)
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return "", errs.New("upload dedup object failed", "name", name, "status", resp.StatusCode, "body", string(msg)).Wrap()
+	}
+	if body.n != size {
+		return "", errs.ErrArgs.WrapMsg("object shorter than its size", "name", name, "size", size, "read", body.n)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,127 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3/dedup"
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStorage(t *testing.T) *mock.Storage {
+	storage := mock.NewStorage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			// TestPutShort aborts the body on purpose.
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		storage.PutObject(strings.TrimPrefix(r.URL.Path, "/"), data, r.Header.Get("Content-Type"))
+	}))
+	t.Cleanup(srv.Close)
+	storage.BaseURL = srv.URL
+	return storage
+}
+
+func TestPut(t *testing.T) {
+	ctx := context.Background()
+	storage := newStorage(t)
+	d := dedup.New(storage, dedup.NewMemoryIndex(), dedup.Config{})
+
+	data := []byte("the same content")
+	first, err := d.Put(ctx, bytes.NewReader(data), int64(len(data)), "text/plain")
+	require.NoError(t, err)
+	assert.False(t, first.Duplicate)
+	assert.True(t, strings.HasPrefix(first.Hash, "sha256:"))
+	second, err := d.Put(ctx, bytes.NewReader(data), int64(len(data)), "text/plain")
+	require.NoError(t, err)
+	assert.True(t, second.Duplicate)
+	assert.Equal(t, first.Key, second.Key)
+	other, err := d.Put(ctx, strings.NewReader("other"), 5, "text/plain")
+	require.NoError(t, err)
+	assert.NotEqual(t, first.Hash, other.Hash)
+	assert.ElementsMatch(t, []string{first.Key, other.Key}, storage.Names())
+
+	stored, err := storage.GetObject(first.Key)
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+
+	deleted, err := d.Release(ctx, first.Hash)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	deleted, err = d.Release(ctx, first.Hash)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Equal(t, []string{other.Key}, storage.Names())
+	_, err = d.Lookup(ctx, first.Hash)
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	_, err = d.Release(ctx, first.Hash)
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+
+	// Stored again after the last release, under a new key.
+	again, err := d.Put(ctx, bytes.NewReader(data), int64(len(data)), "text/plain")
+	require.NoError(t, err)
+	assert.False(t, again.Duplicate)
+	assert.NotEqual(t, first.Key, again.Key)
+}
+
+func TestPutShort(t *testing.T) {
+	ctx := context.Background()
+	storage := newStorage(t)
+	d := dedup.New(storage, dedup.NewMemoryIndex(), dedup.Config{})
+	_, err := d.Put(ctx, strings.NewReader("short"), 10, "")
+	assert.Error(t, err)
+	assert.Empty(t, storage.Names())
+}
+
+func TestAdopt(t *testing.T) {
+	ctx := context.Background()
+	storage := newStorage(t)
+	d := dedup.New(storage, dedup.NewMemoryIndex(), dedup.Config{})
+	storage.PutObject("a", []byte("x"), "")
+	storage.PutObject("b", []byte("x"), "")
+
+	ref, err := d.Adopt(ctx, "h", "a", 1)
+	require.NoError(t, err)
+	assert.False(t, ref.Duplicate)
+	ref, err = d.Adopt(ctx, "h", "a", 1)
+	require.NoError(t, err)
+	assert.True(t, ref.Duplicate)
+	ref, err = d.Adopt(ctx, "h", "b", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "a", ref.Key)
+	assert.Equal(t, []string{"a"}, storage.Names())
+
+	for i := 0; i < 2; i++ {
+		deleted, err := d.Release(ctx, "h")
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	}
+	deleted, err := d.Release(ctx, "h")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Empty(t, storage.Names())
+}
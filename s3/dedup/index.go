@@ -0,0 +1,225 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+// Entry maps a content hash to the object holding the content.
+type Entry struct {
+	Hash string `bson:"_id"`
+	Key  string `bson:"key"`
+	Size int64  `bson:"size"`
+	Refs int64  `bson:"refs"`
+}
+
+// Index counts references per content hash. An entry whose references
+// dropped to zero is being deleted: Acquire replaces it with a new one.
+type Index interface {
+	// Acquire adds a reference to hash. Without a referenced entry it
+	// creates one for key and size and reports created.
+	Acquire(ctx context.Context, hash string, key string, size int64) (entry *Entry, created bool, err error)
+	// Release removes a reference and reports whether it was the last.
+	// It returns errs.ErrRecordNotFound for unreferenced hashes.
+	Release(ctx context.Context, hash string) (entry *Entry, last bool, err error)
+	// Remove deletes the entry of hash if it still maps to key and is not
+	// referenced.
+	Remove(ctx context.Context, hash string, key string) error
+	// Lookup returns the referenced entry of hash, errs.ErrRecordNotFound
+	// if there is none.
+	Lookup(ctx context.Context, hash string) (*Entry, error)
+}
+
+// NewRedisIndex keeps entries as hashes under prefix, "S3DEDUP:" when
+// empty.
+func NewRedisIndex(rdb redis.UniversalClient, prefix string) Index {
+	if prefix == "" {
+		prefix = "S3DEDUP:"
+	}
+	return &redisIndex{rdb: rdb, prefix: prefix}
+}
+
+type redisIndex struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+// acquireScript adds a reference or replaces an unreferenced entry.
+// KEYS[1] entry, ARGV[1] key, ARGV[2] size. Returns {created, key, size, refs}.
+var acquireScript = redis.NewScript(`
+local refs = tonumber(redis.call('HGET', KEYS[1], 'refs') or '0')
+if refs > 0 then
+	refs = redis.call('HINCRBY', KEYS[1], 'refs', 1)
+	local entry = redis.call('HMGET', KEYS[1], 'key', 'size')
+	return {0, entry[1], entry[2], refs}
+end
+redis.call('HSET', KEYS[1], 'key', ARGV[1], 'size', ARGV[2], 'refs', 1)
+return {1, ARGV[1], ARGV[2], 1}
+`)
+
+// releaseScript removes a reference. KEYS[1] entry. Returns {} for
+// unreferenced entries, else {key, size, refs}.
+var releaseScript = redis.NewScript(`
+local refs = tonumber(redis.call('HGET', KEYS[1], 'refs') or '0')
+if refs <= 0 then
+	return {}
+end
+refs = redis.call('HINCRBY', KEYS[1], 'refs', -1)
+local entry = redis.call('HMGET', KEYS[1], 'key', 'size')
+return {entry[1], entry[2], refs}
+`)
+
+// removeScript deletes an unreferenced entry of a key. KEYS[1] entry,
+// ARGV[1] key.
+var removeScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'key') == ARGV[1] and tonumber(redis.call('HGET', KEYS[1], 'refs') or '0') <= 0 then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+func (r *redisIndex) Acquire(ctx context.Context, hash string, key string, size int64) (*Entry, bool, error) {
+	res, err := acquireScript.Run(ctx, r.rdb, []string{r.prefix + hash}, key, size).Slice()
+	if err != nil {
+		return nil, false, errs.WrapMsg(err, "acquire dedup entry failed", "hash", hash)
+	}
+	entry, err := parseEntry(hash, res[1:])
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, res[0].(int64) == 1, nil
+}
+
+func (r *redisIndex) Release(ctx context.Context, hash string) (*Entry, bool, error) {
+	res, err := releaseScript.Run(ctx, r.rdb, []string{r.prefix + hash}).Slice()
+	if err != nil {
+		return nil, false, errs.WrapMsg(err, "release dedup entry failed", "hash", hash)
+	}
+	if len(res) == 0 {
+		return nil, false, errs.ErrRecordNotFound.WrapMsg("dedup entry not referenced", "hash", hash)
+	}
+	entry, err := parseEntry(hash, res)
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, entry.Refs == 0, nil
+}
+
+func (r *redisIndex) Remove(ctx context.Context, hash string, key string) error {
+	if err := removeScript.Run(ctx, r.rdb, []string{r.prefix + hash}, key).Err(); err != nil {
+		return errs.WrapMsg(err, "remove dedup entry failed", "hash", hash)
+	}
+	return nil
+}
+
+func (r *redisIndex) Lookup(ctx context.Context, hash string) (*Entry, error) {
+	res, err := r.rdb.HMGet(ctx, r.prefix+hash, "key", "size", "refs").Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "lookup dedup entry failed", "hash", hash)
+	}
+	if res[0] == nil {
+		return nil, errs.ErrRecordNotFound.WrapMsg("dedup entry not found", "hash", hash)
+	}
+	entry, err := parseEntry(hash, res)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Refs <= 0 {
+		return nil, errs.ErrRecordNotFound.WrapMsg("dedup entry not referenced", "hash", hash)
+	}
+	return entry, nil
+}
+
+// parseEntry parses {key, size, refs} as returned by the scripts and HMGET.
+func parseEntry(hash string, res []any) (*Entry, error) {
+	fields := make([]int64, 2)
+	for i, v := range res[1:3] {
+		switch v := v.(type) {
+		case int64:
+			fields[i] = v
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errs.WrapMsg(err, "invalid dedup entry", "hash", hash)
+			}
+			fields[i] = n
+		}
+	}
+	key, _ := res[0].(string)
+	return &Entry{Hash: hash, Key: key, Size: fields[0], Refs: fields[1]}, nil
+}
+
+// NewMemoryIndex keeps entries in memory, for tests and single instance
+// deployments.
+func NewMemoryIndex() Index {
+	return &memoryIndex{entries: make(map[string]*Entry)}
+}
+
+type memoryIndex struct {
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+func (m *memoryIndex) Acquire(ctx context.Context, hash string, key string, size int64) (*Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[hash]; ok && e.Refs > 0 {
+		e.Refs++
+		res := *e
+		return &res, false, nil
+	}
+	e := &Entry{Hash: hash, Key: key, Size: size, Refs: 1}
+	m.entries[hash] = e
+	res := *e
+	return &res, true, nil
+}
+
+func (m *memoryIndex) Release(ctx context.Context, hash string) (*Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[hash]
+	if !ok || e.Refs <= 0 {
+		return nil, false, errs.ErrRecordNotFound.WrapMsg("dedup entry not referenced", "hash", hash)
+	}
+	e.Refs--
+	res := *e
+	return &res, e.Refs == 0, nil
+}
+
+func (m *memoryIndex) Remove(ctx context.Context, hash string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.entries[hash]; ok && e.Key == key && e.Refs <= 0 {
+		delete(m.entries, hash)
+	}
+	return nil
+}
+
+func (m *memoryIndex) Lookup(ctx context.Context, hash string) (*Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[hash]
+	if !ok || e.Refs <= 0 {
+		return nil, errs.ErrRecordNotFound.WrapMsg("dedup entry not found", "hash", hash)
+	}
+	res := *e
+	return &res, nil
+}
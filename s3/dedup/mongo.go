@@ -0,0 +1,88 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedup
+
+import (
+	"context"
+	"errors"
+
+	"github.com/openimsdk/tools/db/mongoutil"
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoIndex keeps entries as documents keyed by hash in coll.
+func NewMongoIndex(coll *mongo.Collection) Index {
+	return &mongoIndex{coll: coll}
+}
+
+type mongoIndex struct {
+	coll *mongo.Collection
+}
+
+func (m *mongoIndex) Acquire(ctx context.Context, hash string, key string, size int64) (*Entry, bool, error) {
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for {
+		entry, err := mongoutil.FindOneAndUpdate[*Entry](ctx, m.coll,
+			bson.M{"_id": hash, "refs": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"refs": 1}}, after)
+		if err == nil {
+			return entry, false, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, false, err
+		}
+		// No referenced entry: take over an unreferenced one or insert. A
+		// concurrent insert fails the upsert with a duplicate key, retry.
+		entry, err = mongoutil.FindOneAndUpdate[*Entry](ctx, m.coll,
+			bson.M{"_id": hash, "refs": bson.M{"$lte": 0}},
+			bson.M{"$set": bson.M{"key": key, "size": size, "refs": 1}}, after.SetUpsert(true))
+		if err == nil {
+			return entry, true, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, false, err
+		}
+	}
+}
+
+func (m *mongoIndex) Release(ctx context.Context, hash string) (*Entry, bool, error) {
+	after := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	entry, err := mongoutil.FindOneAndUpdate[*Entry](ctx, m.coll,
+		bson.M{"_id": hash, "refs": bson.M{"$gt": 0}}, bson.M{"$inc": bson.M{"refs": -1}}, after)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, false, errs.ErrRecordNotFound.WrapMsg("dedup entry not referenced", "hash", hash)
+		}
+		return nil, false, err
+	}
+	return entry, entry.Refs == 0, nil
+}
+
+func (m *mongoIndex) Remove(ctx context.Context, hash string, key string) error {
+	return mongoutil.DeleteOne(ctx, m.coll, bson.M{"_id": hash, "key": key, "refs": bson.M{"$lte": 0}})
+}
+
+func (m *mongoIndex) Lookup(ctx context.Context, hash string) (*Entry, error) {
+	entry, err := mongoutil.FindOne[*Entry](ctx, m.coll, bson.M{"_id": hash, "refs": bson.M{"$gt": 0}})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errs.ErrRecordNotFound.WrapMsg("dedup entry not found", "hash", hash)
+		}
+		return nil, err
+	}
+	return entry, nil
+}
@@ -0,0 +1,362 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrChecksumMismatch is returned by Download when the downloaded content
+// does not match the expected checksum.
+var ErrChecksumMismatch = errs.New("download checksum mismatch")
+
+// DownloadOptions configures Download. The zero value is usable.
+type DownloadOptions struct {
+	// PartSize is the size of the ranges fetched, 8MiB when zero.
+	PartSize int64
+	// Concurrency is the number of ranges fetched in parallel, 4 when zero.
+	Concurrency int
+	// Retries is the number of attempts per range after a transient
+	// failure, 5 when zero. A retried range resumes after the bytes it
+	// already received.
+	Retries int
+	// Backoff is the delay before the first retry, doubled per attempt up
+	// to 30s, 500ms when zero.
+	Backoff time.Duration
+	// Expire is the validity of the access URL, 1h when zero. The URL is
+	// signed again when a range is rejected with 403.
+	Expire time.Duration
+	// MD5 and SHA256 are the expected hex checksums of the object. When
+	// both are empty and VerifyETag is set, an ETag that is a plain MD5 is
+	// checked instead.
+	MD5        string
+	SHA256     string
+	VerifyETag bool
+	// Progress is called with the bytes downloaded so far and the object
+	// size, never concurrently.
+	Progress func(downloaded int64, total int64)
+	// Client fetches the ranges, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Download writes the object key of storage to w, fetching ranges of it in
+// parallel through its access URL. The object is pinned by its ETag, so a
+// concurrent overwrite fails the download instead of mixing contents.
+func Download(ctx context.Context, storage Interface, key string, w io.WriterAt, opts *DownloadOptions) (*ObjectInfo, error) {
+	var o DownloadOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = 8 * 1024 * 1024
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.Retries <= 0 {
+		o.Retries = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 500 * time.Millisecond
+	}
+	if o.Expire <= 0 {
+		o.Expire = time.Hour
+	}
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+	info, err := storage.StatObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	d := &downloader{storage: storage, key: key, w: w, opts: &o, info: info}
+	if err := d.run(ctx); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+type downloader struct {
+	storage Interface
+	key     string
+	w       io.WriterAt
+	opts    *DownloadOptions
+	info    *ObjectInfo
+
+	mu         sync.Mutex
+	url        string
+	signed     time.Time
+	downloaded int64
+
+	// hash consumes the parts in order; parts completed ahead of it wait in
+	// pending. tokens bounds the parts held in memory.
+	hash    hash.Hash
+	want    string
+	next    int
+	pending map[int][]byte
+	tokens  chan struct{}
+}
+
+func (d *downloader) run(ctx context.Context) error {
+	d.checksum()
+	size := d.info.Size
+	parts := int((size + d.opts.PartSize - 1) / d.opts.PartSize)
+	d.pending = make(map[int][]byte)
+	d.tokens = make(chan struct{}, 2*d.opts.Concurrency)
+	d.report(0)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+		index    = make(chan int)
+	)
+	for i := 0; i < min(d.opts.Concurrency, parts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range index {
+				if err := d.part(ctx, n); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+feed:
+	for n := 0; n < parts; n++ {
+		// Parts are handed out in order, so the part the hash waits for
+		// always holds a token and the wait cannot deadlock.
+		select {
+		case d.tokens <- struct{}{}:
+		case <-ctx.Done():
+			break feed
+		}
+		select {
+		case index <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(index)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return errs.WrapMsg(err, "download canceled", "key", d.key)
+	}
+	if d.hash != nil {
+		if sum := hex.EncodeToString(d.hash.Sum(nil)); sum != d.want {
+			return ErrChecksumMismatch.WrapMsg("checksum mismatch", "key", d.key, "want", d.want, "got", sum)
+		}
+	}
+	return nil
+}
+
+// checksum picks the checksum to verify, if any.
+func (d *downloader) checksum() {
+	switch {
+	case d.opts.SHA256 != "":
+		d.hash, d.want = sha256.New(), strings.ToLower(d.opts.SHA256)
+	case d.opts.MD5 != "":
+		d.hash, d.want = md5.New(), strings.ToLower(d.opts.MD5)
+	case d.opts.VerifyETag:
+		etag := strings.ToLower(strings.Trim(d.info.ETag, `"`))
+		if b, err := hex.DecodeString(etag); err == nil && len(b) == md5.Size {
+			d.hash, d.want = md5.New(), etag
+		}
+	}
+}
+
+// part fetches part n, retrying transient failures from the last byte
+// received, and writes it to w.
+func (d *downloader) part(ctx context.Context, n int) error {
+	start := int64(n) * d.opts.PartSize
+	end := min(start+d.opts.PartSize, d.info.Size)
+	buf := make([]byte, 0, end-start)
+	backoff := d.opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := d.fetch(ctx, start+int64(len(buf)), end, &buf)
+		if err == nil {
+			break
+		}
+		// A changed object is retryable for the caller, but every range is pinned
+		// to the old ETag and would fail again.
+		if !errs.IsTemporary(err) || attempt >= d.opts.Retries || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+	if _, err := d.w.WriteAt(buf, start); err != nil {
+		return errs.WrapMsg(err, "write download part failed", "key", d.key, "offset", start)
+	}
+	d.done(n, buf)
+	return nil
+}
+
+// fetch appends the bytes [start, end) of the object to buf.
+func (d *downloader) fetch(ctx context.Context, start int64, end int64, buf *[]byte) error {
+	if start >= end {
+		return nil
+	}
+	url, err := d.accessURL(ctx, false)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return errs.WrapMsg(err, "create download request failed", "key", d.key)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	if d.info.ETag != "" {
+		req.Header.Set("If-Match", quoteETag(d.info.ETag))
+	}
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return errs.WrapMsg(err, "download canceled", "key", d.key)
+		}
+		return errs.WrapMsg(err, "download request failed", "key", d.key)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusOK && start == 0 && end == d.info.Size:
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return errs.ErrConcurrentModification.WrapMsg("object changed during download", "key", d.key)
+	case resp.StatusCode == http.StatusForbidden:
+		// Most likely the URL expired, sign it again before retrying.
+		if _, err := d.accessURL(ctx, true); err != nil {
+			return err
+		}
+		return statusError(d.key, resp.StatusCode, codes.Aborted)
+	case resp.StatusCode == http.StatusOK:
+		return errs.New("range requests not supported", "key", d.key).Wrap()
+	default:
+		code := codes.FailedPrecondition
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusGatewayTimeout:
+			code = codes.DeadlineExceeded
+		case resp.StatusCode >= 500:
+			code = codes.Unavailable
+		}
+		return statusError(d.key, resp.StatusCode, code)
+	}
+	remaining := end - start
+	for remaining > 0 {
+		chunk := (*buf)[len(*buf):min(int64(len(*buf))+remaining, int64(cap(*buf)))]
+		m, err := resp.Body.Read(chunk)
+		*buf = (*buf)[:len(*buf)+m]
+		remaining -= int64(m)
+		d.report(int64(m))
+		if err == io.EOF && remaining > 0 {
+			return errs.WrapMsg(io.ErrUnexpectedEOF, "download part truncated", "key", d.key, "remaining", remaining)
+		}
+		if err != nil && err != io.EOF {
+			if ctx.Err() != nil {
+				return errs.WrapMsg(err, "download canceled", "key", d.key)
+			}
+			return errs.WrapMsg(err, "read download part failed", "key", d.key)
+		}
+	}
+	return nil
+}
+
+// statusError reports an unexpected HTTP status with the gRPC code whose
+// errs.RetryClass decides whether the range is fetched again.
+func statusError(key string, status int, code codes.Code) error {
+	return errs.NewCodeError(int(code), "download failed").WithDetail(fmt.Sprintf("key=%s status=%d", key, status)).Wrap()
+}
+
+// accessURL returns the cached access URL, signing a new one when renew is
+// set or half of its validity has passed.
+func (d *downloader) accessURL(ctx context.Context, renew bool) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.url != "" && !renew && time.Since(d.signed) < d.opts.Expire/2 {
+		return d.url, nil
+	}
+	url, err := d.storage.AccessURL(ctx, d.key, d.opts.Expire, nil)
+	if err != nil {
+		return "", err
+	}
+	d.url, d.signed = url, time.Now()
+	return url, nil
+}
+
+// report adds n downloaded bytes to the progress.
+func (d *downloader) report(n int64) {
+	if d.opts.Progress == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downloaded += n
+	d.opts.Progress(d.downloaded, d.info.Size)
+}
+
+// done hands part n to the hash and releases the tokens of the parts
+// consumed.
+func (d *downloader) done(n int, buf []byte) {
+	if d.hash == nil {
+		<-d.tokens
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.pending[n] = buf
+	for {
+		buf, ok := d.pending[d.next]
+		if !ok {
+			return
+		}
+		d.hash.Write(buf)
+		delete(d.pending, d.next)
+		d.next++
+		<-d.tokens
+	}
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return `"` + etag + `"`
+}
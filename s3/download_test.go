@@ -0,0 +1,166 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type buffer struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (b *buffer) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n := off + int64(len(p)); n > int64(len(b.data)) {
+		b.data = append(b.data, make([]byte, n-int64(len(b.data)))...)
+	}
+	copy(b.data[off:], p)
+	return len(p), nil
+}
+
+// serve serves the objects of storage with range support. fault may
+// break a response and reports whether it did.
+func serve(t *testing.T, storage *mock.Storage, fault func(w http.ResponseWriter, r *http.Request, data []byte) bool) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		data, err := storage.GetObject(name)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if fault != nil && fault(w, r, data) {
+			return
+		}
+		info, err := storage.StatObject(r.Context(), name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", `"`+info.ETag+`"`)
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	storage.BaseURL = srv.URL
+}
+
+func random(t *testing.T, n int) []byte {
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	return data
+}
+
+func TestDownload(t *testing.T) {
+	storage := mock.NewStorage()
+	data := random(t, 100_000)
+	storage.PutObject("big", data, "")
+	var requests atomic.Int64
+	serve(t, storage, func(w http.ResponseWriter, r *http.Request, data []byte) bool {
+		switch requests.Add(1) % 4 {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		case 2:
+			// Truncate the response, the part resumes after it.
+			var start int
+			if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return true
+			}
+			w.Header().Set("Content-Length", "4096")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(data[start:min(start+1000, len(data))])
+			return true
+		}
+		return false
+	})
+	sum := sha256.Sum256(data)
+	var last, total int64
+	var out buffer
+	info, err := s3.Download(context.Background(), storage, "big", &out, &s3.DownloadOptions{
+		PartSize:    4096,
+		Concurrency: 3,
+		Backoff:     time.Millisecond,
+		SHA256:      hex.EncodeToString(sum[:]),
+		Progress: func(downloaded int64, size int64) {
+			assert.GreaterOrEqual(t, downloaded, last)
+			last, total = downloaded, size
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size)
+	assert.Equal(t, data, out.data)
+	assert.Equal(t, int64(len(data)), last)
+	assert.Equal(t, int64(len(data)), total)
+}
+
+func TestDownloadChecksum(t *testing.T) {
+	storage := mock.NewStorage()
+	storage.PutObject("a", random(t, 10_000), "")
+	serve(t, storage, nil)
+	ctx := context.Background()
+
+	_, err := s3.Download(ctx, storage, "a", &buffer{}, &s3.DownloadOptions{PartSize: 1000, VerifyETag: true})
+	assert.NoError(t, err)
+	_, err = s3.Download(ctx, storage, "a", &buffer{}, &s3.DownloadOptions{PartSize: 1000, MD5: strings.Repeat("0", 32)})
+	assert.True(t, s3.ErrChecksumMismatch.Is(err))
+}
+
+func TestDownloadChanged(t *testing.T) {
+	storage := mock.NewStorage()
+	storage.PutObject("a", random(t, 10_000), "")
+	var once sync.Once
+	serve(t, storage, func(w http.ResponseWriter, r *http.Request, data []byte) bool {
+		once.Do(func() { storage.PutObject("a", random(t, 10_000), "") })
+		return false
+	})
+	_, err := s3.Download(context.Background(), storage, "a", &buffer{}, &s3.DownloadOptions{PartSize: 1000})
+	assert.True(t, errs.ErrConcurrentModification.Is(err))
+}
+
+func TestDownloadPermanent(t *testing.T) {
+	storage := mock.NewStorage()
+	storage.PutObject("a", random(t, 10_000), "")
+	var requests atomic.Int64
+	serve(t, storage, func(w http.ResponseWriter, r *http.Request, data []byte) bool {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		return true
+	})
+	_, err := s3.Download(context.Background(), storage, "a", &buffer{}, &s3.DownloadOptions{PartSize: 20_000, Backoff: time.Millisecond})
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), requests.Load())
+}
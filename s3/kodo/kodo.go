@@ -36,6 +36,7 @@ import (
 	awss3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/openimsdk/tools/errs"
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/throttle"
 	"github.com/qiniu/go-sdk/v7/auth"
 )
 
@@ -55,6 +56,8 @@ type Config struct {
 	AccessKeySecret string
 	SessionToken    string
 	PublicRead      bool
+	// Throttle limits the bandwidth of transfers made by the server.
+	Throttle *throttle.Throttle
 }
 
 type Kodo struct {
@@ -71,7 +74,7 @@ type Kodo struct {
 
 func NewKodo(conf Config) (*Kodo, error) {
 	//init client
-	cfg, err := awss3config.LoadDefaultConfig(context.TODO(),
+	opts := []func(*awss3config.LoadOptions) error{
 		awss3config.WithRegion(conf.Bucket),
 		awss3config.WithEndpointResolverWithOptions(
 			aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
@@ -82,7 +85,11 @@ func NewKodo(conf Config) (*Kodo, error) {
 			conf.AccessKeySecret,
 			conf.SessionToken),
 		),
-	)
+	}
+	if conf.Throttle != nil {
+		opts = append(opts, awss3config.WithHTTPClient(&http.Client{Transport: conf.Throttle.Transport(nil)}))
+	}
+	cfg, err := awss3config.LoadDefaultConfig(context.TODO(), opts...)
 	if err != nil {
 		return nil, err
 	}
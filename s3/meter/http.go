@@ -0,0 +1,61 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+)
+
+// Report is the usage of a bucket as served to admin dashboards.
+type Report struct {
+	Total    *Usage   `json:"total"`
+	Prefixes []*Usage `json:"prefixes"`
+}
+
+// Handler serves the Report of m in the apiresp envelope.
+func Handler(m *Meter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report, err := m.report(r.Context())
+		if err != nil {
+			apiresp.HttpError(w, err)
+			return
+		}
+		apiresp.HttpSuccess(w, report)
+	})
+}
+
+// Gin serves the Report of m.
+func Gin(m *Meter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := m.report(c.Request.Context())
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		apiresp.GinSuccess(c, report)
+	}
+}
+
+func (m *Meter) report(ctx context.Context) (*Report, error) {
+	usages, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{Total: m.total(usages), Prefixes: usages}, nil
+}
@@ -0,0 +1,246 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package meter accounts object counts and bytes per prefix of an s3
+// bucket. Counters are maintained incrementally by wrapping the
+// s3.Interface used for uploads, copies and deletes, and corrected by
+// periodic reconciliation scans, which also catch objects written around
+// the wrapper, e.g. with presigned URLs. Usage can feed a cumulative quota
+// limit and admin dashboards.
+package meter
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/quota"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Config configures a Meter.
+type Config struct {
+	// Bucket names the metered bucket in the Store. Required.
+	Bucket string
+	// Prefixes are the metered prefixes; an object counts for the longest
+	// one its name starts with and objects under none are not metered,
+	// e.g. temporary uploads. Without prefixes the whole bucket is metered
+	// under the empty prefix.
+	Prefixes []string
+	// Quota, when set, receives the bytes of every prefix as the usage of
+	// the cumulative QuotaLimit.
+	Quota      *quota.Manager
+	QuotaLimit string
+	// Subject returns the quota subject of a prefix, defaults to the
+	// prefix itself.
+	Subject func(prefix string) string
+	// ReconcileInterval is the interval of Run, defaults to 24 hours.
+	ReconcileInterval time.Duration
+}
+
+// Meter accounts storage usage of a bucket.
+type Meter struct {
+	store Store
+	conf  Config
+}
+
+func New(store Store, conf Config) (*Meter, error) {
+	if conf.Bucket == "" {
+		return nil, errs.ErrArgs.WrapMsg("meter bucket is required")
+	}
+	if conf.Quota != nil && conf.QuotaLimit == "" {
+		return nil, errs.ErrArgs.WrapMsg("meter quota limit is required with a quota manager")
+	}
+	if conf.Subject == nil {
+		conf.Subject = func(prefix string) string { return prefix }
+	}
+	if conf.ReconcileInterval <= 0 {
+		conf.ReconcileInterval = 24 * time.Hour
+	}
+	return &Meter{store: store, conf: conf}, nil
+}
+
+// prefix returns the metered prefix of name.
+func (m *Meter) prefix(name string) (string, bool) {
+	if len(m.conf.Prefixes) == 0 {
+		return "", true
+	}
+	var (
+		best string
+		ok   bool
+	)
+	for _, prefix := range m.conf.Prefixes {
+		if strings.HasPrefix(name, prefix) && (!ok || len(prefix) > len(best)) {
+			best, ok = prefix, true
+		}
+	}
+	return best, ok
+}
+
+// Record changes the usage of the prefix of name by objects and bytes, for
+// changes made without the wrapped s3.Interface. Names that are not
+// metered are ignored.
+func (m *Meter) Record(ctx context.Context, name string, objects int64, bytes int64) error {
+	prefix, ok := m.prefix(name)
+	if !ok || (objects == 0 && bytes == 0) {
+		return nil
+	}
+	usage, err := m.store.Add(ctx, m.conf.Bucket, prefix, objects, bytes)
+	if err != nil {
+		return err
+	}
+	return m.feed(ctx, usage)
+}
+
+func (m *Meter) feed(ctx context.Context, usage *Usage) error {
+	if m.conf.Quota == nil {
+		return nil
+	}
+	return m.conf.Quota.Set(ctx, m.conf.Subject(usage.Prefix), m.conf.QuotaLimit, max(usage.Bytes, 0))
+}
+
+// Usage returns the usage of a metered prefix.
+func (m *Meter) Usage(ctx context.Context, prefix string) (*Usage, error) {
+	usages, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, usage := range usages {
+		if usage.Prefix == prefix {
+			return usage, nil
+		}
+	}
+	return &Usage{Bucket: m.conf.Bucket, Prefix: prefix}, nil
+}
+
+// List returns the usage of every prefix ordered by prefix.
+func (m *Meter) List(ctx context.Context) ([]*Usage, error) {
+	return m.store.List(ctx, m.conf.Bucket)
+}
+
+// Total returns the usage summed over all prefixes. ReconciledAt is the
+// oldest reconciliation.
+func (m *Meter) Total(ctx context.Context) (*Usage, error) {
+	usages, err := m.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return m.total(usages), nil
+}
+
+func (m *Meter) total(usages []*Usage) *Usage {
+	total := &Usage{Bucket: m.conf.Bucket}
+	for i, usage := range usages {
+		total.Objects += usage.Objects
+		total.Bytes += usage.Bytes
+		if i == 0 || usage.ReconciledAt.Before(total.ReconciledAt) {
+			total.ReconciledAt = usage.ReconciledAt
+		}
+	}
+	return total
+}
+
+// Reconcile lists the metered objects and overwrites the counters with the
+// result. Changes recorded while the scan runs may be lost until the next
+// reconciliation.
+func (m *Meter) Reconcile(ctx context.Context, lister s3.Lister) error {
+	start := time.Now()
+	usages := make(map[string]*Usage)
+	roots := []string{""}
+	if len(m.conf.Prefixes) > 0 {
+		roots = roots[:0]
+		for _, prefix := range m.conf.Prefixes {
+			usages[prefix] = &Usage{Bucket: m.conf.Bucket, Prefix: prefix}
+			if !nested(prefix, m.conf.Prefixes) {
+				roots = append(roots, prefix)
+			}
+		}
+	} else {
+		usages[""] = &Usage{Bucket: m.conf.Bucket}
+	}
+	for _, root := range roots {
+		err := lister.ListObjects(ctx, root, func(info *s3.ObjectInfo) error {
+			if prefix, ok := m.prefix(info.Key); ok {
+				usages[prefix].Objects++
+				usages[prefix].Bytes += info.Size
+			}
+			return nil
+		})
+		if err != nil {
+			return errs.WrapMsg(err, "s3 usage reconciliation failed", "bucket", m.conf.Bucket, "prefix", root)
+		}
+	}
+	previous, err := m.List(ctx)
+	if err != nil {
+		return err
+	}
+	drift := make(map[string]*Usage, len(previous))
+	for _, usage := range previous {
+		drift[usage.Prefix] = usage
+	}
+	for _, usage := range sortUsages(usages) {
+		usage.ReconciledAt = start
+		if err := m.store.Set(ctx, usage); err != nil {
+			return err
+		}
+		if old, ok := drift[usage.Prefix]; ok && (old.Objects != usage.Objects || old.Bytes != usage.Bytes) {
+			log.ZWarn(ctx, "s3 usage drift corrected", nil, "bucket", m.conf.Bucket, "prefix", usage.Prefix,
+				"objects", usage.Objects, "objectsDrift", usage.Objects-old.Objects, "bytes", usage.Bytes, "bytesDrift", usage.Bytes-old.Bytes)
+		}
+		if err := m.feed(ctx, usage); err != nil {
+			return err
+		}
+	}
+	log.ZInfo(ctx, "s3 usage reconciled", "bucket", m.conf.Bucket, "prefixes", len(usages), "cost", time.Since(start))
+	return nil
+}
+
+// nested reports whether prefix lies under another of prefixes.
+func nested(prefix string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if p != prefix && strings.HasPrefix(prefix, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run reconciles every ReconcileInterval until ctx is done. Run it on one
+// instance only, e.g. under a leader election.
+func (m *Meter) Run(ctx context.Context, lister s3.Lister) {
+	ticker := time.NewTicker(m.conf.ReconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Reconcile(ctx, lister); err != nil {
+				log.ZError(ctx, "s3 usage reconciliation failed", err, "bucket", m.conf.Bucket)
+			}
+		}
+	}
+}
+
+func sortUsages(usages map[string]*Usage) []*Usage {
+	res := make([]*Usage, 0, len(usages))
+	for _, usage := range usages {
+		res = append(res, usage)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Prefix < res[j].Prefix })
+	return res
+}
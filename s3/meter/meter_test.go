@@ -0,0 +1,84 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrap(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(NewMemoryStore(), Config{Bucket: "openim", Prefixes: []string{"openim/data/", "openim/data/hash/"}})
+	require.NoError(t, err)
+	storage := mock.NewStorage()
+	impl := m.Wrap(storage)
+
+	storage.PutObject("openim/temp/a", make([]byte, 10), "")
+	_, err = impl.CopyObject(ctx, "openim/temp/a", "openim/data/hash/a")
+	require.NoError(t, err)
+	_, err = impl.CopyObject(ctx, "openim/temp/a", "openim/data/b")
+	require.NoError(t, err)
+
+	upload, err := impl.InitiateMultipartUpload(ctx, "openim/data/hash/a", nil)
+	require.NoError(t, err)
+	etag, err := storage.UploadPart(upload.UploadID, 1, make([]byte, 25))
+	require.NoError(t, err)
+	_, err = impl.CompleteMultipartUpload(ctx, upload.UploadID, "openim/data/hash/a", []s3.Part{{PartNumber: 1, ETag: etag}})
+	require.NoError(t, err)
+
+	require.NoError(t, impl.DeleteObject(ctx, "openim/data/b"))
+	require.NoError(t, impl.DeleteObject(ctx, "openim/temp/a"))
+
+	usages, err := m.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*Usage{
+		{Bucket: "openim", Prefix: "openim/data/"},
+		{Bucket: "openim", Prefix: "openim/data/hash/", Objects: 1, Bytes: 25},
+	}, usages)
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(NewMemoryStore(), Config{Bucket: "openim", Prefixes: []string{"a/", "a/b/", "c/"}})
+	require.NoError(t, err)
+	storage := mock.NewStorage()
+	storage.PutObject("a/1", make([]byte, 1), "")
+	storage.PutObject("a/b/1", make([]byte, 2), "")
+	storage.PutObject("a/b/2", make([]byte, 3), "")
+	storage.PutObject("d/1", make([]byte, 4), "")
+	require.NoError(t, m.Record(ctx, "c/1", 3, 300))
+
+	require.NoError(t, m.Reconcile(ctx, m.Wrap(storage).(s3.Lister)))
+	usages, err := m.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, usages, 3)
+	assert.Equal(t, [][2]int64{{1, 1}, {2, 5}, {0, 0}}, [][2]int64{
+		{usages[0].Objects, usages[0].Bytes},
+		{usages[1].Objects, usages[1].Bytes},
+		{usages[2].Objects, usages[2].Bytes},
+	})
+	assert.False(t, usages[2].ReconciledAt.IsZero())
+
+	total, err := m.Total(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total.Objects)
+	assert.Equal(t, int64(6), total.Bytes)
+}
@@ -0,0 +1,191 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meter
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+// Usage is the storage used under a prefix of a bucket.
+type Usage struct {
+	Bucket       string    `json:"bucket"`
+	Prefix       string    `json:"prefix"`
+	Objects      int64     `json:"objects"`
+	Bytes        int64     `json:"bytes"`
+	ReconciledAt time.Time `json:"reconciledAt"`
+}
+
+// Store keeps usage counters.
+type Store interface {
+	// Add changes a counter and returns its new state.
+	Add(ctx context.Context, bucket string, prefix string, objects int64, bytes int64) (*Usage, error)
+	// Set overwrites a counter after reconciliation.
+	Set(ctx context.Context, usage *Usage) error
+	// List returns the counters of a bucket.
+	List(ctx context.Context, bucket string) ([]*Usage, error)
+}
+
+// NewRedisStore keeps the counters of a bucket in one hash under
+// keyPrefix, which defaults to "S3USAGE:".
+func NewRedisStore(rdb redis.UniversalClient, keyPrefix string) Store {
+	if keyPrefix == "" {
+		keyPrefix = "S3USAGE:"
+	}
+	return &redisStore{rdb: rdb, keyPrefix: keyPrefix}
+}
+
+type redisStore struct {
+	rdb       redis.UniversalClient
+	keyPrefix string
+}
+
+// Hash fields are the counter name and the prefix joined by a colon.
+const (
+	fieldObjects    = "objects"
+	fieldBytes      = "bytes"
+	fieldReconciled = "reconciled"
+)
+
+func field(name string, prefix string) string {
+	return name + ":" + prefix
+}
+
+func (s *redisStore) key(bucket string) string {
+	return s.keyPrefix + bucket
+}
+
+func (s *redisStore) Add(ctx context.Context, bucket string, prefix string, objects int64, bytes int64) (*Usage, error) {
+	var objectsCmd, bytesCmd *redis.IntCmd
+	var reconciledCmd *redis.StringCmd
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		objectsCmd = pipe.HIncrBy(ctx, s.key(bucket), field(fieldObjects, prefix), objects)
+		bytesCmd = pipe.HIncrBy(ctx, s.key(bucket), field(fieldBytes, prefix), bytes)
+		reconciledCmd = pipe.HGet(ctx, s.key(bucket), field(fieldReconciled, prefix))
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errs.WrapMsg(err, "add s3 usage failed", "bucket", bucket, "prefix", prefix)
+	}
+	usage := &Usage{Bucket: bucket, Prefix: prefix, Objects: objectsCmd.Val(), Bytes: bytesCmd.Val()}
+	if ms, err := reconciledCmd.Int64(); err == nil {
+		usage.ReconciledAt = time.UnixMilli(ms)
+	}
+	return usage, nil
+}
+
+func (s *redisStore) Set(ctx context.Context, usage *Usage) error {
+	err := s.rdb.HSet(ctx, s.key(usage.Bucket),
+		field(fieldObjects, usage.Prefix), usage.Objects,
+		field(fieldBytes, usage.Prefix), usage.Bytes,
+		field(fieldReconciled, usage.Prefix), usage.ReconciledAt.UnixMilli(),
+	).Err()
+	if err != nil {
+		return errs.WrapMsg(err, "set s3 usage failed", "bucket", usage.Bucket, "prefix", usage.Prefix)
+	}
+	return nil
+}
+
+func (s *redisStore) List(ctx context.Context, bucket string) ([]*Usage, error) {
+	fields, err := s.rdb.HGetAll(ctx, s.key(bucket)).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "list s3 usage failed", "bucket", bucket)
+	}
+	usages := make(map[string]*Usage)
+	for f, value := range fields {
+		name, prefix, ok := strings.Cut(f, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		usage, ok := usages[prefix]
+		if !ok {
+			usage = &Usage{Bucket: bucket, Prefix: prefix}
+			usages[prefix] = usage
+		}
+		switch name {
+		case fieldObjects:
+			usage.Objects = n
+		case fieldBytes:
+			usage.Bytes = n
+		case fieldReconciled:
+			usage.ReconciledAt = time.UnixMilli(n)
+		}
+	}
+	return sortUsages(usages), nil
+}
+
+// NewMemoryStore keeps the counters in memory, for tests and single
+// instance deployments.
+func NewMemoryStore() Store {
+	return &memoryStore{buckets: make(map[string]map[string]*Usage)}
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]*Usage
+}
+
+func (s *memoryStore) usage(bucket string, prefix string) *Usage {
+	usages, ok := s.buckets[bucket]
+	if !ok {
+		usages = make(map[string]*Usage)
+		s.buckets[bucket] = usages
+	}
+	usage, ok := usages[prefix]
+	if !ok {
+		usage = &Usage{Bucket: bucket, Prefix: prefix}
+		usages[prefix] = usage
+	}
+	return usage
+}
+
+func (s *memoryStore) Add(ctx context.Context, bucket string, prefix string, objects int64, bytes int64) (*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage(bucket, prefix)
+	usage.Objects += objects
+	usage.Bytes += bytes
+	res := *usage
+	return &res, nil
+}
+
+func (s *memoryStore) Set(ctx context.Context, usage *Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.usage(usage.Bucket, usage.Prefix) = *usage
+	return nil
+}
+
+func (s *memoryStore) List(ctx context.Context, bucket string) ([]*Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usages := make(map[string]*Usage, len(s.buckets[bucket]))
+	for prefix, usage := range s.buckets[bucket] {
+		res := *usage
+		usages[prefix] = &res
+	}
+	return sortUsages(usages), nil
+}
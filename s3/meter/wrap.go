@@ -0,0 +1,110 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package meter
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Wrap returns impl metering the objects it completes, copies and deletes.
+// Sizes are read with StatObject, before a write to account for replaced
+// objects and before a delete. Metering failures are logged and left to
+// reconciliation; they do not fail the storage operation.
+func (m *Meter) Wrap(impl s3.Interface) s3.Interface {
+	return &metered{Interface: impl, meter: m}
+}
+
+type metered struct {
+	s3.Interface
+	meter *Meter
+}
+
+// size returns the size of an existing metered object.
+func (w *metered) size(ctx context.Context, name string) (int64, bool) {
+	if _, ok := w.meter.prefix(name); !ok {
+		return 0, false
+	}
+	info, err := w.Interface.StatObject(ctx, name)
+	if err != nil {
+		if !w.Interface.IsNotFound(err) {
+			log.ZWarn(ctx, "s3 usage stat failed", err, "name", name)
+		}
+		return 0, false
+	}
+	return info.Size, true
+}
+
+// written records name after a write that may have replaced an object of
+// oldSize.
+func (w *metered) written(ctx context.Context, name string, oldSize int64, existed bool) {
+	newSize, ok := w.size(ctx, name)
+	if !ok {
+		return
+	}
+	objects := int64(1)
+	if existed {
+		objects = 0
+	}
+	w.record(ctx, name, objects, newSize-oldSize)
+}
+
+func (w *metered) record(ctx context.Context, name string, objects int64, bytes int64) {
+	if err := w.meter.Record(ctx, name, objects, bytes); err != nil {
+		log.ZWarn(ctx, "s3 usage record failed", err, "name", name, "objects", objects, "bytes", bytes)
+	}
+}
+
+func (w *metered) CompleteMultipartUpload(ctx context.Context, uploadID string, name string, parts []s3.Part) (*s3.CompleteMultipartUploadResult, error) {
+	oldSize, existed := w.size(ctx, name)
+	res, err := w.Interface.CompleteMultipartUpload(ctx, uploadID, name, parts)
+	if err != nil {
+		return nil, err
+	}
+	w.written(ctx, name, oldSize, existed)
+	return res, nil
+}
+
+func (w *metered) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
+	oldSize, existed := w.size(ctx, dst)
+	res, err := w.Interface.CopyObject(ctx, src, dst)
+	if err != nil {
+		return nil, err
+	}
+	w.written(ctx, dst, oldSize, existed)
+	return res, nil
+}
+
+func (w *metered) DeleteObject(ctx context.Context, name string) error {
+	oldSize, existed := w.size(ctx, name)
+	if err := w.Interface.DeleteObject(ctx, name); err != nil {
+		return err
+	}
+	if existed {
+		w.record(ctx, name, -1, -oldSize)
+	}
+	return nil
+}
+
+func (w *metered) ListObjects(ctx context.Context, prefix string, fn func(info *s3.ObjectInfo) error) error {
+	lister, ok := w.Interface.(s3.Lister)
+	if !ok {
+		return errs.ErrInternalServer.WrapMsg("s3 engine cannot list objects", "engine", w.Interface.Engine())
+	}
+	return lister.ListObjects(ctx, prefix, fn)
+}
@@ -31,6 +31,7 @@ import (
 
 	"github.com/minio/minio-go/v7"
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/throttle"
 
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/minio/minio-go/v7/pkg/signer"
@@ -57,7 +58,10 @@ const (
 
 const successCode = http.StatusOK
 
-var _ s3.Interface = (*Minio)(nil)
+var (
+	_ s3.Interface = (*Minio)(nil)
+	_ s3.Lister    = (*Minio)(nil)
+)
 
 type Config struct {
 	Bucket          string
@@ -67,6 +71,8 @@ type Config struct {
 	SessionToken    string
 	SignEndpoint    string
 	PublicRead      bool
+	// Throttle limits the bandwidth of transfers made by the server.
+	Throttle *throttle.Throttle
 }
 
 func NewMinio(ctx context.Context, cache Cache, conf Config) (*Minio, error) {
@@ -78,6 +84,13 @@ func NewMinio(ctx context.Context, cache Cache, conf Config) (*Minio, error) {
 		Creds:  credentials.NewStaticV4(conf.AccessKeyID, conf.SecretAccessKey, conf.SessionToken),
 		Secure: u.Scheme == "https",
 	}
+	if conf.Throttle != nil {
+		transport, err := minio.DefaultTransport(opts.Secure)
+		if err != nil {
+			return nil, err
+		}
+		opts.Transport = conf.Throttle.Transport(transport)
+	}
 	client, err := minio.New(u.Host, opts)
 	if err != nil {
 		return nil, err
@@ -341,6 +354,29 @@ func (m *Minio) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, er
 	}, nil
 }
 
+func (m *Minio) ListObjects(ctx context.Context, prefix string, fn func(info *s3.ObjectInfo) error) error {
+	if err := m.initMinio(ctx); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for obj := range m.core.Client.ListObjects(ctx, m.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return errs.WrapMsg(obj.Err, "minio list objects failed", "prefix", prefix)
+		}
+		info := &s3.ObjectInfo{
+			ETag:         strings.ToLower(strings.Trim(obj.ETag, `"`)),
+			Key:          obj.Key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+		}
+		if err := fn(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Minio) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
 	if err := m.initMinio(ctx); err != nil {
 		return nil, err
@@ -0,0 +1,54 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/cont"
+)
+
+// Cache is a cont.S3Cache that reads through to a Storage without caching and records deleted keys.
+type Cache struct {
+	storage *Storage
+	lock    sync.Mutex
+	deleted []string
+}
+
+var _ cont.S3Cache = (*Cache)(nil)
+
+func NewCache(storage *Storage) *Cache {
+	return &Cache{storage: storage}
+}
+
+func (c *Cache) GetKey(ctx context.Context, engine string, key string) (*s3.ObjectInfo, error) {
+	return c.storage.StatObject(ctx, key)
+}
+
+func (c *Cache) DelS3Key(ctx context.Context, engine string, keys ...string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.deleted = append(c.deleted, keys...)
+	return nil
+}
+
+// Deleted returns the keys passed to DelS3Key.
+func (c *Cache) Deleted() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.deleted...)
+}
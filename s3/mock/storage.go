@@ -0,0 +1,377 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mock provides an in-memory s3.Interface and s3 cache for unit tests.
+package mock
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+)
+
+const Engine = "mock"
+
+// ErrNotFound is returned for missing objects and uploads; Storage.IsNotFound recognizes it.
+var ErrNotFound = errs.New("mock s3 object not found")
+
+type object struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+}
+
+type upload struct {
+	name  string
+	parts map[int][]byte
+}
+
+// Storage is an in-memory object store. Objects can be seeded with PutObject; presigned URLs point at
+// BaseURL and are not served. Errors can be injected per method name with SetError.
+type Storage struct {
+	BaseURL string
+
+	lock     sync.RWMutex
+	objects  map[string]*object
+	uploads  map[string]*upload
+	errors   map[string]error
+	uploadID int
+	limit    s3.PartLimit
+}
+
+var (
+	_ s3.Interface = (*Storage)(nil)
+	_ s3.Lister    = (*Storage)(nil)
+)
+
+func NewStorage() *Storage {
+	return &Storage{
+		BaseURL: "http://mock-s3.local/bucket",
+		objects: make(map[string]*object),
+		uploads: make(map[string]*upload),
+		errors:  make(map[string]error),
+		limit: s3.PartLimit{
+			MinPartSize: 5 << 20,
+			MaxPartSize: 5 << 30,
+			MaxNumSize:  10000,
+		},
+	}
+}
+
+// SetError makes the named method (e.g. "StatObject") return err; nil clears it.
+func (s *Storage) SetError(method string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		delete(s.errors, method)
+		return
+	}
+	s.errors[method] = err
+}
+
+func (s *Storage) injected(method string) error {
+	return s.errors[method]
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// PutObject stores data under name, replacing any existing object.
+func (s *Storage) PutObject(name string, data []byte, contentType string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.objects[name] = &object{
+		data:        append([]byte(nil), data...),
+		contentType: contentType,
+		etag:        etag(data),
+		modified:    time.Now(),
+	}
+}
+
+// GetObject returns a copy of the object content.
+func (s *Storage) GetObject(name string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	obj, ok := s.objects[name]
+	if !ok {
+		return nil, ErrNotFound.WrapMsg("get object", "name", name)
+	}
+	return append([]byte(nil), obj.data...), nil
+}
+
+// Names returns all object names in lexical order.
+func (s *Storage) Names() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Storage) Engine() string {
+	return Engine
+}
+
+func (s *Storage) PartLimit() (*s3.PartLimit, error) {
+	limit := s.limit
+	return &limit, nil
+}
+
+func (s *Storage) InitiateMultipartUpload(ctx context.Context, name string, opt *s3.PutOption) (*s3.InitiateMultipartUploadResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.injected("InitiateMultipartUpload"); err != nil {
+		return nil, err
+	}
+	s.uploadID++
+	id := strconv.Itoa(s.uploadID)
+	s.uploads[id] = &upload{name: name, parts: make(map[int][]byte)}
+	return &s3.InitiateMultipartUploadResult{Bucket: Engine, Key: name, UploadID: id}, nil
+}
+
+// UploadPart stores a part of a multipart upload, standing in for the client's PUT to a signed part URL.
+func (s *Storage) UploadPart(uploadID string, partNumber int, data []byte) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	up, ok := s.uploads[uploadID]
+	if !ok {
+		return "", ErrNotFound.WrapMsg("upload part", "uploadID", uploadID)
+	}
+	up.parts[partNumber] = append([]byte(nil), data...)
+	return etag(data), nil
+}
+
+func (s *Storage) CompleteMultipartUpload(ctx context.Context, uploadID string, name string, parts []s3.Part) (*s3.CompleteMultipartUploadResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.injected("CompleteMultipartUpload"); err != nil {
+		return nil, err
+	}
+	up, ok := s.uploads[uploadID]
+	if !ok || up.name != name {
+		return nil, ErrNotFound.WrapMsg("complete multipart upload", "uploadID", uploadID, "name", name)
+	}
+	var data []byte
+	for _, part := range parts {
+		p, ok := up.parts[part.PartNumber]
+		if !ok {
+			return nil, errs.ErrArgs.WrapMsg("part not uploaded", "partNumber", part.PartNumber)
+		}
+		data = append(data, p...)
+	}
+	delete(s.uploads, uploadID)
+	obj := &object{data: data, etag: etag(data), modified: time.Now()}
+	s.objects[name] = obj
+	return &s3.CompleteMultipartUploadResult{Location: s.objectURL(name), Bucket: Engine, Key: name, ETag: obj.etag}, nil
+}
+
+func (s *Storage) PartSize(ctx context.Context, size int64) (int64, error) {
+	if size <= 0 {
+		return 0, errs.ErrArgs.WrapMsg("size must be greater than 0")
+	}
+	if size > s.limit.MaxPartSize*s.limit.MaxNumSize {
+		return 0, errs.ErrArgs.WrapMsg("size too large", "size", size)
+	}
+	partSize := size / s.limit.MaxNumSize
+	if size%s.limit.MaxNumSize != 0 {
+		partSize++
+	}
+	return max(partSize, s.limit.MinPartSize), nil
+}
+
+func (s *Storage) AuthSign(ctx context.Context, uploadID string, name string, expire time.Duration, partNumbers []int) (*s3.AuthSignResult, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("AuthSign"); err != nil {
+		return nil, err
+	}
+	res := &s3.AuthSignResult{URL: s.objectURL(name), Query: url.Values{"uploadId": {uploadID}}, Header: http.Header{}}
+	for _, n := range partNumbers {
+		res.Parts = append(res.Parts, s3.SignPart{PartNumber: n, URL: s.objectURL(name), Query: url.Values{"partNumber": {strconv.Itoa(n)}}})
+	}
+	return res, nil
+}
+
+func (s *Storage) PresignedPutObject(ctx context.Context, name string, expire time.Duration, opt *s3.PutOption) (*s3.PresignedPutResult, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("PresignedPutObject"); err != nil {
+		return nil, err
+	}
+	return &s3.PresignedPutResult{URL: s.objectURL(name) + "?X-Expires=" + strconv.Itoa(int(expire/time.Second))}, nil
+}
+
+func (s *Storage) DeleteObject(ctx context.Context, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.injected("DeleteObject"); err != nil {
+		return err
+	}
+	delete(s.objects, name)
+	return nil
+}
+
+func (s *Storage) CopyObject(ctx context.Context, src string, dst string) (*s3.CopyObjectInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.injected("CopyObject"); err != nil {
+		return nil, err
+	}
+	obj, ok := s.objects[src]
+	if !ok {
+		return nil, ErrNotFound.WrapMsg("copy object", "src", src)
+	}
+	cp := *obj
+	cp.modified = time.Now()
+	s.objects[dst] = &cp
+	return &s3.CopyObjectInfo{Key: dst, ETag: cp.etag}, nil
+}
+
+func (s *Storage) StatObject(ctx context.Context, name string) (*s3.ObjectInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("StatObject"); err != nil {
+		return nil, err
+	}
+	obj, ok := s.objects[name]
+	if !ok {
+		return nil, ErrNotFound.WrapMsg("stat object", "name", name)
+	}
+	return &s3.ObjectInfo{ETag: obj.etag, Key: name, Size: int64(len(obj.data)), LastModified: obj.modified}, nil
+}
+
+// ListObjects lists the objects under prefix in name order. fn must not call
+// other methods of s.
+func (s *Storage) ListObjects(ctx context.Context, prefix string, fn func(info *s3.ObjectInfo) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("ListObjects"); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(s.objects))
+	for name := range s.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		obj := s.objects[name]
+		if err := fn(&s3.ObjectInfo{ETag: obj.etag, Key: name, Size: int64(len(obj.data)), LastModified: obj.modified}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func (s *Storage) AbortMultipartUpload(ctx context.Context, uploadID string, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.injected("AbortMultipartUpload"); err != nil {
+		return err
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+func (s *Storage) ListUploadedParts(ctx context.Context, uploadID string, name string, partNumberMarker int, maxParts int) (*s3.ListUploadedPartsResult, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("ListUploadedParts"); err != nil {
+		return nil, err
+	}
+	up, ok := s.uploads[uploadID]
+	if !ok {
+		return nil, ErrNotFound.WrapMsg("list uploaded parts", "uploadID", uploadID)
+	}
+	numbers := make([]int, 0, len(up.parts))
+	for n := range up.parts {
+		if n > partNumberMarker {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	res := &s3.ListUploadedPartsResult{Key: name, UploadID: uploadID, MaxParts: maxParts}
+	for _, n := range numbers {
+		if maxParts > 0 && len(res.UploadedParts) >= maxParts {
+			res.NextPartNumberMarker = res.UploadedParts[len(res.UploadedParts)-1].PartNumber
+			break
+		}
+		data := up.parts[n]
+		res.UploadedParts = append(res.UploadedParts, s3.UploadedPart{PartNumber: n, ETag: etag(data), Size: int64(len(data))})
+	}
+	return res, nil
+}
+
+func (s *Storage) AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("AccessURL"); err != nil {
+		return "", err
+	}
+	if _, ok := s.objects[name]; !ok {
+		return "", ErrNotFound.WrapMsg("access url", "name", name)
+	}
+	query := url.Values{"X-Expires": {strconv.Itoa(int(expire / time.Second))}}
+	if opt != nil {
+		if opt.ContentType != "" {
+			query.Set("response-content-type", opt.ContentType)
+		}
+		if opt.Filename != "" {
+			query.Set("response-content-disposition", fmt.Sprintf(`attachment; filename=%q`, opt.Filename))
+		}
+	}
+	return s.objectURL(name) + "?" + query.Encode(), nil
+}
+
+func (s *Storage) FormData(ctx context.Context, name string, size int64, contentType string, duration time.Duration) (*s3.FormData, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := s.injected("FormData"); err != nil {
+		return nil, err
+	}
+	return &s3.FormData{
+		URL:          s.BaseURL,
+		File:         "file",
+		FormData:     map[string]string{"key": name, "Content-Type": contentType},
+		Expires:      time.Now().Add(duration),
+		SuccessCodes: []int{http.StatusOK, http.StatusNoContent},
+	}, nil
+}
+
+func (s *Storage) objectURL(name string) string {
+	return s.BaseURL + "/" + name
+}
@@ -0,0 +1,89 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/cont"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageObjects(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+	_, err := s.StatObject(ctx, "a.txt")
+	assert.True(t, s.IsNotFound(err))
+
+	s.PutObject("a.txt", []byte("hello"), "text/plain")
+	info, err := s.StatObject(ctx, "a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+
+	_, err = s.CopyObject(ctx, "a.txt", "b.txt")
+	require.NoError(t, err)
+	data, err := s.GetObject("b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	u, err := s.AccessURL(ctx, "b.txt", time.Hour, &s3.AccessURLOption{ContentType: "text/plain"})
+	require.NoError(t, err)
+	assert.Contains(t, u, "response-content-type=text%2Fplain")
+
+	require.NoError(t, s.DeleteObject(ctx, "a.txt"))
+	assert.Equal(t, []string{"b.txt"}, s.Names())
+
+	s.SetError("StatObject", errs.New("injected"))
+	_, err = s.StatObject(ctx, "b.txt")
+	assert.EqualError(t, err, "injected")
+}
+
+func TestStorageMultipart(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+	res, err := s.InitiateMultipartUpload(ctx, "big.bin", nil)
+	require.NoError(t, err)
+	_, err = s.UploadPart(res.UploadID, 2, []byte("world"))
+	require.NoError(t, err)
+	_, err = s.UploadPart(res.UploadID, 1, []byte("hello "))
+	require.NoError(t, err)
+
+	parts, err := s.ListUploadedParts(ctx, res.UploadID, "big.bin", 0, 1)
+	require.NoError(t, err)
+	require.Len(t, parts.UploadedParts, 1)
+	assert.Equal(t, 1, parts.NextPartNumberMarker)
+
+	_, err = s.CompleteMultipartUpload(ctx, res.UploadID, "big.bin", []s3.Part{{PartNumber: 1}, {PartNumber: 2}})
+	require.NoError(t, err)
+	data, err := s.GetObject("big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+}
+
+func TestController(t *testing.T) {
+	ctx := context.Background()
+	s := NewStorage()
+	cache := NewCache(s)
+	s.PutObject("x", []byte("1"), "")
+	c := cont.New(cache, s)
+	info, err := c.StatObject(ctx, "x")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), info.Size)
+}
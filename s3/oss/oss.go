@@ -31,6 +31,7 @@ import (
 	"time"
 
 	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/throttle"
 
 	"github.com/aliyun/aliyun-oss-go-sdk/oss"
 	"github.com/openimsdk/tools/errs"
@@ -62,13 +63,19 @@ type Config struct {
 	AccessKeySecret string
 	SessionToken    string
 	PublicRead      bool
+	// Throttle limits the bandwidth of transfers made by the server.
+	Throttle *throttle.Throttle
 }
 
 func NewOSS(conf Config) (*OSS, error) {
 	if conf.BucketURL == "" {
 		return nil, errs.Wrap(errors.New("bucket url is empty"))
 	}
-	client, err := oss.New(conf.Endpoint, conf.AccessKeyID, conf.AccessKeySecret)
+	var opts []oss.ClientOption
+	if conf.Throttle != nil {
+		opts = append(opts, oss.HTTPClient(&http.Client{Transport: conf.Throttle.Transport(nil)}))
+	}
+	client, err := oss.New(conf.Endpoint, conf.AccessKeyID, conf.AccessKeySecret, opts...)
 	if err != nil {
 		return nil, err
 	}
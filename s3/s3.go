@@ -173,3 +173,10 @@ type Interface interface {
 
 	FormData(ctx context.Context, name string, size int64, contentType string, duration time.Duration) (*FormData, error)
 }
+
+// Lister is implemented by engines that can enumerate objects, e.g. for
+// usage reconciliation. ListObjects calls fn for every object whose name
+// starts with prefix, stopping at the first error.
+type Lister interface {
+	ListObjects(ctx context.Context, prefix string, fn func(info *ObjectInfo) error) error
+}
@@ -0,0 +1,134 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// ClamAV scans with a clamd daemon over TCP using the INSTREAM command.
+// Content beyond the StreamMaxLength of clamd fails the scan.
+type ClamAV struct {
+	// Addr is the host:port of clamd.
+	Addr string
+	// Timeout bounds a scan unless the context ends earlier, defaults to
+	// 2 minutes.
+	Timeout time.Duration
+	// ChunkSize is the size of the streamed chunks, defaults to 64 KiB.
+	ChunkSize int
+}
+
+func NewClamAV(addr string) *ClamAV {
+	return &ClamAV{Addr: addr}
+}
+
+func (c *ClamAV) Name() string {
+	return "clamav"
+}
+
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (string, error) {
+	timeout, chunkSize := c.Timeout, c.ChunkSize
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	if chunkSize <= 0 {
+		chunkSize = 64 << 10
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return "", errs.WrapMsg(err, "clamd dial failed", "addr", c.Addr)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return "", errs.WrapMsg(err, "clamd set deadline failed")
+	}
+	if err := c.stream(conn, r, chunkSize); err != nil {
+		// clamd replies before closing when the stream exceeds its limit.
+		if reply, rerr := readReply(conn); rerr == nil {
+			return parseReply(reply)
+		}
+		return "", err
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return "", err
+	}
+	return parseReply(reply)
+}
+
+func (c *ClamAV) stream(conn net.Conn, r io.Reader, chunkSize int) error {
+	w := bufio.NewWriterSize(conn, chunkSize+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return errs.WrapMsg(err, "clamd write failed")
+	}
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return errs.WrapMsg(werr, "clamd write failed")
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return errs.WrapMsg(err, "read object for scan failed")
+		}
+	}
+	binary.BigEndian.PutUint32(buf, 0)
+	if _, err := w.Write(buf[:4]); err != nil {
+		return errs.WrapMsg(err, "clamd write failed")
+	}
+	if err := w.Flush(); err != nil {
+		return errs.WrapMsg(err, "clamd write failed")
+	}
+	return nil
+}
+
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", errs.WrapMsg(err, "clamd read reply failed")
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parseReply parses "stream: OK", "stream: <threat> FOUND" and
+// "<message> ERROR".
+func parseReply(reply string) (string, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	default:
+		return "", errs.New("clamd scan failed", "reply", reply).Wrap()
+	}
+}
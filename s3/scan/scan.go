@@ -0,0 +1,262 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scan checks newly uploaded objects with a content scanner, e.g.
+// an antivirus, after the upload completed. Objects are queued and scanned
+// by background workers; verdicts are kept in a Store, which doubles as the
+// quarantine tag consulted before access URLs are handed out. Infected
+// objects can additionally be moved under a quarantine prefix.
+package scan
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+)
+
+const (
+	ObjectQuarantinedError = 1921 // The object was quarantined by a content scan.
+)
+
+var ErrQuarantined = errs.NewCodeError(ObjectQuarantinedError, "ObjectQuarantinedError")
+
+// ErrQueueFull is returned by Submit when the workers are behind.
+var ErrQueueFull = errs.New("scan queue is full")
+
+func init() {
+	apiresp.RegisterProblemStatus(ObjectQuarantinedError, http.StatusForbidden)
+}
+
+// Status is the state of an object scan.
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusClean    Status = "clean"
+	StatusInfected Status = "infected"
+	StatusSkipped  Status = "skipped" // Larger than Config.MaxSize.
+	StatusFailed   Status = "failed"
+)
+
+// Verdict is the scan result of an object. Quarantined is the name the
+// object was moved to, if it was.
+type Verdict struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Status      Status    `json:"status"`
+	Threat      string    `json:"threat,omitempty"`
+	Scanner     string    `json:"scanner,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Quarantined string    `json:"quarantined,omitempty"`
+	SubmittedAt time.Time `json:"submittedAt"`
+	ScannedAt   time.Time `json:"scannedAt"`
+}
+
+// Scanner scans content. Scan returns the name of the threat found, empty
+// for clean content.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader) (threat string, err error)
+}
+
+// Config configures a Pipeline.
+type Config struct {
+	// Workers is the number of concurrent scans, defaults to 4.
+	Workers int
+	// QueueSize bounds the objects waiting for a worker, defaults to 1024.
+	QueueSize int
+	// Timeout bounds the download and scan of an object, defaults to 5
+	// minutes.
+	Timeout time.Duration
+	// MaxSize skips objects larger than it, zero scans every object.
+	MaxSize int64
+	// QuarantinePrefix, when set, moves infected objects to the prefix
+	// plus their name. Otherwise they stay in place, tagged in the Store.
+	QuarantinePrefix string
+	// Client downloads objects, defaults to http.DefaultClient.
+	Client *http.Client
+	// OnVerdict is called with every final verdict.
+	OnVerdict func(ctx context.Context, v *Verdict)
+}
+
+type task struct {
+	ctx     context.Context
+	verdict *Verdict
+}
+
+// Pipeline scans submitted objects in the background.
+type Pipeline struct {
+	storage s3.Interface
+	scanner Scanner
+	store   Store
+	conf    Config
+	queue   chan task
+}
+
+func New(storage s3.Interface, scanner Scanner, store Store, conf Config) *Pipeline {
+	if conf.Workers <= 0 {
+		conf.Workers = 4
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 1024
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Minute
+	}
+	if conf.Client == nil {
+		conf.Client = http.DefaultClient
+	}
+	return &Pipeline{storage: storage, scanner: scanner, store: store, conf: conf, queue: make(chan task, conf.QueueSize)}
+}
+
+// Submit records name as pending and queues it for scanning. Queued
+// objects are lost on shutdown and stay pending in the Store.
+func (p *Pipeline) Submit(ctx context.Context, name string, size int64) error {
+	v := &Verdict{Name: name, Size: size, Status: StatusPending, SubmittedAt: time.Now()}
+	if err := p.store.Save(ctx, v); err != nil {
+		return err
+	}
+	select {
+	case p.queue <- task{ctx: context.WithoutCancel(ctx), verdict: v}:
+		return nil
+	default:
+		return ErrQueueFull.WrapMsg("scan queue is full", "name", name, "size", p.conf.QueueSize)
+	}
+}
+
+// Run scans queued objects with Config.Workers workers until ctx is done.
+func (p *Pipeline) Run(ctx context.Context) {
+	done := make(chan struct{})
+	for i := 0; i < p.conf.Workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case t := <-p.queue:
+					p.scan(t.ctx, t.verdict)
+				}
+			}
+		}()
+	}
+	for i := 0; i < p.conf.Workers; i++ {
+		<-done
+	}
+}
+
+// Verdict returns the verdict of name, errs.ErrRecordNotFound when it was
+// never submitted.
+func (p *Pipeline) Verdict(ctx context.Context, name string) (*Verdict, error) {
+	return p.store.Load(ctx, name)
+}
+
+// Check returns ErrQuarantined when name was found infected. Objects not
+// scanned yet pass.
+func (p *Pipeline) Check(ctx context.Context, name string) error {
+	v, err := p.store.Load(ctx, name)
+	if err != nil {
+		if errs.ErrRecordNotFound.Is(err) {
+			return nil
+		}
+		return err
+	}
+	if v.Status == StatusInfected {
+		return ErrQuarantined.WrapMsg("object quarantined", "name", name, "threat", v.Threat)
+	}
+	return nil
+}
+
+func (p *Pipeline) scan(ctx context.Context, v *Verdict) {
+	defer func() {
+		if r := recover(); r != nil {
+			v.Status, v.Error = StatusFailed, errs.ErrPanic(r).Error()
+			p.finish(ctx, v)
+		}
+	}()
+	if p.conf.MaxSize > 0 && v.Size > p.conf.MaxSize {
+		v.Status = StatusSkipped
+		p.finish(ctx, v)
+		return
+	}
+	threat, err := p.scanObject(ctx, v.Name)
+	v.Scanner = p.scanner.Name()
+	switch {
+	case err != nil:
+		v.Status, v.Error = StatusFailed, err.Error()
+		log.ZWarn(ctx, "object scan failed", err, "name", v.Name)
+	case threat == "":
+		v.Status = StatusClean
+	default:
+		v.Status, v.Threat = StatusInfected, threat
+		log.ZWarn(ctx, "object infected", nil, "name", v.Name, "threat", threat)
+		if err := p.quarantine(ctx, v); err != nil {
+			log.ZError(ctx, "object quarantine failed", err, "name", v.Name)
+		}
+	}
+	p.finish(ctx, v)
+}
+
+func (p *Pipeline) scanObject(ctx context.Context, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+	rawURL, err := p.storage.AccessURL(ctx, name, p.conf.Timeout, nil)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", errs.WrapMsg(err, "create scan download request failed")
+	}
+	resp, err := p.conf.Client.Do(req)
+	if err != nil {
+		return "", errs.WrapMsg(err, "download object for scan failed", "name", name)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errs.New("download object for scan failed", "name", name, "status", resp.StatusCode).Wrap()
+	}
+	return p.scanner.Scan(ctx, resp.Body)
+}
+
+func (p *Pipeline) quarantine(ctx context.Context, v *Verdict) error {
+	if p.conf.QuarantinePrefix == "" {
+		return nil
+	}
+	dst := p.conf.QuarantinePrefix + v.Name
+	if _, err := p.storage.CopyObject(ctx, v.Name, dst); err != nil {
+		return err
+	}
+	if err := p.storage.DeleteObject(ctx, v.Name); err != nil {
+		return err
+	}
+	v.Quarantined = dst
+	return nil
+}
+
+func (p *Pipeline) finish(ctx context.Context, v *Verdict) {
+	v.ScannedAt = time.Now()
+	if err := p.store.Save(ctx, v); err != nil {
+		log.ZError(ctx, "save scan verdict failed", err, "name", v.Name, "status", v.Status)
+	}
+	if p.conf.OnVerdict != nil {
+		p.conf.OnVerdict(ctx, v)
+	}
+}
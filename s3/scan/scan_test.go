@@ -0,0 +1,147 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/openimsdk/tools/s3/scan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eicar = "EICAR-TEST"
+
+// fakeClamd answers INSTREAM like clamd, finding eicar.
+func fakeClamd(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				cmd := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, cmd); err != nil || string(cmd) != "zINSTREAM\x00" {
+					return
+				}
+				var data bytes.Buffer
+				for {
+					var size [4]byte
+					if _, err := io.ReadFull(conn, size[:]); err != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size[:])
+					if n == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, conn, int64(n)); err != nil {
+						return
+					}
+				}
+				reply := "stream: OK\x00"
+				switch {
+				case strings.Contains(data.String(), eicar):
+					reply = "stream: Eicar-Test-Signature FOUND\x00"
+				case strings.Contains(data.String(), "LIMIT"):
+					reply = "INSTREAM size limit exceeded. ERROR\x00"
+				}
+				_, _ = conn.Write([]byte(reply))
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestClamAV(t *testing.T) {
+	c := &scan.ClamAV{Addr: fakeClamd(t), ChunkSize: 4}
+	ctx := context.Background()
+	threat, err := c.Scan(ctx, strings.NewReader("hello world"))
+	require.NoError(t, err)
+	assert.Empty(t, threat)
+	threat, err = c.Scan(ctx, strings.NewReader("xx"+eicar+"xx"))
+	require.NoError(t, err)
+	assert.Equal(t, "Eicar-Test-Signature", threat)
+
+	_, err = c.Scan(ctx, strings.NewReader("LIMIT"))
+	assert.Error(t, err)
+}
+
+func TestPipeline(t *testing.T) {
+	storage := mock.NewStorage()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := storage.GetObject(strings.TrimPrefix(r.URL.Path, "/"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+	storage.BaseURL = srv.URL
+	storage.PutObject("data/clean", []byte("hello"), "")
+	storage.PutObject("data/bad", []byte(eicar), "")
+	storage.PutObject("data/big", make([]byte, 100), "")
+
+	verdicts := make(chan *scan.Verdict, 4)
+	p := scan.New(storage, scan.NewClamAV(fakeClamd(t)), scan.NewMemoryStore(), scan.Config{
+		MaxSize:          64,
+		QuarantinePrefix: "quarantine/",
+		OnVerdict:        func(ctx context.Context, v *scan.Verdict) { verdicts <- v },
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Run(ctx)
+
+	require.NoError(t, p.Submit(ctx, "data/clean", 5))
+	require.NoError(t, p.Submit(ctx, "data/bad", int64(len(eicar))))
+	require.NoError(t, p.Submit(ctx, "data/big", 100))
+	require.NoError(t, p.Submit(ctx, "data/missing", 1))
+
+	got := make(map[string]*scan.Verdict)
+	for i := 0; i < 4; i++ {
+		select {
+		case v := <-verdicts:
+			got[v.Name] = v
+		case <-time.After(5 * time.Second):
+			t.Fatal("verdict timeout")
+		}
+	}
+	assert.Equal(t, scan.StatusClean, got["data/clean"].Status)
+	assert.Equal(t, scan.StatusInfected, got["data/bad"].Status)
+	assert.Equal(t, "Eicar-Test-Signature", got["data/bad"].Threat)
+	assert.Equal(t, "quarantine/data/bad", got["data/bad"].Quarantined)
+	assert.Equal(t, scan.StatusSkipped, got["data/big"].Status)
+	assert.Equal(t, scan.StatusFailed, got["data/missing"].Status)
+
+	assert.Equal(t, []string{"data/big", "data/clean", "quarantine/data/bad"}, storage.Names())
+	assert.True(t, scan.ErrQuarantined.Is(p.Check(ctx, "data/bad")))
+	assert.NoError(t, p.Check(ctx, "data/clean"))
+	assert.NoError(t, p.Check(ctx, "data/unknown"))
+}
@@ -0,0 +1,102 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store keeps verdicts by object name.
+type Store interface {
+	Save(ctx context.Context, v *Verdict) error
+	// Load returns errs.ErrRecordNotFound for unknown names.
+	Load(ctx context.Context, name string) (*Verdict, error)
+}
+
+// NewRedisStore keeps verdicts as JSON under prefix, "S3SCAN:" when empty.
+// Verdicts are the quarantine tags, so they expire only with a ttl set.
+func NewRedisStore(rdb redis.UniversalClient, prefix string, ttl time.Duration) Store {
+	if prefix == "" {
+		prefix = "S3SCAN:"
+	}
+	return &redisStore{rdb: rdb, prefix: prefix, ttl: ttl}
+}
+
+type redisStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func (s *redisStore) Save(ctx context.Context, v *Verdict) error {
+	data, err := jsonutil.Marshal(v)
+	if err != nil {
+		return errs.WrapMsg(err, "encode scan verdict failed", "name", v.Name)
+	}
+	if err := s.rdb.Set(ctx, s.prefix+v.Name, data, s.ttl).Err(); err != nil {
+		return errs.WrapMsg(err, "save scan verdict failed", "name", v.Name)
+	}
+	return nil
+}
+
+func (s *redisStore) Load(ctx context.Context, name string) (*Verdict, error) {
+	data, err := s.rdb.Get(ctx, s.prefix+name).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errs.ErrRecordNotFound.WrapMsg("scan verdict not found", "name", name)
+		}
+		return nil, errs.WrapMsg(err, "load scan verdict failed", "name", name)
+	}
+	var v Verdict
+	if err := jsonutil.Unmarshal(data, &v); err != nil {
+		return nil, errs.WrapMsg(err, "decode scan verdict failed", "name", name)
+	}
+	return &v, nil
+}
+
+// NewMemoryStore keeps verdicts in memory, for tests and single instance
+// deployments.
+func NewMemoryStore() Store {
+	return &memoryStore{verdicts: make(map[string]Verdict)}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	verdicts map[string]Verdict
+}
+
+func (s *memoryStore) Save(ctx context.Context, v *Verdict) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.verdicts[v.Name] = *v
+	return nil
+}
+
+func (s *memoryStore) Load(ctx context.Context, name string) (*Verdict, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.verdicts[name]
+	if !ok {
+		return nil, errs.ErrRecordNotFound.WrapMsg("scan verdict not found", "name", name)
+	}
+	return &v, nil
+}
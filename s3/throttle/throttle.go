@@ -0,0 +1,197 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package throttle limits the bandwidth of s3 transfers with token buckets:
+// a global one per direction shared by all transfers of a Throttle, and
+// optional per-operation ones attached to the context with WithLimit, so a
+// background migration can run slower than interactive traffic. Engines
+// apply it to their HTTP transport when their Config sets a Throttle.
+package throttle
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// minBurst is the smallest bucket, so reads are not split into tiny chunks.
+const minBurst = 32 << 10
+
+// Config configures a Throttle. Limits are in bytes per second, zero means
+// unlimited.
+type Config struct {
+	Upload   int64
+	Download int64
+}
+
+// Throttle limits transfers. A nil Throttle does not limit.
+type Throttle struct {
+	upload   *rate.Limiter
+	download *rate.Limiter
+}
+
+func New(conf Config) *Throttle {
+	return &Throttle{upload: newLimiter(conf.Upload), download: newLimiter(conf.Download)}
+}
+
+func newLimiter(bytesPerSecond int64) *rate.Limiter {
+	if bytesPerSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, minBurst)
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), int(max(bytesPerSecond, minBurst)))
+}
+
+// SetLimit changes the global limits, e.g. on a configuration reload.
+func (t *Throttle) SetLimit(conf Config) {
+	set := func(l *rate.Limiter, bytesPerSecond int64) {
+		if bytesPerSecond <= 0 {
+			l.SetLimit(rate.Inf)
+			return
+		}
+		l.SetBurst(int(max(bytesPerSecond, minBurst)))
+		l.SetLimit(rate.Limit(bytesPerSecond))
+	}
+	set(t.upload, conf.Upload)
+	set(t.download, conf.Download)
+}
+
+type limitKey struct{}
+
+type limiters struct {
+	upload   *rate.Limiter
+	download *rate.Limiter
+}
+
+// WithLimit returns a context whose transfers share their own buckets of
+// upload and download bytes per second, in addition to the global ones.
+// Zero leaves a direction to the global limit only.
+func WithLimit(ctx context.Context, upload int64, download int64) context.Context {
+	l := limiters{}
+	if upload > 0 {
+		l.upload = newLimiter(upload)
+	}
+	if download > 0 {
+		l.download = newLimiter(download)
+	}
+	return context.WithValue(ctx, limitKey{}, l)
+}
+
+// UploadReader limits reading r to the upload limits of t and ctx.
+func (t *Throttle) UploadReader(ctx context.Context, r io.Reader) io.Reader {
+	l, _ := ctx.Value(limitKey{}).(limiters)
+	return t.reader(ctx, r, t.limiter(true), l.upload)
+}
+
+// DownloadReader limits reading r to the download limits of t and ctx.
+func (t *Throttle) DownloadReader(ctx context.Context, r io.Reader) io.Reader {
+	l, _ := ctx.Value(limitKey{}).(limiters)
+	return t.reader(ctx, r, t.limiter(false), l.download)
+}
+
+func (t *Throttle) limiter(upload bool) *rate.Limiter {
+	switch {
+	case t == nil:
+		return nil
+	case upload:
+		return t.upload
+	default:
+		return t.download
+	}
+}
+
+func (t *Throttle) reader(ctx context.Context, r io.Reader, buckets ...*rate.Limiter) io.Reader {
+	lr := &reader{ctx: ctx, r: r}
+	for _, l := range buckets {
+		if l != nil {
+			lr.buckets = append(lr.buckets, l)
+		}
+	}
+	if len(lr.buckets) == 0 {
+		return r
+	}
+	return lr
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.Reader
+	buckets []*rate.Limiter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for _, l := range r.buckets {
+		if l.Limit() != rate.Inf && len(p) > l.Burst() {
+			p = p[:l.Burst()]
+		}
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		for _, l := range r.buckets {
+			if werr := l.WaitN(r.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Transport returns base, http.DefaultTransport when nil, limiting request
+// bodies as uploads and response bodies as downloads.
+func (t *Throttle) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t == nil {
+		return base
+	}
+	return &transport{base: base, throttle: t}
+}
+
+type transport struct {
+	base     http.RoundTripper
+	throttle *Throttle
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if req.Body != nil && req.Body != http.NoBody {
+		body, getBody := req.Body, req.GetBody
+		req = req.Clone(ctx)
+		req.Body = readCloser{Reader: t.throttle.UploadReader(ctx, body), Closer: body}
+		if getBody != nil {
+			req.GetBody = func() (io.ReadCloser, error) {
+				body, err := getBody()
+				if err != nil {
+					return nil, err
+				}
+				return readCloser{Reader: t.throttle.UploadReader(ctx, body), Closer: body}, nil
+			}
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		resp.Body = readCloser{Reader: t.throttle.DownloadReader(ctx, resp.Body), Closer: resp.Body}
+	}
+	return resp, nil
+}
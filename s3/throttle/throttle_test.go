@@ -0,0 +1,87 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransport(t *testing.T) {
+	data := make([]byte, 48<<10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			n, _ := io.Copy(io.Discard, r.Body)
+			assert.Equal(t, int64(len(data)), n)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	th := New(Config{Upload: 32 << 10})
+	client := &http.Client{Transport: th.Transport(nil)}
+
+	start := time.Now()
+	req, err := http.NewRequest(http.MethodPut, srv.URL, bytes.NewReader(data))
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	// The first 32 KiB are the burst, the rest takes half a second.
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+
+	start = time.Now()
+	resp, err = client.Get(srv.URL)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Less(t, time.Since(start), 300*time.Millisecond)
+
+	start = time.Now()
+	req, err = http.NewRequestWithContext(WithLimit(context.Background(), 0, 32<<10), http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	n, err := io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int64(len(data)), n)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestNil(t *testing.T) {
+	var th *Throttle
+	assert.Equal(t, http.DefaultTransport, th.Transport(nil))
+	r := bytes.NewReader(nil)
+	assert.Equal(t, io.Reader(r), th.UploadReader(context.Background(), r))
+}
+
+func TestCanceled(t *testing.T) {
+	th := New(Config{Download: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := io.ReadAll(th.DownloadReader(ctx, bytes.NewReader(make([]byte, 64<<10))))
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,272 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package urlbind hands out object URLs bound to the user and optionally
+// the IP they were issued for, instead of long-lived presigned URLs. A
+// bound URL points at a validating handler, which checks the signature,
+// expiry and binding, logs the access and redirects to a presigned URL
+// valid for a short time only. Every access is logged and attributable. The
+// user binding is enforced only with Config.Requester, otherwise a leaked
+// URL still works for anyone and its use by another user is just logged; an
+// IP binding is always enforced.
+package urlbind
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/s3"
+)
+
+// Query parameters of a bound URL.
+const (
+	paramName        = "name"
+	paramUserID      = "uid"
+	paramBindIP      = "bip"
+	paramExpires     = "exp"
+	paramContentType = "ct"
+	paramFilename    = "fn"
+	paramSignature   = "sig"
+)
+
+// AccessURLer creates presigned URLs, e.g. an s3.Interface or a
+// cont.Controller.
+type AccessURLer interface {
+	AccessURL(ctx context.Context, name string, expire time.Duration, opt *s3.AccessURLOption) (string, error)
+}
+
+// Claims bind a URL. An empty UserID binds to nobody; IP binds to the
+// address the URL must be used from, none when empty.
+type Claims struct {
+	UserID string
+	IP     string
+}
+
+// Access is the access log record of a bound URL.
+type Access struct {
+	Name      string
+	UserID    string // The user the URL was issued to.
+	Requester string // The user resolved by Config.Requester, if any.
+	IP        string
+	UserAgent string
+	Referer   string
+	Expires   time.Time
+	Err       error // Why access was denied, nil when allowed.
+}
+
+// Config configures a Signer.
+type Config struct {
+	// Secret signs bound URLs. Required.
+	Secret []byte
+	// BaseURL is where Handler or Gin is mounted, e.g.
+	// "https://im.example.com/object". Required.
+	BaseURL string
+	// Expire is the validity of bound URLs, defaults to 1 hour.
+	Expire time.Duration
+	// RedirectExpire is the validity of the presigned URL a valid request
+	// is redirected to, defaults to 1 minute.
+	RedirectExpire time.Duration
+	// Requester returns the user making a request, e.g. from a token
+	// cookie. When set, requests of other users than the bound one are
+	// denied; otherwise the binding is only logged.
+	Requester func(r *http.Request) (string, error)
+	// ClientIP returns the address a request comes from, checked against
+	// IP bindings. Defaults to the host of r.RemoteAddr; set it behind a
+	// trusted proxy, e.g. to network.RemoteIP, but never trust forwarding
+	// headers the client can set itself.
+	ClientIP func(r *http.Request) string
+	// OnAccess receives every access, e.g. to store access logs. Accesses
+	// are logged with log.ZInfo either way.
+	OnAccess func(ctx context.Context, a *Access)
+}
+
+// Signer issues and validates bound URLs.
+type Signer struct {
+	storage AccessURLer
+	conf    Config
+}
+
+func New(storage AccessURLer, conf Config) (*Signer, error) {
+	if len(conf.Secret) == 0 {
+		return nil, errs.ErrArgs.WrapMsg("urlbind secret is required")
+	}
+	if _, err := url.Parse(conf.BaseURL); err != nil || conf.BaseURL == "" {
+		return nil, errs.ErrArgs.WrapMsg("invalid urlbind base url", "baseURL", conf.BaseURL)
+	}
+	if conf.Expire <= 0 {
+		conf.Expire = time.Hour
+	}
+	if conf.RedirectExpire <= 0 {
+		conf.RedirectExpire = time.Minute
+	}
+	if conf.ClientIP == nil {
+		conf.ClientIP = remoteAddr
+	}
+	return &Signer{storage: storage, conf: conf}, nil
+}
+
+// URL returns a URL of name bound to claims and valid for expire, or
+// Config.Expire when zero. The IP is signed but not part of the URL.
+func (s *Signer) URL(name string, claims Claims, expire time.Duration, opt *s3.AccessURLOption) string {
+	if expire <= 0 {
+		expire = s.conf.Expire
+	}
+	query := url.Values{
+		paramName:    {name},
+		paramExpires: {strconv.FormatInt(time.Now().Add(expire).Unix(), 10)},
+	}
+	if claims.UserID != "" {
+		query.Set(paramUserID, claims.UserID)
+	}
+	if claims.IP != "" {
+		query.Set(paramBindIP, "1")
+	}
+	if opt != nil {
+		if opt.ContentType != "" {
+			query.Set(paramContentType, opt.ContentType)
+		}
+		if opt.Filename != "" {
+			query.Set(paramFilename, opt.Filename)
+		}
+	}
+	query.Set(paramSignature, s.sign(query, claims.IP))
+	return s.conf.BaseURL + "?" + query.Encode()
+}
+
+// sign signs the sorted query without the signature, and the bound IP.
+func (s *Signer) sign(query url.Values, ip string) string {
+	signed := make(url.Values, len(query))
+	for k, v := range query {
+		if k != paramSignature {
+			signed[k] = v
+		}
+	}
+	mac := hmac.New(sha256.New, s.conf.Secret)
+	mac.Write([]byte(signed.Encode()))
+	mac.Write([]byte{0})
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a request for a bound URL and returns the presigned URL to
+// redirect to. The access is logged whether or not it is allowed.
+func (s *Signer) Verify(r *http.Request) (string, error) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	a := &Access{
+		Name:      query.Get(paramName),
+		UserID:    query.Get(paramUserID),
+		IP:        s.conf.ClientIP(r),
+		UserAgent: r.UserAgent(),
+		Referer:   r.Referer(),
+	}
+	rawURL, err := s.verify(r, query, a)
+	a.Err = err
+	s.log(ctx, a)
+	return rawURL, err
+}
+
+// remoteAddr returns the host of r.RemoteAddr, the peer of the connection.
+func remoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *Signer) verify(r *http.Request, query url.Values, a *Access) (string, error) {
+	if a.Name == "" {
+		return "", errs.ErrArgs.WrapMsg("object name is required")
+	}
+	exp, err := strconv.ParseInt(query.Get(paramExpires), 10, 64)
+	if err != nil {
+		return "", errs.ErrTokenMalformed.WrapMsg("invalid url expiry")
+	}
+	a.Expires = time.Unix(exp, 0)
+	var ip string
+	if query.Get(paramBindIP) != "" {
+		ip = a.IP
+	}
+	if !hmac.Equal([]byte(s.sign(query, ip)), []byte(query.Get(paramSignature))) {
+		// With an IP binding a valid signature also fails from another IP.
+		return "", errs.ErrTokenInvalid.WrapMsg("invalid url signature", "name", a.Name)
+	}
+	if time.Now().After(a.Expires) {
+		return "", errs.ErrTokenExpired.WrapMsg("url expired", "name", a.Name, "expires", a.Expires)
+	}
+	if s.conf.Requester != nil && a.UserID != "" {
+		if a.Requester, err = s.conf.Requester(r); err != nil {
+			return "", err
+		}
+		if a.Requester != a.UserID {
+			return "", errs.ErrNoPermission.WrapMsg("url bound to another user", "name", a.Name, "userID", a.UserID, "requester", a.Requester)
+		}
+	}
+	var opt *s3.AccessURLOption
+	if ct, fn := query.Get(paramContentType), query.Get(paramFilename); ct != "" || fn != "" {
+		opt = &s3.AccessURLOption{ContentType: ct, Filename: fn}
+	}
+	return s.storage.AccessURL(r.Context(), a.Name, s.conf.RedirectExpire, opt)
+}
+
+func (s *Signer) log(ctx context.Context, a *Access) {
+	kv := []any{"name", a.Name, "userID", a.UserID, "requester", a.Requester, "ip", a.IP, "userAgent", a.UserAgent, "referer", a.Referer}
+	if a.Err != nil {
+		log.ZWarn(ctx, "bound url access denied", a.Err, kv...)
+	} else {
+		log.ZInfo(ctx, "bound url access", kv...)
+	}
+	if s.conf.OnAccess != nil {
+		s.conf.OnAccess(ctx, a)
+	}
+}
+
+// Handler redirects valid requests for bound URLs to a short-lived
+// presigned URL and answers others with an apiresp error.
+func (s *Signer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawURL, err := s.Verify(r)
+		if err != nil {
+			apiresp.HttpError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, rawURL, http.StatusFound)
+	})
+}
+
+// Gin is Handler for gin.
+func (s *Signer) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rawURL, err := s.Verify(c.Request)
+		if err != nil {
+			apiresp.GinError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, rawURL)
+	}
+}
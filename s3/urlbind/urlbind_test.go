@@ -0,0 +1,116 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package urlbind
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/s3"
+	"github.com/openimsdk/tools/s3/mock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(rawURL string, ip string, user string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, rawURL, nil)
+	r.RemoteAddr = ip + ":1234"
+	if user != "" {
+		r.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	return r
+}
+
+func TestSigner(t *testing.T) {
+	var accesses []*Access
+	storage := mock.NewStorage()
+	storage.PutObject("a/b.jpg", []byte("jpg"), "image/jpeg")
+	s, err := New(storage, Config{
+		Secret:  []byte("secret"),
+		BaseURL: "https://im.example.com/object",
+		Requester: func(r *http.Request) (string, error) {
+			c, err := r.Cookie("user")
+			if err != nil {
+				return "", errs.ErrTokenNotExist.WrapMsg("no user")
+			}
+			return c.Value, nil
+		},
+		OnAccess: func(ctx context.Context, a *Access) { accesses = append(accesses, a) },
+	})
+	require.NoError(t, err)
+
+	bound := s.URL("a/b.jpg", Claims{UserID: "u1", IP: "10.0.0.1"}, 0, &s3.AccessURLOption{Filename: "b.jpg"})
+	assert.True(t, strings.HasPrefix(bound, "https://im.example.com/object?"))
+	assert.NotContains(t, bound, "10.0.0.1")
+
+	rawURL, err := s.Verify(request(bound, "10.0.0.1", "u1"))
+	require.NoError(t, err)
+	assert.Contains(t, rawURL, "a/b.jpg")
+
+	_, err = s.Verify(request(bound, "10.0.0.2", "u1"))
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+	spoofed := request(bound, "10.0.0.2", "u1")
+	spoofed.Header.Set("X-Forwarded-For", "10.0.0.1")
+	_, err = s.Verify(spoofed)
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+	_, err = s.Verify(request(bound, "10.0.0.1", "u2"))
+	assert.True(t, errs.ErrNoPermission.Is(err))
+	_, err = s.Verify(request(strings.Replace(bound, "b.jpg", "c.jpg", 1), "10.0.0.1", "u1"))
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+
+	expired := s.URL("a/b.jpg", Claims{}, -time.Second, nil)
+	_, err = s.Verify(request(strings.Replace(expired, "exp=", "exp=1", 1), "10.0.0.3", ""))
+	assert.True(t, errs.ErrTokenInvalid.Is(err))
+
+	require.Len(t, accesses, 6)
+	assert.NoError(t, accesses[0].Err)
+	assert.Equal(t, "u2", accesses[3].Requester)
+	assert.Equal(t, "10.0.0.2", accesses[1].IP)
+}
+
+func TestHandler(t *testing.T) {
+	storage := mock.NewStorage()
+	storage.PutObject("a", []byte("a"), "")
+	s, err := New(storage, Config{Secret: []byte("secret"), BaseURL: "http://example.com/object", RedirectExpire: 30 * time.Second})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, request(s.URL("a", Claims{UserID: "u1"}, time.Minute, nil), "10.0.0.1", ""))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/a")
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, request(s.URL("a", Claims{}, time.Nanosecond, nil), "10.0.0.1", ""))
+	assert.Contains(t, w.Body.String(), "TokenExpiredError")
+}
+
+func TestClientIP(t *testing.T) {
+	storage := mock.NewStorage()
+	storage.PutObject("a", []byte("a"), "")
+	s, err := New(storage, Config{
+		Secret:   []byte("secret"),
+		BaseURL:  "http://example.com/object",
+		ClientIP: func(r *http.Request) string { return r.Header.Get("X-Real-IP") },
+	})
+	require.NoError(t, err)
+	r := request(s.URL("a", Claims{IP: "10.0.0.1"}, time.Minute, nil), "192.168.0.1", "")
+	r.Header.Set("X-Real-IP", "10.0.0.1")
+	_, err = s.Verify(r)
+	assert.NoError(t, err)
+}
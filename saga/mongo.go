@@ -0,0 +1,99 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore returns a Store keeping one document per saga in coll.
+func NewMongoStore(coll *mongo.Collection) *MongoStore {
+	return &MongoStore{coll: coll}
+}
+
+// MongoStore is a Store on a Mongo collection.
+type MongoStore struct {
+	coll *mongo.Collection
+}
+
+// EnsureIndexes creates the index Recoverable queries with.
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "locked_until", Value: 1}},
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create saga indexes failed", "collection", s.coll.Name())
+	}
+	return nil
+}
+
+func (s *MongoStore) Create(ctx context.Context, state *State) error {
+	state.Version = 1
+	if _, err := s.coll.InsertOne(ctx, state); err != nil {
+		state.Version = 0
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrExists.WrapMsg("saga id is in use", "id", state.ID)
+		}
+		return errs.WrapMsg(err, "insert saga failed", "id", state.ID)
+	}
+	return nil
+}
+
+func (s *MongoStore) Save(ctx context.Context, state *State) error {
+	next := *state
+	next.Version++
+	res, err := s.coll.ReplaceOne(ctx, bson.M{"_id": state.ID, "version": state.Version}, &next)
+	if err != nil {
+		return errs.WrapMsg(err, "save saga failed", "id", state.ID)
+	}
+	if res.MatchedCount == 0 {
+		return ErrConflict.WrapMsg("saga version mismatch", "id", state.ID, "version", state.Version)
+	}
+	state.Version = next.Version
+	return nil
+}
+
+func (s *MongoStore) Load(ctx context.Context, id string) (*State, error) {
+	var state State
+	if err := s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&state); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, errs.ErrRecordNotFound.WrapMsg("saga not found", "id", id)
+		}
+		return nil, errs.WrapMsg(err, "load saga failed", "id", id)
+	}
+	return &state, nil
+}
+
+func (s *MongoStore) Recoverable(ctx context.Context, now time.Time, limit int) ([]*State, error) {
+	filter := bson.M{
+		"status":       bson.M{"$in": []Status{StatusRunning, StatusCompensating}},
+		"locked_until": bson.M{"$lt": now},
+	}
+	cur, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "locked_until", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find recoverable sagas failed")
+	}
+	var states []*State
+	if err := cur.All(ctx, &states); err != nil {
+		return nil, errs.WrapMsg(err, "decode recoverable sagas failed")
+	}
+	return states, nil
+}
@@ -0,0 +1,166 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/redis/go-redis/v9"
+)
+
+// saveScript replaces the state when its version matches.
+// KEYS[1] state hash; ARGV[1] expected version, ARGV[2] new version,
+// ARGV[3] state JSON, ARGV[4] expiry in milliseconds or 0.
+var saveScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "v") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "v", ARGV[2], "s", ARGV[3])
+if tonumber(ARGV[4]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[4])
+end
+return 1
+`)
+
+// NewRedisStore returns a Store keeping sagas under keyPrefix, "SAGA:" when
+// empty. Finished sagas expire after retention; zero keeps them.
+func NewRedisStore(rdb redis.UniversalClient, keyPrefix string, retention time.Duration) Store {
+	if keyPrefix == "" {
+		keyPrefix = "SAGA:"
+	}
+	return &redisStore{rdb: rdb, prefix: keyPrefix, retention: retention}
+}
+
+// redisStore keeps each saga in a hash with its version and JSON state, and
+// the ids of unfinished sagas in a sorted set scored by lease expiry. The set
+// is updated after the hash, so Recoverable checks the loaded state again.
+type redisStore struct {
+	rdb       redis.UniversalClient
+	prefix    string
+	retention time.Duration
+}
+
+func (s *redisStore) key(id string) string {
+	return s.prefix + id
+}
+
+func (s *redisStore) pendingKey() string {
+	return s.prefix + "pending"
+}
+
+func (s *redisStore) Create(ctx context.Context, state *State) error {
+	ok, err := s.rdb.HSetNX(ctx, s.key(state.ID), "v", 1).Result()
+	if err != nil {
+		return errs.WrapMsg(err, "create saga failed", "id", state.ID)
+	}
+	if !ok {
+		return ErrExists.WrapMsg("saga id is in use", "id", state.ID)
+	}
+	state.Version = 1
+	data, err := jsonutil.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.HSet(ctx, s.key(state.ID), "s", data).Err(); err != nil {
+		return errs.WrapMsg(err, "create saga failed", "id", state.ID)
+	}
+	return s.track(ctx, state)
+}
+
+func (s *redisStore) Save(ctx context.Context, state *State) error {
+	next := *state
+	next.Version++
+	data, err := jsonutil.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	var expire int64
+	if next.Done() {
+		expire = s.retention.Milliseconds()
+	}
+	res, err := saveScript.Run(ctx, s.rdb, []string{s.key(state.ID)},
+		strconv.FormatInt(state.Version, 10), strconv.FormatInt(next.Version, 10), data, expire).Int()
+	if err != nil {
+		return errs.WrapMsg(err, "save saga failed", "id", state.ID)
+	}
+	if res == 0 {
+		return ErrConflict.WrapMsg("saga version mismatch", "id", state.ID, "version", state.Version)
+	}
+	state.Version = next.Version
+	return s.track(ctx, state)
+}
+
+func (s *redisStore) track(ctx context.Context, state *State) error {
+	var err error
+	if state.Done() {
+		err = s.rdb.ZRem(ctx, s.pendingKey(), state.ID).Err()
+	} else {
+		err = s.rdb.ZAdd(ctx, s.pendingKey(), redis.Z{Score: float64(state.LockedUntil.UnixMilli()), Member: state.ID}).Err()
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "update pending sagas failed", "id", state.ID)
+	}
+	return nil
+}
+
+func (s *redisStore) Load(ctx context.Context, id string) (*State, error) {
+	data, err := s.rdb.HGet(ctx, s.key(id), "s").Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, errs.ErrRecordNotFound.WrapMsg("saga not found", "id", id)
+		}
+		return nil, errs.WrapMsg(err, "load saga failed", "id", id)
+	}
+	var state State
+	if err := jsonutil.Unmarshal(data, &state); err != nil {
+		return nil, errs.WrapMsg(err, "decode saga failed", "id", id)
+	}
+	return &state, nil
+}
+
+func (s *redisStore) Recoverable(ctx context.Context, now time.Time, limit int) ([]*State, error) {
+	ids, err := s.rdb.ZRangeByScore(ctx, s.pendingKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   "(" + strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "list pending sagas failed")
+	}
+	states := make([]*State, 0, len(ids))
+	for _, id := range ids {
+		state, err := s.Load(ctx, id)
+		if err != nil {
+			if errors.Is(err, errs.ErrRecordNotFound) {
+				s.rdb.ZRem(ctx, s.pendingKey(), id)
+				continue
+			}
+			return nil, err
+		}
+		if state.Done() {
+			s.rdb.ZRem(ctx, s.pendingKey(), id)
+			continue
+		}
+		if state.LockedUntil.Before(now) {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
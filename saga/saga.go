@@ -0,0 +1,338 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package saga coordinates multi-service operations as sagas: a sequence of
+// steps, each with an action and a compensation that undoes it. When a step
+// fails, the completed steps are compensated in reverse order. Saga state is
+// persisted after every step, so sagas interrupted by a crash are resumed by
+// Recover on any instance.
+//
+// Steps run at least once and may run again after a crash, so actions and
+// compensations must be idempotent.
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+// Status of a saga.
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompensating Status = "compensating"
+	StatusCompleted    Status = "completed"
+	StatusCompensated  Status = "compensated"
+	// StatusFailed means compensation kept failing and needs manual repair.
+	StatusFailed Status = "failed"
+)
+
+var (
+	// ErrExists is returned by Store.Create for a duplicate saga id.
+	ErrExists = errs.New("saga already exists")
+	// ErrConflict is returned by Store.Save when the state changed since it was loaded.
+	ErrConflict = errs.New("saga state changed concurrently")
+	// ErrAborted wraps the step error of a saga that was compensated.
+	ErrAborted = errs.New("saga aborted")
+)
+
+// Data is the saga payload shared by its steps. Steps may add entries, e.g.
+// IDs created by one service that a later step or compensation needs.
+type Data map[string]string
+
+// Step is one action of a saga with its compensation.
+type Step struct {
+	Name       string
+	Do         func(ctx context.Context, data Data) error
+	Compensate func(ctx context.Context, data Data) error // Optional.
+}
+
+// Definition is a named sequence of steps. Definitions are registered on
+// every instance that may recover sagas.
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+// State is the persisted state of a saga.
+type State struct {
+	ID     string `json:"id" bson:"_id"`
+	Name   string `json:"name" bson:"name"`
+	Status Status `json:"status" bson:"status"`
+	// Step is the index of the next step to run while running, or of the
+	// next step to compensate while compensating.
+	Step     int    `json:"step" bson:"step"`
+	Data     Data   `json:"data" bson:"data"`
+	Error    string `json:"error,omitempty" bson:"error,omitempty"`
+	Attempts int    `json:"attempts" bson:"attempts"` // Failed compensation rounds.
+	// Owner holds the saga until LockedUntil; other instances recover it
+	// only after the lease expired.
+	Owner       string    `json:"owner" bson:"owner"`
+	LockedUntil time.Time `json:"lockedUntil" bson:"locked_until"`
+	CreatedAt   time.Time `json:"createdAt" bson:"created_at"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updated_at"`
+	Version     int64     `json:"version" bson:"version"`
+}
+
+// Done reports whether the saga reached a final status.
+func (s *State) Done() bool {
+	switch s.Status {
+	case StatusCompleted, StatusCompensated, StatusFailed:
+		return true
+	}
+	return false
+}
+
+// Store persists saga states. Save must only succeed when the stored version
+// equals state.Version, and increments it.
+type Store interface {
+	Create(ctx context.Context, state *State) error
+	Save(ctx context.Context, state *State) error
+	Load(ctx context.Context, id string) (*State, error)
+	// Recoverable returns up to limit unfinished sagas whose lease expired before now.
+	Recoverable(ctx context.Context, now time.Time, limit int) ([]*State, error)
+}
+
+// Config configures a Coordinator.
+type Config struct {
+	Lease time.Duration // How long a running saga is owned, defaults to 1 minute.
+	// StepRetries is how often a failing action or compensation is retried
+	// in place before the saga moves on, defaults to 2.
+	StepRetries int
+	RetryDelay  time.Duration // Delay between in-place retries, defaults to 200ms.
+	// MaxCompensationAttempts is how many recovery rounds a failing
+	// compensation gets before the saga is marked failed, defaults to 10.
+	MaxCompensationAttempts int
+	RecoverInterval         time.Duration // Poll interval of Run, defaults to 10 seconds.
+	Owner                   string        // Defaults to hostname and pid.
+}
+
+// Coordinator runs and recovers sagas.
+type Coordinator struct {
+	store Store
+	conf  Config
+	defs  map[string]*Definition
+}
+
+// New creates a Coordinator.
+func New(store Store, conf Config) *Coordinator {
+	if conf.Lease <= 0 {
+		conf.Lease = time.Minute
+	}
+	if conf.StepRetries < 0 {
+		conf.StepRetries = 0
+	} else if conf.StepRetries == 0 {
+		conf.StepRetries = 2
+	}
+	if conf.RetryDelay <= 0 {
+		conf.RetryDelay = 200 * time.Millisecond
+	}
+	if conf.MaxCompensationAttempts <= 0 {
+		conf.MaxCompensationAttempts = 10
+	}
+	if conf.RecoverInterval <= 0 {
+		conf.RecoverInterval = 10 * time.Second
+	}
+	if conf.Owner == "" {
+		host, _ := os.Hostname()
+		conf.Owner = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	return &Coordinator{store: store, conf: conf, defs: make(map[string]*Definition)}
+}
+
+// Register adds a definition. It must be called before Start and Recover.
+func (c *Coordinator) Register(def Definition) error {
+	if def.Name == "" || len(def.Steps) == 0 {
+		return errs.ErrArgs.WrapMsg("saga definition requires a name and steps")
+	}
+	if _, ok := c.defs[def.Name]; ok {
+		return errs.ErrArgs.WrapMsg("saga definition already registered", "name", def.Name)
+	}
+	for i, step := range def.Steps {
+		if step.Do == nil {
+			return errs.ErrArgs.WrapMsg("saga step has no action", "name", def.Name, "step", i)
+		}
+	}
+	c.defs[def.Name] = &def
+	return nil
+}
+
+// Start persists a new saga and runs it to completion. When a step fails and
+// the saga is compensated, the returned error wraps ErrAborted and the step
+// error. The state is returned together with any error once it was created.
+func (c *Coordinator) Start(ctx context.Context, name string, id string, data Data) (*State, error) {
+	def, ok := c.defs[name]
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("saga definition not registered", "name", name)
+	}
+	if data == nil {
+		data = make(Data)
+	}
+	now := time.Now().UTC()
+	state := &State{
+		ID:          id,
+		Name:        name,
+		Status:      StatusRunning,
+		Data:        data,
+		Owner:       c.conf.Owner,
+		LockedUntil: now.Add(c.conf.Lease),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := c.store.Create(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, c.execute(ctx, def, state)
+}
+
+// Get returns the state of a saga.
+func (c *Coordinator) Get(ctx context.Context, id string) (*State, error) {
+	return c.store.Load(ctx, id)
+}
+
+// Recover resumes unfinished sagas whose owner stopped renewing them and
+// returns how many were resumed.
+func (c *Coordinator) Recover(ctx context.Context) (int, error) {
+	states, err := c.store.Recoverable(ctx, time.Now().UTC(), 100)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, state := range states {
+		def, ok := c.defs[state.Name]
+		if !ok {
+			log.ZWarn(ctx, "saga definition not registered", nil, "id", state.ID, "name", state.Name)
+			continue
+		}
+		if err := c.save(ctx, state); err != nil {
+			if errors.Is(err, ErrConflict) {
+				continue // Another instance claimed it.
+			}
+			return n, err
+		}
+		n++
+		log.ZInfo(ctx, "recover saga", "id", state.ID, "name", state.Name, "status", state.Status, "step", state.Step)
+		if err := c.execute(ctx, def, state); err != nil && !errors.Is(err, ErrAborted) {
+			log.ZWarn(ctx, "recovered saga failed", err, "id", state.ID, "name", state.Name)
+		}
+	}
+	return n, nil
+}
+
+// Run calls Recover periodically until ctx is done.
+func (c *Coordinator) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.conf.RecoverInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Recover(ctx); err != nil && ctx.Err() == nil {
+			log.ZWarn(ctx, "saga recovery failed", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// save renews the lease and persists state.
+func (c *Coordinator) save(ctx context.Context, state *State) error {
+	return c.saveLease(ctx, state, c.conf.Lease)
+}
+
+// saveLease saves state owned for lease; zero releases it to recovery.
+func (c *Coordinator) saveLease(ctx context.Context, state *State, lease time.Duration) error {
+	now := time.Now().UTC()
+	state.Owner = c.conf.Owner
+	state.LockedUntil = now.Add(lease)
+	state.UpdatedAt = now
+	return c.store.Save(ctx, state)
+}
+
+func (c *Coordinator) execute(ctx context.Context, def *Definition, state *State) error {
+	for state.Status == StatusRunning && state.Step < len(def.Steps) {
+		step := def.Steps[state.Step]
+		if err := c.retry(ctx, func() error { return step.Do(ctx, state.Data) }); err != nil {
+			log.ZWarn(ctx, "saga step failed, compensating", err, "id", state.ID, "name", state.Name, "step", step.Name)
+			// The failed step is assumed not applied; compensate the ones before.
+			state.Status = StatusCompensating
+			state.Error = fmt.Sprintf("step %s: %v", step.Name, err)
+			state.Step--
+		} else {
+			state.Step++
+		}
+		if err := c.save(ctx, state); err != nil {
+			return err
+		}
+	}
+	if state.Status == StatusRunning {
+		state.Status = StatusCompleted
+		return c.save(ctx, state)
+	}
+	for state.Status == StatusCompensating && state.Step >= 0 {
+		step := def.Steps[state.Step]
+		if step.Compensate != nil {
+			if err := c.retry(ctx, func() error { return step.Compensate(ctx, state.Data) }); err != nil {
+				state.Attempts++
+				if state.Attempts >= c.conf.MaxCompensationAttempts {
+					state.Status = StatusFailed
+					log.ZError(ctx, "saga compensation failed permanently", err, "id", state.ID, "name", state.Name, "step", step.Name)
+				}
+				// Release the lease so the next recovery retries the compensation.
+				if serr := c.saveLease(ctx, state, 0); serr != nil {
+					return serr
+				}
+				return errs.WrapMsg(err, "saga compensation failed", "id", state.ID, "step", step.Name)
+			}
+		}
+		state.Step--
+		if err := c.save(ctx, state); err != nil {
+			return err
+		}
+	}
+	if state.Status == StatusCompensating {
+		state.Status = StatusCompensated
+		if err := c.save(ctx, state); err != nil {
+			return err
+		}
+	}
+	if state.Status == StatusFailed {
+		return ErrAborted.WrapMsg("saga compensation failed", "id", state.ID, "error", state.Error)
+	}
+	return ErrAborted.WrapMsg(state.Error, "id", state.ID)
+}
+
+func (c *Coordinator) retry(ctx context.Context, fn func() error) error {
+	var err error
+	for i := 0; i <= c.conf.StepRetries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return errs.Wrap(ctx.Err())
+			case <-time.After(c.conf.RetryDelay):
+			}
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
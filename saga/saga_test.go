@@ -0,0 +1,279 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu     sync.Mutex
+	states map[string]State
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{states: make(map[string]State)}
+}
+
+func (s *memoryStore) Create(ctx context.Context, state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.states[state.ID]; ok {
+		return ErrExists.WrapMsg("saga id is in use", "id", state.ID)
+	}
+	state.Version = 1
+	s.states[state.ID] = *state
+	return nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, state *State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states[state.ID].Version != state.Version {
+		return ErrConflict.WrapMsg("saga version mismatch", "id", state.ID)
+	}
+	state.Version++
+	s.states[state.ID] = *state
+	return nil
+}
+
+func (s *memoryStore) Load(ctx context.Context, id string) (*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		return nil, errs.ErrRecordNotFound.WrapMsg("saga not found", "id", id)
+	}
+	return &state, nil
+}
+
+func (s *memoryStore) Recoverable(ctx context.Context, now time.Time, limit int) ([]*State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var res []*State
+	for _, state := range s.states {
+		if !state.Done() && state.LockedUntil.Before(now) && len(res) < limit {
+			state := state
+			res = append(res, &state)
+		}
+	}
+	return res, nil
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) step(name string, fail error) Step {
+	return Step{
+		Name: name,
+		Do: func(ctx context.Context, data Data) error {
+			r.add("do " + name)
+			if fail != nil {
+				return fail
+			}
+			data[name] = "done"
+			return nil
+		},
+		Compensate: func(ctx context.Context, data Data) error {
+			r.add("undo " + name)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) add(call string) {
+	r.mu.Lock()
+	r.calls = append(r.calls, call)
+	r.mu.Unlock()
+}
+
+func testConfig() Config {
+	return Config{StepRetries: -1, RetryDelay: time.Millisecond, Owner: "test"}
+}
+
+func TestStartCompletes(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	c := New(store, testConfig())
+	var r recorder
+	require.NoError(t, c.Register(Definition{Name: "createGroup", Steps: []Step{r.step("group", nil), r.step("members", nil), r.step("conversation", nil)}}))
+
+	state, err := c.Start(ctx, "createGroup", "g1", Data{"owner": "u1"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, []string{"do group", "do members", "do conversation"}, r.calls)
+
+	stored, err := c.Get(ctx, "g1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, stored.Status)
+	assert.Equal(t, Data{"owner": "u1", "group": "done", "members": "done", "conversation": "done"}, stored.Data)
+
+	_, err = c.Start(ctx, "createGroup", "g1", nil)
+	assert.True(t, errors.Is(err, ErrExists))
+	_, err = c.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, errs.ErrRecordNotFound))
+}
+
+func TestStartCompensates(t *testing.T) {
+	ctx := context.Background()
+	c := New(newMemoryStore(), testConfig())
+	var r recorder
+	require.NoError(t, c.Register(Definition{Name: "createGroup", Steps: []Step{r.step("group", nil), r.step("members", nil), r.step("conversation", errors.New("unavailable"))}}))
+
+	state, err := c.Start(ctx, "createGroup", "g1", nil)
+	assert.True(t, errors.Is(err, ErrAborted))
+	assert.Equal(t, StatusCompensated, state.Status)
+	assert.Equal(t, -1, state.Step)
+	assert.Contains(t, state.Error, "conversation")
+	assert.Equal(t, []string{"do group", "do members", "do conversation", "undo members", "undo group"}, r.calls)
+}
+
+func TestStepRetries(t *testing.T) {
+	ctx := context.Background()
+	conf := testConfig()
+	conf.StepRetries = 2
+	c := New(newMemoryStore(), conf)
+	var calls int
+	require.NoError(t, c.Register(Definition{Name: "flaky", Steps: []Step{{Name: "flaky", Do: func(ctx context.Context, data Data) error {
+		if calls++; calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	}}}}))
+	state, err := c.Start(ctx, "flaky", "f1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	var r recorder
+	def := Definition{Name: "createGroup", Steps: []Step{r.step("group", nil), r.step("members", nil), r.step("conversation", nil)}}
+
+	// A crashed instance finished the first step and its lease expired.
+	crashed := &State{ID: "g1", Name: "createGroup", Status: StatusRunning, Step: 1, Data: Data{"group": "done"}, Owner: "crashed", LockedUntil: time.Now().Add(-time.Second)}
+	require.NoError(t, store.Create(ctx, crashed))
+	// Another instance is still working on this one.
+	busy := &State{ID: "g2", Name: "createGroup", Status: StatusRunning, Step: 1, Data: Data{}, Owner: "busy", LockedUntil: time.Now().Add(time.Minute)}
+	require.NoError(t, store.Create(ctx, busy))
+	// Compensation was interrupted.
+	undo := &State{ID: "g3", Name: "createGroup", Status: StatusCompensating, Step: 0, Data: Data{}, Owner: "crashed", LockedUntil: time.Now().Add(-time.Second)}
+	require.NoError(t, store.Create(ctx, undo))
+
+	c := New(store, testConfig())
+	require.NoError(t, c.Register(def))
+	n, err := c.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"do members", "do conversation", "undo group"}, r.calls)
+
+	state, err := c.Get(ctx, "g1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, state.Status)
+	assert.Equal(t, "test", state.Owner)
+	state, err = c.Get(ctx, "g2")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, state.Status)
+	state, err = c.Get(ctx, "g3")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, state.Status)
+}
+
+func TestCompensationFails(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	conf := testConfig()
+	conf.MaxCompensationAttempts = 2
+	c := New(store, conf)
+	require.NoError(t, c.Register(Definition{Name: "stuck", Steps: []Step{
+		{Name: "a", Do: func(ctx context.Context, data Data) error { return nil }, Compensate: func(ctx context.Context, data Data) error { return errors.New("down") }},
+		{Name: "b", Do: func(ctx context.Context, data Data) error { return errors.New("rejected") }},
+	}}))
+
+	state, err := c.Start(ctx, "stuck", "s1", nil)
+	require.Error(t, err)
+	assert.Equal(t, StatusCompensating, state.Status)
+	assert.Equal(t, 1, state.Attempts)
+
+	// The lease was released, recovery picks it up again right away.
+	time.Sleep(time.Millisecond)
+	n, err := c.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	state, err = c.Get(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, state.Status)
+	assert.Equal(t, 0, state.Step)
+}
+
+func TestRegister(t *testing.T) {
+	c := New(newMemoryStore(), testConfig())
+	assert.Error(t, c.Register(Definition{Name: "empty"}))
+	assert.Error(t, c.Register(Definition{Name: "noop", Steps: []Step{{Name: "a"}}}))
+	require.NoError(t, c.Register(Definition{Name: "ok", Steps: []Step{{Name: "a", Do: func(ctx context.Context, data Data) error { return nil }}}}))
+	assert.Error(t, c.Register(Definition{Name: "ok", Steps: []Step{{Name: "a", Do: func(ctx context.Context, data Data) error { return nil }}}}))
+	_, err := c.Start(context.Background(), "unknown", "x", nil)
+	assert.Error(t, err)
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	state := &State{ID: "s1", Name: "test", Status: StatusRunning, Data: Data{"k": "v"}, LockedUntil: time.Now().Add(-time.Second).UTC()}
+	require.NoError(t, store.Create(ctx, state))
+	assert.True(t, errors.Is(store.Create(ctx, &State{ID: "s1"}), ErrExists))
+
+	stale := *state
+	state.Step = 1
+	require.NoError(t, store.Save(ctx, state))
+	assert.True(t, errors.Is(store.Save(ctx, &stale), ErrConflict))
+
+	loaded, err := store.Load(ctx, "s1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, loaded.Step)
+	assert.Equal(t, state.Version, loaded.Version)
+
+	states, err := store.Recoverable(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+
+	state.Status = StatusCompleted
+	require.NoError(t, store.Save(ctx, state))
+	states, err = store.Recoverable(ctx, time.Now(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, states)
+}
+
+func TestMongoStore(t *testing.T) {
+	store := NewMongoStore(containers.Mongo(t, "saga").GetDB().Collection("saga"))
+	require.NoError(t, store.EnsureIndexes(context.Background()))
+	testStore(t, store)
+}
+
+func TestRedisStore(t *testing.T) {
+	testStore(t, NewRedisStore(containers.Redis(t), "SAGA_TEST:", time.Minute))
+}
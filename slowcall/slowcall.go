@@ -0,0 +1,243 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slowcall detects slow Mongo commands, Redis commands and gRPC client
+// calls. Calls above their threshold are counted and, sampled, logged with
+// their masked arguments, the code location that issued them and the
+// operationID of the request.
+package slowcall
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/openimsdk/tools/mw/recorder"
+	"github.com/openimsdk/tools/utils/randutil"
+)
+
+// Kinds of calls.
+const (
+	KindMongo = "mongo"
+	KindRedis = "redis"
+	KindGRPC  = "grpc"
+)
+
+// Config configures a Detector. A negative threshold disables detection for
+// its kind.
+type Config struct {
+	Mongo time.Duration // Defaults to 200ms.
+	Redis time.Duration // Defaults to 50ms.
+	GRPC  time.Duration // Defaults to 500ms.
+	// SampleRate is the fraction of slow calls that are logged, defaults to
+	// 1. Every slow call is counted.
+	SampleRate float64
+	// MaskFields lists argument keys whose values are hidden, defaults to
+	// recorder.DefaultMaskFields.
+	MaskFields []string
+	// MaxArgsLength truncates logged arguments, defaults to 512 bytes.
+	MaxArgsLength int
+	// OnSlow is called for every slow call, e.g. to feed a metrics system.
+	OnSlow func(ctx context.Context, call *Call)
+}
+
+// Call describes a slow call.
+type Call struct {
+	Kind        string
+	Name        string // Command or method name.
+	Duration    time.Duration
+	Args        string // Masked and truncated arguments.
+	Origin      string // Code location that issued the call.
+	OperationID string
+	Err         error
+}
+
+// Counter counts the slow calls of one command or method.
+type Counter struct {
+	Kind  string
+	Name  string
+	Slow  int64
+	Total time.Duration // Summed duration of the slow calls.
+	Max   time.Duration
+}
+
+type counterKey struct {
+	kind string
+	name string
+}
+
+// Detector observes calls. It is safe for concurrent use.
+type Detector struct {
+	conf   Config
+	masker *recorder.Masker
+
+	mu       sync.Mutex
+	counters map[counterKey]*Counter
+}
+
+// New creates a Detector.
+func New(conf Config) *Detector {
+	if conf.Mongo == 0 {
+		conf.Mongo = 200 * time.Millisecond
+	}
+	if conf.Redis == 0 {
+		conf.Redis = 50 * time.Millisecond
+	}
+	if conf.GRPC == 0 {
+		conf.GRPC = 500 * time.Millisecond
+	}
+	if conf.SampleRate <= 0 {
+		conf.SampleRate = 1
+	}
+	if conf.MaskFields == nil {
+		conf.MaskFields = recorder.DefaultMaskFields
+	}
+	if conf.MaxArgsLength <= 0 {
+		conf.MaxArgsLength = 512
+	}
+	return &Detector{
+		conf:     conf,
+		masker:   recorder.NewMasker(conf.MaskFields),
+		counters: make(map[counterKey]*Counter),
+	}
+}
+
+func (d *Detector) threshold(kind string) time.Duration {
+	switch kind {
+	case KindMongo:
+		return d.conf.Mongo
+	case KindRedis:
+		return d.conf.Redis
+	default:
+		return d.conf.GRPC
+	}
+}
+
+// Observe records a finished call. args is only evaluated for slow calls and
+// should return JSON. It is exported for calls the wrappers do not cover.
+func (d *Detector) Observe(ctx context.Context, kind string, name string, duration time.Duration, err error, args func() []byte) {
+	threshold := d.threshold(kind)
+	if threshold < 0 || duration < threshold {
+		return
+	}
+	d.mu.Lock()
+	key := counterKey{kind: kind, name: name}
+	c, ok := d.counters[key]
+	if !ok {
+		c = &Counter{Kind: kind, Name: name}
+		d.counters[key] = c
+	}
+	c.Slow++
+	c.Total += duration
+	if duration > c.Max {
+		c.Max = duration
+	}
+	sampled := randutil.Sample(d.conf.SampleRate)
+	d.mu.Unlock()
+	if !sampled && d.conf.OnSlow == nil {
+		return
+	}
+	call := &Call{
+		Kind:        kind,
+		Name:        name,
+		Duration:    duration,
+		Origin:      origin(),
+		OperationID: mcontext.GetOperationID(ctx),
+		Err:         err,
+	}
+	if args != nil {
+		call.Args = d.mask(args())
+	}
+	if sampled {
+		log.ZWarn(ctx, "slow call", err, "kind", kind, "name", name, "duration", duration,
+			"threshold", threshold, "origin", call.Origin, "args", call.Args)
+	}
+	if d.conf.OnSlow != nil {
+		d.conf.OnSlow(ctx, call)
+	}
+}
+
+func (d *Detector) mask(data []byte) string {
+	data = d.masker.Mask(data)
+	if len(data) > d.conf.MaxArgsLength {
+		return string(data[:d.conf.MaxArgsLength]) + "...(" + strconv.Itoa(len(data)) + " bytes)"
+	}
+	return string(data)
+}
+
+// Counters returns the slow call counters, most frequent first.
+func (d *Detector) Counters() []Counter {
+	d.mu.Lock()
+	res := make([]Counter, 0, len(d.counters))
+	for _, c := range d.counters {
+		res = append(res, *c)
+	}
+	d.mu.Unlock()
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Slow != res[j].Slow {
+			return res[i].Slow > res[j].Slow
+		}
+		return res[i].Kind+res[i].Name < res[j].Kind+res[j].Name
+	})
+	return res
+}
+
+// Reset clears the counters.
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	d.counters = make(map[counterKey]*Counter)
+	d.mu.Unlock()
+}
+
+// skipPrefixes are packages whose frames are not reported as origin.
+var skipPrefixes = []string{
+	"runtime.",
+	"github.com/openimsdk/tools/slowcall.",
+	"github.com/openimsdk/tools/mw.",
+	"github.com/openimsdk/tools/db/mongoutil.",
+	"go.mongodb.org/",
+	"github.com/redis/go-redis/",
+	"google.golang.org/grpc",
+}
+
+// origin returns the first frame on the stack outside the drivers and this
+// package, tests excepted.
+func origin() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !skipFrame(frame.Function) || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.Function + " " + frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+func skipFrame(function string) bool {
+	for _, prefix := range skipPrefixes {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
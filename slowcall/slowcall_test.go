@@ -0,0 +1,92 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowcall
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestObserve(t *testing.T) {
+	var calls []*Call
+	d := New(Config{Redis: 10 * time.Millisecond, MaxArgsLength: 40, OnSlow: func(ctx context.Context, call *Call) {
+		calls = append(calls, call)
+	}})
+	ctx := mcontext.SetOperationID(context.Background(), "op1")
+
+	d.Observe(ctx, KindRedis, "get", time.Millisecond, nil, nil)
+	assert.Empty(t, calls)
+
+	d.Observe(ctx, KindRedis, "get", 20*time.Millisecond, nil, func() []byte {
+		return []byte(`{"user":"u1","password":"secret"}`)
+	})
+	require.Len(t, calls, 1)
+	assert.Equal(t, "op1", calls[0].OperationID)
+	assert.NotContains(t, calls[0].Args, "secret")
+	assert.Contains(t, calls[0].Origin, "TestObserve")
+
+	d.Observe(ctx, KindRedis, "get", 30*time.Millisecond, nil, func() []byte {
+		return []byte(strings.Repeat("x", 100))
+	})
+	require.Len(t, calls, 2)
+	assert.True(t, strings.HasSuffix(calls[1].Args, "...(100 bytes)"))
+
+	assert.Equal(t, []Counter{{Kind: KindRedis, Name: "get", Slow: 2, Total: 50 * time.Millisecond, Max: 30 * time.Millisecond}}, d.Counters())
+	d.Reset()
+	assert.Empty(t, d.Counters())
+}
+
+func TestDisabled(t *testing.T) {
+	d := New(Config{Mongo: -1})
+	d.Observe(context.Background(), KindMongo, "find", time.Hour, nil, nil)
+	assert.Empty(t, d.Counters())
+}
+
+func TestRedisHook(t *testing.T) {
+	d := New(Config{Redis: time.Nanosecond})
+	hook := d.RedisHook()
+	cmd := redis.NewStringCmd(context.Background(), "set", "k", "v", "ex", 10)
+	process := hook.ProcessHook(func(ctx context.Context, cmd redis.Cmder) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	require.NoError(t, process(context.Background(), cmd))
+	counters := d.Counters()
+	require.Len(t, counters, 1)
+	assert.Equal(t, "set", counters[0].Name)
+	assert.Equal(t, `["set","k","... 3 more"]`, string(redisArgs(cmd)))
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	d := New(Config{GRPC: time.Nanosecond})
+	interceptor := d.UnaryClientInterceptor()
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	require.NoError(t, interceptor(context.Background(), "/user.user/GetUsers", map[string]string{"token": "t"}, nil, nil, invoker))
+	counters := d.Counters()
+	require.Len(t, counters, 1)
+	assert.Equal(t, KindGRPC, counters[0].Kind)
+	assert.Equal(t, "/user.user/GetUsers", counters[0].Name)
+}
@@ -0,0 +1,151 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowcall
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/event"
+	"google.golang.org/grpc"
+)
+
+// MongoMonitor returns a command monitor to set with
+// options.Client().SetMonitor.
+func (d *Detector) MongoMonitor() *event.CommandMonitor {
+	if d.conf.Mongo < 0 {
+		return &event.CommandMonitor{}
+	}
+	// Commands are kept between the started and finished events, keyed by
+	// request ID, so slow ones can be logged with their arguments.
+	var commands sync.Map
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			commands.Store(e.RequestID, startedCommand{db: e.DatabaseName, cmd: e.Command})
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			d.mongoFinished(ctx, &commands, e.CommandFinishedEvent, nil)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			d.mongoFinished(ctx, &commands, e.CommandFinishedEvent, mongoError(e.Failure))
+		},
+	}
+}
+
+type startedCommand struct {
+	db  string
+	cmd interface{ String() string }
+}
+
+type mongoError string
+
+func (e mongoError) Error() string { return string(e) }
+
+func (d *Detector) mongoFinished(ctx context.Context, commands *sync.Map, e event.CommandFinishedEvent, err error) {
+	v, ok := commands.LoadAndDelete(e.RequestID)
+	started, _ := v.(startedCommand)
+	name := e.CommandName
+	if ok {
+		name = started.db + "." + name
+	}
+	d.Observe(ctx, KindMongo, name, e.Duration, err, func() []byte {
+		if started.cmd == nil {
+			return nil
+		}
+		return []byte(started.cmd.String())
+	})
+}
+
+// RedisHook returns a hook to add with AddHook to a go-redis client.
+func (d *Detector) RedisHook() redis.Hook {
+	return redisHook{d: d}
+}
+
+type redisHook struct {
+	d *Detector
+}
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.d.Observe(ctx, KindRedis, cmd.Name(), time.Since(start), redisErr(err), func() []byte {
+			return redisArgs(cmd)
+		})
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+		h.d.Observe(ctx, KindRedis, "pipeline", time.Since(start), redisErr(err), func() []byte {
+			names := make([]string, len(cmds))
+			for i, cmd := range cmds {
+				names[i] = cmd.Name()
+			}
+			data, _ := json.Marshal(names)
+			return data
+		})
+		return err
+	}
+}
+
+// redisErr ignores redis.Nil, which only reports a missing key.
+func redisErr(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// redisArgs returns the command and its key; values may be sensitive and
+// large, so only their count is shown.
+func redisArgs(cmd redis.Cmder) []byte {
+	args := cmd.Args()
+	res := make([]any, 0, 3)
+	for i, arg := range args {
+		if i >= 2 {
+			res = append(res, "... "+strconv.Itoa(len(args)-2)+" more")
+			break
+		}
+		res = append(res, arg)
+	}
+	data, _ := json.Marshal(res)
+	return data
+}
+
+// UnaryClientInterceptor detects slow outgoing gRPC calls.
+func (d *Detector) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		d.Observe(ctx, KindGRPC, method, time.Since(start), err, func() []byte {
+			data, _ := json.Marshal(req)
+			return data
+		})
+		return err
+	}
+}
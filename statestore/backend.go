@@ -0,0 +1,135 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+// Backend stores raw snapshots by name. Load returns ErrNotFound when nothing
+// is stored and Delete ignores missing snapshots.
+type Backend interface {
+	Save(ctx context.Context, name string, data []byte) error
+	Load(ctx context.Context, name string) ([]byte, error)
+	Delete(ctx context.Context, name string) error
+}
+
+// NewFileBackend returns a Backend keeping one file per snapshot in dir,
+// which is created when missing. Files are replaced atomically so a crash
+// during a save leaves the previous snapshot intact.
+func NewFileBackend(dir string) Backend {
+	return &fileBackend{dir: dir}
+}
+
+type fileBackend struct {
+	dir string
+}
+
+func (b *fileBackend) path(name string) string {
+	return filepath.Join(b.dir, filepath.Base(name)+".json")
+}
+
+func (b *fileBackend) Save(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(b.dir, 0o755); err != nil {
+		return errs.WrapMsg(err, "create state dir failed", "dir", b.dir)
+	}
+	tmp, err := os.CreateTemp(b.dir, ".state-*")
+	if err != nil {
+		return errs.WrapMsg(err, "create state file failed", "dir", b.dir)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errs.WrapMsg(err, "write state file failed", "name", name)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errs.WrapMsg(err, "sync state file failed", "name", name)
+	}
+	if err := tmp.Close(); err != nil {
+		return errs.WrapMsg(err, "close state file failed", "name", name)
+	}
+	if err := os.Rename(tmp.Name(), b.path(name)); err != nil {
+		return errs.WrapMsg(err, "rename state file failed", "name", name)
+	}
+	return nil
+}
+
+func (b *fileBackend) Load(ctx context.Context, name string) ([]byte, error) {
+	data, err := os.ReadFile(b.path(name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound.WrapMsg("no state file", "name", name)
+		}
+		return nil, errs.WrapMsg(err, "read state file failed", "name", name)
+	}
+	return data, nil
+}
+
+func (b *fileBackend) Delete(ctx context.Context, name string) error {
+	if err := os.Remove(b.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errs.WrapMsg(err, "remove state file failed", "name", name)
+	}
+	return nil
+}
+
+// NewRedisBackend returns a Backend keeping snapshots under keyPrefix,
+// "STATE:" when empty. Snapshots expire after ttl unless it is zero, so state
+// of an instance that never comes back does not linger. Use a key prefix per
+// instance, e.g. including the pod name.
+func NewRedisBackend(rdb redis.UniversalClient, keyPrefix string, ttl time.Duration) Backend {
+	if keyPrefix == "" {
+		keyPrefix = "STATE:"
+	}
+	return &redisBackend{rdb: rdb, prefix: keyPrefix, ttl: ttl}
+}
+
+type redisBackend struct {
+	rdb    redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+func (b *redisBackend) Save(ctx context.Context, name string, data []byte) error {
+	if err := b.rdb.Set(ctx, b.prefix+name, data, b.ttl).Err(); err != nil {
+		return errs.WrapMsg(err, "save state failed", "name", name)
+	}
+	return nil
+}
+
+func (b *redisBackend) Load(ctx context.Context, name string) ([]byte, error) {
+	data, err := b.rdb.Get(ctx, b.prefix+name).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNotFound.WrapMsg("no state key", "name", name)
+		}
+		return nil, errs.WrapMsg(err, "load state failed", "name", name)
+	}
+	return data, nil
+}
+
+func (b *redisBackend) Delete(ctx context.Context, name string) error {
+	if err := b.rdb.Del(ctx, b.prefix+name).Err(); err != nil {
+		return errs.WrapMsg(err, "delete state failed", "name", name)
+	}
+	return nil
+}
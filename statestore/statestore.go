@@ -0,0 +1,236 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package statestore snapshots in-memory state, such as pending acks or local
+// queues, to disk or Redis on shutdown and restores it on startup. Every
+// snapshot carries a schema version and older snapshots are migrated step by
+// step before they are restored.
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+var (
+	// ErrNotFound is returned by a Backend when no snapshot is stored.
+	ErrNotFound = errs.New("state snapshot not found")
+	// ErrVersion is returned when a snapshot cannot be migrated to the
+	// current version.
+	ErrVersion = errs.New("unsupported state snapshot version")
+)
+
+// Migration converts the payload of a snapshot to the next version.
+type Migration func(data []byte) ([]byte, error)
+
+// Handler snapshots and restores one piece of state of type T, which must be
+// JSON serializable.
+type Handler[T any] struct {
+	Version  int // Current schema version, starting at 1 when zero.
+	Snapshot func(ctx context.Context) (T, error)
+	Restore  func(ctx context.Context, state T) error
+	// Migrations upgrade payloads keyed by the version they start from, e.g.
+	// Migrations[1] turns a version 1 payload into version 2.
+	Migrations map[int]Migration
+}
+
+type envelope struct {
+	Name    string          `json:"name"`
+	Version int             `json:"version"`
+	SavedAt time.Time       `json:"savedAt"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type component struct {
+	version  int
+	snapshot func(ctx context.Context) ([]byte, error)
+	restore  func(ctx context.Context, data []byte) error
+	migrate  map[int]Migration
+}
+
+// Store saves and restores registered state through a Backend.
+type Store struct {
+	backend Backend
+	mu      sync.Mutex
+	comps   map[string]*component
+}
+
+// New creates a Store.
+func New(backend Backend) *Store {
+	return &Store{backend: backend, comps: make(map[string]*component)}
+}
+
+// Register adds state under name. Registering a name twice replaces the
+// earlier handler.
+func Register[T any](s *Store, name string, h Handler[T]) {
+	if h.Version <= 0 {
+		h.Version = 1
+	}
+	c := &component{
+		version: h.Version,
+		migrate: h.Migrations,
+		snapshot: func(ctx context.Context) ([]byte, error) {
+			state, err := h.Snapshot(ctx)
+			if err != nil {
+				return nil, err
+			}
+			data, err := json.Marshal(state)
+			if err != nil {
+				return nil, errs.WrapMsg(err, "marshal state failed", "name", name)
+			}
+			return data, nil
+		},
+		restore: func(ctx context.Context, data []byte) error {
+			var state T
+			if err := json.Unmarshal(data, &state); err != nil {
+				return errs.WrapMsg(err, "unmarshal state failed", "name", name)
+			}
+			return h.Restore(ctx, state)
+		},
+	}
+	s.mu.Lock()
+	s.comps[name] = c
+	s.mu.Unlock()
+}
+
+func (s *Store) components() ([]string, map[string]*component) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.comps))
+	comps := make(map[string]*component, len(s.comps))
+	for name, c := range s.comps {
+		names = append(names, name)
+		comps[name] = c
+	}
+	sort.Strings(names)
+	return names, comps
+}
+
+// Save snapshots the named state.
+func (s *Store) Save(ctx context.Context, name string) error {
+	_, comps := s.components()
+	c, ok := comps[name]
+	if !ok {
+		return errs.ErrArgs.WrapMsg("state not registered", "name", name)
+	}
+	return s.save(ctx, name, c)
+}
+
+func (s *Store) save(ctx context.Context, name string, c *component) error {
+	data, err := c.snapshot(ctx)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(envelope{Name: name, Version: c.version, SavedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return errs.WrapMsg(err, "marshal state envelope failed", "name", name)
+	}
+	return s.backend.Save(ctx, name, raw)
+}
+
+// SaveAll snapshots every registered state, typically on shutdown. It keeps
+// going after a failure so one broken handler does not lose the others, and
+// returns the first error.
+func (s *Store) SaveAll(ctx context.Context) error {
+	names, comps := s.components()
+	var first error
+	for _, name := range names {
+		if err := s.save(ctx, name, comps[name]); err != nil {
+			log.ZError(ctx, "save state failed", err, "name", name)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Restore restores the named state and deletes its snapshot, so a later
+// restart does not restore it twice. It reports false when no snapshot was
+// stored.
+func (s *Store) Restore(ctx context.Context, name string) (bool, error) {
+	_, comps := s.components()
+	c, ok := comps[name]
+	if !ok {
+		return false, errs.ErrArgs.WrapMsg("state not registered", "name", name)
+	}
+	return s.restore(ctx, name, c)
+}
+
+func (s *Store) restore(ctx context.Context, name string, c *component) (bool, error) {
+	raw, err := s.backend.Load(ctx, name)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return false, errs.WrapMsg(err, "unmarshal state envelope failed", "name", name)
+	}
+	data, err := migrate(env.Data, env.Version, c.version, c.migrate)
+	if err != nil {
+		return false, errs.WrapMsg(err, "migrate state failed", "name", name)
+	}
+	if err := c.restore(ctx, data); err != nil {
+		return false, err
+	}
+	if err := s.backend.Delete(ctx, name); err != nil {
+		return true, err
+	}
+	log.ZInfo(ctx, "state restored", "name", name, "version", env.Version, "savedAt", env.SavedAt)
+	return true, nil
+}
+
+// RestoreAll restores every registered state that has a snapshot, typically
+// on startup. Like SaveAll it returns the first error after trying all.
+func (s *Store) RestoreAll(ctx context.Context) error {
+	names, comps := s.components()
+	var first error
+	for _, name := range names {
+		if _, err := s.restore(ctx, name, comps[name]); err != nil {
+			log.ZError(ctx, "restore state failed", err, "name", name)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// migrate upgrades data from version from to version to.
+func migrate(data []byte, from int, to int, migrations map[int]Migration) ([]byte, error) {
+	if from > to {
+		return nil, ErrVersion.WrapMsg("snapshot is newer than the handler", "version", from, "current", to)
+	}
+	for v := from; v < to; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return nil, ErrVersion.WrapMsg("no migration", "from", v, "to", v+1)
+		}
+		var err error
+		if data, err = m(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
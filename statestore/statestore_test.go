@@ -0,0 +1,109 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pending struct {
+	Acks []string `json:"acks"`
+}
+
+func TestSaveRestore(t *testing.T) {
+	ctx := context.Background()
+	backend := NewFileBackend(t.TempDir())
+
+	state := pending{Acks: []string{"a", "b"}}
+	s := New(backend)
+	Register(s, "acks", Handler[pending]{
+		Snapshot: func(ctx context.Context) (pending, error) { return state, nil },
+	})
+	require.NoError(t, s.SaveAll(ctx))
+
+	var restored pending
+	s = New(backend)
+	Register(s, "acks", Handler[pending]{
+		Restore: func(ctx context.Context, p pending) error {
+			restored = p
+			return nil
+		},
+	})
+	ok, err := s.Restore(ctx, "acks")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, state, restored)
+
+	ok, err = s.Restore(ctx, "acks")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	backend := NewFileBackend(t.TempDir())
+
+	s := New(backend)
+	Register(s, "acks", Handler[[]string]{
+		Snapshot: func(ctx context.Context) ([]string, error) { return []string{"a"}, nil },
+	})
+	require.NoError(t, s.SaveAll(ctx))
+
+	var restored pending
+	s = New(backend)
+	Register(s, "acks", Handler[pending]{
+		Version: 2,
+		Restore: func(ctx context.Context, p pending) error {
+			restored = p
+			return nil
+		},
+		Migrations: map[int]Migration{
+			1: func(data []byte) ([]byte, error) {
+				var acks []string
+				if err := json.Unmarshal(data, &acks); err != nil {
+					return nil, err
+				}
+				return json.Marshal(pending{Acks: acks})
+			},
+		},
+	})
+	require.NoError(t, s.RestoreAll(ctx))
+	assert.Equal(t, pending{Acks: []string{"a"}}, restored)
+
+	_, err := migrate(nil, 3, 2, nil)
+	assert.True(t, errors.Is(err, ErrVersion))
+	_, err = migrate(nil, 1, 3, map[int]Migration{1: func(b []byte) ([]byte, error) { return b, nil }})
+	assert.True(t, errors.Is(err, ErrVersion))
+}
+
+func TestRedisBackend(t *testing.T) {
+	ctx := context.Background()
+	b := NewRedisBackend(containers.Redis(t), "STATE_TEST:", time.Minute)
+	require.NoError(t, b.Save(ctx, "x", []byte("1")))
+	data, err := b.Load(ctx, "x")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), data)
+	require.NoError(t, b.Delete(ctx, "x"))
+	_, err = b.Load(ctx, "x")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
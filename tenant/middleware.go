@@ -0,0 +1,76 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/apiresp"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Gin reads the tenantID header into the gin context, where FromContext and
+// the mw interceptors find it. When required, requests without a tenant are
+// rejected; invalid tenant IDs are always rejected.
+func Gin(required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderTenantID)
+		if err := check(id, required); err != nil {
+			apiresp.GinError(c, err)
+			c.Abort()
+			return
+		}
+		if id != "" {
+			c.Set(mcontext.TenantID, id)
+		}
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor puts the tenant from the incoming metadata into the
+// context when RpcServerInterceptor has not already done so, and rejects calls
+// without a tenant when required. Chain it after RpcServerInterceptor so its
+// errors are converted to status codes.
+func UnaryServerInterceptor(required bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := mcontext.GetTenantID(ctx)
+		if id == "" {
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				if v := md.Get(HeaderTenantID); len(v) > 0 {
+					id = v[0]
+					ctx = mcontext.SetTenantID(ctx, id)
+				}
+			}
+		}
+		if err := check(id, required); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func check(id string, required bool) error {
+	if id == "" {
+		if required {
+			return errs.ErrArgs.WrapMsg("header must have tenantID")
+		}
+		return nil
+	}
+	return Validate(id)
+}
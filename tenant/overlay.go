@@ -0,0 +1,94 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+	"gopkg.in/yaml.v2"
+)
+
+// Overlays holds a default config and per-tenant variants of it.
+type Overlays[T any] struct {
+	def     T
+	tenants map[string]T
+}
+
+// LoadOverlays parses YAML with a default config and partial per-tenant
+// overlays:
+//
+//	default:
+//	  maxGroupMembers: 500
+//	  push: {enable: true}
+//	tenants:
+//	  acme:
+//	    maxGroupMembers: 2000
+//
+// Every tenant config starts as the default and takes the fields present in
+// its overlay. Nested maps are merged while lists are replaced.
+func LoadOverlays[T any](data []byte) (*Overlays[T], error) {
+	var raw struct {
+		Default any            `yaml:"default"`
+		Tenants map[string]any `yaml:"tenants"`
+	}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, errs.WrapMsg(err, "parse tenant overlays failed")
+	}
+	def, err := yaml.Marshal(raw.Default)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "encode default config failed")
+	}
+	o := &Overlays[T]{tenants: make(map[string]T, len(raw.Tenants))}
+	if err := yaml.Unmarshal(def, &o.def); err != nil {
+		return nil, errs.WrapMsg(err, "decode default config failed")
+	}
+	for id, overlay := range raw.Tenants {
+		if err := Validate(id); err != nil {
+			return nil, err
+		}
+		var conf T
+		if err := yaml.Unmarshal(def, &conf); err != nil {
+			return nil, errs.WrapMsg(err, "decode default config failed")
+		}
+		data, err := yaml.Marshal(overlay)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "encode tenant overlay failed", "tenantID", id)
+		}
+		if err := yaml.Unmarshal(data, &conf); err != nil {
+			return nil, errs.WrapMsg(err, "decode tenant overlay failed", "tenantID", id)
+		}
+		o.tenants[id] = conf
+	}
+	return o, nil
+}
+
+// Default returns the default config.
+func (o *Overlays[T]) Default() T {
+	return o.def
+}
+
+// For returns the config of the tenant, or the default without an overlay.
+func (o *Overlays[T]) For(id string) T {
+	if conf, ok := o.tenants[id]; ok {
+		return conf
+	}
+	return o.def
+}
+
+// Get returns the config of the tenant of ctx.
+func (o *Overlays[T]) Get(ctx context.Context) T {
+	return o.For(FromContext(ctx))
+}
@@ -0,0 +1,106 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tenant carries the tenant of a request for multi-tenant
+// deployments. The tenant ID travels in the context under mcontext.TenantID,
+// in the tenantID HTTP header and in gRPC metadata, which mw's interceptors
+// forward between services. Key helpers scope Redis keys, S3 object names and
+// Mongo collections per tenant, and Overlays resolves per-tenant config.
+package tenant
+
+import (
+	"context"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HeaderTenantID is the HTTP header and gRPC metadata key of the tenant ID.
+const HeaderTenantID = mcontext.TenantID
+
+const maxIDLength = 64
+
+// Validate checks that id is a usable tenant ID: 1 to 64 ASCII letters,
+// digits, '-' or '_'. The restriction keeps IDs safe to embed in keys,
+// object names and collection names.
+func Validate(id string) error {
+	if id == "" || len(id) > maxIDLength {
+		return errs.ErrArgs.WrapMsg("tenantID must have 1 to 64 characters", "tenantID", id)
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return errs.ErrArgs.WrapMsg("tenantID contains invalid characters", "tenantID", id)
+		}
+	}
+	return nil
+}
+
+// WithTenant returns a context carrying id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return mcontext.SetTenantID(ctx, id)
+}
+
+// FromContext returns the tenant ID of ctx, or an empty string.
+func FromContext(ctx context.Context) string {
+	return mcontext.GetTenantID(ctx)
+}
+
+// Must returns the tenant ID of ctx, or an error when ctx has none.
+func Must(ctx context.Context) (string, error) {
+	id := mcontext.GetTenantID(ctx)
+	if id == "" {
+		return "", errs.ErrArgs.WrapMsg("ctx missing tenantID")
+	}
+	return id, nil
+}
+
+// RedisKey prefixes key with the tenant of ctx, e.g. "T:acme:" + key.
+func RedisKey(ctx context.Context, key string) (string, error) {
+	id, err := Must(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "T:" + id + ":" + key, nil
+}
+
+// ObjectName places an S3 object name under the tenant of ctx, e.g.
+// "tenants/acme/" + name.
+func ObjectName(ctx context.Context, name string) (string, error) {
+	id, err := Must(ctx)
+	if err != nil {
+		return "", err
+	}
+	return "tenants/" + id + "/" + name, nil
+}
+
+// CollectionName returns the per-tenant name of a Mongo collection, e.g.
+// "acme_" + name.
+func CollectionName(ctx context.Context, name string) (string, error) {
+	id, err := Must(ctx)
+	if err != nil {
+		return "", err
+	}
+	return id + "_" + name, nil
+}
+
+// Collection returns the per-tenant collection of db named by CollectionName.
+func Collection(ctx context.Context, db *mongo.Database, name string) (*mongo.Collection, error) {
+	name, err := CollectionName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return db.Collection(name), nil
+}
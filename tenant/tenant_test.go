@@ -0,0 +1,152 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mcontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate("acme"))
+	assert.NoError(t, Validate("tenant_01-eu"))
+	for _, id := range []string{"", "a:b", "a/b", "a b", "ü", string(make([]byte, 65))} {
+		assert.Error(t, Validate(id), id)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	ctx := context.Background()
+	_, err := RedisKey(ctx, "seq")
+	assert.ErrorIs(t, err, errs.ErrArgs)
+
+	ctx = WithTenant(ctx, "acme")
+	assert.Equal(t, "acme", FromContext(ctx))
+	key, err := RedisKey(ctx, "seq:1")
+	require.NoError(t, err)
+	assert.Equal(t, "T:acme:seq:1", key)
+	name, err := ObjectName(ctx, "avatar/1.png")
+	require.NoError(t, err)
+	assert.Equal(t, "tenants/acme/avatar/1.png", name)
+	coll, err := CollectionName(ctx, "msg")
+	require.NoError(t, err)
+	assert.Equal(t, "acme_msg", coll)
+}
+
+func TestGin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	serve := func(required bool, id string) (int, string) {
+		r := gin.New()
+		var got string
+		r.Use(Gin(required))
+		r.GET("/", func(c *gin.Context) {
+			got = FromContext(c)
+			c.Status(http.StatusNoContent)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if id != "" {
+			req.Header.Set(HeaderTenantID, id)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, got
+	}
+	code, got := serve(true, "acme")
+	assert.Equal(t, http.StatusNoContent, code)
+	assert.Equal(t, "acme", got)
+	code, _ = serve(false, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	// apiresp reports errors in the body with status 200.
+	code, got = serve(true, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, got)
+	code, got = serve(false, "bad:id")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, got)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/group.group/createGroup"}
+	var got string
+	handler := func(ctx context.Context, req any) (any, error) {
+		got = mcontext.GetTenantID(ctx)
+		return nil, nil
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(HeaderTenantID, "acme"))
+	_, err := UnaryServerInterceptor(true)(ctx, nil, info, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", got)
+
+	_, err = UnaryServerInterceptor(true)(context.Background(), nil, info, handler)
+	assert.ErrorIs(t, err, errs.ErrArgs)
+	_, err = UnaryServerInterceptor(false)(context.Background(), nil, info, handler)
+	assert.NoError(t, err)
+}
+
+type pushConfig struct {
+	Enable bool   `yaml:"enable"`
+	Vendor string `yaml:"vendor"`
+}
+
+type testConfig struct {
+	MaxGroupMembers int            `yaml:"maxGroupMembers"`
+	Features        []string       `yaml:"features"`
+	Limits          map[string]int `yaml:"limits"`
+	Push            pushConfig     `yaml:"push"`
+}
+
+func TestOverlays(t *testing.T) {
+	o, err := LoadOverlays[testConfig]([]byte(`
+default:
+  maxGroupMembers: 500
+  features: [chat, call]
+  limits: {send: 10, upload: 5}
+  push: {enable: true, vendor: fcm}
+tenants:
+  acme:
+    maxGroupMembers: 2000
+    features: [chat]
+    limits: {send: 50}
+    push: {vendor: jpush}
+`))
+	require.NoError(t, err)
+
+	def := o.Default()
+	assert.Equal(t, 500, def.MaxGroupMembers)
+	assert.Equal(t, map[string]int{"send": 10, "upload": 5}, def.Limits)
+
+	acme := o.Get(WithTenant(context.Background(), "acme"))
+	assert.Equal(t, 2000, acme.MaxGroupMembers)
+	assert.Equal(t, []string{"chat"}, acme.Features)
+	assert.Equal(t, map[string]int{"send": 50, "upload": 5}, acme.Limits)
+	assert.True(t, acme.Push.Enable)
+	assert.Equal(t, "jpush", acme.Push.Vendor)
+
+	assert.Equal(t, def, o.For("other"))
+	assert.Equal(t, map[string]int{"send": 10, "upload": 5}, o.Default().Limits)
+
+	_, err = LoadOverlays[testConfig]([]byte("tenants:\n  \"a:b\": {}\n"))
+	assert.Error(t, err)
+}
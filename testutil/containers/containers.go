@@ -0,0 +1,192 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package containers starts throwaway infrastructure containers for integration tests using the docker CLI.
+// Every helper skips the test when docker is unavailable, waits until the service accepts connections,
+// and removes the container when the test finishes.
+package containers
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// StartTimeout bounds how long a helper waits for a container to become ready.
+var StartTimeout = 2 * time.Minute
+
+// Spec describes a container to run.
+type Spec struct {
+	Image string
+	Env   map[string]string
+	Cmd   []string
+	// Ports are container ports (e.g. "6379/tcp") published on a random loopback port.
+	Ports []string
+	// FixedPorts publishes container ports on the given host ports, for services that must advertise
+	// their external address (e.g. Kafka).
+	FixedPorts map[string]int
+}
+
+// Container is a running container.
+type Container struct {
+	ID    string
+	Image string
+	ports map[string]string
+}
+
+// Addr returns the host:port the container port is published on.
+func (c *Container) Addr(port string) string {
+	return c.ports[normalizePort(port)]
+}
+
+var (
+	availableOnce sync.Once
+	available     bool
+)
+
+// Available reports whether a docker daemon is reachable.
+func Available() bool {
+	availableOnce.Do(func() {
+		if _, err := exec.LookPath("docker"); err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		available = exec.CommandContext(ctx, "docker", "info").Run() == nil
+	})
+	return available
+}
+
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", errs.WrapMsg(err, "docker command failed", "args", strings.Join(args, " "), "stderr", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+func normalizePort(port string) string {
+	if !strings.Contains(port, "/") {
+		return port + "/tcp"
+	}
+	return port
+}
+
+// Run starts the container described by spec and registers its removal with t.Cleanup.
+// The test is skipped when docker is unavailable.
+func Run(t testing.TB, spec Spec) *Container {
+	t.Helper()
+	if !Available() {
+		t.Skip("docker is not available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	defer cancel()
+	c, err := start(ctx, spec)
+	if c != nil {
+		t.Cleanup(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			_, _ = docker(ctx, "rm", "-f", "-v", c.ID)
+		})
+	}
+	if err != nil {
+		t.Fatalf("start container %s: %v", spec.Image, err)
+	}
+	return c
+}
+
+func start(ctx context.Context, spec Spec) (*Container, error) {
+	args := []string{"run", "-d", "--label", "openim.testutil=true"}
+	for k, v := range spec.Env {
+		args = append(args, "-e", k+"="+v)
+	}
+	for _, p := range spec.Ports {
+		args = append(args, "-p", "127.0.0.1::"+normalizePort(p))
+	}
+	for p, host := range spec.FixedPorts {
+		args = append(args, "-p", "127.0.0.1:"+strconv.Itoa(host)+":"+normalizePort(p))
+	}
+	args = append(args, spec.Image)
+	args = append(args, spec.Cmd...)
+	id, err := docker(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	c := &Container{ID: id, Image: spec.Image, ports: make(map[string]string)}
+	for _, p := range spec.Ports {
+		out, err := docker(ctx, "port", id, normalizePort(p))
+		if err != nil {
+			return c, err
+		}
+		// Output may list several bindings (IPv4 and IPv6); the first is ours.
+		c.ports[normalizePort(p)] = strings.TrimSpace(strings.Split(out, "\n")[0])
+	}
+	for p, host := range spec.FixedPorts {
+		c.ports[normalizePort(p)] = net.JoinHostPort("127.0.0.1", strconv.Itoa(host))
+	}
+	return c, nil
+}
+
+// Logs returns the container output, useful when a readiness wait fails.
+func (c *Container) Logs(ctx context.Context) string {
+	out, err := docker(ctx, "logs", "--tail", "100", c.ID)
+	if err != nil {
+		return err.Error()
+	}
+	return out
+}
+
+// WaitReady calls fn until it succeeds or StartTimeout expires, then fails the test with the container logs.
+func WaitReady(t testing.TB, c *Container, fn func(ctx context.Context) error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	defer cancel()
+	var err error
+	for {
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, 5*time.Second)
+		err = fn(attemptCtx)
+		attemptCancel()
+		if err == nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			logCtx, logCancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer logCancel()
+			t.Fatalf("container %s not ready: %v\n%s", c.Image, err, c.Logs(logCtx))
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// FreePort returns a currently unused loopback TCP port.
+func FreePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, errs.WrapMsg(err, "listen failed")
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
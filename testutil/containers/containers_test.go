@@ -0,0 +1,40 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis(t *testing.T) {
+	cli := Redis(t)
+	ctx := context.Background()
+	require.NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	v, err := cli.Get(ctx, "k").Result()
+	require.NoError(t, err)
+	assert.Equal(t, "v", v)
+}
+
+func TestFreePort(t *testing.T) {
+	port, err := FreePort()
+	require.NoError(t, err)
+	assert.Greater(t, port, 0)
+	assert.Equal(t, "6379/tcp", normalizePort("6379"))
+	assert.Equal(t, "53/udp", normalizePort("53/udp"))
+}
@@ -0,0 +1,192 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package containers
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/openimsdk/tools/db/mongoutil"
+	"github.com/openimsdk/tools/db/redisutil"
+	"github.com/openimsdk/tools/discovery/etcd"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/mq/kafka"
+	"github.com/openimsdk/tools/s3/minio"
+	"github.com/redis/go-redis/v9"
+)
+
+// Pinned images. Override before starting containers to test against other versions.
+var (
+	MongoImage = "mongo:7.0.12"
+	RedisImage = "redis:7.2.5"
+	KafkaImage = "apache/kafka:3.7.0"
+	MinIOImage = "minio/minio:RELEASE.2024-05-10T01-41-38Z"
+	EtcdImage  = "quay.io/coreos/etcd:v3.5.13"
+)
+
+const (
+	MinIOAccessKey = "openim-test"
+	MinIOSecretKey = "openim-test-secret"
+	MinIOBucket    = "openim"
+)
+
+// Mongo starts MongoDB and returns a client for database.
+func Mongo(t testing.TB, database string) *mongoutil.Client {
+	t.Helper()
+	c := Run(t, Spec{Image: MongoImage, Ports: []string{"27017"}})
+	conf := &mongoutil.Config{Uri: "mongodb://" + c.Addr("27017"), Database: database, MaxRetry: 1}
+	var cli *mongoutil.Client
+	WaitReady(t, c, func(ctx context.Context) (err error) {
+		cli, err = mongoutil.NewMongoDB(ctx, conf)
+		return err
+	})
+	t.Cleanup(func() {
+		_ = cli.GetDB().Client().Disconnect(context.Background())
+	})
+	return cli
+}
+
+// Redis starts Redis and returns a connected client.
+func Redis(t testing.TB) redis.UniversalClient {
+	t.Helper()
+	c := Run(t, Spec{Image: RedisImage, Ports: []string{"6379"}})
+	conf := &redisutil.Config{Address: []string{c.Addr("6379")}}
+	var cli redis.UniversalClient
+	WaitReady(t, c, func(ctx context.Context) (err error) {
+		cli, err = redisutil.NewRedisClient(ctx, conf)
+		return err
+	})
+	t.Cleanup(func() {
+		_ = cli.Close()
+	})
+	return cli
+}
+
+// Kafka is a single node KRaft broker.
+type Kafka struct {
+	Config   kafka.Config
+	Producer sarama.SyncProducer
+}
+
+// KafkaBroker starts a single node broker and returns its config along with a connected producer.
+func KafkaBroker(t testing.TB) *Kafka {
+	t.Helper()
+	port, err := FreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Run(t, Spec{
+		Image:      KafkaImage,
+		FixedPorts: map[string]int{"9092": port},
+		Env: map[string]string{
+			"KAFKA_NODE_ID":                                  "1",
+			"KAFKA_PROCESS_ROLES":                            "broker,controller",
+			"KAFKA_LISTENERS":                                "PLAINTEXT://:9092,CONTROLLER://:9093",
+			"KAFKA_ADVERTISED_LISTENERS":                     "PLAINTEXT://127.0.0.1:" + strconv.Itoa(port),
+			"KAFKA_CONTROLLER_LISTENER_NAMES":                "CONTROLLER",
+			"KAFKA_LISTENER_SECURITY_PROTOCOL_MAP":           "CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+			"KAFKA_CONTROLLER_QUORUM_VOTERS":                 "1@localhost:9093",
+			"KAFKA_OFFSETS_TOPIC_REPLICATION_FACTOR":         "1",
+			"KAFKA_TRANSACTION_STATE_LOG_REPLICATION_FACTOR": "1",
+			"KAFKA_TRANSACTION_STATE_LOG_MIN_ISR":            "1",
+			"KAFKA_GROUP_INITIAL_REBALANCE_DELAY_MS":         "0",
+		},
+	})
+	k := &Kafka{Config: kafka.Config{Addr: []string{c.Addr("9092")}}}
+	conf, err := kafka.BuildProducerConfig(k.Config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	WaitReady(t, c, func(ctx context.Context) (err error) {
+		k.Producer, err = kafka.NewProducer(conf, k.Config.Addr)
+		return err
+	})
+	t.Cleanup(func() {
+		_ = k.Producer.Close()
+	})
+	return k
+}
+
+// MinIO starts MinIO and returns an s3 implementation using MinIOBucket.
+func MinIO(t testing.TB) *minio.Minio {
+	t.Helper()
+	c := Run(t, Spec{
+		Image: MinIOImage,
+		Ports: []string{"9000"},
+		Env:   map[string]string{"MINIO_ROOT_USER": MinIOAccessKey, "MINIO_ROOT_PASSWORD": MinIOSecretKey},
+		Cmd:   []string{"server", "/data"},
+	})
+	conf := minio.Config{
+		Bucket:          MinIOBucket,
+		Endpoint:        "http://" + c.Addr("9000"),
+		AccessKeyID:     MinIOAccessKey,
+		SecretAccessKey: MinIOSecretKey,
+	}
+	var impl *minio.Minio
+	WaitReady(t, c, func(ctx context.Context) (err error) {
+		impl, err = minio.NewMinio(ctx, noCache{}, conf)
+		return err
+	})
+	return impl
+}
+
+// Etcd starts etcd and returns a discovery registry rooted at rootDirectory.
+func Etcd(t testing.TB, rootDirectory string) *etcd.SvcDiscoveryRegistryImpl {
+	t.Helper()
+	c := Run(t, Spec{
+		Image: EtcdImage,
+		Ports: []string{"2379"},
+		Cmd: []string{"etcd",
+			"--listen-client-urls", "http://0.0.0.0:2379",
+			"--advertise-client-urls", "http://0.0.0.0:2379",
+		},
+	})
+	endpoint := c.Addr("2379")
+	var reg *etcd.SvcDiscoveryRegistryImpl
+	WaitReady(t, c, func(ctx context.Context) (err error) {
+		reg, err = etcd.NewSvcDiscoveryRegistry(rootDirectory, []string{endpoint}, nil)
+		if err != nil {
+			return err
+		}
+		if _, err = reg.GetClient().Status(ctx, endpoint); err != nil {
+			reg.Close()
+			return errs.WrapMsg(err, "etcd status failed")
+		}
+		return nil
+	})
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+// noCache is a minio.Cache that always loads.
+type noCache struct{}
+
+func (noCache) GetImageObjectKeyInfo(ctx context.Context, key string, fn func(ctx context.Context) (*minio.ImageInfo, error)) (*minio.ImageInfo, error) {
+	return fn(ctx)
+}
+
+func (noCache) GetThumbnailKey(ctx context.Context, key string, format string, width int, height int, minioCache func(ctx context.Context) (string, error)) (string, error) {
+	return minioCache(ctx)
+}
+
+func (noCache) DelObjectImageInfoKey(ctx context.Context, keys ...string) error {
+	return nil
+}
+
+func (noCache) DelImageThumbnailKey(ctx context.Context, key string, format string, width int, height int) error {
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen
+
+import (
+	"math/rand"
+	"strings"
+)
+
+// IntRange generates ints in [min, max], shrinking towards the value closest to zero.
+func IntRange(min, max int) Gen[int] {
+	target := 0
+	if min > 0 {
+		target = min
+	} else if max < 0 {
+		target = max
+	}
+	return New(func(r *rand.Rand) int {
+		return min + r.Intn(max-min+1)
+	}, func(v int) []int {
+		return shrinkInt(v, target)
+	})
+}
+
+// Int generates ints in [-1000, 1000].
+func Int() Gen[int] {
+	return IntRange(-1000, 1000)
+}
+
+func shrinkInt(v, target int) []int {
+	if v == target {
+		return nil
+	}
+	res := []int{target}
+	for d := (v - target) / 2; d != 0; d /= 2 {
+		res = append(res, v-d)
+	}
+	if step := v - sign(v-target); step != target {
+		res = append(res, step)
+	}
+	return res
+}
+
+func sign(v int) int {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Int64Range generates int64 values in [min, max].
+func Int64Range(min, max int64) Gen[int64] {
+	g := IntRange(int(min), int(max))
+	return New(func(r *rand.Rand) int64 {
+		return min + r.Int63n(max-min+1)
+	}, func(v int64) []int64 {
+		vs := g.Shrink(int(v))
+		res := make([]int64, len(vs))
+		for i, x := range vs {
+			res[i] = int64(x)
+		}
+		return res
+	})
+}
+
+// Bool generates true or false, shrinking towards false.
+func Bool() Gen[bool] {
+	return New(func(r *rand.Rand) bool {
+		return r.Intn(2) == 1
+	}, func(v bool) []bool {
+		if v {
+			return []bool{false}
+		}
+		return nil
+	})
+}
+
+const (
+	Alpha        = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	AlphaNumeric = Alpha + "0123456789"
+)
+
+// StringOf generates strings of up to maxLen characters drawn from alphabet.
+func StringOf(alphabet string, maxLen int) Gen[string] {
+	runes := []rune(alphabet)
+	return New(func(r *rand.Rand) string {
+		n := r.Intn(maxLen + 1)
+		var sb strings.Builder
+		for range n {
+			sb.WriteRune(runes[r.Intn(len(runes))])
+		}
+		return sb.String()
+	}, func(v string) []string {
+		rs := []rune(v)
+		shrunk := shrinkSlice(rs, func(c rune) []rune {
+			if c == runes[0] {
+				return nil
+			}
+			return []rune{runes[0]}
+		})
+		res := make([]string, len(shrunk))
+		for i, s := range shrunk {
+			res[i] = string(s)
+		}
+		return res
+	})
+}
+
+// String generates alphanumeric strings of up to 16 characters.
+func String() Gen[string] {
+	return StringOf(AlphaNumeric, 16)
+}
+
+// SliceOf generates slices of up to maxLen elements. Shrinking removes chunks and single elements,
+// then shrinks individual elements.
+func SliceOf[T any](g Gen[T], maxLen int) Gen[[]T] {
+	return New(func(r *rand.Rand) []T {
+		n := r.Intn(maxLen + 1)
+		s := make([]T, n)
+		for i := range s {
+			s[i] = g.Generate(r)
+		}
+		return s
+	}, func(v []T) [][]T {
+		return shrinkSlice(v, g.Shrink)
+	})
+}
+
+func shrinkSlice[T any](v []T, shrinkElem func(T) []T) [][]T {
+	if len(v) == 0 {
+		return nil
+	}
+	res := [][]T{nil}
+	// Drop halves, quarters, ... then single elements.
+	for size := len(v) / 2; size > 0; size /= 2 {
+		for start := 0; start+size <= len(v); start += size {
+			res = append(res, concat(v[:start], v[start+size:]))
+		}
+	}
+	for i := range v {
+		for _, e := range shrinkElem(v[i]) {
+			cp := append([]T(nil), v...)
+			cp[i] = e
+			res = append(res, cp)
+		}
+	}
+	return res
+}
+
+func concat[T any](a, b []T) []T {
+	res := make([]T, 0, len(a)+len(b))
+	return append(append(res, a...), b...)
+}
+
+// MapOf generates maps of up to maxLen entries. Shrinking removes entries and shrinks values.
+func MapOf[K comparable, V any](kg Gen[K], vg Gen[V], maxLen int) Gen[map[K]V] {
+	type entry struct {
+		k K
+		v V
+	}
+	entries := SliceOf(New(func(r *rand.Rand) entry {
+		return entry{kg.Generate(r), vg.Generate(r)}
+	}, func(e entry) []entry {
+		var res []entry
+		for _, v := range vg.Shrink(e.v) {
+			res = append(res, entry{e.k, v})
+		}
+		return res
+	}), maxLen)
+	toMap := func(es []entry) map[K]V {
+		m := make(map[K]V, len(es))
+		for _, e := range es {
+			m[e.k] = e.v
+		}
+		return m
+	}
+	return New(func(r *rand.Rand) map[K]V {
+		return toMap(entries.Generate(r))
+	}, func(m map[K]V) []map[K]V {
+		es := make([]entry, 0, len(m))
+		for k, v := range m {
+			es = append(es, entry{k, v})
+		}
+		var res []map[K]V
+		for _, s := range entries.Shrink(es) {
+			res = append(res, toMap(s))
+		}
+		return res
+	})
+}
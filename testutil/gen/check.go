@@ -0,0 +1,114 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen
+
+import (
+	"flag"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+var (
+	seedFlag       = flag.Int64("gen.seed", 0, "seed for property based tests; 0 picks a random seed")
+	iterationsFlag = flag.Int("gen.iterations", 100, "number of cases per property")
+)
+
+// maxShrinkSteps bounds the shrinking search.
+const maxShrinkSteps = 1000
+
+type config struct {
+	seed       int64
+	iterations int
+}
+
+type Option func(*config)
+
+// Seed fixes the random seed, e.g. to replay a reported failure.
+func Seed(seed int64) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// Iterations sets the number of generated cases.
+func Iterations(n int) Option {
+	return func(c *config) {
+		c.iterations = n
+	}
+}
+
+// Check runs prop against generated values. On failure the value is shrunk to a minimal counterexample,
+// which is reported together with the seed needed to reproduce it.
+func Check[T any](t testing.TB, g Gen[T], prop func(v T) bool, opts ...Option) bool {
+	t.Helper()
+	return CheckErr(t, g, func(v T) error {
+		if !prop(v) {
+			return errPropertyFalse
+		}
+		return nil
+	}, opts...)
+}
+
+var errPropertyFalse = errs.New("property returned false")
+
+// CheckErr is Check for properties that explain failures with an error.
+func CheckErr[T any](t testing.TB, g Gen[T], prop func(v T) error, opts ...Option) bool {
+	t.Helper()
+	c := config{seed: *seedFlag, iterations: *iterationsFlag}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.seed == 0 {
+		c.seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(c.seed))
+	for i := range c.iterations {
+		v := g.Generate(r)
+		err := prop(v)
+		if err == nil {
+			continue
+		}
+		shrunk, shrunkErr, steps := shrink(g, v, err, prop)
+		t.Errorf("property failed after %d cases (seed %d, %d shrink steps)\noriginal: %#v\nshrunk:   %#v\nerror:    %v",
+			i+1, c.seed, steps, v, shrunk, shrunkErr)
+		return false
+	}
+	return true
+}
+
+// shrink greedily replaces v with the first simpler candidate that still fails.
+func shrink[T any](g Gen[T], v T, err error, prop func(v T) error) (T, error, int) {
+	steps := 0
+	for steps < maxShrinkSteps {
+		improved := false
+		for _, c := range g.Shrink(v) {
+			steps++
+			if cerr := prop(c); cerr != nil {
+				v, err, improved = c, cerr, true
+				break
+			}
+			if steps >= maxShrinkSteps {
+				break
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return v, err, steps
+}
@@ -0,0 +1,72 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gen provides random value generators with shrinking for property based tests.
+//
+//	gen.Check(t, gen.SliceOf(gen.IntRange(0, 10), 20), func(s []int) bool {
+//		return len(datautil.Distinct(s)) <= len(s)
+//	})
+package gen
+
+import (
+	"math/rand"
+)
+
+// Gen produces random values of T and, for a failing value, simpler candidates to retry.
+type Gen[T any] struct {
+	generate func(r *rand.Rand) T
+	shrink   func(v T) []T
+}
+
+// New builds a generator from a generate function and an optional shrink function.
+func New[T any](generate func(r *rand.Rand) T, shrink func(v T) []T) Gen[T] {
+	if shrink == nil {
+		shrink = func(T) []T { return nil }
+	}
+	return Gen[T]{generate: generate, shrink: shrink}
+}
+
+// Generate returns a random value.
+func (g Gen[T]) Generate(r *rand.Rand) T {
+	return g.generate(r)
+}
+
+// Shrink returns simpler variants of v, most aggressive first.
+func (g Gen[T]) Shrink(v T) []T {
+	return g.shrink(v)
+}
+
+// Const always produces v.
+func Const[T any](v T) Gen[T] {
+	return New(func(*rand.Rand) T { return v }, nil)
+}
+
+// OneOf picks one of vs uniformly, shrinking towards earlier entries.
+func OneOf[T any](vs ...T) Gen[T] {
+	return New(func(r *rand.Rand) T {
+		return vs[r.Intn(len(vs))]
+	}, func(v T) []T {
+		if len(vs) == 0 {
+			return nil
+		}
+		return vs[:1]
+	})
+}
+
+// Map transforms generated values. The mapped generator does not shrink.
+func Map[T, U any](g Gen[T], fn func(T) U) Gen[U] {
+	return New(func(r *rand.Rand) U {
+		return fn(g.Generate(r))
+	}, nil)
+}
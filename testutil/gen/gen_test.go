@@ -0,0 +1,95 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	testing.TB
+	msg string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.msg = fmt.Sprintf(format, args...)
+}
+
+func TestShrinkInt(t *testing.T) {
+	rt := &recordingT{TB: t}
+	ok := Check(rt, IntRange(0, 1000), func(v int) bool { return v < 50 }, Seed(1))
+	assert.False(t, ok)
+	assert.Contains(t, rt.msg, "shrunk:   50\n")
+}
+
+func TestShrinkSlice(t *testing.T) {
+	rt := &recordingT{TB: t}
+	// Fails whenever the slice contains a value >= 10; the minimal counterexample is []int{10}.
+	ok := Check(rt, SliceOf(IntRange(0, 100), 30), func(s []int) bool {
+		for _, v := range s {
+			if v >= 10 {
+				return false
+			}
+		}
+		return true
+	}, Seed(2))
+	assert.False(t, ok)
+	assert.Contains(t, rt.msg, "shrunk:   []int{10}\n")
+}
+
+func TestShrinkString(t *testing.T) {
+	rt := &recordingT{TB: t}
+	ok := Check(rt, StringOf("ab", 20), func(s string) bool { return len(s) < 3 }, Seed(3))
+	assert.False(t, ok)
+	assert.Contains(t, rt.msg, `shrunk:   "aaa"`)
+}
+
+func TestGeneratorsDeterministic(t *testing.T) {
+	g := MapOf(String(), SliceOf(Int(), 5), 10)
+	a := g.Generate(rand.New(rand.NewSource(7)))
+	b := g.Generate(rand.New(rand.NewSource(7)))
+	assert.Equal(t, a, b)
+}
+
+func TestStruct(t *testing.T) {
+	type user struct {
+		ID     string
+		Age    int
+		Tags   []string
+		hidden int
+	}
+	g := Struct[user]()
+	r := rand.New(rand.NewSource(1))
+	var sawID bool
+	for range 20 {
+		u := g.Generate(r)
+		assert.Zero(t, u.hidden)
+		sawID = sawID || u.ID != ""
+	}
+	require.True(t, sawID)
+	shrunk := g.Shrink(user{ID: "x", Age: 3})
+	assert.Equal(t, []user{{Age: 3}, {ID: "x"}}, shrunk)
+}
+
+func TestCheckPasses(t *testing.T) {
+	assert.True(t, Check(t, SliceOf(Int(), 10), func(s []int) bool { return len(s) <= 10 }, Iterations(50)))
+}
@@ -0,0 +1,100 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gen
+
+import (
+	"math/rand"
+	"reflect"
+)
+
+// Struct generates values of the struct type T by filling exported fields of kind bool, int*, uint*,
+// float*, string and slices or maps of those; other fields keep their zero value.
+// Shrinking resets one field at a time to its zero value.
+func Struct[T any]() Gen[T] {
+	return New(func(r *rand.Rand) T {
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		if rv.Kind() == reflect.Struct {
+			fillStruct(r, rv)
+		}
+		return v
+	}, func(v T) []T {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Struct {
+			return nil
+		}
+		var res []T
+		for i := range rv.NumField() {
+			if !rv.Type().Field(i).IsExported() || rv.Field(i).IsZero() {
+				continue
+			}
+			cp := v
+			f := reflect.ValueOf(&cp).Elem().Field(i)
+			f.Set(reflect.Zero(f.Type()))
+			res = append(res, cp)
+		}
+		return res
+	})
+}
+
+func fillStruct(r *rand.Rand, rv reflect.Value) {
+	for i := range rv.NumField() {
+		if rv.Type().Field(i).IsExported() {
+			fillValue(r, rv.Field(i), 2)
+		}
+	}
+}
+
+func fillValue(r *rand.Rand, v reflect.Value, depth int) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(r.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(r.Intn(201) - 100))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(r.Intn(201)))
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(r.Float64()*200 - 100)
+	case reflect.String:
+		v.SetString(String().Generate(r))
+	case reflect.Slice:
+		if depth == 0 {
+			return
+		}
+		n := r.Intn(6)
+		s := reflect.MakeSlice(v.Type(), n, n)
+		for i := range n {
+			fillValue(r, s.Index(i), depth-1)
+		}
+		v.Set(s)
+	case reflect.Map:
+		if depth == 0 {
+			return
+		}
+		m := reflect.MakeMap(v.Type())
+		for range r.Intn(6) {
+			k := reflect.New(v.Type().Key()).Elem()
+			e := reflect.New(v.Type().Elem()).Elem()
+			fillValue(r, k, depth-1)
+			fillValue(r, e, depth-1)
+			m.SetMapIndex(k, e)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		if depth > 0 {
+			fillStruct(r, v)
+		}
+	}
+}
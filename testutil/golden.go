@@ -0,0 +1,203 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testutil contains helpers shared by the tests of this module and its users.
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// GoldenDir is where golden files are read from, relative to the package under test.
+var GoldenDir = "testdata"
+
+const (
+	scrubbedTimestamp = "<timestamp>"
+	scrubbedValue     = "<scrubbed>"
+)
+
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?$`)
+
+type goldenOptions struct {
+	raw        bool
+	timestamps bool
+	keys       map[string]struct{}
+}
+
+type GoldenOption func(*goldenOptions)
+
+// Raw compares the output byte for byte, without JSON normalization.
+func Raw() GoldenOption {
+	return func(o *goldenOptions) {
+		o.raw = true
+	}
+}
+
+// KeepTimestamps disables replacing RFC 3339 style timestamp strings with a placeholder.
+func KeepTimestamps() GoldenOption {
+	return func(o *goldenOptions) {
+		o.timestamps = false
+	}
+}
+
+// ScrubKeys replaces the values of the given JSON object keys, e.g. generated IDs, with a placeholder.
+func ScrubKeys(keys ...string) GoldenOption {
+	return func(o *goldenOptions) {
+		for _, k := range keys {
+			o.keys[k] = struct{}{}
+		}
+	}
+}
+
+// AssertGolden compares got with the golden file GoldenDir/name.golden and reports a line diff on mismatch.
+// Run the tests with -update to (re)write the file.
+//
+// got may be a []byte, a string or any value, which is JSON encoded. Output that is valid JSON is normalized:
+// keys are sorted, the document is indented, and timestamp strings and ScrubKeys values are replaced
+// with placeholders so the golden file stays stable across runs.
+func AssertGolden(t testing.TB, name string, got any, opts ...GoldenOption) bool {
+	t.Helper()
+	o := goldenOptions{timestamps: true, keys: make(map[string]struct{})}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	data, err := goldenBytes(got)
+	if err != nil {
+		t.Fatalf("golden %s: encode: %v", name, err)
+		return false
+	}
+	if !o.raw {
+		data = normalizeJSON(data, &o)
+	}
+	path := filepath.Join(GoldenDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+			return false
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("golden %s: %v", name, err)
+			return false
+		}
+		return true
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden %s: %v (run with -update to create it)", name, err)
+		return false
+	}
+	if bytes.Equal(want, data) {
+		return true
+	}
+	t.Errorf("golden %s mismatch (-want +got):\n%s", name, Diff(string(want), string(data)))
+	return false
+}
+
+func goldenBytes(v any) ([]byte, error) {
+	switch val := v.(type) {
+	case []byte:
+		return val, nil
+	case string:
+		return []byte(val), nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// normalizeJSON returns data re-encoded with sorted keys and scrubbed values, or data unchanged when it is not JSON.
+func normalizeJSON(data []byte, o *goldenOptions) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return data
+	}
+	v = scrub(v, o)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+func scrub(v any, o *goldenOptions) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, item := range val {
+			if _, ok := o.keys[k]; ok {
+				val[k] = scrubbedValue
+				continue
+			}
+			val[k] = scrub(item, o)
+		}
+	case []any:
+		for i, item := range val {
+			val[i] = scrub(item, o)
+		}
+	case string:
+		if o.timestamps && timestampPattern.MatchString(val) {
+			return scrubbedTimestamp
+		}
+	}
+	return v
+}
+
+// Diff returns a line based diff of want and got, prefixing removed lines with "-" and added lines with "+".
+func Diff(want, got string) string {
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("- " + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+ " + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
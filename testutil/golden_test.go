@@ -0,0 +1,53 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type goldenSample struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"createdAt"`
+	Count     int64     `json:"count"`
+}
+
+func TestAssertGolden(t *testing.T) {
+	v := map[string]any{
+		"zeta":  1,
+		"alpha": goldenSample{ID: "random-id", Name: "openim", Tags: []string{"a", "b"}, CreatedAt: time.Now(), Count: 9007199254740993},
+	}
+	AssertGolden(t, "sample", v, ScrubKeys("id"))
+}
+
+func TestAssertGoldenRaw(t *testing.T) {
+	AssertGolden(t, "raw", "line one\nline two\n", Raw())
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, "  a\n- b\n+ x\n  c\n", Diff("a\nb\nc", "a\nx\nc"))
+	assert.Equal(t, "  a\n+ b\n", Diff("a", "a\nb"))
+}
+
+func TestNormalizeJSON(t *testing.T) {
+	o := &goldenOptions{timestamps: true, keys: map[string]struct{}{}}
+	assert.Equal(t, "{\n  \"a\": \"<timestamp>\",\n  \"b\": 1\n}\n", string(normalizeJSON([]byte(`{"b":1,"a":"2024-01-02T03:04:05.123+08:00"}`), o)))
+	assert.Equal(t, "not json", string(normalizeJSON([]byte("not json"), o)))
+}
@@ -0,0 +1,132 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// LeakOption configures VerifyNoLeaks.
+type LeakOption func(*leakConfig)
+
+type leakConfig struct {
+	timeout time.Duration
+	ignore  []string
+}
+
+// LeakTimeout sets how long VerifyNoLeaks waits for goroutines to exit,
+// 2 seconds by default.
+func LeakTimeout(d time.Duration) LeakOption {
+	return func(c *leakConfig) {
+		c.timeout = d
+	}
+}
+
+// IgnoreLeak ignores goroutines whose stack contains function, e.g. a
+// package level worker that lives for the whole process.
+func IgnoreLeak(function string) LeakOption {
+	return func(c *leakConfig) {
+		c.ignore = append(c.ignore, function)
+	}
+}
+
+type goroutine struct {
+	id    int
+	stack string
+}
+
+// goroutines returns the stacks of all goroutines but the calling one.
+func goroutines() []goroutine {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var res []goroutine
+	for i, stack := range bytes.Split(buf, []byte("\n\n")) {
+		if i == 0 {
+			continue // The calling goroutine is listed first.
+		}
+		if id := goroutineID(stack); id > 0 {
+			res = append(res, goroutine{id: id, stack: string(stack)})
+		}
+	}
+	return res
+}
+
+// goroutineID parses the id from a "goroutine 12 [running]:" header.
+func goroutineID(stack []byte) int {
+	stack = bytes.TrimPrefix(stack, []byte("goroutine "))
+	if i := bytes.IndexByte(stack, ' '); i > 0 {
+		id, _ := strconv.Atoi(string(stack[:i]))
+		return id
+	}
+	return 0
+}
+
+func (c *leakConfig) ignored(stack string) bool {
+	for _, function := range c.ignore {
+		if strings.Contains(stack, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyNoLeaks fails the test if goroutines started after the call are still
+// running when the test finishes. Call it first in a test, so its cleanup
+// runs after the cleanups that stop the components under test.
+func VerifyNoLeaks(t testing.TB, opts ...LeakOption) {
+	t.Helper()
+	conf := leakConfig{
+		timeout: 2 * time.Second,
+		ignore:  []string{"testing.(*T).Run", "testing.tRunner", "runtime.ensureSigM", "os/signal.signal_recv"},
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	before := make(map[int]struct{})
+	for _, g := range goroutines() {
+		before[g.id] = struct{}{}
+	}
+	t.Cleanup(func() {
+		deadline := time.Now().Add(conf.timeout)
+		for delay := time.Millisecond; ; delay *= 2 {
+			var leaked []string
+			for _, g := range goroutines() {
+				if _, ok := before[g.id]; !ok && !conf.ignored(g.stack) {
+					leaked = append(leaked, g.stack)
+				}
+			}
+			if len(leaked) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Errorf("found %d leaked goroutines:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+				return
+			}
+			time.Sleep(min(delay, 100*time.Millisecond))
+		}
+	})
+}
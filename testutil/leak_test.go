@@ -0,0 +1,116 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTB struct {
+	testing.TB
+	mu       sync.Mutex
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	r.errors = append(r.errors, format)
+	r.mu.Unlock()
+}
+
+func (r *recordingTB) Error(args ...any) {
+	r.Errorf("error")
+}
+
+func (r *recordingTB) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+func (r *recordingTB) runCleanups() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
+
+func TestVerifyNoLeaks(t *testing.T) {
+	rec := &recordingTB{TB: t}
+	VerifyNoLeaks(rec, LeakTimeout(50*time.Millisecond))
+	stop := make(chan struct{})
+	go func() { <-stop }()
+	rec.runCleanups()
+	assert.Len(t, rec.errors, 1)
+	close(stop)
+
+	rec = &recordingTB{TB: t}
+	VerifyNoLeaks(rec, LeakTimeout(time.Second))
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(done)
+	}()
+	rec.runCleanups()
+	assert.Empty(t, rec.errors)
+	<-done
+
+	rec = &recordingTB{TB: t}
+	VerifyNoLeaks(rec, LeakTimeout(20*time.Millisecond), IgnoreLeak("testutil.TestVerifyNoLeaks.func"))
+	stop2 := make(chan struct{})
+	go func() { <-stop2 }()
+	rec.runCleanups()
+	assert.Empty(t, rec.errors)
+	close(stop2)
+}
+
+func TestLockOrder(t *testing.T) {
+	o := NewLockOrder()
+	a, b, c := o.Mutex("a"), o.Mutex("b"), o.Mutex("c")
+
+	a.Lock()
+	b.Lock()
+	b.Unlock()
+	a.Unlock()
+	b.Lock()
+	c.Lock()
+	c.Unlock()
+	b.Unlock()
+	assert.Empty(t, o.Violations())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.Lock()
+		a.Lock()
+		a.Unlock()
+		c.Unlock()
+	}()
+	wg.Wait()
+	violations := o.Violations()
+	require.Len(t, violations, 1)
+	assert.Contains(t, violations[0], "c -> a")
+	assert.Contains(t, violations[0], "a -> b -> c")
+
+	rec := &recordingTB{TB: t}
+	o.Verify(rec)
+	assert.Len(t, rec.errors, 1)
+}
@@ -0,0 +1,160 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// LockOrder detects potential deadlocks. It records in which order the
+// goroutines of a test acquire its mutexes and reports two mutexes acquired
+// in opposite orders, directly or through others, even when the run happened
+// not to deadlock.
+type LockOrder struct {
+	mu         sync.Mutex
+	edges      map[string]map[string]string // Held lock, acquired lock, stack of the first acquisition.
+	held       map[int][]string             // Locks held by goroutine id.
+	violations []string
+}
+
+// NewLockOrder creates a LockOrder.
+func NewLockOrder() *LockOrder {
+	return &LockOrder{edges: make(map[string]map[string]string), held: make(map[int][]string)}
+}
+
+// Mutex returns a mutex named name whose acquisitions are checked. Mutexes
+// with the same name count as the same lock, e.g. one per shard.
+func (o *LockOrder) Mutex(name string) *OrderedMutex {
+	return &OrderedMutex{order: o, name: name}
+}
+
+// OrderedMutex is a sync.Mutex checked by a LockOrder.
+type OrderedMutex struct {
+	mu    sync.Mutex
+	order *LockOrder
+	name  string
+}
+
+func (m *OrderedMutex) Lock() {
+	m.order.acquire(m.name)
+	m.mu.Lock()
+}
+
+func (m *OrderedMutex) TryLock() bool {
+	if !m.mu.TryLock() {
+		return false
+	}
+	// A failing TryLock cannot block, so only successful ones add an order.
+	m.order.acquire(m.name)
+	return true
+}
+
+func (m *OrderedMutex) Unlock() {
+	m.mu.Unlock()
+	m.order.release(m.name)
+}
+
+func currentGoroutineID() int {
+	buf := make([]byte, 64)
+	return goroutineID(buf[:runtime.Stack(buf, false)])
+}
+
+func (o *LockOrder) acquire(name string) {
+	id := currentGoroutineID()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, held := range o.held[id] {
+		if held == name {
+			continue
+		}
+		next, ok := o.edges[held]
+		if !ok {
+			next = make(map[string]string)
+			o.edges[held] = next
+		}
+		if _, ok := next[name]; ok {
+			continue
+		}
+		buf := make([]byte, 4096)
+		stack := string(buf[:runtime.Stack(buf, false)])
+		if path := o.path(name, held); path != nil {
+			o.violations = append(o.violations, "lock order inversion: "+held+" -> "+name+
+				" while "+strings.Join(path, " -> ")+" was seen before\n"+
+				"first "+path[0]+" -> "+path[1]+" at:\n"+o.edges[path[0]][path[1]]+"\n"+
+				"now "+held+" -> "+name+" at:\n"+stack)
+		}
+		next[name] = stack
+	}
+	o.held[id] = append(o.held[id], name)
+}
+
+func (o *LockOrder) release(name string) {
+	id := currentGoroutineID()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	held := o.held[id]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i] == name {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(o.held, id)
+	} else {
+		o.held[id] = held
+	}
+}
+
+// path returns the locks from one to another along recorded orders, or nil.
+// Called with mu held.
+func (o *LockOrder) path(from string, to string) []string {
+	visited := map[string]bool{from: true}
+	var walk func(name string) []string
+	walk = func(name string) []string {
+		if name == to {
+			return []string{name}
+		}
+		for next := range o.edges[name] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if p := walk(next); p != nil {
+				return append([]string{name}, p...)
+			}
+		}
+		return nil
+	}
+	return walk(from)
+}
+
+// Violations returns the lock order inversions seen so far.
+func (o *LockOrder) Violations() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]string(nil), o.violations...)
+}
+
+// Verify fails the test for every lock order inversion seen so far.
+func (o *LockOrder) Verify(t testing.TB) {
+	t.Helper()
+	for _, v := range o.Violations() {
+		t.Error(v)
+	}
+}
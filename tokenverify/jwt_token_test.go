@@ -42,3 +42,26 @@ func secretFun() jwt.Keyfunc {
 		return []byte(secret), nil
 	}
 }
+
+func FuzzGetClaimFromToken(f *testing.F) {
+	claims := BuildClaims("123456", constant.AndroidPadPlatformID, 10)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(token)
+	f.Add("eyJhbGciOiJub25lIn0.eyJVc2VySUQiOiIxIn0.")
+	f.Add("a.b.c")
+	f.Fuzz(func(t *testing.T, token string) {
+		claims, err := GetClaimFromToken(token, secretFun())
+		if err != nil {
+			if claims != nil {
+				t.Fatalf("claims returned with error %v", err)
+			}
+			return
+		}
+		if claims == nil {
+			t.Fatal("nil claims without error")
+		}
+	})
+}
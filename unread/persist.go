@@ -0,0 +1,96 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unread
+
+import (
+	"context"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Record is the persisted unread state of a user in a conversation.
+type Record struct {
+	UserID         string    `bson:"user_id"`
+	ConversationID string    `bson:"conversation_id"`
+	ReadSeq        int64     `bson:"read_seq"`
+	Count          int64     `bson:"count"`
+	UpdatedAt      time.Time `bson:"updated_at"`
+}
+
+// Persister stores unread state snapshots.
+type Persister interface {
+	Save(ctx context.Context, records []Record) error
+}
+
+// NewMongoPersister returns a Persister upserting one document per user and
+// conversation into coll.
+func NewMongoPersister(coll *mongo.Collection) *MongoPersister {
+	return &MongoPersister{coll: coll}
+}
+
+// MongoPersister is a Persister on a Mongo collection.
+type MongoPersister struct {
+	coll *mongo.Collection
+}
+
+// EnsureIndexes creates the unique index the upserts rely on.
+func (p *MongoPersister) EnsureIndexes(ctx context.Context) error {
+	_, err := p.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "conversation_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return errs.WrapMsg(err, "create unread indexes failed", "collection", p.coll.Name())
+	}
+	return nil
+}
+
+// Save upserts records. The read seq only moves forward, like in Redis.
+func (p *MongoPersister) Save(ctx context.Context, records []Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, len(records))
+	for i, r := range records {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"user_id": r.UserID, "conversation_id": r.ConversationID}).
+			SetUpdate(bson.M{
+				"$max": bson.M{"read_seq": r.ReadSeq},
+				"$set": bson.M{"count": r.Count, "updated_at": r.UpdatedAt},
+			}).
+			SetUpsert(true)
+	}
+	if _, err := p.coll.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return errs.WrapMsg(err, "save unread records failed", "count", len(records))
+	}
+	return nil
+}
+
+// Find returns the persisted records of a user, e.g. to Restore them.
+func (p *MongoPersister) Find(ctx context.Context, userID string) ([]Record, error) {
+	cur, err := p.coll.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, errs.WrapMsg(err, "find unread records failed", "userID", userID)
+	}
+	var records []Record
+	if err := cur.All(ctx, &records); err != nil {
+		return nil, errs.WrapMsg(err, "decode unread records failed", "userID", userID)
+	}
+	return records, nil
+}
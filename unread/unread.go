@@ -0,0 +1,389 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package unread keeps unread state of conversations in Redis in two forms.
+// Watermarks store the max seq of every conversation and the read seq of
+// every user; the unread count is derived from them and never negative.
+// Counters are plain per-user counts for sources without seqs, e.g.
+// notifications. Changed values are flushed to a Persister by Run.
+package unread
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// Count returns the unread messages of a conversation with maxSeq for a
+// reader at readSeq. Seqs start at 1, so a reader at 0 has read nothing.
+func Count(maxSeq, readSeq int64) int64 {
+	if readSeq >= maxSeq {
+		return 0
+	}
+	if readSeq < 0 {
+		readSeq = 0
+	}
+	return maxSeq - readSeq
+}
+
+// State is the unread state of a conversation for a user.
+type State struct {
+	ConversationID string
+	MaxSeq         int64
+	ReadSeq        int64
+	Unread         int64
+}
+
+// Config configures a Store.
+type Config struct {
+	KeyPrefix       string // Defaults to "UNREAD:".
+	Persister       Persister
+	PersistInterval time.Duration // Defaults to 1 minute.
+}
+
+// Store keeps unread state.
+type Store struct {
+	rdb  redis.UniversalClient
+	conf Config
+
+	mu    sync.Mutex
+	dirty map[dirtyKey]struct{}
+}
+
+type dirtyKey struct {
+	userID         string
+	conversationID string
+}
+
+// New creates a Store.
+func New(rdb redis.UniversalClient, conf Config) *Store {
+	if conf.KeyPrefix == "" {
+		conf.KeyPrefix = "UNREAD:"
+	}
+	if conf.PersistInterval <= 0 {
+		conf.PersistInterval = time.Minute
+	}
+	return &Store{rdb: rdb, conf: conf, dirty: make(map[dirtyKey]struct{})}
+}
+
+func (s *Store) maxKey(conversationID string) string {
+	return s.conf.KeyPrefix + "max:" + conversationID
+}
+
+func (s *Store) readKey(userID string) string {
+	return s.conf.KeyPrefix + "read:" + userID
+}
+
+func (s *Store) countKey(userID string) string {
+	return s.conf.KeyPrefix + "count:" + userID
+}
+
+// raiseScript sets KEYS[1] to ARGV[1] unless it is already higher and
+// returns the resulting value.
+var raiseScript = redis.NewScript(`
+local cur = tonumber(redis.call('GET', KEYS[1]) or '0')
+local seq = tonumber(ARGV[1])
+if seq > cur then
+	redis.call('SET', KEYS[1], ARGV[1])
+	return seq
+end
+return cur
+`)
+
+// raiseFieldScript sets field ARGV[1] of KEYS[1] to ARGV[2] unless it is
+// already higher and returns the resulting value.
+var raiseFieldScript = redis.NewScript(`
+local cur = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+local seq = tonumber(ARGV[2])
+if seq > cur then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+	return seq
+end
+return cur
+`)
+
+// SetMaxSeq raises the max seq of a conversation, e.g. after a message was
+// stored, and returns the current max seq. It never lowers it, so late or
+// reordered updates are harmless.
+func (s *Store) SetMaxSeq(ctx context.Context, conversationID string, seq int64) (int64, error) {
+	res, err := raiseScript.Run(ctx, s.rdb, []string{s.maxKey(conversationID)}, seq).Int64()
+	if err != nil {
+		return 0, errs.WrapMsg(err, "set max seq failed", "conversationID", conversationID)
+	}
+	return res, nil
+}
+
+// MarkRead raises the read seq of a user, capped at the max seq of the
+// conversation, and returns the new state. A read seq never moves back, so
+// a stale client cannot resurrect read messages as unread.
+func (s *Store) MarkRead(ctx context.Context, userID string, conversationID string, seq int64) (*State, error) {
+	maxSeq, err := s.getMax(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if seq > maxSeq {
+		seq = maxSeq
+	}
+	readSeq, err := raiseFieldScript.Run(ctx, s.rdb, []string{s.readKey(userID)}, conversationID, seq).Int64()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "mark read failed", "userID", userID, "conversationID", conversationID)
+	}
+	s.markDirty(userID, conversationID)
+	return &State{ConversationID: conversationID, MaxSeq: maxSeq, ReadSeq: readSeq, Unread: Count(maxSeq, readSeq)}, nil
+}
+
+// MarkAllRead moves the read seq of a user to the max seq of every
+// conversation.
+func (s *Store) MarkAllRead(ctx context.Context, userID string, conversationIDs ...string) error {
+	maxSeqs, err := s.getMaxes(ctx, conversationIDs)
+	if err != nil {
+		return err
+	}
+	pipe := s.rdb.Pipeline()
+	for i, conversationID := range conversationIDs {
+		raiseFieldScript.Eval(ctx, pipe, []string{s.readKey(userID)}, conversationID, maxSeqs[i])
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errs.WrapMsg(err, "mark all read failed", "userID", userID, "count", len(conversationIDs))
+	}
+	for _, conversationID := range conversationIDs {
+		s.markDirty(userID, conversationID)
+	}
+	return nil
+}
+
+func (s *Store) getMax(ctx context.Context, conversationID string) (int64, error) {
+	maxSeq, err := s.rdb.Get(ctx, s.maxKey(conversationID)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, errs.WrapMsg(err, "get max seq failed", "conversationID", conversationID)
+	}
+	return maxSeq, nil
+}
+
+// getMaxes reads max seqs with single GETs in a pipeline, as the keys may be
+// in different cluster slots.
+func (s *Store) getMaxes(ctx context.Context, conversationIDs []string) ([]int64, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(conversationIDs))
+	for i, conversationID := range conversationIDs {
+		cmds[i] = pipe.Get(ctx, s.maxKey(conversationID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, errs.WrapMsg(err, "get max seqs failed", "count", len(conversationIDs))
+	}
+	res := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		res[i], _ = cmd.Int64()
+	}
+	return res, nil
+}
+
+// States returns the unread state of a user in every conversation.
+func (s *Store) States(ctx context.Context, userID string, conversationIDs ...string) ([]State, error) {
+	if len(conversationIDs) == 0 {
+		return nil, nil
+	}
+	maxSeqs, err := s.getMaxes(ctx, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	reads, err := s.rdb.HMGet(ctx, s.readKey(userID), conversationIDs...).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "get read seqs failed", "userID", userID)
+	}
+	states := make([]State, len(conversationIDs))
+	for i, conversationID := range conversationIDs {
+		var readSeq int64
+		if v, ok := reads[i].(string); ok {
+			readSeq, _ = strconv.ParseInt(v, 10, 64)
+		}
+		states[i] = State{ConversationID: conversationID, MaxSeq: maxSeqs[i], ReadSeq: readSeq, Unread: Count(maxSeqs[i], readSeq)}
+	}
+	return states, nil
+}
+
+// Incr adds n to the counter of a conversation for every user, e.g. for a
+// notification sent to a group.
+func (s *Store) Incr(ctx context.Context, conversationID string, userIDs []string, n int64) error {
+	pipe := s.rdb.Pipeline()
+	for _, userID := range userIDs {
+		pipe.HIncrBy(ctx, s.countKey(userID), conversationID, n)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errs.WrapMsg(err, "increment unread counters failed", "conversationID", conversationID, "count", len(userIDs))
+	}
+	for _, userID := range userIDs {
+		s.markDirty(userID, conversationID)
+	}
+	return nil
+}
+
+// Reset clears the counters of a user for the conversations.
+func (s *Store) Reset(ctx context.Context, userID string, conversationIDs ...string) error {
+	if len(conversationIDs) == 0 {
+		return nil
+	}
+	if err := s.rdb.HDel(ctx, s.countKey(userID), conversationIDs...).Err(); err != nil {
+		return errs.WrapMsg(err, "reset unread counters failed", "userID", userID)
+	}
+	for _, conversationID := range conversationIDs {
+		s.markDirty(userID, conversationID)
+	}
+	return nil
+}
+
+// Counters returns the counters of a user; conversations without a count
+// are omitted. Without conversationIDs all counters are returned.
+func (s *Store) Counters(ctx context.Context, userID string, conversationIDs ...string) (map[string]int64, error) {
+	res := make(map[string]int64)
+	if len(conversationIDs) == 0 {
+		all, err := s.rdb.HGetAll(ctx, s.countKey(userID)).Result()
+		if err != nil {
+			return nil, errs.WrapMsg(err, "get unread counters failed", "userID", userID)
+		}
+		for conversationID, v := range all {
+			if n, _ := strconv.ParseInt(v, 10, 64); n > 0 {
+				res[conversationID] = n
+			}
+		}
+		return res, nil
+	}
+	values, err := s.rdb.HMGet(ctx, s.countKey(userID), conversationIDs...).Result()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "get unread counters failed", "userID", userID)
+	}
+	for i, v := range values {
+		if str, ok := v.(string); ok {
+			if n, _ := strconv.ParseInt(str, 10, 64); n > 0 {
+				res[conversationIDs[i]] = n
+			}
+		}
+	}
+	return res, nil
+}
+
+// Total returns the sum of all counters of a user.
+func (s *Store) Total(ctx context.Context, userID string) (int64, error) {
+	counters, err := s.Counters(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, n := range counters {
+		total += n
+	}
+	return total, nil
+}
+
+func (s *Store) markDirty(userID string, conversationID string) {
+	if s.conf.Persister == nil {
+		return
+	}
+	s.mu.Lock()
+	s.dirty[dirtyKey{userID: userID, conversationID: conversationID}] = struct{}{}
+	s.mu.Unlock()
+}
+
+// Run flushes changed read seqs and counters every PersistInterval until
+// ctx is done, then flushes once more.
+func (s *Store) Run(ctx context.Context) {
+	if s.conf.Persister == nil {
+		return
+	}
+	ticker := time.NewTicker(s.conf.PersistInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(context.WithoutCancel(ctx)); err != nil {
+				log.ZWarn(ctx, "unread flush failed", err)
+			}
+			return
+		case <-ticker.C:
+			if err := s.Flush(ctx); err != nil {
+				log.ZWarn(ctx, "unread flush failed", err)
+			}
+		}
+	}
+}
+
+// Flush persists the read seqs and counters changed since the last flush.
+// Entries that fail to persist are retried by the next flush.
+func (s *Store) Flush(ctx context.Context) error {
+	if s.conf.Persister == nil {
+		return nil
+	}
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = make(map[dirtyKey]struct{})
+	s.mu.Unlock()
+	if len(dirty) == 0 {
+		return nil
+	}
+	keys := make([]dirtyKey, 0, len(dirty))
+	pipe := s.rdb.Pipeline()
+	reads := make([]*redis.StringCmd, 0, len(dirty))
+	counts := make([]*redis.StringCmd, 0, len(dirty))
+	for k := range dirty {
+		keys = append(keys, k)
+		reads = append(reads, pipe.HGet(ctx, s.readKey(k.userID), k.conversationID))
+		counts = append(counts, pipe.HGet(ctx, s.countKey(k.userID), k.conversationID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		s.requeue(keys)
+		return errs.WrapMsg(err, "read unread state failed", "count", len(keys))
+	}
+	now := time.Now().UTC()
+	records := make([]Record, len(keys))
+	for i, k := range keys {
+		readSeq, _ := reads[i].Int64()
+		count, _ := counts[i].Int64()
+		records[i] = Record{UserID: k.userID, ConversationID: k.conversationID, ReadSeq: readSeq, Count: count, UpdatedAt: now}
+	}
+	if err := s.conf.Persister.Save(ctx, records); err != nil {
+		s.requeue(keys)
+		return err
+	}
+	return nil
+}
+
+func (s *Store) requeue(keys []dirtyKey) {
+	s.mu.Lock()
+	for _, k := range keys {
+		s.dirty[k] = struct{}{}
+	}
+	s.mu.Unlock()
+}
+
+// Restore writes persisted records back to Redis, e.g. after a Redis data
+// loss. Read seqs only move forward, so restoring stale records is harmless.
+func (s *Store) Restore(ctx context.Context, records []Record) error {
+	pipe := s.rdb.Pipeline()
+	for _, r := range records {
+		raiseFieldScript.Eval(ctx, pipe, []string{s.readKey(r.UserID)}, r.ConversationID, r.ReadSeq)
+		if r.Count > 0 {
+			pipe.HSetNX(ctx, s.countKey(r.UserID), r.ConversationID, r.Count)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return errs.WrapMsg(err, "restore unread state failed", "count", len(records))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unread
+
+import (
+	"context"
+	"testing"
+
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCount(t *testing.T) {
+	assert.Equal(t, int64(5), Count(5, 0))
+	assert.Equal(t, int64(2), Count(5, 3))
+	assert.Equal(t, int64(0), Count(5, 5))
+	assert.Equal(t, int64(0), Count(5, 9))
+	assert.Equal(t, int64(5), Count(5, -1))
+	assert.Equal(t, int64(0), Count(0, 0))
+}
+
+type memPersister struct {
+	records map[string]Record
+}
+
+func (p *memPersister) Save(ctx context.Context, records []Record) error {
+	for _, r := range records {
+		p.records[r.UserID+"/"+r.ConversationID] = r
+	}
+	return nil
+}
+
+func TestWatermarks(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	p := &memPersister{records: make(map[string]Record)}
+	s := New(rdb, Config{KeyPrefix: "UNREAD_TEST:", Persister: p})
+
+	maxSeq, err := s.SetMaxSeq(ctx, "c1", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), maxSeq)
+	maxSeq, err = s.SetMaxSeq(ctx, "c1", 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), maxSeq)
+
+	state, err := s.MarkRead(ctx, "u1", "c1", 4)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), state.Unread)
+	state, err = s.MarkRead(ctx, "u1", "c1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), state.ReadSeq)
+	state, err = s.MarkRead(ctx, "u1", "c1", 50)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), state.ReadSeq)
+	assert.Equal(t, int64(0), state.Unread)
+
+	_, err = s.SetMaxSeq(ctx, "c2", 3)
+	require.NoError(t, err)
+	states, err := s.States(ctx, "u1", "c1", "c2", "c3")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{0, 3, 0}, []int64{states[0].Unread, states[1].Unread, states[2].Unread})
+
+	require.NoError(t, s.MarkAllRead(ctx, "u1", "c2"))
+	require.NoError(t, s.Flush(ctx))
+	assert.Equal(t, int64(3), p.records["u1/c2"].ReadSeq)
+	assert.Equal(t, int64(10), p.records["u1/c1"].ReadSeq)
+}
+
+func TestCounters(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	s := New(rdb, Config{KeyPrefix: "UNREAD_TEST:"})
+
+	require.NoError(t, s.Incr(ctx, "n1", []string{"u1", "u2"}, 2))
+	require.NoError(t, s.Incr(ctx, "n2", []string{"u1"}, 1))
+	total, err := s.Total(ctx, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+
+	require.NoError(t, s.Reset(ctx, "u1", "n1"))
+	counters, err := s.Counters(ctx, "u1", "n1", "n2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"n2": 1}, counters)
+}
+
+func TestMongoPersister(t *testing.T) {
+	p := NewMongoPersister(containers.Mongo(t, "unread").GetDB().Collection("unread"))
+	ctx := context.Background()
+	require.NoError(t, p.EnsureIndexes(ctx))
+	require.NoError(t, p.Save(ctx, []Record{{UserID: "u1", ConversationID: "c1", ReadSeq: 5, Count: 1}}))
+	require.NoError(t, p.Save(ctx, []Record{{UserID: "u1", ConversationID: "c1", ReadSeq: 3, Count: 2}}))
+	records, err := p.Find(ctx, "u1")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(5), records[0].ReadSeq)
+	assert.Equal(t, int64(2), records[0].Count)
+}
@@ -0,0 +1,114 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archiveutil
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+type Format string
+
+const (
+	FormatZip   Format = "zip"
+	FormatTarGz Format = "tar.gz"
+)
+
+// Writer streams entries into an archive. Entries are written in the order they are added and nothing
+// is buffered beyond what the underlying compressor needs.
+type Writer interface {
+	// AddReader adds a regular file named name. size must be the exact number of bytes r yields;
+	// tar needs it up front, zip uses it only as a sanity check.
+	AddReader(name string, size int64, modTime time.Time, r io.Reader) error
+	// AddFile adds the local file at filePath under name.
+	AddFile(name string, filePath string) error
+	// AddDir adds every regular file below dir, with names relative to dir and prefixed by prefix.
+	AddDir(prefix string, dir string) error
+	// Close flushes the archive. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// NewWriter returns a Writer for the given format.
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatZip:
+		return NewZipWriter(w), nil
+	case FormatTarGz:
+		return NewTarGzWriter(w), nil
+	default:
+		return nil, errs.New("unsupported archive format", "format", format).Wrap()
+	}
+}
+
+// cleanEntryName normalizes an archive entry name to a relative, slash separated path.
+func cleanEntryName(name string) (string, error) {
+	name = path.Clean(strings.TrimLeft(filepath.ToSlash(name), "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", errs.New("invalid archive entry name", "name", name).Wrap()
+	}
+	return name, nil
+}
+
+type fileAdder func(name string, size int64, modTime time.Time, r io.Reader) error
+
+func addFile(add fileAdder, name string, filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return errs.WrapMsg(err, "open file failed", "path", filePath)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errs.WrapMsg(err, "stat file failed", "path", filePath)
+	}
+	if !info.Mode().IsRegular() {
+		return errs.New("not a regular file", "path", filePath).Wrap()
+	}
+	return add(name, info.Size(), info.ModTime(), f)
+}
+
+func addDir(add fileAdder, prefix string, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return errs.WrapMsg(err, "walk dir failed", "dir", dir)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return errs.WrapMsg(err, "filepath.Rel failed", "dir", dir, "path", p)
+		}
+		return addFile(add, path.Join(prefix, filepath.ToSlash(rel)), p)
+	})
+}
+
+// copyExact copies exactly size bytes from r to w and fails if r yields more or fewer.
+func copyExact(w io.Writer, r io.Reader, size int64, name string) error {
+	n, err := io.Copy(w, io.LimitReader(r, size+1))
+	if err != nil {
+		return errs.WrapMsg(err, "write archive entry failed", "name", name)
+	}
+	if n != size {
+		return errs.New("archive entry size mismatch", "name", name, "expected", size, "actual", n).Wrap()
+	}
+	return nil
+}
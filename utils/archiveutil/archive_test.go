@@ -0,0 +1,96 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archiveutil
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/utils/fileutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "a", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a", "b", "c.log"), []byte("log line"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "root.txt"), []byte("root"), 0644))
+
+	for _, format := range []Format{FormatZip, FormatTarGz} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+			require.NoError(t, w.AddDir("logs", src))
+			require.NoError(t, w.AddReader("extra/meta.json", 2, time.Now(), strings.NewReader("{}")))
+			require.NoError(t, w.Close())
+
+			dst := t.TempDir()
+			if format == FormatZip {
+				require.NoError(t, ExtractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dst, nil))
+			} else {
+				require.NoError(t, ExtractTarGz(&buf, dst, nil))
+			}
+			data, err := os.ReadFile(filepath.Join(dst, "logs", "a", "b", "c.log"))
+			require.NoError(t, err)
+			assert.Equal(t, "log line", string(data))
+			size, err := fileutil.DirSize(dst)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len("log line")+len("root")+2), size)
+		})
+	}
+}
+
+func TestAddReaderSizeMismatch(t *testing.T) {
+	w := NewTarGzWriter(&bytes.Buffer{})
+	assert.Error(t, w.AddReader("a.txt", 10, time.Now(), strings.NewReader("short")))
+}
+
+func TestExtractLimits(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewZipWriter(&buf)
+	payload := bytes.Repeat([]byte{'0'}, 1<<16)
+	for _, name := range []string{"a", "b", "c"} {
+		require.NoError(t, w.AddReader(name, int64(len(payload)), time.Now(), bytes.NewReader(payload)))
+	}
+	require.NoError(t, w.Close())
+	r := bytes.NewReader(buf.Bytes())
+
+	err := ExtractZip(r, r.Size(), t.TempDir(), &Limits{MaxEntries: 2})
+	assert.ErrorIs(t, err, ErrTooManyEntries)
+	err = ExtractZip(r, r.Size(), t.TempDir(), &Limits{MaxFileSize: 1 << 10})
+	assert.ErrorIs(t, err, ErrEntryTooLarge)
+	err = ExtractZip(r, r.Size(), t.TempDir(), &Limits{MaxTotalSize: 1<<17 + 1})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestExtractTraversal(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("../../evil.sh")
+	require.NoError(t, err)
+	_, _ = f.Write([]byte("rm -rf /"))
+	require.NoError(t, zw.Close())
+
+	r := bytes.NewReader(buf.Bytes())
+	err = ExtractZip(r, r.Size(), t.TempDir(), nil)
+	assert.ErrorIs(t, err, fileutil.ErrPathTraversal)
+}
@@ -0,0 +1,185 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archiveutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/fileutil"
+)
+
+var (
+	ErrTooManyEntries = errs.New("archive has too many entries")
+	ErrEntryTooLarge  = errs.New("archive entry is too large")
+	ErrTooLarge       = errs.New("archive is too large")
+)
+
+// Limits bounds what an extraction may write. Zero values mean unlimited.
+// Sizes are enforced on the decompressed bytes actually written, not on header claims.
+type Limits struct {
+	MaxEntries   int
+	MaxFileSize  int64
+	MaxTotalSize int64
+}
+
+// DefaultLimits are conservative limits for archives received from clients.
+var DefaultLimits = Limits{
+	MaxEntries:   10000,
+	MaxFileSize:  1 << 30,
+	MaxTotalSize: 4 << 30,
+}
+
+type extractor struct {
+	dst     string
+	limits  Limits
+	entries int
+	total   int64
+}
+
+func newExtractor(dst string, limits *Limits) *extractor {
+	if limits == nil {
+		limits = &DefaultLimits
+	}
+	return &extractor{dst: dst, limits: *limits}
+}
+
+func (e *extractor) nextEntry() error {
+	e.entries++
+	if e.limits.MaxEntries > 0 && e.entries > e.limits.MaxEntries {
+		return ErrTooManyEntries.WrapMsg("extract", "max", e.limits.MaxEntries)
+	}
+	return nil
+}
+
+func (e *extractor) mkdir(name string) error {
+	target, err := fileutil.SafeJoin(e.dst, name)
+	if err != nil {
+		return err
+	}
+	return errs.WrapMsg(os.MkdirAll(target, 0755), "MkdirAll failed", "dir", target)
+}
+
+func (e *extractor) writeFile(name string, r io.Reader) error {
+	target, err := fileutil.SafeJoin(e.dst, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errs.WrapMsg(err, "MkdirAll failed", "path", target)
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errs.WrapMsg(err, "create file failed", "path", target)
+	}
+	limit := int64(-1)
+	if e.limits.MaxFileSize > 0 {
+		limit = e.limits.MaxFileSize
+	}
+	if e.limits.MaxTotalSize > 0 && (limit < 0 || e.limits.MaxTotalSize-e.total < limit) {
+		limit = e.limits.MaxTotalSize - e.total
+	}
+	var n int64
+	if limit >= 0 {
+		n, err = io.Copy(f, io.LimitReader(r, limit+1))
+	} else {
+		n, err = io.Copy(f, r)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errs.WrapMsg(err, "extract file failed", "path", target)
+	}
+	e.total += n
+	if e.limits.MaxFileSize > 0 && n > e.limits.MaxFileSize {
+		return ErrEntryTooLarge.WrapMsg("extract", "name", name, "max", e.limits.MaxFileSize)
+	}
+	if e.limits.MaxTotalSize > 0 && e.total > e.limits.MaxTotalSize {
+		return ErrTooLarge.WrapMsg("extract", "max", e.limits.MaxTotalSize)
+	}
+	return nil
+}
+
+// ExtractZip extracts a zip archive into dst. Symlinks and other special files are skipped,
+// and entries resolving outside dst are rejected.
+func ExtractZip(r io.ReaderAt, size int64, dst string, limits *Limits) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return errs.WrapMsg(err, "open zip failed")
+	}
+	e := newExtractor(dst, limits)
+	for _, file := range zr.File {
+		if err := e.nextEntry(); err != nil {
+			return err
+		}
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := e.mkdir(file.Name); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			rc, err := file.Open()
+			if err != nil {
+				return errs.WrapMsg(err, "open zip entry failed", "name", file.Name)
+			}
+			err = e.writeFile(file.Name, rc)
+			_ = rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ExtractTarGz extracts a gzip compressed tar stream into dst with the same rules as ExtractZip.
+func ExtractTarGz(r io.Reader, dst string, limits *Limits) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return errs.WrapMsg(err, "open gzip failed")
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	e := newExtractor(dst, limits)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errs.WrapMsg(err, "read tar failed")
+		}
+		if err := e.nextEntry(); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := e.mkdir(header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := e.writeFile(header.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
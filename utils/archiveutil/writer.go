@@ -0,0 +1,108 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archiveutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// ZipWriter writes a zip archive.
+type ZipWriter struct {
+	zw *zip.Writer
+}
+
+func NewZipWriter(w io.Writer) *ZipWriter {
+	return &ZipWriter{zw: zip.NewWriter(w)}
+}
+
+func (z *ZipWriter) AddReader(name string, size int64, modTime time.Time, r io.Reader) error {
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modTime,
+	}
+	header.SetMode(0644)
+	w, err := z.zw.CreateHeader(header)
+	if err != nil {
+		return errs.WrapMsg(err, "zip create header failed", "name", name)
+	}
+	return copyExact(w, r, size, name)
+}
+
+func (z *ZipWriter) AddFile(name string, filePath string) error {
+	return addFile(z.AddReader, name, filePath)
+}
+
+func (z *ZipWriter) AddDir(prefix string, dir string) error {
+	return addDir(z.AddReader, prefix, dir)
+}
+
+func (z *ZipWriter) Close() error {
+	return errs.WrapMsg(z.zw.Close(), "zip close failed")
+}
+
+// TarGzWriter writes a gzip compressed tar archive.
+type TarGzWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func NewTarGzWriter(w io.Writer) *TarGzWriter {
+	gw := gzip.NewWriter(w)
+	return &TarGzWriter{gw: gw, tw: tar.NewWriter(gw)}
+}
+
+func (t *TarGzWriter) AddReader(name string, size int64, modTime time.Time, r io.Reader) error {
+	name, err := cleanEntryName(name)
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  modTime,
+	}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return errs.WrapMsg(err, "tar write header failed", "name", name)
+	}
+	return copyExact(t.tw, r, size, name)
+}
+
+func (t *TarGzWriter) AddFile(name string, filePath string) error {
+	return addFile(t.AddReader, name, filePath)
+}
+
+func (t *TarGzWriter) AddDir(prefix string, dir string) error {
+	return addDir(t.AddReader, prefix, dir)
+}
+
+func (t *TarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return errs.WrapMsg(err, "tar close failed")
+	}
+	return errs.WrapMsg(t.gw.Close(), "gzip close failed")
+}
@@ -0,0 +1,124 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package atomicvalue holds values read on hot paths and replaced as a whole,
+// like config snapshots. Reads are a single atomic load; every change closes
+// a channel so that readers can wait for the next snapshot.
+package atomicvalue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+type state[T any] struct {
+	v       T
+	changed chan struct{} // Closed when the value is replaced.
+}
+
+// Value is a typed atomic value. The zero value holds the zero T. Values
+// stored must not be modified afterwards, since readers share them.
+type Value[T any] struct {
+	mu sync.Mutex // Serializes writers.
+	p  atomic.Pointer[state[T]]
+}
+
+// New returns a Value holding v.
+func New[T any](v T) *Value[T] {
+	a := &Value[T]{}
+	a.p.Store(&state[T]{v: v, changed: make(chan struct{})})
+	return a
+}
+
+func (a *Value[T]) load() *state[T] {
+	if s := a.p.Load(); s != nil {
+		return s
+	}
+	a.p.CompareAndSwap(nil, &state[T]{changed: make(chan struct{})})
+	return a.p.Load()
+}
+
+// Load returns the current value.
+func (a *Value[T]) Load() T {
+	return a.load().v
+}
+
+// Store replaces the value and notifies the waiters.
+func (a *Value[T]) Store(v T) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.store(v)
+}
+
+func (a *Value[T]) store(v T) T {
+	old := a.load()
+	a.p.Store(&state[T]{v: v, changed: make(chan struct{})})
+	close(old.changed)
+	return old.v
+}
+
+// Swap replaces the value and returns the previous one.
+func (a *Value[T]) Swap(v T) T {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.store(v)
+}
+
+// Update replaces the value with fn applied to the current one and returns
+// the new value. Concurrent updates are applied one after the other, so none
+// is lost. fn must not modify its argument in place.
+func (a *Value[T]) Update(fn func(old T) T) T {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	v := fn(a.load().v)
+	a.store(v)
+	return v
+}
+
+// Changed returns a channel closed on the next change of the value.
+func (a *Value[T]) Changed() <-chan struct{} {
+	return a.load().changed
+}
+
+// LoadChanged returns the current value together with the channel closed
+// when it is replaced, so no change between the two can be missed.
+func (a *Value[T]) LoadChanged() (T, <-chan struct{}) {
+	s := a.load()
+	return s.v, s.changed
+}
+
+// Subscribe sends the current value and then every change until ctx is
+// done. A slow receiver only gets the latest value, intermediate ones are
+// skipped.
+func (a *Value[T]) Subscribe(ctx context.Context) <-chan T {
+	ch := make(chan T, 1)
+	go func() {
+		defer close(ch)
+		for {
+			v, changed := a.LoadChanged()
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- v
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+			}
+		}
+	}()
+	return ch
+}
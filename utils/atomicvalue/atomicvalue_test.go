@@ -0,0 +1,76 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package atomicvalue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type snapshot struct {
+	Version int
+	Hosts   []string
+}
+
+func TestValue(t *testing.T) {
+	var v Value[*snapshot]
+	assert.Nil(t, v.Load())
+	changed := v.Changed()
+	v.Store(&snapshot{Version: 1})
+	select {
+	case <-changed:
+	default:
+		t.Fatal("store did not notify")
+	}
+	assert.Equal(t, 1, v.Load().Version)
+	old := v.Swap(&snapshot{Version: 2})
+	assert.Equal(t, 1, old.Version)
+
+	n := New(0)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.Update(func(old int) int { return old + 1 })
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, n.Load())
+}
+
+func TestSubscribe(t *testing.T) {
+	v := New("a")
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := v.Subscribe(ctx)
+	assert.Equal(t, "a", <-ch)
+	v.Store("b")
+	v.Store("c")
+	assert.Eventually(t, func() bool {
+		select {
+		case s := <-ch:
+			return s == "c"
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	cancel()
+	for range ch {
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cow provides copy-on-write containers for data read on hot paths
+// and written rarely, like config snapshots and routing tables. Readers load
+// an immutable snapshot without locking; writers clone it, apply the change
+// and swap it in atomically. Writers are serialized with each other.
+//
+// Snapshots returned to readers are shared and must not be modified.
+package cow
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// Map is a copy-on-write map. The zero value is an empty map ready to use.
+type Map[K comparable, V any] struct {
+	mu sync.Mutex // Serializes writers.
+	m  atomic.Pointer[map[K]V]
+}
+
+// NewMap returns a Map holding a copy of m.
+func NewMap[K comparable, V any](m map[K]V) *Map[K, V] {
+	c := &Map[K, V]{}
+	c.Replace(m)
+	return c
+}
+
+// Snapshot returns the current map, which must not be modified. It is nil
+// until the first write.
+func (c *Map[K, V]) Snapshot() map[K]V {
+	if p := c.m.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (c *Map[K, V]) Get(key K) (V, bool) {
+	v, ok := c.Snapshot()[key]
+	return v, ok
+}
+
+func (c *Map[K, V]) Len() int {
+	return len(c.Snapshot())
+}
+
+// Range calls fn for the entries of one snapshot until fn returns false.
+func (c *Map[K, V]) Range(fn func(key K, value V) bool) {
+	for k, v := range c.Snapshot() {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Update applies fn to a copy of the map and publishes the copy.
+func (c *Map[K, V]) Update(fn func(m map[K]V)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m := maps.Clone(c.Snapshot())
+	if m == nil {
+		m = make(map[K]V)
+	}
+	fn(m)
+	c.m.Store(&m)
+}
+
+func (c *Map[K, V]) Set(key K, value V) {
+	c.Update(func(m map[K]V) { m[key] = value })
+}
+
+// SetAll sets several entries with a single copy.
+func (c *Map[K, V]) SetAll(entries map[K]V) {
+	c.Update(func(m map[K]V) { maps.Copy(m, entries) })
+}
+
+func (c *Map[K, V]) Delete(keys ...K) {
+	c.Update(func(m map[K]V) {
+		for _, k := range keys {
+			delete(m, k)
+		}
+	})
+}
+
+// Replace publishes a copy of m as the whole map.
+func (c *Map[K, V]) Replace(m map[K]V) {
+	m = maps.Clone(m)
+	if m == nil {
+		m = make(map[K]V)
+	}
+	c.mu.Lock()
+	c.m.Store(&m)
+	c.mu.Unlock()
+}
+
+// Slice is a copy-on-write slice. The zero value is an empty slice ready to
+// use.
+type Slice[T any] struct {
+	mu sync.Mutex // Serializes writers.
+	s  atomic.Pointer[[]T]
+}
+
+// NewSlice returns a Slice holding a copy of s.
+func NewSlice[T any](s []T) *Slice[T] {
+	c := &Slice[T]{}
+	c.Replace(s)
+	return c
+}
+
+// Snapshot returns the current slice, which must not be modified.
+func (c *Slice[T]) Snapshot() []T {
+	if p := c.s.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (c *Slice[T]) Len() int {
+	return len(c.Snapshot())
+}
+
+// Update publishes the result of fn applied to a copy of the slice.
+func (c *Slice[T]) Update(fn func(s []T) []T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := fn(slices.Clone(c.Snapshot()))
+	// Cap the capacity, so appends to a snapshot never share its array.
+	s = s[:len(s):len(s)]
+	c.s.Store(&s)
+}
+
+func (c *Slice[T]) Append(values ...T) {
+	c.Update(func(s []T) []T { return append(s, values...) })
+}
+
+// DeleteFunc removes the elements for which del returns true.
+func (c *Slice[T]) DeleteFunc(del func(T) bool) {
+	c.Update(func(s []T) []T { return slices.DeleteFunc(s, del) })
+}
+
+// Replace publishes a copy of s as the whole slice.
+func (c *Slice[T]) Replace(s []T) {
+	s = slices.Clip(slices.Clone(s))
+	c.mu.Lock()
+	c.s.Store(&s)
+	c.mu.Unlock()
+}
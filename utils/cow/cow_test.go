@@ -0,0 +1,84 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cow
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	var m Map[string, int]
+	assert.Equal(t, 0, m.Len())
+	_, ok := m.Get("a")
+	assert.False(t, ok)
+
+	m.Set("a", 1)
+	snap := m.Snapshot()
+	m.SetAll(map[string]int{"b": 2, "c": 3})
+	m.Delete("a")
+	assert.Equal(t, map[string]int{"a": 1}, snap, "snapshots are immutable")
+	assert.Equal(t, map[string]int{"b": 2, "c": 3}, m.Snapshot())
+
+	src := map[string]int{"x": 1}
+	m2 := NewMap(src)
+	src["x"] = 2
+	v, _ := m2.Get("x")
+	assert.Equal(t, 1, v)
+
+	var keys []string
+	m.Range(func(k string, _ int) bool { keys = append(keys, k); return false })
+	assert.Len(t, keys, 1)
+}
+
+func TestSlice(t *testing.T) {
+	s := NewSlice([]int{1, 2})
+	snap := s.Snapshot()
+	s.Append(3)
+	s.DeleteFunc(func(v int) bool { return v == 1 })
+	assert.Equal(t, []int{1, 2}, snap)
+	assert.Equal(t, []int{2, 3}, s.Snapshot())
+	assert.Equal(t, 2, s.Len())
+
+	// Appending to a snapshot must not write into the published array.
+	grown := append(s.Snapshot(), 9)
+	grown[0] = 7
+	assert.Equal(t, []int{2, 3}, s.Snapshot())
+}
+
+func TestConcurrent(t *testing.T) {
+	var m Map[string, int]
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Set(strconv.Itoa(i*100+j), j)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Range(func(string, int) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 800, m.Len())
+}
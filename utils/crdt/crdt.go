@@ -0,0 +1,147 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crdt provides state-based conflict-free replicated data types:
+// grow-only and positive-negative counters and last-writer-wins registers.
+// Every replica, e.g. a datacenter, updates its own copy and exchanges it
+// with the others; merging copies in any order and any number of times
+// converges to the same value. The types serialize to JSON and are not safe
+// for concurrent use.
+package crdt
+
+// GCounter is a grow-only counter holding the count of every replica.
+type GCounter struct {
+	Counts map[string]uint64 `json:"counts"`
+}
+
+// NewGCounter returns an empty counter.
+func NewGCounter() *GCounter {
+	return &GCounter{Counts: make(map[string]uint64)}
+}
+
+// Inc adds n to the count of replica.
+func (c *GCounter) Inc(replica string, n uint64) {
+	if c.Counts == nil {
+		c.Counts = make(map[string]uint64)
+	}
+	c.Counts[replica] += n
+}
+
+// Value returns the sum over all replicas.
+func (c *GCounter) Value() uint64 {
+	var sum uint64
+	for _, n := range c.Counts {
+		sum += n
+	}
+	return sum
+}
+
+// Merge takes the maximum count of every replica from other.
+func (c *GCounter) Merge(other *GCounter) {
+	if other == nil {
+		return
+	}
+	if c.Counts == nil {
+		c.Counts = make(map[string]uint64, len(other.Counts))
+	}
+	for replica, n := range other.Counts {
+		if n > c.Counts[replica] {
+			c.Counts[replica] = n
+		}
+	}
+}
+
+// Clone returns a copy of c.
+func (c *GCounter) Clone() *GCounter {
+	res := &GCounter{Counts: make(map[string]uint64, len(c.Counts))}
+	for replica, n := range c.Counts {
+		res.Counts[replica] = n
+	}
+	return res
+}
+
+// PNCounter is a counter that can be incremented and decremented, kept as
+// two grow-only counters.
+type PNCounter struct {
+	P GCounter `json:"p"`
+	N GCounter `json:"n"`
+}
+
+// NewPNCounter returns an empty counter.
+func NewPNCounter() *PNCounter {
+	return &PNCounter{P: GCounter{Counts: make(map[string]uint64)}, N: GCounter{Counts: make(map[string]uint64)}}
+}
+
+// Add adds delta, which may be negative, on behalf of replica.
+func (c *PNCounter) Add(replica string, delta int64) {
+	if delta >= 0 {
+		c.P.Inc(replica, uint64(delta))
+	} else {
+		c.N.Inc(replica, uint64(-delta))
+	}
+}
+
+// Value returns the increments minus the decrements of all replicas.
+func (c *PNCounter) Value() int64 {
+	return int64(c.P.Value() - c.N.Value())
+}
+
+// Merge merges the increments and decrements of other.
+func (c *PNCounter) Merge(other *PNCounter) {
+	if other == nil {
+		return
+	}
+	c.P.Merge(&other.P)
+	c.N.Merge(&other.N)
+}
+
+// Clone returns a copy of c.
+func (c *PNCounter) Clone() *PNCounter {
+	return &PNCounter{P: *c.P.Clone(), N: *c.N.Clone()}
+}
+
+// LWWRegister holds the value of the latest write. Writes are ordered by
+// timestamp, e.g. Unix milliseconds or a hybrid logical clock, and ties are
+// broken by replica name so every replica picks the same winner.
+type LWWRegister[T any] struct {
+	Value     T      `json:"value"`
+	Timestamp int64  `json:"ts"`
+	Replica   string `json:"replica"`
+}
+
+func (r *LWWRegister[T]) before(ts int64, replica string) bool {
+	return r.Timestamp < ts || r.Timestamp == ts && r.Replica < replica
+}
+
+// Set writes value when the write is newer than the current one and reports
+// whether it did.
+func (r *LWWRegister[T]) Set(value T, ts int64, replica string) bool {
+	if !r.before(ts, replica) {
+		return false
+	}
+	r.Value, r.Timestamp, r.Replica = value, ts, replica
+	return true
+}
+
+// Merge keeps the newer of r and other and reports whether r changed.
+func (r *LWWRegister[T]) Merge(other *LWWRegister[T]) bool {
+	if other == nil {
+		return false
+	}
+	return r.Set(other.Value, other.Timestamp, other.Replica)
+}
+
+// Flag is a last-writer-wins boolean, e.g. whether a user is online in a
+// datacenter or a conversation is muted.
+type Flag = LWWRegister[bool]
@@ -0,0 +1,126 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crdt
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGCounter(t *testing.T) {
+	a, b := NewGCounter(), NewGCounter()
+	a.Inc("dc1", 3)
+	b.Inc("dc2", 2)
+	b.Inc("dc1", 1) // Stale view of dc1.
+	a.Merge(b)
+	b.Merge(a)
+	assert.Equal(t, uint64(5), a.Value())
+	assert.Equal(t, a, b)
+	a.Merge(b)
+	assert.Equal(t, uint64(5), a.Value())
+
+	var zero GCounter
+	zero.Merge(a)
+	assert.Equal(t, uint64(5), zero.Value())
+}
+
+func TestPNCounter(t *testing.T) {
+	a, b := NewPNCounter(), NewPNCounter()
+	a.Add("dc1", 5)
+	a.Add("dc1", -2)
+	b.Add("dc2", -4)
+	a.Merge(b)
+	assert.Equal(t, int64(-1), a.Value())
+
+	data, err := jsonutil.Marshal(a)
+	require.NoError(t, err)
+	var decoded PNCounter
+	require.NoError(t, jsonutil.Unmarshal(data, &decoded))
+	assert.Equal(t, int64(-1), decoded.Value())
+}
+
+func TestLWWRegister(t *testing.T) {
+	var r LWWRegister[string]
+	assert.True(t, r.Set("a", 10, "dc1"))
+	assert.False(t, r.Set("old", 9, "dc2"))
+	assert.True(t, r.Set("b", 10, "dc2"))  // Tie, higher replica wins.
+	assert.False(t, r.Set("c", 10, "dc1")) // Tie, lower replica loses.
+	assert.Equal(t, "b", r.Value)
+
+	var f Flag
+	f.Set(true, 1, "dc1")
+	other := &Flag{Value: false, Timestamp: 2, Replica: "dc2"}
+	assert.True(t, f.Merge(other))
+	assert.False(t, f.Value)
+	assert.False(t, f.Merge(other))
+
+	data, err := jsonutil.Marshal(&f)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value":false,"ts":2,"replica":"dc2"}`, string(data))
+}
+
+// TestConvergence applies random updates on several replicas and merges
+// them in random orders; all replicas must end up with the same state.
+func TestConvergence(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const replicas = 4
+	counters := make([]*PNCounter, replicas)
+	registers := make([]*LWWRegister[int], replicas)
+	var want int64
+	for i := range counters {
+		counters[i] = NewPNCounter()
+		registers[i] = &LWWRegister[int]{}
+	}
+	for step := 0; step < 1000; step++ {
+		i := rnd.Intn(replicas)
+		name := "dc" + strconv.Itoa(i)
+		switch rnd.Intn(3) {
+		case 0:
+			delta := rnd.Int63n(21) - 10
+			counters[i].Add(name, delta)
+			want += delta
+			registers[i].Set(step, int64(rnd.Intn(100)), name)
+		case 1:
+			j := rnd.Intn(replicas)
+			counters[i].Merge(counters[j].Clone())
+			registers[i].Merge(registers[j])
+		case 2:
+			// Merging a replica with itself must not change it.
+			counters[i].Merge(counters[i].Clone())
+		}
+	}
+	for _, i := range rnd.Perm(replicas) {
+		for _, j := range rnd.Perm(replicas) {
+			counters[i].Merge(counters[j])
+			registers[i].Merge(registers[j])
+		}
+	}
+	for _, i := range rnd.Perm(replicas) {
+		for j := range counters {
+			counters[j].Merge(counters[i])
+			registers[j].Merge(registers[i])
+		}
+	}
+	for i := 1; i < replicas; i++ {
+		assert.Equal(t, counters[0], counters[i])
+		assert.Equal(t, registers[0], registers[i])
+	}
+	assert.Equal(t, want, counters[0].Value())
+}
@@ -0,0 +1,154 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ctxutil tells apart why a context ended. A call failing with
+// context.Canceled or context.DeadlineExceeded is reported as canceled by the
+// client, timed out by this server, or out of the deadline set upstream, each
+// with its own errs code.
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ClientCanceledError   = 1901 // The caller canceled the call.
+	ServerTimeoutError    = 1902 // A timeout set by this server expired.
+	UpstreamDeadlineError = 1903 // The deadline set by the caller expired.
+)
+
+var (
+	ErrClientCanceled   = errs.NewCodeError(ClientCanceledError, "ClientCanceledError")
+	ErrServerTimeout    = errs.NewCodeError(ServerTimeoutError, "ServerTimeoutError")
+	ErrUpstreamDeadline = errs.NewCodeError(UpstreamDeadlineError, "UpstreamDeadlineError")
+)
+
+func init() {
+	// A canceled caller does not want the result anymore, a deadline may be
+	// met by the next attempt.
+	errs.SetRetryClass(ClientCanceledError, errs.Permanent)
+	errs.SetRetryClass(ServerTimeoutError, errs.Temporary)
+	errs.SetRetryClass(UpstreamDeadlineError, errs.Temporary)
+}
+
+// WithTimeoutCause returns a context that times out after timeout with
+// cause, or with ErrServerTimeout when cause is nil.
+func WithTimeoutCause(ctx context.Context, timeout time.Duration, cause error) (context.Context, context.CancelFunc) {
+	if cause == nil {
+		cause = ErrServerTimeout.WrapMsg("server timeout exceeded", "timeout", timeout)
+	}
+	return context.WithTimeoutCause(ctx, timeout, cause)
+}
+
+// WithDeadlineCause is WithTimeoutCause with an absolute deadline.
+func WithDeadlineCause(ctx context.Context, deadline time.Time, cause error) (context.Context, context.CancelFunc) {
+	if cause == nil {
+		cause = ErrServerTimeout.WrapMsg("server deadline exceeded", "deadline", deadline)
+	}
+	return context.WithDeadlineCause(ctx, deadline, cause)
+}
+
+// Cause returns why ctx ended as a coded error, or nil while it is alive.
+// Causes set with the helpers of this package are returned as they are, a
+// plain cancellation is ErrClientCanceled and a plain deadline, which on a
+// server is the one propagated by the caller, is ErrUpstreamDeadline.
+func Cause(ctx context.Context) error {
+	return cause(ctx, false)
+}
+
+// cause is Cause; local reports a plain deadline as ErrServerTimeout, for
+// clients whose deadline was set by this service rather than its caller.
+func cause(ctx context.Context, local bool) error {
+	err := ctx.Err()
+	if err == nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); cause != nil && cause != err {
+		return cause
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrClientCanceled.WrapMsg("context canceled")
+	}
+	if local {
+		return ErrServerTimeout.WrapMsg("context deadline exceeded")
+	}
+	return ErrUpstreamDeadline.WrapMsg("context deadline exceeded")
+}
+
+// Classify replaces an err caused by the end of a context, a context error or
+// a gRPC Canceled or DeadlineExceeded status, with the Cause of ctx. A
+// deadline hit while ctx is still alive is a timeout inside this server.
+// Other errors are returned unchanged.
+func Classify(ctx context.Context, err error) error {
+	return classify(ctx, err, false)
+}
+
+// ClassifyClient is Classify for the client side of a call: an expired
+// plain deadline of ctx was set by this service, so it is reported as
+// ErrServerTimeout instead of ErrUpstreamDeadline.
+func ClassifyClient(ctx context.Context, err error) error {
+	return classify(ctx, err, true)
+}
+
+func classify(ctx context.Context, err error, local bool) error {
+	if !IsContextError(err) {
+		return err
+	}
+	if cause := cause(ctx, local); cause != nil {
+		return errs.WrapMsg(cause, "call interrupted", "err", errs.Unwrap(err).Error())
+	}
+	if isDeadline(err) {
+		return ErrServerTimeout.WrapMsg("call timed out", "err", errs.Unwrap(err).Error())
+	}
+	return err
+}
+
+// IsContextError reports whether err is a cancellation or deadline, local or
+// received from another service, that has not been classified yet.
+func IsContextError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	code := grpcCode(err)
+	return code == codes.Canceled || code == codes.DeadlineExceeded
+}
+
+func isDeadline(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || grpcCode(err) == codes.DeadlineExceeded
+}
+
+// grpcCode returns the gRPC code of err, from a status or from a coded error
+// built from one by the rpc client interceptor.
+func grpcCode(err error) codes.Code {
+	var codeErr errs.CodeError
+	if errors.As(err, &codeErr) {
+		if c := codeErr.Code(); c == int(codes.Canceled) || c == int(codes.DeadlineExceeded) {
+			return codes.Code(c)
+		}
+		return codes.Unknown
+	}
+	if st, ok := status.FromError(errs.Unwrap(err)); ok {
+		return st.Code()
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,81 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctxutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassify(t *testing.T) {
+	plain := errors.New("boom")
+	assert.Equal(t, plain, Classify(context.Background(), plain))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Classify(ctx, fmt.Errorf("query: %w", ctx.Err()))
+	assert.True(t, ErrClientCanceled.Is(err))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	assert.True(t, ErrUpstreamDeadline.Is(Classify(ctx, status.Error(codes.DeadlineExceeded, "deadline"))))
+
+	ctx, cancel = WithTimeoutCause(context.Background(), time.Nanosecond, nil)
+	defer cancel()
+	<-ctx.Done()
+	err = Classify(ctx, errs.Wrap(ctx.Err()))
+	assert.True(t, ErrServerTimeout.Is(err))
+	assert.True(t, errs.IsTemporary(err))
+
+	// A deadline inside the call while the request context is alive.
+	err = Classify(context.Background(), errs.NewCodeError(int(codes.DeadlineExceeded), "deadline").Wrap())
+	assert.True(t, ErrServerTimeout.Is(err))
+	// Already classified errors received from another service stay as they are.
+	assert.Equal(t, ErrClientCanceled, Classify(ctx, ErrClientCanceled))
+}
+
+func TestClassifyRetryClass(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	deadline := status.Error(codes.DeadlineExceeded, "deadline")
+	assert.Equal(t, errs.Temporary, errs.RetryClassOf(deadline))
+	assert.Equal(t, errs.Temporary, errs.RetryClassOf(Classify(ctx, deadline)))
+
+	err := ClassifyClient(ctx, deadline)
+	assert.True(t, ErrServerTimeout.Is(err))
+	assert.Equal(t, errs.Temporary, errs.RetryClassOf(err))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, errs.Permanent, errs.RetryClassOf(ClassifyClient(ctx, status.Error(codes.Canceled, "canceled"))))
+}
+
+func TestCause(t *testing.T) {
+	assert.Nil(t, Cause(context.Background()))
+	custom := errs.New("shutting down")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	cancel(custom)
+	assert.Equal(t, custom, Cause(ctx))
+}
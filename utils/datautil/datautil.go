@@ -15,16 +15,17 @@
 package datautil
 
 import (
-	"math/rand"
+	"cmp"
 	"reflect"
+	"slices"
 	"sort"
-	"time"
 
 	"github.com/jinzhu/copier"
 
 	"github.com/openimsdk/tools/db/pagination"
 	"github.com/openimsdk/tools/errs"
 	"github.com/openimsdk/tools/utils/jsonutil"
+	"github.com/openimsdk/tools/utils/randutil"
 )
 
 // SliceSubFuncs returns elements in slice a that are not present in slice b (a - b) and remove duplicates.
@@ -76,8 +77,12 @@ func SliceIntersectFuncs[T, V any, E comparable](a []T, b []V, fna func(i T) E,
 	for _, item := range a {
 		// Get the comparison value of the element from slice a
 		e := fna(item)
-		// If the element exists in both a and b, and hasn't been added yet, add it to the result
-		if _, ok := k[e]; ok && t[e] == struct{}{} {
+		// Skip elements that do not exist in b
+		if _, ok := k[e]; !ok {
+			continue
+		}
+		// Add the element to the result if it hasn't been added yet
+		if _, ok := t[e]; !ok {
 			rs = append(rs, item)
 			t[e] = struct{}{}
 		}
@@ -87,6 +92,17 @@ func SliceIntersectFuncs[T, V any, E comparable](a []T, b []V, fna func(i T) E,
 	return rs
 }
 
+// SliceIntersectFunc returns the intersection (a ∩ b) of slices a and b, removing duplicates.
+// Determine if elements are equal based on the result returned by fn.
+func SliceIntersectFunc[T any, E comparable](a, b []T, fn func(i T) E) []T {
+	return SliceIntersectFuncs(a, b, fn, fn)
+}
+
+// SliceIntersect returns the intersection (a ∩ b) of slices a and b, removing duplicates.
+func SliceIntersect[E comparable](a, b []E) []E {
+	return SliceIntersectFunc(a, b, func(i E) E { return i })
+}
+
 // SliceSubFunc returns elements in slice a that are not present in slice b (a - b) and remove duplicates.
 // Determine if elements are equal based on the result returned by fn.
 func SliceSubFunc[T any, E comparable](a, b []T, fn func(i T) E) []T {
@@ -127,10 +143,14 @@ func SliceAnySub[E any, T comparable](a, b []E, fn func(t E) T) []E {
 	return es
 }
 
+// smallSliceLen is the length up to which Distinct compares elements with a linear scan,
+// which is cheaper than allocating and hashing into a map.
+const smallSliceLen = 16
+
 // DistinctAny duplicate removal.
 func DistinctAny[E any, K comparable](es []E, fn func(e E) K) []E {
 	v := make([]E, 0, len(es))
-	tmp := map[K]struct{}{}
+	tmp := make(map[K]struct{}, len(es))
 	for i := 0; i < len(es); i++ {
 		t := es[i]
 		k := fn(t)
@@ -144,7 +164,7 @@ func DistinctAny[E any, K comparable](es []E, fn func(e E) K) []E {
 
 func DistinctAnyGetComparable[E any, K comparable](es []E, fn func(e E) K) []K {
 	v := make([]K, 0, len(es))
-	tmp := map[K]struct{}{}
+	tmp := make(map[K]struct{}, len(es))
 	for i := 0; i < len(es); i++ {
 		t := es[i]
 		k := fn(t)
@@ -156,6 +176,9 @@ func DistinctAnyGetComparable[E any, K comparable](es []E, fn func(e E) K) []K {
 	return v
 }
 
+// Distinct removes duplicates, keeping the first occurrence of each element.
+// Integer keys share the generic map path: a concrete map[int64] version
+// benchmarked within noise of it, so there is no int specialization.
 func Distinct[T comparable](ts []T) []T {
 	if len(ts) < 2 {
 		return ts
@@ -166,9 +189,51 @@ func Distinct[T comparable](ts []T) []T {
 			return ts
 		}
 	}
-	return DistinctAny(ts, func(t T) T {
-		return t
-	})
+	if len(ts) <= smallSliceLen {
+		return distinctSmall(ts)
+	}
+	v := make([]T, 0, len(ts))
+	tmp := make(map[T]struct{}, len(ts))
+	for _, t := range ts {
+		if _, ok := tmp[t]; !ok {
+			tmp[t] = struct{}{}
+			v = append(v, t)
+		}
+	}
+	return v
+}
+
+func distinctSmall[T comparable](ts []T) []T {
+	v := make([]T, 0, len(ts))
+	for _, t := range ts {
+		found := false
+		for _, e := range v {
+			if e == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v = append(v, t)
+		}
+	}
+	return v
+}
+
+// DistinctSorted removes duplicates from a sorted slice without allocating a map.
+// The result reuses a new backing array; ts is not modified.
+func DistinctSorted[T comparable](ts []T) []T {
+	if len(ts) < 2 {
+		return ts
+	}
+	v := make([]T, 1, len(ts))
+	v[0] = ts[0]
+	for _, t := range ts[1:] {
+		if t != v[len(v)-1] {
+			v = append(v, t)
+		}
+	}
+	return v
 }
 
 // Delete Delete slice elements, support negative number to delete the reciprocal number
@@ -298,7 +363,7 @@ func Duplicate[E comparable](es []E) bool {
 
 // SliceToMapOkAny slice to map (Custom type, filter)
 func SliceToMapOkAny[E any, K comparable, V any](es []E, fn func(e E) (K, V, bool)) map[K]V {
-	kv := make(map[K]V)
+	kv := make(map[K]V, len(es))
 	for i := 0; i < len(es); i++ {
 		t := es[i]
 		if k, v, ok := fn(t); ok {
@@ -318,10 +383,11 @@ func SliceToMapAny[E any, K comparable, V any](es []E, fn func(e E) (K, V)) map[
 
 // SliceToMap slice to map
 func SliceToMap[E any, K comparable](es []E, fn func(e E) K) map[K]E {
-	return SliceToMapOkAny(es, func(e E) (K, E, bool) {
-		k := fn(e)
-		return k, e, true
-	})
+	kv := make(map[K]E, len(es))
+	for _, e := range es {
+		kv[fn(e)] = e
+	}
+	return kv
 }
 
 // SliceSetAny slice to map[K]struct{}
@@ -351,11 +417,37 @@ func Slice[E any, T any](es []E, fn func(e E) T) []T {
 	return v
 }
 
+// SliceInto converts es with fn into dst[:0] and returns the result.
+// The backing array of dst is reused when cap(dst) >= len(es), otherwise a new one is allocated, so callers
+// in hot paths should keep the returned slice and pass it back as dst on the next call. Elements of dst
+// beyond the returned length are left untouched and the result aliases dst, so dst must not be used
+// concurrently or retained elsewhere.
+func SliceInto[E any, T any](dst []T, es []E, fn func(e E) T) []T {
+	dst = slices.Grow(dst[:0], len(es))[:len(es)]
+	for i := 0; i < len(es); i++ {
+		dst[i] = fn(es[i])
+	}
+	return dst
+}
+
+// FilterInto is Filter appending into dst[:0]; it reuses dst with the same semantics as SliceInto.
+func FilterInto[E, T any](dst []T, es []E, fn func(e E) (T, bool)) []T {
+	dst = slices.Grow(dst[:0], len(es))
+	for i := 0; i < len(es); i++ {
+		if t, ok := fn(es[i]); ok {
+			dst = append(dst, t)
+		}
+	}
+	return dst
+}
+
 // SliceSet slice to map[E]struct{}
 func SliceSet[E comparable](es []E) map[E]struct{} {
-	return SliceSetAny(es, func(e E) E {
-		return e
-	})
+	set := make(map[E]struct{}, len(es))
+	for _, e := range es {
+		set[e] = struct{}{}
+	}
+	return set
 }
 
 // HasKey get whether the map contains key
@@ -432,44 +524,56 @@ func SlicePaginate[E any](es []E, pagination pagination.Pagination) []E {
 }
 
 // BothExistAny gets elements that are common in the slice (intersection)
+// Candidates are taken from the shortest slice and narrowed by each other slice in turn, so only one
+// map the size of the shortest slice is built. The result follows the order of the shortest slice.
 func BothExistAny[E any, K comparable](es [][]E, fn func(e E) K) []E {
 	if len(es) == 0 {
 		return []E{}
 	}
-	var idx int
-	ei := make([]map[K]E, len(es))
-	for i := 0; i < len(ei); i++ {
-		e := es[i]
-		if len(e) == 0 {
+	idx := 0
+	for i := 0; i < len(es); i++ {
+		if len(es[i]) == 0 {
 			return []E{}
 		}
-		kv := make(map[K]E)
-		for j := 0; j < len(e); j++ {
-			t := e[j]
-			k := fn(t)
-			kv[k] = t
-		}
-		ei[i] = kv
-		if len(kv) < len(ei[idx]) {
+		if len(es[i]) < len(es[idx]) {
 			idx = i
 		}
 	}
-	v := make([]E, 0, len(ei[idx]))
-	for k := range ei[idx] {
-		all := true
-		for i := 0; i < len(ei); i++ {
-			if i == idx {
-				continue
-			}
-			if _, ok := ei[i][k]; !ok {
-				all = false
-				break
+	base := es[idx]
+	// cand maps each candidate key to the round in which it was last confirmed.
+	cand := make(map[K]int, len(base))
+	for _, e := range base {
+		cand[fn(e)] = 0
+	}
+	round := 0
+	for i := 0; i < len(es); i++ {
+		if i == idx {
+			continue
+		}
+		round++
+		hits := 0
+		for _, e := range es[i] {
+			k := fn(e)
+			if r, ok := cand[k]; ok && r == round-1 {
+				cand[k] = round
+				hits++
 			}
 		}
-		if !all {
-			continue
+		if hits == 0 {
+			return []E{}
 		}
-		v = append(v, ei[idx][k])
+	}
+	// Walk base backwards so that, as with a map keyed by fn, the last of several equal elements is kept.
+	v := make([]E, 0, len(cand))
+	for i := len(base) - 1; i >= 0; i-- {
+		k := fn(base[i])
+		if cand[k] == round {
+			v = append(v, base[i])
+			cand[k] = -1
+		}
+	}
+	for i, j := 0, len(v)-1; i < j; i, j = i+1, j-1 {
+		v[i], v[j] = v[j], v[i]
 	}
 	return v
 }
@@ -481,6 +585,39 @@ func BothExist[E comparable](es ...[]E) []E {
 	})
 }
 
+// BothExistSorted returns the distinct elements common to all sorted slices by merging them,
+// without allocating maps.
+func BothExistSorted[E cmp.Ordered](es ...[]E) []E {
+	if len(es) == 0 {
+		return []E{}
+	}
+	v := DistinctSorted(es[0])
+	for _, s := range es[1:] {
+		res := make([]E, 0, min(len(v), len(s)))
+		i, j := 0, 0
+		for i < len(v) && j < len(s) {
+			switch {
+			case v[i] < s[j]:
+				i++
+			case v[i] > s[j]:
+				j++
+			default:
+				res = append(res, v[i])
+				i++
+				j++
+			}
+		}
+		v = res
+		if len(v) == 0 {
+			break
+		}
+	}
+	if v == nil {
+		return []E{}
+	}
+	return v
+}
+
 //func CompleteAny[K comparable, E any](ks []K, es []E, fn func(e E) K) bool {
 //	if len(ks) == 0 && len(es) == 0 {
 //		return true
@@ -706,6 +843,15 @@ func Batch[T any, V any](fn func(T) V, ts []T) []V {
 	return res
 }
 
+// BatchInto is Batch writing into dst[:0]; it reuses dst with the same semantics as SliceInto.
+// Unlike Batch, a nil ts yields an empty, non-nil result when dst is non-nil.
+func BatchInto[T any, V any](dst []V, fn func(T) V, ts []T) []V {
+	if ts == nil && dst == nil {
+		return nil
+	}
+	return SliceInto(dst, ts, fn)
+}
+
 func InitSlice[T any](val *[]T) {
 	if val != nil && *val == nil {
 		*val = []T{}
@@ -747,11 +893,8 @@ func CopySlice[T any](a []T) []T {
 }
 
 func ShuffleSlice[T any](a []T) []T {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	shuffled := CopySlice(a)
-	r.Shuffle(len(shuffled), func(i, j int) {
-		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
-	})
+	randutil.Shuffle(shuffled)
 	return shuffled
 }
 
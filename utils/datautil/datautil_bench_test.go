@@ -0,0 +1,127 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datautil
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+var benchSizes = []int{8, 1000, 100000}
+
+func benchInt64s(n int) []int64 {
+	r := rand.New(rand.NewSource(1))
+	s := make([]int64, n)
+	for i := range s {
+		s[i] = r.Int63n(int64(n/2 + 1))
+	}
+	return s
+}
+
+func benchStrings(n int) []string {
+	s := make([]string, n)
+	for i, v := range benchInt64s(n) {
+		s[i] = "user_" + strconv.FormatInt(v, 10)
+	}
+	return s
+}
+
+func BenchmarkDistinct(b *testing.B) {
+	for _, n := range benchSizes {
+		ints, strs := benchInt64s(n), benchStrings(n)
+		sorted := append([]int64(nil), ints...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		b.Run("int64/"+strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Distinct(ints)
+			}
+		})
+		b.Run("string/"+strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Distinct(strs)
+			}
+		})
+		b.Run("sorted/"+strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				DistinctSorted(sorted)
+			}
+		})
+	}
+}
+
+func BenchmarkSliceToMap(b *testing.B) {
+	type item struct {
+		ID   string
+		Seq  int64
+		Name string
+	}
+	for _, n := range benchSizes {
+		items := make([]item, n)
+		for i, s := range benchStrings(n) {
+			items[i] = item{ID: s, Seq: int64(i)}
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				SliceToMap(items, func(e item) string { return e.ID })
+			}
+		})
+	}
+}
+
+func BenchmarkBothExist(b *testing.B) {
+	for _, n := range benchSizes {
+		x, y := benchInt64s(n), benchInt64s(n/2+1)
+		sx := append([]int64(nil), x...)
+		sy := append([]int64(nil), y...)
+		sort.Slice(sx, func(i, j int) bool { return sx[i] < sx[j] })
+		sort.Slice(sy, func(i, j int) bool { return sy[i] < sy[j] })
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BothExist(x, y)
+			}
+		})
+		b.Run("sorted/"+strconv.Itoa(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BothExistSorted(sx, sy)
+			}
+		})
+	}
+}
+
+func BenchmarkSliceInto(b *testing.B) {
+	src := benchInt64s(1000)
+	fn := func(e int64) int { return int(e) }
+	b.Run("Slice", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Slice(src, fn)
+		}
+	})
+	b.Run("SliceInto", func(b *testing.B) {
+		b.ReportAllocs()
+		var dst []int
+		for i := 0; i < b.N; i++ {
+			dst = SliceInto(dst, src, fn)
+		}
+	})
+}
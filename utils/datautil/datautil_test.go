@@ -16,8 +16,13 @@ package datautil
 
 import (
 	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
+	"strconv"
 	"testing"
+
+	"github.com/openimsdk/tools/testutil/gen"
 )
 
 func TestSliceSubFunc(t *testing.T) {
@@ -303,3 +308,118 @@ func TestStructFieldNotNilReplace(t *testing.T) {
 	}
 
 }
+
+type slicePair struct {
+	A, B []int
+}
+
+// slicePairs generates small-valued slices so that duplicates and overlaps are common.
+func slicePairs() gen.Gen[slicePair] {
+	s := gen.SliceOf(gen.IntRange(0, 20), 30)
+	return gen.New(func(r *rand.Rand) slicePair {
+		return slicePair{A: s.Generate(r), B: s.Generate(r)}
+	}, func(p slicePair) []slicePair {
+		var res []slicePair
+		for _, a := range s.Shrink(p.A) {
+			res = append(res, slicePair{A: a, B: p.B})
+		}
+		for _, b := range s.Shrink(p.B) {
+			res = append(res, slicePair{A: p.A, B: b})
+		}
+		return res
+	})
+}
+
+func TestSliceSetOperationsProperty(t *testing.T) {
+	gen.Check(t, slicePairs(), func(p slicePair) bool {
+		sub, inter := SliceSub(p.A, p.B), SliceIntersect(p.A, p.B)
+		if len(p.B) == 0 {
+			// An empty b returns a itself, duplicates included.
+			return reflect.DeepEqual(sub, p.A) && len(inter) == 0
+		}
+		if Duplicate(sub) || Duplicate(inter) {
+			return false
+		}
+		// sub and inter are disjoint and together form the distinct elements of a.
+		union := append(append([]int{}, sub...), inter...)
+		return !Duplicate(union) && reflect.DeepEqual(SliceSet(union), SliceSet(Distinct(p.A)))
+	})
+}
+
+func TestSliceIntersectProperty(t *testing.T) {
+	gen.Check(t, slicePairs(), func(p slicePair) bool {
+		inter := SliceIntersect(p.A, p.B)
+		both := BothExist(p.A, p.B)
+		if len(inter) != len(both) {
+			return false
+		}
+		bs := SliceSet(p.B)
+		for _, e := range inter {
+			if _, ok := bs[e]; !ok {
+				return false
+			}
+		}
+		return reflect.DeepEqual(SliceSet(inter), SliceSet(both))
+	})
+}
+
+func TestDistinctProperty(t *testing.T) {
+	gen.Check(t, gen.SliceOf(gen.IntRange(0, 10), 30), func(s []int) bool {
+		d := Distinct(s)
+		return !Duplicate(d) && reflect.DeepEqual(SliceSet(d), SliceSet(s))
+	})
+}
+
+func TestDistinctSorted(t *testing.T) {
+	gen.Check(t, gen.SliceOf(gen.IntRange(0, 10), 40), func(s []int) bool {
+		sorted := append([]int(nil), s...)
+		sort.Ints(sorted)
+		return reflect.DeepEqual(DistinctSorted(sorted), Distinct(sorted))
+	})
+}
+
+func TestBothExistSorted(t *testing.T) {
+	gen.Check(t, slicePairs(), func(p slicePair) bool {
+		a, b := append([]int(nil), p.A...), append([]int(nil), p.B...)
+		sort.Ints(a)
+		sort.Ints(b)
+		return reflect.DeepEqual(SliceSet(BothExistSorted(a, b)), SliceSet(BothExist(a, b)))
+	})
+	if got := BothExistSorted([]int{1, 2, 2, 3}, []int{2, 3, 3, 4}, []int{0, 3}); !reflect.DeepEqual(got, []int{3}) {
+		t.Fatal(got)
+	}
+}
+
+func TestBothExistOrder(t *testing.T) {
+	got := BothExist([]int{5, 1, 4, 1, 2}, []int{1, 2, 3, 4, 5, 6, 7})
+	if !reflect.DeepEqual(got, []int{5, 4, 1, 2}) {
+		t.Fatal(got)
+	}
+}
+
+func TestSliceInto(t *testing.T) {
+	buf := make([]string, 0, 4)
+	out := SliceInto(buf, []int{1, 2, 3}, strconv.Itoa)
+	if !reflect.DeepEqual(out, []string{"1", "2", "3"}) || &out[0] != &buf[:1][0] {
+		t.Fatal("expected conversion into reused buffer", out)
+	}
+	out = SliceInto(out, []int{7}, strconv.Itoa)
+	if !reflect.DeepEqual(out, []string{"7"}) {
+		t.Fatal(out)
+	}
+	out = SliceInto(out, []int{1, 2, 3, 4, 5}, strconv.Itoa)
+	if len(out) != 5 || cap(out) < 5 {
+		t.Fatal(out)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { out = SliceInto(out, []int{1, 2}, strconv.Itoa) }); allocs != 0 {
+		t.Fatalf("expected no allocations, got %v", allocs)
+	}
+
+	even := FilterInto(nil, []int{1, 2, 3, 4}, func(e int) (int, bool) { return e * 10, e%2 == 0 })
+	if !reflect.DeepEqual(even, []int{20, 40}) {
+		t.Fatal(even)
+	}
+	if BatchInto[int, string](nil, strconv.Itoa, nil) != nil {
+		t.Fatal("expected nil")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datautil
+
+import (
+	"github.com/openimsdk/tools/errs"
+)
+
+// PartialResult is the outcome of a batch lookup that may succeed for some
+// keys only. Every requested key ends up in exactly one of Found, Missing and
+// Errors.
+type PartialResult[K comparable, V any] struct {
+	Found   map[K]V
+	Missing []K
+	Errors  map[K]error
+}
+
+func NewPartialResult[K comparable, V any]() *PartialResult[K, V] {
+	return &PartialResult[K, V]{Found: make(map[K]V), Errors: make(map[K]error)}
+}
+
+// Complete reports whether every key was found.
+func (r *PartialResult[K, V]) Complete() bool {
+	return len(r.Missing) == 0 && len(r.Errors) == 0
+}
+
+// Failed reports whether no key was found and at least one lookup failed, so
+// the batch as a whole should be reported as an error.
+func (r *PartialResult[K, V]) Failed() bool {
+	return len(r.Found) == 0 && len(r.Missing) == 0 && len(r.Errors) > 0
+}
+
+// Err returns the error of the first key in keys that failed, or nil.
+func (r *PartialResult[K, V]) Err(keys []K) error {
+	for _, k := range keys {
+		if err, ok := r.Errors[k]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Values returns the found values in the order of keys.
+func (r *PartialResult[K, V]) Values(keys []K) []V {
+	vs := make([]V, 0, len(r.Found))
+	for _, k := range keys {
+		if v, ok := r.Found[k]; ok {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// PartialGet looks every distinct key up with fn. Keys failing with
+// errs.ErrRecordNotFound are missing, other failures are kept per key.
+func PartialGet[K comparable, V any](keys []K, fn func(key K) (V, error)) *PartialResult[K, V] {
+	r := NewPartialResult[K, V]()
+	for _, k := range Distinct(keys) {
+		v, err := fn(k)
+		switch {
+		case err == nil:
+			r.Found[k] = v
+		case errs.ErrRecordNotFound.Is(err):
+			r.Missing = append(r.Missing, k)
+		default:
+			r.Errors[k] = err
+		}
+	}
+	return r
+}
+
+// PartialGetBatch looks the distinct keys up with fn in batches of size, or
+// all at once when size is not positive. Keys absent from the map returned
+// by fn are missing. When a batch fails its keys get the error, while the
+// other batches are still looked up.
+func PartialGetBatch[K comparable, V any](keys []K, size int, fn func(keys []K) (map[K]V, error)) *PartialResult[K, V] {
+	r := NewPartialResult[K, V]()
+	keys = Distinct(keys)
+	if size <= 0 {
+		size = len(keys)
+	}
+	for start := 0; start < len(keys); start += size {
+		batch := keys[start:min(start+size, len(keys))]
+		found, err := fn(batch)
+		for _, k := range batch {
+			if err != nil {
+				r.Errors[k] = err
+			} else if v, ok := found[k]; ok {
+				r.Found[k] = v
+			} else {
+				r.Missing = append(r.Missing, k)
+			}
+		}
+	}
+	return r
+}
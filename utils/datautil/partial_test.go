@@ -0,0 +1,60 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datautil
+
+import (
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartialGet(t *testing.T) {
+	users := map[string]int{"a": 1, "c": 3}
+	r := PartialGet([]string{"a", "b", "c", "d", "a"}, func(k string) (int, error) {
+		if k == "d" {
+			return 0, errs.ErrInternalServer.WrapMsg("db down")
+		}
+		if v, ok := users[k]; ok {
+			return v, nil
+		}
+		return 0, errs.ErrRecordNotFound.WrapMsg("user not found", "userID", k)
+	})
+	assert.Equal(t, map[string]int{"a": 1, "c": 3}, r.Found)
+	assert.Equal(t, []string{"b"}, r.Missing)
+	assert.Len(t, r.Errors, 1)
+	assert.Equal(t, []int{3, 1}, r.Values([]string{"c", "b", "a"}))
+	assert.False(t, r.Complete())
+	assert.False(t, r.Failed())
+	assert.True(t, errs.ErrInternalServer.Is(r.Err([]string{"a", "d"})))
+}
+
+func TestPartialGetBatch(t *testing.T) {
+	var batches [][]int
+	r := PartialGetBatch([]int{1, 2, 3, 4, 5}, 2, func(keys []int) (map[int]string, error) {
+		batches = append(batches, keys)
+		if keys[0] == 3 {
+			return nil, errs.ErrInternalServer.Wrap()
+		}
+		return map[int]string{1: "one", 5: "five"}, nil
+	})
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}, {5}}, batches)
+	assert.Equal(t, map[int]string{1: "one", 5: "five"}, r.Found)
+	assert.Equal(t, []int{2}, r.Missing)
+	assert.Len(t, r.Errors, 2)
+
+	r = PartialGetBatch([]int{1}, 0, func([]int) (map[int]string, error) { return nil, errs.ErrArgs.Wrap() })
+	assert.True(t, r.Failed())
+}
@@ -0,0 +1,86 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"encoding/base32"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var crockfordEncoding = base32.NewEncoding(crockfordAlphabet).WithPadding(base32.NoPadding)
+
+// crockfordNormalizer maps the ambiguous characters allowed by the Crockford spec onto canonical symbols
+// and drops the hyphens used for readability.
+var crockfordNormalizer = strings.NewReplacer(
+	"-", "",
+	"I", "1", "i", "1",
+	"L", "1", "l", "1",
+	"O", "0", "o", "0",
+)
+
+// CrockfordEncode encodes data with the Crockford base32 alphabet, without padding.
+// The output avoids I, L, O and U, which makes it suitable for codes typed in by users.
+func CrockfordEncode(data []byte) string {
+	return crockfordEncoding.EncodeToString(data)
+}
+
+// CrockfordDecode decodes a Crockford base32 string. Decoding is case-insensitive, ignores hyphens
+// and accepts I/L for 1 and O for 0.
+func CrockfordDecode(s string) ([]byte, error) {
+	data, err := crockfordEncoding.DecodeString(strings.ToUpper(crockfordNormalizer.Replace(s)))
+	if err != nil {
+		return nil, errs.WrapMsg(err, "crockford base32 decode failed", "data", s)
+	}
+	return data, nil
+}
+
+// CrockfordEncodeUint64 encodes n as a Crockford base32 number (most significant symbol first).
+func CrockfordEncodeUint64(n uint64) string {
+	if n == 0 {
+		return "0"
+	}
+	var buf [13]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = crockfordAlphabet[n&31]
+		n >>= 5
+	}
+	return string(buf[i:])
+}
+
+// CrockfordDecodeUint64 decodes a number produced by CrockfordEncodeUint64, with the same leniency as CrockfordDecode.
+func CrockfordDecodeUint64(s string) (uint64, error) {
+	norm := strings.ToUpper(crockfordNormalizer.Replace(s))
+	if norm == "" {
+		return 0, errs.New("crockford base32 string is empty").Wrap()
+	}
+	var n uint64
+	for i := 0; i < len(norm); i++ {
+		v := strings.IndexByte(crockfordAlphabet, norm[i])
+		if v < 0 {
+			return 0, errs.New("invalid crockford base32 character", "data", s).Wrap()
+		}
+		if n>>59 != 0 {
+			return 0, errs.New("crockford base32 value overflows uint64", "data", s).Wrap()
+		}
+		n = n<<5 | uint64(v)
+	}
+	return n, nil
+}
@@ -0,0 +1,128 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"github.com/openimsdk/tools/errs"
+)
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var base62Index = func() [256]int8 {
+	var idx [256]int8
+	for i := range idx {
+		idx[i] = -1
+	}
+	for i := 0; i < len(base62Alphabet); i++ {
+		idx[base62Alphabet[i]] = int8(i)
+	}
+	return idx
+}()
+
+// Base62EncodeUint64 encodes n using the alphabet 0-9A-Za-z, so the result sorts like n for equal lengths.
+func Base62EncodeUint64(n uint64) string {
+	if n == 0 {
+		return "0"
+	}
+	var buf [11]byte
+	i := len(buf)
+	for n > 0 {
+		i--
+		buf[i] = base62Alphabet[n%62]
+		n /= 62
+	}
+	return string(buf[i:])
+}
+
+// Base62DecodeUint64 decodes a string produced by Base62EncodeUint64.
+func Base62DecodeUint64(s string) (uint64, error) {
+	if s == "" {
+		return 0, errs.New("base62 string is empty").Wrap()
+	}
+	var n uint64
+	for i := 0; i < len(s); i++ {
+		v := base62Index[s[i]]
+		if v < 0 {
+			return 0, errs.New("invalid base62 character", "data", s, "index", i).Wrap()
+		}
+		next := n*62 + uint64(v)
+		if n > (1<<64-1)/62 || next < n*62 {
+			return 0, errs.New("base62 value overflows uint64", "data", s).Wrap()
+		}
+		n = next
+	}
+	return n, nil
+}
+
+// Base62Encode encodes arbitrary bytes as base62. Leading zero bytes are kept as leading '0' characters,
+// so the encoding round-trips exactly.
+func Base62Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	// log(256)/log(62) ≈ 1.344
+	digits := make([]byte, 0, len(data)*138/100+1)
+	for _, b := range data[zeros:] {
+		carry := int(b)
+		for j := 0; j < len(digits); j++ {
+			carry += int(digits[j]) << 8
+			digits[j] = byte(carry % 62)
+			carry /= 62
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%62))
+			carry /= 62
+		}
+	}
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = base62Alphabet[0]
+	}
+	for i := 0; i < len(digits); i++ {
+		out[zeros+i] = base62Alphabet[digits[len(digits)-1-i]]
+	}
+	return string(out)
+}
+
+// Base62Decode decodes a string produced by Base62Encode.
+func Base62Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base62Alphabet[0] {
+		zeros++
+	}
+	bytes := make([]byte, 0, len(s)*3/4+1)
+	for i := zeros; i < len(s); i++ {
+		v := base62Index[s[i]]
+		if v < 0 {
+			return nil, errs.New("invalid base62 character", "data", s, "index", i).Wrap()
+		}
+		carry := int(v)
+		for j := 0; j < len(bytes); j++ {
+			carry += int(bytes[j]) * 62
+			bytes[j] = byte(carry & 0xff)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bytes = append(bytes, byte(carry&0xff))
+			carry >>= 8
+		}
+	}
+	out := make([]byte, zeros+len(bytes))
+	for i := 0; i < len(bytes); i++ {
+		out[zeros+i] = bytes[len(bytes)-1-i]
+	}
+	return out, nil
+}
@@ -0,0 +1,78 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase62Bytes(t *testing.T) {
+	cases := [][]byte{{}, {0}, {0, 0, 1}, {255, 255}, []byte("hello world")}
+	for _, c := range cases {
+		s := Base62Encode(c)
+		got, err := Base62Decode(s)
+		assert.NoError(t, err)
+		assert.Equal(t, c, got, "encoded %q", s)
+	}
+	_, err := Base62Decode("abc$")
+	assert.Error(t, err)
+}
+
+func TestBase62Uint64(t *testing.T) {
+	for _, n := range []uint64{0, 1, 61, 62, 123456789, math.MaxUint64} {
+		v, err := Base62DecodeUint64(Base62EncodeUint64(n))
+		assert.NoError(t, err)
+		assert.Equal(t, n, v)
+	}
+	_, err := Base62DecodeUint64("zzzzzzzzzzzz")
+	assert.Error(t, err)
+}
+
+func TestCrockford(t *testing.T) {
+	data := []byte{0xde, 0xad, 0xbe, 0xef, 0x01}
+	s := CrockfordEncode(data)
+	got, err := CrockfordDecode(s)
+	assert.NoError(t, err)
+	assert.Equal(t, data, got)
+
+	n, err := CrockfordDecodeUint64("1o-Il")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1<<15|1<<5|1), n)
+	for _, n := range []uint64{0, 31, 32, math.MaxUint64} {
+		v, err := CrockfordDecodeUint64(CrockfordEncodeUint64(n))
+		assert.NoError(t, err)
+		assert.Equal(t, n, v)
+	}
+	_, err = CrockfordDecodeUint64("U")
+	assert.Error(t, err)
+}
+
+func TestPackTuple(t *testing.T) {
+	tuple := Tuple{Timestamp: 1718000000123, Shard: 7, Sequence: 42}
+	s, err := PackTuple(tuple)
+	assert.NoError(t, err)
+	assert.Len(t, s, 16)
+	got, err := UnpackTuple(s)
+	assert.NoError(t, err)
+	assert.Equal(t, tuple, got)
+
+	_, err = PackTuple(Tuple{Timestamp: -1})
+	assert.Error(t, err)
+	_, err = UnpackTuple("short")
+	assert.Error(t, err)
+}
@@ -0,0 +1,228 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gatewayproto implements the compact binary framing used between
+// clients and the message gateway.
+//
+// A frame is laid out as
+//
+//	uvarint  length of everything that follows
+//	byte     protocol version
+//	byte     flags, bit 0 set when the body is deflate compressed
+//	uvarint  opcode
+//	bytes    body
+//
+// Decoders accept every version up to Version, so new fields can only be
+// introduced together with a version bump.
+package gatewayproto
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Version is the highest protocol version this package encodes and decodes.
+const Version = 1
+
+const flagCompressed = 1 << 0
+
+const (
+	DefaultMaxFrameSize      = 4 << 20
+	DefaultCompressThreshold = 1024
+)
+
+var (
+	// ErrShortFrame means the buffer does not hold a complete frame yet.
+	ErrShortFrame = errs.New("gateway frame incomplete")
+	// ErrFrameTooLarge means the frame or its decompressed body exceeds MaxFrameSize.
+	ErrFrameTooLarge = errs.New("gateway frame too large")
+	// ErrUnsupportedVersion means the frame was written by a newer protocol version.
+	ErrUnsupportedVersion = errs.New("gateway frame version unsupported")
+	// ErrInvalidFrame means the frame is malformed.
+	ErrInvalidFrame = errs.New("gateway frame invalid")
+)
+
+// Frame is a single protocol message.
+type Frame struct {
+	Version uint8
+	Opcode  uint32
+	Body    []byte
+}
+
+// Codec encodes and decodes frames. The zero value is not usable, use NewCodec.
+type Codec struct {
+	// MaxFrameSize limits both the encoded frame and the decompressed body.
+	MaxFrameSize int
+	// CompressThreshold is the body size from which bodies are compressed,
+	// a negative value disables compression.
+	CompressThreshold int
+}
+
+// NewCodec returns a Codec with the default limits.
+func NewCodec() *Codec {
+	return &Codec{MaxFrameSize: DefaultMaxFrameSize, CompressThreshold: DefaultCompressThreshold}
+}
+
+// Append encodes f and appends it to dst. A zero f.Version is written as Version.
+func (c *Codec) Append(dst []byte, f *Frame) ([]byte, error) {
+	version := f.Version
+	if version == 0 {
+		version = Version
+	}
+	if version > Version {
+		return dst, errs.WrapMsg(ErrUnsupportedVersion, "encode gateway frame", "version", version)
+	}
+	if len(f.Body) > c.MaxFrameSize {
+		return dst, errs.WrapMsg(ErrFrameTooLarge, "encode gateway frame", "size", len(f.Body), "max", c.MaxFrameSize)
+	}
+	var flags byte
+	body := f.Body
+	if c.CompressThreshold >= 0 && len(body) >= c.CompressThreshold && len(body) > 0 {
+		if compressed, ok := compress(body); ok {
+			body = compressed
+			flags |= flagCompressed
+		}
+	}
+	var opcode [binary.MaxVarintLen32]byte
+	n := binary.PutUvarint(opcode[:], uint64(f.Opcode))
+	length := 2 + n + len(body)
+	if length > c.MaxFrameSize {
+		return dst, errs.WrapMsg(ErrFrameTooLarge, "encode gateway frame", "size", length, "max", c.MaxFrameSize)
+	}
+	dst = binary.AppendUvarint(dst, uint64(length))
+	dst = append(dst, version, flags)
+	dst = append(dst, opcode[:n]...)
+	return append(dst, body...), nil
+}
+
+// Encode returns the encoding of f.
+func (c *Codec) Encode(f *Frame) ([]byte, error) {
+	return c.Append(nil, f)
+}
+
+// Decode decodes the first frame in data and returns it with the number of
+// bytes consumed. ErrShortFrame is returned while data holds a partial frame.
+func (c *Codec) Decode(data []byte) (*Frame, int, error) {
+	length, n := binary.Uvarint(data)
+	switch {
+	case n == 0:
+		return nil, 0, ErrShortFrame
+	case n < 0:
+		return nil, 0, errs.WrapMsg(ErrInvalidFrame, "bad length")
+	case length > uint64(c.MaxFrameSize):
+		return nil, 0, errs.WrapMsg(ErrFrameTooLarge, "decode gateway frame", "size", length, "max", c.MaxFrameSize)
+	case uint64(len(data)-n) < length:
+		return nil, 0, ErrShortFrame
+	}
+	f, err := c.decodePayload(data[n : n+int(length)])
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, n + int(length), nil
+}
+
+func (c *Codec) decodePayload(p []byte) (*Frame, error) {
+	if len(p) < 3 {
+		return nil, errs.WrapMsg(ErrInvalidFrame, "frame header truncated")
+	}
+	version, flags := p[0], p[1]
+	if version == 0 {
+		return nil, errs.WrapMsg(ErrInvalidFrame, "zero version")
+	}
+	if version > Version {
+		return nil, errs.WrapMsg(ErrUnsupportedVersion, "decode gateway frame", "version", version)
+	}
+	if flags&^flagCompressed != 0 {
+		return nil, errs.WrapMsg(ErrInvalidFrame, "unknown flags", "flags", flags)
+	}
+	opcode, n := binary.Uvarint(p[2:])
+	if n <= 0 || opcode > 1<<32-1 {
+		return nil, errs.WrapMsg(ErrInvalidFrame, "bad opcode")
+	}
+	body := p[2+n:]
+	if flags&flagCompressed != 0 {
+		var err error
+		if body, err = c.decompress(body); err != nil {
+			return nil, err
+		}
+	} else {
+		body = bytes.Clone(body)
+	}
+	return &Frame{Version: version, Opcode: uint32(opcode), Body: body}, nil
+}
+
+// ReadFrame reads one frame from r.
+func (c *Codec) ReadFrame(r *bufio.Reader) (*Frame, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errs.WrapMsg(ErrInvalidFrame, "read length", "err", err)
+	}
+	if length > uint64(c.MaxFrameSize) {
+		return nil, errs.WrapMsg(ErrFrameTooLarge, "read gateway frame", "size", length, "max", c.MaxFrameSize)
+	}
+	p := make([]byte, length)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, errs.WrapMsg(err, "read gateway frame", "size", length)
+	}
+	return c.decodePayload(p)
+}
+
+// WriteFrame writes f to w.
+func (c *Codec) WriteFrame(w io.Writer, f *Frame) error {
+	data, err := c.Encode(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return errs.Wrap(err)
+}
+
+func compress(body []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := fw.Write(body); err != nil {
+		return nil, false
+	}
+	if err := fw.Close(); err != nil {
+		return nil, false
+	}
+	if buf.Len() >= len(body) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func (c *Codec) decompress(body []byte) ([]byte, error) {
+	fr := flate.NewReader(bytes.NewReader(body))
+	defer fr.Close()
+	out, err := io.ReadAll(io.LimitReader(fr, int64(c.MaxFrameSize)+1))
+	if err != nil {
+		return nil, errs.WrapMsg(ErrInvalidFrame, "decompress body", "err", err)
+	}
+	if len(out) > c.MaxFrameSize {
+		return nil, errs.WrapMsg(ErrFrameTooLarge, "decompressed body", "max", c.MaxFrameSize)
+	}
+	return out, nil
+}
@@ -0,0 +1,140 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gatewayproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTrip(t *testing.T) {
+	c := NewCodec()
+	frames := []*Frame{
+		{Opcode: 0},
+		{Opcode: 1001, Body: []byte(`{"sendID":"u1"}`)},
+		{Opcode: 1 << 31, Body: bytes.Repeat([]byte("openim "), 1000)},
+	}
+	var stream []byte
+	for _, f := range frames {
+		var err error
+		stream, err = c.Append(stream, f)
+		require.NoError(t, err)
+	}
+	assert.Less(t, len(stream), 1000, "large repetitive body should be compressed")
+
+	r := bufio.NewReader(bytes.NewReader(stream))
+	for _, want := range frames {
+		got, n, err := c.Decode(stream)
+		require.NoError(t, err)
+		stream = stream[n:]
+		assert.Equal(t, uint8(Version), got.Version)
+		assert.Equal(t, want.Opcode, got.Opcode)
+		assert.Equal(t, len(want.Body), len(got.Body))
+		assert.True(t, bytes.Equal(want.Body, got.Body))
+
+		got, err = c.ReadFrame(r)
+		require.NoError(t, err)
+		assert.True(t, bytes.Equal(want.Body, got.Body))
+	}
+	assert.Empty(t, stream)
+	_, err := c.ReadFrame(r)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWireFormat(t *testing.T) {
+	c := NewCodec()
+	data, err := c.Encode(&Frame{Opcode: 300, Body: []byte("hi")})
+	require.NoError(t, err)
+	// length 6, version 1, flags 0, opcode 300 as uvarint, body.
+	assert.Equal(t, []byte{6, 1, 0, 0xac, 0x02, 'h', 'i'}, data)
+}
+
+func TestShortFrame(t *testing.T) {
+	c := NewCodec()
+	data, err := c.Encode(&Frame{Opcode: 7, Body: []byte("payload")})
+	require.NoError(t, err)
+	for i := 0; i < len(data); i++ {
+		_, _, err := c.Decode(data[:i])
+		assert.ErrorIs(t, err, ErrShortFrame, i)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	c := &Codec{MaxFrameSize: 4096, CompressThreshold: -1}
+	_, err := c.Encode(&Frame{Body: make([]byte, 4097)})
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+
+	// A small compressed frame must not expand beyond the limit.
+	big := &Codec{MaxFrameSize: 1 << 20, CompressThreshold: 0}
+	bomb, err := big.Encode(&Frame{Body: make([]byte, 1<<20)})
+	require.NoError(t, err)
+	require.Less(t, len(bomb), 4096)
+	_, _, err = c.Decode(bomb)
+	assert.ErrorIs(t, err, ErrFrameTooLarge)
+}
+
+func TestVersion(t *testing.T) {
+	c := NewCodec()
+	_, err := c.Encode(&Frame{Version: Version + 1})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	_, _, err = c.Decode([]byte{3, Version + 1, 0, 1})
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+	_, _, err = c.Decode([]byte{3, Version, 0x80, 1})
+	assert.ErrorIs(t, err, ErrInvalidFrame)
+}
+
+func FuzzDecode(f *testing.F) {
+	c := NewCodec()
+	for _, frame := range []*Frame{
+		{Opcode: 1, Body: []byte("hello")},
+		{Opcode: 1 << 20, Body: bytes.Repeat([]byte("ab"), 1024)},
+	} {
+		data, err := c.Encode(frame)
+		require.NoError(f, err)
+		f.Add(data)
+	}
+	f.Add([]byte{3, 1, 1, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		codec := &Codec{MaxFrameSize: 1 << 16, CompressThreshold: DefaultCompressThreshold}
+		frame, n, err := codec.Decode(data)
+		if err != nil {
+			if !errors.Is(err, ErrShortFrame) && !errors.Is(err, ErrInvalidFrame) &&
+				!errors.Is(err, ErrFrameTooLarge) && !errors.Is(err, ErrUnsupportedVersion) {
+				t.Fatalf("unexpected error type: %v", err)
+			}
+			return
+		}
+		if n > len(data) {
+			t.Fatalf("consumed %d of %d bytes", n, len(data))
+		}
+		again, err := codec.Encode(frame)
+		if err != nil {
+			return
+		}
+		decoded, _, err := codec.Decode(again)
+		if err != nil {
+			t.Fatalf("re-decode failed: %v", err)
+		}
+		if decoded.Opcode != frame.Opcode || !bytes.Equal(decoded.Body, frame.Body) {
+			t.Fatalf("round trip mismatch")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package encoding
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	packedTupleSize = 12
+	maxTimestamp    = 1<<48 - 1
+)
+
+// Tuple is the (timestamp, shard, sequence) triple used by compact message IDs and invitation codes.
+type Tuple struct {
+	Timestamp int64  // Unix milliseconds, must fit in 48 bits.
+	Shard     uint16 // Shard or node number.
+	Sequence  uint32 // Per-shard sequence.
+}
+
+// PackTupleBytes packs t into 12 big-endian bytes: 48-bit timestamp, 16-bit shard, 32-bit sequence.
+func PackTupleBytes(t Tuple) ([]byte, error) {
+	if t.Timestamp < 0 || t.Timestamp > maxTimestamp {
+		return nil, errs.New("timestamp out of range", "timestamp", t.Timestamp).Wrap()
+	}
+	buf := make([]byte, packedTupleSize)
+	ts := uint64(t.Timestamp)
+	buf[0] = byte(ts >> 40)
+	buf[1] = byte(ts >> 32)
+	binary.BigEndian.PutUint32(buf[2:6], uint32(ts))
+	binary.BigEndian.PutUint16(buf[6:8], t.Shard)
+	binary.BigEndian.PutUint32(buf[8:12], t.Sequence)
+	return buf, nil
+}
+
+// UnpackTupleBytes is the inverse of PackTupleBytes.
+func UnpackTupleBytes(data []byte) (Tuple, error) {
+	if len(data) != packedTupleSize {
+		return Tuple{}, errs.New("invalid packed tuple length", "length", len(data)).Wrap()
+	}
+	ts := uint64(data[0])<<40 | uint64(data[1])<<32 | uint64(binary.BigEndian.Uint32(data[2:6]))
+	return Tuple{
+		Timestamp: int64(ts),
+		Shard:     binary.BigEndian.Uint16(data[6:8]),
+		Sequence:  binary.BigEndian.Uint32(data[8:12]),
+	}, nil
+}
+
+// PackTuple packs t into a 16 character URL-safe string.
+func PackTuple(t Tuple) (string, error) {
+	data, err := PackTupleBytes(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// UnpackTuple decodes a string produced by PackTuple.
+func UnpackTuple(s string) (Tuple, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Tuple{}, errs.WrapMsg(err, "DecodeString failed", "data", s)
+	}
+	return UnpackTupleBytes(data)
+}
@@ -0,0 +1,81 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// WriteFileAtomic writes data to a temporary file in the same directory as filename, syncs it and renames it
+// over filename, so readers observe either the old or the new content and never a partial write.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	return WriteAtomic(filename, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteAtomic is like WriteFileAtomic but streams the content through fn.
+func WriteAtomic(filename string, perm os.FileMode, fn func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errs.WrapMsg(err, "MkdirAll failed", "dir", dir)
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return errs.WrapMsg(err, "CreateTemp failed", "dir", dir)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpName)
+		}
+	}()
+	if err = fn(tmp); err != nil {
+		return errs.WrapMsg(err, "write temp file failed", "file", tmpName)
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return errs.WrapMsg(err, "chmod temp file failed", "file", tmpName)
+	}
+	if err = tmp.Sync(); err != nil {
+		return errs.WrapMsg(err, "sync temp file failed", "file", tmpName)
+	}
+	if err = tmp.Close(); err != nil {
+		return errs.WrapMsg(err, "close temp file failed", "file", tmpName)
+	}
+	if err = os.Rename(tmpName, filename); err != nil {
+		return errs.WrapMsg(err, "rename temp file failed", "from", tmpName, "to", filename)
+	}
+	return SyncDir(dir)
+}
+
+// SyncDir fsyncs a directory so that a preceding create or rename in it is durable.
+// It is a no-op on platforms that do not support syncing directories.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errs.WrapMsg(err, "open dir failed", "dir", dir)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !isSyncUnsupported(err) {
+		return errs.WrapMsg(err, "sync dir failed", "dir", dir)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// ErrPathTraversal is returned by SafeJoin when the joined path would escape the base directory.
+var ErrPathTraversal = errs.New("path escapes base directory")
+
+// CopyFile copies src to dst and fsyncs dst before returning. dst is created with the mode of src.
+func CopyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errs.WrapMsg(err, "open source file failed", "src", src)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return errs.WrapMsg(err, "stat source file failed", "src", src)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errs.WrapMsg(err, "MkdirAll failed", "dst", dst)
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return errs.WrapMsg(err, "open destination file failed", "dst", dst)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return errs.WrapMsg(err, "copy file failed", "src", src, "dst", dst)
+	}
+	if err := out.Sync(); err != nil {
+		_ = out.Close()
+		return errs.WrapMsg(err, "sync destination file failed", "dst", dst)
+	}
+	if err := out.Close(); err != nil {
+		return errs.WrapMsg(err, "close destination file failed", "dst", dst)
+	}
+	return nil
+}
+
+// DirSize returns the total size in bytes of all regular files under dir.
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, errs.WrapMsg(err, "walk dir failed", "dir", dir)
+	}
+	return size, nil
+}
+
+// SafeJoin joins elem onto base and returns ErrPathTraversal if the result is not inside base.
+// Absolute elements are treated as relative to base.
+func SafeJoin(base string, elem ...string) (string, error) {
+	base = filepath.Clean(base)
+	joined := filepath.Join(append([]string{base}, elem...)...)
+	rel, err := filepath.Rel(base, joined)
+	if err != nil {
+		return "", errs.WrapMsg(err, "filepath.Rel failed", "base", base, "path", joined)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrPathTraversal.WrapMsg("unsafe path", "base", base, "elem", elem)
+	}
+	return joined, nil
+}
+
+// Exists reports whether the named file or directory exists.
+func Exists(name string) (bool, error) {
+	_, err := os.Stat(name)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, errs.WrapMsg(err, "stat failed", "name", name)
+}
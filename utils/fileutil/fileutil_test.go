@@ -0,0 +1,78 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "sub", "config.yml")
+	require.NoError(t, WriteFileAtomic(name, []byte("a: 1"), 0600))
+	require.NoError(t, WriteFileAtomic(name, []byte("a: 2"), 0600))
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, "a: 2", string(data))
+
+	entries, err := os.ReadDir(filepath.Dir(name))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temp files must not be left behind")
+}
+
+func TestCopyFileAndDirSize(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	require.NoError(t, os.WriteFile(src, []byte("hello"), 0644))
+	require.NoError(t, CopyFile(src, filepath.Join(dir, "b", "b.txt")))
+
+	size, err := DirSize(dir)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+}
+
+func TestSafeJoin(t *testing.T) {
+	base := "/data/s3"
+	p, err := SafeJoin(base, "bucket", "a/b.png")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(base, "bucket", "a", "b.png"), p)
+
+	_, err = SafeJoin(base, "../etc/passwd")
+	assert.ErrorIs(t, err, ErrPathTraversal)
+	_, err = SafeJoin(base, "a/../../s3x")
+	assert.ErrorIs(t, err, ErrPathTraversal)
+}
+
+func TestFileLock(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "run.lock")
+	l1 := NewFileLock(name)
+	require.NoError(t, l1.Lock())
+
+	l2 := NewFileLock(name)
+	ok, err := l2.TryLock()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, l1.Unlock())
+	ok, err = l2.TryLock()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, l2.Unlock())
+}
@@ -0,0 +1,90 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// FileLock is an advisory, process-wide exclusive lock backed by a lock file.
+type FileLock struct {
+	path string
+	f    *os.File
+}
+
+// NewFileLock returns a lock on path. The file is created on first Lock.
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Path returns the lock file path.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// Lock blocks until the lock is acquired.
+func (l *FileLock) Lock() error {
+	return l.lock(true)
+}
+
+// TryLock acquires the lock without blocking and reports whether it succeeded.
+func (l *FileLock) TryLock() (bool, error) {
+	if err := l.lock(false); err != nil {
+		if errs.Unwrap(err) == errLocked {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *FileLock) lock(block bool) error {
+	if l.f != nil {
+		return errs.New("file lock already held", "path", l.path).Wrap()
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return errs.WrapMsg(err, "MkdirAll failed", "path", l.path)
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return errs.WrapMsg(err, "open lock file failed", "path", l.path)
+	}
+	if err := lockFile(f, block); err != nil {
+		_ = f.Close()
+		if err == errLocked {
+			return errs.Wrap(err)
+		}
+		return errs.WrapMsg(err, "lock file failed", "path", l.path)
+	}
+	l.f = f
+	return nil
+}
+
+// Unlock releases the lock. The lock file itself is left in place.
+func (l *FileLock) Unlock() error {
+	if l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	if err := unlockFile(f); err != nil {
+		_ = f.Close()
+		return errs.WrapMsg(err, "unlock file failed", "path", l.path)
+	}
+	return errs.Wrap(f.Close())
+}
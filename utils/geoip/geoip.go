@@ -0,0 +1,183 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package geoip resolves IP addresses to locations using MaxMind DB (MMDB)
+// files such as GeoLite2-City. Databases are loaded on first use and reloaded
+// when the file changes on disk, so they can be updated without a restart.
+package geoip
+
+import (
+	"net"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Config configures a DB.
+type Config struct {
+	// CityPath is a City database, e.g. GeoLite2-City.mmdb or GeoIP2-City.mmdb.
+	CityPath string
+	// AnonymousPath is an optional GeoIP2-Anonymous-IP database filling Location.Anonymizer.
+	AnonymousPath string
+	// Language selects the localized names, defaults to "en". Names fall back
+	// to English when the language is missing or empty.
+	Language string
+	// CheckInterval is how often the files are checked for changes, defaults
+	// to one minute. A negative value disables reloading.
+	CheckInterval time.Duration
+}
+
+// Location is the result of a lookup. Fields the database does not know are empty.
+type Location struct {
+	Continent   string // Continent code, e.g. "AS".
+	Country     string // ISO 3166-1 country code, e.g. "CN".
+	CountryName string
+	Region      string // ISO 3166-2 subdivision code without the country, e.g. "GD".
+	RegionName  string
+	City        string
+	Latitude    float64
+	Longitude   float64
+	TimeZone    string
+	// Anonymizer is only set when an anonymous IP database is configured.
+	Anonymizer *Anonymizer
+}
+
+// Anonymizer reports whether an address belongs to a service hiding the real client.
+type Anonymizer struct {
+	IsAnonymous        bool `maxminddb:"is_anonymous"`
+	IsAnonymousVPN     bool `maxminddb:"is_anonymous_vpn"`
+	IsHostingProvider  bool `maxminddb:"is_hosting_provider"`
+	IsPublicProxy      bool `maxminddb:"is_public_proxy"`
+	IsResidentialProxy bool `maxminddb:"is_residential_proxy"`
+	IsTorExitNode      bool `maxminddb:"is_tor_exit_node"`
+}
+
+type names map[string]string
+
+type cityRecord struct {
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+		Names   names  `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+		Names   names  `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names names `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+}
+
+// DB looks up IP addresses. It is safe for concurrent use.
+type DB struct {
+	language  string
+	city      *source
+	anonymous *source
+}
+
+// New creates a DB. The files are not opened until the first lookup.
+func New(conf Config) (*DB, error) {
+	if conf.CityPath == "" {
+		return nil, errs.ErrArgs.WrapMsg("geoip city database path is required")
+	}
+	if conf.Language == "" {
+		conf.Language = "en"
+	}
+	if conf.CheckInterval == 0 {
+		conf.CheckInterval = time.Minute
+	}
+	db := &DB{language: conf.Language, city: newSource(conf.CityPath, conf.CheckInterval)}
+	if conf.AnonymousPath != "" {
+		db.anonymous = newSource(conf.AnonymousPath, conf.CheckInterval)
+	}
+	return db, nil
+}
+
+// Lookup resolves ip. It returns errs.ErrRecordNotFound when the address is
+// not in the database, which is the case for private addresses.
+func (db *DB) Lookup(ip string) (*Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, errs.ErrArgs.WrapMsg("invalid ip", "ip", ip)
+	}
+	return db.LookupIP(parsed)
+}
+
+// LookupIP resolves ip, see Lookup.
+func (db *DB) LookupIP(ip net.IP) (*Location, error) {
+	reader, err := db.city.get()
+	if err != nil {
+		return nil, err
+	}
+	var rec cityRecord
+	_, ok, err := reader.LookupNetwork(ip, &rec)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "geoip lookup failed", "ip", ip.String())
+	}
+	if !ok {
+		return nil, errs.ErrRecordNotFound.WrapMsg("ip not found in geoip database", "ip", ip.String())
+	}
+	loc := &Location{
+		Continent:   rec.Continent.Code,
+		Country:     rec.Country.ISOCode,
+		CountryName: db.name(rec.Country.Names),
+		City:        db.name(rec.City.Names),
+		Latitude:    rec.Location.Latitude,
+		Longitude:   rec.Location.Longitude,
+		TimeZone:    rec.Location.TimeZone,
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = rec.Subdivisions[0].ISOCode
+		loc.RegionName = db.name(rec.Subdivisions[0].Names)
+	}
+	if db.anonymous != nil {
+		if loc.Anonymizer, err = db.lookupAnonymous(ip); err != nil {
+			return nil, err
+		}
+	}
+	return loc, nil
+}
+
+func (db *DB) lookupAnonymous(ip net.IP) (*Anonymizer, error) {
+	reader, err := db.anonymous.get()
+	if err != nil {
+		return nil, err
+	}
+	var a Anonymizer
+	if err := reader.Lookup(ip, &a); err != nil {
+		return nil, errs.WrapMsg(err, "geoip anonymous lookup failed", "ip", ip.String())
+	}
+	return &a, nil
+}
+
+func (db *DB) name(n names) string {
+	if v := n[db.language]; v != "" {
+		return v
+	}
+	return n["en"]
+}
+
+// SameRegion reports whether two locations share country and region, which is
+// what login security notifications usually compare.
+func SameRegion(a, b *Location) bool {
+	return a != nil && b != nil && a.Country == b.Country && a.Region == b.Region
+}
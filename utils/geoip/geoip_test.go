@@ -0,0 +1,252 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdb writes minimal IPv4 MaxMind DB files for the tests.
+type mmdb struct {
+	nodes [][2]record
+	data  bytes.Buffer
+}
+
+type record struct {
+	node   int // Child node when > 0.
+	data   int // Data offset plus one when > 0.
+	isData bool
+}
+
+func (w *mmdb) insert(cidr string, value any) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	ones, _ := network.Mask.Size()
+	ip := network.IP.To4()
+	offset := w.data.Len()
+	encode(&w.data, value)
+	if len(w.nodes) == 0 {
+		w.nodes = append(w.nodes, [2]record{})
+	}
+	n := 0
+	for i := 0; i < ones; i++ {
+		bit := (ip[i/8] >> (7 - uint(i%8))) & 1
+		if i == ones-1 {
+			w.nodes[n][bit] = record{data: offset, isData: true}
+			return
+		}
+		if w.nodes[n][bit].node == 0 {
+			w.nodes = append(w.nodes, [2]record{})
+			w.nodes[n][bit] = record{node: len(w.nodes) - 1}
+		}
+		n = w.nodes[n][bit].node
+	}
+}
+
+func (w *mmdb) bytes(dbType string) []byte {
+	var out bytes.Buffer
+	count := len(w.nodes)
+	put := func(r record) {
+		v := count
+		switch {
+		case r.isData:
+			v = count + 16 + r.data
+		case r.node > 0:
+			v = r.node
+		}
+		out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+	}
+	for _, n := range w.nodes {
+		put(n[0])
+		put(n[1])
+	}
+	out.Write(make([]byte, 16))
+	out.Write(w.data.Bytes())
+	out.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encode(&out, map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               dbType,
+		"languages":                   []any{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"description":                 map[string]any{"en": "test"},
+	})
+	return out.Bytes()
+}
+
+func control(buf *bytes.Buffer, typ int, size int) {
+	var ext []byte
+	if size >= 29 {
+		ext = []byte{byte(size - 29)}
+		size = 29
+	}
+	if typ > 7 {
+		buf.Write([]byte{byte(size), byte(typ - 7)})
+	} else {
+		buf.WriteByte(byte(typ<<5 | size))
+	}
+	buf.Write(ext)
+}
+
+func encode(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case string:
+		control(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		control(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint16:
+		control(buf, 5, 2)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		control(buf, 6, 4)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case uint64:
+		control(buf, 9, 8)
+		_ = binary.Write(buf, binary.BigEndian, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		control(buf, 14, size)
+	case []any:
+		control(buf, 11, len(v))
+		for _, e := range v {
+			encode(buf, e)
+		}
+	case map[string]any:
+		control(buf, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encode(buf, k)
+			encode(buf, v[k])
+		}
+	default:
+		panic("unsupported type")
+	}
+}
+
+func cityData(country string, region string, city string, cityZh string) map[string]any {
+	return map[string]any{
+		"continent": map[string]any{"code": "AS"},
+		"country":   map[string]any{"iso_code": country, "names": map[string]any{"en": country + " name"}},
+		"subdivisions": []any{
+			map[string]any{"iso_code": region, "names": map[string]any{"en": region + " name"}},
+		},
+		"city":     map[string]any{"names": map[string]any{"en": city, "zh-CN": cityZh}},
+		"location": map[string]any{"latitude": 22.5, "longitude": 114.1, "time_zone": "Asia/Shanghai"},
+	}
+}
+
+func writeDB(t *testing.T, path string, dbType string, networks map[string]any) {
+	w := &mmdb{}
+	for cidr, v := range networks {
+		w.insert(cidr, v)
+	}
+	require.NoError(t, os.WriteFile(path, w.bytes(dbType), 0o644))
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	anonPath := filepath.Join(dir, "anon.mmdb")
+	writeDB(t, cityPath, "GeoLite2-City", map[string]any{
+		"1.2.3.0/24": cityData("CN", "GD", "Shenzhen", "深圳"),
+		"8.8.0.0/16": cityData("US", "CA", "Mountain View", ""),
+	})
+	writeDB(t, anonPath, "GeoIP2-Anonymous-IP", map[string]any{
+		"8.8.8.0/24": map[string]any{"is_anonymous": true, "is_hosting_provider": true},
+	})
+
+	db, err := New(Config{CityPath: cityPath, AnonymousPath: anonPath, Language: "zh-CN"})
+	require.NoError(t, err)
+	loc, err := db.Lookup("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "CN", loc.Country)
+	assert.Equal(t, "GD", loc.Region)
+	assert.Equal(t, "GD name", loc.RegionName)
+	assert.Equal(t, "深圳", loc.City)
+	assert.Equal(t, "Asia/Shanghai", loc.TimeZone)
+	assert.False(t, loc.Anonymizer.IsAnonymous)
+
+	loc2, err := db.Lookup("8.8.8.8")
+	require.NoError(t, err)
+	assert.Equal(t, "Mountain View", loc2.City)
+	assert.True(t, loc2.Anonymizer.IsAnonymous)
+	assert.True(t, loc2.Anonymizer.IsHostingProvider)
+	assert.False(t, SameRegion(loc, loc2))
+
+	_, err = db.Lookup("10.0.0.1")
+	assert.True(t, errs.ErrRecordNotFound.Is(err))
+	_, err = db.Lookup("not an ip")
+	assert.True(t, errs.ErrArgs.Is(err))
+}
+
+func TestLazyLoadAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	db, err := New(Config{CityPath: path, CheckInterval: time.Millisecond})
+	require.NoError(t, err)
+	// Nothing is opened until the first lookup.
+	_, err = db.Lookup("1.2.3.4")
+	assert.Error(t, err)
+
+	writeDB(t, path, "GeoLite2-City", map[string]any{"1.2.3.0/24": cityData("CN", "GD", "Shenzhen", "")})
+	loc, err := db.Lookup("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "Shenzhen", loc.City)
+
+	writeDB(t, path, "GeoLite2-City", map[string]any{"1.2.3.0/24": cityData("CN", "BJ", "Beijing", "")})
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	time.Sleep(5 * time.Millisecond)
+	loc, err = db.Lookup("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "Beijing", loc.City)
+
+	// A broken file keeps the loaded database.
+	require.NoError(t, os.WriteFile(path, []byte("broken"), 0o644))
+	time.Sleep(5 * time.Millisecond)
+	loc, err = db.Lookup("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "Beijing", loc.City)
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	assert.Equal(t, "1.2.3.0", AnonymizeIP("1.2.3.4"))
+	assert.Equal(t, "2001:db8:1::", AnonymizeIP("2001:db8:1:2::5"))
+	assert.Equal(t, "bad", AnonymizeIP("bad"))
+}
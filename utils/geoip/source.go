@@ -0,0 +1,110 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package geoip
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// source holds one database file. The file is read into memory rather than
+// mapped so a replaced reader can be dropped while lookups still use it.
+type source struct {
+	path     string
+	interval time.Duration
+
+	mu        sync.Mutex
+	reader    atomic.Pointer[maxminddb.Reader]
+	nextCheck atomic.Int64
+	modTime   time.Time
+	size      int64
+}
+
+func newSource(path string, interval time.Duration) *source {
+	return &source{path: path, interval: interval}
+}
+
+func (s *source) get() (*maxminddb.Reader, error) {
+	r := s.reader.Load()
+	if r == nil {
+		return s.load()
+	}
+	if s.interval > 0 && time.Now().UnixNano() >= s.nextCheck.Load() {
+		s.reload()
+		r = s.reader.Load()
+	}
+	return r, nil
+}
+
+func (s *source) load() (*maxminddb.Reader, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r := s.reader.Load(); r != nil {
+		return r, nil
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s.reader.Load(), nil
+}
+
+// reload swaps in the file when its modification time or size changed. A
+// broken file keeps the previous database in use.
+func (s *source) reload() {
+	if !s.mu.TryLock() {
+		return
+	}
+	defer s.mu.Unlock()
+	s.nextCheck.Store(time.Now().Add(s.interval).UnixNano())
+	info, err := os.Stat(s.path)
+	if err != nil {
+		log.ZWarn(context.Background(), "geoip stat database failed", err, "path", s.path)
+		return
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return
+	}
+	if err := s.open(); err != nil {
+		log.ZWarn(context.Background(), "geoip reload database failed", err, "path", s.path)
+		return
+	}
+	log.ZInfo(context.Background(), "geoip database reloaded", "path", s.path)
+}
+
+func (s *source) open() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return errs.WrapMsg(err, "geoip stat database failed", "path", s.path)
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return errs.WrapMsg(err, "geoip read database failed", "path", s.path)
+	}
+	r, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return errs.WrapMsg(err, "geoip open database failed", "path", s.path)
+	}
+	s.reader.Store(r)
+	s.modTime, s.size = info.ModTime(), info.Size()
+	s.nextCheck.Store(time.Now().Add(s.interval).UnixNano())
+	return nil
+}
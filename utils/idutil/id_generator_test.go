@@ -3,8 +3,11 @@ package idutil
 import (
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // TestGetMsgIDByMD5 checks if GetMsgIDByMD5 returns a valid MD5 hash string.
@@ -24,3 +27,44 @@ func TestOperationIDGenerator(t *testing.T) {
 	// Just check if it is numeric and has a reasonable length.
 	assert.Regexp(t, regexp.MustCompile("^[0-9]{13,}$"), opID, "The returned operation ID should be numeric and long")
 }
+
+func TestUUIDv7(t *testing.T) {
+	before := time.Now().Truncate(time.Millisecond)
+	prev := UUIDv7()
+	for i := 0; i < 1000; i++ {
+		next := UUIDv7()
+		assert.Less(t, prev, next, "UUIDv7 must be time ordered")
+		prev = next
+	}
+	u, ts, err := ParseUUIDv7(prev)
+	assert.NoError(t, err)
+	assert.Equal(t, prev, u.String())
+	assert.False(t, ts.Before(before))
+	assert.WithinDuration(t, time.Now(), ts, time.Second)
+	assert.LessOrEqual(t, MinUUIDv7(ts).String(), prev)
+	assert.Greater(t, MinUUIDv7(ts).String(), MinUUIDv7(ts.Add(-time.Millisecond)).String())
+
+	_, _, err = ParseUUIDv7(uuid.NewString())
+	assert.Error(t, err)
+	_, _, err = ParseUUIDv7("not-a-uuid")
+	assert.Error(t, err)
+}
+
+func TestUUIDv7ObjectID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	u := UUIDv7FromObjectID(oid)
+	assert.Equal(t, uuid.Version(7), u.Version())
+	assert.Equal(t, uuid.RFC4122, u.Variant())
+	assert.True(t, oid.Timestamp().Equal(UUIDv7Time(u)))
+	assert.Equal(t, u, UUIDv7FromObjectID(oid))
+
+	back, err := ObjectIDFromUUIDv7(u)
+	assert.NoError(t, err)
+	assert.Equal(t, oid, back)
+
+	later := primitive.NewObjectIDFromTimestamp(oid.Timestamp().Add(time.Second))
+	assert.Less(t, u.String(), UUIDv7FromObjectID(later).String())
+
+	_, err = ObjectIDFromUUIDv7(uuid.New())
+	assert.Error(t, err)
+}
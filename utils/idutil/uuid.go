@@ -0,0 +1,106 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idutil
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UUIDv7 returns a new time-ordered UUID (RFC 9562 version 7) as a string.
+// Unlike random v4 UUIDs, consecutive values sort by creation time, so they
+// keep Mongo index inserts at the right edge of the B-tree.
+func UUIDv7() string {
+	return NewUUIDv7().String()
+}
+
+// NewUUIDv7 returns a new version 7 UUID. IDs generated by one process within
+// the same millisecond are still strictly increasing.
+func NewUUIDv7() uuid.UUID {
+	return uuid.Must(uuid.NewV7())
+}
+
+// ParseUUIDv7 parses s and returns the UUID with the time it was created at.
+// It fails if s is not a version 7 UUID.
+func ParseUUIDv7(s string) (uuid.UUID, time.Time, error) {
+	u, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, time.Time{}, errs.ErrArgs.WrapMsg("invalid uuid", "uuid", s)
+	}
+	if u.Version() != 7 {
+		return uuid.Nil, time.Time{}, errs.ErrArgs.WrapMsg("uuid is not version 7", "uuid", s, "version", int(u.Version()))
+	}
+	return u, UUIDv7Time(u), nil
+}
+
+// UUIDv7Time returns the millisecond timestamp embedded in a version 7 UUID.
+func UUIDv7Time(u uuid.UUID) time.Time {
+	ms := int64(u[0])<<40 | int64(u[1])<<32 | int64(u[2])<<24 | int64(u[3])<<16 | int64(u[4])<<8 | int64(u[5])
+	return time.UnixMilli(ms)
+}
+
+// MinUUIDv7 returns the smallest version 7 UUID of the millisecond of t. It is
+// a lower bound for range queries over UUIDv7 keys, e.g. {$gte: MinUUIDv7(t)}.
+func MinUUIDv7(t time.Time) uuid.UUID {
+	var u uuid.UUID
+	putUUIDv7Time(&u, t.UnixMilli())
+	u[6] = 0x70
+	u[8] = 0x80
+	return u
+}
+
+// UUIDv7FromObjectID converts a BSON ObjectID to a version 7 UUID with the
+// same timestamp, so records keyed by either sort the same way. The ObjectID
+// has second precision, the remaining bytes are carried over and the result is
+// deterministic; ObjectIDFromUUIDv7 converts it back.
+func UUIDv7FromObjectID(oid primitive.ObjectID) uuid.UUID {
+	var u uuid.UUID
+	putUUIDv7Time(&u, oid.Timestamp().UnixMilli())
+	u[6] = 0x70
+	u[7] = oid[4]
+	u[8] = 0x80
+	copy(u[9:], oid[5:])
+	return u
+}
+
+// ObjectIDFromUUIDv7 converts a version 7 UUID to a BSON ObjectID. The
+// timestamp is truncated to seconds. UUIDs created by UUIDv7FromObjectID map
+// back to the original ObjectID.
+func ObjectIDFromUUIDv7(u uuid.UUID) (primitive.ObjectID, error) {
+	var oid primitive.ObjectID
+	if u.Version() != 7 {
+		return oid, errs.ErrArgs.WrapMsg("uuid is not version 7", "uuid", u.String(), "version", int(u.Version()))
+	}
+	sec := UUIDv7Time(u).Unix()
+	oid[0] = byte(sec >> 24)
+	oid[1] = byte(sec >> 16)
+	oid[2] = byte(sec >> 8)
+	oid[3] = byte(sec)
+	oid[4] = u[7]
+	copy(oid[5:], u[9:])
+	return oid, nil
+}
+
+func putUUIDv7Time(u *uuid.UUID, ms int64) {
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+}
@@ -0,0 +1,334 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imageutil reads image metadata from file headers without decoding pixel data.
+package imageutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatGIF  = "gif"
+	FormatWebP = "webp"
+)
+
+// Orientation is the EXIF orientation tag value (1-8). 1 means the image is stored upright.
+type Orientation int
+
+const (
+	OrientationNormal Orientation = 1
+)
+
+// Swapped reports whether the orientation rotates the image by 90 degrees, i.e. whether the displayed
+// width and height are swapped relative to the stored ones.
+func (o Orientation) Swapped() bool {
+	return o >= 5 && o <= 8
+}
+
+type Info struct {
+	Format      string      `json:"format"`
+	Width       int         `json:"width"`
+	Height      int         `json:"height"`
+	Orientation Orientation `json:"orientation"`
+	// Animated is set for GIFs with more than one frame and for animated WebP.
+	Animated bool `json:"animated,omitempty"`
+}
+
+// DisplaySize returns the width and height after applying the orientation.
+func (i *Info) DisplaySize() (int, int) {
+	if i.Orientation.Swapped() {
+		return i.Height, i.Width
+	}
+	return i.Width, i.Height
+}
+
+var ErrUnsupportedFormat = errs.New("unsupported image format")
+
+// maxHeaderScan bounds how far into a JPEG Probe will look for the frame header.
+const maxHeaderScan = 1 << 20
+
+// Probe reads just enough of r to determine the format, dimensions and orientation of a JPEG, PNG, GIF or WebP image.
+// For JPEG, bytes are consumed up to the SOF marker, which normally sits in the first few kilobytes.
+func Probe(r io.Reader) (*Info, error) {
+	br := bufio.NewReaderSize(r, 64)
+	head, err := br.Peek(12)
+	if err != nil && len(head) < 4 {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "image header too short")
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte{0xff, 0xd8}):
+		return probeJPEG(br)
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return probePNG(br)
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return probeGIF(br)
+	case len(head) >= 12 && bytes.Equal(head[:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WEBP")):
+		return probeWebP(br)
+	}
+	return nil, errs.Wrap(ErrUnsupportedFormat)
+}
+
+// ProbeBytes is Probe over an in-memory header.
+func ProbeBytes(data []byte) (*Info, error) {
+	return Probe(bytes.NewReader(data))
+}
+
+func readFull(r io.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errs.WrapMsg(err, "read image header failed")
+	}
+	return buf, nil
+}
+
+func probePNG(r *bufio.Reader) (*Info, error) {
+	// signature(8) + IHDR length(4) + "IHDR"(4) + width(4) + height(4)
+	buf, err := readFull(r, 24)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(buf[12:16], []byte("IHDR")) {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "png missing IHDR")
+	}
+	return &Info{
+		Format:      FormatPNG,
+		Width:       int(binary.BigEndian.Uint32(buf[16:20])),
+		Height:      int(binary.BigEndian.Uint32(buf[20:24])),
+		Orientation: OrientationNormal,
+	}, nil
+}
+
+func probeGIF(r *bufio.Reader) (*Info, error) {
+	buf, err := readFull(r, 13)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Format:      FormatGIF,
+		Width:       int(binary.LittleEndian.Uint16(buf[6:8])),
+		Height:      int(binary.LittleEndian.Uint16(buf[8:10])),
+		Orientation: OrientationNormal,
+	}
+	// Count image descriptors cheaply; stop as soon as a second frame is seen.
+	if buf[10]&0x80 != 0 {
+		if _, err := r.Discard(3 << (int(buf[10]&0x07) + 1)); err != nil {
+			return info, nil
+		}
+	}
+	frames := 0
+	for frames < 2 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return info, nil
+		}
+		switch b {
+		case 0x21: // extension
+			if _, err := r.ReadByte(); err != nil {
+				return info, nil
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return info, nil
+			}
+		case 0x2c: // image descriptor
+			frames++
+			desc, err := readFull(r, 9)
+			if err != nil {
+				return info, nil
+			}
+			if desc[8]&0x80 != 0 {
+				if _, err := r.Discard(3 << (int(desc[8]&0x07) + 1)); err != nil {
+					return info, nil
+				}
+			}
+			if _, err := r.ReadByte(); err != nil { // LZW minimum code size
+				return info, nil
+			}
+			if err := skipGIFSubBlocks(r); err != nil {
+				return info, nil
+			}
+		default:
+			info.Animated = frames > 1
+			return info, nil
+		}
+	}
+	info.Animated = true
+	return info, nil
+}
+
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return err
+		}
+	}
+}
+
+func probeWebP(r *bufio.Reader) (*Info, error) {
+	buf, err := readFull(r, 30)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Format: FormatWebP, Orientation: OrientationNormal}
+	chunk := buf[12:16]
+	data := buf[20:]
+	switch string(chunk) {
+	case "VP8 ":
+		// frame tag(3) + start code(3) + 14-bit width/height
+		if !bytes.Equal(data[3:6], []byte{0x9d, 0x01, 0x2a}) {
+			return nil, errs.WrapMsg(ErrUnsupportedFormat, "invalid vp8 start code")
+		}
+		info.Width = int(binary.LittleEndian.Uint16(data[6:8]) & 0x3fff)
+		info.Height = int(binary.LittleEndian.Uint16(data[8:10]) & 0x3fff)
+	case "VP8L":
+		if data[0] != 0x2f {
+			return nil, errs.WrapMsg(ErrUnsupportedFormat, "invalid vp8l signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[1:5])
+		info.Width = int(bits&0x3fff) + 1
+		info.Height = int(bits>>14&0x3fff) + 1
+	case "VP8X":
+		flags := data[0]
+		info.Animated = flags&0x02 != 0
+		info.Width = int(uint32(data[4])|uint32(data[5])<<8|uint32(data[6])<<16) + 1
+		info.Height = int(uint32(data[7])|uint32(data[8])<<8|uint32(data[9])<<16) + 1
+	default:
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "unknown webp chunk", "chunk", string(chunk))
+	}
+	return info, nil
+}
+
+func probeJPEG(r *bufio.Reader) (*Info, error) {
+	if _, err := r.Discard(2); err != nil {
+		return nil, errs.WrapMsg(err, "read jpeg header failed")
+	}
+	info := &Info{Format: FormatJPEG, Orientation: OrientationNormal}
+	scanned := 2
+	for scanned < maxHeaderScan {
+		// Markers may be preceded by any number of 0xff fill bytes.
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errs.WrapMsg(err, "read jpeg marker failed")
+		}
+		scanned++
+		if b != 0xff {
+			continue
+		}
+		marker, err := r.ReadByte()
+		if err != nil {
+			return nil, errs.WrapMsg(err, "read jpeg marker failed")
+		}
+		scanned++
+		if marker == 0xff || marker == 0x00 || (marker >= 0xd0 && marker <= 0xd7) || marker == 0x01 {
+			if marker == 0xff {
+				_ = r.UnreadByte()
+				scanned--
+			}
+			continue
+		}
+		if marker == 0xd9 || marker == 0xda {
+			break
+		}
+		lenBuf, err := readFull(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		length := int(binary.BigEndian.Uint16(lenBuf)) - 2
+		if length < 0 {
+			return nil, errs.WrapMsg(ErrUnsupportedFormat, "invalid jpeg segment length")
+		}
+		scanned += 2 + length
+		switch {
+		case isSOF(marker):
+			seg, err := readFull(r, length)
+			if err != nil {
+				return nil, err
+			}
+			if len(seg) < 5 {
+				return nil, errs.WrapMsg(ErrUnsupportedFormat, "short jpeg SOF segment")
+			}
+			info.Height = int(binary.BigEndian.Uint16(seg[1:3]))
+			info.Width = int(binary.BigEndian.Uint16(seg[3:5]))
+			return info, nil
+		case marker == 0xe1:
+			seg, err := readFull(r, length)
+			if err != nil {
+				return nil, err
+			}
+			if o := exifOrientation(seg); o != 0 {
+				info.Orientation = o
+			}
+		default:
+			if _, err := r.Discard(length); err != nil {
+				return nil, errs.WrapMsg(err, "skip jpeg segment failed")
+			}
+		}
+	}
+	return nil, errs.WrapMsg(ErrUnsupportedFormat, "jpeg frame header not found")
+}
+
+func isSOF(marker byte) bool {
+	// SOF0-SOF15 except DHT (c4), JPG (c8) and DAC (cc).
+	return marker >= 0xc0 && marker <= 0xcf && marker != 0xc4 && marker != 0xc8 && marker != 0xcc
+}
+
+// exifOrientation extracts the orientation tag from an APP1 Exif segment, or returns 0.
+func exifOrientation(seg []byte) Orientation {
+	if len(seg) < 14 || !bytes.Equal(seg[:6], []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := seg[6:]
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		off := ifd + 2 + i*12
+		if off+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[off:off+2]) == 0x0112 {
+			o := Orientation(order.Uint16(tiff[off+8 : off+10]))
+			if o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
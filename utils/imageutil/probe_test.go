@@ -0,0 +1,104 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imageutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testImage(w, h int) image.Image {
+	img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.Black, color.White})
+	return img
+}
+
+func TestProbePNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(37, 21)))
+	info, err := Probe(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{Format: FormatPNG, Width: 37, Height: 21, Orientation: OrientationNormal}, info)
+}
+
+func TestProbeGIF(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, gif.Encode(&buf, testImage(10, 12), nil))
+	info, err := ProbeBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 10, info.Width)
+	assert.Equal(t, 12, info.Height)
+	assert.False(t, info.Animated)
+
+	buf.Reset()
+	frame := testImage(10, 12).(*image.Paletted)
+	require.NoError(t, gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{1, 1}}))
+	info, err = ProbeBytes(buf.Bytes())
+	require.NoError(t, err)
+	assert.True(t, info.Animated)
+}
+
+func TestProbeJPEGWithOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 64, 32)), nil))
+	data := buf.Bytes()
+
+	// Build an APP1 Exif segment holding orientation 6 (rotate 90 CW) and insert it after SOI.
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	ifd := make([]byte, 2+12+4)
+	binary.LittleEndian.PutUint16(ifd[0:], 1)
+	binary.LittleEndian.PutUint16(ifd[2:], 0x0112)
+	binary.LittleEndian.PutUint16(ifd[4:], 3)
+	binary.LittleEndian.PutUint32(ifd[6:], 1)
+	binary.LittleEndian.PutUint16(ifd[10:], 6)
+	payload := append(append([]byte("Exif\x00\x00"), tiff...), ifd...)
+	app1 := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+	withExif := append(append(append([]byte{}, data[:2]...), app1...), data[2:]...)
+
+	info, err := ProbeBytes(withExif)
+	require.NoError(t, err)
+	assert.Equal(t, FormatJPEG, info.Format)
+	assert.Equal(t, 64, info.Width)
+	assert.Equal(t, 32, info.Height)
+	assert.Equal(t, Orientation(6), info.Orientation)
+	w, h := info.DisplaySize()
+	assert.Equal(t, []int{32, 64}, []int{w, h})
+}
+
+func TestProbeWebP(t *testing.T) {
+	// Minimal VP8X header: canvas 300x200, animation flag set.
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00")
+	data = append(data, 0x02, 0, 0, 0)
+	data = append(data, 0x2b, 0x01, 0x00) // 299
+	data = append(data, 0xc7, 0x00, 0x00) // 199
+	info, err := ProbeBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{Format: FormatWebP, Width: 300, Height: 200, Orientation: OrientationNormal, Animated: true}, info)
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	_, err := ProbeBytes([]byte("not an image at all"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
@@ -0,0 +1,171 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Names of the built-in codecs.
+const (
+	CodecStd    = "std"
+	CodecGoJSON = "go-json"
+	CodecSonic  = "sonic"
+)
+
+// Encoder writes JSON values to an output stream.
+type Encoder interface {
+	Encode(v any) error
+	SetIndent(prefix, indent string)
+	SetEscapeHTML(on bool)
+}
+
+// Decoder reads JSON values from an input stream.
+type Decoder interface {
+	Decode(v any) error
+	UseNumber()
+	DisallowUnknownFields()
+}
+
+// Codec is a JSON engine. Implementations must behave like encoding/json for
+// the subset of features used by OpenIM (struct tags, json.Marshaler, json.RawMessage).
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	MarshalIndent(v any, prefix, indent string) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+var (
+	codecMu sync.RWMutex
+	codecs  = map[string]Codec{CodecStd: stdCodec{}}
+	current atomic.Pointer[Codec]
+)
+
+// Register makes a codec selectable by name, replacing any codec already
+// registered under the same name.
+func Register(c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+func registerCodec(c Codec) struct{} {
+	Register(c)
+	return struct{}{}
+}
+
+// Codecs returns the names of all registered codecs in sorted order.
+func Codecs() []string {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the codec registered under name.
+func Lookup(name string) (Codec, bool) {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// Use switches the package-wide codec to the one registered under name.
+// An empty name selects the codec chosen at build time.
+func Use(name string) error {
+	if name == "" {
+		name = buildCodec
+	}
+	c, ok := Lookup(name)
+	if !ok {
+		return errs.ErrArgs.WrapMsg("unknown json codec", "name", name, "available", Codecs())
+	}
+	SetCodec(c)
+	return nil
+}
+
+// SetCodec switches the package-wide codec.
+func SetCodec(c Codec) {
+	current.Store(&c)
+}
+
+// Default returns the codec used by the package-level functions. Unless
+// changed with Use or SetCodec it is selected by build tag: "sonic" picks
+// sonic, "gojson" picks go-json and otherwise encoding/json is used.
+func Default() Codec {
+	if c := current.Load(); c != nil {
+		return *c
+	}
+	if c, ok := Lookup(buildCodec); ok {
+		return c
+	}
+	return stdCodec{}
+}
+
+// Marshal encodes v with the current codec.
+func Marshal(v any) ([]byte, error) {
+	b, err := Default().Marshal(v)
+	return b, errs.Wrap(err)
+}
+
+// MarshalIndent encodes v with the current codec, indenting the output.
+func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	b, err := Default().MarshalIndent(v, prefix, indent)
+	return b, errs.Wrap(err)
+}
+
+// Unmarshal decodes data into v with the current codec.
+func Unmarshal(data []byte, v any) error {
+	return errs.Wrap(Default().Unmarshal(data, v))
+}
+
+// NewEncoder returns a stream encoder backed by the current codec.
+func NewEncoder(w io.Writer) Encoder {
+	return Default().NewEncoder(w)
+}
+
+// NewDecoder returns a stream decoder backed by the current codec.
+func NewDecoder(r io.Reader) Decoder {
+	return Default().NewDecoder(r)
+}
+
+type stdCodec struct{}
+
+func (stdCodec) Name() string { return CodecStd }
+
+func (stdCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (stdCodec) MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+func (stdCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+func (stdCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+
+func (stdCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
@@ -0,0 +1,41 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"io"
+
+	gojson "github.com/goccy/go-json"
+)
+
+var _ = registerCodec(goJSONCodec{})
+
+// goJSONCodec is backed by github.com/goccy/go-json, a drop-in replacement
+// for encoding/json that is considerably faster on large structs.
+type goJSONCodec struct{}
+
+func (goJSONCodec) Name() string { return CodecGoJSON }
+
+func (goJSONCodec) Marshal(v any) ([]byte, error) { return gojson.Marshal(v) }
+
+func (goJSONCodec) MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	return gojson.MarshalIndent(v, prefix, indent)
+}
+
+func (goJSONCodec) Unmarshal(data []byte, v any) error { return gojson.Unmarshal(data, v) }
+
+func (goJSONCodec) NewEncoder(w io.Writer) Encoder { return gojson.NewEncoder(w) }
+
+func (goJSONCodec) NewDecoder(r io.Reader) Decoder { return gojson.NewDecoder(r) }
@@ -0,0 +1,48 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build sonic
+
+package jsonutil
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+const buildCodec = CodecSonic
+
+var _ = registerCodec(sonicCodec{api: sonic.ConfigStd})
+
+// sonicCodec is backed by github.com/bytedance/sonic. It relies on a JIT and
+// only builds on the Go versions and architectures sonic supports, which is
+// why it has to be enabled explicitly with the "sonic" build tag.
+type sonicCodec struct {
+	api sonic.API
+}
+
+func (sonicCodec) Name() string { return CodecSonic }
+
+func (c sonicCodec) Marshal(v any) ([]byte, error) { return c.api.Marshal(v) }
+
+func (c sonicCodec) MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	return c.api.MarshalIndent(v, prefix, indent)
+}
+
+func (c sonicCodec) Unmarshal(data []byte, v any) error { return c.api.Unmarshal(data, v) }
+
+func (c sonicCodec) NewEncoder(w io.Writer) Encoder { return c.api.NewEncoder(w) }
+
+func (c sonicCodec) NewDecoder(r io.Reader) Decoder { return c.api.NewDecoder(r) }
@@ -0,0 +1,125 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecSample struct {
+	Name  string            `json:"name"`
+	Age   int               `json:"age,omitempty"`
+	Tags  []string          `json:"tags"`
+	Extra json.RawMessage   `json:"extra"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	in := codecSample{
+		Name:  "alice",
+		Tags:  []string{"a", "b"},
+		Extra: json.RawMessage(`{"k":1}`),
+		Attrs: map[string]string{"x": "y"},
+	}
+	for _, name := range Codecs() {
+		t.Run(name, func(t *testing.T) {
+			c, ok := Lookup(name)
+			require.True(t, ok)
+			b, err := c.Marshal(in)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"name":"alice","tags":["a","b"],"extra":{"k":1},"attrs":{"x":"y"}}`, string(b))
+
+			var out codecSample
+			require.NoError(t, c.Unmarshal(b, &out))
+			assert.Equal(t, in, out)
+
+			var buf bytes.Buffer
+			enc := c.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			require.NoError(t, enc.Encode(in))
+			out = codecSample{}
+			dec := c.NewDecoder(&buf)
+			dec.DisallowUnknownFields()
+			require.NoError(t, dec.Decode(&out))
+			assert.Equal(t, in, out)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	defer SetCodec(Default())
+	assert.Contains(t, Codecs(), CodecStd)
+	assert.Contains(t, Codecs(), CodecGoJSON)
+
+	require.NoError(t, Use(CodecGoJSON))
+	assert.Equal(t, CodecGoJSON, Default().Name())
+	b, err := JsonMarshal(map[string]int{"a": 1})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(b))
+
+	err = Use("unknown")
+	assert.True(t, errs.ErrArgs.Is(err))
+	assert.Equal(t, CodecGoJSON, Default().Name())
+
+	require.NoError(t, Use(""))
+	assert.Equal(t, buildCodec, Default().Name())
+}
+
+func FuzzCodecs(f *testing.F) {
+	f.Add([]byte(`{"name":"alice","tags":["a"],"extra":{"k":[1,2.5,null]},"attrs":{"x":"y"}}`))
+	f.Add([]byte(`{"name":"\u00e9\ud83d\ude00","age":-1,"extra":"s"}`))
+	f.Add([]byte(`[1,{"a":true}]`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Codecs differ on invalid input, e.g. go-json keeps malformed
+		// json.RawMessage values, so only valid documents must round trip.
+		valid := json.Valid(data)
+		for _, name := range Codecs() {
+			c, _ := Lookup(name)
+			var v any
+			_ = c.Unmarshal(data, &v)
+			if !valid {
+				continue
+			}
+			var first codecSample
+			if err := c.Unmarshal(data, &first); err != nil {
+				continue
+			}
+			// Values a codec decoded must survive its own round trip.
+			b, err := c.Marshal(first)
+			if err != nil {
+				t.Fatalf("%s: marshal of decoded value failed: %v", name, err)
+			}
+			var second codecSample
+			if err := c.Unmarshal(b, &second); err != nil {
+				t.Fatalf("%s: decode of %q failed: %v", name, b, err)
+			}
+			again, err := c.Marshal(second)
+			if err != nil {
+				t.Fatalf("%s: marshal failed: %v", name, err)
+			}
+			var x, y any
+			if json.Unmarshal(b, &x) != nil || json.Unmarshal(again, &y) != nil || !reflect.DeepEqual(x, y) {
+				t.Fatalf("%s: round trip unstable: %q != %q", name, b, again)
+			}
+		}
+	})
+}
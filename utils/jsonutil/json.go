@@ -15,27 +15,25 @@
 package jsonutil
 
 import (
-	"encoding/json"
-	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/stringutil"
 )
 
 func JsonMarshal(v any) ([]byte, error) {
-	m, err := json.Marshal(v)
-	return m, errs.Wrap(err)
+	return Marshal(v)
 }
 
 func JsonUnmarshal(b []byte, v any) error {
-	return errs.Wrap(json.Unmarshal(b, v))
+	return Unmarshal(b, v)
 }
 
 func StructToJsonString(param any) string {
 	dataType, _ := JsonMarshal(param)
-	dataString := string(dataType)
-	return dataString
+	// dataType is owned by this function and never modified, so it can back the string directly.
+	return stringutil.BytesToString(dataType)
 }
 
 // The incoming parameter must be a pointer
 func JsonStringToStruct(s string, args any) error {
-	err := json.Unmarshal([]byte(s), args)
+	err := Default().Unmarshal(stringutil.StringToBytes(s), args)
 	return err
 }
@@ -0,0 +1,183 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/openimsdk/tools/errs"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ProtoOptions controls how protobuf messages are transcoded to and from JSON.
+// Services should agree on one set, configured once with SetProtoOptions.
+type ProtoOptions struct {
+	// EmitDefaults writes proto3 scalars with zero values, empty lists and empty maps.
+	EmitDefaults bool
+	// EnumsAsInts writes enums as numbers instead of their names.
+	EnumsAsInts bool
+	// Int64AsString writes 64-bit integers as JSON strings as required by the
+	// proto3 JSON mapping. When false they are written as JSON numbers, which
+	// loses precision in JavaScript clients beyond 2^53.
+	Int64AsString bool
+	// UseProtoNames uses the field names from the .proto file instead of lowerCamelCase.
+	UseProtoNames bool
+	// DiscardUnknown ignores unknown fields when unmarshaling instead of failing.
+	DiscardUnknown bool
+}
+
+// DefaultProtoOptions are the options used until SetProtoOptions is called.
+var DefaultProtoOptions = ProtoOptions{
+	EmitDefaults:   true,
+	EnumsAsInts:    true,
+	Int64AsString:  true,
+	DiscardUnknown: true,
+}
+
+var protoOptions atomic.Pointer[ProtoOptions]
+
+// SetProtoOptions sets the options used by ProtoMarshal and ProtoUnmarshal.
+func SetProtoOptions(opts ProtoOptions) {
+	protoOptions.Store(&opts)
+}
+
+// GetProtoOptions returns the options used by ProtoMarshal and ProtoUnmarshal.
+func GetProtoOptions() ProtoOptions {
+	if opts := protoOptions.Load(); opts != nil {
+		return *opts
+	}
+	return DefaultProtoOptions
+}
+
+// ProtoMarshal encodes m as JSON using the central ProtoOptions.
+func ProtoMarshal(m proto.Message) ([]byte, error) {
+	return ProtoMarshalWith(m, GetProtoOptions())
+}
+
+// ProtoUnmarshal decodes JSON into m using the central ProtoOptions.
+// Both string and number forms of 64-bit integers and enums are accepted.
+func ProtoUnmarshal(b []byte, m proto.Message) error {
+	return ProtoUnmarshalWith(b, m, GetProtoOptions())
+}
+
+// ProtoMarshalWith encodes m as JSON using opts.
+func ProtoMarshalWith(m proto.Message, opts ProtoOptions) ([]byte, error) {
+	data, err := protojson.MarshalOptions{
+		EmitUnpopulated: opts.EmitDefaults,
+		UseEnumNumbers:  opts.EnumsAsInts,
+		UseProtoNames:   opts.UseProtoNames,
+	}.Marshal(m)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "proto marshal failed", "type", messageName(m))
+	}
+	if opts.Int64AsString {
+		return data, nil
+	}
+	data, err = int64AsNumber(m.ProtoReflect().Descriptor(), data, opts.UseProtoNames)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "proto marshal failed", "type", messageName(m))
+	}
+	return data, nil
+}
+
+// ProtoUnmarshalWith decodes JSON into m using opts.
+func ProtoUnmarshalWith(b []byte, m proto.Message, opts ProtoOptions) error {
+	err := protojson.UnmarshalOptions{DiscardUnknown: opts.DiscardUnknown}.Unmarshal(b, m)
+	if err != nil {
+		return errs.WrapMsg(err, "proto unmarshal failed", "type", messageName(m))
+	}
+	return nil
+}
+
+func messageName(m proto.Message) string {
+	if m == nil {
+		return ""
+	}
+	return string(m.ProtoReflect().Descriptor().FullName())
+}
+
+// int64AsNumber rewrites the string encoded 64-bit integers produced by
+// protojson as JSON numbers, using the message descriptor to find them so
+// string fields that merely look numeric are left alone.
+func int64AsNumber(md protoreflect.MessageDescriptor, data []byte, protoNames bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	v = convertMessage(md, v, protoNames)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+func convertMessage(md protoreflect.MessageDescriptor, v any, protoNames bool) any {
+	obj, ok := v.(map[string]any)
+	// Well-known types have their own JSON mapping and are left untouched.
+	if !ok || md.FullName().Parent() == "google.protobuf" {
+		return v
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := fd.JSONName()
+		if protoNames {
+			name = fd.TextName()
+		}
+		fv, ok := obj[name]
+		if !ok {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if m, ok := fv.(map[string]any); ok {
+				for k, e := range m {
+					m[k] = convertValue(fd.MapValue(), e, protoNames)
+				}
+			}
+		case fd.IsList():
+			if list, ok := fv.([]any); ok {
+				for j, e := range list {
+					list[j] = convertValue(fd, e, protoNames)
+				}
+			}
+		default:
+			obj[name] = convertValue(fd, fv, protoNames)
+		}
+	}
+	return obj
+}
+
+func convertValue(fd protoreflect.FieldDescriptor, v any, protoNames bool) any {
+	switch fd.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if s, ok := v.(string); ok {
+			return json.Number(s)
+		}
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return convertMessage(fd.Message(), v, protoNames)
+	}
+	return v
+}
@@ -0,0 +1,99 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"testing"
+
+	"github.com/openimsdk/protocol/sdkws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoMarshalDefaults(t *testing.T) {
+	req := &sdkws.PullMessageBySeqsReq{
+		UserID:    "u1",
+		SeqRanges: []*sdkws.SeqRange{{ConversationID: "c1", Begin: 1, End: 9007199254740993}},
+		Order:     sdkws.PullOrder_PullOrderDesc,
+	}
+	b, err := ProtoMarshal(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"userID":"u1","seqRanges":[{"conversationID":"c1","begin":"1","end":"9007199254740993","num":"0"}],"order":1}`, string(b))
+
+	var out sdkws.PullMessageBySeqsReq
+	require.NoError(t, ProtoUnmarshal(b, &out))
+	assert.Equal(t, req.SeqRanges[0].End, out.SeqRanges[0].End)
+	assert.Equal(t, req.Order, out.Order)
+}
+
+func TestProtoMarshalInt64AsNumber(t *testing.T) {
+	opts := DefaultProtoOptions
+	opts.Int64AsString = false
+	opts.EmitDefaults = false
+	msg := &sdkws.MsgData{
+		SendID:   "123",
+		Seq:      42,
+		SendTime: 9007199254740993,
+		Options:  map[string]bool{"history": true},
+	}
+	b, err := ProtoMarshalWith(msg, opts)
+	require.NoError(t, err)
+	assert.Equal(t, `{"options":{"history":true},"sendID":"123","sendTime":9007199254740993,"seq":42}`, string(b))
+
+	var out sdkws.MsgData
+	require.NoError(t, ProtoUnmarshalWith(b, &out, opts))
+	assert.Equal(t, msg.SendTime, out.SendTime)
+	assert.Equal(t, "123", out.SendID)
+
+	b, err = ProtoMarshalWith(wrapperspb.Int64(7), opts)
+	require.NoError(t, err)
+	assert.Equal(t, `"7"`, string(b))
+}
+
+func TestSetProtoOptions(t *testing.T) {
+	defer SetProtoOptions(GetProtoOptions())
+	SetProtoOptions(ProtoOptions{Int64AsString: true, UseProtoNames: true})
+	b, err := ProtoMarshal(&sdkws.PullMessageBySeqsReq{Order: sdkws.PullOrder_PullOrderDesc})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"order":"PullOrderDesc"}`, string(b))
+
+	var out sdkws.PullMessageBySeqsReq
+	assert.Error(t, ProtoUnmarshal([]byte(`{"unknown":1}`), &out))
+	assert.NoError(t, ProtoUnmarshalWith([]byte(`{"unknown":1}`), &out, DefaultProtoOptions))
+}
+
+func FuzzProtoUnmarshal(f *testing.F) {
+	f.Add([]byte(`{"sendID":"123","seq":"42","sendTime":9007199254740993,"options":{"history":true}}`))
+	f.Add([]byte(`{"content":"aGk=","contentType":101,"atUserIDList":["a"]}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg sdkws.MsgData
+		if err := ProtoUnmarshal(data, &msg); err != nil {
+			return
+		}
+		b, err := ProtoMarshal(&msg)
+		if err != nil {
+			t.Fatalf("marshal of decoded message failed: %v", err)
+		}
+		var again sdkws.MsgData
+		if err := ProtoUnmarshal(b, &again); err != nil {
+			t.Fatalf("decode of %q failed: %v", b, err)
+		}
+		if !proto.Equal(&msg, &again) {
+			t.Fatalf("round trip mismatch for %q", b)
+		}
+	})
+}
@@ -0,0 +1,725 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/openimsdk/tools/errs"
+)
+
+// Schema is a compiled JSON Schema. The supported subset covers what payload
+// validation needs:
+//
+//   - type, enum, const
+//   - properties, required, additionalProperties, minProperties, maxProperties
+//   - items, minItems, maxItems, uniqueItems
+//   - minLength, maxLength, pattern, format (date-time, date, email, uri, uuid)
+//   - minimum, maximum, exclusiveMinimum, exclusiveMaximum, multipleOf
+//   - allOf, anyOf, oneOf, not
+//   - $ref to "#", "#/$defs/..." and "#/definitions/..."
+//
+// Other keywords are rejected when compiling, so a schema never silently
+// validates less than its author expects. Annotations like title,
+// description, default, examples, $schema, $id and $comment are ignored.
+type Schema struct {
+	root *schemaNode
+}
+
+// SchemaViolation is a single failed check.
+type SchemaViolation struct {
+	Path    string // JSON pointer of the value, "" for the document.
+	Message string
+}
+
+// SchemaError is returned for payloads violating a schema. It is an
+// ArgsError, with the violations as detail.
+type SchemaError struct {
+	errs.CodeError
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Wrap() error {
+	return errs.Wrap(e)
+}
+
+func (e *SchemaError) WrapMsg(msg string, kv ...any) error {
+	return errs.WrapMsg(e, msg, kv...)
+}
+
+type schemaNode struct {
+	boolean *bool // true or false schema.
+	ref     string
+	refNode *schemaNode
+
+	types      []string
+	enum       []any
+	hasConst   bool
+	constValue any
+
+	properties           map[string]*schemaNode
+	required             []string
+	additionalProperties *schemaNode
+	minProperties        *int
+	maxProperties        *int
+
+	items       *schemaNode
+	minItems    *int
+	maxItems    *int
+	uniqueItems bool
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+	format    string
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+	multipleOf       *float64
+
+	allOf []*schemaNode
+	anyOf []*schemaNode
+	oneOf []*schemaNode
+	not   *schemaNode
+}
+
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "$defs": true, "definitions": true,
+	"title": true, "description": true, "default": true, "examples": true, "deprecated": true,
+	"readOnly": true, "writeOnly": true,
+}
+
+var schemaFormats = map[string]func(string) bool{
+	"date-time": func(s string) bool { _, err := time.Parse(time.RFC3339, s); return err == nil },
+	"date":      func(s string) bool { _, err := time.Parse(time.DateOnly, s); return err == nil },
+	"email": func(s string) bool {
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	},
+	"uri": func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	},
+	"uuid": func(s string) bool { _, err := uuid.Parse(s); return err == nil && len(s) == 36 },
+}
+
+// CompileSchema parses a JSON Schema document.
+func CompileSchema(schema []byte) (*Schema, error) {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(schema))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errs.WrapMsg(err, "json schema is not valid json")
+	}
+	c := &schemaCompiler{doc: doc, refs: make(map[string]*schemaNode)}
+	root, err := c.compile(doc, "#")
+	if err != nil {
+		return nil, err
+	}
+	c.refs["#"] = root
+	if err := c.resolve(root, make(map[*schemaNode]bool)); err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+type schemaCompiler struct {
+	doc  any
+	refs map[string]*schemaNode
+}
+
+func (c *schemaCompiler) compile(v any, path string) (*schemaNode, error) {
+	if b, ok := v.(bool); ok {
+		return &schemaNode{boolean: &b}, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("json schema must be an object or a boolean", "path", path)
+	}
+	n := &schemaNode{}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := c.keyword(n, k, m[k], path+"/"+k); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (c *schemaCompiler) keyword(n *schemaNode, k string, v any, path string) error {
+	var err error
+	switch k {
+	case "$ref":
+		s, ok := v.(string)
+		if !ok || s != "#" && !strings.HasPrefix(s, "#/$defs/") && !strings.HasPrefix(s, "#/definitions/") {
+			return errs.ErrArgs.WrapMsg("unsupported json schema $ref", "path", path, "ref", v)
+		}
+		n.ref = s
+	case "type":
+		switch t := v.(type) {
+		case string:
+			n.types = []string{t}
+		case []any:
+			for _, item := range t {
+				s, ok := item.(string)
+				if !ok {
+					return errs.ErrArgs.WrapMsg("json schema type must be a string", "path", path)
+				}
+				n.types = append(n.types, s)
+			}
+		default:
+			return errs.ErrArgs.WrapMsg("invalid json schema type", "path", path)
+		}
+		for _, t := range n.types {
+			switch t {
+			case "null", "boolean", "object", "array", "number", "integer", "string":
+			default:
+				return errs.ErrArgs.WrapMsg("unknown json schema type", "path", path, "type", t)
+			}
+		}
+	case "enum":
+		items, ok := v.([]any)
+		if !ok {
+			return errs.ErrArgs.WrapMsg("json schema enum must be an array", "path", path)
+		}
+		n.enum = items
+	case "const":
+		n.hasConst, n.constValue = true, v
+	case "properties":
+		props, ok := v.(map[string]any)
+		if !ok {
+			return errs.ErrArgs.WrapMsg("json schema properties must be an object", "path", path)
+		}
+		n.properties = make(map[string]*schemaNode, len(props))
+		for name, prop := range props {
+			if n.properties[name], err = c.compile(prop, path+"/"+escapePointer(name)); err != nil {
+				return err
+			}
+		}
+	case "required":
+		items, ok := v.([]any)
+		if !ok {
+			return errs.ErrArgs.WrapMsg("json schema required must be an array", "path", path)
+		}
+		for _, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return errs.ErrArgs.WrapMsg("json schema required must list strings", "path", path)
+			}
+			n.required = append(n.required, s)
+		}
+	case "additionalProperties":
+		n.additionalProperties, err = c.compile(v, path)
+	case "items":
+		n.items, err = c.compile(v, path)
+	case "not":
+		n.not, err = c.compile(v, path)
+	case "allOf", "anyOf", "oneOf":
+		items, ok := v.([]any)
+		if !ok || len(items) == 0 {
+			return errs.ErrArgs.WrapMsg("json schema "+k+" must be a non empty array", "path", path)
+		}
+		nodes := make([]*schemaNode, len(items))
+		for i, item := range items {
+			if nodes[i], err = c.compile(item, path+"/"+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		switch k {
+		case "allOf":
+			n.allOf = nodes
+		case "anyOf":
+			n.anyOf = nodes
+		default:
+			n.oneOf = nodes
+		}
+	case "minProperties", "maxProperties", "minItems", "maxItems", "minLength", "maxLength":
+		i, ok := schemaInt(v)
+		if !ok || i < 0 {
+			return errs.ErrArgs.WrapMsg("json schema "+k+" must be a non negative integer", "path", path)
+		}
+		switch k {
+		case "minProperties":
+			n.minProperties = &i
+		case "maxProperties":
+			n.maxProperties = &i
+		case "minItems":
+			n.minItems = &i
+		case "maxItems":
+			n.maxItems = &i
+		case "minLength":
+			n.minLength = &i
+		default:
+			n.maxLength = &i
+		}
+	case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+		f, ok := schemaFloat(v)
+		if !ok || k == "multipleOf" && f <= 0 {
+			return errs.ErrArgs.WrapMsg("json schema "+k+" must be a number", "path", path)
+		}
+		switch k {
+		case "minimum":
+			n.minimum = &f
+		case "maximum":
+			n.maximum = &f
+		case "exclusiveMinimum":
+			n.exclusiveMinimum = &f
+		case "exclusiveMaximum":
+			n.exclusiveMaximum = &f
+		default:
+			n.multipleOf = &f
+		}
+	case "uniqueItems":
+		b, ok := v.(bool)
+		if !ok {
+			return errs.ErrArgs.WrapMsg("json schema uniqueItems must be a boolean", "path", path)
+		}
+		n.uniqueItems = b
+	case "pattern":
+		s, ok := v.(string)
+		if !ok {
+			return errs.ErrArgs.WrapMsg("json schema pattern must be a string", "path", path)
+		}
+		if n.pattern, err = regexp.Compile(s); err != nil {
+			return errs.WrapMsg(err, "invalid json schema pattern", "path", path)
+		}
+	case "format":
+		s, ok := v.(string)
+		if _, known := schemaFormats[s]; !ok || !known {
+			return errs.ErrArgs.WrapMsg("unsupported json schema format", "path", path, "format", v)
+		}
+		n.format = s
+	default:
+		if !schemaAnnotations[k] {
+			return errs.ErrArgs.WrapMsg("unsupported json schema keyword", "path", path)
+		}
+	}
+	return err
+}
+
+// resolve links the $ref nodes to their targets.
+func (c *schemaCompiler) resolve(n *schemaNode, seen map[*schemaNode]bool) error {
+	if n == nil || seen[n] {
+		return nil
+	}
+	seen[n] = true
+	if n.ref != "" {
+		target, ok := c.refs[n.ref]
+		if !ok {
+			v := c.doc
+			for _, part := range strings.Split(strings.TrimPrefix(n.ref, "#/"), "/") {
+				m, isMap := v.(map[string]any)
+				if !isMap {
+					v = nil
+					break
+				}
+				v = m[unescapePointer(part)]
+			}
+			if v == nil {
+				return errs.ErrArgs.WrapMsg("json schema $ref not found", "ref", n.ref)
+			}
+			var err error
+			if target, err = c.compile(v, n.ref); err != nil {
+				return err
+			}
+			c.refs[n.ref] = target
+		}
+		n.refNode = target
+		if err := c.resolve(target, seen); err != nil {
+			return err
+		}
+	}
+	children := []*schemaNode{n.additionalProperties, n.items, n.not}
+	for _, p := range n.properties {
+		children = append(children, p)
+	}
+	children = append(children, n.allOf...)
+	children = append(children, n.anyOf...)
+	children = append(children, n.oneOf...)
+	for _, child := range children {
+		if err := c.resolve(child, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func schemaFloat(v any) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func schemaInt(v any) (int, bool) {
+	f, ok := schemaFloat(v)
+	if !ok || f != math.Trunc(f) || f > math.MaxInt32 {
+		return 0, false
+	}
+	return int(f), true
+}
+
+func escapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
+
+// Validate checks a JSON document against the schema.
+func (s *Schema) Validate(data []byte) error {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return errs.ErrArgs.WrapMsg("payload is not valid json", "err", err.Error())
+	}
+	if dec.More() {
+		return errs.ErrArgs.WrapMsg("payload has data after the json value")
+	}
+	return s.validate(v)
+}
+
+// ValidateValue checks a Go value, encoded to JSON first, against the schema.
+func (s *Schema) ValidateValue(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errs.WrapMsg(err, "marshal value to validate failed")
+	}
+	return s.Validate(data)
+}
+
+func (s *Schema) validate(v any) error {
+	var violations []SchemaViolation
+	s.root.check(v, "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	detail := make([]string, 0, len(violations))
+	for _, vio := range violations {
+		path := vio.Path
+		if path == "" {
+			path = "/"
+		}
+		detail = append(detail, path+": "+vio.Message)
+	}
+	return &SchemaError{CodeError: errs.ErrArgs.WithDetail(strings.Join(detail, "; ")), Violations: violations}
+}
+
+// matches reports whether v passes n, without collecting violations.
+func (n *schemaNode) matches(v any) bool {
+	var violations []SchemaViolation
+	n.check(v, "", &violations)
+	return len(violations) == 0
+}
+
+func (n *schemaNode) check(v any, path string, out *[]SchemaViolation) {
+	fail := func(format string, args ...any) {
+		*out = append(*out, SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	if n.boolean != nil {
+		if !*n.boolean {
+			fail("no value is allowed")
+		}
+		return
+	}
+	if n.refNode != nil {
+		n.refNode.check(v, path, out)
+	}
+	if len(n.types) > 0 && !schemaTypeMatches(n.types, v) {
+		fail("expected %s, got %s", strings.Join(n.types, " or "), schemaTypeOf(v))
+		return
+	}
+	if n.enum != nil {
+		var ok bool
+		for _, e := range n.enum {
+			if schemaEqual(e, v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if n.hasConst && !schemaEqual(n.constValue, v) {
+		fail("value must be %v", n.constValue)
+	}
+	switch val := v.(type) {
+	case map[string]any:
+		n.checkObject(val, path, out, fail)
+	case []any:
+		n.checkArray(val, path, out, fail)
+	case string:
+		n.checkString(val, fail)
+	case json.Number:
+		n.checkNumber(val, fail)
+	}
+	for _, sub := range n.allOf {
+		sub.check(v, path, out)
+	}
+	if n.anyOf != nil {
+		var ok bool
+		for _, sub := range n.anyOf {
+			if sub.matches(v) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			fail("value matches none of anyOf")
+		}
+	}
+	if n.oneOf != nil {
+		var matched int
+		for _, sub := range n.oneOf {
+			if sub.matches(v) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			fail("value matches %d of oneOf instead of exactly one", matched)
+		}
+	}
+	if n.not != nil && n.not.matches(v) {
+		fail("value must not match the not schema")
+	}
+}
+
+func (n *schemaNode) checkObject(m map[string]any, path string, out *[]SchemaViolation, fail func(string, ...any)) {
+	for _, name := range n.required {
+		if _, ok := m[name]; !ok {
+			fail("missing required property %q", name)
+		}
+	}
+	if n.minProperties != nil && len(m) < *n.minProperties {
+		fail("at least %d properties required", *n.minProperties)
+	}
+	if n.maxProperties != nil && len(m) > *n.maxProperties {
+		fail("at most %d properties allowed", *n.maxProperties)
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := path + "/" + escapePointer(name)
+		if prop, ok := n.properties[name]; ok {
+			prop.check(m[name], sub, out)
+		} else if n.additionalProperties != nil {
+			if n.additionalProperties.boolean != nil && !*n.additionalProperties.boolean {
+				*out = append(*out, SchemaViolation{Path: sub, Message: "property is not allowed"})
+				continue
+			}
+			n.additionalProperties.check(m[name], sub, out)
+		}
+	}
+}
+
+func (n *schemaNode) checkArray(items []any, path string, out *[]SchemaViolation, fail func(string, ...any)) {
+	if n.minItems != nil && len(items) < *n.minItems {
+		fail("at least %d items required", *n.minItems)
+	}
+	if n.maxItems != nil && len(items) > *n.maxItems {
+		fail("at most %d items allowed", *n.maxItems)
+	}
+	if n.uniqueItems {
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if schemaEqual(items[i], items[j]) {
+					fail("items %d and %d are equal", j, i)
+				}
+			}
+		}
+	}
+	if n.items != nil {
+		for i, item := range items {
+			n.items.check(item, path+"/"+strconv.Itoa(i), out)
+		}
+	}
+}
+
+func (n *schemaNode) checkString(s string, fail func(string, ...any)) {
+	length := utf8.RuneCountInString(s)
+	if n.minLength != nil && length < *n.minLength {
+		fail("at least %d characters required", *n.minLength)
+	}
+	if n.maxLength != nil && length > *n.maxLength {
+		fail("at most %d characters allowed", *n.maxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		fail("does not match pattern %s", n.pattern)
+	}
+	if n.format != "" && !schemaFormats[n.format](s) {
+		fail("not a valid %s", n.format)
+	}
+}
+
+func (n *schemaNode) checkNumber(num json.Number, fail func(string, ...any)) {
+	f, err := num.Float64()
+	if err != nil {
+		fail("invalid number")
+		return
+	}
+	if n.minimum != nil && f < *n.minimum {
+		fail("must be >= %v", *n.minimum)
+	}
+	if n.maximum != nil && f > *n.maximum {
+		fail("must be <= %v", *n.maximum)
+	}
+	if n.exclusiveMinimum != nil && f <= *n.exclusiveMinimum {
+		fail("must be > %v", *n.exclusiveMinimum)
+	}
+	if n.exclusiveMaximum != nil && f >= *n.exclusiveMaximum {
+		fail("must be < %v", *n.exclusiveMaximum)
+	}
+	if n.multipleOf != nil {
+		if q := f / *n.multipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %v", *n.multipleOf)
+		}
+	}
+}
+
+func schemaTypeOf(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+func schemaTypeMatches(types []string, v any) bool {
+	actual := schemaTypeOf(v)
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaEqual compares decoded JSON values, numbers by value.
+func schemaEqual(a, b any) bool {
+	if na, ok := a.(json.Number); ok {
+		nb, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fa, errA := na.Float64()
+		fb, errB := nb.Float64()
+		return errA == nil && errB == nil && fa == fb
+	}
+	switch va := a.(type) {
+	case map[string]any:
+		vb, ok := b.(map[string]any)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for k, x := range va {
+			y, ok := vb[k]
+			if !ok || !schemaEqual(x, y) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		vb, ok := b.([]any)
+		if !ok || len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if !schemaEqual(va[i], vb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// maxCachedSchemas bounds the schemas cached by ValidateSchema.
+const maxCachedSchemas = 1024
+
+var (
+	schemaCacheMu sync.Mutex
+	schemaCache   = make(map[string]*Schema)
+)
+
+// ValidateSchema checks a JSON document against a JSON Schema document.
+// Compiled schemas are cached by their text.
+func ValidateSchema(data, schema []byte) error {
+	s, err := cachedSchema(schema)
+	if err != nil {
+		return err
+	}
+	return s.Validate(data)
+}
+
+func cachedSchema(schema []byte) (*Schema, error) {
+	schemaCacheMu.Lock()
+	s, ok := schemaCache[string(schema)]
+	schemaCacheMu.Unlock()
+	if ok {
+		return s, nil
+	}
+	s, err := CompileSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	schemaCacheMu.Lock()
+	if len(schemaCache) >= maxCachedSchemas {
+		clear(schemaCache)
+	}
+	schemaCache[string(schema)] = s
+	schemaCacheMu.Unlock()
+	return s, nil
+}
@@ -0,0 +1,101 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["event", "user"],
+	"additionalProperties": false,
+	"properties": {
+		"event": {"enum": ["created", "deleted"]},
+		"user": {"$ref": "#/$defs/user"},
+		"tags": {"type": "array", "items": {"type": "string", "minLength": 1}, "maxItems": 3, "uniqueItems": true},
+		"score": {"type": "number", "minimum": 0, "exclusiveMaximum": 100, "multipleOf": 0.5},
+		"at": {"type": "string", "format": "date-time"},
+		"parent": {"anyOf": [{"type": "null"}, {"$ref": "#/$defs/user"}]}
+	},
+	"$defs": {
+		"user": {
+			"type": "object",
+			"required": ["userID"],
+			"properties": {
+				"userID": {"type": "string", "pattern": "^[a-z0-9]+$"},
+				"level": {"type": "integer", "minimum": 1},
+				"email": {"type": "string", "format": "email"}
+			}
+		}
+	}
+}`
+
+func TestValidateSchema(t *testing.T) {
+	valid := `{"event":"created","user":{"userID":"u1","level":2,"email":"a@b.c"},"tags":["x","y"],"score":99.5,"at":"2024-05-01T10:00:00Z","parent":null}`
+	require.NoError(t, ValidateSchema([]byte(valid), []byte(testSchema)))
+
+	err := ValidateSchema([]byte(`{"event":"updated","user":{"userID":"U 1","level":1.5},"tags":["x","x",""],"score":100,"extra":1,"parent":{}}`), []byte(testSchema))
+	require.Error(t, err)
+	assert.True(t, errs.ErrArgs.Is(err))
+	var schemaErr *SchemaError
+	require.True(t, errors.As(err, &schemaErr))
+	paths := make(map[string]bool)
+	for _, v := range schemaErr.Violations {
+		paths[v.Path] = true
+	}
+	for _, p := range []string{"/event", "/user/userID", "/user/level", "/tags", "/tags/2", "/score", "/extra", "/parent"} {
+		assert.True(t, paths[p], "missing violation at %s: %v", p, schemaErr.Violations)
+	}
+
+	err = ValidateSchema([]byte(`{"user":{"userID":"u1"}}`), []byte(testSchema))
+	assert.ErrorContains(t, err, `missing required property "event"`)
+	assert.Error(t, ValidateSchema([]byte(`{`), []byte(testSchema)))
+}
+
+func TestCompileSchema(t *testing.T) {
+	for _, bad := range []string{
+		`{"type":"float"}`,
+		`{"patternProperties":{}}`,
+		`{"$ref":"https://example.com/schema"}`,
+		`{"$ref":"#/$defs/missing"}`,
+		`{"pattern":"("}`,
+		`{"format":"hostname"}`,
+		`{"minLength":-1}`,
+		`[]`,
+	} {
+		_, err := CompileSchema([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+
+	s, err := CompileSchema([]byte(`{"$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"}}}},"$ref":"#/$defs/node"}`))
+	require.NoError(t, err)
+	assert.NoError(t, s.ValidateValue(map[string]any{"next": map[string]any{"next": map[string]any{}}}))
+	assert.Error(t, s.ValidateValue(map[string]any{"next": map[string]any{"next": 1}}))
+
+	s, err = CompileSchema([]byte(`{"oneOf":[{"type":"integer"},{"minimum":2}],"not":{"const":5}}`))
+	require.NoError(t, err)
+	assert.NoError(t, s.Validate([]byte(`1`)))
+	assert.Error(t, s.Validate([]byte(`3`)))
+	assert.NoError(t, s.Validate([]byte(`2.5`)))
+	assert.Error(t, s.Validate([]byte(`5`)))
+	assert.NoError(t, s.Validate([]byte(`"x"`)))
+}
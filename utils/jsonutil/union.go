@@ -0,0 +1,231 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// DefaultDiscriminator is the field naming the variant of a union unless
+// RegisterUnion sets another one.
+const DefaultDiscriminator = "type"
+
+// union holds the variants of an interface type encoded as a tagged union.
+type union struct {
+	field  string
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+var (
+	unionMu sync.RWMutex
+	unions  = make(map[reflect.Type]*union)
+)
+
+func typeOf[I any]() reflect.Type {
+	return reflect.TypeOf((*I)(nil)).Elem()
+}
+
+func getUnion(t reflect.Type, create bool) *union {
+	u, ok := unions[t]
+	if !ok && create {
+		u = &union{field: DefaultDiscriminator, byName: make(map[string]reflect.Type), byType: make(map[reflect.Type]string)}
+		unions[t] = u
+	}
+	return u
+}
+
+// RegisterUnion sets the discriminator field of the union I, e.g. "contentType".
+// It must be called before the variants are registered.
+func RegisterUnion[I any](field string) {
+	unionMu.Lock()
+	defer unionMu.Unlock()
+	u := getUnion(typeOf[I](), true)
+	if len(u.byName) > 0 {
+		panic("jsonutil: discriminator of " + typeOf[I]().String() + " set after its variants")
+	}
+	u.field = field
+}
+
+// RegisterVariant registers the type of sample, e.g. &TextElem{}, as the
+// variant name of the union I. Like gob.Register it panics on conflicting
+// registrations, and on variants declaring the discriminator themselves.
+func RegisterVariant[I any](name string, sample I) {
+	t := reflect.TypeOf(sample)
+	if t == nil {
+		panic("jsonutil: nil variant " + name)
+	}
+	unionMu.Lock()
+	defer unionMu.Unlock()
+	u := getUnion(typeOf[I](), true)
+	if old, ok := u.byName[name]; ok && old != t {
+		panic("jsonutil: variant " + name + " registered for " + old.String() + " and " + t.String())
+	}
+	if old, ok := u.byType[t]; ok && old != name {
+		panic("jsonutil: " + t.String() + " registered as " + old + " and " + name)
+	}
+	if hasJSONField(t, u.field) {
+		panic("jsonutil: " + t.String() + " declares the discriminator " + u.field)
+	}
+	u.byName[name] = t
+	u.byType[t] = name
+}
+
+// hasJSONField reports whether the struct t, or the struct t points to,
+// encodes a top level field named name.
+func hasJSONField(t reflect.Type, name string) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		if tag == "" && f.Anonymous {
+			if hasJSONField(f.Type, name) {
+				return true
+			}
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalUnion encodes v as a JSON object with the discriminator of its
+// variant as the first field.
+func MarshalUnion[I any](v I) ([]byte, error) {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return []byte("null"), nil
+	}
+	unionMu.RLock()
+	u := getUnion(typeOf[I](), false)
+	var name, field string
+	var ok bool
+	if u != nil {
+		name, ok = u.byType[t]
+		field = u.field
+	}
+	unionMu.RUnlock()
+	if !ok {
+		return nil, errs.ErrArgs.WrapMsg("union variant not registered", "union", typeOf[I]().String(), "type", t.String())
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[0] != '{' {
+		return nil, errs.ErrArgs.WrapMsg("union variant is not encoded as an object", "type", t.String())
+	}
+	head, err := json.Marshal(map[string]string{field: name})
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	out := make([]byte, 0, len(head)+len(data))
+	out = append(out, head[:len(head)-1]...)
+	if body := bytes.TrimSpace(data[1:]); len(body) > 0 && body[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, data[1:]...), nil
+}
+
+// UnmarshalUnion decodes an object written by MarshalUnion into a new value
+// of the variant its discriminator names. null decodes to the zero I.
+func UnmarshalUnion[I any](data []byte) (I, error) {
+	var zero I
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return zero, nil
+	}
+	unionMu.RLock()
+	u := getUnion(typeOf[I](), false)
+	field := DefaultDiscriminator
+	if u != nil {
+		field = u.field
+	}
+	unionMu.RUnlock()
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return zero, errs.WrapMsg(err, "union is not a json object", "union", typeOf[I]().String())
+	}
+	var name string
+	if raw, ok := fields[field]; !ok {
+		return zero, errs.ErrArgs.WrapMsg("union discriminator missing", "union", typeOf[I]().String(), "field", field)
+	} else if err := json.Unmarshal(raw, &name); err != nil {
+		return zero, errs.ErrArgs.WrapMsg("union discriminator is not a string", "union", typeOf[I]().String(), "field", field)
+	}
+	unionMu.RLock()
+	var t reflect.Type
+	if u != nil {
+		t = u.byName[name]
+	}
+	unionMu.RUnlock()
+	if t == nil {
+		return zero, errs.ErrArgs.WrapMsg("unknown union variant", "union", typeOf[I]().String(), field, name)
+	}
+	var ptr reflect.Value
+	if t.Kind() == reflect.Pointer {
+		ptr = reflect.New(t.Elem())
+	} else {
+		ptr = reflect.New(t)
+	}
+	if err := Unmarshal(data, ptr.Interface()); err != nil {
+		return zero, errs.WrapMsg(err, "decode union variant failed", "union", typeOf[I]().String(), field, name)
+	}
+	if t.Kind() != reflect.Pointer {
+		ptr = ptr.Elem()
+	}
+	return ptr.Interface().(I), nil
+}
+
+// Union holds a value of the union I in a struct field, so that messages
+// with polymorphic parts are encoded and decoded with the usual functions:
+//
+//	type Msg struct {
+//		Elems []jsonutil.Union[Elem] `json:"elems"`
+//	}
+type Union[I any] struct {
+	Value I
+}
+
+func (u Union[I]) MarshalJSON() ([]byte, error) {
+	return MarshalUnion(u.Value)
+}
+
+func (u *Union[I]) UnmarshalJSON(data []byte) error {
+	v, err := UnmarshalUnion[I](data)
+	if err != nil {
+		return err
+	}
+	u.Value = v
+	return nil
+}
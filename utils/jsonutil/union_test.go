@@ -0,0 +1,88 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testElem interface{ elem() }
+
+type testText struct {
+	Content string `json:"content"`
+}
+
+type testImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type testEmpty struct{}
+
+func (*testText) elem()  {}
+func (testImage) elem()  {}
+func (*testEmpty) elem() {}
+
+type testMsg struct {
+	ID    string            `json:"id"`
+	Elems []Union[testElem] `json:"elems"`
+}
+
+func init() {
+	RegisterUnion[testElem]("contentType")
+	RegisterVariant[testElem]("text", &testText{})
+	RegisterVariant[testElem]("image", testImage{})
+	RegisterVariant[testElem]("empty", &testEmpty{})
+}
+
+func TestUnion(t *testing.T) {
+	msg := testMsg{ID: "m1", Elems: []Union[testElem]{
+		{Value: &testText{Content: "hi"}},
+		{Value: testImage{URL: "a.png", Width: 2, Height: 3}},
+		{Value: &testEmpty{}},
+		{},
+	}}
+	data, err := Marshal(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"m1","elems":[
+		{"contentType":"text","content":"hi"},
+		{"contentType":"image","url":"a.png","width":2,"height":3},
+		{"contentType":"empty"},
+		null]}`, string(data))
+
+	var got testMsg
+	require.NoError(t, Unmarshal(data, &got))
+	assert.Equal(t, msg, got)
+
+	_, err = UnmarshalUnion[testElem]([]byte(`{"contentType":"video"}`))
+	assert.Error(t, err)
+	_, err = UnmarshalUnion[testElem]([]byte(`{"content":"hi"}`))
+	assert.Error(t, err)
+	_, err = MarshalUnion[testElem](&testImage{})
+	assert.Error(t, err)
+}
+
+func TestRegisterVariantConflicts(t *testing.T) {
+	type declares struct {
+		Kind string `json:"type"`
+	}
+	assert.Panics(t, func() { RegisterVariant[testElem]("text", &testEmpty{}) })
+	assert.Panics(t, func() { RegisterVariant[any]("declares", declares{Kind: "x"}) })
+	assert.Panics(t, func() { RegisterUnion[testElem]("kind") })
+}
@@ -0,0 +1,56 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+var adtsSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// probeAAC walks ADTS frame headers, seeking over the payload of each frame.
+func probeAAC(r io.ReadSeeker, size int64) (*Info, error) {
+	info := &Info{Format: FormatAAC}
+	var samples uint64
+	for off := int64(0); off+7 <= size; {
+		h, err := readAt(r, off, 7)
+		if err != nil {
+			return nil, err
+		}
+		if h[0] != 0xff || h[1]&0xf6 != 0xf0 {
+			break
+		}
+		rateIdx := int(h[2]>>2) & 0x0f
+		if rateIdx >= len(adtsSampleRates) {
+			return nil, errs.WrapMsg(ErrUnsupportedFormat, "invalid adts sample rate")
+		}
+		if info.SampleRate == 0 {
+			info.SampleRate = adtsSampleRates[rateIdx]
+		}
+		frameLen := int64(h[3]&0x03)<<11 | int64(h[4])<<3 | int64(h[5]>>5)
+		if frameLen < 7 {
+			return nil, errs.WrapMsg(ErrUnsupportedFormat, "invalid adts frame length", "offset", off)
+		}
+		samples += uint64(h[6]&0x03+1) * 1024
+		off += frameLen
+	}
+	if info.SampleRate == 0 {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "adts frame not found")
+	}
+	info.Duration = samplesToDuration(samples, info.SampleRate)
+	return info, nil
+}
@@ -0,0 +1,76 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType  string `json:"codec_type"`
+		Width      int    `json:"width"`
+		Height     int    `json:"height"`
+		SampleRate string `json:"sample_rate"`
+	} `json:"streams"`
+}
+
+// FFProbe runs the ffprobe binary bin against path and converts its JSON report into an Info.
+func FFProbe(ctx context.Context, bin string, path string) (*Info, error) {
+	cmd := exec.CommandContext(ctx, bin, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "ffprobe failed", "path", path)
+	}
+	return parseFFProbe(out)
+}
+
+func parseFFProbe(data []byte) (*Info, error) {
+	var res ffprobeOutput
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, errs.WrapMsg(err, "ffprobe output unmarshal failed")
+	}
+	info := &Info{Format: res.Format.FormatName}
+	if res.Format.Duration != "" {
+		sec, err := strconv.ParseFloat(res.Format.Duration, 64)
+		if err != nil {
+			return nil, errs.WrapMsg(err, "invalid ffprobe duration", "duration", res.Format.Duration)
+		}
+		info.Duration = time.Duration(sec * float64(time.Second))
+	}
+	for _, s := range res.Streams {
+		switch s.CodecType {
+		case "video":
+			if info.Width == 0 {
+				info.Width, info.Height = s.Width, s.Height
+			}
+		case "audio":
+			if info.SampleRate == 0 {
+				info.SampleRate, _ = strconv.Atoi(s.SampleRate)
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,153 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mediautil extracts duration and dimensions from audio and video container headers.
+package mediautil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+const (
+	FormatMP4 = "mp4"
+	FormatMP3 = "mp3"
+	FormatAAC = "aac"
+	FormatOGG = "ogg"
+)
+
+type Info struct {
+	Format     string        `json:"format"`
+	Duration   time.Duration `json:"duration"`
+	Width      int           `json:"width,omitempty"`
+	Height     int           `json:"height,omitempty"`
+	SampleRate int           `json:"sampleRate,omitempty"`
+}
+
+// HasVideo reports whether a video track with non-zero dimensions was found.
+func (i *Info) HasVideo() bool {
+	return i.Width > 0 && i.Height > 0
+}
+
+// DurationWithin reports whether claimed differs from the probed duration by at most tolerance.
+// It is intended for checking client supplied message metadata.
+func (i *Info) DurationWithin(claimed, tolerance time.Duration) bool {
+	diff := i.Duration - claimed
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= tolerance
+}
+
+var ErrUnsupportedFormat = errs.New("unsupported media format")
+
+// Probe identifies the container in r and parses its headers. The reader is repositioned freely;
+// only header structures are read, never the encoded samples.
+func Probe(r io.ReadSeeker) (*Info, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "seek media failed")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, errs.WrapMsg(err, "seek media failed")
+	}
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, errs.WrapMsg(err, "seek media failed")
+	}
+	switch {
+	case len(head) >= 8 && bytes.Equal(head[4:8], []byte("ftyp")):
+		return probeMP4(r, size)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		return probeOGG(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return probeMP3(r, size)
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xf0 == 0xf0 && head[1]&0x06 == 0:
+		return probeAAC(r, size)
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		return probeMP3(r, size)
+	}
+	return nil, errs.Wrap(ErrUnsupportedFormat)
+}
+
+// ProbeBytes is Probe over an in-memory file.
+func ProbeBytes(data []byte) (*Info, error) {
+	return Probe(bytes.NewReader(data))
+}
+
+// ProbeFile probes the file at path. When the built-in parsers cannot handle the file and an
+// ffprobe binary is configured with WithFFProbe, ffprobe is executed as a fallback.
+func ProbeFile(ctx context.Context, path string, opts ...Option) (*Info, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "open media failed", "path", path)
+	}
+	info, err := Probe(f)
+	_ = f.Close()
+	if err == nil && info.Duration > 0 {
+		return info, nil
+	}
+	if o.ffprobe == "" {
+		if err != nil {
+			return nil, err
+		}
+		return info, nil
+	}
+	return FFProbe(ctx, o.ffprobe, path)
+}
+
+type options struct {
+	ffprobe string
+}
+
+type Option func(*options)
+
+// WithFFProbe enables the ffprobe fallback using the given binary, e.g. "ffprobe".
+func WithFFProbe(bin string) Option {
+	return func(o *options) {
+		o.ffprobe = bin
+	}
+}
+
+func readAt(r io.ReadSeeker, offset int64, n int) ([]byte, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, errs.WrapMsg(err, "seek media failed")
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, errs.WrapMsg(err, "read media header failed", "offset", offset)
+	}
+	return buf, nil
+}
+
+func samplesToDuration(samples uint64, rate int) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(samples * uint64(time.Second) / uint64(rate))
+}
+
+var be = binary.BigEndian
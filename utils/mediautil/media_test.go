@@ -0,0 +1,139 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(b, uint32(8+len(body)))
+	copy(b[4:], typ)
+	return append(b, body...)
+}
+
+func testMP4() []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000) // timescale
+	binary.BigEndian.PutUint32(mvhd[16:], 5500) // duration
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], 640<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], 360<<16)
+	return append(box("ftyp", []byte("isom\x00\x00\x02\x00")), box("moov", box("mvhd", mvhd), box("trak", box("tkhd", tkhd)))...)
+}
+
+func TestProbeMP4(t *testing.T) {
+	info, err := ProbeBytes(testMP4())
+	require.NoError(t, err)
+	assert.Equal(t, &Info{Format: FormatMP4, Duration: 5500 * time.Millisecond, Width: 640, Height: 360}, info)
+	assert.True(t, info.HasVideo())
+	assert.True(t, info.DurationWithin(5*time.Second, time.Second))
+	assert.False(t, info.DurationWithin(3*time.Second, time.Second))
+}
+
+func TestProbeMP3CBR(t *testing.T) {
+	// MPEG1 Layer III, 128kbps, 44100Hz, stereo: 417 byte frames.
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	data := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0a"), make([]byte, 10)...)
+	// 16000 bytes of audio is one second at 128kbps.
+	for len(data) < 20+16000 {
+		data = append(data, frame...)
+	}
+	data = data[:20+16000]
+	info, err := ProbeBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, FormatMP3, info.Format)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.Equal(t, time.Second, info.Duration)
+}
+
+func TestProbeMP3Xing(t *testing.T) {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	off := 4 + 32
+	copy(frame[off:], "Xing")
+	binary.BigEndian.PutUint32(frame[off+4:], 1)
+	binary.BigEndian.PutUint32(frame[off+8:], 3828) // 3828 * 1152 / 44100 = 100s
+	info, err := ProbeBytes(frame)
+	require.NoError(t, err)
+	assert.InDelta(t, 100.0, info.Duration.Seconds(), 0.01)
+}
+
+func TestProbeAAC(t *testing.T) {
+	// 44100Hz (index 4), single raw block, 100 byte frames.
+	frame := make([]byte, 100)
+	copy(frame, []byte{0xff, 0xf1, 0x50, 0x80, 0x0c, 0x9f, 0xfc})
+	var data []byte
+	for i := 0; i < 431; i++ {
+		data = append(data, frame...)
+	}
+	info, err := ProbeBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, FormatAAC, info.Format)
+	assert.Equal(t, 44100, info.SampleRate)
+	assert.InDelta(t, 431*1024/44100.0, info.Duration.Seconds(), 0.001)
+}
+
+func oggPage(granule uint64, packet []byte) []byte {
+	page := make([]byte, 27)
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	page[26] = 1
+	page = append(page, byte(len(packet)))
+	return append(page, packet...)
+}
+
+func TestProbeOggOpus(t *testing.T) {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = append(head, make([]byte, 7)...)
+	data := append(oggPage(0, head), oggPage(48000*3+312, []byte("audio"))...)
+	info, err := ProbeBytes(data)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{Format: FormatOGG, Duration: 3 * time.Second, SampleRate: opusRate}, info)
+}
+
+func TestProbeUnsupported(t *testing.T) {
+	_, err := ProbeBytes([]byte("plain text payload"))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestProbeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp4")
+	require.NoError(t, os.WriteFile(path, testMP4(), 0o644))
+	info, err := ProbeFile(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, 640, info.Width)
+}
+
+func TestParseFFProbe(t *testing.T) {
+	out := []byte(`{"streams":[{"codec_type":"audio","sample_rate":"48000"},{"codec_type":"video","width":1280,"height":720}],
+		"format":{"format_name":"matroska,webm","duration":"12.500000"}}`)
+	info, err := parseFFProbe(out)
+	require.NoError(t, err)
+	assert.Equal(t, &Info{Format: "matroska,webm", Duration: 12500 * time.Millisecond, Width: 1280, Height: 720, SampleRate: 48000}, info)
+}
@@ -0,0 +1,163 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// maxSyncScan bounds how far Probe searches for the first MPEG audio frame.
+const maxSyncScan = 64 << 10
+
+var (
+	mp3SampleRates = [4][3]int{
+		{11025, 12000, 8000},  // MPEG 2.5
+		{},                    // reserved
+		{22050, 24000, 16000}, // MPEG 2
+		{44100, 48000, 32000}, // MPEG 1
+	}
+	// kbps, indexed by [mpeg1?][layer][index] where layer is 1..3.
+	mp3Bitrates = [2][4][16]int{
+		{
+			{},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+		{
+			{},
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+	}
+)
+
+type mp3Frame struct {
+	mpeg1      bool
+	layer      int
+	sampleRate int
+	bitrate    int // kbps
+	mono       bool
+}
+
+func parseMP3Header(h []byte) (mp3Frame, bool) {
+	if len(h) < 4 || h[0] != 0xff || h[1]&0xe0 != 0xe0 {
+		return mp3Frame{}, false
+	}
+	version := int(h[1]>>3) & 0x03
+	layerBits := int(h[1]>>1) & 0x03
+	bitrateIdx := int(h[2] >> 4)
+	rateIdx := int(h[2]>>2) & 0x03
+	if version == 1 || layerBits == 0 || bitrateIdx == 0 || bitrateIdx == 15 || rateIdx == 3 {
+		return mp3Frame{}, false
+	}
+	f := mp3Frame{
+		mpeg1:      version == 3,
+		layer:      4 - layerBits,
+		sampleRate: mp3SampleRates[version][rateIdx],
+		mono:       h[3]>>6 == 3,
+	}
+	v := 0
+	if f.mpeg1 {
+		v = 1
+	}
+	f.bitrate = mp3Bitrates[v][f.layer][bitrateIdx]
+	return f, true
+}
+
+func (f mp3Frame) samplesPerFrame() int {
+	switch {
+	case f.layer == 1:
+		return 384
+	case f.layer == 3 && !f.mpeg1:
+		return 576
+	default:
+		return 1152
+	}
+}
+
+func (f mp3Frame) sideInfoLen() int {
+	switch {
+	case f.mpeg1 && f.mono:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+func probeMP3(r io.ReadSeeker, size int64) (*Info, error) {
+	var start int64
+	if hdr, err := readAt(r, 0, 10); err == nil && bytes.HasPrefix(hdr, []byte("ID3")) {
+		tagLen := int64(hdr[6]&0x7f)<<21 | int64(hdr[7]&0x7f)<<14 | int64(hdr[8]&0x7f)<<7 | int64(hdr[9]&0x7f)
+		start = 10 + tagLen
+		if hdr[5]&0x10 != 0 {
+			start += 10
+		}
+	}
+	scanLen := int64(maxSyncScan)
+	if start+scanLen > size {
+		scanLen = size - start
+	}
+	if scanLen < 4 {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "mp3 frame not found")
+	}
+	buf, err := readAt(r, start, int(scanLen))
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+4 <= len(buf); i++ {
+		f, ok := parseMP3Header(buf[i:])
+		if !ok {
+			continue
+		}
+		info := &Info{Format: FormatMP3, SampleRate: f.sampleRate}
+		frame := buf[i:]
+		if frames, ok := vbrFrames(frame, f); ok {
+			info.Duration = samplesToDuration(uint64(frames)*uint64(f.samplesPerFrame()), f.sampleRate)
+			return info, nil
+		}
+		audio := size - start - int64(i)
+		if size-128 >= start+int64(i) {
+			if tag, err := readAt(r, size-128, 3); err == nil && string(tag) == "TAG" {
+				audio -= 128
+			}
+		}
+		info.Duration = samplesToDuration(uint64(audio)*8*uint64(f.sampleRate)/uint64(f.bitrate*1000), f.sampleRate)
+		return info, nil
+	}
+	return nil, errs.WrapMsg(ErrUnsupportedFormat, "mp3 frame not found")
+}
+
+// vbrFrames reads the frame count from a Xing/Info or VBRI header in the first frame.
+func vbrFrames(frame []byte, f mp3Frame) (uint32, bool) {
+	if off := 4 + f.sideInfoLen(); len(frame) >= off+12 {
+		tag := string(frame[off : off+4])
+		if (tag == "Xing" || tag == "Info") && be.Uint32(frame[off+4:off+8])&0x01 != 0 {
+			return be.Uint32(frame[off+8 : off+12]), true
+		}
+	}
+	if len(frame) >= 36+18 && string(frame[36:40]) == "VBRI" {
+		return be.Uint32(frame[36+14 : 36+18]), true
+	}
+	return 0, false
+}
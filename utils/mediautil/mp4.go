@@ -0,0 +1,121 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"io"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// maxBoxDepth bounds recursion into nested MP4 boxes.
+const maxBoxDepth = 8
+
+func probeMP4(r io.ReadSeeker, size int64) (*Info, error) {
+	info := &Info{Format: FormatMP4}
+	if err := walkBoxes(r, 0, size, 0, info); err != nil {
+		return nil, err
+	}
+	if info.Duration == 0 && !info.HasVideo() {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "mp4 moov box not found")
+	}
+	return info, nil
+}
+
+func walkBoxes(r io.ReadSeeker, start, end int64, depth int, info *Info) error {
+	if depth > maxBoxDepth {
+		return nil
+	}
+	for off := start; off+8 <= end; {
+		hdr, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		boxSize := int64(be.Uint32(hdr[:4]))
+		typ := string(hdr[4:8])
+		hdrLen := int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = end - off
+		case 1:
+			ext, err := readAt(r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			boxSize = int64(be.Uint64(ext))
+			hdrLen = 16
+		}
+		if boxSize < hdrLen || off+boxSize > end {
+			return errs.WrapMsg(ErrUnsupportedFormat, "invalid mp4 box size", "type", typ, "offset", off)
+		}
+		body, bodyLen := off+hdrLen, boxSize-hdrLen
+		switch typ {
+		case "moov", "trak":
+			if err := walkBoxes(r, body, body+bodyLen, depth+1, info); err != nil {
+				return err
+			}
+		case "mvhd":
+			if err := parseMVHD(r, body, bodyLen, info); err != nil {
+				return err
+			}
+		case "tkhd":
+			if err := parseTKHD(r, body, bodyLen, info); err != nil {
+				return err
+			}
+		}
+		off += boxSize
+	}
+	return nil
+}
+
+func parseMVHD(r io.ReadSeeker, off, n int64, info *Info) error {
+	if n < 32 {
+		return errs.WrapMsg(ErrUnsupportedFormat, "short mvhd box")
+	}
+	buf, err := readAt(r, off, 32)
+	if err != nil {
+		return err
+	}
+	var timescale, duration uint64
+	if buf[0] == 1 {
+		timescale = uint64(be.Uint32(buf[20:24]))
+		duration = be.Uint64(buf[24:32])
+	} else {
+		timescale = uint64(be.Uint32(buf[12:16]))
+		duration = uint64(be.Uint32(buf[16:20]))
+	}
+	if timescale > 0 {
+		info.Duration = time.Duration(duration * uint64(time.Second) / timescale)
+	}
+	return nil
+}
+
+func parseTKHD(r io.ReadSeeker, off, n int64, info *Info) error {
+	if info.HasVideo() {
+		return nil
+	}
+	// Width and height are the last two 16.16 fixed point fields of the box.
+	if n < 8 {
+		return errs.WrapMsg(ErrUnsupportedFormat, "short tkhd box")
+	}
+	buf, err := readAt(r, off+n-8, 8)
+	if err != nil {
+		return err
+	}
+	info.Width = int(be.Uint32(buf[:4]) >> 16)
+	info.Height = int(be.Uint32(buf[4:]) >> 16)
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mediautil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// oggTailScan is how much of the end of the file is searched for the last page.
+const oggTailScan = 64 << 10
+
+// opusRate is the fixed granule rate of Ogg Opus streams.
+const opusRate = 48000
+
+func probeOGG(r io.ReadSeeker, size int64) (*Info, error) {
+	hdr, err := readAt(r, 0, 27)
+	if err != nil {
+		return nil, err
+	}
+	segments := int(hdr[26])
+	table, err := readAt(r, 27, segments)
+	if err != nil {
+		return nil, err
+	}
+	packetLen := 0
+	for _, s := range table {
+		packetLen += int(s)
+		if s < 255 {
+			break
+		}
+	}
+	if packetLen > 64 {
+		packetLen = 64
+	}
+	packet, err := readAt(r, int64(27+segments), packetLen)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Format: FormatOGG}
+	var preSkip uint64
+	switch {
+	case bytes.HasPrefix(packet, []byte("OpusHead")) && len(packet) >= 12:
+		info.SampleRate = opusRate
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	case bytes.HasPrefix(packet, []byte("\x01vorbis")) && len(packet) >= 16:
+		info.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+	default:
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "unknown ogg codec")
+	}
+
+	tailStart := size - oggTailScan
+	if tailStart < 0 {
+		tailStart = 0
+	}
+	tail, err := readAt(r, tailStart, int(size-tailStart))
+	if err != nil {
+		return nil, err
+	}
+	idx := bytes.LastIndex(tail, []byte("OggS"))
+	if idx < 0 || idx+14 > len(tail) {
+		return nil, errs.WrapMsg(ErrUnsupportedFormat, "ogg last page not found")
+	}
+	granule := binary.LittleEndian.Uint64(tail[idx+6 : idx+14])
+	if granule > preSkip {
+		granule -= preSkip
+	} else {
+		granule = 0
+	}
+	info.Duration = samplesToDuration(granule, info.SampleRate)
+	return info, nil
+}
@@ -0,0 +1,147 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mimeutil
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/openimsdk/tools/errs"
+)
+
+// SniffLen is the number of leading bytes inspected when detecting content types.
+const SniffLen = 3072
+
+const (
+	OctetStream = "application/octet-stream"
+	TextPlain   = "text/plain"
+)
+
+// executableMIMEs are detected types that must never be accepted as user media.
+var executableMIMEs = []string{
+	"application/vnd.microsoft.portable-executable",
+	"application/x-elf",
+	"application/x-executable",
+	"application/x-sharedlib",
+	"application/x-mach-binary",
+	"application/x-ms-installer",
+	"application/java-archive",
+	"text/x-shellscript",
+}
+
+// extensionAliases lists extensions that name the same format.
+var extensionAliases = map[string]string{
+	".jpeg": ".jpg",
+	".jpe":  ".jpg",
+	".tif":  ".tiff",
+	".htm":  ".html",
+	".mpeg": ".mpg",
+	".qt":   ".mov",
+	".oga":  ".ogg",
+	".m4v":  ".mp4",
+}
+
+// Detect returns the MIME type (without parameters) and canonical extension for the given leading bytes.
+func Detect(data []byte) (string, string) {
+	m := mimetype.Detect(data)
+	return baseType(m.String()), m.Extension()
+}
+
+// DetectReader reads up to SniffLen bytes from r and returns the detected MIME type together with a reader
+// that yields the full, unconsumed content.
+func DetectReader(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, errs.WrapMsg(err, "read content header failed")
+	}
+	head = head[:n]
+	contentType, _ := Detect(head)
+	return contentType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// IsExecutable reports whether contentType is a native executable, installer or script.
+func IsExecutable(contentType string) bool {
+	contentType = baseType(contentType)
+	for _, e := range executableMIMEs {
+		if contentType == e {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtensionMatches reports whether the extension of filename is consistent with the detected contentType.
+// Files without an extension, and generic text content, are considered consistent.
+func ExtensionMatches(filename string, contentType string) bool {
+	ext := normalizeExt(filepath.Ext(filename))
+	if ext == "" {
+		return true
+	}
+	contentType = baseType(contentType)
+	m := mimetype.Lookup(contentType)
+	if m == nil {
+		byExt := baseType(mime.TypeByExtension(ext))
+		return byExt != "" && byExt == contentType
+	}
+	if m.Is(TextPlain) {
+		return !IsExecutableExtension(ext)
+	}
+	for p := m; p != nil; p = p.Parent() {
+		if normalizeExt(p.Extension()) == ext {
+			return true
+		}
+		if byExt := baseType(mime.TypeByExtension(ext)); byExt != "" && p.Is(byExt) {
+			return true
+		}
+	}
+	return false
+}
+
+var executableExtensions = map[string]struct{}{
+	".exe": {}, ".dll": {}, ".com": {}, ".scr": {}, ".msi": {}, ".bat": {}, ".cmd": {},
+	".ps1": {}, ".vbs": {}, ".sh": {}, ".jar": {}, ".so": {}, ".dylib": {},
+}
+
+// IsExecutableExtension reports whether ext (with or without the leading dot) names an executable format.
+func IsExecutableExtension(ext string) bool {
+	_, ok := executableExtensions[normalizeExt(ext)]
+	return ok
+}
+
+func normalizeExt(ext string) string {
+	if ext == "" {
+		return ""
+	}
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if alias, ok := extensionAliases[ext]; ok {
+		return alias
+	}
+	return ext
+}
+
+func baseType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
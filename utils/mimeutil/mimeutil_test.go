@@ -0,0 +1,87 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mimeutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x02\x00\x00\x00")
+	exeHeader = append([]byte("MZ\x90\x00"), make([]byte, 60)...)
+	elfHeader = []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x00\x3e\x00")
+)
+
+func TestDetectReader(t *testing.T) {
+	contentType, r, err := DetectReader(bytes.NewReader(pngHeader))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+	all, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, pngHeader, all)
+}
+
+func TestExtensionMatches(t *testing.T) {
+	assert.True(t, ExtensionMatches("a.png", "image/png"))
+	assert.True(t, ExtensionMatches("a.PNG", "image/png"))
+	assert.True(t, ExtensionMatches("a.jpeg", "image/jpeg"))
+	assert.True(t, ExtensionMatches("noext", "image/png"))
+	assert.True(t, ExtensionMatches("notes.log", "text/plain; charset=utf-8"))
+	assert.False(t, ExtensionMatches("a.jpg", "image/png"))
+	assert.False(t, ExtensionMatches("run.sh", "text/plain"))
+}
+
+func TestValidator(t *testing.T) {
+	v := NewValidator(WithAllowed("image/*", "video/mp4"))
+
+	_, err := v.ValidateBytes("avatar.png", pngHeader)
+	assert.NoError(t, err)
+
+	_, err = v.ValidateBytes("avatar.jpg", pngHeader)
+	assert.True(t, errs.ErrArgs.Is(err))
+
+	_, err = v.ValidateBytes("avatar.png", exeHeader)
+	assert.True(t, errs.ErrArgs.Is(err), "disguised exe must be rejected")
+
+	_, err = v.ValidateBytes("photo.png", elfHeader)
+	assert.True(t, errs.ErrArgs.Is(err), "disguised elf must be rejected")
+
+	_, _, err = v.Validate("readme.txt", bytes.NewReader([]byte("hello")))
+	assert.True(t, errs.ErrArgs.Is(err), "text is not in the allowlist")
+
+	any := NewValidator()
+	_, err = any.ValidateBytes("setup.exe", []byte("hello"))
+	assert.Error(t, err, "executable extensions are rejected by default")
+	_, err = NewValidator(WithAllowExecutable()).ValidateBytes("setup.exe", exeHeader)
+	assert.NoError(t, err)
+}
+
+func TestValidatorAllowedExact(t *testing.T) {
+	v := NewValidator(WithAllowed("text/plain"))
+	assert.True(t, v.Allowed("text/plain; charset=utf-8"))
+	assert.False(t, v.Allowed("text/html"))
+	assert.False(t, v.Allowed("image/svg+xml"))
+	assert.False(t, v.Allowed("text/x-php"))
+
+	generic := NewValidator(WithAllowed("application/octet-stream"))
+	assert.True(t, generic.Allowed("text/html"))
+	assert.True(t, NewValidator(WithAllowed("application/zip")).Allowed("application/vnd.openxmlformats-officedocument.wordprocessingml.document"))
+}
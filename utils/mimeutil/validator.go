@@ -0,0 +1,141 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mimeutil
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/openimsdk/tools/errs"
+)
+
+// Validator checks uploads against an allowlist of content types using the actual content,
+// not the client supplied Content-Type.
+type Validator struct {
+	allowed        []string
+	checkExtension bool
+	allowExec      bool
+}
+
+type Option func(*Validator)
+
+// WithAllowed sets the allowed types. Entries may be exact types ("image/png"),
+// wildcards ("image/*") or "*/*". Exact types match the detected type or its aliases only, so
+// "text/plain" does not admit text/html. Subtypes are accepted only for the generic container
+// types in parentTypes, e.g. "application/zip" also admits docx.
+func WithAllowed(types ...string) Option {
+	return func(v *Validator) {
+		v.allowed = append(v.allowed, types...)
+	}
+}
+
+// WithExtensionCheck toggles the filename extension consistency check (enabled by default).
+func WithExtensionCheck(check bool) Option {
+	return func(v *Validator) {
+		v.checkExtension = check
+	}
+}
+
+// WithAllowExecutable disables the executable rejection, for internal tooling only.
+func WithAllowExecutable() Option {
+	return func(v *Validator) {
+		v.allowExec = true
+	}
+}
+
+// parentTypes are the generic types whose subtypes an allowlist entry admits. Other types
+// are matched exactly: text/plain is the parent of html, svg and scripts, which must not pass
+// as plain text.
+var parentTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+}
+
+func NewValidator(opts ...Option) *Validator {
+	v := &Validator{checkExtension: true}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// Allowed reports whether contentType matches the allowlist. An empty allowlist allows everything.
+func (v *Validator) Allowed(contentType string) bool {
+	if len(v.allowed) == 0 {
+		return true
+	}
+	contentType = baseType(contentType)
+	m := mimetype.Lookup(contentType)
+	for _, a := range v.allowed {
+		a = baseType(a)
+		switch {
+		case a == "*/*" || a == "*":
+			return true
+		case strings.HasSuffix(a, "/*"):
+			if strings.HasPrefix(contentType, strings.TrimSuffix(a, "*")) {
+				return true
+			}
+		case a == contentType:
+			return true
+		case m != nil && m.Is(a):
+			return true
+		case parentTypes[a]:
+			for p := m; p != nil; p = p.Parent() {
+				if p.Is(a) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ValidateBytes validates the leading bytes of a file (at least SniffLen, if available) and returns the detected type.
+func (v *Validator) ValidateBytes(filename string, head []byte) (string, error) {
+	contentType, _ := Detect(head)
+	return contentType, v.check(filename, contentType)
+}
+
+// Validate sniffs r and returns the detected content type and a reader replaying the full content.
+// Rejections are errs.ErrArgs coded.
+func (v *Validator) Validate(filename string, r io.Reader) (string, io.Reader, error) {
+	contentType, rd, err := DetectReader(r)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := v.check(filename, contentType); err != nil {
+		return contentType, nil, err
+	}
+	return contentType, rd, nil
+}
+
+func (v *Validator) check(filename string, contentType string) error {
+	if !v.allowExec {
+		if IsExecutable(contentType) {
+			return errs.ErrArgs.WrapMsg("executable content is not allowed", "filename", filename, "contentType", contentType)
+		}
+		if i := strings.LastIndexByte(filename, '.'); i >= 0 && IsExecutableExtension(filename[i:]) {
+			return errs.ErrArgs.WrapMsg("executable file extension is not allowed", "filename", filename)
+		}
+	}
+	if !v.Allowed(contentType) {
+		return errs.ErrArgs.WrapMsg("content type is not allowed", "filename", filename, "contentType", contentType)
+	}
+	if v.checkExtension && !ExtensionMatches(filename, contentType) {
+		return errs.ErrArgs.WrapMsg("file extension does not match content", "filename", filename, "contentType", contentType)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package platformutil classifies OpenIM platform IDs and parses client
+// User-Agent strings into the platform, OS version and app version.
+package platformutil
+
+import "github.com/openimsdk/protocol/constant"
+
+// Class groups platforms the way login policies treat them. The values match
+// the class names of the protocol constant package.
+type Class string
+
+const (
+	ClassUnknown Class = ""
+	ClassMobile  Class = constant.TerminalMobile
+	ClassDesktop Class = constant.TerminalPC
+	ClassWeb     Class = constant.WebPlatformStr
+	ClassAdmin   Class = constant.AdminPlatformStr
+)
+
+// ClassOf returns the class of a platform ID. Unlike constant.PlatformIDToClass
+// it also covers pads, which count as mobile, and the admin platform.
+func ClassOf(platformID int) Class {
+	switch platformID {
+	case constant.IOSPlatformID, constant.AndroidPlatformID, constant.IPadPlatformID, constant.AndroidPadPlatformID:
+		return ClassMobile
+	case constant.WindowsPlatformID, constant.OSXPlatformID, constant.LinuxPlatformID:
+		return ClassDesktop
+	case constant.WebPlatformID, constant.MiniWebPlatformID:
+		return ClassWeb
+	case constant.AdminPlatformID:
+		return ClassAdmin
+	default:
+		return ClassUnknown
+	}
+}
+
+// Valid reports whether platformID is a known platform.
+func Valid(platformID int) bool {
+	_, ok := constant.PlatformID2Name[platformID]
+	return ok
+}
+
+// Name returns the platform name of an ID, empty when unknown.
+func Name(platformID int) string {
+	return constant.PlatformIDToName(platformID)
+}
+
+// IsMobile reports whether the platform is a phone or pad app.
+func IsMobile(platformID int) bool {
+	return ClassOf(platformID) == ClassMobile
+}
+
+// IsPad reports whether the platform is an iPad or Android pad app.
+func IsPad(platformID int) bool {
+	return platformID == constant.IPadPlatformID || platformID == constant.AndroidPadPlatformID
+}
+
+// IsDesktop reports whether the platform is a Windows, macOS or Linux app.
+func IsDesktop(platformID int) bool {
+	return ClassOf(platformID) == ClassDesktop
+}
+
+// IsWeb reports whether the platform is a browser or mini program.
+func IsWeb(platformID int) bool {
+	return ClassOf(platformID) == ClassWeb
+}
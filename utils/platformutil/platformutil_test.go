@@ -0,0 +1,101 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platformutil
+
+import (
+	"testing"
+
+	"github.com/openimsdk/protocol/constant"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassOf(t *testing.T) {
+	assert.Equal(t, ClassMobile, ClassOf(constant.IPadPlatformID))
+	assert.Equal(t, ClassDesktop, ClassOf(constant.LinuxPlatformID))
+	assert.Equal(t, ClassWeb, ClassOf(constant.MiniWebPlatformID))
+	assert.Equal(t, ClassAdmin, ClassOf(constant.AdminPlatformID))
+	assert.Equal(t, ClassUnknown, ClassOf(0))
+	for id := range constant.PlatformID2class {
+		assert.Equal(t, constant.PlatformIDToClass(id), string(ClassOf(id)))
+	}
+	assert.True(t, IsPad(constant.AndroidPadPlatformID))
+	assert.True(t, IsMobile(constant.AndroidPadPlatformID))
+	assert.False(t, Valid(11))
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want Platform
+	}{
+		{
+			ua:   "OpenIM/3.5.1 (iOS 17.2; iPhone15,2)",
+			want: Platform{ID: constant.IOSPlatformID, OS: "iOS", OSVersion: "17.2", App: "OpenIM", AppVersion: "3.5.1"},
+		},
+		{
+			ua:   "OpenIM/3.5.1 (Linux; Android 14; Pixel 8 Mobile)",
+			want: Platform{ID: constant.AndroidPlatformID, OS: "Android", OSVersion: "14", App: "OpenIM", AppVersion: "3.5.1"},
+		},
+		{
+			ua:   "OpenIM/3.5.1 (Linux; Android 13; SM-X700)",
+			want: Platform{ID: constant.AndroidPadPlatformID, OS: "Android", OSVersion: "13", App: "OpenIM", AppVersion: "3.5.1"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) OpenIM/3.4.0 Mobile/15E148",
+			want: Platform{ID: constant.IPadPlatformID, OS: "iOS", OSVersion: "16.6"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			want: Platform{ID: constant.WebPlatformID, OS: "Windows", OSVersion: "10.0", Browser: "Edge", BrowserVersion: "120.0.2210.91"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+			want: Platform{ID: constant.WebPlatformID, OS: "iOS", OSVersion: "17.1.2", Browser: "Safari", BrowserVersion: "17.1"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) OpenIM/3.5.0 Chrome/118.0.5993.159 Electron/27.1.3 Safari/537.36",
+			want: Platform{ID: constant.OSXPlatformID, OS: "macOS", OSVersion: "10.15.7", App: "Electron", AppVersion: "27.1.3"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			want: Platform{ID: constant.WebPlatformID, OS: "Linux", Browser: "Firefox", BrowserVersion: "121.0"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 12; M2102K1C Build/SKQ1.211006.001; wv) AppleWebKit/537.36 Chrome/86.0.4240.99 Mobile Safari/537.36 MicroMessenger/8.0.30.2260(0x28001E3B) miniProgram",
+			want: Platform{ID: constant.MiniWebPlatformID, OS: "Android", OSVersion: "12", Browser: "WeChat", BrowserVersion: "8.0.30.2260"},
+		},
+		{
+			ua:   "",
+			want: Platform{},
+		},
+	}
+	for _, tt := range tests {
+		got := Parse(tt.ua)
+		tt.want.Name = Name(tt.want.ID)
+		tt.want.Class = ClassOf(tt.want.ID)
+		assert.Equal(t, tt.want, *got, tt.ua)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	p := Resolve(constant.IPadPlatformID, "OpenIM/3.5.1 (iOS 17.2; iPhone15,2)")
+	assert.Equal(t, constant.IPadPlatformID, p.ID)
+	assert.Equal(t, constant.IPadPlatformStr, p.Name)
+	assert.Equal(t, ClassMobile, p.Class)
+	assert.Equal(t, "3.5.1", p.AppVersion)
+
+	p = Resolve(0, "OpenIM/3.5.1 (Windows 10.0)")
+	assert.Equal(t, constant.WindowsPlatformID, p.ID)
+}
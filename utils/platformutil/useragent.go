@@ -0,0 +1,176 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platformutil
+
+import (
+	"strings"
+
+	"github.com/openimsdk/protocol/constant"
+)
+
+// Platform is what is known about a client.
+type Platform struct {
+	ID             int // Platform ID, 0 when it could not be determined.
+	Name           string
+	Class          Class
+	OS             string // "iOS", "Android", "Windows", "macOS", "Linux" or empty.
+	OSVersion      string // Dotted, e.g. "17.2".
+	App            string // Product of a native client, e.g. "OpenIM".
+	AppVersion     string
+	Browser        string // "Chrome", "Edge", "Firefox", "Safari", "Opera" or "WeChat".
+	BrowserVersion string
+}
+
+// Resolve combines the platform ID a client reported with its User-Agent. A
+// valid platformID wins over the one derived from the User-Agent, which then
+// only contributes versions.
+func Resolve(platformID int, userAgent string) *Platform {
+	p := Parse(userAgent)
+	if Valid(platformID) {
+		p.ID = platformID
+	}
+	p.Name = Name(p.ID)
+	p.Class = ClassOf(p.ID)
+	return p
+}
+
+// browsers are checked in order, as most User-Agents list several products.
+var browsers = []struct {
+	token string
+	name  string
+}{
+	{"MicroMessenger/", "WeChat"},
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"Version/", "Safari"},
+}
+
+// Parse derives the platform from a User-Agent. Native clients are expected
+// to send "App/version (OS version; ...)" and are told apart from browsers by
+// their first product not being "Mozilla". Electron shells count as desktop apps.
+func Parse(userAgent string) *Platform {
+	p := &Platform{}
+	ua := strings.TrimSpace(userAgent)
+	if ua == "" {
+		return p
+	}
+	p.OS, p.OSVersion = parseOS(ua)
+	pad := strings.Contains(ua, "iPad") || (p.OS == "Android" && !strings.Contains(ua, "Mobile"))
+
+	first, _, _ := strings.Cut(ua, " ")
+	name, version, _ := strings.Cut(first, "/")
+	native := name != "" && name != "Mozilla"
+	if native {
+		p.App, p.AppVersion = name, version
+	} else if v, ok := product(ua, "Electron/"); ok {
+		native = true
+		p.App, p.AppVersion = "Electron", v
+	}
+	if !native {
+		for _, b := range browsers {
+			if v, ok := product(ua, b.token); ok {
+				p.Browser, p.BrowserVersion = b.name, v
+				break
+			}
+		}
+	}
+
+	switch {
+	case !native && strings.Contains(ua, "miniProgram"):
+		p.ID = constant.MiniWebPlatformID
+	case !native && p.Browser != "":
+		p.ID = constant.WebPlatformID
+	case p.OS == "iOS" && pad:
+		p.ID = constant.IPadPlatformID
+	case p.OS == "iOS":
+		p.ID = constant.IOSPlatformID
+	case p.OS == "Android" && pad:
+		p.ID = constant.AndroidPadPlatformID
+	case p.OS == "Android":
+		p.ID = constant.AndroidPlatformID
+	case p.OS == "Windows":
+		p.ID = constant.WindowsPlatformID
+	case p.OS == "macOS":
+		p.ID = constant.OSXPlatformID
+	case p.OS == "Linux":
+		p.ID = constant.LinuxPlatformID
+	}
+	p.Name = Name(p.ID)
+	p.Class = ClassOf(p.ID)
+	return p
+}
+
+// osPatterns maps a User-Agent token to an OS. The version follows the token.
+var osPatterns = []struct {
+	token string
+	os    string
+}{
+	{"iPhone OS ", "iOS"},
+	{"CPU OS ", "iOS"}, // iPad
+	{"iOS ", "iOS"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Android ", "Android"},
+	{"Android", "Android"},
+	{"Windows NT ", "Windows"},
+	{"Windows", "Windows"},
+	{"Mac OS X ", "macOS"},
+	{"macOS ", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+func parseOS(ua string) (string, string) {
+	for _, pattern := range osPatterns {
+		i := strings.Index(ua, pattern.token)
+		if i < 0 {
+			continue
+		}
+		version := ""
+		if strings.HasSuffix(pattern.token, " ") {
+			version = versionPrefix(ua[i+len(pattern.token):])
+		}
+		return pattern.os, version
+	}
+	return "", ""
+}
+
+// product returns the version following token, e.g. "Chrome/".
+func product(ua string, token string) (string, bool) {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return "", false
+	}
+	return versionPrefix(ua[i+len(token):]), true
+}
+
+// versionPrefix returns the leading version of s with "_" separators turned into dots.
+func versionPrefix(s string) string {
+	end := 0
+	for end < len(s) {
+		c := s[end]
+		if (c < '0' || c > '9') && c != '.' && c != '_' {
+			break
+		}
+		end++
+	}
+	return strings.Trim(strings.ReplaceAll(s[:end], "_", "."), ".")
+}
@@ -0,0 +1,244 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package qrcode renders QR codes as PNG or SVG bytes, ready to be uploaded through the s3 layer
+// or written directly to an HTTP response.
+package qrcode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/image/draw"
+)
+
+const (
+	ContentTypePNG = "image/png"
+	ContentTypeSVG = "image/svg+xml"
+)
+
+// Level is the error correction level; higher levels survive more damage (or a bigger logo) at the cost of density.
+type Level int
+
+const (
+	Low     Level = iota // ~7% recovery
+	Medium               // ~15% recovery
+	High                 // ~25% recovery
+	Highest              // ~30% recovery
+)
+
+const (
+	defaultSize      = 256
+	defaultMargin    = 4
+	defaultLogoRatio = 0.2
+	maxLogoRatio     = 0.3
+)
+
+type Options struct {
+	// Size is the width and height of the PNG output in pixels, and the viewBox size of the SVG output.
+	Size int
+	// Margin is the quiet zone around the code in modules. Negative disables it.
+	Margin int
+	Level  Level
+	// Foreground and Background default to black and white.
+	Foreground color.Color
+	Background color.Color
+	// Logo is drawn in the center of the code. Error correction is raised to at least High when set.
+	Logo image.Image
+	// LogoRatio is the logo width relative to the code width, capped at 0.3.
+	LogoRatio float64
+}
+
+func (o *Options) normalize() Options {
+	var opt Options
+	if o != nil {
+		opt = *o
+	}
+	if opt.Size <= 0 {
+		opt.Size = defaultSize
+	}
+	if opt.Margin == 0 {
+		opt.Margin = defaultMargin
+	} else if opt.Margin < 0 {
+		opt.Margin = 0
+	}
+	if opt.Foreground == nil {
+		opt.Foreground = color.Black
+	}
+	if opt.Background == nil {
+		opt.Background = color.White
+	}
+	if opt.Logo != nil {
+		if opt.Level < High {
+			opt.Level = High
+		}
+		if opt.LogoRatio <= 0 {
+			opt.LogoRatio = defaultLogoRatio
+		} else if opt.LogoRatio > maxLogoRatio {
+			opt.LogoRatio = maxLogoRatio
+		}
+	}
+	return opt
+}
+
+func (l Level) recovery() qrcode.RecoveryLevel {
+	switch l {
+	case Medium:
+		return qrcode.Medium
+	case High:
+		return qrcode.High
+	case Highest:
+		return qrcode.Highest
+	default:
+		return qrcode.Low
+	}
+}
+
+// modules returns the module matrix including the quiet zone.
+func modules(content string, opt *Options) ([][]bool, error) {
+	if content == "" {
+		return nil, errs.ErrArgs.WrapMsg("qrcode content is empty")
+	}
+	q, err := qrcode.New(content, opt.Level.recovery())
+	if err != nil {
+		return nil, errs.WrapMsg(err, "qrcode encode failed", "length", len(content))
+	}
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+	n := len(bitmap) + 2*opt.Margin
+	m := make([][]bool, n)
+	for y := range m {
+		m[y] = make([]bool, n)
+		if y < opt.Margin || y >= opt.Margin+len(bitmap) {
+			continue
+		}
+		copy(m[y][opt.Margin:], bitmap[y-opt.Margin])
+	}
+	return m, nil
+}
+
+// Image renders content as an image of opt.Size pixels.
+func Image(content string, opts *Options) (image.Image, error) {
+	opt := opts.normalize()
+	m, err := modules(content, &opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(m)
+	size := opt.Size
+	if size < n {
+		size = n
+	}
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(opt.Background), image.Point{}, draw.Src)
+	fg := image.NewUniform(opt.Foreground)
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if !m[y][x] {
+				continue
+			}
+			rect := image.Rect(x*size/n, y*size/n, (x+1)*size/n, (y+1)*size/n)
+			draw.Draw(img, rect, fg, image.Point{}, draw.Src)
+		}
+	}
+	if opt.Logo != nil {
+		drawLogo(img, &opt, n)
+	}
+	return img, nil
+}
+
+func logoRect(size int, n int, opt *Options) image.Rectangle {
+	codeSize := float64(size) * float64(n-2*opt.Margin) / float64(n)
+	w := int(codeSize * opt.LogoRatio)
+	x0 := (size - w) / 2
+	return image.Rect(x0, x0, x0+w, x0+w)
+}
+
+func drawLogo(img *image.RGBA, opt *Options, n int) {
+	rect := logoRect(img.Bounds().Dx(), n, opt)
+	pad := rect.Dx() / 10
+	draw.Draw(img, rect.Inset(-pad), image.NewUniform(opt.Background), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(img, rect, opt.Logo, opt.Logo.Bounds(), draw.Over, nil)
+}
+
+// PNG renders content as PNG bytes.
+func PNG(content string, opts *Options) ([]byte, error) {
+	img, err := Image(content, opts)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, errs.WrapMsg(err, "png encode failed")
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders content as an SVG document. Dark modules are merged into a single path per row run,
+// and the logo, if any, is embedded as a PNG data URI.
+func SVG(content string, opts *Options) ([]byte, error) {
+	opt := opts.normalize()
+	m, err := modules(content, &opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(m)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" shape-rendering="crispEdges">`, n, n, opt.Size, opt.Size)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="%s"/>`, n, n, hexColor(opt.Background))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(opt.Foreground))
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; {
+			if !m[y][x] {
+				x++
+				continue
+			}
+			start := x
+			for x < n && m[y][x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start, y, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/>`)
+	if opt.Logo != nil {
+		// Work in module units: render the logo at a fixed resolution and position it in the viewBox.
+		const unit = 16
+		rect := logoRect(n*unit, n, &opt)
+		logo := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.CatmullRom.Scale(logo, logo.Bounds(), opt.Logo, opt.Logo.Bounds(), draw.Src, nil)
+		var logoBuf bytes.Buffer
+		if err := png.Encode(&logoBuf, logo); err != nil {
+			return nil, errs.WrapMsg(err, "png encode logo failed")
+		}
+		x := float64(rect.Min.X) / unit
+		w := float64(rect.Dx()) / unit
+		pad := w / 10
+		fmt.Fprintf(&buf, `<rect x="%g" y="%g" width="%g" height="%g" fill="%s"/>`, x-pad, x-pad, w+2*pad, w+2*pad, hexColor(opt.Background))
+		fmt.Fprintf(&buf, `<image x="%g" y="%g" width="%g" height="%g" href="data:image/png;base64,%s"/>`, x, x, w, w, base64.StdEncoding.EncodeToString(logoBuf.Bytes()))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+func hexColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
@@ -0,0 +1,64 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrcode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPNG(t *testing.T) {
+	data, err := PNG("https://example.com/invite?code=ABC123", &Options{Size: 300})
+	require.NoError(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	// The quiet zone corner is background.
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, b})
+}
+
+func TestLogo(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for i := range logo.Pix {
+		logo.Pix[i] = 0xff
+	}
+	logo.Set(32, 32, color.RGBA{R: 0xff, A: 0xff})
+	data, err := PNG("login:session:123", &Options{Size: 200, Logo: logo})
+	require.NoError(t, err)
+	assert.NotEmpty(t, data)
+
+	svg, err := SVG("login:session:123", &Options{Logo: logo})
+	require.NoError(t, err)
+	assert.Contains(t, string(svg), "data:image/png;base64,")
+}
+
+func TestSVG(t *testing.T) {
+	svg, err := SVG("hello", &Options{Foreground: color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}})
+	require.NoError(t, err)
+	s := string(svg)
+	assert.True(t, strings.HasPrefix(s, "<svg"))
+	assert.Contains(t, s, `fill="#123456"`)
+
+	_, err = SVG("", nil)
+	assert.Error(t, err)
+}
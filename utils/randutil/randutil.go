@@ -0,0 +1,176 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package randutil provides injectable pseudo random numbers for shuffling,
+// IDs, jitter and sampling, so tests can make them deterministic, and a
+// separate Secure API backed by crypto/rand for tokens and codes.
+package randutil
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Source is a source of pseudo random numbers. Implementations must be safe
+// for concurrent use.
+type Source interface {
+	Int63() int64
+	Int63n(n int64) int64
+	Intn(n int) int
+	Uint32() uint32
+	Float64() float64
+	Shuffle(n int, swap func(i, j int))
+}
+
+// globalSource uses the automatically seeded top-level functions of
+// math/rand, which are safe for concurrent use.
+type globalSource struct{}
+
+func (globalSource) Int63() int64                       { return rand.Int63() }
+func (globalSource) Int63n(n int64) int64               { return rand.Int63n(n) }
+func (globalSource) Intn(n int) int                     { return rand.Intn(n) }
+func (globalSource) Uint32() uint32                     { return rand.Uint32() }
+func (globalSource) Float64() float64                   { return rand.Float64() }
+func (globalSource) Shuffle(n int, swap func(i, j int)) { rand.Shuffle(n, swap) }
+
+// lockedSource guards a *rand.Rand, which is not safe for concurrent use.
+type lockedSource struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// New returns a Source producing the same sequence for the same seed.
+func New(seed int64) Source {
+	return &lockedSource{r: rand.New(rand.NewSource(seed))}
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63()
+}
+
+func (s *lockedSource) Int63n(n int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63n(n)
+}
+
+func (s *lockedSource) Intn(n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Intn(n)
+}
+
+func (s *lockedSource) Uint32() uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Uint32()
+}
+
+func (s *lockedSource) Float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64()
+}
+
+func (s *lockedSource) Shuffle(n int, swap func(i, j int)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.r.Shuffle(n, swap)
+}
+
+type holder struct {
+	src Source
+}
+
+var current atomic.Pointer[holder]
+
+func init() {
+	current.Store(&holder{src: globalSource{}})
+}
+
+// Default returns the Source used by the package level helpers.
+func Default() Source {
+	return current.Load().src
+}
+
+// SetDefault replaces the Source of the package level helpers and returns a
+// function restoring the previous one, e.g. for a deferred call in a test.
+// A nil src restores the automatically seeded source.
+func SetDefault(src Source) (restore func()) {
+	if src == nil {
+		src = globalSource{}
+	}
+	prev := current.Swap(&holder{src: src})
+	return func() {
+		current.Store(prev)
+	}
+}
+
+// Intn returns a number in [0, n) from the default Source.
+func Intn(n int) int {
+	return Default().Intn(n)
+}
+
+// Int63n returns a number in [0, n) from the default Source.
+func Int63n(n int64) int64 {
+	return Default().Int63n(n)
+}
+
+// Uint32 returns a number from the default Source.
+func Uint32() uint32 {
+	return Default().Uint32()
+}
+
+// Float64 returns a number in [0, 1) from the default Source.
+func Float64() float64 {
+	return Default().Float64()
+}
+
+// Shuffle shuffles s in place with the default Source.
+func Shuffle[T any](s []T) {
+	ShuffleWith(Default(), s)
+}
+
+// ShuffleWith shuffles s in place with src.
+func ShuffleWith[T any](src Source, s []T) {
+	src.Shuffle(len(s), func(i, j int) {
+		s[i], s[j] = s[j], s[i]
+	})
+}
+
+// Sample reports true with probability rate, e.g. to log a fraction of
+// events. Rates of 1 or more always and 0 or less never sample.
+func Sample(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return Default().Float64() < rate
+}
+
+// Jitter returns d changed randomly by up to factor of itself in either
+// direction, e.g. 0.2 spreads retries of 1s over [800ms, 1.2s).
+func Jitter(d time.Duration, factor float64) time.Duration {
+	if d <= 0 || factor <= 0 {
+		return d
+	}
+	delta := float64(d) * factor
+	return d + time.Duration(delta*(2*Default().Float64()-1))
+}
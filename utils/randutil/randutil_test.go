@@ -0,0 +1,85 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package randutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeterministic(t *testing.T) {
+	a, b := New(42), New(42)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, a.Int63(), b.Int63())
+	}
+
+	restore := SetDefault(New(7))
+	s1 := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	Shuffle(s1)
+	restore()
+	restore = SetDefault(New(7))
+	s2 := []int{1, 2, 3, 4, 5, 6, 7, 8}
+	Shuffle(s2)
+	restore()
+	assert.Equal(t, s1, s2)
+	assert.ElementsMatch(t, []int{1, 2, 3, 4, 5, 6, 7, 8}, s1)
+	_, ok := Default().(globalSource)
+	assert.True(t, ok)
+}
+
+func TestSample(t *testing.T) {
+	assert.True(t, Sample(1))
+	assert.False(t, Sample(0))
+	defer SetDefault(New(1))()
+	var n int
+	for i := 0; i < 10000; i++ {
+		if Sample(0.25) {
+			n++
+		}
+	}
+	assert.InDelta(t, 2500, n, 250)
+}
+
+func TestJitter(t *testing.T) {
+	assert.Equal(t, time.Second, Jitter(time.Second, 0))
+	defer SetDefault(New(1))()
+	for i := 0; i < 1000; i++ {
+		d := Jitter(time.Second, 0.2)
+		require.GreaterOrEqual(t, d, 800*time.Millisecond)
+		require.Less(t, d, 1200*time.Millisecond)
+	}
+}
+
+func TestSecure(t *testing.T) {
+	restore := SetDefault(New(1))
+	defer restore()
+	a, err := SecureHex(16)
+	require.NoError(t, err)
+	assert.Len(t, a, 32)
+	b, err := SecureHex(16)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	s, err := SecureString("ab", 20)
+	require.NoError(t, err)
+	assert.Regexp(t, "^[ab]{20}$", s)
+	_, err = SecureString("", 1)
+	assert.Error(t, err)
+	_, err = SecureIntn(0)
+	assert.Error(t, err)
+}
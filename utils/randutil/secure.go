@@ -0,0 +1,74 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package randutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// The Secure functions read crypto/rand and cannot be replaced by SetDefault.
+// Use them for tokens, verification codes, nonces and anything an attacker
+// must not predict.
+
+// SecureBytes returns n random bytes.
+func SecureBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errs.WrapMsg(err, "read crypto random failed")
+	}
+	return b, nil
+}
+
+// SecureHex returns n random bytes as hex, 2n characters long.
+func SecureHex(n int) (string, error) {
+	b, err := SecureBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SecureIntn returns a uniformly distributed number in [0, n).
+func SecureIntn(n int) (int, error) {
+	if n <= 0 {
+		return 0, errs.ErrArgs.WrapMsg("secure intn needs a positive bound", "n", n)
+	}
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, errs.WrapMsg(err, "read crypto random failed")
+	}
+	return int(v.Int64()), nil
+}
+
+// SecureString returns length characters drawn uniformly from charset.
+func SecureString(charset string, length int) (string, error) {
+	if charset == "" {
+		return "", errs.ErrArgs.WrapMsg("secure string needs a charset")
+	}
+	runes := []rune(charset)
+	res := make([]rune, length)
+	for i := range res {
+		n, err := SecureIntn(len(runes))
+		if err != nil {
+			return "", err
+		}
+		res[i] = runes[n]
+	}
+	return string(res), nil
+}
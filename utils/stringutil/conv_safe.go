@@ -0,0 +1,30 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build safeconv
+
+package stringutil
+
+// BytesToString is the copying fallback used with the safeconv build tag.
+func BytesToString(b []byte) string {
+	return string(b)
+}
+
+// StringToBytes is the copying fallback used with the safeconv build tag.
+func StringToBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return []byte(s)
+}
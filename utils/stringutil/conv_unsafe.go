@@ -0,0 +1,43 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !safeconv
+
+package stringutil
+
+import "unsafe"
+
+// BytesToString returns a string that shares b's underlying memory, without copying.
+//
+// Safety: b must not be modified for as long as the returned string, or any string derived from it,
+// is in use. Only pass buffers that are freshly produced and owned by the caller (e.g. the result of
+// json.Marshal). Build with the safeconv tag to replace this with a copying conversion.
+func BytesToString(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return unsafe.String(unsafe.SliceData(b), len(b))
+}
+
+// StringToBytes returns a byte slice that shares s's underlying memory, without copying.
+//
+// Safety: the returned slice must never be written to; strings are immutable and may live in read-only
+// memory, so a write can crash the program. Only pass it to functions that merely read their input,
+// such as json.Unmarshal or hash functions. Build with the safeconv tag to replace this with a copying conversion.
+func StringToBytes(s string) []byte {
+	if s == "" {
+		return nil
+	}
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
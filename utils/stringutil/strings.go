@@ -16,13 +16,13 @@ package stringutil
 
 import (
 	"encoding/json"
-	"fmt"
 	"hash/crc32"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 func IntToString(i int) string {
@@ -225,7 +225,7 @@ func Difference(slice1, slice2 []int64) []int64 {
 }
 
 func GetHashCode(s string) uint32 {
-	return crc32.ChecksumIEEE([]byte(s))
+	return crc32.ChecksumIEEE(StringToBytes(s))
 }
 
 // FormatString formats a string with a specified length and alignment.
@@ -238,16 +238,22 @@ func FormatString(text string, length int, alignLeft bool) string {
 		return text[:length]
 	}
 
-	// Create a format string based on alignment preference
-	var formatStr string
+	// Pad with spaces to the desired width, counted in runes like fmt's width
+	pad := length - utf8.RuneCountInString(text)
+	if pad <= 0 {
+		return text
+	}
+	b := make([]byte, 0, len(text)+pad)
 	if alignLeft {
-		formatStr = fmt.Sprintf("%%-%ds", length) // Left align
-	} else {
-		formatStr = fmt.Sprintf("%%%ds", length) // Right align
+		b = append(b, text...)
 	}
-
-	// Use the format string to format the text
-	return fmt.Sprintf(formatStr, text)
+	for i := 0; i < pad; i++ {
+		b = append(b, ' ')
+	}
+	if !alignLeft {
+		b = append(b, text...)
+	}
+	return BytesToString(b)
 }
 
 // CamelCaseToSpaceSeparated converts a camelCase string to a space-separated format
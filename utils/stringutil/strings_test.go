@@ -112,3 +112,20 @@ func TestCamelCaseToSpaceSeparated(t *testing.T) {
 		fmt.Println(r)
 	}
 }
+
+func TestBytesStringConversion(t *testing.T) {
+	b := []byte("hello openim")
+	s := BytesToString(b)
+	if s != "hello openim" {
+		t.Fatalf("BytesToString = %q", s)
+	}
+	if got := StringToBytes(s); string(got) != s {
+		t.Fatalf("StringToBytes = %q", got)
+	}
+	if BytesToString(nil) != "" || StringToBytes("") != nil {
+		t.Fatal("empty conversions")
+	}
+	if allocs := testing.AllocsPerRun(100, func() { _ = StringToBytes(BytesToString(b)) }); allocs != 0 {
+		t.Logf("conversions allocated %v times (safeconv build)", allocs)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"encoding/csv"
+	"io"
+	"reflect"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+type csvSource struct {
+	r *csv.Reader
+}
+
+func (s *csvSource) Next() ([]string, error) {
+	record, err := s.r.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errs.WrapMsg(err, "read csv failed")
+	}
+	return record, nil
+}
+
+// ReadCSV streams rows of T from a CSV with a header row.
+func ReadCSV[T any](r io.Reader, opts *ReadOptions, fn RowFunc[T]) (*Report, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return read[T](&csvSource{r: cr}, opts, fn)
+}
+
+type csvWriter[T any] struct {
+	schema *schema
+	w      *csv.Writer
+}
+
+// NewCSVWriter writes the header row immediately and returns a Writer for the data rows.
+func NewCSVWriter[T any](w io.Writer) (Writer[T], error) {
+	s, err := getSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	headers, _ := Headers[T]()
+	cw := csv.NewWriter(w)
+	if err := cw.Write(headers); err != nil {
+		return nil, errs.WrapMsg(err, "write csv header failed")
+	}
+	return &csvWriter[T]{schema: s, w: cw}, nil
+}
+
+func (c *csvWriter[T]) Write(v *T) error {
+	if err := c.w.Write(c.schema.record(reflect.ValueOf(v).Elem())); err != nil {
+		return errs.WrapMsg(err, "write csv row failed")
+	}
+	return nil
+}
+
+func (c *csvWriter[T]) Close() error {
+	c.w.Flush()
+	return errs.WrapMsg(c.w.Error(), "flush csv failed")
+}
@@ -0,0 +1,116 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// RowError describes a problem with a single row. Row is 1-based and counts the header row,
+// so it matches the row number shown by spreadsheet applications.
+type RowError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Value  string `json:"value,omitempty"`
+	Err    error  `json:"-"`
+}
+
+func (e *RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+	}
+	return fmt.Sprintf("row %d, column %q: %v", e.Row, e.Column, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// Message describes Err for the consumer of a report: the messages added by errs.WrapMsg with their
+// key-values, then the underlying error, without the stack traces kept by errs.
+func (e *RowError) Message() string {
+	if e.Err == nil {
+		return ""
+	}
+	var parts []string
+	for _, f := range errs.WrapFrames(e.Err) {
+		msg := f.Msg
+		for i := 0; i+1 < len(f.KV); i += 2 {
+			msg += fmt.Sprintf(" %v=%v", f.KV[i], f.KV[i+1])
+		}
+		if msg != "" {
+			parts = append(parts, msg)
+		}
+	}
+	var codeErr errs.CodeError
+	switch root := errs.Unwrap(e.Err); {
+	case errors.As(root, &codeErr):
+		// The code is implied by the frames, e.g. "value is required" of an ErrArgs.
+		if len(parts) == 0 {
+			parts = append(parts, codeErr.Msg())
+		}
+	case root != nil:
+		parts = append(parts, root.Error())
+	}
+	return strings.Join(parts, ": ")
+}
+
+// MarshalJSON adds Message as "message", since Err does not serialize.
+func (e *RowError) MarshalJSON() ([]byte, error) {
+	type rowError RowError
+	return json.Marshal(struct {
+		*rowError
+		Message string `json:"message"`
+	}{rowError: (*rowError)(e), Message: e.Message()})
+}
+
+// Report summarizes a read: how many data rows were seen, how many were accepted and which failed.
+type Report struct {
+	Total   int         `json:"total"`
+	Success int         `json:"success"`
+	Errors  []*RowError `json:"errors"`
+	// Truncated is set when reading stopped because ReadOptions.MaxErrors was reached.
+	Truncated bool `json:"truncated"`
+}
+
+func (r *Report) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// FailedRows returns the distinct row numbers that produced errors, in order.
+func (r *Report) FailedRows() []int {
+	rows := make([]int, 0, len(r.Errors))
+	for _, e := range r.Errors {
+		if len(rows) == 0 || rows[len(rows)-1] != e.Row {
+			rows = append(rows, e.Row)
+		}
+	}
+	return rows
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "total=%d success=%d failed=%d", r.Total, r.Success, len(r.FailedRows()))
+	for _, e := range r.Errors {
+		sb.WriteString("\n")
+		sb.WriteString(e.Error())
+	}
+	return sb.String()
+}
@@ -0,0 +1,278 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// TagName is the struct tag used for column mapping, e.g. `table:"User ID,required"`.
+// A tag of "-" skips the field; untagged exported fields use the field name as header.
+const TagName = "table"
+
+// TimeLayout is used to format and parse time.Time cells.
+var TimeLayout = "2006-01-02 15:04:05"
+
+type column struct {
+	name     string
+	index    int
+	required bool
+}
+
+type schema struct {
+	typ     reflect.Type
+	columns []column
+}
+
+var schemaCache sync.Map // reflect.Type -> *schema
+
+func getSchema[T any]() (*schema, error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if v, ok := schemaCache.Load(typ); ok {
+		return v.(*schema), nil
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, errs.New("table row type must be a struct", "type", typ.String()).Wrap()
+	}
+	s := &schema{typ: typ}
+	seen := make(map[string]struct{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get(TagName)
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			name = field.Name
+		}
+		if !supportedKind(field.Type) {
+			return nil, errs.New("unsupported table field type", "field", field.Name, "type", field.Type.String()).Wrap()
+		}
+		if _, ok := seen[name]; ok {
+			return nil, errs.New("duplicate table column", "column", name).Wrap()
+		}
+		seen[name] = struct{}{}
+		col := column{name: name, index: i}
+		for _, opt := range parts[1:] {
+			if strings.TrimSpace(opt) == "required" {
+				col.required = true
+			}
+		}
+		s.columns = append(s.columns, col)
+	}
+	v, _ := schemaCache.LoadOrStore(typ, s)
+	return v.(*schema), nil
+}
+
+// Headers returns the header row for T.
+func Headers[T any]() ([]string, error) {
+	s, err := getSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		headers[i] = col.name
+	}
+	return headers, nil
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func supportedKind(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(TimeLayout)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return ""
+}
+
+func parseValue(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if s == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		p := reflect.New(v.Type().Elem())
+		if err := parseValue(p.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Type() == timeType {
+		if s == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		t, err := time.ParseInLocation(TimeLayout, s, time.Local)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, s); err != nil {
+				return err
+			}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if s == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	}
+	return nil
+}
+
+// record converts a struct into cells in header order.
+func (s *schema) record(v reflect.Value) []string {
+	cells := make([]string, len(s.columns))
+	for i, col := range s.columns {
+		cells[i] = formatValue(v.Field(col.index))
+	}
+	return cells
+}
+
+// binding maps the columns of an input header row onto schema columns.
+type binding struct {
+	schema *schema
+	cols   []int // input column index -> schema column index, -1 if unmapped
+}
+
+func (s *schema) bind(header []string) (*binding, error) {
+	byName := make(map[string]int, len(s.columns))
+	for i, col := range s.columns {
+		byName[col.name] = i
+	}
+	b := &binding{schema: s, cols: make([]int, len(header))}
+	found := make([]bool, len(s.columns))
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		idx, ok := byName[h]
+		if !ok {
+			b.cols[i] = -1
+			continue
+		}
+		b.cols[i] = idx
+		found[idx] = true
+	}
+	for i, col := range s.columns {
+		if col.required && !found[i] {
+			return nil, errs.ErrArgs.WrapMsg("missing required column", "column", col.name)
+		}
+	}
+	return b, nil
+}
+
+// decode fills dst from a data row and returns the per-cell errors.
+func (b *binding) decode(row int, cells []string, dst reflect.Value) []*RowError {
+	var rowErrs []*RowError
+	set := make([]bool, len(b.schema.columns))
+	for i, cell := range cells {
+		if i >= len(b.cols) || b.cols[i] < 0 {
+			continue
+		}
+		col := b.schema.columns[b.cols[i]]
+		cell = strings.TrimSpace(cell)
+		if cell != "" {
+			set[b.cols[i]] = true
+		}
+		if err := parseValue(dst.Field(col.index), cell); err != nil {
+			rowErrs = append(rowErrs, &RowError{Row: row, Column: col.name, Value: cell, Err: errs.ErrArgs.WrapMsg(err.Error())})
+		}
+	}
+	for i, col := range b.schema.columns {
+		if col.required && !set[i] {
+			rowErrs = append(rowErrs, &RowError{Row: row, Column: col.name, Err: errs.ErrArgs.WrapMsg("value is required")})
+		}
+	}
+	return rowErrs
+}
@@ -0,0 +1,109 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/openimsdk/tools/checker"
+	"github.com/openimsdk/tools/errs"
+)
+
+// RowFunc is called for every data row that parsed cleanly. Returning an error records it in the report
+// against that row; the read continues with the next row.
+type RowFunc[T any] func(row int, v *T) error
+
+type ReadOptions struct {
+	// MaxErrors stops reading once this many row errors were collected. Zero means unlimited.
+	MaxErrors int
+	// SkipEmptyRows ignores rows in which every cell is blank.
+	SkipEmptyRows bool
+}
+
+// rowSource yields raw rows, the first one being the header.
+type rowSource interface {
+	Next() ([]string, error) // returns io.EOF when done
+}
+
+func read[T any](src rowSource, opts *ReadOptions, fn RowFunc[T]) (*Report, error) {
+	if opts == nil {
+		opts = &ReadOptions{SkipEmptyRows: true}
+	}
+	s, err := getSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	header, err := src.Next()
+	if err == io.EOF {
+		return nil, errs.ErrArgs.WrapMsg("table is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.bind(header)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{}
+	for row := 2; ; row++ {
+		cells, err := src.Next()
+		if err == io.EOF {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if opts.SkipEmptyRows && isEmptyRow(cells) {
+			continue
+		}
+		report.Total++
+		var v T
+		rowErrs := b.decode(row, cells, reflect.ValueOf(&v).Elem())
+		if len(rowErrs) == 0 {
+			if err := checker.Validate(&v); err != nil {
+				rowErrs = append(rowErrs, &RowError{Row: row, Err: err})
+			} else if fn != nil {
+				if err := fn(row, &v); err != nil {
+					rowErrs = append(rowErrs, &RowError{Row: row, Err: err})
+				}
+			}
+		}
+		if len(rowErrs) == 0 {
+			report.Success++
+			continue
+		}
+		report.Errors = append(report.Errors, rowErrs...)
+		if opts.MaxErrors > 0 && len(report.Errors) >= opts.MaxErrors {
+			report.Truncated = true
+			return report, nil
+		}
+	}
+}
+
+func isEmptyRow(cells []string) bool {
+	for _, c := range cells {
+		if c != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Writer writes rows of T to a table. Close must be called to flush the output.
+type Writer[T any] interface {
+	Write(v *T) error
+	Close() error
+}
@@ -0,0 +1,131 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type user struct {
+	UserID   string    `table:"User ID,required"`
+	Nickname string    `table:"Nickname"`
+	Age      int       `table:"Age"`
+	Level    *int32    `table:"Level"`
+	Created  time.Time `table:"Created"`
+	Internal string    `table:"-"`
+}
+
+func (u *user) Check() error {
+	if u.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
+}
+
+func TestReadCSV(t *testing.T) {
+	data := "Nickname,User ID,Age,Ignored\n" +
+		"alice,u1,20,x\n" +
+		"bob,,30,\n" +
+		"carol,u3,abc,\n" +
+		",,,\n" +
+		"dave,u4,-1,\n" +
+		"erin,u5,22,\n"
+	var got []string
+	report, err := ReadCSV[user](strings.NewReader(data), nil, func(row int, u *user) error {
+		if u.UserID == "u5" {
+			return errs.ErrDuplicateKey.WrapMsg("user exists")
+		}
+		got = append(got, u.UserID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, got)
+	assert.Equal(t, 5, report.Total)
+	assert.Equal(t, 1, report.Success)
+	assert.Equal(t, []int{3, 4, 6, 7}, report.FailedRows())
+	assert.Equal(t, "User ID", report.Errors[0].Column)
+	assert.True(t, errs.ErrArgs.Is(report.Errors[1].Err))
+}
+
+func TestReadMissingRequiredColumn(t *testing.T) {
+	_, err := ReadCSV[user](strings.NewReader("Nickname\nalice\n"), nil, nil)
+	assert.Error(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	level := int32(3)
+	created := time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)
+	rows := []user{
+		{UserID: "u1", Nickname: "alice, the first", Age: 20, Level: &level, Created: created},
+		{UserID: "u2", Nickname: "bob", Age: 30},
+	}
+	check := func(t *testing.T, read func(fn RowFunc[user]) (*Report, error)) {
+		var got []user
+		report, err := read(func(_ int, u *user) error {
+			got = append(got, *u)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.False(t, report.HasErrors(), report.String())
+		require.Len(t, got, 2)
+		assert.Equal(t, rows[0].Nickname, got[0].Nickname)
+		assert.Equal(t, level, *got[0].Level)
+		assert.True(t, created.Equal(got[0].Created))
+		assert.Nil(t, got[1].Level)
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewCSVWriter[user](&buf)
+		require.NoError(t, err)
+		for i := range rows {
+			require.NoError(t, w.Write(&rows[i]))
+		}
+		require.NoError(t, w.Close())
+		check(t, func(fn RowFunc[user]) (*Report, error) { return ReadCSV(&buf, nil, fn) })
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := NewXLSXWriter[user](&buf, "users")
+		require.NoError(t, err)
+		for i := range rows {
+			require.NoError(t, w.Write(&rows[i]))
+		}
+		require.NoError(t, w.Close())
+		check(t, func(fn RowFunc[user]) (*Report, error) { return ReadXLSX(&buf, "", nil, fn) })
+	})
+}
+
+func TestRowErrorJSON(t *testing.T) {
+	report := &Report{Total: 3, Success: 1, Errors: []*RowError{
+		{Row: 2, Column: "Age", Value: "x", Err: errs.ErrArgs.WrapMsg("invalid int", "value", "x")},
+		{Row: 3, Err: errors.New("boom")},
+	}}
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"total":3,"success":1,"truncated":false,"errors":[
+		{"row":2,"column":"Age","value":"x","message":"invalid int value=x"},
+		{"row":3,"message":"boom"}]}`, string(data))
+}
@@ -0,0 +1,128 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tableutil
+
+import (
+	"io"
+	"reflect"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/xuri/excelize/v2"
+)
+
+type xlsxSource struct {
+	rows *excelize.Rows
+}
+
+func (s *xlsxSource) Next() ([]string, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Error(); err != nil {
+			return nil, errs.WrapMsg(err, "read xlsx row failed")
+		}
+		return nil, io.EOF
+	}
+	cells, err := s.rows.Columns()
+	if err != nil {
+		return nil, errs.WrapMsg(err, "read xlsx columns failed")
+	}
+	return cells, nil
+}
+
+// ReadXLSX streams rows of T from a worksheet with a header row. An empty sheet name selects the first sheet.
+func ReadXLSX[T any](r io.Reader, sheet string, opts *ReadOptions, fn RowFunc[T]) (*Report, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "open xlsx failed")
+	}
+	defer f.Close()
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "open xlsx sheet failed", "sheet", sheet)
+	}
+	defer rows.Close()
+	return read[T](&xlsxSource{rows: rows}, opts, fn)
+}
+
+type xlsxWriter[T any] struct {
+	schema *schema
+	out    io.Writer
+	file   *excelize.File
+	sw     *excelize.StreamWriter
+	row    int
+}
+
+// NewXLSXWriter returns a Writer producing a single sheet workbook. Rows are streamed to a temporary
+// file by excelize and the workbook is written to w on Close.
+func NewXLSXWriter[T any](w io.Writer, sheet string) (Writer[T], error) {
+	s, err := getSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	f := excelize.NewFile()
+	if sheet != "" && sheet != f.GetSheetName(0) {
+		if err := f.SetSheetName(f.GetSheetName(0), sheet); err != nil {
+			_ = f.Close()
+			return nil, errs.WrapMsg(err, "set xlsx sheet name failed", "sheet", sheet)
+		}
+	} else {
+		sheet = f.GetSheetName(0)
+	}
+	sw, err := f.NewStreamWriter(sheet)
+	if err != nil {
+		_ = f.Close()
+		return nil, errs.WrapMsg(err, "create xlsx stream writer failed")
+	}
+	x := &xlsxWriter[T]{schema: s, out: w, file: f, sw: sw, row: 1}
+	headers, _ := Headers[T]()
+	if err := x.writeRow(headers); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return x, nil
+}
+
+func (x *xlsxWriter[T]) writeRow(cells []string) error {
+	values := make([]any, len(cells))
+	for i := range cells {
+		values[i] = cells[i]
+	}
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	if err := x.sw.SetRow(cell, values); err != nil {
+		return errs.WrapMsg(err, "write xlsx row failed", "row", x.row)
+	}
+	x.row++
+	return nil
+}
+
+func (x *xlsxWriter[T]) Write(v *T) error {
+	return x.writeRow(x.schema.record(reflect.ValueOf(v).Elem()))
+}
+
+func (x *xlsxWriter[T]) Close() error {
+	defer x.file.Close()
+	if err := x.sw.Flush(); err != nil {
+		return errs.WrapMsg(err, "flush xlsx failed")
+	}
+	if _, err := x.file.WriteTo(x.out); err != nil {
+		return errs.WrapMsg(err, "write xlsx failed")
+	}
+	return nil
+}
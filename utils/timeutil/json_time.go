@@ -0,0 +1,183 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeutil
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// JSONFormat is the layout JSONTime marshals to, RFC 3339 with
+// milliseconds.
+const JSONFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// JSONTime marshals to JSON as an RFC 3339 string, null when zero.
+// Both time types accept RFC 3339 strings, unix milliseconds and numeric
+// strings of them when unmarshaling, and are stored in BSON as dates, so
+// payloads of either format decode into either type.
+type JSONTime struct {
+	time.Time
+}
+
+// UnixMilliTime marshals to JSON as unix milliseconds, 0 when zero.
+type UnixMilliTime struct {
+	time.Time
+}
+
+func NewJSONTime(t time.Time) JSONTime {
+	return JSONTime{Time: t}
+}
+
+func NewUnixMilliTime(t time.Time) UnixMilliTime {
+	return UnixMilliTime{Time: t}
+}
+
+func (t JSONTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return strconv.AppendQuote(nil, t.Format(JSONFormat)), nil
+}
+
+func (t *JSONTime) UnmarshalJSON(data []byte) error {
+	v, err := parseJSONTime(data)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+func (t JSONTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return marshalBSONTime(t.Time)
+}
+
+func (t *JSONTime) UnmarshalBSONValue(typ bsontype.Type, data []byte) error {
+	v, err := parseBSONTime(typ, data)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+func (t UnixMilliTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("0"), nil
+	}
+	return strconv.AppendInt(nil, t.UnixMilli(), 10), nil
+}
+
+func (t *UnixMilliTime) UnmarshalJSON(data []byte) error {
+	v, err := parseJSONTime(data)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+func (t UnixMilliTime) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return marshalBSONTime(t.Time)
+}
+
+func (t *UnixMilliTime) UnmarshalBSONValue(typ bsontype.Type, data []byte) error {
+	v, err := parseBSONTime(typ, data)
+	if err != nil {
+		return err
+	}
+	t.Time = v
+	return nil
+}
+
+// ParseTime parses an RFC 3339 time or unix milliseconds. The empty
+// string and "0" are the zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return fromUnixMilli(ms), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errs.ErrArgs.WrapMsg("invalid time", "time", s)
+	}
+	return t, nil
+}
+
+func parseJSONTime(data []byte) (time.Time, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return time.Time{}, nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		s, err := strconv.Unquote(string(data))
+		if err != nil {
+			return time.Time{}, errs.ErrArgs.WrapMsg("invalid time", "time", string(data))
+		}
+		return ParseTime(s)
+	}
+	ms, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, errs.ErrArgs.WrapMsg("invalid time", "time", string(data))
+	}
+	return fromUnixMilli(ms), nil
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func marshalBSONTime(t time.Time) (bsontype.Type, []byte, error) {
+	if t.IsZero() {
+		return bson.TypeNull, nil, nil
+	}
+	return bson.MarshalValue(primitive.NewDateTimeFromTime(t))
+}
+
+func parseBSONTime(typ bsontype.Type, data []byte) (time.Time, error) {
+	v := bson.RawValue{Type: typ, Value: data}
+	switch typ {
+	case bson.TypeNull, bson.TypeUndefined:
+		return time.Time{}, nil
+	case bson.TypeDateTime:
+		if t, ok := v.TimeOK(); ok {
+			return t, nil
+		}
+	case bson.TypeInt64:
+		if ms, ok := v.Int64OK(); ok {
+			return fromUnixMilli(ms), nil
+		}
+	case bson.TypeInt32:
+		if ms, ok := v.Int32OK(); ok {
+			return fromUnixMilli(int64(ms)), nil
+		}
+	case bson.TypeString:
+		if s, ok := v.StringValueOK(); ok {
+			return ParseTime(s)
+		}
+	}
+	return time.Time{}, errs.ErrArgs.WrapMsg("invalid bson time", "type", typ.String())
+}
@@ -0,0 +1,105 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeutil
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type payload struct {
+	Created JSONTime      `json:"created" bson:"created"`
+	Updated UnixMilliTime `json:"updated" bson:"updated"`
+}
+
+func TestJSONTimeMarshal(t *testing.T) {
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	data, err := json.Marshal(payload{Created: NewJSONTime(ts), Updated: NewUnixMilliTime(ts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"created":"2024-05-06T07:08:09.123Z","updated":1714979289123}`
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+	data, err = json.Marshal(payload{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"created":null,"updated":0}`; string(data) != want {
+		t.Errorf("Marshal(zero) = %s, want %s", data, want)
+	}
+}
+
+func TestJSONTimeUnmarshal(t *testing.T) {
+	want := time.UnixMilli(1714979289123)
+	for _, in := range []string{
+		`{"created":"2024-05-06T07:08:09.123Z","updated":1714979289123}`,
+		`{"created":1714979289123,"updated":"2024-05-06T15:08:09.123+08:00"}`,
+		`{"created":"1714979289123","updated":"1714979289123"}`,
+	} {
+		var p payload
+		if err := json.Unmarshal([]byte(in), &p); err != nil {
+			t.Fatalf("Unmarshal(%s) error = %v", in, err)
+		}
+		if !p.Created.Equal(want) || !p.Updated.Equal(want) {
+			t.Errorf("Unmarshal(%s) = %v, %v, want %v", in, p.Created, p.Updated, want)
+		}
+	}
+	var p payload
+	if err := json.Unmarshal([]byte(`{"created":null,"updated":0}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Created.IsZero() || !p.Updated.IsZero() {
+		t.Errorf("Unmarshal(zero) = %v, %v, want zero", p.Created, p.Updated)
+	}
+	if err := json.Unmarshal([]byte(`{"created":"yesterday"}`), &p); err == nil {
+		t.Error("Unmarshal(invalid) error = nil")
+	}
+}
+
+func TestJSONTimeBSON(t *testing.T) {
+	ts := time.UnixMilli(1714979289123)
+	data, err := bson.Marshal(payload{Created: NewJSONTime(ts), Updated: NewUnixMilliTime(ts)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := bson.Raw(data).Lookup("created").Type; typ != bson.TypeDateTime {
+		t.Errorf("created stored as %v, want datetime", typ)
+	}
+	var p payload
+	if err := bson.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Created.Equal(ts) || !p.Updated.Equal(ts) {
+		t.Errorf("Unmarshal() = %v, %v, want %v", p.Created, p.Updated, ts)
+	}
+
+	// Documents written with plain millisecond fields decode as well.
+	data, err = bson.Marshal(bson.M{"created": ts.UnixMilli(), "updated": nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p = payload{}
+	if err := bson.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Created.Equal(ts) || !p.Updated.IsZero() {
+		t.Errorf("Unmarshal(legacy) = %v, %v", p.Created, p.Updated)
+	}
+}
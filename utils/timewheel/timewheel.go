@@ -0,0 +1,253 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timewheel implements a hierarchical timing wheel for large numbers
+// of coarse timers, such as per-connection heartbeats and ack timeouts. Adding,
+// stopping and resetting a timer is O(1) and a timer costs one small
+// allocation, far less than a time.Timer per connection. Timers fire with the
+// resolution of the wheel's tick.
+package timewheel
+
+import (
+	"sync"
+	"time"
+)
+
+// Config configures a Wheel.
+type Config struct {
+	Tick   time.Duration // Resolution, defaults to 100ms.
+	Slots  int           // Slots per level, defaults to 256.
+	Levels int           // Number of levels, defaults to 4.
+}
+
+// Timer is a pending call of a function.
+type Timer struct {
+	w          *Wheel
+	fn         func()
+	expire     int64 // Tick at which the timer fires.
+	bucket     *bucket
+	prev, next *Timer
+}
+
+type bucket struct {
+	head Timer // Sentinel of a circular list.
+}
+
+func newBucket() *bucket {
+	b := &bucket{}
+	b.head.prev, b.head.next = &b.head, &b.head
+	return b
+}
+
+func (b *bucket) push(t *Timer) {
+	t.bucket = b
+	t.prev, t.next = b.head.prev, &b.head
+	b.head.prev.next = t
+	b.head.prev = t
+}
+
+func (b *bucket) remove(t *Timer) {
+	t.prev.next, t.next.prev = t.next, t.prev
+	t.prev, t.next, t.bucket = nil, nil, nil
+}
+
+// take detaches and returns the first timer of the list, or nil.
+func (b *bucket) take() *Timer {
+	t := b.head.next
+	if t == &b.head {
+		return nil
+	}
+	b.remove(t)
+	return t
+}
+
+// Wheel schedules timers. Callbacks run on the wheel's goroutine one after
+// another and must return quickly; start a goroutine for slow work.
+type Wheel struct {
+	tick    time.Duration
+	slots   int64
+	mu      sync.Mutex
+	levels  [][]*bucket
+	current int64 // Last processed tick.
+	size    int
+
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newWheel(conf Config) *Wheel {
+	if conf.Tick <= 0 {
+		conf.Tick = 100 * time.Millisecond
+	}
+	if conf.Slots <= 1 {
+		conf.Slots = 256
+	}
+	if conf.Levels <= 0 {
+		conf.Levels = 4
+	}
+	w := &Wheel{
+		tick:   conf.Tick,
+		slots:  int64(conf.Slots),
+		levels: make([][]*bucket, conf.Levels),
+	}
+	for i := range w.levels {
+		w.levels[i] = make([]*bucket, conf.Slots)
+		for j := range w.levels[i] {
+			w.levels[i][j] = newBucket()
+		}
+	}
+	return w
+}
+
+// New creates a Wheel and starts its goroutine.
+func New(conf Config) *Wheel {
+	w := newWheel(conf)
+	w.start = time.Now()
+	w.stop = make(chan struct{})
+	w.stopped = make(chan struct{})
+	go w.run()
+	return w
+}
+
+func (w *Wheel) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			// Catch up with ticks missed under load.
+			w.advance(int64(time.Since(w.start) / w.tick))
+		}
+	}
+}
+
+// Stop stops the wheel. Pending timers never fire.
+func (w *Wheel) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+		<-w.stopped
+	})
+}
+
+// Len returns the number of pending timers.
+func (w *Wheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// ticks converts d to a number of ticks, rounding up and at least one.
+func (w *Wheel) ticks(d time.Duration) int64 {
+	n := int64((d + w.tick - 1) / w.tick)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// AfterFunc calls fn on the wheel's goroutine after at least d.
+func (w *Wheel) AfterFunc(d time.Duration, fn func()) *Timer {
+	t := &Timer{w: w, fn: fn}
+	w.mu.Lock()
+	t.expire = w.current + w.ticks(d)
+	w.add(t)
+	w.mu.Unlock()
+	return t
+}
+
+// add places t into the level whose span covers its delay. Called with mu held.
+func (w *Wheel) add(t *Timer) {
+	delay := t.expire - w.current
+	span := int64(1)
+	for level := range w.levels {
+		if delay < span*w.slots || level == len(w.levels)-1 {
+			slot := t.expire / span
+			if level == len(w.levels)-1 && delay >= span*w.slots {
+				// Beyond the range of the wheel: park in the furthest slot
+				// and cascade again from there.
+				slot = w.current/span + w.slots - 1
+			}
+			w.levels[level][slot%w.slots].push(t)
+			w.size++
+			return
+		}
+		span *= w.slots
+	}
+}
+
+// advance processes all ticks up to and including to, firing expired timers.
+func (w *Wheel) advance(to int64) {
+	for {
+		w.mu.Lock()
+		if w.current >= to {
+			w.mu.Unlock()
+			return
+		}
+		w.current++
+		// Cascade higher levels whose slot starts at this tick.
+		span := w.slots
+		for level := 1; level < len(w.levels) && w.current%span == 0; level++ {
+			b := w.levels[level][(w.current/span)%w.slots]
+			for t := b.take(); t != nil; t = b.take() {
+				w.size--
+				w.add(t)
+			}
+			span *= w.slots
+		}
+		b := w.levels[0][w.current%w.slots]
+		var fire []func()
+		for t := b.take(); t != nil; t = b.take() {
+			w.size--
+			fire = append(fire, t.fn)
+		}
+		w.mu.Unlock()
+		for _, fn := range fire {
+			fn()
+		}
+	}
+}
+
+// Stop prevents the timer from firing and reports whether it was pending.
+func (t *Timer) Stop() bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if t.bucket == nil {
+		return false
+	}
+	t.bucket.remove(t)
+	t.w.size--
+	return true
+}
+
+// Reset reschedules the timer to fire after d, whether or not it already
+// fired or was stopped, and reports whether it was pending. It is the cheap
+// way to push back a heartbeat deadline.
+func (t *Timer) Reset(d time.Duration) bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pending := t.bucket != nil
+	if pending {
+		t.bucket.remove(t)
+		w.size--
+	}
+	t.expire = w.current + w.ticks(d)
+	w.add(t)
+	return pending
+}
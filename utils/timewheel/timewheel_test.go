@@ -0,0 +1,113 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timewheel
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFireTicks checks on a manually advanced wheel that timers fire exactly
+// at their tick across levels, including beyond the wheel's range.
+func TestFireTicks(t *testing.T) {
+	w := newWheel(Config{Tick: time.Millisecond, Slots: 4, Levels: 3}) // Range of 64 ticks.
+	rnd := rand.New(rand.NewSource(1))
+	fired := make(map[int]int64)
+	want := make(map[int]int64)
+	for i := 0; i < 500; i++ {
+		// Add timers at different points in time.
+		if i%50 == 0 {
+			w.advance(w.current + int64(rnd.Intn(20)))
+		}
+		i := i
+		d := time.Duration(1+rnd.Intn(150)) * time.Millisecond
+		want[i] = w.current + int64(d/time.Millisecond)
+		w.AfterFunc(d, func() { fired[i] = w.current })
+	}
+	w.advance(w.current + 200)
+	assert.Equal(t, want, fired)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestStopReset(t *testing.T) {
+	w := newWheel(Config{Tick: time.Millisecond, Slots: 8, Levels: 2})
+	var fired []string
+	a := w.AfterFunc(5*time.Millisecond, func() { fired = append(fired, "a") })
+	b := w.AfterFunc(5*time.Millisecond, func() { fired = append(fired, "b") })
+	c := w.AfterFunc(20*time.Millisecond, func() { fired = append(fired, "c") })
+	assert.True(t, a.Stop())
+	assert.False(t, a.Stop())
+
+	w.advance(3)
+	// Heartbeat arrived: push the deadline back.
+	assert.True(t, b.Reset(5*time.Millisecond))
+	w.advance(6)
+	assert.Empty(t, fired)
+	w.advance(8)
+	assert.Equal(t, []string{"b"}, fired)
+	assert.False(t, b.Stop())
+
+	// Resetting a fired timer schedules it again.
+	assert.False(t, b.Reset(time.Millisecond))
+	assert.True(t, c.Reset(30*time.Millisecond))
+	w.advance(9)
+	assert.Equal(t, []string{"b", "b"}, fired)
+	w.advance(37)
+	assert.Equal(t, []string{"b", "b"}, fired)
+	w.advance(38)
+	assert.Equal(t, []string{"b", "b", "c"}, fired)
+	assert.Equal(t, 0, w.Len())
+}
+
+func TestWheel(t *testing.T) {
+	testutil.VerifyNoLeaks(t)
+	w := New(Config{Tick: 5 * time.Millisecond})
+	defer w.Stop()
+	var n atomic.Int32
+	done := make(chan struct{})
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		w.AfterFunc(20*time.Millisecond, func() {
+			if n.Add(1) == 1000 {
+				close(done)
+			}
+		})
+	}
+	stopped := w.AfterFunc(10*time.Millisecond, func() { t.Error("stopped timer fired") })
+	require.True(t, stopped.Stop())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timers did not fire")
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func BenchmarkAfterFuncStop(b *testing.B) {
+	w := New(Config{})
+	defer w.Stop()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w.AfterFunc(30*time.Second, func() {}).Stop()
+		}
+	})
+}
@@ -0,0 +1,320 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wsutil wraps gorilla websocket connections with keepalive,
+// deadlines, size limits, a bounded send queue and graceful close.
+package wsutil
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openimsdk/tools/errs"
+)
+
+// Message types, re-exported from gorilla websocket.
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+var (
+	// ErrClosed is returned when sending on a connection that is closing or closed.
+	ErrClosed = errs.New("websocket connection closed")
+	// ErrQueueFull is returned by TrySend when the send queue is full.
+	ErrQueueFull = errs.New("websocket send queue full")
+)
+
+// Config configures a Conn. Zero fields take the defaults below.
+type Config struct {
+	PingInterval     time.Duration // Interval between pings, must be shorter than PongWait.
+	PongWait         time.Duration // Time to wait for any frame from the peer before the connection is considered dead.
+	WriteWait        time.Duration // Deadline for writing a single message.
+	MaxMessageSize   int64         // Maximum size of a received message in bytes.
+	SendQueueSize    int           // Number of messages buffered before Send blocks.
+	CloseGracePeriod time.Duration // Time to wait for the peer to answer a close frame.
+}
+
+const (
+	DefaultPingInterval     = 27 * time.Second
+	DefaultPongWait         = 30 * time.Second
+	DefaultWriteWait        = 10 * time.Second
+	DefaultMaxMessageSize   = 1 << 20
+	DefaultSendQueueSize    = 256
+	DefaultCloseGracePeriod = time.Second
+)
+
+func (c *Config) withDefaults() Config {
+	conf := Config{}
+	if c != nil {
+		conf = *c
+	}
+	if conf.PongWait <= 0 {
+		conf.PongWait = DefaultPongWait
+	}
+	if conf.PingInterval <= 0 || conf.PingInterval >= conf.PongWait {
+		conf.PingInterval = conf.PongWait * 9 / 10
+	}
+	if conf.WriteWait <= 0 {
+		conf.WriteWait = DefaultWriteWait
+	}
+	if conf.MaxMessageSize <= 0 {
+		conf.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if conf.SendQueueSize <= 0 {
+		conf.SendQueueSize = DefaultSendQueueSize
+	}
+	if conf.CloseGracePeriod <= 0 {
+		conf.CloseGracePeriod = DefaultCloseGracePeriod
+	}
+	return conf
+}
+
+// Transport is a message oriented, bidirectional connection. Conn implements
+// it over websocket and the longpoll package over plain HTTP requests, so the
+// gateway handles both the same way.
+type Transport interface {
+	// Send queues a message, blocking while the send queue is full.
+	Send(ctx context.Context, typ int, data []byte) error
+	// TrySend queues a message or fails with ErrQueueFull.
+	TrySend(typ int, data []byte) error
+	// ReadMessage returns the next message from the peer.
+	ReadMessage() (int, []byte, error)
+	// Close closes the transport with a websocket close code and reason.
+	Close(code int, reason string) error
+	// Done is closed once the transport is closed.
+	Done() <-chan struct{}
+}
+
+var _ Transport = (*Conn)(nil)
+
+type message struct {
+	typ  int
+	data []byte
+}
+
+type closeFrame struct {
+	code   int
+	reason string
+}
+
+// Conn is a websocket connection. Send, TrySend and Close may be called from
+// any goroutine, ReadMessage must be called from a single reader goroutine.
+type Conn struct {
+	ws   *websocket.Conn
+	conf Config
+
+	send       chan message
+	closing    chan struct{}
+	closeOnce  sync.Once
+	frame      closeFrame
+	peerClosed chan struct{}
+	peerOnce   sync.Once
+	done       chan struct{}
+	doneOnce   sync.Once
+}
+
+// NewConn wraps ws and starts its writer goroutine.
+func NewConn(ws *websocket.Conn, conf *Config) *Conn {
+	c := newConn(ws, conf)
+	go c.writeLoop()
+	return c
+}
+
+func newConn(ws *websocket.Conn, conf *Config) *Conn {
+	c := &Conn{
+		ws:         ws,
+		conf:       conf.withDefaults(),
+		closing:    make(chan struct{}),
+		peerClosed: make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	c.send = make(chan message, c.conf.SendQueueSize)
+	ws.SetReadLimit(c.conf.MaxMessageSize)
+	_ = ws.SetReadDeadline(time.Now().Add(c.conf.PongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(c.conf.PongWait))
+	})
+	return c
+}
+
+// Upgrade upgrades an HTTP request to a websocket Conn. The upgrader decides
+// buffer sizes and origin checks; nil uses the gorilla defaults.
+func Upgrade(w http.ResponseWriter, r *http.Request, upgrader *websocket.Upgrader, header http.Header, conf *Config) (*Conn, error) {
+	if upgrader == nil {
+		upgrader = &websocket.Upgrader{}
+	}
+	ws, err := upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "websocket upgrade failed", "remoteAddr", r.RemoteAddr)
+	}
+	return NewConn(ws, conf), nil
+}
+
+// Dial connects to a websocket server, mainly for test clients and tools.
+func Dial(ctx context.Context, url string, header http.Header, conf *Config) (*Conn, *http.Response, error) {
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, resp, errs.WrapMsg(err, "websocket dial failed", "url", url)
+	}
+	return NewConn(ws, conf), resp, nil
+}
+
+// Underlying returns the wrapped gorilla connection.
+func (c *Conn) Underlying() *websocket.Conn {
+	return c.ws
+}
+
+// Done is closed once the connection is fully closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// QueueLen returns the number of messages waiting to be written.
+func (c *Conn) QueueLen() int {
+	return len(c.send)
+}
+
+// Send queues a message, blocking while the send queue is full until ctx is
+// done or the connection closes. That blocking is the backpressure slow
+// readers apply to the sender.
+func (c *Conn) Send(ctx context.Context, typ int, data []byte) error {
+	select {
+	case <-c.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.send <- message{typ: typ, data: data}:
+		return nil
+	case <-c.closing:
+		return ErrClosed
+	case <-ctx.Done():
+		return errs.WrapMsg(ctx.Err(), "websocket send canceled", "queueLen", len(c.send))
+	}
+}
+
+// TrySend queues a message without blocking and returns ErrQueueFull when the
+// queue is full, for callers that prefer dropping or disconnecting slow peers.
+func (c *Conn) TrySend(typ int, data []byte) error {
+	select {
+	case <-c.closing:
+		return ErrClosed
+	default:
+	}
+	select {
+	case c.send <- message{typ: typ, data: data}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// ReadMessage reads the next data message. Any frame from the peer extends the
+// read deadline. When the peer closes the connection a *websocket.CloseError
+// is returned and the connection is torn down.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	typ, data, err := c.ws.ReadMessage()
+	if err != nil {
+		c.peerOnce.Do(func() { close(c.peerClosed) })
+		c.startClose(websocket.CloseNormalClosure, "")
+		return 0, nil, err
+	}
+	_ = c.ws.SetReadDeadline(time.Now().Add(c.conf.PongWait))
+	return typ, data, nil
+}
+
+// Close flushes queued messages, sends a close frame and waits up to the
+// close grace period for the peer to answer before closing the network
+// connection. The peer's answer is only observed while a goroutine is
+// blocked in ReadMessage.
+func (c *Conn) Close(code int, reason string) error {
+	c.startClose(code, reason)
+	<-c.done
+	return nil
+}
+
+func (c *Conn) startClose(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.frame = closeFrame{code: code, reason: reason}
+		close(c.closing)
+	})
+}
+
+func (c *Conn) finish() {
+	c.doneOnce.Do(func() {
+		_ = c.ws.Close()
+		close(c.done)
+	})
+}
+
+func (c *Conn) write(msg message) error {
+	_ = c.ws.SetWriteDeadline(time.Now().Add(c.conf.WriteWait))
+	return c.ws.WriteMessage(msg.typ, msg.data)
+}
+
+func (c *Conn) writeLoop() {
+	ticker := time.NewTicker(c.conf.PingInterval)
+	defer ticker.Stop()
+	defer c.finish()
+	for {
+		select {
+		case msg := <-c.send:
+			if err := c.write(msg); err != nil {
+				c.startClose(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.conf.WriteWait)); err != nil {
+				c.startClose(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.closing:
+			c.gracefulClose()
+			return
+		}
+	}
+}
+
+func (c *Conn) gracefulClose() {
+	select {
+	case <-c.peerClosed:
+		// The peer started the close handshake and gorilla already answered it.
+		return
+	default:
+	}
+	for drained := false; !drained; {
+		select {
+		case msg := <-c.send:
+			if err := c.write(msg); err != nil {
+				return
+			}
+		default:
+			drained = true
+		}
+	}
+	data := websocket.FormatCloseMessage(c.frame.code, c.frame.reason)
+	if err := c.ws.WriteControl(websocket.CloseMessage, data, time.Now().Add(c.conf.WriteWait)); err != nil {
+		return
+	}
+	timer := time.NewTimer(c.conf.CloseGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-c.peerClosed:
+	case <-timer.C:
+	}
+}
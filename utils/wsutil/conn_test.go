@@ -0,0 +1,146 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsutil
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoServer echoes every message and reports the error that ended its read loop.
+func echoServer(t *testing.T, conf *Config) (string, <-chan error) {
+	readErr := make(chan error, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r, nil, nil, conf)
+		if err != nil {
+			return
+		}
+		for {
+			typ, data, err := c.ReadMessage()
+			if err != nil {
+				readErr <- err
+				<-c.Done()
+				return
+			}
+			if err := c.Send(context.Background(), typ, data); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), readErr
+}
+
+func dial(t *testing.T, url string, conf *Config) *Conn {
+	c, _, err := Dial(context.Background(), url, nil, conf)
+	require.NoError(t, err)
+	t.Cleanup(func() { c.Close(websocket.CloseNormalClosure, "") })
+	return c
+}
+
+func TestEchoAndGracefulClose(t *testing.T) {
+	url, serverErr := echoServer(t, nil)
+	c := dial(t, url, nil)
+
+	for _, msg := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Send(context.Background(), TextMessage, []byte(msg)))
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		typ, data, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, TextMessage, typ)
+		assert.Equal(t, want, string(data))
+	}
+
+	readDone := make(chan error, 1)
+	go func() {
+		_, _, err := c.ReadMessage()
+		readDone <- err
+	}()
+	start := time.Now()
+	require.NoError(t, c.Close(websocket.CloseGoingAway, "bye"))
+	assert.Less(t, time.Since(start), DefaultCloseGracePeriod, "peer answer should end the handshake early")
+
+	err := <-serverErr
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	assert.True(t, websocket.IsCloseError(<-readDone, websocket.CloseGoingAway))
+	assert.ErrorIs(t, c.Send(context.Background(), TextMessage, nil), ErrClosed)
+}
+
+func TestKeepalive(t *testing.T) {
+	conf := &Config{PingInterval: 20 * time.Millisecond, PongWait: 60 * time.Millisecond}
+	url, _ := echoServer(t, conf)
+	c := dial(t, url, conf)
+	// Both sides stay idle for several PongWait periods and are kept alive by pings.
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		_ = c.Send(context.Background(), TextMessage, []byte("alive"))
+	}()
+	_, data, err := c.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, "alive", string(data))
+}
+
+func TestReadDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		// Never read, so pings are not answered.
+		time.Sleep(time.Second)
+	}))
+	defer srv.Close()
+	c := dial(t, "ws"+strings.TrimPrefix(srv.URL, "http"), &Config{PongWait: 50 * time.Millisecond})
+	start := time.Now()
+	_, _, err := c.ReadMessage()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	url, serverErr := echoServer(t, &Config{MaxMessageSize: 16})
+	c := dial(t, url, nil)
+	require.NoError(t, c.Send(context.Background(), BinaryMessage, make([]byte, 17)))
+	assert.ErrorIs(t, <-serverErr, websocket.ErrReadLimit)
+}
+
+func TestSendQueue(t *testing.T) {
+	url, _ := echoServer(t, nil)
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	// Without the writer goroutine nothing drains the queue.
+	c := newConn(ws, &Config{SendQueueSize: 1})
+	require.NoError(t, c.TrySend(TextMessage, []byte("1")))
+	assert.ErrorIs(t, c.TrySend(TextMessage, []byte("2")), ErrQueueFull)
+	assert.Equal(t, 1, c.QueueLen())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Send(ctx, TextMessage, []byte("2")), context.DeadlineExceeded)
+
+	c.startClose(websocket.CloseNormalClosure, "")
+	assert.ErrorIs(t, c.TrySend(TextMessage, nil), ErrClosed)
+}
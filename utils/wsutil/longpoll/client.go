@@ -0,0 +1,282 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/wsutil"
+)
+
+// Client is the client side of the protocol, used by test clients and tools.
+type Client struct {
+	base string
+	sid  string
+	http *http.Client
+
+	in   chan inbound
+	out  chan inbound
+	stop chan struct{}
+	done chan struct{}
+
+	stopOnce sync.Once
+	mu       sync.Mutex
+	closeErr error
+}
+
+var _ wsutil.Transport = (*Client)(nil)
+
+// Dial opens a session at baseURL, the mount point of a Manager. The header
+// is sent with the open request, for example to pass a token. A nil cli uses
+// an http.Client without timeout, since polls are expected to hang.
+func Dial(ctx context.Context, baseURL string, header http.Header, cli *http.Client, queueSize int) (*Client, error) {
+	if cli == nil {
+		cli = &http.Client{}
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	base := strings.TrimSuffix(baseURL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/open", nil)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "longpoll open failed", "url", baseURL)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "longpoll open failed", "url", baseURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errs.New("longpoll open rejected", "url", baseURL, "status", resp.StatusCode).Wrap()
+	}
+	var open openResponse
+	if err := json.NewDecoder(resp.Body).Decode(&open); err != nil {
+		return nil, errs.WrapMsg(err, "longpoll open response invalid", "url", baseURL)
+	}
+	c := &Client{
+		base: base,
+		sid:  open.SessionID,
+		http: cli,
+		in:   make(chan inbound, queueSize),
+		out:  make(chan inbound, queueSize),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go c.pollLoop()
+	go c.sendLoop()
+	return c, nil
+}
+
+// SessionID returns the ID assigned by the server.
+func (c *Client) SessionID() string {
+	return c.sid
+}
+
+// Done is closed once the session is closed by either side.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Client) url(endpoint string, query url.Values) string {
+	query.Set("sid", c.sid)
+	return c.base + "/" + endpoint + "?" + query.Encode()
+}
+
+// Send queues a message for the server, blocking while the queue is full.
+func (c *Client) Send(ctx context.Context, typ int, data []byte) error {
+	select {
+	case <-c.stop:
+		return wsutil.ErrClosed
+	default:
+	}
+	select {
+	case c.out <- inbound{typ: typ, data: data}:
+		return nil
+	case <-c.stop:
+		return wsutil.ErrClosed
+	case <-ctx.Done():
+		return errs.WrapMsg(ctx.Err(), "longpoll send canceled", "sessionID", c.sid)
+	}
+}
+
+// TrySend queues a message or returns wsutil.ErrQueueFull.
+func (c *Client) TrySend(typ int, data []byte) error {
+	select {
+	case <-c.stop:
+		return wsutil.ErrClosed
+	default:
+	}
+	select {
+	case c.out <- inbound{typ: typ, data: data}:
+		return nil
+	default:
+		return wsutil.ErrQueueFull
+	}
+}
+
+// ReadMessage returns the next message from the server. After the session is
+// closed a *websocket.CloseError is returned, as with websocket.
+func (c *Client) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-c.in:
+		return msg.typ, msg.data, nil
+	case <-c.done:
+		select {
+		case msg := <-c.in:
+			return msg.typ, msg.data, nil
+		default:
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return 0, nil, c.closeErr
+	}
+}
+
+// Close tells the server to close the session.
+func (c *Client) Close(code int, reason string) error {
+	if !c.stopping() {
+		return nil
+	}
+	defer c.finish(&websocket.CloseError{Code: code, Text: reason})
+	query := url.Values{"code": {strconv.Itoa(code)}, "reason": {reason}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("close", query), nil)
+	if err != nil {
+		return errs.WrapMsg(err, "longpoll close failed", "sessionID", c.sid)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errs.WrapMsg(err, "longpoll close failed", "sessionID", c.sid)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// stopping stops the poll and send loops and reports whether this call did it.
+func (c *Client) stopping() bool {
+	stopped := false
+	c.stopOnce.Do(func() {
+		close(c.stop)
+		stopped = true
+	})
+	return stopped
+}
+
+func (c *Client) finish(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeErr != nil {
+		return
+	}
+	c.closeErr = err
+	close(c.done)
+}
+
+func (c *Client) pollLoop() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var ack int64
+	for {
+		resp, err := c.poll(ctx, ack)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.stopping()
+				c.finish(err)
+			}
+			return
+		}
+		for _, msg := range resp.Messages {
+			if msg.Seq <= ack {
+				continue
+			}
+			select {
+			case c.in <- inbound{typ: msg.Type, data: msg.Data}:
+			case <-c.stop:
+				return
+			}
+			ack = msg.Seq
+		}
+		if resp.Closed {
+			c.stopping()
+			c.finish(&websocket.CloseError{Code: resp.Code, Text: resp.Reason})
+			return
+		}
+	}
+}
+
+func (c *Client) poll(ctx context.Context, ack int64) (*PollResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url("poll", url.Values{"ack": {strconv.FormatInt(ack, 10)}}), nil)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "longpoll poll failed", "sessionID", c.sid)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "longpoll poll failed", "sessionID", c.sid)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errs.New("longpoll poll failed", "sessionID", c.sid, "status", resp.StatusCode).Wrap()
+	}
+	var res PollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, errs.WrapMsg(err, "longpoll poll response invalid", "sessionID", c.sid)
+	}
+	return &res, nil
+}
+
+func (c *Client) sendLoop() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case msg := <-c.out:
+			query := url.Values{"type": {strconv.Itoa(msg.typ)}}
+			resp, err := c.http.Post(c.url("send", query), "application/octet-stream", bytes.NewReader(msg.data))
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusNoContent {
+					err = errs.New("longpoll send failed", "status", resp.StatusCode).Wrap()
+				}
+			}
+			if err != nil {
+				if c.stopping() {
+					c.finish(errs.WrapMsg(err, "longpoll send failed", "sessionID", c.sid))
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openimsdk/tools/utils/wsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echo serves a Transport the way a gateway would, echoing every message.
+func echo(t wsutil.Transport, closed chan<- error) {
+	for {
+		typ, data, err := t.ReadMessage()
+		if err != nil {
+			closed <- err
+			return
+		}
+		if err := t.Send(context.Background(), typ, data); err != nil {
+			closed <- err
+			return
+		}
+	}
+}
+
+func newServer(t *testing.T, conf *Config) (*Manager, string, chan *Session, chan error) {
+	sessions := make(chan *Session, 10)
+	closed := make(chan error, 10)
+	m := NewManager(conf, func(r *http.Request, s *Session) error {
+		if r.Header.Get("token") != "ok" {
+			return assert.AnError
+		}
+		sessions <- s
+		go echo(s, closed)
+		return nil
+	})
+	srv := httptest.NewServer(http.StripPrefix("/lp", m))
+	t.Cleanup(func() {
+		m.Close()
+		srv.Close()
+	})
+	return m, srv.URL + "/lp", sessions, closed
+}
+
+var okHeader = http.Header{"Token": {"ok"}}
+
+func TestEcho(t *testing.T) {
+	m, url, _, serverClosed := newServer(t, nil)
+	c, err := Dial(context.Background(), url, okHeader, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Len())
+
+	for _, msg := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Send(context.Background(), wsutil.TextMessage, []byte(msg)))
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		typ, data, err := c.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, wsutil.TextMessage, typ)
+		assert.Equal(t, want, string(data))
+	}
+
+	require.NoError(t, c.Close(websocket.CloseNormalClosure, "bye"))
+	err = <-serverClosed
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+	assert.Equal(t, 0, m.Len())
+	assert.ErrorIs(t, c.Send(context.Background(), wsutil.TextMessage, nil), wsutil.ErrClosed)
+}
+
+func TestRejected(t *testing.T) {
+	m, url, _, _ := newServer(t, nil)
+	_, err := Dial(context.Background(), url, nil, nil, 0)
+	assert.Error(t, err)
+	assert.Equal(t, 0, m.Len())
+}
+
+func TestServerClose(t *testing.T) {
+	_, url, sessions, _ := newServer(t, nil)
+	c, err := Dial(context.Background(), url, okHeader, nil, 0)
+	require.NoError(t, err)
+	s := <-sessions
+	require.NoError(t, s.Send(context.Background(), wsutil.BinaryMessage, []byte{1}))
+	require.NoError(t, s.Close(websocket.ClosePolicyViolation, "kicked"))
+
+	_, data, err := c.ReadMessage()
+	require.NoError(t, err, "queued messages are delivered before the close")
+	assert.Equal(t, []byte{1}, data)
+	_, _, err = c.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation), err)
+	<-c.Done()
+}
+
+func pollRaw(t *testing.T, url, sid string, ack int) *PollResponse {
+	resp, err := http.Get(url + "/poll?sid=" + sid + "&ack=" + strconv.Itoa(ack))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var res PollResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	return &res
+}
+
+func TestRedeliveryUntilAck(t *testing.T) {
+	_, url, sessions, _ := newServer(t, &Config{PollTimeout: 20 * time.Millisecond, MaxBatch: 2})
+	req, _ := http.NewRequest(http.MethodPost, url+"/open", nil)
+	req.Header = okHeader
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var open openResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&open))
+	resp.Body.Close()
+	s := <-sessions
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.TrySend(wsutil.TextMessage, []byte{'a' + byte(i)}))
+	}
+	res := pollRaw(t, url, open.SessionID, 0)
+	require.Len(t, res.Messages, 2)
+	assert.Equal(t, int64(1), res.Messages[0].Seq)
+	// The response was "lost", polling again without ack returns the same messages.
+	res = pollRaw(t, url, open.SessionID, 0)
+	require.Len(t, res.Messages, 2)
+	assert.Equal(t, 3, s.QueueLen())
+
+	res = pollRaw(t, url, open.SessionID, 2)
+	require.Len(t, res.Messages, 1)
+	assert.Equal(t, []byte("c"), res.Messages[0].Data)
+	res = pollRaw(t, url, open.SessionID, 3)
+	assert.Empty(t, res.Messages)
+	assert.Equal(t, 0, s.QueueLen())
+}
+
+func TestBackpressure(t *testing.T) {
+	_, url, sessions, _ := newServer(t, &Config{QueueSize: 1, PollTimeout: 20 * time.Millisecond})
+	req, _ := http.NewRequest(http.MethodPost, url+"/open", nil)
+	req.Header = okHeader
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	var open openResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&open))
+	resp.Body.Close()
+	s := <-sessions
+
+	require.NoError(t, s.TrySend(wsutil.TextMessage, []byte("1")))
+	assert.ErrorIs(t, s.TrySend(wsutil.TextMessage, []byte("2")), wsutil.ErrQueueFull)
+
+	sent := make(chan error, 1)
+	go func() { sent <- s.Send(context.Background(), wsutil.TextMessage, []byte("2")) }()
+	select {
+	case <-sent:
+		t.Fatal("send should block until the client acknowledges")
+	case <-time.After(20 * time.Millisecond):
+	}
+	pollRaw(t, url, open.SessionID, 1)
+	require.NoError(t, <-sent)
+}
+
+func TestExpire(t *testing.T) {
+	m, url, _, serverClosed := newServer(t, &Config{SessionTimeout: 40 * time.Millisecond})
+	req, _ := http.NewRequest(http.MethodPost, url+"/open", nil)
+	req.Header = okHeader
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, m.Len())
+
+	err = <-serverClosed
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	assert.Equal(t, 0, m.Len())
+}
@@ -0,0 +1,305 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package longpoll is an HTTP long-polling fallback for clients whose proxies
+// block websocket. Sessions implement wsutil.Transport so the gateway serves
+// them like websocket connections.
+//
+// The protocol has four endpoints below the handler's mount point:
+//
+//	POST open                  creates a session and returns {"sessionID": "..."}
+//	GET  poll?sid=ID&ack=SEQ   acknowledges messages up to SEQ and waits for newer ones
+//	POST send?sid=ID&type=T    delivers the request body as one message of type T
+//	POST close?sid=ID&code=C   closes the session
+//
+// Messages stay queued until acknowledged, so a poll response lost on the way
+// is delivered again by the next poll.
+package longpoll
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openimsdk/tools/log"
+	"github.com/openimsdk/tools/utils/wsutil"
+)
+
+// Config configures a Manager. Zero fields take the defaults below.
+type Config struct {
+	PollTimeout    time.Duration // Time a poll waits for messages before returning empty.
+	SessionTimeout time.Duration // Sessions without a poll for this long are closed.
+	QueueSize      int           // Maximum unacknowledged messages per direction.
+	MaxBatch       int           // Maximum messages returned by one poll.
+	MaxMessageSize int64         // Maximum size of a message sent by the client.
+}
+
+const (
+	DefaultPollTimeout    = 25 * time.Second
+	DefaultSessionTimeout = time.Minute
+	DefaultQueueSize      = 256
+	DefaultMaxBatch       = 100
+	DefaultMaxMessageSize = 1 << 20
+)
+
+func (c *Config) withDefaults() Config {
+	conf := Config{}
+	if c != nil {
+		conf = *c
+	}
+	if conf.PollTimeout <= 0 {
+		conf.PollTimeout = DefaultPollTimeout
+	}
+	if conf.SessionTimeout <= 0 {
+		conf.SessionTimeout = DefaultSessionTimeout
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = DefaultQueueSize
+	}
+	if conf.MaxBatch <= 0 {
+		conf.MaxBatch = DefaultMaxBatch
+	}
+	if conf.MaxMessageSize <= 0 {
+		conf.MaxMessageSize = DefaultMaxMessageSize
+	}
+	return conf
+}
+
+// Message is a server to client message as returned by poll.
+type Message struct {
+	Seq  int64  `json:"seq"`
+	Type int    `json:"type"`
+	Data []byte `json:"data"`
+}
+
+// PollResponse is the body returned by poll. Closed is set once the session
+// is closed and all queued messages have been returned.
+type PollResponse struct {
+	Messages []Message `json:"messages"`
+	Closed   bool      `json:"closed,omitempty"`
+	Code     int       `json:"code,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+type openResponse struct {
+	SessionID string `json:"sessionID"`
+}
+
+// OpenFunc is called for every new session with the request that opened it,
+// typically to authenticate it and start reading from the session. Returning
+// an error rejects the session.
+type OpenFunc func(r *http.Request, s *Session) error
+
+// Manager owns the long-polling sessions and serves the protocol endpoints.
+type Manager struct {
+	conf   Config
+	onOpen OpenFunc
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewManager creates a Manager and starts the goroutine expiring idle sessions.
+func NewManager(conf *Config, onOpen OpenFunc) *Manager {
+	m := &Manager{
+		conf:     conf.withDefaults(),
+		onOpen:   onOpen,
+		sessions: make(map[string]*Session),
+		stop:     make(chan struct{}),
+	}
+	go m.expireLoop()
+	return m
+}
+
+// Len returns the number of open sessions.
+func (m *Manager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Get returns the session with the given ID.
+func (m *Manager) Get(id string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// Close closes all sessions and stops the manager.
+func (m *Manager) Close() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	m.mu.Lock()
+	sessions := m.sessions
+	m.sessions = make(map[string]*Session)
+	m.mu.Unlock()
+	for _, s := range sessions {
+		_ = s.Close(websocket.CloseGoingAway, "server shutdown")
+	}
+}
+
+// ServeHTTP dispatches on the last path element: open, poll, send or close.
+func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "open":
+		m.handleOpen(w, r)
+	case "poll":
+		m.handlePoll(w, r)
+	case "send":
+		m.handleSend(w, r)
+	case "close":
+		m.handleClose(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *Manager) handleOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s := newSession(newSessionID(), m)
+	if m.onOpen != nil {
+		if err := m.onOpen(r, s); err != nil {
+			log.ZWarn(r.Context(), "longpoll session rejected", err, "remoteAddr", r.RemoteAddr)
+			s.closeLocal(websocket.ClosePolicyViolation, "rejected")
+			http.Error(w, "session rejected", http.StatusForbidden)
+			return
+		}
+	}
+	m.mu.Lock()
+	m.sessions[s.id] = s
+	m.mu.Unlock()
+	writeJSON(w, &openResponse{SessionID: s.id})
+}
+
+func (m *Manager) session(w http.ResponseWriter, r *http.Request) (*Session, bool) {
+	s, ok := m.Get(r.URL.Query().Get("sid"))
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+	}
+	return s, ok
+}
+
+func (m *Manager) handlePoll(w http.ResponseWriter, r *http.Request) {
+	s, ok := m.session(w, r)
+	if !ok {
+		return
+	}
+	ack, _ := strconv.ParseInt(r.URL.Query().Get("ack"), 10, 64)
+	ctx, cancel := context.WithTimeout(r.Context(), m.conf.PollTimeout)
+	defer cancel()
+	resp := s.poll(ctx, ack)
+	if resp.Closed {
+		m.remove(s)
+	}
+	writeJSON(w, resp)
+}
+
+func (m *Manager) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	s, ok := m.session(w, r)
+	if !ok {
+		return
+	}
+	typ := wsutil.BinaryMessage
+	if t, err := strconv.Atoi(r.URL.Query().Get("type")); err == nil && t == wsutil.TextMessage {
+		typ = wsutil.TextMessage
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, m.conf.MaxMessageSize))
+	if err != nil {
+		http.Error(w, "message too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := s.receive(r.Context(), typ, data); err != nil {
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) handleClose(w http.ResponseWriter, r *http.Request) {
+	s, ok := m.session(w, r)
+	if !ok {
+		return
+	}
+	code, err := strconv.Atoi(r.URL.Query().Get("code"))
+	if err != nil {
+		code = websocket.CloseNormalClosure
+	}
+	s.closeRemote(code, r.URL.Query().Get("reason"))
+	m.remove(s)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) remove(s *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sessions[s.id] == s {
+		delete(m.sessions, s.id)
+	}
+}
+
+func (m *Manager) expireLoop() {
+	ticker := time.NewTicker(m.conf.SessionTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			var expired []*Session
+			for _, s := range m.sessions {
+				if s.idleSince(now) > m.conf.SessionTimeout {
+					expired = append(expired, s)
+					delete(m.sessions, s.id)
+				}
+			}
+			m.mu.Unlock()
+			for _, s := range expired {
+				s.closeRemote(websocket.CloseGoingAway, "session expired")
+			}
+		}
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.ZDebug(context.Background(), "longpoll write response failed", "err", err)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package longpoll
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/utils/wsutil"
+)
+
+type inbound struct {
+	typ  int
+	data []byte
+}
+
+// Session is the server side of a long-polling client.
+type Session struct {
+	id   string
+	conf Config
+
+	mu         sync.Mutex
+	out        []Message
+	seq        int64
+	changed    chan struct{}
+	polling    int
+	lastActive time.Time
+	closed     bool
+	closeErr   *websocket.CloseError
+
+	in   chan inbound
+	done chan struct{}
+}
+
+var _ wsutil.Transport = (*Session)(nil)
+
+func newSession(id string, m *Manager) *Session {
+	return &Session{
+		id:         id,
+		conf:       m.conf,
+		changed:    make(chan struct{}),
+		lastActive: time.Now(),
+		in:         make(chan inbound, m.conf.QueueSize),
+		done:       make(chan struct{}),
+	}
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// Done is closed once the session is closed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// QueueLen returns the number of messages not yet acknowledged by the client.
+func (s *Session) QueueLen() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.out)
+}
+
+// broadcast wakes up everyone waiting on changed, s.mu must be held.
+func (s *Session) broadcast() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Send queues a message for the client, blocking while QueueSize messages are
+// waiting for acknowledgement.
+func (s *Session) Send(ctx context.Context, typ int, data []byte) error {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return wsutil.ErrClosed
+		}
+		if len(s.out) < s.conf.QueueSize {
+			s.push(typ, data)
+			s.mu.Unlock()
+			return nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return errs.WrapMsg(ctx.Err(), "longpoll send canceled", "sessionID", s.id)
+		}
+	}
+}
+
+// TrySend queues a message or returns wsutil.ErrQueueFull.
+func (s *Session) TrySend(typ int, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return wsutil.ErrClosed
+	}
+	if len(s.out) >= s.conf.QueueSize {
+		return wsutil.ErrQueueFull
+	}
+	s.push(typ, data)
+	return nil
+}
+
+func (s *Session) push(typ int, data []byte) {
+	s.seq++
+	s.out = append(s.out, Message{Seq: s.seq, Type: typ, Data: data})
+	s.broadcast()
+}
+
+// ReadMessage returns the next message sent by the client. After the client
+// closed the session a *websocket.CloseError is returned, as with websocket.
+func (s *Session) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-s.in:
+		return msg.typ, msg.data, nil
+	case <-s.done:
+		select {
+		case msg := <-s.in:
+			return msg.typ, msg.data, nil
+		default:
+		}
+		return 0, nil, s.closeErr
+	}
+}
+
+// Close closes the session. Messages still queued are delivered by the next
+// poll together with the close code and reason.
+func (s *Session) Close(code int, reason string) error {
+	s.closeLocal(code, reason)
+	return nil
+}
+
+func (s *Session) closeLocal(code int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closeErr = &websocket.CloseError{Code: code, Text: reason}
+	s.broadcast()
+	close(s.done)
+}
+
+// closeRemote closes the session on behalf of the client, dropping queued messages.
+func (s *Session) closeRemote(code int, reason string) {
+	s.closeLocal(code, reason)
+	s.mu.Lock()
+	s.out = nil
+	s.mu.Unlock()
+}
+
+func (s *Session) receive(ctx context.Context, typ int, data []byte) error {
+	select {
+	case <-s.done:
+		return wsutil.ErrClosed
+	default:
+	}
+	select {
+	case s.in <- inbound{typ: typ, data: data}:
+		return nil
+	case <-s.done:
+		return wsutil.ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Session) idleSince(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.polling > 0 {
+		return 0
+	}
+	return now.Sub(s.lastActive)
+}
+
+// poll drops messages up to ack and waits until ctx is done for newer ones.
+func (s *Session) poll(ctx context.Context, ack int64) *PollResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polling++
+	defer func() {
+		s.polling--
+		s.lastActive = time.Now()
+	}()
+	if n := acked(s.out, ack); n > 0 {
+		s.out = append(s.out[:0:0], s.out[n:]...)
+		s.broadcast()
+	}
+	for len(s.out) == 0 && !s.closed {
+		changed := s.changed
+		s.mu.Unlock()
+		select {
+		case <-changed:
+			s.mu.Lock()
+		case <-ctx.Done():
+			s.mu.Lock()
+			return &PollResponse{Messages: []Message{}}
+		}
+	}
+	resp := &PollResponse{Messages: s.out[:min(len(s.out), s.conf.MaxBatch)]}
+	if s.closed && len(resp.Messages) == len(s.out) {
+		resp.Closed = true
+		resp.Code = s.closeErr.Code
+		resp.Reason = s.closeErr.Text
+	}
+	return resp
+}
+
+func acked(out []Message, ack int64) int {
+	n := 0
+	for n < len(out) && out[n].Seq <= ack {
+		n++
+	}
+	return n
+}
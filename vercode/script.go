@@ -0,0 +1,91 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vercode
+
+import "github.com/redis/go-redis/v9"
+
+// limitScript counts a send in a fixed window and returns the milliseconds
+// until the window resets when the limit is already reached, 0 otherwise.
+// KEYS[1] counter, ARGV[1] max, ARGV[2] window in milliseconds.
+var limitScript = redis.NewScript(`
+local n = tonumber(redis.call('GET', KEYS[1]) or '0')
+if n >= tonumber(ARGV[1]) then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl <= 0 then ttl = 1 end
+	return ttl
+end
+if redis.call('INCR', KEYS[1]) == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+const (
+	issueOK       = 0
+	issueCooldown = 1
+	issueLimited  = 2
+)
+
+// issueScript checks the cooldown and the account limit, then stores the code
+// with a zero attempt counter. It returns {status, retry after in milliseconds}.
+// KEYS[1] code, KEYS[2] cooldown, KEYS[3] account counter.
+// ARGV[1] code, ARGV[2] ttl, ARGV[3] cooldown, ARGV[4] account max, ARGV[5] account window.
+var issueScript = redis.NewScript(`
+local wait = redis.call('PTTL', KEYS[2])
+if wait > 0 then
+	return {1, wait}
+end
+local max = tonumber(ARGV[4])
+if max > 0 then
+	local n = tonumber(redis.call('GET', KEYS[3]) or '0')
+	if n >= max then
+		local ttl = redis.call('PTTL', KEYS[3])
+		if ttl <= 0 then ttl = 1 end
+		return {2, ttl}
+	end
+	if redis.call('INCR', KEYS[3]) == 1 then
+		redis.call('PEXPIRE', KEYS[3], ARGV[5])
+	end
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'code', ARGV[1], 'attempts', 0)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+end
+return {0, 0}
+`)
+
+const (
+	attemptMissing  = 0
+	attemptExceeded = -1
+)
+
+// attemptScript counts a verification attempt and returns {attempts, code}.
+// Attempts is 0 when no code exists and -1 when the code was discarded after
+// exceeding the maximum.
+// KEYS[1] code, ARGV[1] max attempts.
+var attemptScript = redis.NewScript(`
+local code = redis.call('HGET', KEYS[1], 'code')
+if not code then
+	return {0, ''}
+end
+local n = redis.call('HINCRBY', KEYS[1], 'attempts', 1)
+if n > tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+	return {-1, ''}
+end
+return {n, code}
+`)
@@ -0,0 +1,255 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package vercode issues and verifies one-time verification codes stored in
+// Redis. It limits how often codes are sent per account and per IP, bounds
+// the number of verification attempts and compares codes in constant time.
+package vercode
+
+import (
+	"context"
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/notify"
+	"github.com/openimsdk/tools/utils/randutil"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	CodeMismatchError      = 1821 // The code does not match the issued one.
+	CodeExpiredError       = 1822 // No code was issued, it expired or it was already used.
+	TooManyAttemptsError   = 1823 // Too many wrong codes were entered, a new code must be requested.
+	SendTooFrequentError   = 1824 // A code was sent to the account within the cooldown.
+	SendLimitExceededError = 1825 // The account or IP reached its send limit for the window.
+)
+
+var (
+	ErrCodeMismatch      = errs.NewCodeError(CodeMismatchError, "CodeMismatchError")
+	ErrCodeExpired       = errs.NewCodeError(CodeExpiredError, "CodeExpiredError")
+	ErrTooManyAttempts   = errs.NewCodeError(TooManyAttemptsError, "TooManyAttemptsError")
+	ErrSendTooFrequent   = errs.NewCodeError(SendTooFrequentError, "SendTooFrequentError")
+	ErrSendLimitExceeded = errs.NewCodeError(SendLimitExceededError, "SendLimitExceededError")
+)
+
+// Charset is the set of characters codes are drawn from.
+type Charset string
+
+const (
+	Numeric Charset = "0123456789"
+	// Alphanumeric leaves out characters that are easily confused: 0, 1, I and O.
+	Alphanumeric Charset = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// Limit allows Max sends per fixed Window. A zero Max disables the limit.
+type Limit struct {
+	Max    int
+	Window time.Duration
+}
+
+// Config configures a Manager.
+type Config struct {
+	Length      int           // Code length, defaults to 6.
+	Charset     Charset       // Defaults to Numeric.
+	TTL         time.Duration // How long a code stays valid, defaults to 5 minutes.
+	MaxAttempts int           // Wrong codes accepted before the code is discarded, defaults to 5.
+	Cooldown    time.Duration // Minimum interval between two codes for the same account and scene.
+	Account     Limit         // Sends per account across all scenes.
+	IP          Limit         // Sends per client IP across all accounts.
+	KeyPrefix   string        // Defaults to "VERCODE:".
+	// Template is the notify template used by Send. It is rendered with the
+	// caller params plus "code" and "minutes".
+	Template string
+}
+
+func (c *Config) setDefaults() error {
+	if c.Length <= 0 {
+		c.Length = 6
+	}
+	if c.Charset == "" {
+		c.Charset = Numeric
+	}
+	if c.TTL <= 0 {
+		c.TTL = 5 * time.Minute
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = "VERCODE:"
+	}
+	if c.Account.Max > 0 && c.Account.Window <= 0 {
+		return errs.ErrArgs.WrapMsg("account limit window must be positive")
+	}
+	if c.IP.Max > 0 && c.IP.Window <= 0 {
+		return errs.ErrArgs.WrapMsg("ip limit window must be positive")
+	}
+	return nil
+}
+
+// Target identifies who a code is issued to.
+type Target struct {
+	Scene   string // The flow the code belongs to, e.g. "register" or "reset_password".
+	Account string // Phone number or email address.
+	IP      string // Client IP, optional.
+}
+
+// Manager issues and verifies codes.
+type Manager struct {
+	rdb      redis.UniversalClient
+	conf     Config
+	notifier *notify.Notifier
+}
+
+// New creates a Manager. The notifier is only required by Send and may be nil.
+func New(rdb redis.UniversalClient, conf Config, notifier *notify.Notifier) (*Manager, error) {
+	if err := conf.setDefaults(); err != nil {
+		return nil, err
+	}
+	return &Manager{rdb: rdb, conf: conf, notifier: notifier}, nil
+}
+
+// All keys of an account share the account hash tag so that the issue script
+// only touches a single cluster slot.
+func (m *Manager) codeKey(t *Target) string {
+	return m.conf.KeyPrefix + "{" + t.Account + "}:code:" + t.Scene
+}
+
+func (m *Manager) cooldownKey(t *Target) string {
+	return m.conf.KeyPrefix + "{" + t.Account + "}:cooldown:" + t.Scene
+}
+
+func (m *Manager) accountKey(t *Target) string {
+	return m.conf.KeyPrefix + "{" + t.Account + "}:count"
+}
+
+func (m *Manager) ipKey(ip string) string {
+	return m.conf.KeyPrefix + "ip:" + ip
+}
+
+// Generate checks the send limits, then issues and stores a new code for the
+// target, replacing any previous code of the same scene.
+func (m *Manager) Generate(ctx context.Context, t *Target) (string, error) {
+	if t.Scene == "" || t.Account == "" {
+		return "", errs.ErrArgs.WrapMsg("scene and account are required")
+	}
+	if t.IP != "" && m.conf.IP.Max > 0 {
+		wait, err := limitScript.Run(ctx, m.rdb, []string{m.ipKey(t.IP)}, m.conf.IP.Max, m.conf.IP.Window.Milliseconds()).Int64()
+		if err != nil {
+			return "", errs.WrapMsg(err, "vercode ip limit failed", "ip", t.IP)
+		}
+		if wait > 0 {
+			return "", ErrSendLimitExceeded.WrapMsg("ip send limit exceeded", "ip", t.IP, "retryAfter", time.Duration(wait)*time.Millisecond)
+		}
+	}
+	code, err := m.newCode()
+	if err != nil {
+		return "", err
+	}
+	keys := []string{m.codeKey(t), m.cooldownKey(t), m.accountKey(t)}
+	args := []any{code, m.conf.TTL.Milliseconds(), m.conf.Cooldown.Milliseconds(), m.conf.Account.Max, m.conf.Account.Window.Milliseconds()}
+	res, err := issueScript.Run(ctx, m.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		return "", errs.WrapMsg(err, "vercode issue failed", "scene", t.Scene, "account", t.Account)
+	}
+	retryAfter := time.Duration(res[1]) * time.Millisecond
+	switch res[0] {
+	case issueOK:
+		return code, nil
+	case issueCooldown:
+		return "", ErrSendTooFrequent.WrapMsg("code sent too frequently", "account", t.Account, "retryAfter", retryAfter)
+	default:
+		return "", ErrSendLimitExceeded.WrapMsg("account send limit exceeded", "account", t.Account, "retryAfter", retryAfter)
+	}
+}
+
+// Send generates a code and delivers it to the account through the notifier
+// using the configured template. If delivery fails the code and cooldown are
+// dropped so the user can ask again immediately.
+func (m *Manager) Send(ctx context.Context, channel notify.Channel, t *Target, params map[string]string) error {
+	if m.notifier == nil {
+		return errs.New("vercode notifier not configured").Wrap()
+	}
+	code, err := m.Generate(ctx, t)
+	if err != nil {
+		return err
+	}
+	p := make(map[string]string, len(params)+2)
+	for k, v := range params {
+		p[k] = v
+	}
+	p["code"] = code
+	p["minutes"] = strconv.Itoa(int(m.conf.TTL / time.Minute))
+	if _, err := m.notifier.Send(ctx, channel, t.Account, m.conf.Template, p); err != nil {
+		if delErr := m.rdb.Del(ctx, m.codeKey(t), m.cooldownKey(t)).Err(); delErr != nil {
+			return errs.WrapMsg(delErr, "vercode discard failed", "account", t.Account)
+		}
+		return err
+	}
+	return nil
+}
+
+// Verify checks code against the code issued for the account and scene. A
+// matching code is consumed, a wrong one counts as an attempt and the code is
+// discarded once MaxAttempts is exceeded.
+func (m *Manager) Verify(ctx context.Context, scene string, account string, code string) error {
+	t := &Target{Scene: scene, Account: account}
+	key := m.codeKey(t)
+	res, err := attemptScript.Run(ctx, m.rdb, []string{key}, m.conf.MaxAttempts).Slice()
+	if err != nil {
+		return errs.WrapMsg(err, "vercode verify failed", "scene", scene, "account", account)
+	}
+	attempts, _ := res[0].(int64)
+	switch attempts {
+	case attemptMissing:
+		return ErrCodeExpired.WrapMsg("code expired or not issued", "scene", scene, "account", account)
+	case attemptExceeded:
+		return ErrTooManyAttempts.WrapMsg("too many attempts", "scene", scene, "account", account)
+	}
+	stored, _ := res[1].(string)
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(code)) != 1 {
+		return ErrCodeMismatch.WrapMsg("code mismatch", "scene", scene, "account", account, "remaining", int64(m.conf.MaxAttempts)-attempts)
+	}
+	// Only one concurrent caller may consume the code.
+	n, err := m.rdb.Del(ctx, key).Result()
+	if err != nil {
+		return errs.WrapMsg(err, "vercode consume failed", "scene", scene, "account", account)
+	}
+	if n == 0 {
+		return ErrCodeExpired.WrapMsg("code already used", "scene", scene, "account", account)
+	}
+	return nil
+}
+
+// Invalidate discards the code issued for the account and scene.
+func (m *Manager) Invalidate(ctx context.Context, scene string, account string) error {
+	if err := m.rdb.Del(ctx, m.codeKey(&Target{Scene: scene, Account: account})).Err(); err != nil {
+		return errs.WrapMsg(err, "vercode invalidate failed", "scene", scene, "account", account)
+	}
+	return nil
+}
+
+func (m *Manager) newCode() (string, error) {
+	return randomCode(m.conf.Charset, m.conf.Length)
+}
+
+func randomCode(charset Charset, length int) (string, error) {
+	code, err := randutil.SecureString(string(charset), length)
+	if err != nil {
+		return "", errs.WrapMsg(err, "generate code failed")
+	}
+	return code, nil
+}
@@ -0,0 +1,109 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vercode
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/notify"
+	"github.com/openimsdk/tools/testutil/containers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandomCode(t *testing.T) {
+	for _, charset := range []Charset{Numeric, Alphanumeric} {
+		code, err := randomCode(charset, 8)
+		require.NoError(t, err)
+		assert.Len(t, code, 8)
+		for _, c := range code {
+			assert.True(t, strings.ContainsRune(string(charset), c))
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	conf := Config{}
+	require.NoError(t, conf.setDefaults())
+	assert.Equal(t, 6, conf.Length)
+	assert.Equal(t, Numeric, conf.Charset)
+	assert.Equal(t, 5*time.Minute, conf.TTL)
+
+	conf = Config{Account: Limit{Max: 3}}
+	assert.True(t, errs.ErrArgs.Is(conf.setDefaults()))
+}
+
+type codeSender struct {
+	last string
+}
+
+func (s *codeSender) Name() string            { return "test" }
+func (s *codeSender) Channel() notify.Channel { return notify.ChannelSMS }
+
+func (s *codeSender) Send(ctx context.Context, msg *notify.Message) (*notify.Result, error) {
+	s.last = msg.Body
+	return &notify.Result{}, nil
+}
+
+func TestManager(t *testing.T) {
+	rdb := containers.Redis(t)
+	ctx := context.Background()
+	conf := Config{
+		MaxAttempts: 2,
+		Cooldown:    time.Minute,
+		Account:     Limit{Max: 2, Window: time.Hour},
+		IP:          Limit{Max: 4, Window: time.Hour},
+		KeyPrefix:   "VERCODE_TEST:" + time.Now().Format("150405.000") + ":",
+		Template:    "code",
+	}
+	sender := &codeSender{}
+	n := notify.New(notify.WithSender(sender), notify.WithTemplate("code", &notify.Template{Body: "{{.code}}"}))
+	m, err := New(rdb, conf, n)
+	require.NoError(t, err)
+
+	target := &Target{Scene: "register", Account: "+8613800000000", IP: "10.0.0.1"}
+	require.NoError(t, m.Send(ctx, notify.ChannelSMS, target, nil))
+	code := sender.last
+	assert.Len(t, code, 6)
+
+	_, err = m.Generate(ctx, target)
+	assert.True(t, ErrSendTooFrequent.Is(err))
+
+	assert.True(t, ErrCodeMismatch.Is(m.Verify(ctx, "register", target.Account, "xxxxxx")))
+	require.NoError(t, m.Verify(ctx, "register", target.Account, code))
+	assert.True(t, ErrCodeExpired.Is(m.Verify(ctx, "register", target.Account, code)))
+
+	// A different scene has its own cooldown but shares the account limit.
+	login := &Target{Scene: "login", Account: target.Account, IP: target.IP}
+	code, err = m.Generate(ctx, login)
+	require.NoError(t, err)
+	assert.True(t, ErrCodeMismatch.Is(m.Verify(ctx, "login", login.Account, "1")))
+	assert.True(t, ErrCodeMismatch.Is(m.Verify(ctx, "login", login.Account, "2")))
+	assert.True(t, ErrTooManyAttempts.Is(m.Verify(ctx, "login", login.Account, code)))
+	assert.True(t, ErrCodeExpired.Is(m.Verify(ctx, "login", login.Account, code)))
+
+	_, err = m.Generate(ctx, &Target{Scene: "reset", Account: target.Account})
+	assert.True(t, ErrSendLimitExceeded.Is(err))
+
+	// Requests rejected by the cooldown still count against the IP limit.
+	_, err = m.Generate(ctx, &Target{Scene: "register", Account: "a@example.com", IP: target.IP})
+	require.NoError(t, err)
+	_, err = m.Generate(ctx, &Target{Scene: "register", Account: "b@example.com", IP: target.IP})
+	assert.True(t, ErrSendLimitExceeded.Is(err))
+}
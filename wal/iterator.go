@@ -0,0 +1,152 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/openimsdk/tools/errs"
+)
+
+// Iterator reads records in order. At the end of the log Next returns io.EOF;
+// calling it again later returns records written in the meantime, so an
+// Iterator can tail the log.
+type Iterator struct {
+	w     *WAL
+	seg   segment
+	file  *os.File
+	r     *bufio.Reader
+	off   int64
+	index uint64 // Index of the record Next returns.
+	// sealed is set once a later segment was seen, so the end of the
+	// current one is final.
+	sealed bool
+}
+
+// Iterator returns an Iterator starting at index. Indexes before FirstIndex
+// start at FirstIndex.
+func (w *WAL) Iterator(index uint64) (*Iterator, error) {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, ErrClosed.Wrap()
+	}
+	if index > w.next {
+		next := w.next
+		w.mu.Unlock()
+		return nil, errs.ErrArgs.WrapMsg("wal index out of range", "index", index, "next", next)
+	}
+	if index < w.segments[0].first {
+		index = w.segments[0].first
+	}
+	seg := w.segments[0]
+	for _, s := range w.segments {
+		if s.first <= index {
+			seg = s
+		}
+	}
+	w.mu.Unlock()
+	it := &Iterator{w: w}
+	if err := it.open(seg); err != nil {
+		return nil, err
+	}
+	for it.index < index {
+		if _, _, err := it.Next(); err != nil {
+			it.Close()
+			return nil, err
+		}
+	}
+	return it, nil
+}
+
+func (it *Iterator) open(seg segment) error {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return errs.WrapMsg(err, "open wal segment failed", "path", seg.path)
+	}
+	if it.file != nil {
+		it.file.Close()
+	}
+	it.seg = seg
+	it.file = f
+	it.r = bufio.NewReader(f)
+	it.off = 0
+	it.index = seg.first
+	it.sealed = false
+	return nil
+}
+
+// nextSegment returns the segment following the current one, if any.
+func (it *Iterator) nextSegment() (segment, bool) {
+	it.w.mu.Lock()
+	defer it.w.mu.Unlock()
+	for _, s := range it.w.segments {
+		if s.first > it.seg.first {
+			return s, true
+		}
+	}
+	return segment{}, false
+}
+
+// Next returns the next record and its index.
+func (it *Iterator) Next() (uint64, []byte, error) {
+	for {
+		data, err := readRecord(it.r, it.w.conf.MaxRecordSize)
+		if err == nil {
+			index := it.index
+			it.index++
+			it.off += headerSize + int64(len(data))
+			return index, data, nil
+		}
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, errs.WrapMsg(err, "wal read failed", "path", it.seg.path, "index", it.index)
+		}
+		if it.sealed {
+			seg, ok := it.nextSegment()
+			if !ok {
+				return 0, nil, io.EOF
+			}
+			if err := it.open(seg); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		// The end of the segment, possibly in the middle of a record being
+		// written. Rewind to the record start and, if the segment was
+		// rotated meanwhile, read its final records before moving on.
+		if _, err := it.file.Seek(it.off, io.SeekStart); err != nil {
+			return 0, nil, errs.WrapMsg(err, "seek wal segment failed", "path", it.seg.path)
+		}
+		it.r.Reset(it.file)
+		if _, ok := it.nextSegment(); ok {
+			it.sealed = true
+			continue
+		}
+		return 0, nil, io.EOF
+	}
+}
+
+// Close releases the open segment.
+func (it *Iterator) Close() error {
+	if it.file == nil {
+		return nil
+	}
+	err := it.file.Close()
+	it.file = nil
+	return err
+}
@@ -0,0 +1,430 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wal implements an append-only, segmented write-ahead log. Records
+// are numbered from 1 and framed with their length and a CRC-32C checksum.
+// A torn record at the tail, left by a crash during a write, is cut off when
+// the log is opened. Typical use is buffering MQ publishes on local disk
+// while the broker is unavailable and replaying them once it is back.
+package wal
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openimsdk/tools/errs"
+	"github.com/openimsdk/tools/log"
+)
+
+const (
+	headerSize = 8 // Record length and CRC-32C, both little endian uint32.
+	segmentExt = ".wal"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	ErrCorrupt = errs.New("wal record corrupt")
+	ErrClosed  = errs.New("wal closed")
+)
+
+// SyncPolicy decides when written records are fsynced.
+type SyncPolicy int
+
+const (
+	SyncInterval SyncPolicy = iota // Fsync every Config.SyncInterval when there are new records.
+	SyncAlways                     // Fsync before every write returns.
+	SyncNever                      // Leave flushing to the operating system.
+)
+
+// Config configures a WAL.
+type Config struct {
+	Dir           string
+	SegmentSize   int64         // Size after which a new segment is started, defaults to 64 MiB.
+	Sync          SyncPolicy    // Defaults to SyncInterval.
+	SyncInterval  time.Duration // Defaults to 1 second.
+	MaxRecordSize int           // Larger records are rejected, defaults to 16 MiB.
+}
+
+func (c *Config) setDefaults() {
+	if c.SegmentSize <= 0 {
+		c.SegmentSize = 64 << 20
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = time.Second
+	}
+	if c.MaxRecordSize <= 0 {
+		c.MaxRecordSize = 16 << 20
+	}
+}
+
+type segment struct {
+	first uint64 // Index of the first record.
+	path  string
+}
+
+// WAL is a write-ahead log in a directory. It is safe for concurrent use.
+type WAL struct {
+	conf Config
+
+	mu       sync.Mutex
+	segments []segment
+	file     *os.File // Last segment, opened for appending.
+	size     int64
+	next     uint64
+	dirty    bool
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open opens the log in conf.Dir, creating it when missing.
+func Open(conf Config) (*WAL, error) {
+	conf.setDefaults()
+	if err := os.MkdirAll(conf.Dir, 0o755); err != nil {
+		return nil, errs.WrapMsg(err, "create wal dir failed", "dir", conf.Dir)
+	}
+	segments, err := listSegments(conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+	w := &WAL{conf: conf, segments: segments, done: make(chan struct{})}
+	if len(segments) == 0 {
+		if err := w.createSegment(1); err != nil {
+			return nil, err
+		}
+	} else if err := w.openLast(); err != nil {
+		return nil, err
+	}
+	if conf.Sync == SyncInterval {
+		w.wg.Add(1)
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+func segmentName(first uint64) string {
+	return fmt.Sprintf("%020d%s", first, segmentExt)
+}
+
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errs.WrapMsg(err, "read wal dir failed", "dir", dir)
+	}
+	var segments []segment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{first: first, path: filepath.Join(dir, name)})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].first < segments[j].first })
+	return segments, nil
+}
+
+// openLast scans the last segment, cuts off a torn tail and opens it for
+// appending. Earlier segments were synced when they were rotated.
+func (w *WAL) openLast() error {
+	last := w.segments[len(w.segments)-1]
+	f, err := os.OpenFile(last.path, os.O_RDWR, 0o644)
+	if err != nil {
+		return errs.WrapMsg(err, "open wal segment failed", "path", last.path)
+	}
+	var (
+		n   uint64
+		off int64
+	)
+	r := bufio.NewReader(f)
+	for {
+		data, err := readRecord(r, w.conf.MaxRecordSize)
+		if err == nil {
+			n++
+			off += headerSize + int64(len(data))
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, ErrCorrupt) {
+			log.ZWarn(context.Background(), "wal truncating torn tail", err, "path", last.path, "offset", off)
+			if err := f.Truncate(off); err != nil {
+				f.Close()
+				return errs.WrapMsg(err, "truncate wal segment failed", "path", last.path)
+			}
+			break
+		}
+		f.Close()
+		return errs.WrapMsg(err, "read wal segment failed", "path", last.path)
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return errs.WrapMsg(err, "seek wal segment failed", "path", last.path)
+	}
+	w.file = f
+	w.size = off
+	w.next = last.first + n
+	return nil
+}
+
+func (w *WAL) createSegment(first uint64) error {
+	path := filepath.Join(w.conf.Dir, segmentName(first))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errs.WrapMsg(err, "create wal segment failed", "path", path)
+	}
+	w.segments = append(w.segments, segment{first: first, path: path})
+	w.file = f
+	w.size = 0
+	w.next = first
+	return nil
+}
+
+func (w *WAL) rotate() error {
+	if err := w.file.Sync(); err != nil {
+		return errs.WrapMsg(err, "sync wal segment failed")
+	}
+	if err := w.file.Close(); err != nil {
+		return errs.WrapMsg(err, "close wal segment failed")
+	}
+	w.dirty = false
+	return w.createSegment(w.next)
+}
+
+func readRecord(r *bufio.Reader, maxSize int) ([]byte, error) {
+	var hdr [headerSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(hdr[:4])
+	sum := binary.LittleEndian.Uint32(hdr[4:])
+	if int64(n) > int64(maxSize) {
+		return nil, ErrCorrupt.WrapMsg("record too large", "size", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != sum {
+		return nil, ErrCorrupt.WrapMsg("checksum mismatch")
+	}
+	return data, nil
+}
+
+func appendRecord(buf []byte, data []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(data, crcTable))
+	return append(buf, data...)
+}
+
+// Write appends a record and returns its index.
+func (w *WAL) Write(data []byte) (uint64, error) {
+	return w.WriteBatch([][]byte{data})
+}
+
+// WriteBatch appends records and returns the index of the first one. The
+// records get consecutive indexes.
+func (w *WAL) WriteBatch(batch [][]byte) (uint64, error) {
+	for _, data := range batch {
+		if len(data) > w.conf.MaxRecordSize {
+			return 0, errs.ErrArgs.WrapMsg("wal record too large", "size", len(data), "max", w.conf.MaxRecordSize)
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrClosed.Wrap()
+	}
+	first := w.next
+	var buf []byte
+	for _, data := range batch {
+		n := int64(headerSize + len(data))
+		if size := w.size + int64(len(buf)); size > 0 && size+n > w.conf.SegmentSize {
+			if err := w.flush(buf); err != nil {
+				return 0, err
+			}
+			buf = buf[:0]
+			if err := w.rotate(); err != nil {
+				return 0, err
+			}
+		}
+		buf = appendRecord(buf, data)
+		w.next++
+	}
+	if err := w.flush(buf); err != nil {
+		return 0, err
+	}
+	if w.conf.Sync == SyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return 0, errs.WrapMsg(err, "sync wal segment failed")
+		}
+	} else {
+		w.dirty = true
+	}
+	return first, nil
+}
+
+// flush writes encoded records to the last segment. A failed write is cut
+// off again so later records do not follow garbage.
+func (w *WAL) flush(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		if terr := w.file.Truncate(w.size); terr == nil {
+			_, _ = w.file.Seek(w.size, io.SeekStart)
+		}
+		w.next = w.segments[len(w.segments)-1].first + w.countRecords()
+		return errs.WrapMsg(err, "write wal segment failed")
+	}
+	w.size += int64(len(buf))
+	return nil
+}
+
+// countRecords counts the records in the last segment after a failed write
+// reset it to w.size.
+func (w *WAL) countRecords() uint64 {
+	f, err := os.Open(w.segments[len(w.segments)-1].path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	r := bufio.NewReader(io.LimitReader(f, w.size))
+	var n uint64
+	for {
+		if _, err := readRecord(r, w.conf.MaxRecordSize); err != nil {
+			return n
+		}
+		n++
+	}
+}
+
+// Sync fsyncs the last segment.
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed.Wrap()
+	}
+	return w.sync()
+}
+
+func (w *WAL) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		return errs.WrapMsg(err, "sync wal segment failed")
+	}
+	w.dirty = false
+	return nil
+}
+
+func (w *WAL) syncLoop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.conf.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			if !w.closed {
+				if err := w.sync(); err != nil {
+					log.ZWarn(context.Background(), "wal sync failed", err, "dir", w.conf.Dir)
+				}
+			}
+			w.mu.Unlock()
+		}
+	}
+}
+
+// FirstIndex returns the index of the first record still kept. It may be
+// equal to LastIndex()+1 when the log is empty.
+func (w *WAL) FirstIndex() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.segments[0].first
+}
+
+// LastIndex returns the index of the last written record, 0 if none.
+func (w *WAL) LastIndex() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.next - 1
+}
+
+// TruncateFront removes segments whose records all precede index, e.g. after
+// they were replayed. The last segment is always kept, so records before
+// index may remain.
+func (w *WAL) TruncateFront(index uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrClosed.Wrap()
+	}
+	var n int
+	for n < len(w.segments)-1 && w.segments[n+1].first <= index {
+		if err := os.Remove(w.segments[n].path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.segments = w.segments[n:]
+			return errs.WrapMsg(err, "remove wal segment failed", "path", w.segments[0].path)
+		}
+		n++
+	}
+	w.segments = w.segments[n:]
+	return nil
+}
+
+// Close syncs and closes the log.
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	err := w.file.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	if err != nil {
+		return errs.WrapMsg(err, "close wal failed", "dir", w.conf.Dir)
+	}
+	return nil
+}
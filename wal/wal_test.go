@@ -0,0 +1,152 @@
+// Copyright © 2024 OpenIM open source community. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, w *WAL, from uint64) []string {
+	t.Helper()
+	it, err := w.Iterator(from)
+	require.NoError(t, err)
+	defer it.Close()
+	var res []string
+	for {
+		_, data, err := it.Next()
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		require.NoError(t, err)
+		res = append(res, string(data))
+	}
+}
+
+func TestWriteReplay(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Config{Dir: dir, Sync: SyncAlways})
+	require.NoError(t, err)
+	index, err := w.Write([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), index)
+	index, err = w.WriteBatch([][]byte{[]byte("b"), []byte(""), []byte("c")})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), index)
+	require.NoError(t, w.Close())
+
+	w, err = Open(Config{Dir: dir})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(4), w.LastIndex())
+	assert.Equal(t, []string{"a", "b", "", "c"}, readAll(t, w, 1))
+	assert.Equal(t, []string{"c"}, readAll(t, w, 4))
+	assert.Empty(t, readAll(t, w, 5))
+	_, err = w.Iterator(6)
+	assert.Error(t, err)
+}
+
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Config{Dir: dir, Sync: SyncNever})
+	require.NoError(t, err)
+	_, err = w.WriteBatch([][]byte{[]byte("first"), []byte("second")})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	path := w.segments[0].path
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-2))
+
+	w, err = Open(Config{Dir: dir, Sync: SyncNever})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), w.LastIndex())
+	_, err = w.Write([]byte("third"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "third"}, readAll(t, w, 1))
+	require.NoError(t, w.Close())
+}
+
+func TestCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Open(Config{Dir: dir, Sync: SyncNever})
+	require.NoError(t, err)
+	_, err = w.WriteBatch([][]byte{[]byte("first"), []byte("second")})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	path := w.segments[0].path
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[headerSize] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	w, err = Open(Config{Dir: dir, Sync: SyncNever})
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, uint64(0), w.LastIndex())
+}
+
+func TestRotateTruncate(t *testing.T) {
+	w, err := Open(Config{Dir: t.TempDir(), SegmentSize: 64, Sync: SyncNever})
+	require.NoError(t, err)
+	defer w.Close()
+	var want []string
+	for i := 0; i < 20; i++ {
+		s := fmt.Sprintf("record-%02d", i)
+		want = append(want, s)
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	assert.Greater(t, len(w.segments), 1)
+	assert.Equal(t, want, readAll(t, w, 1))
+	assert.Equal(t, want[9:], readAll(t, w, 10))
+
+	require.NoError(t, w.TruncateFront(10))
+	first := w.FirstIndex()
+	assert.LessOrEqual(t, first, uint64(10))
+	assert.Greater(t, first, uint64(1))
+	assert.Equal(t, want[first-1:], readAll(t, w, 1))
+}
+
+func TestTail(t *testing.T) {
+	w, err := Open(Config{Dir: t.TempDir(), SegmentSize: 32, Sync: SyncNever})
+	require.NoError(t, err)
+	defer w.Close()
+	it, err := w.Iterator(1)
+	require.NoError(t, err)
+	defer it.Close()
+	_, _, err = it.Next()
+	assert.True(t, errors.Is(err, io.EOF))
+	for i := 0; i < 5; i++ {
+		_, err := w.Write([]byte(fmt.Sprintf("record-%d", i)))
+		require.NoError(t, err)
+	}
+	for i := 0; i < 5; i++ {
+		index, data, err := it.Next()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), index)
+		assert.Equal(t, fmt.Sprintf("record-%d", i), string(data))
+	}
+	_, _, err = it.Next()
+	assert.True(t, errors.Is(err, io.EOF))
+}